@@ -0,0 +1,499 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/walterschell/chess-analyzer/chessanalysis"
+)
+
+// Account is a user logged in with an OAuth provider. Their analyses are
+// associated with it, and may be kept private to it, see ownership.
+type Account struct {
+	ID       string `json:"id"`       // Unique across providers, as in "lichess:thibault"
+	Name     string `json:"name"`     // As the provider shows it
+	Provider string `json:"provider"` // Such as "lichess"
+}
+
+// accountContextKey is the request context key of the account of the
+// request's session, see contextAccount
+type accountContextKey struct{}
+
+// withAccount returns the context holding the account a request was made with
+func withAccount(ctx context.Context, account *Account) context.Context {
+	return context.WithValue(ctx, accountContextKey{}, account)
+}
+
+// contextAccount returns the account a request was made with, or nil if its
+// user isn't logged in. The contexts of websocket connections hold the
+// account the connection was opened with.
+func contextAccount(ctx context.Context) *Account {
+	account, _ := ctx.Value(accountContextKey{}).(*Account)
+	return account
+}
+
+// errLoginRequired is returned for requests only logged-in users can make
+var errLoginRequired = errors.New("log in to keep analyses private")
+
+// errSideLoginRequired is returned when an anonymous user asks for their own
+// moves alone to be analyzed
+var errSideLoginRequired = errors.New("log in to analyze your own moves")
+
+// ownership is who a stored analysis belongs to. Analyses run without
+// logging in belong to nobody, and everyone sees and changes them.
+type ownership struct {
+	owner   string // ID of the Account that ran the analysis, or ""
+	private bool   // Whether only the owner sees it
+}
+
+// accountOwnership returns the ownership of public analyses run with the
+// context: by its account, if it has one
+func accountOwnership(ctx context.Context) ownership {
+	if account := contextAccount(ctx); account != nil {
+		return ownership{owner: account.ID}
+	}
+	return ownership{}
+}
+
+// requestOwnership returns the ownership of the analyses of a request: its
+// account's, private with the private query parameter
+func requestOwnership(r *http.Request) (ownership, error) {
+	owned := accountOwnership(r.Context())
+	if private := r.URL.Query().Get("private"); private != "" {
+		var err error
+		if owned.private, err = strconv.ParseBool(private); err != nil {
+			return owned, fmt.Errorf("invalid private %q", private)
+		}
+	}
+	if owned.private && owned.owner == "" {
+		return owned, errLoginRequired
+	}
+	return owned, nil
+}
+
+// ownershipErrorStatus returns the HTTP status of an error of
+// requestOwnership or requestSide
+func ownershipErrorStatus(err error) int {
+	if errors.Is(err, errLoginRequired) || errors.Is(err, errSideLoginRequired) {
+		return http.StatusUnauthorized
+	}
+	return http.StatusBadRequest
+}
+
+// visibleTo reports whether the account, nil for anonymous users, sees the
+// analysis
+func (o ownership) visibleTo(account *Account) bool {
+	return !o.private || o.ownedBy(account)
+}
+
+// editableBy reports whether the account may change the analysis, by
+// re-analyzing it or its notes
+func (o ownership) editableBy(account *Account) bool {
+	return o.owner == "" || o.ownedBy(account)
+}
+
+// ownedBy reports whether the analysis belongs to the account
+func (o ownership) ownedBy(account *Account) bool {
+	return account != nil && o.owner == account.ID
+}
+
+// storedAnalysis returns the stored analysis with the given ID, if it is
+// still stored and the account of the context sees it. Private analyses of
+// others are not found, so their IDs give nothing away.
+func (app *Application) storedAnalysis(ctx context.Context, id string) (storedAnalysis, bool) {
+	stored, ok := app.analyses.get(id)
+	if !ok || !stored.visibleTo(contextAccount(ctx)) {
+		return storedAnalysis{}, false
+	}
+	return stored, true
+}
+
+// OAuthConfig lets users log in with OAuth providers, Lichess for now
+type OAuthConfig struct {
+	Lichess *LichessOAuthConfig `json:"lichess,omitempty"`
+}
+
+// LichessOAuthConfig lets users log in with their Lichess accounts. Lichess
+// needs no registration or client secret, as logins use PKCE.
+type LichessOAuthConfig struct {
+	// ClientID names the server to Lichess, which shows it to users as they
+	// log in, such as the server's host name
+	ClientID string `json:"clientId"`
+	// RedirectURL is the server's /auth/lichess/callback as users reach it,
+	// by default on the host they asked to log in on
+	RedirectURL string `json:"redirectUrl,omitempty"`
+	// URL of Lichess, chessanalysis.LichessURL by default
+	URL string `json:"url,omitempty"`
+}
+
+// Lifetimes of sessions and of the logins under way
+const (
+	sessionLifetime = 30 * 24 * time.Hour
+	loginTimeout    = 10 * time.Minute
+)
+
+// lichessScopes are the permissions the server asks Lichess users for: to
+// add the chapters of studyExportHandler
+var lichessScopes = []string{"study:write"}
+
+// sessionCookie holds the ID of a logged-in user's session
+const sessionCookie = "chess_analyzer_session"
+
+// loginStateCookie ties a login under way to the browser that started it, so
+// the callback can't be used to log someone else in to another account
+const loginStateCookie = "chess_analyzer_login_state"
+
+// session is a logged-in user's
+type session struct {
+	account Account
+	token   string // The provider's access token, revoked when they log out
+	expires time.Time
+}
+
+// pendingLogin is a login sent to the provider and not back yet, by its
+// OAuth state
+type pendingLogin struct {
+	verifier    string // PKCE code verifier
+	redirectURL string
+	expires     time.Time
+}
+
+// sessionStore keeps the sessions of logged-in users, and their logins under
+// way, in memory: restarting the server logs everyone out
+type sessionStore struct {
+	lock     sync.Mutex
+	sessions map[string]session // By ID, the sessionCookie
+	logins   map[string]pendingLogin
+}
+
+func newSessionStore() *sessionStore {
+	return &sessionStore{sessions: make(map[string]session), logins: make(map[string]pendingLogin)}
+}
+
+// start opens a session for the account, returning its ID
+func (s *sessionStore) start(account Account, token string) string {
+	id := randomID(32)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for other, open := range s.sessions {
+		if time.Now().After(open.expires) {
+			delete(s.sessions, other)
+		}
+	}
+	s.sessions[id] = session{account: account, token: token, expires: time.Now().Add(sessionLifetime)}
+	return id
+}
+
+// get returns the session with the given ID, unless it has expired
+func (s *sessionStore) get(id string) (session, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	session, ok := s.sessions[id]
+	if !ok || time.Now().After(session.expires) {
+		delete(s.sessions, id)
+		return session, false
+	}
+	return session, true
+}
+
+// end closes the session with the given ID, returning it
+func (s *sessionStore) end(id string) (session, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	session, ok := s.sessions[id]
+	delete(s.sessions, id)
+	return session, ok
+}
+
+// beginLogin records a login sent to the provider, returning its state
+func (s *sessionStore) beginLogin(verifier, redirectURL string) string {
+	state := randomID(16)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for other, login := range s.logins {
+		if time.Now().After(login.expires) {
+			delete(s.logins, other)
+		}
+	}
+	s.logins[state] = pendingLogin{verifier: verifier, redirectURL: redirectURL, expires: time.Now().Add(loginTimeout)}
+	return state
+}
+
+// finishLogin returns the login with the given state, once
+func (s *sessionStore) finishLogin(state string) (pendingLogin, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	login, ok := s.logins[state]
+	delete(s.logins, state)
+	return login, ok && time.Now().Before(login.expires)
+}
+
+// requestSession returns the session of the request's cookie, if it has one
+func (app *Application) requestSession(r *http.Request) (string, session, bool) {
+	cookie, err := r.Cookie(sessionCookie)
+	if err != nil {
+		return "", session{}, false
+	}
+	session, ok := app.sessions.get(cookie.Value)
+	return cookie.Value, session, ok
+}
+
+// lichessLogin is a LichessOAuthConfig ready to log users in
+type lichessLogin struct {
+	clientID    string
+	redirectURL string
+	url         string
+	client      *http.Client
+}
+
+// newLichessLogin checks the configuration, returning nil if it has no
+// Lichess login
+func newLichessLogin(config *LichessOAuthConfig) (*lichessLogin, error) {
+	if config == nil {
+		return nil, nil
+	}
+	if config.ClientID == "" {
+		return nil, errors.New("the Lichess login needs a client ID")
+	}
+	login := &lichessLogin{
+		clientID:    config.ClientID,
+		redirectURL: config.RedirectURL,
+		url:         strings.TrimSuffix(config.URL, "/"),
+		client:      &http.Client{Timeout: 30 * time.Second},
+	}
+	if login.url == "" {
+		login.url = chessanalysis.LichessURL
+	}
+	return login, nil
+}
+
+// lichessLogin returns the Lichess login of the configuration, or nil if
+// users can't log in with Lichess
+func (app *Application) lichessLogin() *lichessLogin {
+	app.configLock.RLock()
+	defer app.configLock.RUnlock()
+	return app.lichess
+}
+
+// callbackURL returns where Lichess sends users back to from the request
+// that asked to log in
+func (l *lichessLogin) callbackURL(r *http.Request) string {
+	if l.redirectURL != "" {
+		return l.redirectURL
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return fmt.Sprintf("%s://%s/auth/lichess/callback", scheme, r.Host)
+}
+
+// secure reports whether users reach the server over HTTPS, by the scheme of
+// the callback URL, so its cookies are only sent back that way. Behind a
+// proxy that terminates TLS, or on a Unix socket, this takes a RedirectURL.
+func (l *lichessLogin) secure(r *http.Request) bool {
+	callback, err := url.Parse(l.callbackURL(r))
+	return err == nil && callback.Scheme == "https"
+}
+
+// codeChallenge returns the S256 PKCE challenge of the verifier
+func codeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// exchange trades the authorization code Lichess sent the user back with for
+// an access token
+func (l *lichessLogin) exchange(ctx context.Context, code string, login pendingLogin) (string, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"code_verifier": {login.verifier},
+		"redirect_uri":  {login.redirectURL},
+		"client_id":     {l.clientID},
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, l.url+"/api/token", strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	response, err := l.client.Do(request)
+	if err != nil {
+		return "", fmt.Errorf("getting a Lichess token: %w", err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("getting a Lichess token: %s", response.Status)
+	}
+	var token struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(response.Body).Decode(&token); err != nil || token.AccessToken == "" {
+		return "", fmt.Errorf("getting a Lichess token: invalid response")
+	}
+	return token.AccessToken, nil
+}
+
+// account returns the Lichess account of the access token
+func (l *lichessLogin) account(ctx context.Context, token string) (Account, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, l.url+"/api/account", nil)
+	if err != nil {
+		return Account{}, err
+	}
+	request.Header.Set("Authorization", "Bearer "+token)
+	response, err := l.client.Do(request)
+	if err != nil {
+		return Account{}, fmt.Errorf("getting the Lichess account: %w", err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return Account{}, fmt.Errorf("getting the Lichess account: %s", response.Status)
+	}
+	var user struct {
+		ID       string `json:"id"`
+		Username string `json:"username"`
+	}
+	if err := json.NewDecoder(response.Body).Decode(&user); err != nil || user.ID == "" {
+		return Account{}, fmt.Errorf("getting the Lichess account: invalid response")
+	}
+	return Account{ID: "lichess:" + user.ID, Name: user.Username, Provider: "lichess"}, nil
+}
+
+// revoke invalidates an access token, as users log out
+func (l *lichessLogin) revoke(ctx context.Context, token string) error {
+	request, err := http.NewRequestWithContext(ctx, http.MethodDelete, l.url+"/api/token", nil)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Authorization", "Bearer "+token)
+	response, err := l.client.Do(request)
+	if err != nil {
+		return err
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusNoContent && response.StatusCode != http.StatusOK {
+		return fmt.Errorf("revoking the Lichess token: %s", response.Status)
+	}
+	return nil
+}
+
+// lichessLoginHandler sends the user to Lichess to log in
+func (app *Application) lichessLoginHandler(w http.ResponseWriter, r *http.Request) {
+	login := app.lichessLogin()
+	if login == nil {
+		http.Error(w, "Logging in with Lichess is not configured", http.StatusNotFound)
+		return
+	}
+	verifier, redirectURL := randomID(32), login.callbackURL(r)
+	state := app.sessions.beginLogin(verifier, redirectURL)
+	http.SetCookie(w, &http.Cookie{
+		Name:     loginStateCookie,
+		Value:    state,
+		Path:     "/auth/lichess",
+		MaxAge:   int(loginTimeout.Seconds()),
+		HttpOnly: true,
+		Secure:   login.secure(r),
+		SameSite: http.SameSiteLaxMode,
+	})
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {login.clientID},
+		"redirect_uri":          {redirectURL},
+		"code_challenge_method": {"S256"},
+		"code_challenge":        {codeChallenge(verifier)},
+		"state":                 {state},
+		"scope":                 {strings.Join(lichessScopes, " ")},
+	}
+	http.Redirect(w, r, login.url+"/oauth?"+query.Encode(), http.StatusFound)
+}
+
+// lichessCallbackHandler finishes a login once Lichess sends the user back,
+// starting their session and returning them to the page
+func (app *Application) lichessCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	login := app.lichessLogin()
+	if login == nil {
+		http.Error(w, "Logging in with Lichess is not configured", http.StatusNotFound)
+		return
+	}
+	query := r.URL.Query()
+	cookie, err := r.Cookie(loginStateCookie)
+	if err != nil || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(query.Get("state"))) != 1 {
+		http.Error(w, "Login wasn't started in this browser, try logging in again", http.StatusBadRequest)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{Name: loginStateCookie, Path: "/auth/lichess", MaxAge: -1, HttpOnly: true})
+	pending, ok := app.sessions.finishLogin(query.Get("state"))
+	if !ok {
+		http.Error(w, "Unknown or expired login, try logging in again", http.StatusBadRequest)
+		return
+	}
+	if reason := query.Get("error"); reason != "" {
+		http.Error(w, fmt.Sprintf("Lichess refused the login: %s", reason), http.StatusForbidden)
+		return
+	}
+	token, err := login.exchange(r.Context(), query.Get("code"), pending)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	account, err := login.account(r.Context(), token)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    app.sessions.start(account, token),
+		Path:     "/",
+		MaxAge:   int(sessionLifetime.Seconds()),
+		HttpOnly: true,
+		Secure:   login.secure(r),
+		SameSite: http.SameSiteLaxMode,
+	})
+	fmt.Printf("%s logged in\n", account.ID)
+	http.Redirect(w, r, "/", http.StatusFound)
+}
+
+// logoutHandler ends the request's session, revoking its access token
+func (app *Application) logoutHandler(w http.ResponseWriter, r *http.Request) {
+	if id, _, ok := app.requestSession(r); ok {
+		session, _ := app.sessions.end(id)
+		if login := app.lichessLogin(); login != nil && session.account.Provider == "lichess" {
+			if err := login.revoke(r.Context(), session.token); err != nil {
+				fmt.Printf("Error revoking token: %v\n", err)
+			}
+		}
+	}
+	http.SetCookie(w, &http.Cookie{Name: sessionCookie, Path: "/", MaxAge: -1, HttpOnly: true})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// AccountStatus is who the user is logged in as, and the providers they can
+// log in with
+type AccountStatus struct {
+	Account   *Account `json:"account"` // nil when not logged in
+	Providers []string `json:"providers"`
+}
+
+// accountHandler returns the account the user is logged in as
+func (app *Application) accountHandler(w http.ResponseWriter, r *http.Request) {
+	status := AccountStatus{Account: contextAccount(r.Context()), Providers: []string{}}
+	if app.lichessLogin() != nil {
+		status.Providers = append(status.Providers, "lichess")
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(status); err != nil {
+		fmt.Printf("Error writing account: %v\n", err)
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/walterschell/chess-analyzer/chessanalysis"
+)
+
+// DiffRequest is the body of a request to diff two analyses of a game made
+// elsewhere, such as by the CLI with another engine
+type DiffRequest struct {
+	Left  *chessanalysis.GameAnalysis `json:"left"`
+	Right *chessanalysis.GameAnalysis `json:"right"`
+}
+
+// writeAnalysisDiff diffs the two analyses and writes the result, or 422
+// Unprocessable Entity if they are of different games
+func writeAnalysisDiff(w http.ResponseWriter, left, right *chessanalysis.GameAnalysis) {
+	diff, err := chessanalysis.DiffAnalyses(left, right)
+	if errors.Is(err, chessanalysis.ErrDifferentGames) {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(diff); err != nil {
+		fmt.Printf("Error writing analysis diff: %v\n", err)
+	}
+}
+
+// storedVersion returns a version of a stored analysis, the current one if
+// version is empty, or writes why it can't
+func (app *Application) storedVersion(w http.ResponseWriter, r *http.Request, id, version string) (*chessanalysis.GameAnalysis, bool) {
+	stored, ok := app.storedAnalysis(r.Context(), id)
+	if !ok {
+		http.Error(w, fmt.Sprintf("Analysis %s not found", id), http.StatusNotFound)
+		return nil, false
+	}
+	if version == "" {
+		return stored.game, true
+	}
+	number, err := strconv.Atoi(version)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid version %q", version), http.StatusBadRequest)
+		return nil, false
+	}
+	found, ok := stored.versionOf(number)
+	if !ok {
+		http.Error(w, fmt.Sprintf("Version %d of analysis %s not found", number, id), http.StatusNotFound)
+		return nil, false
+	}
+	return found.game, true
+}
+
+// analysisDiffHandler diffs a stored analysis, a chessanalysis.AnalysisDiff,
+// with another analysis of its game: by default its current version with the
+// version query parameter, such as the shallower analysis a re-analysis
+// replaced. The with and withVersion query parameters pick the analysis it is
+// diffed with instead, another stored analysis of the same game and one of its
+// versions. Analyses of different games answer 422 Unprocessable Entity.
+func (app *Application) analysisDiffHandler(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	query := r.URL.Query()
+	with := query.Get("with")
+	if with == "" {
+		with = id
+	}
+	left, ok := app.storedVersion(w, r, id, query.Get("version"))
+	if !ok {
+		return
+	}
+	right, ok := app.storedVersion(w, r, with, query.Get("withVersion"))
+	if !ok {
+		return
+	}
+	writeAnalysisDiff(w, left, right)
+}
+
+// diffHandler diffs the two analyses of a game in the request body, a
+// DiffRequest, as analysisDiffHandler does stored ones
+func (app *Application) diffHandler(w http.ResponseWriter, r *http.Request) {
+	var request DiffRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestSize)).Decode(&request); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid diff request: %v", err), http.StatusBadRequest)
+		return
+	}
+	if request.Left == nil || request.Right == nil {
+		http.Error(w, "Invalid diff request: both a left and a right analysis are needed", http.StatusBadRequest)
+		return
+	}
+	writeAnalysisDiff(w, request.Left, request.Right)
+}
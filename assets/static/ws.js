@@ -1,6 +1,9 @@
 // WebSocket connection instance
 let ws = null;
 let messageHandlers = new Map();
+// Handlers of the messages of other boards than the default one, by board ID
+// and then message type
+let boardMessageHandlers = new Map();
 
 function openWebSocket() {
     if (ws && ws.readyState === WebSocket.OPEN) {
@@ -20,8 +23,11 @@ function openWebSocket() {
     ws.onmessage = function(event) {
         try {
             const data = JSON.parse(event.data);
-            // Call all registered handlers for this message type
-            const handlers = messageHandlers.get(data.type) || [];
+            // Call all registered handlers for this message type, of its board
+            // if it is for one
+            const handlers = data.boardId
+                ? (boardMessageHandlers.get(data.boardId) || new Map()).get(data.type) || []
+                : messageHandlers.get(data.type) || [];
             handlers.forEach(handler => handler(data));
         } catch (e) {
             console.error('Error parsing message:', e);
@@ -65,6 +71,30 @@ function removeMessageHandler(type, handler) {
     }
 }
 
+// Boards multiplex several analyses, such as tabs, over the one connection.
+// Messages for a board carry its boardId, and the server keeps each board's
+// analyses, kibitzer and guess-the-move session apart.
+function addBoardMessageHandler(boardId, type, handler) {
+    if (!boardMessageHandlers.has(boardId)) {
+        boardMessageHandlers.set(boardId, new Map());
+    }
+    const handlers = boardMessageHandlers.get(boardId);
+    if (!handlers.has(type)) {
+        handlers.set(type, []);
+    }
+    handlers.get(type).push(handler);
+}
+
+function sendBoardMessage(boardId, message) {
+    sendMessage({ ...message, boardId: boardId });
+}
+
+// Stops everything the server is running for the board and removes its handlers
+function closeBoard(boardId) {
+    boardMessageHandlers.delete(boardId);
+    sendMessage({ type: 'board-close', boardId: boardId });
+}
+
 function sendMessage(message) {
     if (!ws || ws.readyState !== WebSocket.OPEN) {
         ws = openWebSocket();
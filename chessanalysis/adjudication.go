@@ -0,0 +1,155 @@
+package chessanalysis
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+
+	chess "github.com/corentings/chess/v2"
+)
+
+// Sources of an adjudication
+const (
+	AdjudicatedByPosition  = "position"  // The final position is checkmate or stalemate
+	AdjudicatedByTablebase = "tablebase" // The tablebase knows the result
+	AdjudicatedByEngine    = "engine"    // The engine's win/draw/loss estimate
+)
+
+// Adjudication is the likely result of an unfinished game
+type Adjudication struct {
+	Result     string  `json:"result"`     // "1-0", "0-1" or "1/2-1/2"
+	Confidence float64 `json:"confidence"` // Probability of the result, from 0 to 1
+	Source     string  `json:"source"`
+	FEN        string  `json:"fen"` // The adjudicated position
+	WhiteScore *Score  `json:"whiteScore,omitempty"`
+	Depth      int     `json:"depth,omitempty"`
+}
+
+// DefaultAdjudicationDepth is the shallowest depth final positions are searched to
+const DefaultAdjudicationDepth = 20
+
+// adjudicationSearchFactor is how much longer the final position is searched than a move
+const adjudicationSearchFactor = 4
+
+// adjudicationLimits returns the limits for a deeper search of the final position
+func (o *AnalyzeChessGameOptions) adjudicationLimits() SearchLimits {
+	limits := o.searchLimits()
+	switch {
+	case limits.MoveTime > 0:
+		limits.MoveTime *= adjudicationSearchFactor
+	case limits.Nodes > 0:
+		limits.Nodes *= adjudicationSearchFactor
+	default:
+		limits.Depth = min(max(limits.Depth*adjudicationSearchFactor, DefaultAdjudicationDepth), MaxDepth)
+	}
+	limits.Timeout *= adjudicationSearchFactor
+	limits.MultiPV = 1
+	return limits
+}
+
+// scoreWDL estimates win/draw/loss probabilities from a score, for engines
+// that don't report them. A forced mate is a certain win or loss.
+func scoreWDL(score Score) (win, draw, loss float64) {
+	if score.IsMate() {
+		if score.Winning() {
+			return 1, 0, 0
+		}
+		return 0, 0, 1
+	}
+	expected := 1 / (1 + math.Exp(-0.00368208*float64(score.CP())))
+	win = math.Max(0, 2*expected-1)
+	loss = math.Max(0, 1-2*expected)
+	return win, 1 - win - loss, loss
+}
+
+// Unfinished reports whether the game has no result or was abandoned
+func (g *GameAnalysis) Unfinished() bool {
+	switch g.Headers["Result"] {
+	case "", "*":
+		return true
+	}
+	return strings.Contains(strings.ToLower(g.Headers["Termination"]), "abandon")
+}
+
+// finalFEN returns the position the game ended in
+func (g *GameAnalysis) finalFEN() string {
+	if len(g.Moves) > 0 {
+		return g.Moves[len(g.Moves)-1].FENAfter
+	}
+	if fen := g.Headers["FEN"]; fen != "" {
+		return fen
+	}
+	return chess.StartingPosition().String()
+}
+
+// AdjudicatePosition predicts the result of the game from the position given
+// as a FEN. Finished positions are scored directly; otherwise the tablebase
+// from the options is probed, falling back to a deeper engine search than
+// the per-move analysis.
+func AdjudicatePosition(fen string, opts ...AnalyzeChessGameOption) (*Adjudication, error) {
+	analysisOpts, err := ResolveOptions(opts...)
+	if err != nil {
+		return nil, err
+	}
+	if err := analysisOpts.Context.Err(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrAnalysisCancelled, err)
+	}
+	fenOpt, err := chess.FEN(fen)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPGN, err)
+	}
+	position := chess.NewGame(fenOpt).Position()
+
+	switch position.Status() {
+	case chess.Checkmate:
+		return &Adjudication{
+			Result:     sideToMoveResult(position.Turn() == chess.White, false),
+			Confidence: 1,
+			Source:     AdjudicatedByPosition,
+			FEN:        fen,
+		}, nil
+	case chess.Stalemate:
+		return &Adjudication{Result: "1/2-1/2", Confidence: 1, Source: AdjudicatedByPosition, FEN: fen}, nil
+	}
+
+	if analysisOpts.Tablebase != nil {
+		result, err := analysisOpts.Tablebase.Probe(analysisOpts.Context, fen)
+		if err == nil {
+			return &Adjudication{Result: result, Confidence: 1, Source: AdjudicatedByTablebase, FEN: fen}, nil
+		}
+		if !errors.Is(err, ErrTablebaseMiss) {
+			log.Warn("Tablebase probe failed, adjudicating with the engine", "error", err)
+		}
+	}
+
+	engine, err := analysisOpts.startEngine()
+	if err != nil {
+		return nil, err
+	}
+	defer engine.Close()
+	result, err := engine.AnalyzePosition(fen, analysisOpts.adjudicationLimits())
+	if err != nil {
+		return nil, fmt.Errorf("adjudicating final position: %w", err)
+	}
+
+	win, draw, loss := result.WhiteWinProb, result.WhiteDrawProb, result.WhiteLossProb
+	if win+draw+loss == 0 {
+		win, draw, loss = scoreWDL(result.WhiteScore)
+	}
+	adjudication := &Adjudication{
+		Result:     "1/2-1/2",
+		Confidence: draw,
+		Source:     AdjudicatedByEngine,
+		FEN:        fen,
+		WhiteScore: &result.WhiteScore,
+		Depth:      result.Depth,
+	}
+	if win > adjudication.Confidence {
+		adjudication.Result, adjudication.Confidence = "1-0", win
+	}
+	if loss > adjudication.Confidence {
+		adjudication.Result, adjudication.Confidence = "0-1", loss
+	}
+	return adjudication, nil
+}
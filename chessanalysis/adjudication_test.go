@@ -0,0 +1,105 @@
+package chessanalysis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// stubTablebase answers probes from a map, missing everything else
+type stubTablebase map[string]string
+
+func (t stubTablebase) Probe(ctx context.Context, fen string) (string, error) {
+	if result, ok := t[fen]; ok {
+		return result, nil
+	}
+	return "", ErrTablebaseMiss
+}
+
+func TestAdjudicatePosition(t *testing.T) {
+	const (
+		mated       = "rnb1kbnr/pppp1ppp/8/4p3/6Pq/5P2/PPPPP2P/RNBQKBNR w KQkq - 1 3"
+		whiteWins   = "4k3/8/8/8/8/8/8/3QK3 w - - 0 1"
+		blackToMove = "4k3/8/8/8/8/8/8/3QK3 b - - 0 1"
+	)
+	engine := &FakeEngine{Positions: map[string]FakeEvaluation{
+		whiteWins:   {Score: 900},
+		blackToMove: {Score: -900},
+	}}
+
+	tests := []struct {
+		name   string
+		fen    string
+		opts   []AnalyzeChessGameOption
+		result string
+		source string
+	}{
+		{"Checkmate", mated, nil, "0-1", AdjudicatedByPosition},
+		{"Engine", whiteWins, nil, "1-0", AdjudicatedByEngine},
+		{"Engine with Black to move", blackToMove, nil, "1-0", AdjudicatedByEngine},
+		{"Tablebase", whiteWins, []AnalyzeChessGameOption{WithTablebase(stubTablebase{whiteWins: "1/2-1/2"})}, "1/2-1/2", AdjudicatedByTablebase},
+		{"Tablebase miss", whiteWins, []AnalyzeChessGameOption{WithTablebase(stubTablebase{})}, "1-0", AdjudicatedByEngine},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			opts := append([]AnalyzeChessGameOption{WithEngineFactory(engine.NewEngine)}, test.opts...)
+			adjudication, err := AdjudicatePosition(test.fen, opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if adjudication.Result != test.result || adjudication.Source != test.source {
+				t.Errorf("expected %s by %s, got %+v", test.result, test.source, adjudication)
+			}
+			if adjudication.Confidence <= 0.5 || adjudication.Confidence > 1 {
+				t.Errorf("unexpected confidence %.3f", adjudication.Confidence)
+			}
+		})
+	}
+}
+
+func TestAnalyzeGameAdjudicatesUnfinishedGames(t *testing.T) {
+	unfinished := "[White \"Player 1\"]\n[Black \"Player 2\"]\n[Result \"*\"]\n\n1. e4 e5 *"
+	game, err := AnalyzeGame(unfinished, WithEngineFactory(scholarsMateEngine().NewEngine))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if game.Adjudication == nil || game.Adjudication.Source != AdjudicatedByEngine || game.Adjudication.FEN != game.Moves[1].FENAfter {
+		t.Errorf("unexpected adjudication %+v", game.Adjudication)
+	}
+
+	finished, err := AnalyzeGame(scholarsMatePgn, WithEngineFactory(scholarsMateEngine().NewEngine))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if finished.Adjudication != nil {
+		t.Errorf("finished games shouldn't be adjudicated, got %+v", finished.Adjudication)
+	}
+}
+
+func TestLichessTablebase(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("fen") {
+		case "4k3/8/8/8/8/8/8/3QK3 b - - 0 1":
+			fmt.Fprint(w, `{"category":"loss","dtz":-20}`)
+		case "4k3/8/8/8/8/8/8/4K3 w - - 0 1":
+			fmt.Fprint(w, `{"category":"draw"}`)
+		default:
+			http.Error(w, "bad fen", http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+	tablebase := &LichessTablebase{Client: server.Client(), URL: server.URL}
+
+	if result, err := tablebase.Probe(context.Background(), "4k3/8/8/8/8/8/8/3QK3 b - - 0 1"); err != nil || result != "1-0" {
+		t.Errorf("expected 1-0, got %q (%v)", result, err)
+	}
+	if result, err := tablebase.Probe(context.Background(), "4k3/8/8/8/8/8/8/4K3 w - - 0 1"); err != nil || result != "1/2-1/2" {
+		t.Errorf("expected a draw, got %q (%v)", result, err)
+	}
+	if _, err := tablebase.Probe(context.Background(), "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1"); !errors.Is(err, ErrTablebaseMiss) {
+		t.Errorf("expected ErrTablebaseMiss for the starting position, got %v", err)
+	}
+}
@@ -1,11 +1,15 @@
 package chessanalysis
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"strings"
+	"slices"
+	"time"
 
 	chess "github.com/corentings/chess/v2"
+	"github.com/walterschell/chess-analyzer/chessanalysis/uciengine"
 )
 
 type MoveClassification int
@@ -18,6 +22,9 @@ const (
 	Excellent
 	Winning
 	Best
+	Brilliant // A sound sacrifice, see MoveAnalysis.Sacrifice
+	Book      // A known opening move, not searched by the engine; see WithSkipBook
+	Forced    // The only legal move or an expected recapture, not searched by the engine; see WithSkipForced
 )
 
 type MoveClassifier interface {
@@ -42,6 +49,9 @@ type ThresholdMoveClassifier struct {
 }
 
 func (c *ThresholdMoveClassifier) ClassifyMove(move *MoveAnalysis) MoveClassification {
+	if move.Sacrifice {
+		return Brilliant
+	}
 	if move.IsBestMove {
 		return Best
 	}
@@ -75,33 +85,45 @@ func (c *ThresholdMoveClassifier) ClassifyMove(move *MoveAnalysis) MoveClassific
 	return Neutral
 }
 
+// DefaultMoveClassifier classifies moves with the thresholds of the club
+// classifier profile, see ClassifierProfiles
 func DefaultMoveClassifier() MoveClassifier {
-	return &ThresholdMoveClassifier{
-		blunderWinProbThreshold:       0.2,
-		blunderLossProbThreshold:      0.2,
-		questionableWinProbThreshold:  0.1,
-		questionableLossProbThreshold: 0.1,
-		goodWinProbThreshold:          0.05,
-		goodLossProbThreshold:         0.05,
-		excellentWinProbThreshold:     0.1,
-		excellentLossProbThreshold:    0.1,
-	}
+	profile, _ := ClassifierProfileByName(DefaultClassifierProfile)
+	return profile.Classifier()
 }
 
+var moveClassificationNames = []string{"Neutral", "Blunder", "Questionable", "Good", "Excellent", "Winning", "Best", "Brilliant", "Book", "Forced"}
+
 func (c MoveClassification) String() string {
-	return []string{"Neutral", "Blunder", "Questionable", "Good", "Excellent", "Winning", "Best"}[c]
+	return moveClassificationNames[c]
+}
+
+// ParseMoveClassification returns the classification with the given name
+func ParseMoveClassification(name string) (MoveClassification, error) {
+	for i, n := range moveClassificationNames {
+		if n == name {
+			return MoveClassification(i), nil
+		}
+	}
+	return Neutral, fmt.Errorf("unknown move classification %q", name)
 }
 
 type MoveAnalysis struct {
 	MoveNumber            int
 	Color                 string
 	MoveText              string
-	WhiteScore            float64
-	PreviousWhiteScore    float64
+	Piece                 string // Type of the piece moved, e.g. "Knight"
+	IsCapture             bool   // Including en passant captures
+	IsCheck               bool
+	IsPromotion           bool
+	FENBefore             string // Position before the move was played
+	FENAfter              string // Position after the move was played
+	WhiteScore            Score
+	PreviousWhiteScore    Score
 	IsBestMove            bool
 	BestMove              string
 	BestMoveSAN           string
-	BestMoveWhiteScore    float64
+	BestMoveWhiteScore    Score
 	WhiteWinProb          float64
 	WhiteDrawProb         float64
 	WhiteLossProb         float64
@@ -111,59 +133,168 @@ type MoveAnalysis struct {
 	BestMoveWhiteWinProb  float64
 	BestMoveWhiteDrawProb float64
 	BestMoveWhiteLossProb float64
+	Depth                 int           // Depth reached by the engine search
+	RequestedDepth        int           // Depth the search was asked to reach; 0 for searches limited by time or nodes
+	DepthRetries          int           // How many times the search was repeated for stopping short of RequestedDepth, see WithDepthRetries
+	SelDepth              int           // Selective depth reached by the engine search
+	Nodes                 int64         // Nodes searched
+	NPS                   int64         // Search speed in nodes per second
+	TimeSpent             time.Duration // Time the engine spent on the search
+	ReusedFrom            string        // Move in the same position whose search was reused, e.g. "3. Nf3"; see SearchCache
+	Phase                 GamePhase
+	Clock                 time.Duration // Mover's remaining time after the move, from the PGN's %clk
+	HasClock              bool          // Whether the PGN recorded the clock for this move
+	Refutation            []string      // The engine's expected continuation after the move, in SAN
+	BestReply             string        // The engine's best response to the move, in SAN; the start of Refutation
+	BestReplyUCI          string        // BestReply in UCI notation
+	TimeTrouble           bool          // Whether the mover was below the time trouble threshold after the move
+	EngineRank            int           // Rank of the move among the engine's top choices, or 0 if it wasn't one
+	Sharpness             float64       // How sharp the position before the move was, from 0 to 1; needs a MultiPV above 1
+	TopMoves              []EngineMove  // The engine's top choices in the position before the move, best first
+	Hints                 MoveHints     // Arrows and highlights for showing the move on a board
+	Sacrifice             bool          // Whether the move is a sacrifice, see MinSacrificeMaterial
+	SacrificeMaterial     int           // Pawns the move gives up by the end of the engine's line
+	MissedDraw            string        // The drawing resource the move missed in a lost position, such as MissedDrawRepetition; "" for none
+	MissedMate            int           // Moves of the forced mate the best move had and the move gave up; 0 for none
+	MateVerified          bool          // Whether a mate search confirmed MissedMate, see WithMateVerification
+	PracticalChances      float64       // The must-win side's chances of winning after the move, in percent; see WithPracticalMode
+	PracticalLoss         float64       // Percentage points of PracticalChances the move cost its player
+	PracticalTry          *PracticalTry // The most complicating defence in a lost position, see WithPracticalTries
+	BestMoveSacrifice     bool          // Whether the engine's best move is a sacrifice
+	BestSacrificeMaterial int           // Pawns the best move gives up by the end of the engine's line
+	Accuracy              float64       // Move accuracy from 0 to 100
+	ExpectedPoints        float64       // Expected points the move gained its player, negative where it threw them away
+	CentipawnLoss         float64       // Centipawns lost compared to the previous evaluation
 	Classification        MoveClassification
+	ClassificationSymbol  string         // Symbol shown with the classification, see WithClassificationSymbols; "" for the ASCII one
+	Annotation            string         // The move's NAG in the PGN, such as "$2" or "?"; see NAGMapping.Classification
+	EmbeddedEval          bool           // Whether the scores came from the PGN's [%eval] instead of a search, see WithEmbeddedEvals
+	Skipped               bool           // Whether the move was replayed without a search, as the opponent's with WithSide
+	Decided               bool           // Whether the game was decided before the move, see WithEarlyStop
+	Heuristic             bool           // Whether the move was evaluated by a HeuristicEngine, for want of a real engine
+	TerminalStatus        string         // How the game ends after the move, such as TerminalCheckmate; "" while play goes on
+	SecondOpinion         *SecondOpinion // The second engine's evaluation, see WithSecondOpinion
+	Diagnostics           *Diagnostics   // Details of the engine search, see WithDiagnostics
+}
+
+// EngineMove is one of the engine's top choices in a position
+type EngineMove struct {
+	Move       string   `json:"move"` // SAN
+	UCI        string   `json:"uci"`
+	WhiteScore Score    `json:"whiteScore"`
+	Line       []string `json:"line,omitempty"` // The engine's line starting with Move, in SAN, up to maxTopLinePlies
 }
 
 func (m *MoveAnalysis) String() string {
-	return fmt.Sprintf("Move %d: %s (Score: %.2f, Classification: %s, Is Best Move: %t)",
-		m.MoveNumber, m.MoveText, m.WhiteScore, m.Classification, m.IsBestMove)
+	return fmt.Sprintf("Move %d: %s (Score: %s, Classification: %s, Is Best Move: %t)",
+		m.MoveNumber, m.MoveText, m.WhiteScore.Format(), m.Classification, m.IsBestMove)
 }
 
-// Chess annotation symbols for move classifications
-var classificationAnnotations = map[MoveClassification]string{
-	Blunder:      "??",
-	Questionable: "?",
-	Neutral:      "",
-	Good:         "!",
-	Excellent:    "!!",
-	Winning:      "⩲",
-	Best:         "*",
+// Evaluated reports whether the move was searched or its evaluation was
+// taken from the PGN
+func (m *MoveAnalysis) Evaluated() bool {
+	return m.Depth > 0 || m.EmbeddedEval
+}
+
+// ShortOfDepth reports whether the move's search ended before the depth it
+// was asked to reach, such as after a single legal move, a forced mate, or a
+// search stopped for overrunning its timeout
+func (m *MoveAnalysis) ShortOfDepth() bool {
+	return m.RequestedDepth > 0 && m.Depth < m.RequestedDepth
 }
 
 // MoveAnalysisJSON is the JSON representation of MoveAnalysis
 type moveAnalysisJSON struct {
-	MoveNumber            int     `json:"moveNumber"`
-	Color                 string  `json:"color"`
-	MoveText              string  `json:"moveText"`
-	WhiteScore            float64 `json:"whiteScore"`
-	PreviousWhiteScore    float64 `json:"previousWhiteScore"`
-	Classification        string  `json:"classification"`       // Human readable
-	ClassificationSymbol  string  `json:"classificationSymbol"` // Chess annotation
-	IsBestMove            bool    `json:"isBestMove"`
-	BestMove              string  `json:"bestMove"`
-	BestMoveSAN           string  `json:"bestMoveSAN"`
-	BestMoveWhiteScore    float64 `json:"bestMoveWhiteScore"`
-	WhiteWinProb          float64 `json:"whiteWinProb"`
-	WhiteDrawProb         float64 `json:"whiteDrawProb"`
-	WhiteLossProb         float64 `json:"whiteLossProb"`
-	BestMoveWhiteWinProb  float64 `json:"bestMoveWhiteWinProb"`
-	BestMoveWhiteDrawProb float64 `json:"bestMoveWhiteDrawProb"`
-	BestMoveWhiteLossProb float64 `json:"bestMoveWhiteLossProb"`
-	PreviousWhiteWinProb  float64 `json:"previousWhiteWinProb"`
-	PreviousWhiteDrawProb float64 `json:"previousWhiteDrawProb"`
-	PreviousWhiteLossProb float64 `json:"previousWhiteLossProb"`
+	SchemaVersion         int            `json:"schemaVersion"` // See SchemaVersion
+	MoveNumber            int            `json:"moveNumber"`
+	Color                 string         `json:"color"`
+	MoveText              string         `json:"moveText"`
+	Piece                 string         `json:"piece"`
+	IsCapture             bool           `json:"isCapture"`
+	IsCheck               bool           `json:"isCheck"`
+	IsPromotion           bool           `json:"isPromotion"`
+	FENBefore             string         `json:"fenBefore"`
+	FENAfter              string         `json:"fenAfter"`
+	WhiteScore            Score          `json:"whiteScore"`
+	PreviousWhiteScore    Score          `json:"previousWhiteScore"`
+	Classification        string         `json:"classification"`       // Human readable
+	ClassificationSymbol  string         `json:"classificationSymbol"` // See ClassificationSymbols
+	IsBestMove            bool           `json:"isBestMove"`
+	BestMove              string         `json:"bestMove"`
+	BestMoveSAN           string         `json:"bestMoveSAN"`
+	BestMoveWhiteScore    Score          `json:"bestMoveWhiteScore"`
+	WhiteWinProb          float64        `json:"whiteWinProb"`
+	WhiteDrawProb         float64        `json:"whiteDrawProb"`
+	WhiteLossProb         float64        `json:"whiteLossProb"`
+	BestMoveWhiteWinProb  float64        `json:"bestMoveWhiteWinProb"`
+	BestMoveWhiteDrawProb float64        `json:"bestMoveWhiteDrawProb"`
+	BestMoveWhiteLossProb float64        `json:"bestMoveWhiteLossProb"`
+	PreviousWhiteWinProb  float64        `json:"previousWhiteWinProb"`
+	PreviousWhiteDrawProb float64        `json:"previousWhiteDrawProb"`
+	PreviousWhiteLossProb float64        `json:"previousWhiteLossProb"`
+	Depth                 int            `json:"depth"`
+	RequestedDepth        int            `json:"requestedDepth,omitempty"`
+	DepthRetries          int            `json:"depthRetries,omitempty"`
+	SelDepth              int            `json:"selDepth"`
+	Nodes                 int64          `json:"nodes"`
+	NPS                   int64          `json:"nps"`
+	TimeSpentMs           int64          `json:"timeSpentMs"`
+	ReusedFrom            string         `json:"reusedFrom,omitempty"`
+	Phase                 string         `json:"phase"`
+	ClockMs               *int64         `json:"clockMs,omitempty"`
+	Refutation            []string       `json:"refutation,omitempty"`
+	BestReply             string         `json:"bestReply,omitempty"`
+	BestReplyUCI          string         `json:"bestReplyUCI,omitempty"`
+	TimeTrouble           bool           `json:"timeTrouble"`
+	EngineRank            int            `json:"engineRank"`
+	Sharpness             float64        `json:"sharpness"`
+	TopMoves              []EngineMove   `json:"topMoves,omitempty"`
+	Hints                 MoveHints      `json:"hints"`
+	Sacrifice             bool           `json:"sacrifice"`
+	SacrificeMaterial     int            `json:"sacrificeMaterial,omitempty"`
+	MissedDraw            string         `json:"missedDraw,omitempty"`
+	MissedMate            int            `json:"missedMate,omitempty"`
+	MateVerified          bool           `json:"mateVerified,omitempty"`
+	PracticalChances      float64        `json:"practicalChances,omitempty"`
+	PracticalLoss         float64        `json:"practicalLoss,omitempty"`
+	PracticalTry          *PracticalTry  `json:"practicalTry,omitempty"`
+	BestMoveSacrifice     bool           `json:"bestMoveSacrifice"`
+	BestSacrificeMaterial int            `json:"bestSacrificeMaterial,omitempty"`
+	Accuracy              float64        `json:"accuracy"`
+	ExpectedPoints        float64        `json:"expectedPoints"`
+	CentipawnLoss         float64        `json:"centipawnLoss"`
+	Annotation            string         `json:"annotation,omitempty"`
+	EmbeddedEval          bool           `json:"embeddedEval,omitempty"`
+	Skipped               bool           `json:"skipped,omitempty"`
+	Decided               bool           `json:"decided,omitempty"`
+	Heuristic             bool           `json:"heuristic,omitempty"`
+	TerminalStatus        string         `json:"terminalStatus,omitempty"`
+	SecondOpinion         *SecondOpinion `json:"secondOpinion,omitempty"`
+	Diagnostics           *Diagnostics   `json:"diagnostics,omitempty"`
 }
 
 // MarshalJSON implements custom JSON serialization for MoveAnalysis
 func (m *MoveAnalysis) MarshalJSON() ([]byte, error) {
+	var clockMs *int64
+	if m.HasClock {
+		ms := m.Clock.Milliseconds()
+		clockMs = &ms
+	}
 	return json.Marshal(moveAnalysisJSON{
+		SchemaVersion:         SchemaVersion,
 		MoveNumber:            m.MoveNumber,
 		Color:                 m.Color,
 		MoveText:              m.MoveText,
+		Piece:                 m.Piece,
+		IsCapture:             m.IsCapture,
+		IsCheck:               m.IsCheck,
+		IsPromotion:           m.IsPromotion,
+		FENBefore:             m.FENBefore,
+		FENAfter:              m.FENAfter,
 		WhiteScore:            m.WhiteScore,
 		PreviousWhiteScore:    m.PreviousWhiteScore,
 		Classification:        m.Classification.String(),
-		ClassificationSymbol:  classificationAnnotations[m.Classification],
+		ClassificationSymbol:  m.Symbol(),
 		IsBestMove:            m.IsBestMove,
 		BestMove:              m.BestMove,
 		BestMoveSAN:           m.BestMoveSAN,
@@ -177,9 +308,157 @@ func (m *MoveAnalysis) MarshalJSON() ([]byte, error) {
 		PreviousWhiteWinProb:  m.PreviousWhiteWinProb,
 		PreviousWhiteDrawProb: m.PreviousWhiteDrawProb,
 		PreviousWhiteLossProb: m.PreviousWhiteLossProb,
+		Depth:                 m.Depth,
+		RequestedDepth:        m.RequestedDepth,
+		DepthRetries:          m.DepthRetries,
+		SelDepth:              m.SelDepth,
+		Nodes:                 m.Nodes,
+		NPS:                   m.NPS,
+		TimeSpentMs:           m.TimeSpent.Milliseconds(),
+		ReusedFrom:            m.ReusedFrom,
+		Phase:                 m.Phase.String(),
+		ClockMs:               clockMs,
+		Refutation:            m.Refutation,
+		BestReply:             m.BestReply,
+		BestReplyUCI:          m.BestReplyUCI,
+		TimeTrouble:           m.TimeTrouble,
+		EngineRank:            m.EngineRank,
+		Sharpness:             m.Sharpness,
+		TopMoves:              m.TopMoves,
+		Hints:                 m.Hints,
+		Sacrifice:             m.Sacrifice,
+		SacrificeMaterial:     m.SacrificeMaterial,
+		MissedDraw:            m.MissedDraw,
+		MissedMate:            m.MissedMate,
+		MateVerified:          m.MateVerified,
+		PracticalChances:      m.PracticalChances,
+		PracticalLoss:         m.PracticalLoss,
+		PracticalTry:          m.PracticalTry,
+		BestMoveSacrifice:     m.BestMoveSacrifice,
+		BestSacrificeMaterial: m.BestSacrificeMaterial,
+		Accuracy:              m.Accuracy,
+		ExpectedPoints:        m.ExpectedPoints,
+		CentipawnLoss:         m.CentipawnLoss,
+		Annotation:            m.Annotation,
+		EmbeddedEval:          m.EmbeddedEval,
+		Skipped:               m.Skipped,
+		Decided:               m.Decided,
+		Heuristic:             m.Heuristic,
+		TerminalStatus:        m.TerminalStatus,
+		SecondOpinion:         m.SecondOpinion,
+		Diagnostics:           m.Diagnostics,
 	})
 }
 
+// UnmarshalJSON implements custom JSON deserialization for MoveAnalysis,
+// reading JSON of earlier schema versions too, see SchemaVersion
+func (m *MoveAnalysis) UnmarshalJSON(data []byte) error {
+	data, err := upgradeSchema("move", moveSchemaUpgrades, data)
+	if err != nil {
+		return err
+	}
+	var v moveAnalysisJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	classification, err := ParseMoveClassification(v.Classification)
+	if err != nil {
+		return err
+	}
+	phase, err := ParseGamePhase(v.Phase)
+	if err != nil {
+		return err
+	}
+	var clock time.Duration
+	if v.ClockMs != nil {
+		clock = time.Duration(*v.ClockMs) * time.Millisecond
+	}
+	// Only symbols other than the default are kept
+	symbol := v.ClassificationSymbol
+	if symbol == ASCIISymbols.Symbol(classification) {
+		symbol = ""
+	}
+	*m = MoveAnalysis{
+		MoveNumber:            v.MoveNumber,
+		Color:                 v.Color,
+		MoveText:              v.MoveText,
+		Piece:                 v.Piece,
+		IsCapture:             v.IsCapture,
+		IsCheck:               v.IsCheck,
+		IsPromotion:           v.IsPromotion,
+		FENBefore:             v.FENBefore,
+		FENAfter:              v.FENAfter,
+		WhiteScore:            v.WhiteScore,
+		PreviousWhiteScore:    v.PreviousWhiteScore,
+		IsBestMove:            v.IsBestMove,
+		BestMove:              v.BestMove,
+		BestMoveSAN:           v.BestMoveSAN,
+		BestMoveWhiteScore:    v.BestMoveWhiteScore,
+		WhiteWinProb:          v.WhiteWinProb,
+		WhiteDrawProb:         v.WhiteDrawProb,
+		WhiteLossProb:         v.WhiteLossProb,
+		PreviousWhiteWinProb:  v.PreviousWhiteWinProb,
+		PreviousWhiteDrawProb: v.PreviousWhiteDrawProb,
+		PreviousWhiteLossProb: v.PreviousWhiteLossProb,
+		BestMoveWhiteWinProb:  v.BestMoveWhiteWinProb,
+		BestMoveWhiteDrawProb: v.BestMoveWhiteDrawProb,
+		BestMoveWhiteLossProb: v.BestMoveWhiteLossProb,
+		Depth:                 v.Depth,
+		RequestedDepth:        v.RequestedDepth,
+		DepthRetries:          v.DepthRetries,
+		SelDepth:              v.SelDepth,
+		Nodes:                 v.Nodes,
+		NPS:                   v.NPS,
+		TimeSpent:             time.Duration(v.TimeSpentMs) * time.Millisecond,
+		ReusedFrom:            v.ReusedFrom,
+		Phase:                 phase,
+		Clock:                 clock,
+		HasClock:              v.ClockMs != nil,
+		Refutation:            v.Refutation,
+		BestReply:             v.BestReply,
+		BestReplyUCI:          v.BestReplyUCI,
+		TimeTrouble:           v.TimeTrouble,
+		EngineRank:            v.EngineRank,
+		Sharpness:             v.Sharpness,
+		TopMoves:              v.TopMoves,
+		Hints:                 v.Hints,
+		Sacrifice:             v.Sacrifice,
+		SacrificeMaterial:     v.SacrificeMaterial,
+		MissedDraw:            v.MissedDraw,
+		MissedMate:            v.MissedMate,
+		MateVerified:          v.MateVerified,
+		PracticalChances:      v.PracticalChances,
+		PracticalLoss:         v.PracticalLoss,
+		PracticalTry:          v.PracticalTry,
+		BestMoveSacrifice:     v.BestMoveSacrifice,
+		BestSacrificeMaterial: v.BestSacrificeMaterial,
+		Accuracy:              v.Accuracy,
+		ExpectedPoints:        v.ExpectedPoints,
+		CentipawnLoss:         v.CentipawnLoss,
+		Classification:        classification,
+		ClassificationSymbol:  symbol,
+		Annotation:            v.Annotation,
+		EmbeddedEval:          v.EmbeddedEval,
+		Skipped:               v.Skipped,
+		Decided:               v.Decided,
+		Heuristic:             v.Heuristic,
+		TerminalStatus:        v.TerminalStatus,
+		SecondOpinion:         v.SecondOpinion,
+		Diagnostics:           v.Diagnostics,
+	}
+	return nil
+}
+
+// pieceTypeNames are the names of the piece types used in MoveAnalysis.Piece
+var pieceTypeNames = map[chess.PieceType]string{
+	chess.King:   "King",
+	chess.Queen:  "Queen",
+	chess.Rook:   "Rook",
+	chess.Bishop: "Bishop",
+	chess.Knight: "Knight",
+	chess.Pawn:   "Pawn",
+}
+
 func moveToSan(startingPosition *chess.Position, move *chess.Move) string {
 	return chess.AlgebraicNotation{}.Encode(startingPosition, move)
 }
@@ -188,14 +467,392 @@ func moveToUci(startingPosition *chess.Position, move *chess.Move) string {
 	return chess.UCINotation{}.Encode(startingPosition, move)
 }
 
+// decodeMove decodes a move given by the caller in SAN or UCI, returning
+// ErrIllegalMove unless it is legal in the position. Decoding UCI doesn't
+// check legality itself, so the move is looked up among the legal ones.
+func decodeMove(position *chess.Position, text string) (*chess.Move, error) {
+	if move, err := (chess.AlgebraicNotation{}).Decode(position, text); err == nil {
+		return move, nil
+	}
+	if move, err := (chess.UCINotation{}).Decode(position, text); err == nil {
+		uci := moveToUci(position, move)
+		moves := position.ValidMoves()
+		for i := range moves {
+			if moveToUci(position, &moves[i]) == uci {
+				return &moves[i], nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("%w: %q in %s", ErrIllegalMove, text, position)
+}
+
+// playedMoveUCI returns the move played in UCI notation, derived from its SAN
+// and the position before it, or "" if that isn't known
+func playedMoveUCI(move *MoveAnalysis) string {
+	position, err := positionFromFEN(move.FENBefore)
+	if err != nil {
+		return ""
+	}
+	played, err := chess.AlgebraicNotation{}.Decode(position, move.MoveText)
+	if err != nil {
+		return ""
+	}
+	return moveToUci(position, played)
+}
+
+// maxTopLinePlies is how much of each of the engine's top lines is kept
+const maxTopLinePlies = 8
+
+// engineMoves pairs the engine's top moves in the position with their scores,
+// which are converted from the mover's perspective to White's, and their lines
+func engineMoves(position *chess.Position, topMoves []string, topScores []Score, topLines [][]string) []EngineMove {
+	var moves []EngineMove
+	for i, uci := range topMoves {
+		move, err := chess.UCINotation{}.Decode(position, uci)
+		if err != nil || i >= len(topScores) {
+			continue
+		}
+		score := topScores[i]
+		if position.Turn() == chess.Black {
+			score = score.Negate()
+		}
+		engineMove := EngineMove{Move: moveToSan(position, move), UCI: uci, WhiteScore: score}
+		if i < len(topLines) && len(topLines[i]) > 1 {
+			engineMove.Line = uciLineToSan(position, topLines[i][:min(len(topLines[i]), maxTopLinePlies)])
+		}
+		moves = append(moves, engineMove)
+	}
+	return moves
+}
+
+// maxRefutationPlies is how much of the engine's continuation is kept as a move's refutation
+const maxRefutationPlies = 6
+
+// RefutationDepth is how deep the position after a mistake is searched for
+// its refutation when the move's own search didn't give one, such as for
+// moves scored by embedded evaluations
+const RefutationDepth = 10
+
+// needsRefutation reports whether a move is a mistake still lacking the
+// opponent's punishing line
+func needsRefutation(move *MoveAnalysis) bool {
+	return (move.Classification == Blunder || move.Classification == Questionable) &&
+		len(move.Refutation) == 0 && move.TerminalStatus == ""
+}
+
+// refute searches the position after a mistake for the opponent's punishing
+// line, keeping it as the move's refutation
+func refute(engine Engine, move *MoveAnalysis, after *chess.Position, timeout time.Duration) error {
+	result, err := engine.AnalyzePosition(move.FENAfter, SearchLimits{Depth: RefutationDepth, Timeout: timeout})
+	if err != nil {
+		return err
+	}
+	setRefutation(move, after, result.PlayedLine)
+	move.Hints = moveHints(move)
+	return nil
+}
+
+// setRefutation keeps the start of the engine's line in the position after a
+// move as its refutation, and the line's first move as the best reply
+func setRefutation(move *MoveAnalysis, after *chess.Position, line []string) {
+	move.Refutation = uciLineToSan(after, line[:min(len(line), maxRefutationPlies)])
+	if len(move.Refutation) > 0 {
+		move.BestReply, move.BestReplyUCI = move.Refutation[0], line[0]
+	}
+}
+
+// uciLineToSan converts a line of UCI moves played from the position to SAN,
+// stopping at the first move that isn't legal
+func uciLineToSan(position *chess.Position, line []string) []string {
+	var san []string
+	for _, uci := range line {
+		move, err := chess.UCINotation{}.Decode(position, uci)
+		if err != nil {
+			break
+		}
+		san = append(san, moveToSan(position, move))
+		position = position.Update(move)
+	}
+	return san
+}
+
+// DefaultDepth is the search depth used when no depth, move time, or node limit is given
+const DefaultDepth = 2
+
+// MaxDepth is the deepest search depth accepted by the analysis options
+const MaxDepth = 99
+
+// MaxMultiPV is the most engine lines accepted by the analysis options
+const MaxMultiPV = 256
+
 type AnalyzeChessGameOptions struct {
-	Depth          int
+	Depth          int           // Search depth per move; mutually exclusive with MoveTime and Nodes
+	MoveTime       time.Duration // Search time per move; mutually exclusive with Depth and Nodes
+	Nodes          int64         // Nodes searched per move; mutually exclusive with Depth and MoveTime
+	TimeBudget     time.Duration // Wall-clock time for the whole analysis; mutually exclusive with the limits above
 	MoveClassifier MoveClassifier
+	// ClassifierProfile names the preset classifier profile moves are
+	// classified with instead of MoveClassifier, see ClassifierProfiles
+	ClassifierProfile string
+	Context           context.Context // Cancelling the context stops the analysis
+	EngineTimeout     time.Duration   // How long a single engine search may take before it is stopped
+	EngineFactory     EngineFactory   // Starts the engine used for the analysis
+	// TimeTroubleThreshold is the remaining clock time below which moves are
+	// marked as played in time trouble; 0 derives it from each game's
+	// TimeControl tag, see TimeControl.TimeTroubleThreshold
+	TimeTroubleThreshold time.Duration
+	// MultiPV is how many of the engine's top moves are reported per position,
+	// so moves can be ranked among them
+	MultiPV int
+	// Tablebase is consulted when adjudicating unfinished games and looking
+	// for dead draws; nil skips it
+	Tablebase Tablebase
+	// ExcludeDeadDraw leaves the moves after a dead draw out of the players'
+	// statistics, see WithoutDeadDrawMoves
+	ExcludeDeadDraw bool
+	// Theory is used to find where a game left known theory; nil skips it
+	Theory Theory
+	// SkipBook classifies moves found in Theory as Book without searching
+	// them with the engine
+	SkipBook bool
+	// SkipForced classifies forced moves as Forced without searching them,
+	// see WithSkipForced
+	SkipForced bool
+	// SearchCache is shared between analyses to reuse their searches; nil
+	// gives each analysis its own
+	SearchCache *SearchCache
+	// EnginePool limits how many engines run at once; nil starts engines
+	// without waiting
+	EnginePool *EnginePool
+	// Priority orders the analysis among those waiting for EnginePool
+	Priority Priority
+	// EmbeddedEvals takes the evaluation of moves annotated with [%eval] in
+	// the PGN, as Lichess exports them, instead of searching them
+	EmbeddedEvals bool
+	// SecondOpinion starts a second engine searching every move alongside
+	// the first; nil analyzes with one engine
+	SecondOpinion EngineFactory
+	// Symbols show the moves' classifications; nil shows ASCIISymbols
+	Symbols ClassificationSymbols
+	// DepthRetries is how many times a search limited by depth is repeated,
+	// with twice the time each time, when it stops short of the depth
+	DepthRetries int
+	// VerifyMates confirms the mates moves missed with a mate search
+	VerifyMates bool
+	// Diagnostics keeps the details of each move's engine search
+	Diagnostics bool
+	// Contempt is passed to engines with a Contempt option, see WithContempt
+	Contempt int
+	// MustWin is the side, "White" or "Black", that moves are judged for
+	// with WithPracticalMode; "" judges them by expected score alone
+	MustWin string
+	// PracticalTries looks for the most complicating defence in lost
+	// positions
+	PracticalTries bool
+	// RatingScaler scales the classifier profile's thresholds to each
+	// side's rating, see WithRatingScaling; nil classifies both sides alike
+	RatingScaler RatingScaler
+	// TimeControlProfiles name the classifier profile of each speed class,
+	// see WithTimeControlProfiles; nil classifies all games alike
+	TimeControlProfiles map[TimeControlCategory]string
+	// Variations analyzes the sidelines of games too, see WithVariations
+	Variations bool
+	// Side is the color, "White" or "Black", whose moves alone are analyzed,
+	// see WithSide; "" analyzes both sides'
+	Side string
+	// Repertoires are the players' prepared openings by their names, see
+	// WithRepertoire
+	Repertoires map[string]*Repertoire
+	// EarlyStop is when the analysis stops searching a decided game in full,
+	// see WithEarlyStop; nil searches every move alike
+	EarlyStop *EarlyStop
 }
 
 var defaultAnalyzeChessGameOptions = AnalyzeChessGameOptions{
-	Depth:          2,
 	MoveClassifier: DefaultMoveClassifier(),
+	Context:        context.Background(),
+	EngineTimeout:  uciengine.DefaultEngineTimeout,
+	EngineFactory:  uciengine.StockfishEngineFactory,
+	MultiPV:        1,
+}
+
+// validate checks the options for values the engine can't use and fills in the default depth
+func (o *AnalyzeChessGameOptions) validate() error {
+	limits := 0
+	if o.Depth < 0 || o.Depth > MaxDepth {
+		return fmt.Errorf("%w: depth %d is outside 1-%d", ErrInvalidOptions, o.Depth, MaxDepth)
+	}
+	if o.Depth > 0 {
+		limits++
+	}
+	if o.MoveTime < 0 {
+		return fmt.Errorf("%w: move time %v is negative", ErrInvalidOptions, o.MoveTime)
+	}
+	if o.MoveTime > 0 {
+		if o.MoveTime < time.Millisecond {
+			return fmt.Errorf("%w: move time %v is below 1ms", ErrInvalidOptions, o.MoveTime)
+		}
+		limits++
+	}
+	if o.Nodes < 0 {
+		return fmt.Errorf("%w: node limit %d is negative", ErrInvalidOptions, o.Nodes)
+	}
+	if o.Nodes > 0 {
+		limits++
+	}
+	if o.TimeBudget < 0 {
+		return fmt.Errorf("%w: time budget %v is negative", ErrInvalidOptions, o.TimeBudget)
+	}
+	if o.TimeBudget > 0 {
+		limits++
+	}
+	if limits > 1 {
+		return fmt.Errorf("%w: depth, move time, node, and time budget limits are mutually exclusive", ErrInvalidOptions)
+	}
+	if limits == 0 {
+		o.Depth = DefaultDepth
+	}
+	if o.ClassifierProfile != "" {
+		profile, err := ClassifierProfileByName(o.ClassifierProfile)
+		if err != nil {
+			return err
+		}
+		o.MoveClassifier = profile.Classifier()
+	}
+	for _, name := range o.TimeControlProfiles {
+		if _, err := ClassifierProfileByName(name); err != nil {
+			return err
+		}
+	}
+	if o.MoveClassifier == nil {
+		return fmt.Errorf("%w: move classifier is nil", ErrInvalidOptions)
+	}
+	if o.Context == nil {
+		return fmt.Errorf("%w: context is nil", ErrInvalidOptions)
+	}
+	if o.EngineFactory == nil {
+		return fmt.Errorf("%w: engine factory is nil", ErrInvalidOptions)
+	}
+	if o.EngineTimeout <= 0 {
+		return fmt.Errorf("%w: engine timeout %v must be positive", ErrInvalidOptions, o.EngineTimeout)
+	}
+	if o.TimeTroubleThreshold < 0 {
+		return fmt.Errorf("%w: time trouble threshold %v is negative", ErrInvalidOptions, o.TimeTroubleThreshold)
+	}
+	if o.MultiPV < 1 || o.MultiPV > MaxMultiPV {
+		return fmt.Errorf("%w: MultiPV %d is outside 1-%d", ErrInvalidOptions, o.MultiPV, MaxMultiPV)
+	}
+	if o.DepthRetries < 0 || o.DepthRetries > MaxDepthRetries {
+		return fmt.Errorf("%w: depth retries %d is outside 0-%d", ErrInvalidOptions, o.DepthRetries, MaxDepthRetries)
+	}
+	if err := validateSide(o.Side); err != nil {
+		return err
+	}
+	if err := validateEarlyStop(o.EarlyStop); err != nil {
+		return err
+	}
+	return validateMustWin(o.MustWin)
+}
+
+// startEngine starts the analysis engine, first waiting for room in the engine
+// pool if there is one
+func (o *AnalyzeChessGameOptions) startEngine() (Engine, error) {
+	if o.EnginePool != nil {
+		return o.EnginePool.Acquire(o.Context, o.Priority, o.EngineFactory)
+	}
+	return o.EngineFactory()
+}
+
+// searchLimits returns the per-move engine search limits for the options
+func (o *AnalyzeChessGameOptions) searchLimits() SearchLimits {
+	return SearchLimits{
+		Depth:    o.Depth,
+		MoveTime: o.MoveTime,
+		Nodes:    o.Nodes,
+		Timeout:  o.EngineTimeout,
+		MultiPV:  o.MultiPV,
+		Contempt: o.Contempt,
+	}
+}
+
+// ResolveOptions applies opts to the defaults and validates the result,
+// returning the settings an analysis with those options would use
+func ResolveOptions(opts ...AnalyzeChessGameOption) (*AnalyzeChessGameOptions, error) {
+	analysisOpts := defaultAnalyzeChessGameOptions
+	for _, opt := range opts {
+		opt(&analysisOpts)
+	}
+	if err := analysisOpts.validate(); err != nil {
+		return nil, err
+	}
+	return &analysisOpts, nil
+}
+
+// EffectiveOptions records the settings an analysis actually ran with
+type EffectiveOptions struct {
+	Depth                int
+	MoveTime             time.Duration
+	Nodes                int64
+	TimeBudget           time.Duration
+	Classifier           string
+	ClassifierProfile    string
+	EngineTimeout        time.Duration
+	TimeTroubleThreshold time.Duration
+	MultiPV              int
+	ExcludeDeadDraw      bool
+	DepthRetries         int
+	VerifyMates          bool
+	Contempt             int
+	MustWin              string
+	Side                 string     // The side analyzed alone, see WithSide
+	EarlyStop            *EarlyStop // When decided games stopped being searched in full, see WithEarlyStop
+	// RatedThresholds are the thresholds each side's moves were classified
+	// with, when scaled to their ratings; see WithRatingScaling
+	RatedThresholds []RatedThresholds
+	// TimeControlProfiles are the classifier profiles of the speed classes,
+	// by name, see WithTimeControlProfiles
+	TimeControlProfiles map[string]string
+
+	// ratedThresholds fills in RatedThresholds from a game's headers
+	ratedThresholds func(headers map[string]string) []RatedThresholds
+	// repertoires are the players' prepared openings, see WithRepertoire
+	repertoires map[string]*Repertoire
+}
+
+// Effective returns the reportable form of the options
+func (o *AnalyzeChessGameOptions) Effective() EffectiveOptions {
+	effective := EffectiveOptions{
+		Depth:                o.Depth,
+		MoveTime:             o.MoveTime,
+		Nodes:                o.Nodes,
+		TimeBudget:           o.TimeBudget,
+		Classifier:           fmt.Sprintf("%T", o.MoveClassifier),
+		ClassifierProfile:    o.ClassifierProfile,
+		EngineTimeout:        o.EngineTimeout,
+		TimeTroubleThreshold: o.TimeTroubleThreshold,
+		MultiPV:              o.MultiPV,
+		ExcludeDeadDraw:      o.ExcludeDeadDraw,
+		DepthRetries:         o.DepthRetries,
+		VerifyMates:          o.VerifyMates,
+		Contempt:             o.Contempt,
+		MustWin:              o.MustWin,
+		Side:                 o.Side,
+		EarlyStop:            o.EarlyStop,
+		repertoires:          o.Repertoires,
+	}
+	if len(o.TimeControlProfiles) > 0 {
+		effective.TimeControlProfiles = map[string]string{}
+		for category, profile := range o.TimeControlProfiles {
+			effective.TimeControlProfiles[category.String()] = profile
+		}
+	}
+	if o.RatingScaler != nil {
+		opts := *o
+		effective.ratedThresholds = func(headers map[string]string) []RatedThresholds {
+			return ratedProfiles(opts.baseProfile(headers), opts.RatingScaler, headers)
+		}
+	}
+	return effective
 }
 
 type AnalyzeChessGameOption func(*AnalyzeChessGameOptions)
@@ -206,81 +863,341 @@ func WithDepth(depth int) AnalyzeChessGameOption {
 	}
 }
 
+// WithMoveTime searches each move for the given time instead of to a fixed depth
+func WithMoveTime(moveTime time.Duration) AnalyzeChessGameOption {
+	return func(opts *AnalyzeChessGameOptions) {
+		opts.MoveTime = moveTime
+	}
+}
+
+// WithNodes searches each move for the given number of nodes instead of to a fixed depth
+func WithNodes(nodes int64) AnalyzeChessGameOption {
+	return func(opts *AnalyzeChessGameOptions) {
+		opts.Nodes = nodes
+	}
+}
+
+// WithTimeBudget limits the whole analysis to the given wall-clock time. Each
+// move is searched for its share of the time left, and if the budget runs out
+// the analysis stops with ErrTimeBudgetExceeded.
+func WithTimeBudget(budget time.Duration) AnalyzeChessGameOption {
+	return func(opts *AnalyzeChessGameOptions) {
+		opts.TimeBudget = budget
+	}
+}
+
 func WithMoveClassifier(moveClassifier MoveClassifier) AnalyzeChessGameOption {
 	return func(opts *AnalyzeChessGameOptions) {
 		opts.MoveClassifier = moveClassifier
 	}
 }
 
-// AnalyzeChessGameStreaming analyzes a chess game move by move, sending results through a channel
-func AnalyzeChessGameStreaming(pgn string, opts ...AnalyzeChessGameOption) (<-chan *MoveAnalysis, <-chan error) {
-	// Process options
-	analysisOpts := defaultAnalyzeChessGameOptions
-	for _, opt := range opts {
-		opt(&analysisOpts)
+// WithEngineTimeout sets how long a single engine search may run before the engine
+// is told to stop; an engine that doesn't answer is restarted and ErrEngineTimeout is returned
+func WithEngineTimeout(timeout time.Duration) AnalyzeChessGameOption {
+	return func(opts *AnalyzeChessGameOptions) {
+		opts.EngineTimeout = timeout
+	}
+}
+
+// WithEngineFactory analyzes with engines started by factory instead of a local Stockfish
+func WithEngineFactory(factory EngineFactory) AnalyzeChessGameOption {
+	return func(opts *AnalyzeChessGameOptions) {
+		opts.EngineFactory = factory
+	}
+}
+
+// WithTimeTroubleThreshold marks moves played with less than threshold left on
+// the clock as time trouble, according to the PGN's %clk comments. Without
+// it, the threshold suits each game's TimeControl tag, or is
+// DefaultClockThreshold for games without one.
+func WithTimeTroubleThreshold(threshold time.Duration) AnalyzeChessGameOption {
+	return func(opts *AnalyzeChessGameOptions) {
+		opts.TimeTroubleThreshold = threshold
+	}
+}
+
+// WithMultiPV has the engine report its best few moves per position instead
+// of only the best one, so played moves can be ranked among them
+func WithMultiPV(lines int) AnalyzeChessGameOption {
+	return func(opts *AnalyzeChessGameOptions) {
+		opts.MultiPV = lines
+	}
+}
+
+// WithDepthRetries repeats the search of a move up to retries times when it
+// stops short of the depth given with WithDepth, with twice the engine timeout
+// each time, so that moves are compared at the same depth. Searches that stop
+// early for a single legal move or a forced mate aren't repeated. Moves keep
+// the depth they reached either way; see MoveAnalysis.ShortOfDepth.
+func WithDepthRetries(retries int) AnalyzeChessGameOption {
+	return func(opts *AnalyzeChessGameOptions) {
+		opts.DepthRetries = retries
+	}
+}
+
+// WithMateVerification confirms every forced mate a move missed with a
+// search for a mate in as many moves before reporting it. Mates the search
+// doesn't find are taken back, and those it finds are marked as verified; see
+// MoveAnalysis.MissedMate.
+func WithMateVerification() AnalyzeChessGameOption {
+	return func(opts *AnalyzeChessGameOptions) {
+		opts.VerifyMates = true
+	}
+}
+
+// WithoutDeadDrawMoves leaves the moves played after the game became a dead
+// draw out of the players' accuracy and other statistics, see DetectDeadDraw
+func WithoutDeadDrawMoves() AnalyzeChessGameOption {
+	return func(opts *AnalyzeChessGameOptions) {
+		opts.ExcludeDeadDraw = true
+	}
+}
+
+// WithTablebase probes tablebase when adjudicating the final position of an
+// unfinished game, and for a dead draw earlier than the engine shows
+func WithTablebase(tablebase Tablebase) AnalyzeChessGameOption {
+	return func(opts *AnalyzeChessGameOptions) {
+		opts.Tablebase = tablebase
 	}
+}
+
+// WithTheory finds the novelty of analyzed games against theory, such as a
+// PolyglotTheory or PGNTheory
+func WithTheory(theory Theory) AnalyzeChessGameOption {
+	return func(opts *AnalyzeChessGameOptions) {
+		opts.Theory = theory
+	}
+}
+
+// WithSkipBook skips the engine search for moves found in the theory given
+// with WithTheory. Book moves take their evaluation from theory that
+// implements TheoryEvaluator, or keep the evaluation before the move.
+func WithSkipBook() AnalyzeChessGameOption {
+	return func(opts *AnalyzeChessGameOptions) {
+		opts.SkipBook = true
+	}
+}
+
+// WithSearchCache reuses the searches of other analyses sharing the cache
+func WithSearchCache(cache *SearchCache) AnalyzeChessGameOption {
+	return func(opts *AnalyzeChessGameOptions) {
+		opts.SearchCache = cache
+	}
+}
+
+// WithEmbeddedEvals reuses the evaluations annotated in the PGN with [%eval],
+// such as those of games analyzed on Lichess, for the moves that have them.
+// Only the other moves are searched, and no engine is started if none are
+// left. The PGN doesn't say what the best move was, so reused moves have none.
+func WithEmbeddedEvals() AnalyzeChessGameOption {
+	return func(opts *AnalyzeChessGameOptions) {
+		opts.EmbeddedEvals = true
+	}
+}
 
+// WithEnginePool waits for room in pool before starting the engine, behind any
+// analyses of a higher priority
+func WithEnginePool(pool *EnginePool, priority Priority) AnalyzeChessGameOption {
+	return func(opts *AnalyzeChessGameOptions) {
+		opts.EnginePool = pool
+		opts.Priority = priority
+	}
+}
+
+// WithContext stops the analysis with ErrAnalysisCancelled when ctx is done
+func WithContext(ctx context.Context) AnalyzeChessGameOption {
+	return func(opts *AnalyzeChessGameOptions) {
+		opts.Context = ctx
+	}
+}
+
+// AnalyzeChessGameStreaming analyzes a chess game move by move, sending results through a channel
+func AnalyzeChessGameStreaming(pgn string, opts ...AnalyzeChessGameOption) (<-chan *MoveAnalysis, <-chan error) {
 	results := make(chan *MoveAnalysis)
 	errc := make(chan error, 1)
 
+	// Process options
+	analysisOpts, err := ResolveOptions(opts...)
+	if err != nil {
+		errc <- err
+		close(results)
+		close(errc)
+		return results, errc
+	}
+
 	if pgn == "" {
-		errc <- fmt.Errorf("empty PGN")
+		errc <- fmt.Errorf("%w: empty PGN", ErrEmptyGame)
 		close(results)
 		close(errc)
 		return results, errc
 	}
 
+	deadline := time.Now().Add(analysisOpts.TimeBudget)
 	go func() {
 		defer close(results)
 		defer close(errc)
 
-		// Initialize Stockfish engine
-		log.Info("Initializing Stockfish engine")
-		engine, err := NewStockfishEngine()
-		if err != nil {
-			errc <- fmt.Errorf("failed to initialize Stockfish: %v", err)
-			return
-		}
-		defer engine.Close()
-		log.Info("Stockfish engine initialized")
+		// The engine is started for the first move that needs a search, since
+		// moves with embedded evaluations don't
+		var engine, secondEngine Engine
+		var secondName string
+		defer func() {
+			if engine != nil {
+				engine.Close()
+			}
+			if secondEngine != nil {
+				secondEngine.Close()
+			}
+		}()
 
 		// Parse PGN
 		log.Info("Parsing PGN")
-		reader := strings.NewReader(pgn)
-		pgnOpt, err := chess.PGN(reader)
+		moves, err := parseMainline(pgn)
 		if err != nil {
 			log.Error("Error parsing PGN", "error", err)
-			errc <- fmt.Errorf("error parsing PGN: %v", err)
+			errc <- fmt.Errorf("%w: %v", ErrInvalidPGN, err)
 			return
 		}
-		log.Info("PGN parsed")
-
-		// Create new game from PGN
-		log.Info("Creating new game from PGN")
-		game := chess.NewGame(pgnOpt)
-		log.Info("Game created", "moves", len(game.Moves()))
+		log.Info("PGN parsed", "moves", len(moves))
+		headers := parsePGNHeaders(pgn)
+		classifier := analysisOpts.classifierFor(headers)
+		timeTroubleThreshold := gameTimeTroubleThreshold(analysisOpts.TimeTroubleThreshold, headers)
 
-		moves := game.Moves()
-		var previousWhiteScore float64 = StartingPositionWhiteScore
+		var previousWhiteScore Score = StartingPositionWhiteScore
 		var previousWhiteWinProb float64 = StartingPositionWhiteWinProb
 		var previousWhiteDrawProb float64 = StartingPositionWhiteDrawProb
 		var previousWhiteLossProb float64 = StartingPositionWhiteLossProb
-		var uciMoves []string
-		runningGame := chess.NewGame()
-		// Analyze each position
-		for i := 0; i < len(moves); i++ {
-			tempGame := runningGame.Clone()
-			lastMove := moves[i]
-			lastMoveSan := moveToSan(tempGame.Position(), lastMove)
-
-			err = runningGame.PushMove(lastMoveSan, &chess.PushMoveOptions{
-				ForceMainline: true,
-			})
+		uciMoves := make([]string, 0, len(moves))
+		phase := Opening
+		ctx := analysisOpts.Context
+		searches := analysisOpts.SearchCache
+		if searches == nil {
+			searches = NewSearchCache()
+		}
+		limits := analysisOpts.searchLimits()
+		// After a null move the engine can't replay the game from the start,
+		// so moves are searched by their positions instead
+		afterNullMove := false
+		// The search of the previous move, which expects the recaptures
+		// WithSkipForced skips; nil when it wasn't searched
+		var previousResult *AnalysisResult
+		// How often each position occurred, for drawing by repetition
+		repetitions := make(map[string]int)
+		// How many analyzed moves in a row were decided, see WithEarlyStop
+		decidedMoves := 0
+		// Mistakes without a refutation are searched for one, missed mates
+		// are verified, and lost positions searched for a practical try,
+		// with the engine started for them if no move needed it. They only
+		// explain a move, so they are given up if the engine can't start.
+		explanationsUnavailable := false
+		explainingEngine := func() bool {
+			if engine == nil && !explanationsUnavailable {
+				var err error
+				if engine, err = analysisOpts.startEngine(); err != nil {
+					log.Warn("Can't start the engine to explain moves", "error", err)
+					explanationsUnavailable = true
+				}
+			}
+			return !explanationsUnavailable
+		}
+		refuteMistake := func(analysis *MoveAnalysis, after *chess.Position) {
+			if !needsRefutation(analysis) || !explainingEngine() {
+				return
+			}
+			if err := refute(engine, analysis, after, limits.Timeout); err != nil {
+				log.Warn("Failed to refute mistake", "error", err, "move", MoveLabel(analysis))
+			}
+		}
+		tryPractically := func(analysis *MoveAnalysis, before *chess.Position, limits SearchLimits) {
+			if !analysisOpts.PracticalTries || !needsPracticalTry(analysis) || !explainingEngine() {
+				return
+			}
+			try, err := findPracticalTry(engine, analysis, before, limits)
 			if err != nil {
-				log.Error("Error moving in running game", "error", err, "move", moves[i].String(), "san", lastMoveSan, "position", tempGame.Position().String())
-				errc <- fmt.Errorf("error moving in running game: %v", err)
+				log.Warn("Failed to find a practical try", "error", err, "move", MoveLabel(analysis))
+				return
+			}
+			analysis.PracticalTry = try
+		}
+		verifyMate := func(analysis *MoveAnalysis) {
+			if !analysisOpts.VerifyMates || analysis.MissedMate == 0 || !explainingEngine() {
+				return
+			}
+			if err := verifyMissedMate(engine, analysis, limits.Timeout); err != nil {
+				log.Warn("Failed to verify missed mate", "error", err, "move", MoveLabel(analysis))
+			}
+		}
+		send := func(analysis *MoveAnalysis) bool {
+			if analysisOpts.Symbols != nil {
+				analysis.ClassificationSymbol = analysisOpts.Symbols.Symbol(analysis.Classification)
+			}
+			if analysisOpts.MustWin != "" {
+				judgePractically(analysis, analysisOpts.MustWin)
+			}
+			select {
+			case results <- analysis:
+			case <-ctx.Done():
+				errc <- fmt.Errorf("%w: %v", ErrAnalysisCancelled, ctx.Err())
+				return false
+			}
+
+			// Update for next iteration
+			if stop := analysisOpts.EarlyStop; stop != nil && !analysis.Skipped && analysis.Evaluated() {
+				if stop.decides(analysis.WhiteScore) {
+					decidedMoves++
+				} else {
+					decidedMoves = 0
+				}
+			}
+			previousWhiteScore = analysis.WhiteScore
+			previousWhiteWinProb = analysis.WhiteWinProb
+			previousWhiteDrawProb = analysis.WhiteDrawProb
+			previousWhiteLossProb = analysis.WhiteLossProb
+			return true
+		}
+		// Analyze each position, walking the parsed moves which already hold
+		// the positions before and after them
+		for i, lastMove := range moves {
+			if ctx.Err() != nil {
+				errc <- fmt.Errorf("%w: %v", ErrAnalysisCancelled, ctx.Err())
 				return
 			}
+			lastResult := previousResult
+			previousResult = nil
+			if lastMove == nil {
+				// A null move only passes the turn, so there's nothing to
+				// search, but it still counts for the move numbers
+				afterNullMove = true
+				continue
+			}
+
+			// Share the time left between the remaining moves, allowing for a
+			// second search of moves that weren't the engine's choice, and for
+			// the second opinion
+			moveLimits := limits
+			if analysisOpts.TimeBudget > 0 {
+				remaining := time.Until(deadline)
+				if remaining <= 0 {
+					errc <- fmt.Errorf("%w after %d of %d moves", ErrTimeBudgetExceeded, i, len(moves))
+					return
+				}
+				searchesPerMove := 2
+				if analysisOpts.SecondOpinion != nil {
+					searchesPerMove = 3
+				}
+				searchedMoves := len(moves) - i
+				if analysisOpts.Side != "" {
+					// Every other move is the opponent's, which isn't searched
+					searchedMoves = (searchedMoves + 1) / 2
+				}
+				moveLimits.MoveTime = max(remaining/time.Duration(searchesPerMove*searchedMoves), time.Millisecond)
+			}
+
+			before, after := lastMove.Parent().Position(), lastMove.Position()
+			repetitions[positionKey(before.String())]++
+			lastMoveSan := moveToSan(before, lastMove)
+			playedUci := moveToUci(before, lastMove)
 
 			moveNum := (i / 2) + 1
 			color := "White"
@@ -288,37 +1205,151 @@ func AnalyzeChessGameStreaming(pgn string, opts ...AnalyzeChessGameOption) (<-ch
 				color = "Black"
 			}
 
+			phase = detectPhase(before, moveNum, phase)
+
 			// Get the current move
 			moveText := lastMoveSan
-			uciMoves = append(uciMoves, moveToUci(tempGame.Position(), lastMove))
+			uciMoves = append(uciMoves, playedUci)
 
 			// Create analysis entry
 			analysis := &MoveAnalysis{
 				MoveNumber:            moveNum,
 				Color:                 color,
 				MoveText:              moveText,
+				Piece:                 pieceTypeNames[before.Board().Piece(lastMove.S1()).Type()],
+				IsCapture:             lastMove.HasTag(chess.Capture) || lastMove.HasTag(chess.EnPassant),
+				IsCheck:               lastMove.HasTag(chess.Check),
+				IsPromotion:           lastMove.Promo() != chess.NoPieceType,
+				Phase:                 phase,
+				FENBefore:             before.String(),
+				FENAfter:              after.String(),
 				PreviousWhiteScore:    previousWhiteScore,
 				PreviousWhiteWinProb:  previousWhiteWinProb,
 				PreviousWhiteDrawProb: previousWhiteDrawProb,
 				PreviousWhiteLossProb: previousWhiteLossProb,
+				Annotation:            lastMove.NAG(),
+			}
+			// Moves that checkmate need no search, and moves that end the game
+			// in a draw only need the best move in the position before them
+			terminal := terminalMethod(after)
+			analysis.TerminalStatus = terminalStatus(terminal)
+			searchMove := func(engine Engine, moveLimits SearchLimits) (*AnalysisResult, error) {
+				switch terminal {
+				case chess.NoMethod:
+					if afterNullMove {
+						return analyzeFromPositions(engine, analysis.FENBefore, analysis.FENAfter, playedUci, moveLimits)
+					}
+					return engine.AnalyzeLastMove(uciMoves, moveLimits)
+				case chess.Checkmate:
+					return checkmateResult(playedUci, color, moveLimits.Depth), nil
+				}
+				return analyzeDrawingMove(engine, analysis.FENBefore, playedUci, moveLimits)
 			}
 
-			// Analyze position after the move
-			result, err := engine.analyzeLastMove(uciMoves, analysisOpts.Depth)
-			if err != nil {
-				errc <- fmt.Errorf("analysis error at move %d: %v", moveNum, err)
-				return
+			if clk, ok := lastMove.GetCommand("clk"); ok {
+				if clock, err := parseClock(clk); err == nil {
+					analysis.Clock = clock
+					analysis.HasClock = true
+					analysis.TimeTrouble = clock < timeTroubleThreshold
+				} else {
+					log.Warn("Ignoring invalid clock", "error", err, "move", moveNum)
+				}
+			}
+
+			decided := analysisOpts.EarlyStop != nil && decidedMoves >= analysisOpts.EarlyStop.Moves
+			analysis.Decided = decided
+			if analysisOpts.Side != "" && color != analysisOpts.Side || decided && analysisOpts.EarlyStop.Skip {
+				var embeddedEval *Score
+				if eval, ok := lastMove.GetCommand("eval"); ok && analysisOpts.EmbeddedEvals {
+					if score, err := parseEval(eval); err == nil {
+						embeddedEval = &score
+					}
+				}
+				skipMove(analysis, embeddedEval)
+				if !send(analysis) {
+					return
+				}
+				continue
+			}
+
+			if analysisOpts.SkipBook && analysisOpts.Theory != nil {
+				if _, followed, ok := checkTheory(analysis, analysisOpts.Theory); ok && followed {
+					analyzeBookMove(analysis, analysisOpts.Theory)
+					if !send(analysis) {
+						return
+					}
+					continue
+				}
+			}
+
+			if analysisOpts.EmbeddedEvals {
+				if eval, ok := lastMove.GetCommand("eval"); ok {
+					if score, err := parseEval(eval); err == nil {
+						analyzeEmbeddedEval(analysis, score, classifier)
+						refuteMistake(analysis, after)
+						if !send(analysis) {
+							return
+						}
+						continue
+					}
+					log.Warn("Ignoring invalid evaluation", "eval", eval, "move", moveNum)
+				}
+			}
+
+			if analysisOpts.SkipForced && terminal == chess.NoMethod && isForcedMove(before, lastMove, lastResult) {
+				analyzeForcedMove(analysis, playedUci)
+				if !send(analysis) {
+					return
+				}
+				continue
+			}
+
+			// Decided games are searched shallower, and cached apart from
+			// searches in full
+			cacheLimits := limits
+			if decided {
+				moveLimits = decidedLimits(moveLimits)
+				cacheLimits = decidedLimits(limits)
+			}
+
+			// Analyze position after the move, unless the move was already
+			// searched in a repeated or transposed position
+			result, reusedFrom, reused := searches.lookup(analysis.FENBefore, playedUci, cacheLimits)
+			if reused {
+				analysis.ReusedFrom = reusedFrom
+			} else {
+				if engine == nil && terminal != chess.Checkmate {
+					log.Info("Initializing engine")
+					if engine, err = analysisOpts.startEngine(); err != nil {
+						errc <- fmt.Errorf("failed to initialize engine: %w", err)
+						return
+					}
+					log.Info("Engine initialized")
+				}
+				search := func(limits SearchLimits) (*AnalysisResult, error) { return searchMove(engine, limits) }
+				result, analysis.DepthRetries, err = searchToDepth(search, moveLimits, analysisOpts.DepthRetries, before)
+				if err != nil {
+					errc <- fmt.Errorf("analysis error at move %d: %w", moveNum, err)
+					return
+				}
+				// Heuristic evaluations aren't kept, so an engine started
+				// later searches the move properly
+				analysis.Heuristic = terminal != chess.Checkmate && IsHeuristic(engine)
+				if !analysis.Heuristic {
+					searches.store(analysis.FENBefore, playedUci, cacheLimits, result, MoveLabel(analysis))
+				}
 			}
 			analysis.BestMove = result.BestMove
+			previousResult = result
 
 			// Convert best move to SAN format and get its score
 			if result.BestMove != "" {
-				bestMove, err := chess.UCINotation{}.Decode(tempGame.Position(), result.BestMove)
+				bestMove, err := chess.UCINotation{}.Decode(before, result.BestMove)
 				if err != nil {
 					log.Error("Error parsing best move", "error", err, "bestMove", result.BestMove)
 					continue
 				}
-				analysis.BestMoveSAN = chess.AlgebraicNotation{}.Encode(tempGame.Position(), bestMove)
+				analysis.BestMoveSAN = chess.AlgebraicNotation{}.Encode(before, bestMove)
 			}
 
 			// Store the score and probabilities
@@ -326,32 +1357,85 @@ func AnalyzeChessGameStreaming(pgn string, opts ...AnalyzeChessGameOption) (<-ch
 			analysis.WhiteWinProb = result.WhiteWinProb
 			analysis.WhiteDrawProb = result.WhiteDrawProb
 			analysis.WhiteLossProb = result.WhiteLossProb
+			analysis.BestMoveWhiteScore = result.BestMoveWhiteScore
 			analysis.BestMoveWhiteWinProb = result.BestMoveWhiteWinProb
 			analysis.BestMoveWhiteDrawProb = result.BestMoveWhiteDrawProb
 			analysis.BestMoveWhiteLossProb = result.BestMoveWhiteLossProb
+			if i > 0 && (moves[i-1] == nil || analysisOpts.Side != "") {
+				// The evaluation before the null move is of the other side
+				// to move, and the opponent's move before this one wasn't
+				// searched with WithSide, so the position is measured by
+				// its best move
+				analysis.PreviousWhiteScore = result.BestMoveWhiteScore
+				analysis.PreviousWhiteWinProb = result.BestMoveWhiteWinProb
+				analysis.PreviousWhiteDrawProb = result.BestMoveWhiteDrawProb
+				analysis.PreviousWhiteLossProb = result.BestMoveWhiteLossProb
+			}
+			analysis.Depth = result.Depth
+			analysis.RequestedDepth = moveLimits.Depth
+			analysis.SelDepth = result.SelDepth
+			analysis.Nodes = result.Nodes
+			analysis.NPS = result.NPS
+			analysis.TimeSpent = result.TimeSpent
+			if analysisOpts.Diagnostics {
+				analysis.Diagnostics = newDiagnostics(result)
+			}
+			if len(result.PlayedLine) > 1 {
+				setRefutation(analysis, after, result.PlayedLine[1:])
+			}
 
 			// Calculate centipawn difference for backward compatibility
 
 			// Classify the move based on WDL probabilities
-			analysis.IsBestMove = result.BestMove == moveToUci(tempGame.Position(), lastMove)
+			analysis.IsBestMove = result.BestMove == playedUci
+			analysis.EngineRank = slices.Index(result.TopMoves, playedUci) + 1
+			analysis.Sharpness = positionSharpness(result.TopScores)
+			analysis.TopMoves = engineMoves(before, result.TopMoves, result.TopScores, result.TopLines)
+			analysis.Hints = moveHints(analysis)
 
-			analysis.Classification = analysisOpts.MoveClassifier.ClassifyMove(analysis)
+			detectSacrifices(analysis, before, result)
+			detectMissedDraw(analysis, before, result, repetitions)
+			detectMissedMate(analysis)
+			verifyMate(analysis)
+			tryPractically(analysis, before, moveLimits)
 
-			// Send analysis result
-			results <- analysis
+			analysis.Accuracy = moveAccuracy(analysis)
+			analysis.ExpectedPoints = expectedPoints(analysis)
+			analysis.CentipawnLoss = centipawnLoss(analysis)
+			analysis.Classification = classifier.ClassifyMove(analysis)
+			refuteMistake(analysis, after)
 
-			// Update for next iteration
-			previousWhiteScore = analysis.WhiteScore
-			previousWhiteWinProb = analysis.WhiteWinProb
-			previousWhiteDrawProb = analysis.WhiteDrawProb
-			previousWhiteLossProb = analysis.WhiteLossProb
+			if analysisOpts.SecondOpinion != nil {
+				if secondEngine == nil {
+					if secondEngine, err = analysisOpts.SecondOpinion(); err != nil {
+						errc <- fmt.Errorf("failed to initialize second opinion engine: %w", err)
+						return
+					}
+					if info, ok := DescribeEngine(secondEngine); ok {
+						secondName = info.Name
+					}
+				}
+				second, err := searchMove(secondEngine, moveLimits)
+				if err != nil {
+					errc <- fmt.Errorf("second opinion error at move %d: %w", moveNum, err)
+					return
+				}
+				analysis.SecondOpinion = newSecondOpinion(analysis, before, second, secondName)
+			}
 
+			// Send analysis result
+			if !send(analysis) {
+				return
+			}
 		}
 	}()
 
 	return results, errc
 }
 
+// AnalyzeChessGame analyzes every move of a chess game. If the time budget
+// given with WithTimeBudget runs out, it returns the moves analyzed so far
+// along with ErrTimeBudgetExceeded.
 func AnalyzeChessGame(pgn string, opts ...AnalyzeChessGameOption) ([]MoveAnalysis, error) {
 	// Start streaming analysis
 	movesChan, errChan := AnalyzeChessGameStreaming(pgn, opts...)
@@ -364,6 +1448,9 @@ func AnalyzeChessGame(pgn string, opts ...AnalyzeChessGameOption) ([]MoveAnalysi
 
 	// Check for any errors
 	if err := <-errChan; err != nil {
+		if errors.Is(err, ErrTimeBudgetExceeded) {
+			return results, err
+		}
 		return nil, err
 	}
 
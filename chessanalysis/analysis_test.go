@@ -1,7 +1,15 @@
 package chessanalysis
 
 import (
+	"encoding/json"
+	"errors"
+	"os/exec"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/walterschell/chess-analyzer/chessanalysis/uciengine"
 )
 
 const pgn = `
@@ -36,7 +44,108 @@ const invalidPgn = `
 1. e4 e5 2. invalid_move
 `
 
+const scholarsMatePgn = `
+[Event "Scholar's Mate"]
+[White "Player 1"]
+[Black "Player 2"]
+[Result "1-0"]
+
+1. e4 e5 2. Qh5 Nc6 3. Bc4 Nf6 4. Qxf7# 1-0
+`
+
+// requireStockfish skips tests that need a real Stockfish binary when none is installed
+func requireStockfish(t *testing.T) {
+	t.Helper()
+	if _, err := exec.LookPath("stockfish"); err != nil {
+		t.Skip("stockfish is not installed")
+	}
+}
+
+// scholarsMateEngine returns a fake engine that knows 3...Nf6 allows mate
+func scholarsMateEngine() *FakeEngine {
+	return &FakeEngine{
+		Positions: map[string]FakeEvaluation{
+			// Before 3...Nf6
+			"r1bqkbnr/pppp1ppp/2n5/4p2Q/2B1P3/8/PPPP1PPP/RNB1K1NR b KQkq - 3 3": {
+				BestMove: "g7g6",
+				Score:    0,
+				Moves:    map[string]int{"g8f6": -900},
+			},
+			// Before 4.Qxf7#
+			"r1bqkb1r/pppp1ppp/2n2n2/4p2Q/2B1P3/8/PPPP1PPP/RNB1K1NR w KQkq - 4 4": {
+				BestMove: "h5f7",
+				Score:    900,
+			},
+		},
+	}
+}
+
+func TestMoveFlags(t *testing.T) {
+	const promotionPgn = "[Result \"*\"]\n\n1. e4 d5 2. exd5 c6 3. dxc6 Nf6 4. cxb7 Nbd7 5. bxa8=Q *"
+	results, err := AnalyzeChessGame(promotionPgn, WithDepth(1), WithEngineFactory((&FakeEngine{}).NewEngine))
+	if err != nil {
+		t.Fatalf("failed to analyze game: %v", err)
+	}
+	tests := []struct {
+		ply                       int
+		piece                     string
+		capture, check, promotion bool
+	}{
+		{0, "Pawn", false, false, false},
+		{2, "Pawn", true, false, false},
+		{5, "Knight", false, false, false},
+		{8, "Pawn", true, false, true},
+	}
+	for _, test := range tests {
+		move := results[test.ply]
+		if move.Piece != test.piece || move.IsCapture != test.capture || move.IsCheck != test.check || move.IsPromotion != test.promotion {
+			t.Errorf("%s: expected %s capture=%t check=%t promotion=%t, got %s capture=%t check=%t promotion=%t",
+				MoveLabel(&move), test.piece, test.capture, test.check, test.promotion,
+				move.Piece, move.IsCapture, move.IsCheck, move.IsPromotion)
+		}
+	}
+}
+
+func TestAnalyzeChessGameWithFakeEngine(t *testing.T) {
+	results, err := AnalyzeChessGame(scholarsMatePgn, WithDepth(3), WithEngineFactory(scholarsMateEngine().NewEngine))
+	if err != nil {
+		t.Fatalf("failed to analyze game: %v", err)
+	}
+	if len(results) != 7 {
+		t.Fatalf("expected 7 analyzed moves, got %d", len(results))
+	}
+
+	blunder := results[5]
+	if blunder.MoveText != "Nf6" || blunder.Color != "Black" {
+		t.Fatalf("expected move 6 to be Black's Nf6, got %s %s", blunder.Color, blunder.MoveText)
+	}
+	if blunder.Classification != Blunder {
+		t.Errorf("expected Nf6 to be a blunder, got %s", blunder.Classification)
+	}
+	if blunder.BestMoveSAN != "g6" {
+		t.Errorf("expected best move g6, got %s", blunder.BestMoveSAN)
+	}
+	if blunder.WhiteScore != uciengine.Pawns(9) {
+		t.Errorf("expected White score 9.00 after Nf6, got %v", blunder.WhiteScore)
+	}
+	if blunder.Depth != 3 {
+		t.Errorf("expected search depth 3, got %d", blunder.Depth)
+	}
+
+	mate := results[6]
+	if !mate.IsBestMove || mate.Classification != Best {
+		t.Errorf("expected Qxf7# to be the best move, got %s", mate.Classification)
+	}
+	if mate.Piece != "Queen" || !mate.IsCapture || !mate.IsCheck || mate.IsPromotion {
+		t.Errorf("unexpected flags for Qxf7#: %s capture=%t check=%t promotion=%t", mate.Piece, mate.IsCapture, mate.IsCheck, mate.IsPromotion)
+	}
+	if mate.FENAfter != "r1bqkb1r/pppp1Qpp/2n2n2/4p3/2B1P3/8/PPPP1PPP/RNB1K1NR b KQkq - 0 4" {
+		t.Errorf("unexpected FEN after Qxf7#: %s", mate.FENAfter)
+	}
+}
+
 func TestAnalyzeChessGame(t *testing.T) {
+	requireStockfish(t)
 	t.Log("Analyzing game...")
 	results, err := AnalyzeChessGame(pgn, WithDepth(2))
 	if err != nil {
@@ -51,6 +160,7 @@ func TestAnalyzeChessGame(t *testing.T) {
 
 func TestAnalyzeChessGameStreaming(t *testing.T) {
 	t.Run("Valid PGN", func(t *testing.T) {
+		requireStockfish(t)
 		movesChan, errChan := AnalyzeChessGameStreaming(pgn, WithDepth(2))
 
 		moveCount := 0
@@ -167,3 +277,256 @@ func TestAnalyzeChessGameStreaming(t *testing.T) {
 // 		}
 // 	})
 // }
+
+func TestAnalyzeChessGameMultiPV(t *testing.T) {
+	engine := scholarsMateEngine()
+	engine.Positions["rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1"] = FakeEvaluation{
+		BestMove: "d2d4",
+		Score:    30,
+		Moves:    map[string]int{"e2e4": 25, "c2c4": 20},
+	}
+	results, err := AnalyzeChessGame(scholarsMatePgn, WithMultiPV(3), WithEngineFactory(engine.NewEngine))
+	if err != nil {
+		t.Fatalf("failed to analyze game: %v", err)
+	}
+	if results[0].IsBestMove || results[0].EngineRank != 2 {
+		t.Errorf("expected 1. e4 to be the engine's second choice, got rank %d", results[0].EngineRank)
+	}
+	if results[6].EngineRank != 1 {
+		t.Errorf("expected 4. Qxf7# to be the engine's first choice, got rank %d", results[6].EngineRank)
+	}
+	if results[5].EngineRank != 0 {
+		t.Errorf("expected 3...Nf6 to be outside the engine's top three, got rank %d", results[5].EngineRank)
+	}
+
+	white := Summarize(results).White
+	if white.TopThreeAgreement <= white.BestMoveAgreement {
+		t.Errorf("expected top three agreement above best move agreement, got %.1f and %.1f", white.TopThreeAgreement, white.BestMoveAgreement)
+	}
+}
+
+func TestMoveAnalysisJSONRoundTrip(t *testing.T) {
+	game := &GameAnalysis{
+		Headers: map[string]string{"White": "Player 1", "Black": "Player 2"},
+		Moves: []MoveAnalysis{
+			{
+				MoveNumber:     1,
+				Color:          "White",
+				MoveText:       "e4",
+				FENBefore:      "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1",
+				FENAfter:       "rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq e3 0 1",
+				WhiteScore:     uciengine.Pawns(0.3),
+				IsBestMove:     true,
+				BestMove:       "e2e4",
+				BestMoveSAN:    "e4",
+				WhiteWinProb:   0.05,
+				WhiteDrawProb:  0.93,
+				WhiteLossProb:  0.02,
+				Depth:          12,
+				Nodes:          12345,
+				TimeSpent:      250 * time.Millisecond,
+				Clock:          3 * time.Minute,
+				HasClock:       true,
+				TopMoves:       []EngineMove{{Move: "e4", UCI: "e2e4", WhiteScore: uciengine.Pawns(0.3), Line: []string{"e4", "e5"}}, {Move: "d4", UCI: "d2d4", WhiteScore: uciengine.Pawns(0.25)}},
+				Classification: Best,
+			},
+			{
+				MoveNumber:     1,
+				Color:          "Black",
+				MoveText:       "f6",
+				Classification: Questionable,
+				Annotation:     "?!",
+			},
+		},
+		Options: EffectiveOptions{
+			Depth:         12,
+			Classifier:    "*chessanalysis.ThresholdMoveClassifier",
+			EngineTimeout: uciengine.DefaultEngineTimeout,
+		},
+	}
+
+	data, err := json.Marshal(game)
+	if err != nil {
+		t.Fatalf("failed to marshal game analysis: %v", err)
+	}
+
+	var decoded GameAnalysis
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("failed to unmarshal game analysis: %v", err)
+	}
+
+	if !reflect.DeepEqual(game, &decoded) {
+		t.Errorf("round trip mismatch:\n got %+v\nwant %+v", decoded, *game)
+	}
+}
+
+func TestResolveOptions(t *testing.T) {
+	opts, err := ResolveOptions()
+	if err != nil {
+		t.Fatalf("unexpected error resolving default options: %v", err)
+	}
+	if opts.Depth != DefaultDepth {
+		t.Errorf("expected default depth %d, got %d", DefaultDepth, opts.Depth)
+	}
+
+	opts, err = ResolveOptions(WithMoveTime(time.Second))
+	if err != nil {
+		t.Fatalf("unexpected error resolving move time options: %v", err)
+	}
+	if opts.Depth != 0 || opts.MoveTime != time.Second {
+		t.Errorf("expected move time only, got depth %d and move time %v", opts.Depth, opts.MoveTime)
+	}
+
+	invalid := map[string][]AnalyzeChessGameOption{
+		"Depth too large":    {WithDepth(MaxDepth + 1)},
+		"Negative depth":     {WithDepth(-1)},
+		"Depth and nodes":    {WithDepth(10), WithNodes(1000)},
+		"Depth and movetime": {WithDepth(10), WithMoveTime(time.Second)},
+		"Nil classifier":     {WithMoveClassifier(nil)},
+		"Zero timeout":       {WithEngineTimeout(0)},
+		"Negative threshold": {WithTimeTroubleThreshold(-time.Second)},
+		"Zero MultiPV":       {WithMultiPV(0)},
+		"Unknown profile":    {WithClassifierProfile("grandmaster")},
+	}
+	for name, options := range invalid {
+		t.Run(name, func(t *testing.T) {
+			if _, err := ResolveOptions(options...); !errors.Is(err, ErrInvalidOptions) {
+				t.Errorf("expected ErrInvalidOptions, got %v", err)
+			}
+		})
+	}
+}
+
+func TestVariationsAreNotAnalyzed(t *testing.T) {
+	const variationPgn = "[Result \"*\"]\n\n1. e4 (1. d4 d5 2. c4) 1... e5 2. Nf3 *"
+	results, err := AnalyzeChessGame(variationPgn, WithDepth(1), WithEngineFactory((&FakeEngine{}).NewEngine))
+	if err != nil {
+		t.Fatalf("failed to analyze game: %v", err)
+	}
+	var played []string
+	for _, move := range results {
+		played = append(played, move.MoveText)
+	}
+	if !reflect.DeepEqual(played, []string{"e4", "e5", "Nf3"}) {
+		t.Fatalf("expected only the mainline, got %v", played)
+	}
+	if fen := results[1].FENBefore; fen != results[0].FENAfter {
+		t.Errorf("expected 1... e5 to be played after 1. e4, got %s", fen)
+	}
+	if fen := results[2].FENAfter; !strings.HasPrefix(fen, "rnbqkbnr/pppp1ppp/8/4p3/4P3/5N2/PPPP1PPP/RNBQKB1R b KQkq") {
+		t.Errorf("unexpected position after 2. Nf3: %s", fen)
+	}
+}
+
+func BenchmarkAnalyzeChessGame(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := AnalyzeChessGame(pgn, WithDepth(1), WithEngineFactory((&FakeEngine{}).NewEngine)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// slowEngine delays every move search, to run analyses out of time
+type slowEngine struct {
+	Engine
+	delay time.Duration
+}
+
+func (e slowEngine) AnalyzeLastMove(moves []string, limits SearchLimits) (*AnalysisResult, error) {
+	time.Sleep(e.delay)
+	return e.Engine.AnalyzeLastMove(moves, limits)
+}
+
+// shortLineEngine reports only the move searched as its line, like engines
+// that stop their principal variation early
+type shortLineEngine struct {
+	Engine
+}
+
+func (e shortLineEngine) AnalyzeLastMove(moves []string, limits SearchLimits) (*AnalysisResult, error) {
+	result, err := e.Engine.AnalyzeLastMove(moves, limits)
+	if err == nil && len(result.PlayedLine) > 1 {
+		result.PlayedLine = result.PlayedLine[:1]
+	}
+	return result, err
+}
+
+func TestBestReply(t *testing.T) {
+	moves, err := AnalyzeChessGame(scholarsMatePgn, WithDepth(3), WithEngineFactory(scholarsMateEngine().NewEngine))
+	if err != nil {
+		t.Fatalf("failed to analyze game: %v", err)
+	}
+	if nf6 := moves[5]; nf6.BestReply != "Qxf7#" || nf6.BestReplyUCI != "h5f7" {
+		t.Errorf("expected Qxf7# as the best reply to 3...Nf6, got %q (%q)", nf6.BestReply, nf6.BestReplyUCI)
+	}
+	if mate := moves[6]; mate.BestReply != "" {
+		t.Errorf("expected no reply to checkmate, got %q", mate.BestReply)
+	}
+
+	data, err := json.Marshal(&moves[5])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded MoveAnalysis
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.BestReply != "Qxf7#" || decoded.BestReplyUCI != "h5f7" {
+		t.Errorf("expected the best reply to survive JSON, got %s", data)
+	}
+}
+
+func TestMistakesAreRefuted(t *testing.T) {
+	factory := func() (Engine, error) {
+		engine, err := scholarsMateEngine().NewEngine()
+		return shortLineEngine{Engine: engine}, err
+	}
+	moves, err := AnalyzeChessGame(scholarsMatePgn, WithDepth(3), WithEngineFactory(factory))
+	if err != nil {
+		t.Fatalf("failed to analyze game: %v", err)
+	}
+	nf6 := moves[5]
+	if nf6.Classification != Blunder || !reflect.DeepEqual(nf6.Refutation, []string{"Qxf7#"}) || len(nf6.Hints.Refutation) != 1 {
+		t.Errorf("expected 3...Nf6 to be refuted by Qxf7#, got %v (%+v)", nf6.Refutation, nf6.Hints)
+	}
+	if nf6.BestReply != "Qxf7#" || nf6.BestReplyUCI != "h5f7" {
+		t.Errorf("expected the refutation's search to give the best reply, got %q (%q)", nf6.BestReply, nf6.BestReplyUCI)
+	}
+	for _, move := range moves {
+		if move.Classification != Blunder && move.Classification != Questionable && len(move.Refutation) > 0 {
+			t.Errorf("expected only mistakes to be refuted, got %v after %s", move.Refutation, move.MoveText)
+		}
+	}
+}
+
+func TestTimeBudget(t *testing.T) {
+	if _, err := ResolveOptions(WithTimeBudget(time.Minute), WithDepth(10)); !errors.Is(err, ErrInvalidOptions) {
+		t.Errorf("expected a time budget and a depth to be rejected, got %v", err)
+	}
+
+	game, err := AnalyzeGame(scholarsMatePgn, WithTimeBudget(time.Minute), WithEngineFactory(scholarsMateEngine().NewEngine))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if game.Summary.Partial || len(game.Moves) != 7 || game.Options.TimeBudget != time.Minute {
+		t.Errorf("expected a complete analysis within the budget, got %d moves", len(game.Moves))
+	}
+
+	slow := func() (Engine, error) {
+		engine, err := scholarsMateEngine().NewEngine()
+		return slowEngine{Engine: engine, delay: 30 * time.Millisecond}, err
+	}
+	game, err = AnalyzeGame(scholarsMatePgn, WithTimeBudget(50*time.Millisecond), WithEngineFactory(slow))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !game.Summary.Partial || len(game.Moves) == 0 || len(game.Moves) >= 7 {
+		t.Fatalf("expected a partial analysis, got %d moves", len(game.Moves))
+	}
+
+	moves, err := AnalyzeChessGame(scholarsMatePgn, WithTimeBudget(50*time.Millisecond), WithEngineFactory(slow))
+	if !errors.Is(err, ErrTimeBudgetExceeded) || len(moves) == 0 {
+		t.Errorf("expected the moves analyzed before the budget ran out, got %d moves and %v", len(moves), err)
+	}
+}
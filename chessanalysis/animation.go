@@ -0,0 +1,190 @@
+package chessanalysis
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/draw"
+	"image/gif"
+	"image/png"
+	"io"
+	"io/fs"
+	"time"
+)
+
+// DefaultFrameDelay is how long each move is shown in game animations
+const DefaultFrameDelay = time.Second
+
+// finalFrameDelay is how long the final position is shown before the animation loops
+const finalFrameDelay = 4 * time.Second
+
+// evalBarWidth is the width in pixels of the evaluation bar beside the board
+const evalBarWidth = 24
+
+// Colors of the animated board
+var (
+	lightSquareColor    = color.RGBA{0xf0, 0xd9, 0xb5, 0xff}
+	darkSquareColor     = color.RGBA{0xb5, 0x88, 0x63, 0xff}
+	lightHighlightColor = color.RGBA{0xcd, 0xd2, 0x6a, 0xff}
+	darkHighlightColor  = color.RGBA{0xaa, 0xa2, 0x3a, 0xff}
+	evalBarWhiteColor   = color.RGBA{0xff, 0xff, 0xff, 0xff}
+	evalBarBlackColor   = color.RGBA{0x40, 0x3d, 0x39, 0xff}
+	evalBarMidlineColor = color.RGBA{0xd8, 0x5a, 0x00, 0xff}
+	animationPalette    = append(color.Palette{lightSquareColor, darkSquareColor, lightHighlightColor, darkHighlightColor, evalBarWhiteColor, evalBarBlackColor, evalBarMidlineColor}, palette.WebSafe...)
+)
+
+// animationFrame is a position shown in a game animation
+type animationFrame struct {
+	fen       string
+	lastMove  string  // UCI move that led to the position, highlighted on the board
+	whiteEval float64 // White's expected score in percent, shown by the eval bar
+}
+
+// WriteGameGIF writes an animated GIF of the game, one frame per position,
+// with the last move highlighted and an evaluation bar showing White's
+// expected score. Piece images must be given with WithPieceImages; their size
+// sets the size of the squares.
+func WriteGameGIF(w io.Writer, game *GameAnalysis, opts ...BoardOption) error {
+	options := boardOptions{frameDelay: DefaultFrameDelay}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	if options.pieces == nil {
+		return fmt.Errorf("animating a game needs piece images")
+	}
+	if len(game.Moves) == 0 {
+		return ErrEmptyGame
+	}
+	pieces, squareSize, err := loadPieceImages(options.pieces)
+	if err != nil {
+		return err
+	}
+
+	first := &game.Moves[0]
+	frames := []animationFrame{{
+		fen:       first.FENBefore,
+		whiteEval: expectedScore("White", first.PreviousWhiteWinProb, first.PreviousWhiteDrawProb, first.PreviousWhiteLossProb),
+	}}
+	for i := range game.Moves {
+		move := &game.Moves[i]
+		frames = append(frames, animationFrame{
+			fen:       move.FENAfter,
+			lastMove:  playedMoveUCI(move),
+			whiteEval: expectedScore("White", move.WhiteWinProb, move.WhiteDrawProb, move.WhiteLossProb),
+		})
+	}
+
+	animation := &gif.GIF{}
+	bounds := image.Rect(0, 0, evalBarWidth+8*squareSize, 8*squareSize)
+	canvas := image.NewRGBA(bounds)
+	quantizer := newQuantizer(animationPalette)
+	for i, frame := range frames {
+		drawFrame(canvas, frame, pieces, squareSize, options.flipped)
+		paletted := image.NewPaletted(bounds, animationPalette)
+		quantizer.convert(paletted, canvas)
+		delay := options.frameDelay
+		if i == len(frames)-1 {
+			delay = max(delay, finalFrameDelay)
+		}
+		animation.Image = append(animation.Image, paletted)
+		animation.Delay = append(animation.Delay, int(delay/(10*time.Millisecond)))
+	}
+	return gif.EncodeAll(w, animation)
+}
+
+// loadPieceImages decodes the piece PNGs, keyed by FEN letter, and returns
+// their width
+func loadPieceImages(pieces fs.FS) (map[rune]image.Image, int, error) {
+	images := make(map[rune]image.Image)
+	size := 0
+	for _, piece := range "KQRBNPkqrbnp" {
+		name := pieceImageName(piece)
+		data, err := fs.ReadFile(pieces, name)
+		if err != nil {
+			return nil, 0, fmt.Errorf("loading piece image: %w", err)
+		}
+		img, err := png.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, 0, fmt.Errorf("decoding piece image %s: %w", name, err)
+		}
+		images[piece] = img
+		size = max(size, img.Bounds().Dx())
+	}
+	return images, size, nil
+}
+
+// drawFrame draws the eval bar and board of a frame onto the canvas
+func drawFrame(canvas *image.RGBA, frame animationFrame, pieces map[rune]image.Image, squareSize int, flipped bool) {
+	height := canvas.Bounds().Dy()
+
+	// The bar fills from White's side of the board
+	whiteHeight := int(float64(height) * frame.whiteEval / 100)
+	draw.Draw(canvas, image.Rect(0, 0, evalBarWidth, height), image.NewUniform(evalBarBlackColor), image.Point{}, draw.Src)
+	whiteBar := image.Rect(0, height-whiteHeight, evalBarWidth, height)
+	if flipped {
+		whiteBar = image.Rect(0, 0, evalBarWidth, whiteHeight)
+	}
+	draw.Draw(canvas, whiteBar, image.NewUniform(evalBarWhiteColor), image.Point{}, draw.Src)
+	draw.Draw(canvas, image.Rect(0, height/2-1, evalBarWidth, height/2+1), image.NewUniform(evalBarMidlineColor), image.Point{}, draw.Src)
+
+	highlighted := func(file, rank int) bool {
+		if len(frame.lastMove) < 4 {
+			return false
+		}
+		square := string(rune('a'+file)) + string(rune('1'+rank))
+		return square == frame.lastMove[0:2] || square == frame.lastMove[2:4]
+	}
+	b := parseBoard(frame.fen)
+	for rank := 0; rank < 8; rank++ {
+		for file := 0; file < 8; file++ {
+			x, y := file*squareSize, (7-rank)*squareSize
+			if flipped {
+				x, y = (7-file)*squareSize, rank*squareSize
+			}
+			square := image.Rect(evalBarWidth+x, y, evalBarWidth+x+squareSize, y+squareSize)
+			light := (rank+file)%2 == 1
+			fill := darkSquareColor
+			switch {
+			case light && highlighted(file, rank):
+				fill = lightHighlightColor
+			case light:
+				fill = lightSquareColor
+			case highlighted(file, rank):
+				fill = darkHighlightColor
+			}
+			draw.Draw(canvas, square, image.NewUniform(fill), image.Point{}, draw.Src)
+			if piece, ok := pieces[b[rank][file]]; ok {
+				draw.Draw(canvas, square, piece, piece.Bounds().Min, draw.Over)
+			}
+		}
+	}
+}
+
+// quantizer maps colors to the nearest palette entry, caching the results
+// since most of a frame is a handful of flat colors
+type quantizer struct {
+	palette color.Palette
+	cache   map[color.RGBA]uint8
+}
+
+func newQuantizer(p color.Palette) *quantizer {
+	return &quantizer{palette: p, cache: make(map[color.RGBA]uint8)}
+}
+
+// convert draws src onto dst, which must have the same bounds
+func (q *quantizer) convert(dst *image.Paletted, src *image.RGBA) {
+	bounds := src.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := src.RGBAAt(x, y)
+			index, ok := q.cache[c]
+			if !ok {
+				index = uint8(q.palette.Index(c))
+				q.cache[c] = index
+			}
+			dst.SetColorIndex(x, y, index)
+		}
+	}
+}
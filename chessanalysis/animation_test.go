@@ -0,0 +1,49 @@
+package chessanalysis
+
+import (
+	"bytes"
+	"image/gif"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestWriteGameGIF(t *testing.T) {
+	game, err := AnalyzeGame(scholarsMatePgn, WithEngineFactory(scholarsMateEngine().NewEngine))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteGameGIF(&bytes.Buffer{}, game); err == nil {
+		t.Error("expected an error without piece images")
+	}
+
+	var out bytes.Buffer
+	pieces := os.DirFS("../assets/static/pieces")
+	if err := WriteGameGIF(&out, game, WithPieceImages(pieces), WithFrameDelay(500*time.Millisecond)); err != nil {
+		t.Fatalf("failed to write GIF: %v", err)
+	}
+	animation, err := gif.DecodeAll(&out)
+	if err != nil {
+		t.Fatalf("failed to decode GIF: %v", err)
+	}
+	if len(animation.Image) != len(game.Moves)+1 {
+		t.Fatalf("expected %d frames, got %d", len(game.Moves)+1, len(animation.Image))
+	}
+	if animation.Delay[0] != 50 || animation.Delay[len(animation.Delay)-1] != 400 {
+		t.Errorf("unexpected frame delays %v", animation.Delay)
+	}
+
+	// After 1. e4 the e2 and e4 squares are highlighted; squares are 80 pixels
+	frame := animation.Image[1]
+	if got := frame.At(evalBarWidth+4*80+5, 6*80+5); got != lightHighlightColor {
+		t.Errorf("expected e2 to be highlighted, got %v", got)
+	}
+	if got := frame.At(evalBarWidth+5*80+5, 3*80+5); got != lightSquareColor {
+		t.Errorf("expected f5 to be a plain light square, got %v", got)
+	}
+	// White is winning after 4. Qxf7#, so its bar reaches far above the midline
+	last := animation.Image[len(animation.Image)-1]
+	if got := last.At(5, 100); got != evalBarWhiteColor {
+		t.Errorf("expected White's bar near the top, got %v", got)
+	}
+}
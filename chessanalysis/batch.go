@@ -0,0 +1,62 @@
+package chessanalysis
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	chess "github.com/corentings/chess/v2"
+)
+
+// SplitPGN splits a PGN database into the PGN text of each game
+func SplitPGN(pgn string) ([]string, error) {
+	scanner := chess.NewScanner(strings.NewReader(pgn))
+	var games []string
+	for scanner.HasNext() {
+		game, err := scanner.ScanGame()
+		if err != nil {
+			return nil, fmt.Errorf("%w: game %d: %v", ErrInvalidPGN, len(games)+1, err)
+		}
+		games = append(games, game.Raw)
+	}
+	if len(games) == 0 {
+		return nil, fmt.Errorf("%w: no games found", ErrEmptyGame)
+	}
+	return games, nil
+}
+
+// AnalyzeChessGames analyzes every game of a PGN database in order. Games that
+// fail to analyze are reported in the returned error, which joins the error of
+// each failed game; the successfully analyzed games are still returned. The
+// games share a SearchCache, since games from the same opening repeat many
+// positions. Give one with WithSearchCache to read its Stats afterwards.
+func AnalyzeChessGames(pgn string, opts ...AnalyzeChessGameOption) ([]*GameAnalysis, error) {
+	games, err := SplitPGN(pgn)
+	if err != nil {
+		return nil, err
+	}
+	analysisOpts, err := ResolveOptions(opts...)
+	if err != nil {
+		return nil, err
+	}
+	if analysisOpts.SearchCache == nil {
+		opts = append(slices.Clip(opts), WithSearchCache(NewSearchCache()))
+	}
+
+	var analyses []*GameAnalysis
+	var errs []error
+	for i, game := range games {
+		log.Info("Analyzing game", "game", i+1, "games", len(games))
+		analysis, err := AnalyzeGame(game, opts...)
+		if err != nil {
+			if errors.Is(err, ErrAnalysisCancelled) {
+				return analyses, err
+			}
+			errs = append(errs, fmt.Errorf("game %d: %w", i+1, err))
+			continue
+		}
+		analyses = append(analyses, analysis)
+	}
+	return analyses, errors.Join(errs...)
+}
@@ -0,0 +1,84 @@
+package chessanalysis
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/walterschell/chess-analyzer/chessanalysis/uciengine"
+)
+
+// BenchmarkPositions is the standard suite searched by RunBenchmark, from the
+// opening through the middlegame to pawn endings
+var BenchmarkPositions = []string{
+	"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1",
+	"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1",
+	"r3k2r/2pb1ppp/2pp1q2/p7/1nP1B3/1P2P3/P2N1PPP/R2QK2R w KQkq a6 0 14",
+	"4rrk1/pp1n3p/3q2pQ/2p1pb2/2PP4/2P3N1/P2B2PP/4RRK1 b - - 7 19",
+	"8/8/8/8/5kp1/P7/8/1K1N4 w - - 0 1",
+	"8/k7/3p4/p2P1p2/P2P1P2/8/8/K7 w - - 0 1",
+}
+
+// DefaultBenchmarkDepths are the depths RunBenchmark searches when none are given
+var DefaultBenchmarkDepths = []int{8, 12, 16, 20}
+
+// BenchmarkResult is how fast the engine searched the suite at one depth
+type BenchmarkResult struct {
+	Depth     int   `json:"depth"`
+	Positions int   `json:"positions"`
+	Nodes     int64 `json:"nodes"`
+	NPS       int64 `json:"nps"` // Nodes per second over the whole suite
+	// AverageTime is the mean search time per position. Analyzing a move
+	// searches once when it was the best move and twice otherwise.
+	AverageTime time.Duration `json:"averageTime"`
+}
+
+// RunBenchmark searches every position at each depth with an engine from the
+// factory, so users can pick a depth their hardware analyzes at a useful pace.
+// A nil positions uses BenchmarkPositions and a nil depths DefaultBenchmarkDepths.
+func RunBenchmark(ctx context.Context, factory EngineFactory, depths []int, positions []string) ([]BenchmarkResult, error) {
+	if depths == nil {
+		depths = DefaultBenchmarkDepths
+	}
+	if positions == nil {
+		positions = BenchmarkPositions
+	}
+	for _, depth := range depths {
+		if depth < 1 || depth > MaxDepth {
+			return nil, fmt.Errorf("%w: depth %d is outside 1-%d", ErrInvalidOptions, depth, MaxDepth)
+		}
+	}
+
+	engine, err := factory()
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize engine: %w", err)
+	}
+	defer engine.Close()
+
+	results := make([]BenchmarkResult, 0, len(depths))
+	for _, depth := range depths {
+		limits := SearchLimits{Depth: depth, Timeout: uciengine.DefaultEngineTimeout}
+		result := BenchmarkResult{Depth: depth, Positions: len(positions)}
+		var spent time.Duration
+		for _, fen := range positions {
+			if ctx.Err() != nil {
+				return results, fmt.Errorf("%w: %v", ErrAnalysisCancelled, ctx.Err())
+			}
+			search, err := engine.AnalyzePosition(fen, limits)
+			if err != nil {
+				return results, fmt.Errorf("benchmark at depth %d: %w", depth, err)
+			}
+			result.Nodes += search.Nodes
+			spent += search.TimeSpent
+		}
+		if spent > 0 {
+			result.NPS = int64(float64(result.Nodes) / spent.Seconds())
+		}
+		if len(positions) > 0 {
+			result.AverageTime = spent / time.Duration(len(positions))
+		}
+		log.Info("Benchmarked depth", "depth", depth, "nps", result.NPS, "averageTime", result.AverageTime)
+		results = append(results, result)
+	}
+	return results, nil
+}
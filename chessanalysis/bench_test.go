@@ -0,0 +1,32 @@
+package chessanalysis
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRunBenchmark(t *testing.T) {
+	results, err := RunBenchmark(context.Background(), (&FakeEngine{}).NewEngine, []int{2, 4}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("expected a result per depth, got %+v", results)
+	}
+	// The fake engine searches 1000 nodes per ply of depth in a millisecond per ply
+	for _, result := range results {
+		positions := int64(len(BenchmarkPositions))
+		if result.Positions != len(BenchmarkPositions) || result.Nodes != positions*int64(result.Depth)*1000 {
+			t.Errorf("unexpected result %+v", result)
+		}
+		if result.NPS != 1000000 || result.AverageTime != time.Duration(result.Depth)*time.Millisecond {
+			t.Errorf("unexpected speed %+v", result)
+		}
+	}
+
+	if _, err := RunBenchmark(context.Background(), (&FakeEngine{}).NewEngine, []int{0}, nil); !errors.Is(err, ErrInvalidOptions) {
+		t.Errorf("expected an invalid depth to be rejected, got %v", err)
+	}
+}
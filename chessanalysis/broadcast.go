@@ -0,0 +1,124 @@
+package chessanalysis
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// LichessBroadcast follows a round of an official Lichess broadcast through
+// its PGN stream, which sends every game of the round when it opens and then
+// each game again whenever a move is played on its board. The games are
+// analyzed by a Relay, whose Overview shows the whole round.
+type LichessBroadcast struct {
+	Client *http.Client // Without a timeout, since the stream stays open
+	URL    string
+	Round  string // Broadcast round ID
+	Relay  *Relay
+}
+
+// NewLichessBroadcast returns a follower for the Lichess broadcast round with
+// the given ID, analyzing its moves with the given options
+func NewLichessBroadcast(round string, opts ...AnalyzeChessGameOption) *LichessBroadcast {
+	return &LichessBroadcast{
+		Client: &http.Client{},
+		URL:    LichessURL,
+		Round:  round,
+		Relay:  NewRelay(fmt.Sprintf("%s/api/broadcast/round/%s.pgn", LichessURL, url.PathEscape(round)), opts...),
+	}
+}
+
+// Follow streams the round until ctx is done, calling update with the
+// analysis of each new move. The stream is opened again after the relay's
+// Interval whenever it ends or fails; moves already reported aren't again.
+func (b *LichessBroadcast) Follow(ctx context.Context, update func(RelayUpdate)) error {
+	interval := b.Relay.Interval
+	if interval <= 0 {
+		interval = DefaultRelayInterval
+	}
+	for {
+		err := b.stream(ctx, update)
+		if ctx.Err() != nil {
+			return fmt.Errorf("%w: %v", ErrAnalysisCancelled, ctx.Err())
+		}
+		if err != nil {
+			log.Warn("Lichess broadcast stream failed", "round", b.Round, "error", err)
+		}
+		select {
+		case <-time.After(interval):
+		case <-ctx.Done():
+			return fmt.Errorf("%w: %v", ErrAnalysisCancelled, ctx.Err())
+		}
+	}
+}
+
+// stream analyzes the games of the round's PGN stream until it ends
+func (b *LichessBroadcast) stream(ctx context.Context, update func(RelayUpdate)) error {
+	endpoint := fmt.Sprintf("%s/api/stream/broadcast/round/%s.pgn", b.URL, url.PathEscape(b.Round))
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	response, err := b.Client.Do(request)
+	if err != nil {
+		return fmt.Errorf("streaming broadcast round %s: %w", b.Round, err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("streaming broadcast round %s: %s", b.Round, response.Status)
+	}
+	return readPGNStream(response.Body, func(pgn string) error {
+		updates, err := b.Relay.UpdateGame(ctx, pgn)
+		for _, u := range updates {
+			update(u)
+		}
+		if errors.Is(err, ErrAnalysisCancelled) {
+			return err
+		}
+		if err != nil {
+			log.Warn("Failed to analyze broadcast game", "round", b.Round, "error", err)
+		}
+		return nil
+	})
+}
+
+// readPGNStream calls game with each game of a PGN stream as soon as its
+// movetext ends, rather than when the next game begins, since the next game
+// of a live stream may be a long time coming
+func readPGNStream(r io.Reader, game func(pgn string) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	var text strings.Builder
+	inMovetext := false
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "" && inMovetext:
+			if err := game(text.String()); err != nil {
+				return err
+			}
+			text.Reset()
+			inMovetext = false
+			continue
+		case line == "" && text.Len() == 0:
+			continue
+		case line != "" && !strings.HasPrefix(line, "["):
+			inMovetext = true
+		}
+		text.WriteString(line)
+		text.WriteByte('\n')
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if inMovetext {
+		return game(text.String())
+	}
+	return nil
+}
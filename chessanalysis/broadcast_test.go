@@ -0,0 +1,71 @@
+package chessanalysis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLichessBroadcast(t *testing.T) {
+	game := func(white, black, movetext string) string {
+		return fmt.Sprintf("[Event \"Open\"]\n[Round \"1\"]\n[White %q]\n[Black %q]\n[Result \"*\"]\n\n%s *\n\n\n", white, black, movetext)
+	}
+	next := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/stream/broadcast/round/abc.pgn" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, game("A", "B", "1. e4"), game("C", "D", "1. d4"))
+		w.(http.Flusher).Flush()
+		<-next
+		fmt.Fprint(w, game("A", "B", "1. e4 e5"))
+	}))
+	defer server.Close()
+	var once sync.Once
+	release := func() { once.Do(func() { close(next) }) }
+	// Let the stream end even if the test fails before reaching the update
+	defer release()
+
+	broadcast := NewLichessBroadcast("abc", WithDepth(1), WithEngineFactory((&FakeEngine{}).NewEngine))
+	broadcast.URL = server.URL
+	broadcast.Relay.Interval = time.Hour
+	updates := make(chan RelayUpdate)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		done <- broadcast.Follow(ctx, func(update RelayUpdate) { updates <- update })
+	}()
+
+	expect := func(board int, move string) {
+		t.Helper()
+		select {
+		case update := <-updates:
+			if update.Board != board || update.Move.MoveText != move {
+				t.Errorf("expected %s on board %d, got %s on board %d", move, board, update.Move.MoveText, update.Board)
+			}
+		case <-time.After(10 * time.Second):
+			t.Fatalf("timed out waiting for %s on board %d", move, board)
+		}
+	}
+	expect(1, "e4")
+	expect(2, "d4")
+	release()
+	expect(1, "e5")
+
+	overview := broadcast.Relay.Overview()
+	if len(overview) != 2 || overview[0].White != "A" || overview[0].Plies != 2 || overview[0].LastMove != "1... e5" || overview[1].LastMove != "1. d4" {
+		t.Errorf("unexpected overview %+v", overview)
+	}
+
+	cancel()
+	if err := <-done; !errors.Is(err, ErrAnalysisCancelled) {
+		t.Errorf("expected ErrAnalysisCancelled, got %v", err)
+	}
+}
@@ -0,0 +1,86 @@
+package chessanalysis
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ChessComURL is the base URL of the chess.com published-data API
+const ChessComURL = "https://api.chess.com/pub"
+
+// ChessComArchive fetches games from the monthly game archives of the
+// chess.com published-data API
+type ChessComArchive struct {
+	Client *http.Client
+	URL    string
+}
+
+// NewChessComArchive returns a game archive for chess.com
+func NewChessComArchive() *ChessComArchive {
+	return &ChessComArchive{
+		Client: &http.Client{Timeout: time.Minute},
+		URL:    ChessComURL,
+	}
+}
+
+// chessComMonth is the JSON of a monthly archive, of which only the PGN and
+// the rules of each game are used
+type chessComMonth struct {
+	Games []struct {
+		PGN   string `json:"pgn"`
+		Rules string `json:"rules"` // "chess" for standard chess, or the variant
+	} `json:"games"`
+}
+
+// MonthlyGames returns the player's games of the given month as a PGN
+// database. Variant games, which can't be analyzed, are left out.
+func (a *ChessComArchive) MonthlyGames(ctx context.Context, player string, month time.Time) (string, error) {
+	endpoint := fmt.Sprintf("%s/player/%s/games/%04d/%02d", a.URL, url.PathEscape(strings.ToLower(player)), month.Year(), month.Month())
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return "", err
+	}
+	// chess.com asks API clients to identify themselves
+	request.Header.Set("User-Agent", "chess-analyzer")
+	response, err := a.Client.Do(request)
+	if err != nil {
+		return "", fmt.Errorf("fetching %s games of %s: %w", month.Format("2006-01"), player, err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("fetching %s games of %s: %s", month.Format("2006-01"), player, response.Status)
+	}
+	var archive chessComMonth
+	if err := json.NewDecoder(response.Body).Decode(&archive); err != nil {
+		return "", fmt.Errorf("fetching %s games of %s: %w", month.Format("2006-01"), player, err)
+	}
+	var games []string
+	for _, game := range archive.Games {
+		if game.Rules != "chess" || strings.TrimSpace(game.PGN) == "" {
+			continue
+		}
+		games = append(games, strings.TrimSpace(game.PGN))
+	}
+	return strings.Join(games, "\n\n"), nil
+}
+
+// Games returns the player's games of each of the given months, in order, as
+// a single PGN database for AnalyzeChessGames
+func (a *ChessComArchive) Games(ctx context.Context, player string, months []time.Time) (string, error) {
+	var games []string
+	for _, month := range months {
+		pgn, err := a.MonthlyGames(ctx, player, month)
+		if err != nil {
+			return "", err
+		}
+		if pgn != "" {
+			games = append(games, pgn)
+		}
+	}
+	return strings.Join(games, "\n\n"), nil
+}
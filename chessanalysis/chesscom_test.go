@@ -0,0 +1,44 @@
+package chessanalysis
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestChessComArchive(t *testing.T) {
+	months := map[string][]map[string]string{
+		"/player/someone/games/2024/01": {
+			{"pgn": scholarsMatePgn, "rules": "chess"},
+			{"pgn": "[Event \"Live Chess - Chess960\"]\n\n1. e4 *", "rules": "chess960"},
+		},
+		"/player/someone/games/2024/02": {},
+		"/player/someone/games/2024/03": {{"pgn": scholarsMatePgn, "rules": "chess"}},
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		games, ok := months[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{"games": games})
+	}))
+	defer server.Close()
+
+	archive := &ChessComArchive{Client: server.Client(), URL: server.URL}
+	month := func(m time.Month) time.Time { return time.Date(2024, m, 1, 0, 0, 0, 0, time.UTC) }
+	pgn, err := archive.Games(context.Background(), "Someone", []time.Time{month(time.January), month(time.February), month(time.March)})
+	if err != nil {
+		t.Fatalf("failed to fetch games: %v", err)
+	}
+	games, err := SplitPGN(pgn)
+	if err != nil || len(games) != 2 {
+		t.Fatalf("expected the two standard games, got %d (%v):\n%s", len(games), err, pgn)
+	}
+	if _, err := archive.MonthlyGames(context.Background(), "nobody", month(time.January)); err == nil {
+		t.Error("expected an error for a missing player")
+	}
+}
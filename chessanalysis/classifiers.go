@@ -0,0 +1,70 @@
+package chessanalysis
+
+// DefaultWinningThreshold is the win probability from which WinningStage
+// considers a position won
+const DefaultWinningThreshold = 0.95
+
+// PartialMoveClassifier classifies only the moves it has an opinion on, such
+// as book moves, leaving the others to the next classifier of a chain; see
+// ChainClassifiers
+type PartialMoveClassifier interface {
+	// TryClassifyMove reports false for moves it has no opinion on
+	TryClassifyMove(move *MoveAnalysis) (MoveClassification, bool)
+}
+
+type PartialMoveClassifierFunc func(move *MoveAnalysis) (MoveClassification, bool)
+
+func (c PartialMoveClassifierFunc) TryClassifyMove(move *MoveAnalysis) (MoveClassification, bool) {
+	return c(move)
+}
+
+// ChainClassifiers layers specialized classifiers over a general one. Each
+// move is offered to the stages in order, and the first to classify it wins;
+// moves none of them classifies are classified by fallback. For instance
+//
+//	ChainClassifiers(DefaultMoveClassifier(), BookStage(theory), WinningStage(DefaultWinningThreshold))
+//
+// classifies book moves as Book, then moves keeping a won game as Winning,
+// then every other move by its thresholds.
+func ChainClassifiers(fallback MoveClassifier, stages ...PartialMoveClassifier) MoveClassifier {
+	return MoveClassifierFunc(func(move *MoveAnalysis) MoveClassification {
+		for _, stage := range stages {
+			if classification, ok := stage.TryClassifyMove(move); ok {
+				return classification
+			}
+		}
+		return fallback.ClassifyMove(move)
+	})
+}
+
+// BookStage classifies the moves theory knows in the position before them as
+// Book, like WithSkipBook does for moves it skips
+func BookStage(theory Theory) PartialMoveClassifier {
+	return PartialMoveClassifierFunc(func(move *MoveAnalysis) (MoveClassification, bool) {
+		if _, followed, ok := checkTheory(move, theory); ok && followed {
+			return Book, true
+		}
+		return Neutral, false
+	})
+}
+
+// WinningStage classifies moves played in a won position that keep it won,
+// with the mover's win probability at least threshold before and after, as
+// Winning. Converting a won game, as when a quicker mate is missed for a
+// slower one, is then not judged by the chances given back. The best move and
+// sacrifices are left to the next classifier.
+func WinningStage(threshold float64) PartialMoveClassifier {
+	return PartialMoveClassifierFunc(func(move *MoveAnalysis) (MoveClassification, bool) {
+		if move.IsBestMove || move.Sacrifice {
+			return Neutral, false
+		}
+		before, after := move.PreviousWhiteWinProb, move.WhiteWinProb
+		if move.Color == "Black" {
+			before, after = move.PreviousWhiteLossProb, move.WhiteLossProb
+		}
+		if before >= threshold && after >= threshold {
+			return Winning, true
+		}
+		return Neutral, false
+	})
+}
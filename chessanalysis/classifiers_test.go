@@ -0,0 +1,44 @@
+package chessanalysis
+
+import "testing"
+
+// fixedTheory knows the moves listed for each FEN
+type fixedTheory map[string][]string
+
+func (t fixedTheory) Moves(fen string) []string {
+	return t[fen]
+}
+
+func TestChainClassifiers(t *testing.T) {
+	const start = "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1"
+	theory := fixedTheory{start: {"e2e4"}}
+	classifier := ChainClassifiers(DefaultMoveClassifier(), BookStage(theory), WinningStage(DefaultWinningThreshold))
+
+	tests := []struct {
+		name string
+		move MoveAnalysis
+		want MoveClassification
+	}{
+		{"book move", MoveAnalysis{Color: "White", FENBefore: start, MoveText: "e4", PreviousWhiteWinProb: 0.5, WhiteWinProb: 0.2}, Book},
+		{"out of book", MoveAnalysis{Color: "White", FENBefore: start, MoveText: "a4", PreviousWhiteWinProb: 0.5, WhiteWinProb: 0.2}, Blunder},
+		{"keeping a won game", MoveAnalysis{Color: "Black", PreviousWhiteLossProb: 1, WhiteLossProb: 0.96}, Winning},
+		{"best move in a won game", MoveAnalysis{Color: "Black", PreviousWhiteLossProb: 1, WhiteLossProb: 1, IsBestMove: true}, Best},
+		{"throwing away a won game", MoveAnalysis{Color: "Black", PreviousWhiteLossProb: 1, WhiteLossProb: 0.6}, Blunder},
+	}
+	for _, test := range tests {
+		if got := classifier.ClassifyMove(&test.move); got != test.want {
+			t.Errorf("%s: got %s, want %s", test.name, got, test.want)
+		}
+	}
+
+	// The first stage to classify a move wins
+	always := func(classification MoveClassification) PartialMoveClassifier {
+		return PartialMoveClassifierFunc(func(*MoveAnalysis) (MoveClassification, bool) {
+			return classification, true
+		})
+	}
+	move := MoveAnalysis{Color: "White"}
+	if got := ChainClassifiers(DefaultMoveClassifier(), always(Good), always(Excellent)).ClassifyMove(&move); got != Good {
+		t.Errorf("expected the first stage to take precedence, got %s", got)
+	}
+}
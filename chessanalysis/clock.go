@@ -0,0 +1,169 @@
+package chessanalysis
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// parseClock parses a PGN %clk value such as "0:09:57" or "1:02:03.4"
+func parseClock(value string) (time.Duration, error) {
+	parts := strings.Split(strings.TrimSpace(value), ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return 0, fmt.Errorf("invalid clock %q", value)
+	}
+	var clock time.Duration
+	for i, part := range parts {
+		unit := time.Minute
+		if len(parts) == 3 && i == 0 {
+			unit = time.Hour
+		}
+		if i == len(parts)-1 {
+			seconds, err := strconv.ParseFloat(part, 64)
+			if err != nil || seconds < 0 {
+				return 0, fmt.Errorf("invalid clock %q", value)
+			}
+			clock += time.Duration(seconds * float64(time.Second))
+			continue
+		}
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid clock %q", value)
+		}
+		clock += time.Duration(n) * unit
+	}
+	return clock, nil
+}
+
+// DefaultClockThreshold is the remaining time below which moves count as played
+// short of time in clock reports
+const DefaultClockThreshold = 2 * time.Minute
+
+// ClockDataPoint is one move with a known clock, for charting mistakes against time
+type ClockDataPoint struct {
+	Game           int     `json:"game"` // Index of the game in the report input
+	MoveNumber     int     `json:"moveNumber"`
+	Color          string  `json:"color"`
+	ClockMs        int64   `json:"clockMs"`
+	CentipawnLoss  float64 `json:"centipawnLoss"`
+	Classification string  `json:"classification"`
+}
+
+// BlunderClockReport correlates mistakes with the time left on the clock
+type BlunderClockReport struct {
+	Threshold time.Duration // 0 for each game's own, see GameAnalysis.TimeControl
+	Moves     int           // Moves with a known clock
+	Blunders  int
+	Mistakes  int // Blunders and questionable moves
+	// Counts of the above played with less than Threshold on the clock
+	MovesUnderThreshold    int
+	BlundersUnderThreshold int
+	MistakesUnderThreshold int
+	Points                 []ClockDataPoint
+}
+
+// BlunderShareUnderThreshold returns the percentage of blunders played short of time
+func (r *BlunderClockReport) BlunderShareUnderThreshold() float64 {
+	return percentage(r.BlundersUnderThreshold, r.Blunders)
+}
+
+// MistakeShareUnderThreshold returns the percentage of mistakes played short of time
+func (r *BlunderClockReport) MistakeShareUnderThreshold() float64 {
+	return percentage(r.MistakesUnderThreshold, r.Mistakes)
+}
+
+// MoveShareUnderThreshold returns the percentage of all moves played short of time,
+// the baseline the blunder share should be compared against
+func (r *BlunderClockReport) MoveShareUnderThreshold() float64 {
+	return percentage(r.MovesUnderThreshold, r.Moves)
+}
+
+// String summarizes the report in a sentence
+func (r *BlunderClockReport) String() string {
+	if r.Blunders == 0 {
+		return fmt.Sprintf("No blunders in %d timed moves", r.Moves)
+	}
+	if r.Threshold == 0 {
+		return fmt.Sprintf("%.0f%% of blunders occurred in time trouble (%.0f%% of all moves)",
+			r.BlunderShareUnderThreshold(), r.MoveShareUnderThreshold())
+	}
+	return fmt.Sprintf("%.0f%% of blunders occurred with under %s on the clock (%.0f%% of all moves)",
+		r.BlunderShareUnderThreshold(), formatClock(r.Threshold), r.MoveShareUnderThreshold())
+}
+
+// formatClockCommand formats a clock time as the value of a %clk PGN
+// command, the inverse of parseClock, e.g. "0:02:58.5"
+func formatClockCommand(clock time.Duration) string {
+	hours := int(clock / time.Hour)
+	minutes := int(clock % time.Hour / time.Minute)
+	seconds := float64(clock%time.Minute) / float64(time.Second)
+	return fmt.Sprintf("%d:%02d:%04.1f", hours, minutes, seconds)
+}
+
+// formatClock formats a clock time as m:ss
+func formatClock(clock time.Duration) string {
+	seconds := int(clock.Round(time.Second) / time.Second)
+	return fmt.Sprintf("%d:%02d", seconds/60, seconds%60)
+}
+
+func percentage(part, whole int) float64 {
+	if whole == 0 {
+		return 0
+	}
+	return 100 * float64(part) / float64(whole)
+}
+
+// NewBlunderClockReport correlates the named player's mistakes with their
+// remaining clock time. An empty player includes the moves of both sides.
+// Moves without %clk data are ignored. A threshold of 0 counts the moves
+// each game marked as played in time trouble, whose threshold suits its time
+// control, so bullet and classical games can be reported together.
+func NewBlunderClockReport(games []*GameAnalysis, player string, threshold time.Duration) *BlunderClockReport {
+	report := &BlunderClockReport{Threshold: threshold}
+	for i, game := range games {
+		color := ""
+		if player != "" {
+			if color = game.PlayerColor(player); color == "" {
+				continue
+			}
+		}
+		for _, move := range game.Moves {
+			if !move.HasClock || (color != "" && move.Color != color) {
+				continue
+			}
+			under := move.Clock < threshold
+			if threshold == 0 {
+				under = move.TimeTrouble
+			}
+			blunder := move.Classification == Blunder
+			mistake := blunder || move.Classification == Questionable
+
+			report.Moves++
+			if under {
+				report.MovesUnderThreshold++
+			}
+			if blunder {
+				report.Blunders++
+				if under {
+					report.BlundersUnderThreshold++
+				}
+			}
+			if mistake {
+				report.Mistakes++
+				if under {
+					report.MistakesUnderThreshold++
+				}
+			}
+			report.Points = append(report.Points, ClockDataPoint{
+				Game:           i,
+				MoveNumber:     move.MoveNumber,
+				Color:          move.Color,
+				ClockMs:        move.Clock.Milliseconds(),
+				CentipawnLoss:  move.CentipawnLoss,
+				Classification: move.Classification.String(),
+			})
+		}
+	}
+	return report
+}
@@ -0,0 +1,110 @@
+package chessanalysis
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseClock(t *testing.T) {
+	tests := []struct {
+		value string
+		want  time.Duration
+	}{
+		{"0:09:57", 9*time.Minute + 57*time.Second},
+		{"1:02:03.5", time.Hour + 2*time.Minute + 3500*time.Millisecond},
+		{"4:05", 4*time.Minute + 5*time.Second},
+	}
+	for _, test := range tests {
+		got, err := parseClock(test.value)
+		if err != nil || got != test.want {
+			t.Errorf("parseClock(%q) = %v, %v; want %v", test.value, got, err, test.want)
+		}
+	}
+	for _, value := range []string{"", "12", "a:00:00", "0:-1:00"} {
+		if _, err := parseClock(value); err == nil {
+			t.Errorf("parseClock(%q) should fail", value)
+		}
+	}
+}
+
+func TestAnalyzeChessGameParsesClock(t *testing.T) {
+	pgn := `[White "Player 1"]
+[Black "Player 2"]
+
+1. e4 {[%clk 0:03:00]} e5 {[%clk 0:02:58.5]} 2. Qh5 Nc6 3. Bc4 Nf6 4. Qxf7# 1-0`
+	moves, err := AnalyzeChessGame(pgn, WithEngineFactory(scholarsMateEngine().NewEngine), WithTimeTroubleThreshold(2*time.Minute+59*time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !moves[0].HasClock || moves[0].Clock != 3*time.Minute {
+		t.Errorf("unexpected clock for 1. e4: %v (%v)", moves[0].Clock, moves[0].HasClock)
+	}
+	if !moves[1].HasClock || moves[1].Clock != 2*time.Minute+58500*time.Millisecond {
+		t.Errorf("unexpected clock for 1... e5: %v (%v)", moves[1].Clock, moves[1].HasClock)
+	}
+	if moves[0].TimeTrouble || !moves[1].TimeTrouble {
+		t.Errorf("expected only 1... e5 in time trouble, got %v and %v", moves[0].TimeTrouble, moves[1].TimeTrouble)
+	}
+	if moves[2].HasClock || moves[2].TimeTrouble {
+		t.Errorf("2. Qh5 has no clock but got %v", moves[2].Clock)
+	}
+}
+
+func TestTimeTroubleSegments(t *testing.T) {
+	moves := []MoveAnalysis{
+		{Color: "White", HasClock: true, Accuracy: 90},
+		{Color: "White", HasClock: true, Accuracy: 70},
+		{Color: "White", HasClock: true, TimeTrouble: true, Accuracy: 40, Classification: Blunder},
+		{Color: "White", HasClock: true, TimeTrouble: true, Accuracy: 80},
+		{Color: "White", Accuracy: 10},
+	}
+	white := Summarize(moves).White
+	if white.NormalTime.Moves != 2 || white.NormalTime.Accuracy != 80 || white.NormalTime.BlunderRate != 0 {
+		t.Errorf("unexpected normal time segment %+v", white.NormalTime)
+	}
+	if white.TimeTrouble.Moves != 2 || white.TimeTrouble.Accuracy != 60 || white.TimeTrouble.BlunderRate != 50 {
+		t.Errorf("unexpected time trouble segment %+v", white.TimeTrouble)
+	}
+}
+
+func TestBlunderClockReport(t *testing.T) {
+	game := testGame("me", "them", "0-1", "C50", []string{"e4", "e5", "Nf3", "Nc6", "Bc4", "Nf6", "Ng5"},
+		map[int]MoveClassification{2: Blunder, 4: Questionable, 6: Blunder, 5: Blunder})
+	clocks := []time.Duration{5 * time.Minute, 5 * time.Minute, 3 * time.Minute, time.Minute, 90 * time.Second, 50 * time.Second, 30 * time.Second}
+	for i := range game.Moves {
+		game.Moves[i].Clock = clocks[i]
+		game.Moves[i].HasClock = true
+	}
+	untimed := testGame("me", "them", "1-0", "C50", []string{"e4"}, map[int]MoveClassification{0: Blunder})
+
+	report := NewBlunderClockReport([]*GameAnalysis{game, untimed}, "me", DefaultClockThreshold)
+	if report.Moves != 4 || report.Blunders != 2 || report.Mistakes != 3 {
+		t.Fatalf("unexpected totals: %+v", report)
+	}
+	if report.BlundersUnderThreshold != 1 || report.MistakesUnderThreshold != 2 || report.MovesUnderThreshold != 2 {
+		t.Errorf("unexpected under-threshold counts: %+v", report)
+	}
+	if report.BlunderShareUnderThreshold() != 50 || report.MoveShareUnderThreshold() != 50 {
+		t.Errorf("unexpected shares %.1f%% and %.1f%%", report.BlunderShareUnderThreshold(), report.MoveShareUnderThreshold())
+	}
+	if len(report.Points) != 4 || report.Points[3].ClockMs != 30000 || report.Points[3].Classification != "Blunder" {
+		t.Errorf("unexpected data points: %+v", report.Points)
+	}
+	if got, want := report.String(), "50% of blunders occurred with under 2:00 on the clock (50% of all moves)"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+
+	if all := NewBlunderClockReport([]*GameAnalysis{game}, "", DefaultClockThreshold); all.Blunders != 3 {
+		t.Errorf("expected 3 blunders across both players, got %d", all.Blunders)
+	}
+
+	// Without a threshold, the moves each game marked as in time trouble count
+	game.Moves[2].TimeTrouble = true
+	own := NewBlunderClockReport([]*GameAnalysis{game}, "me", 0)
+	if own.BlundersUnderThreshold != 1 || own.MovesUnderThreshold != 1 {
+		t.Errorf("unexpected counts with each game's threshold: %+v", own)
+	}
+	if got, want := own.String(), "50% of blunders occurred in time trouble (25% of all moves)"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,134 @@
+package chessanalysis
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// maxCriticalMoments is how many critical moments a comparison lists per side
+const maxCriticalMoments = 5
+
+// CriticalMoment is a costly move listed in a comparison
+type CriticalMoment struct {
+	Game           int     `json:"game"` // Index of the game within the side's games
+	Move           string  `json:"move"` // e.g. "12... Nxe4"
+	Classification string  `json:"classification"`
+	CentipawnLoss  float64 `json:"centipawnLoss"`
+}
+
+// ComparisonSide is the move quality of one side of a comparison
+type ComparisonSide struct {
+	Label string `json:"label"`
+	Games int    `json:"games"`
+	PlayerSummary
+	Classifications map[string]int   `json:"classifications"`
+	CriticalMoments []CriticalMoment `json:"criticalMoments"`
+}
+
+// Comparison is a side-by-side comparison of two games or two players
+type Comparison struct {
+	Left  ComparisonSide `json:"left"`
+	Right ComparisonSide `json:"right"`
+}
+
+// newComparisonSide aggregates the moves of the given color in each game.
+// colorOf returns the color to include for a game, "" to skip the game or
+// "*" to include both colors.
+func newComparisonSide(label string, games []*GameAnalysis, colorOf func(*GameAnalysis) string) ComparisonSide {
+	side := ComparisonSide{Label: label, Classifications: make(map[string]int)}
+	for i, game := range games {
+		color := colorOf(game)
+		if color == "" {
+			continue
+		}
+		side.Games++
+		for _, move := range game.Moves {
+			if color != "*" && move.Color != color {
+				continue
+			}
+			side.Classifications[move.Classification.String()]++
+			if move.Classification == Blunder || move.Classification == Questionable {
+				side.CriticalMoments = append(side.CriticalMoments, CriticalMoment{
+					Game:           i,
+					Move:           MoveLabel(&move),
+					Classification: move.Classification.String(),
+					CentipawnLoss:  move.CentipawnLoss,
+				})
+			}
+			side.record(&move)
+		}
+	}
+	side.complete()
+	side.EstimatedRating = EstimateRating(&side.PlayerSummary, UnknownTimeControl)
+
+	sort.SliceStable(side.CriticalMoments, func(i, j int) bool {
+		return side.CriticalMoments[i].CentipawnLoss > side.CriticalMoments[j].CentipawnLoss
+	})
+	if len(side.CriticalMoments) > maxCriticalMoments {
+		side.CriticalMoments = side.CriticalMoments[:maxCriticalMoments]
+	}
+	return side
+}
+
+// CompareGames compares the moves of the given color in two games, or all
+// moves of each game if color is empty
+func CompareGames(left, right *GameAnalysis, color string) *Comparison {
+	if color == "" {
+		color = "*"
+	}
+	label := func(game *GameAnalysis) string {
+		return fmt.Sprintf("%s vs %s", game.Headers["White"], game.Headers["Black"])
+	}
+	colorOf := func(*GameAnalysis) string { return color }
+	return &Comparison{
+		Left:  newComparisonSide(label(left), []*GameAnalysis{left}, colorOf),
+		Right: newComparisonSide(label(right), []*GameAnalysis{right}, colorOf),
+	}
+}
+
+// ComparePlayers compares two players' aggregate move quality, each over
+// their own games
+func ComparePlayers(leftGames []*GameAnalysis, leftPlayer string, rightGames []*GameAnalysis, rightPlayer string) *Comparison {
+	playing := func(player string) func(*GameAnalysis) string {
+		return func(game *GameAnalysis) string { return game.PlayerColor(player) }
+	}
+	return &Comparison{
+		Left:  newComparisonSide(leftPlayer, leftGames, playing(leftPlayer)),
+		Right: newComparisonSide(rightPlayer, rightGames, playing(rightPlayer)),
+	}
+}
+
+// Markdown renders the comparison as a markdown table followed by each side's
+// critical moments
+func (c *Comparison) Markdown() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "| | %s | %s | Difference |\n|---|---:|---:|---:|\n", c.Left.Label, c.Right.Label)
+	row := func(name string, left, right float64, format string) {
+		fmt.Fprintf(&b, "| %s | "+format+" | "+format+" | %+"+format[1:]+" |\n", name, left, right, right-left)
+	}
+	row("Games", float64(c.Left.Games), float64(c.Right.Games), "%.0f")
+	row("Moves", float64(c.Left.Moves), float64(c.Right.Moves), "%.0f")
+	row("Accuracy", c.Left.Accuracy, c.Right.Accuracy, "%.1f")
+	row("ACPL", c.Left.ACPL, c.Right.ACPL, "%.1f")
+	row("Estimated rating", float64(c.Left.EstimatedRating), float64(c.Right.EstimatedRating), "%.0f")
+	row("Opening accuracy", c.Left.Opening.Accuracy, c.Right.Opening.Accuracy, "%.1f")
+	row("Middlegame accuracy", c.Left.Middlegame.Accuracy, c.Right.Middlegame.Accuracy, "%.1f")
+	row("Endgame accuracy", c.Left.Endgame.Accuracy, c.Right.Endgame.Accuracy, "%.1f")
+	for i := len(moveClassificationNames) - 1; i >= 0; i-- {
+		name := moveClassificationNames[i]
+		row(name, float64(c.Left.Classifications[name]), float64(c.Right.Classifications[name]), "%.0f")
+	}
+
+	for _, side := range []*ComparisonSide{&c.Left, &c.Right} {
+		fmt.Fprintf(&b, "\n**Critical moments: %s**\n\n", side.Label)
+		if len(side.CriticalMoments) == 0 {
+			b.WriteString("None\n")
+			continue
+		}
+		for _, moment := range side.CriticalMoments {
+			fmt.Fprintf(&b, "- %s (%s, -%.0f cp)\n", moment.Move, moment.Classification, moment.CentipawnLoss)
+		}
+	}
+	return b.String()
+}
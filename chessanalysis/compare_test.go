@@ -0,0 +1,57 @@
+package chessanalysis
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestCompareGames(t *testing.T) {
+	left := testGame("me", "them", "1-0", "C50", []string{"e4", "e5", "Nf3", "Nc6"}, map[int]MoveClassification{0: Best, 2: Blunder})
+	left.Moves[2].CentipawnLoss = 300
+	right := testGame("me", "you", "1-0", "C50", []string{"d4", "d5", "c4", "e6"}, map[int]MoveClassification{0: Best, 2: Best, 3: Blunder})
+
+	comparison := CompareGames(left, right, "White")
+	if comparison.Left.Label != "me vs them" || comparison.Left.Moves != 2 || comparison.Right.Moves != 2 {
+		t.Fatalf("unexpected sides: %+v", comparison)
+	}
+	if comparison.Left.Classifications["Blunder"] != 1 || comparison.Right.Classifications["Best"] != 2 {
+		t.Errorf("unexpected classification counts %v and %v", comparison.Left.Classifications, comparison.Right.Classifications)
+	}
+	if len(comparison.Left.CriticalMoments) != 1 || comparison.Left.CriticalMoments[0].Move != "2. Nf3" {
+		t.Errorf("unexpected critical moments %+v", comparison.Left.CriticalMoments)
+	}
+	if len(comparison.Right.CriticalMoments) != 0 {
+		t.Errorf("Black's blunder shouldn't be compared, got %+v", comparison.Right.CriticalMoments)
+	}
+
+	markdown := comparison.Markdown()
+	for _, want := range []string{"| | me vs them | me vs you | Difference |", "| Blunder | 1 | 0 | -1 |", "- 2. Nf3 (Blunder, -300 cp)"} {
+		if !strings.Contains(markdown, want) {
+			t.Errorf("markdown missing %q:\n%s", want, markdown)
+		}
+	}
+
+	data, err := json.Marshal(comparison)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded Comparison
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Left.Moves != 2 || decoded.Right.Classifications["Best"] != 2 {
+		t.Errorf("unexpected comparison after round trip: %s", data)
+	}
+}
+
+func TestComparePlayers(t *testing.T) {
+	games := []*GameAnalysis{
+		testGame("alice", "bob", "1-0", "C50", []string{"e4", "e5"}, map[int]MoveClassification{1: Blunder}),
+		testGame("bob", "alice", "1-0", "C50", []string{"e4", "e5"}, nil),
+	}
+	comparison := ComparePlayers(games, "alice", games, "bob")
+	if comparison.Left.Games != 2 || comparison.Left.Moves != 2 || comparison.Right.Blunders != 1 {
+		t.Errorf("unexpected comparison %+v", comparison)
+	}
+}
@@ -0,0 +1,111 @@
+package chessanalysis
+
+import (
+	"context"
+	"errors"
+	"math"
+)
+
+// Sources of a dead draw
+const (
+	DeadDrawByEngine    = "engine"    // The evaluation stayed flat in a simplified position
+	DeadDrawByTablebase = "tablebase" // The tablebase called every position from then on a draw
+)
+
+// DeadDraw is the move after which the game was a trivial draw, leaving the
+// rest of it a formality
+type DeadDraw struct {
+	Ply    int    `json:"ply"`  // Index of the move within the game
+	Move   string `json:"move"` // e.g. "41. Kf2"
+	Plies  int    `json:"plies"`
+	Source string `json:"source"`
+}
+
+// Moves returns how many moves of the game followed the dead draw, counting
+// both sides' moves as one
+func (d *DeadDraw) Moves() int {
+	return (d.Plies + 1) / 2
+}
+
+// DeadDrawCriteria are when the engine's evaluations make a position a dead draw
+type DeadDrawCriteria struct {
+	MaxScore    float64 // Largest score either way, in pawns, from the move on
+	MaxSwing    float64 // Largest difference between the scores from the move on, in pawns
+	MaxMaterial int     // Most material either side may have after the move, in pawns
+	MinPlies    int     // Fewest moves that must follow, so short endings aren't flagged
+}
+
+// DefaultDeadDrawCriteria are the criteria used for game summaries
+var DefaultDeadDrawCriteria = DeadDrawCriteria{MaxScore: 0.3, MaxSwing: 0.3, MaxMaterial: 13, MinPlies: 10}
+
+// DetectDeadDraw returns the earliest move from which the engine's score
+// stayed within the criteria until the end of the game in a simplified
+// position, or nil if the game never became a dead draw
+func DetectDeadDraw(moves []MoveAnalysis, criteria DeadDrawCriteria) *DeadDraw {
+	var draw *DeadDraw
+	low, high := math.Inf(1), math.Inf(-1)
+	for i := len(moves) - 1; i >= 0; i-- {
+		move := &moves[i]
+		score := move.WhiteScore.Pawns()
+		low, high = math.Min(low, score), math.Max(high, score)
+		if move.WhiteScore.IsMate() || math.Abs(score) > criteria.MaxScore || high-low > criteria.MaxSwing || move.TerminalStatus == TerminalCheckmate {
+			break
+		}
+		if plies := len(moves) - 1 - i; plies >= criteria.MinPlies {
+			b := parseBoard(move.FENAfter)
+			if white, black := b.material(); max(white, black) <= criteria.MaxMaterial {
+				draw = &DeadDraw{Ply: i, Move: MoveLabel(move), Plies: plies, Source: DeadDrawByEngine}
+			}
+		}
+	}
+	return draw
+}
+
+// probeDeadDraw walks back from the end of the game for as long as the
+// tablebase calls the positions drawn, returning the earliest of them, or nil
+// if the final position isn't a tablebase draw
+func probeDeadDraw(ctx context.Context, tablebase Tablebase, moves []MoveAnalysis) (*DeadDraw, error) {
+	var draw *DeadDraw
+	for i := len(moves) - 1; i >= 0; i-- {
+		result, err := tablebase.Probe(ctx, moves[i].FENAfter)
+		if errors.Is(err, ErrTablebaseMiss) {
+			break
+		}
+		if err != nil {
+			return draw, err
+		}
+		if result != "1/2-1/2" {
+			break
+		}
+		if i == len(moves)-1 {
+			// A draw in the final position leaves nothing to call a formality
+			continue
+		}
+		draw = &DeadDraw{Ply: i, Move: MoveLabel(&moves[i]), Plies: len(moves) - 1 - i, Source: DeadDrawByTablebase}
+	}
+	return draw, nil
+}
+
+// setDeadDraw records the dead draw in the summary, leaving its moves out of
+// the players' statistics when analyzed with WithoutDeadDrawMoves
+func (g *GameAnalysis) setDeadDraw(draw *DeadDraw) {
+	g.Summary.DeadDraw = draw
+	if draw == nil || !g.Options.ExcludeDeadDraw {
+		return
+	}
+	g.Summary.summarizePlayers(g.Moves[:draw.Ply+1])
+	g.Summary.estimateRatings(g.Headers)
+	g.assessOpenings()
+}
+
+// refineDeadDraw probes the tablebase for a dead draw earlier than the
+// engine's evaluations showed
+func (g *GameAnalysis) refineDeadDraw(ctx context.Context, tablebase Tablebase) {
+	draw, err := probeDeadDraw(ctx, tablebase, g.Moves)
+	if err != nil {
+		log.Warn("Tablebase probe failed while looking for a dead draw", "error", err)
+	}
+	if draw != nil && (g.Summary.DeadDraw == nil || draw.Ply < g.Summary.DeadDraw.Ply) {
+		g.setDeadDraw(draw)
+	}
+}
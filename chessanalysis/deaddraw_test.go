@@ -0,0 +1,77 @@
+package chessanalysis
+
+import (
+	"context"
+	"testing"
+
+	"github.com/walterschell/chess-analyzer/chessanalysis/uciengine"
+)
+
+// deadDrawMoves is a game of 16 plies reaching a king and pawn ending after
+// the fifth, in which the scores are given by score
+func deadDrawMoves(score func(ply int) float64) []MoveAnalysis {
+	const start = "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1"
+	const ending = "8/8/4k3/8/8/4K3/4P3/8 w - - 0 40"
+	var moves []MoveAnalysis
+	for i := 0; i < 16; i++ {
+		move := MoveAnalysis{MoveNumber: i/2 + 1, Color: "White", MoveText: "Ke3", FENAfter: ending, WhiteScore: uciengine.Pawns(score(i)), Accuracy: 100}
+		if i%2 == 1 {
+			move.Color, move.MoveText = "Black", "Ke6"
+		}
+		if i < 4 {
+			move.FENAfter, move.Accuracy = start, 50
+		}
+		moves = append(moves, move)
+	}
+	return moves
+}
+
+func TestDetectDeadDraw(t *testing.T) {
+	draw := DetectDeadDraw(deadDrawMoves(func(int) float64 { return 0.1 }), DefaultDeadDrawCriteria)
+	if draw == nil || draw.Ply != 4 || draw.Move != "3. Ke3" || draw.Plies != 11 || draw.Moves() != 6 || draw.Source != DeadDrawByEngine {
+		t.Fatalf("expected a dead draw after 3. Ke3, got %+v", draw)
+	}
+
+	// A swing late in the game leaves too few moves after it
+	swing := func(ply int) float64 {
+		if ply == 8 {
+			return 0.5
+		}
+		return 0.1
+	}
+	if draw := DetectDeadDraw(deadDrawMoves(swing), DefaultDeadDrawCriteria); draw != nil {
+		t.Errorf("expected no dead draw after a swing, got %+v", draw)
+	}
+	if draw := DetectDeadDraw(deadDrawMoves(func(int) float64 { return 1 }), DefaultDeadDrawCriteria); draw != nil {
+		t.Errorf("expected no dead draw in a better ending, got %+v", draw)
+	}
+}
+
+func TestDeadDrawExcludedFromStats(t *testing.T) {
+	moves := deadDrawMoves(func(int) float64 { return 0.1 })
+	game := NewGameAnalysis("", moves, EffectiveOptions{})
+	if game.Summary.DeadDraw == nil || game.Summary.White.Moves != 8 {
+		t.Fatalf("expected a dead draw with every move counted, got %+v", game.Summary)
+	}
+
+	game = NewGameAnalysis("", moves, EffectiveOptions{ExcludeDeadDraw: true})
+	if game.Summary.White.Moves != 3 || game.Summary.Black.Moves != 2 || game.Summary.White.Accuracy != 200.0/3 {
+		t.Errorf("expected only the moves up to the dead draw counted, got %+v", game.Summary.White.AccuracyStats)
+	}
+}
+
+func TestTablebaseDeadDraw(t *testing.T) {
+	moves := deadDrawMoves(func(int) float64 { return 1 })
+	game := NewGameAnalysis("", moves, EffectiveOptions{})
+	game.refineDeadDraw(context.Background(), stubTablebase{moves[4].FENAfter: "1/2-1/2"})
+	draw := game.Summary.DeadDraw
+	if draw == nil || draw.Ply != 4 || draw.Source != DeadDrawByTablebase {
+		t.Errorf("expected the tablebase to find the dead draw after 3. Ke3, got %+v", draw)
+	}
+
+	game = NewGameAnalysis("", moves, EffectiveOptions{})
+	game.refineDeadDraw(context.Background(), stubTablebase{moves[4].FENAfter: "1-0"})
+	if game.Summary.DeadDraw != nil {
+		t.Errorf("expected no dead draw in a won ending, got %+v", game.Summary.DeadDraw)
+	}
+}
@@ -0,0 +1,44 @@
+package chessanalysis
+
+import chess "github.com/corentings/chess/v2"
+
+// MaxDepthRetries is the most times WithDepthRetries repeats a search
+const MaxDepthRetries = 5
+
+// stoppedShort reports whether a search limited by depth ended before
+// reaching it for no good reason. Engines rightly stop early with a single
+// legal move or once they have found a forced mate, and those searches are
+// as good as they get; anything else, such as a search stopped for overrunning
+// its timeout, isn't comparable to the moves searched to full depth.
+func stoppedShort(result *AnalysisResult, limits SearchLimits, before *chess.Position) bool {
+	if limits.Depth <= 0 || result.Depth >= limits.Depth {
+		return false
+	}
+	if result.WhiteScore.IsMate() || result.BestMoveWhiteScore.IsMate() {
+		return false
+	}
+	return len(before.ValidMoves()) > 1
+}
+
+// searchToDepth runs search, repeating it up to retries times while it stops
+// short of the depth of the limits. Each retry doubles the time the engine
+// may take. It returns the deepest result and how many retries it took.
+func searchToDepth(search func(SearchLimits) (*AnalysisResult, error), limits SearchLimits, retries int, before *chess.Position) (*AnalysisResult, int, error) {
+	result, err := search(limits)
+	if err != nil {
+		return nil, 0, err
+	}
+	retried := 0
+	for ; retried < retries && stoppedShort(result, limits, before); retried++ {
+		log.Info("Search stopped short of its depth, retrying", "depth", result.Depth, "requested", limits.Depth)
+		limits.Timeout *= 2
+		retry, err := search(limits)
+		if err != nil {
+			return nil, retried, err
+		}
+		if retry.Depth >= result.Depth {
+			result = retry
+		}
+	}
+	return result, retried, nil
+}
@@ -0,0 +1,91 @@
+package chessanalysis
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	chess "github.com/corentings/chess/v2"
+	"github.com/walterschell/chess-analyzer/chessanalysis/uciengine"
+)
+
+// impatientEngine stops its searches a ply short of their depth unless they
+// are given at least patience to run, like an engine stopped for overrunning
+// its timeout
+type impatientEngine struct {
+	Engine
+	patience time.Duration
+}
+
+func (e impatientEngine) AnalyzeLastMove(moves []string, limits SearchLimits) (*AnalysisResult, error) {
+	result, err := e.Engine.AnalyzeLastMove(moves, limits)
+	if err == nil && limits.Timeout < e.patience {
+		result.Depth = limits.Depth - 1
+	}
+	return result, err
+}
+
+func TestDepthRetries(t *testing.T) {
+	const game = "[Result \"*\"]\n\n1. e4 e5 2. Nf3 *"
+	factory := func() (Engine, error) {
+		engine, err := (&FakeEngine{}).NewEngine()
+		return impatientEngine{Engine: engine, patience: 4 * time.Second}, err
+	}
+	tests := []struct {
+		retries     int
+		wantDepth   int
+		wantRetries int
+	}{
+		{0, 4, 0},
+		{1, 4, 1},
+		{2, 5, 2},
+		{3, 5, 2},
+	}
+	for _, test := range tests {
+		moves, err := AnalyzeChessGame(game, WithDepth(5), WithEngineTimeout(time.Second), WithDepthRetries(test.retries), WithEngineFactory(factory))
+		if err != nil {
+			t.Fatalf("failed to analyze game: %v", err)
+		}
+		for _, move := range moves {
+			if move.Depth != test.wantDepth || move.RequestedDepth != 5 || move.DepthRetries != test.wantRetries {
+				t.Errorf("with %d retries, expected %s to reach depth %d of 5 after %d retries, got %d of %d after %d",
+					test.retries, move.MoveText, test.wantDepth, test.wantRetries, move.Depth, move.RequestedDepth, move.DepthRetries)
+			}
+			if move.ShortOfDepth() != (test.wantDepth < 5) {
+				t.Errorf("with %d retries, expected %s short of depth to be %t", test.retries, move.MoveText, test.wantDepth < 5)
+			}
+		}
+	}
+
+	if _, err := ResolveOptions(WithDepthRetries(MaxDepthRetries + 1)); !errors.Is(err, ErrInvalidOptions) {
+		t.Errorf("expected %d retries to be rejected, got %v", MaxDepthRetries+1, err)
+	}
+}
+
+func TestStoppedShort(t *testing.T) {
+	start := chess.StartingPosition()
+	// Black's king on h8 has only Kg8 against the rook on the seventh rank
+	single, err := positionFromFEN("7k/R7/6K1/8/8/8/8/8 b - - 0 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	limits := SearchLimits{Depth: 10}
+	tests := []struct {
+		name     string
+		result   AnalysisResult
+		limits   SearchLimits
+		position *chess.Position
+		want     bool
+	}{
+		{"full depth", AnalysisResult{Depth: 10}, limits, start, false},
+		{"short", AnalysisResult{Depth: 6}, limits, start, true},
+		{"forced mate", AnalysisResult{Depth: 6, BestMoveWhiteScore: uciengine.MateIn(3)}, limits, start, false},
+		{"single legal move", AnalysisResult{Depth: 1}, limits, single, false},
+		{"move time", AnalysisResult{Depth: 6}, SearchLimits{MoveTime: time.Second}, start, false},
+	}
+	for _, test := range tests {
+		if got := stoppedShort(&test.result, test.limits, test.position); got != test.want {
+			t.Errorf("%s: expected %t, got %t", test.name, test.want, got)
+		}
+	}
+}
@@ -0,0 +1,26 @@
+package chessanalysis
+
+// Diagnostics are details of a move's search that help explain why its
+// evaluation differs between runs, such as a search cut short by a full hash
+// table or steered by tablebases, beyond the depths every move carries. See
+// WithDiagnostics.
+type Diagnostics struct {
+	HashFull int   `json:"hashFull"` // Permille of the engine's hash table in use after the search
+	TBHits   int64 `json:"tbHits"`   // Positions the search found in the engine's endgame tablebases
+}
+
+// WithDiagnostics keeps the engine's diagnostics of every searched move as
+// its Diagnostics
+func WithDiagnostics() AnalyzeChessGameOption {
+	return func(opts *AnalyzeChessGameOptions) {
+		opts.Diagnostics = true
+	}
+}
+
+// newDiagnostics returns the diagnostics of the search of a move
+func newDiagnostics(result *AnalysisResult) *Diagnostics {
+	return &Diagnostics{
+		HashFull: result.HashFull,
+		TBHits:   result.TBHits,
+	}
+}
@@ -0,0 +1,40 @@
+package chessanalysis
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestDiagnostics(t *testing.T) {
+	moves, err := AnalyzeChessGame(scholarsMatePgn, WithDepth(3), WithEngineFactory(scholarsMateEngine().NewEngine))
+	if err != nil {
+		t.Fatalf("failed to analyze game: %v", err)
+	}
+	if moves[0].Diagnostics != nil {
+		t.Errorf("expected no diagnostics without WithDiagnostics, got %+v", moves[0].Diagnostics)
+	}
+
+	moves, err = AnalyzeChessGame(scholarsMatePgn, WithDepth(3), WithDiagnostics(), WithEngineFactory(scholarsMateEngine().NewEngine))
+	if err != nil {
+		t.Fatalf("failed to analyze game: %v", err)
+	}
+	// The fake engine reports as many permille of its hash in use as its depth
+	if diagnostics := moves[0].Diagnostics; diagnostics == nil || *diagnostics != (Diagnostics{HashFull: 3}) || moves[0].SelDepth != 3 {
+		t.Errorf("expected the diagnostics of a depth 3 search, got %+v at selective depth %d", diagnostics, moves[0].SelDepth)
+	}
+	data, err := json.Marshal(&moves[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"diagnostics":{"hashFull":3,"tbHits":0}`) {
+		t.Errorf("expected the diagnostics in the JSON, got %s", data)
+	}
+	var decoded MoveAnalysis
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Diagnostics == nil || *decoded.Diagnostics != *moves[0].Diagnostics {
+		t.Errorf("expected the diagnostics to survive JSON, got %+v", decoded.Diagnostics)
+	}
+}
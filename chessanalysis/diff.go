@@ -0,0 +1,130 @@
+package chessanalysis
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// ErrDifferentGames is returned by DiffAnalyses for analyses of different games
+var ErrDifferentGames = errors.New("the analyses are of different games")
+
+// DiffSide describes one of the two analyses of a diff: the settings it ran
+// with and how it judged each side
+type DiffSide struct {
+	Depth         int     `json:"depth,omitempty"`
+	MoveTimeMs    int64   `json:"moveTimeMs,omitempty"`
+	Nodes         int64   `json:"nodes,omitempty"`
+	Classifier    string  `json:"classifier,omitempty"` // Profile, if not the default
+	WhiteAccuracy float64 `json:"whiteAccuracy"`
+	BlackAccuracy float64 `json:"blackAccuracy"`
+}
+
+// MoveDiff is how two analyses of a game differ on a move
+type MoveDiff struct {
+	Ply        int    `json:"ply"` // Index of the move within the game
+	Move       string `json:"move"`
+	Color      string `json:"color"`
+	LeftScore  Score  `json:"leftScore"` // White's, after the move
+	RightScore Score  `json:"rightScore"`
+	// ScoreDifference is how many percentage points of White's expected
+	// score the right analysis sees after the move above the left one
+	ScoreDifference       float64 `json:"scoreDifference"`
+	LeftClassification    string  `json:"leftClassification"`
+	RightClassification   string  `json:"rightClassification"`
+	ClassificationChanged bool    `json:"classificationChanged"`
+	LeftBestMove          string  `json:"leftBestMove,omitempty"` // SAN
+	RightBestMove         string  `json:"rightBestMove,omitempty"`
+	BestMoveChanged       bool    `json:"bestMoveChanged"`
+	LeftState             string  `json:"leftState"` // Who stands better after the move, see GameState
+	RightState            string  `json:"rightState"`
+	// Flipped is whether the analyses come to different conclusions about who
+	// stands better after the move
+	Flipped bool `json:"flipped"`
+}
+
+// AnalysisDiff compares two analyses of the same game move by move, such as
+// one at a low depth and one at a high depth, or with different engines, to
+// tell whether the deeper or second analysis changed its conclusions
+type AnalysisDiff struct {
+	Left  DiffSide   `json:"left"`
+	Right DiffSide   `json:"right"`
+	Moves []MoveDiff `json:"moves"`
+	// ClassificationChanges, BestMoveChanges and Flips count the moves where
+	// the analyses classified the move differently, preferred a different
+	// move and disagreed on who stands better
+	ClassificationChanges int `json:"classificationChanges"`
+	BestMoveChanges       int `json:"bestMoveChanges"`
+	Flips                 int `json:"flips"`
+	// MeanScoreDifference and MaxScoreDifference are of the absolute
+	// ScoreDifference of the moves
+	MeanScoreDifference float64 `json:"meanScoreDifference"`
+	MaxScoreDifference  float64 `json:"maxScoreDifference"`
+}
+
+// newDiffSide describes an analysis for a diff
+func newDiffSide(game *GameAnalysis) DiffSide {
+	return DiffSide{
+		Depth:         game.Options.Depth,
+		MoveTimeMs:    game.Options.MoveTime.Milliseconds(),
+		Nodes:         game.Options.Nodes,
+		Classifier:    game.Options.ClassifierProfile,
+		WhiteAccuracy: game.Summary.White.Accuracy,
+		BlackAccuracy: game.Summary.Black.Accuracy,
+	}
+}
+
+// DiffAnalyses compares two analyses of a game move by move. It fails with
+// ErrDifferentGames unless both analyses are of the same moves from the same
+// positions.
+func DiffAnalyses(left, right *GameAnalysis) (*AnalysisDiff, error) {
+	if len(left.Moves) != len(right.Moves) {
+		return nil, fmt.Errorf("%w: %d and %d moves", ErrDifferentGames, len(left.Moves), len(right.Moves))
+	}
+	diff := &AnalysisDiff{Left: newDiffSide(left), Right: newDiffSide(right), Moves: []MoveDiff{}}
+	total := 0.0
+	for i := range left.Moves {
+		l, r := &left.Moves[i], &right.Moves[i]
+		if l.MoveText != r.MoveText || l.FENBefore != r.FENBefore {
+			return nil, fmt.Errorf("%w: %s and %s", ErrDifferentGames, MoveLabel(l), MoveLabel(r))
+		}
+		leftExpectation := moverExpectation("White", l.WhiteScore, l.WhiteWinProb, l.WhiteDrawProb, l.WhiteLossProb)
+		rightExpectation := moverExpectation("White", r.WhiteScore, r.WhiteWinProb, r.WhiteDrawProb, r.WhiteLossProb)
+		leftState := DefaultWinProbBands.stateAt(leftExpectation / 100)
+		rightState := DefaultWinProbBands.stateAt(rightExpectation / 100)
+		move := MoveDiff{
+			Ply:                   i,
+			Move:                  MoveLabel(l),
+			Color:                 l.Color,
+			LeftScore:             l.WhiteScore,
+			RightScore:            r.WhiteScore,
+			ScoreDifference:       rightExpectation - leftExpectation,
+			LeftClassification:    l.Classification.String(),
+			RightClassification:   r.Classification.String(),
+			ClassificationChanged: l.Classification != r.Classification,
+			LeftBestMove:          l.BestMoveSAN,
+			RightBestMove:         r.BestMoveSAN,
+			BestMoveChanged:       l.BestMoveSAN != r.BestMoveSAN,
+			LeftState:             leftState.String(),
+			RightState:            rightState.String(),
+			Flipped:               leftState != rightState,
+		}
+		if move.ClassificationChanged {
+			diff.ClassificationChanges++
+		}
+		if move.BestMoveChanged {
+			diff.BestMoveChanges++
+		}
+		if move.Flipped {
+			diff.Flips++
+		}
+		difference := math.Abs(move.ScoreDifference)
+		total += difference
+		diff.MaxScoreDifference = math.Max(diff.MaxScoreDifference, difference)
+		diff.Moves = append(diff.Moves, move)
+	}
+	if len(diff.Moves) > 0 {
+		diff.MeanScoreDifference = total / float64(len(diff.Moves))
+	}
+	return diff, nil
+}
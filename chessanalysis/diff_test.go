@@ -0,0 +1,50 @@
+package chessanalysis
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/walterschell/chess-analyzer/chessanalysis/uciengine"
+)
+
+func TestDiffAnalyses(t *testing.T) {
+	moves := []string{"e4", "e5", "Nf3", "Nc6"}
+	left := testGame("me", "them", "1-0", "C50", moves, map[int]MoveClassification{2: Blunder})
+	right := testGame("me", "them", "1-0", "C50", moves, map[int]MoveClassification{2: Best})
+	left.Options.Depth, right.Options.Depth = 8, 20
+	for i := range moves {
+		left.Moves[i].WhiteScore = uciengine.Centipawns(20)
+		right.Moves[i].WhiteScore = uciengine.Centipawns(20)
+		left.Moves[i].BestMoveSAN, right.Moves[i].BestMoveSAN = moves[i], moves[i]
+	}
+	right.Moves[3].WhiteScore = uciengine.Centipawns(400)
+	right.Moves[3].BestMoveSAN = "Nf6"
+
+	diff, err := DiffAnalyses(left, right)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff.Left.Depth != 8 || diff.Right.Depth != 20 || len(diff.Moves) != 4 {
+		t.Fatalf("unexpected diff %+v", diff)
+	}
+	if diff.ClassificationChanges != 1 || !diff.Moves[2].ClassificationChanged || diff.Moves[2].RightClassification != "Best" {
+		t.Errorf("unexpected classification changes in %+v", diff.Moves)
+	}
+	if diff.BestMoveChanges != 1 || diff.Moves[3].RightBestMove != "Nf6" {
+		t.Errorf("unexpected best move changes in %+v", diff.Moves)
+	}
+	flip := diff.Moves[3]
+	if diff.Flips != 1 || !flip.Flipped || flip.Move != "2... Nc6" || flip.LeftState != "Equal" || flip.RightState != "WhiteWinning" {
+		t.Errorf("unexpected flips in %+v", diff.Moves)
+	}
+	if flip.ScoreDifference <= 0 || diff.MaxScoreDifference != flip.ScoreDifference || diff.MeanScoreDifference != flip.ScoreDifference/4 {
+		t.Errorf("unexpected score differences %+v", diff)
+	}
+
+	if _, err := DiffAnalyses(left, testGame("me", "them", "1-0", "C50", moves[:2], nil)); !errors.Is(err, ErrDifferentGames) {
+		t.Errorf("expected ErrDifferentGames for games of different lengths, got %v", err)
+	}
+	if _, err := DiffAnalyses(left, testGame("me", "them", "1-0", "C50", []string{"e4", "e5", "Nf3", "Nf6"}, nil)); !errors.Is(err, ErrDifferentGames) {
+		t.Errorf("expected ErrDifferentGames for different moves, got %v", err)
+	}
+}
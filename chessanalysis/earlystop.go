@@ -0,0 +1,60 @@
+package chessanalysis
+
+import "fmt"
+
+// DecidedDepth is how deep moves are searched once WithEarlyStop finds the
+// game decided, unless the analysis searches shallower anyway
+const DecidedDepth = 8
+
+// EarlyStop is when an analysis stops grinding out a decided game, see
+// WithEarlyStop
+type EarlyStop struct {
+	// Centipawns is the evaluation, for either side, beyond which a position
+	// is decided; forced mates always are
+	Centipawns int `json:"centipawns"`
+	// Moves is how many analyzed moves in a row must be decided
+	Moves int `json:"moves"`
+	// Skip leaves the rest of the game unsearched, as WithSide leaves the
+	// opponent's moves, instead of searching it to DecidedDepth
+	Skip bool `json:"skip,omitempty"`
+}
+
+// WithEarlyStop spends less time on games that are already decided, such as
+// long technically won endgames: once stop.Moves analyzed moves in a row are
+// evaluated beyond stop.Centipawns for either side, the rest of the game is
+// searched to DecidedDepth alone, or with stop.Skip not at all, and its
+// moves are marked Decided. Should a shallow search find the game no longer
+// decided, the moves after it are searched in full again.
+func WithEarlyStop(stop EarlyStop) AnalyzeChessGameOption {
+	return func(opts *AnalyzeChessGameOptions) {
+		opts.EarlyStop = &stop
+	}
+}
+
+// validateEarlyStop checks the conditions of WithEarlyStop
+func validateEarlyStop(stop *EarlyStop) error {
+	if stop == nil {
+		return nil
+	}
+	if stop.Centipawns <= 0 {
+		return fmt.Errorf("%w: early stop evaluation %d must be positive", ErrInvalidOptions, stop.Centipawns)
+	}
+	if stop.Moves < 1 {
+		return fmt.Errorf("%w: early stop after %d moves, at least 1 is needed", ErrInvalidOptions, stop.Moves)
+	}
+	return nil
+}
+
+// decides reports whether White's score decides the game
+func (s *EarlyStop) decides(whiteScore Score) bool {
+	return whiteScore.IsMate() || max(whiteScore.CP(), -whiteScore.CP()) > s.Centipawns
+}
+
+// decidedLimits returns the limits moves of a decided game are searched with
+func decidedLimits(limits SearchLimits) SearchLimits {
+	if limits.Depth > 0 && limits.Depth <= DecidedDepth {
+		return limits
+	}
+	limits.Depth, limits.MoveTime, limits.Nodes = DecidedDepth, 0, 0
+	return limits
+}
@@ -0,0 +1,72 @@
+package chessanalysis
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/walterschell/chess-analyzer/chessanalysis/uciengine"
+)
+
+// crushingEngine evaluates every position five pawns up for White
+type crushingEngine struct {
+	Engine
+}
+
+func (e crushingEngine) AnalyzeLastMove(moves []string, limits SearchLimits) (*AnalysisResult, error) {
+	result, err := e.Engine.AnalyzeLastMove(moves, limits)
+	if err == nil {
+		result.WhiteScore, result.BestMoveWhiteScore = uciengine.Pawns(5), uciengine.Pawns(5)
+	}
+	return result, err
+}
+
+func TestEarlyStop(t *testing.T) {
+	if _, err := ResolveOptions(WithEarlyStop(EarlyStop{Centipawns: 400})); !errors.Is(err, ErrInvalidOptions) {
+		t.Errorf("expected an early stop after no moves to be rejected, got %v", err)
+	}
+
+	const game = "[Event \"Decided\"]\n\n1. e4 e5 2. Nf3 Nc6 3. Bb5 a6 *\n"
+	crushing := func() (Engine, error) {
+		engine, err := (&FakeEngine{}).NewEngine()
+		return crushingEngine{Engine: engine}, err
+	}
+	stop := EarlyStop{Centipawns: 400, Moves: 2}
+	analyzed, err := AnalyzeGame(game, WithDepth(12), WithEarlyStop(stop), WithEngineFactory(crushing))
+	if err != nil {
+		t.Fatalf("failed to analyze game: %v", err)
+	}
+	if analyzed.Options.EarlyStop == nil || *analyzed.Options.EarlyStop != stop {
+		t.Errorf("expected the early stop in the effective options, got %+v", analyzed.Options.EarlyStop)
+	}
+	for i, move := range analyzed.Moves {
+		decided := i >= 2
+		wantDepth := 12
+		if decided {
+			wantDepth = DecidedDepth
+		}
+		if move.Decided != decided || move.RequestedDepth != wantDepth || !move.Evaluated() {
+			t.Errorf("expected %s decided %v and searched to depth %d, got %v to depth %d", MoveLabel(&move), decided, wantDepth, move.Decided, move.RequestedDepth)
+		}
+	}
+
+	stop.Skip = true
+	moves, err := AnalyzeChessGame(game, WithDepth(12), WithEarlyStop(stop), WithEngineFactory(crushing))
+	if err != nil {
+		t.Fatalf("failed to analyze game: %v", err)
+	}
+	for i, move := range moves {
+		if decided := i >= 2; move.Decided != decided || move.Skipped != decided || move.Evaluated() == decided {
+			t.Errorf("expected %s skipped as decided to be %v, got %+v", MoveLabel(&move), decided, move)
+		}
+	}
+
+	moves, err = AnalyzeChessGame(game, WithDepth(12), WithEarlyStop(stop), WithEngineFactory((&FakeEngine{}).NewEngine))
+	if err != nil {
+		t.Fatalf("failed to analyze game: %v", err)
+	}
+	for _, move := range moves {
+		if move.Decided || move.Skipped {
+			t.Errorf("expected %s of an even game searched in full, got %+v", MoveLabel(&move), move)
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package chessanalysis
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	chess "github.com/corentings/chess/v2"
+)
+
+// ECOOpening is an opening of the ECO classification
+type ECOOpening struct {
+	ECO  string `json:"eco"`
+	Name string `json:"name"`
+	// Moves are its standard move order, e.g. "1. d4 d5 2. c4"
+	Moves string `json:"moves"`
+}
+
+// ECOOpenings are the openings games are classified by, the main lines of
+// each ECO volume. Where two lead to the same position, the first is the
+// position's opening.
+var ECOOpenings = []ECOOpening{
+	{"A00", "Polish Opening", "1. b4"},
+	{"A01", "Nimzo-Larsen Attack", "1. b3"},
+	{"A02", "Bird Opening", "1. f4"},
+	{"A04", "Zukertort Opening", "1. Nf3"},
+	{"A10", "English Opening", "1. c4"},
+	{"A13", "English Opening: Agincourt Defense", "1. c4 e6"},
+	{"A15", "English Opening: Anglo-Indian Defense", "1. c4 Nf6"},
+	{"A20", "English Opening: King's English Variation", "1. c4 e5"},
+	{"A30", "English Opening: Symmetrical Variation", "1. c4 c5"},
+	{"A40", "Queen's Pawn Game", "1. d4"},
+	{"A45", "Indian Defense", "1. d4 Nf6"},
+	{"A46", "Indian Defense: Knights Variation", "1. d4 Nf6 2. Nf3"},
+	{"A50", "Indian Defense: Normal Variation", "1. d4 Nf6 2. c4"},
+	{"A53", "Old Indian Defense", "1. d4 Nf6 2. c4 d6"},
+	{"A56", "Benoni Defense", "1. d4 Nf6 2. c4 c5"},
+	{"A57", "Benko Gambit", "1. d4 Nf6 2. c4 c5 3. d5 b5"},
+	{"A80", "Dutch Defense", "1. d4 f5"},
+	{"B00", "King's Pawn Game", "1. e4"},
+	{"B01", "Scandinavian Defense", "1. e4 d5"},
+	{"B02", "Alekhine Defense", "1. e4 Nf6"},
+	{"B06", "Modern Defense", "1. e4 g6"},
+	{"B07", "Pirc Defense", "1. e4 d6 2. d4 Nf6"},
+	{"B10", "Caro-Kann Defense", "1. e4 c6"},
+	{"B12", "Caro-Kann Defense: Advance Variation", "1. e4 c6 2. d4 d5 3. e5"},
+	{"B13", "Caro-Kann Defense: Exchange Variation", "1. e4 c6 2. d4 d5 3. exd5 cxd5"},
+	{"B15", "Caro-Kann Defense: Main Line", "1. e4 c6 2. d4 d5 3. Nc3"},
+	{"B20", "Sicilian Defense", "1. e4 c5"},
+	{"B22", "Sicilian Defense: Alapin Variation", "1. e4 c5 2. c3"},
+	{"B23", "Sicilian Defense: Closed", "1. e4 c5 2. Nc3"},
+	{"B30", "Sicilian Defense: Old Sicilian", "1. e4 c5 2. Nf3 Nc6"},
+	{"B40", "Sicilian Defense: French Variation", "1. e4 c5 2. Nf3 e6"},
+	{"B50", "Sicilian Defense: Modern Variations", "1. e4 c5 2. Nf3 d6"},
+	{"B54", "Sicilian Defense: Modern Variations, Main Line", "1. e4 c5 2. Nf3 d6 3. d4 cxd4 4. Nxd4"},
+	{"B56", "Sicilian Defense: Classical Variation", "1. e4 c5 2. Nf3 d6 3. d4 cxd4 4. Nxd4 Nf6 5. Nc3 Nc6"},
+	{"B70", "Sicilian Defense: Dragon Variation", "1. e4 c5 2. Nf3 d6 3. d4 cxd4 4. Nxd4 Nf6 5. Nc3 g6"},
+	{"B80", "Sicilian Defense: Scheveningen Variation", "1. e4 c5 2. Nf3 d6 3. d4 cxd4 4. Nxd4 Nf6 5. Nc3 e6"},
+	{"B90", "Sicilian Defense: Najdorf Variation", "1. e4 c5 2. Nf3 d6 3. d4 cxd4 4. Nxd4 Nf6 5. Nc3 a6"},
+	{"C00", "French Defense", "1. e4 e6"},
+	{"C01", "French Defense: Exchange Variation", "1. e4 e6 2. d4 d5 3. exd5 exd5"},
+	{"C02", "French Defense: Advance Variation", "1. e4 e6 2. d4 d5 3. e5"},
+	{"C03", "French Defense: Tarrasch Variation", "1. e4 e6 2. d4 d5 3. Nd2"},
+	{"C10", "French Defense: Paulsen Variation", "1. e4 e6 2. d4 d5 3. Nc3"},
+	{"C20", "King's Pawn Game", "1. e4 e5"},
+	{"C23", "Bishop's Opening", "1. e4 e5 2. Bc4"},
+	{"C25", "Vienna Game", "1. e4 e5 2. Nc3"},
+	{"C30", "King's Gambit", "1. e4 e5 2. f4"},
+	{"C40", "King's Knight Opening", "1. e4 e5 2. Nf3"},
+	{"C41", "Philidor Defense", "1. e4 e5 2. Nf3 d6"},
+	{"C42", "Petrov's Defense", "1. e4 e5 2. Nf3 Nf6"},
+	{"C44", "King's Knight Opening: Normal Variation", "1. e4 e5 2. Nf3 Nc6"},
+	{"C44", "Scotch Game", "1. e4 e5 2. Nf3 Nc6 3. d4"},
+	{"C45", "Scotch Game: Main Line", "1. e4 e5 2. Nf3 Nc6 3. d4 exd4 4. Nxd4"},
+	{"C46", "Three Knights Opening", "1. e4 e5 2. Nf3 Nc6 3. Nc3"},
+	{"C47", "Four Knights Game", "1. e4 e5 2. Nf3 Nc6 3. Nc3 Nf6"},
+	{"C50", "Italian Game", "1. e4 e5 2. Nf3 Nc6 3. Bc4"},
+	{"C50", "Italian Game: Giuoco Piano", "1. e4 e5 2. Nf3 Nc6 3. Bc4 Bc5"},
+	{"C55", "Italian Game: Two Knights Defense", "1. e4 e5 2. Nf3 Nc6 3. Bc4 Nf6"},
+	{"C60", "Ruy Lopez", "1. e4 e5 2. Nf3 Nc6 3. Bb5"},
+	{"C65", "Ruy Lopez: Berlin Defense", "1. e4 e5 2. Nf3 Nc6 3. Bb5 Nf6"},
+	{"C68", "Ruy Lopez: Exchange Variation", "1. e4 e5 2. Nf3 Nc6 3. Bb5 a6 4. Bxc6"},
+	{"C70", "Ruy Lopez: Morphy Defense", "1. e4 e5 2. Nf3 Nc6 3. Bb5 a6 4. Ba4"},
+	{"D00", "Queen's Pawn Game", "1. d4 d5"},
+	{"D02", "Queen's Pawn Game: Zukertort Variation", "1. d4 d5 2. Nf3"},
+	{"D02", "Queen's Pawn Game: London System", "1. d4 d5 2. Nf3 Nf6 3. Bf4"},
+	{"D06", "Queen's Gambit", "1. d4 d5 2. c4"},
+	{"D07", "Queen's Gambit Declined: Chigorin Defense", "1. d4 d5 2. c4 Nc6"},
+	{"D10", "Slav Defense", "1. d4 d5 2. c4 c6"},
+	{"D20", "Queen's Gambit Accepted", "1. d4 d5 2. c4 dxc4"},
+	{"D30", "Queen's Gambit Declined", "1. d4 d5 2. c4 e6"},
+	{"D31", "Queen's Gambit Declined: Queen's Knight Variation", "1. d4 d5 2. c4 e6 3. Nc3"},
+	{"D35", "Queen's Gambit Declined: Normal Defense", "1. d4 d5 2. c4 e6 3. Nc3 Nf6"},
+	{"D37", "Queen's Gambit Declined: Three Knights Variation", "1. d4 d5 2. c4 e6 3. Nc3 Nf6 4. Nf3"},
+	{"D43", "Semi-Slav Defense", "1. d4 d5 2. c4 e6 3. Nc3 Nf6 4. Nf3 c6"},
+	{"D80", "Grünfeld Defense", "1. d4 Nf6 2. c4 g6 3. Nc3 d5"},
+	{"E00", "Indian Defense: East Indian Defense", "1. d4 Nf6 2. c4 e6"},
+	{"E01", "Catalan Opening", "1. d4 Nf6 2. c4 e6 3. g3"},
+	{"E10", "Indian Defense: Anti-Nimzo-Indian", "1. d4 Nf6 2. c4 e6 3. Nf3"},
+	{"E12", "Queen's Indian Defense", "1. d4 Nf6 2. c4 e6 3. Nf3 b6"},
+	{"E20", "Nimzo-Indian Defense", "1. d4 Nf6 2. c4 e6 3. Nc3 Bb4"},
+	{"E60", "King's Indian Defense", "1. d4 Nf6 2. c4 g6"},
+	{"E61", "King's Indian Defense: Main Line", "1. d4 Nf6 2. c4 g6 3. Nc3 Bg7"},
+	{"E70", "King's Indian Defense: Normal Variation", "1. d4 Nf6 2. c4 g6 3. Nc3 Bg7 4. e4 d6"},
+}
+
+// ecoTable finds the openings of ECOOpenings by their position, whichever
+// order its moves were played in, and by their moves in order
+type ecoTable struct {
+	positions map[string]*ECOOpening // By the theoryKey of the position they reach
+	lines     map[string]*ECOOpening // By their moves in SAN, separated by spaces
+}
+
+// ecoOpenings returns the table of ECOOpenings, built the first time
+var ecoOpenings = sync.OnceValue(func() *ecoTable {
+	table := &ecoTable{positions: make(map[string]*ECOOpening), lines: make(map[string]*ECOOpening)}
+	for i := range ECOOpenings {
+		opening := &ECOOpenings[i]
+		position := chess.StartingPosition()
+		var sans []string
+		for _, token := range strings.Fields(opening.Moves) {
+			if strings.HasSuffix(token, ".") {
+				continue
+			}
+			move, err := chess.AlgebraicNotation{}.Decode(position, token)
+			if err != nil {
+				panic(fmt.Sprintf("ECO opening %s %s: %v", opening.ECO, opening.Name, err))
+			}
+			position = position.Update(move)
+			sans = append(sans, token)
+		}
+		key := theoryKey(position.String())
+		if table.positions[key] == nil {
+			table.positions[key] = opening
+		}
+		table.lines[strings.Join(sans, " ")] = opening
+	}
+	return table
+})
+
+// GameOpening is the opening of a game, see ClassifyOpening
+type GameOpening struct {
+	// ECOOpening is the last opening whose position the game reached
+	ECOOpening
+	Ply int `json:"ply"` // Index of the move that reached its position
+	// Nominal is the last opening whose moves the game played in their
+	// standard order, as naming the game by its moves would; nil if the game
+	// played none. It differs from the opening reached when the game
+	// transposed into it.
+	Nominal *ECOOpening `json:"nominal,omitempty"`
+	// Transposition is the game's own moves to the opening's position, when
+	// they aren't its standard move order, e.g. "1. c4 e6 2. Nc3 d5 3. d4 Nf6"
+	Transposition string `json:"transposition,omitempty"`
+}
+
+// Transposed reports whether the game reached its opening's position in
+// another order than the opening's standard moves
+func (o *GameOpening) Transposed() bool {
+	return o.Transposition != ""
+}
+
+// ClassifyOpening finds the opening of the analyzed moves of a game in
+// ECOOpenings by the positions the game reached, rather than by its moves,
+// so that games reaching an opening by a transposition are classified as
+// it, and tells whether they did and which opening their moves nominally
+// were. It returns nil for games that reached no opening's position or
+// didn't start from the standard starting position.
+func ClassifyOpening(moves []MoveAnalysis) *GameOpening {
+	if len(moves) == 0 || theoryKey(moves[0].FENBefore) != theoryKey(chess.StartingPosition().String()) {
+		return nil
+	}
+	table := ecoOpenings()
+	var classified *GameOpening
+	var nominal *ECOOpening
+	sans := make([]string, 0, len(moves))
+	for ply := range moves {
+		sans = append(sans, moves[ply].MoveText)
+		line := strings.Join(sans, " ")
+		if opening, ok := table.lines[line]; ok {
+			nominal = opening
+		}
+		if opening, ok := table.positions[theoryKey(moves[ply].FENAfter)]; ok {
+			classified = &GameOpening{ECOOpening: *opening, Ply: ply}
+		}
+	}
+	if classified == nil {
+		return nil
+	}
+	played := FormatLine(1, "White", sans[:classified.Ply+1])
+	if played != classified.Moves {
+		classified.Transposition = played
+	}
+	if nominal != nil {
+		nominalOpening := *nominal
+		classified.Nominal = &nominalOpening
+	}
+	return classified
+}
@@ -0,0 +1,63 @@
+package chessanalysis
+
+import "testing"
+
+func TestECOOpenings(t *testing.T) {
+	table := ecoOpenings()
+	if len(table.lines) != len(ECOOpenings) || len(table.positions) != len(ECOOpenings) {
+		t.Errorf("expected every opening to have its own moves and position, got %d lines and %d positions of %d openings",
+			len(table.lines), len(table.positions), len(ECOOpenings))
+	}
+	for _, opening := range table.lines {
+		if len(opening.ECO) != 3 || opening.Name == "" {
+			t.Errorf("unexpected opening %+v", opening)
+		}
+	}
+}
+
+func TestClassifyOpening(t *testing.T) {
+	analyze := func(pgn string) *GameOpening {
+		t.Helper()
+		moves, err := AnalyzeChessGame("[Result \"*\"]\n\n"+pgn+" *", WithDepth(1), WithEngineFactory((&FakeEngine{}).NewEngine))
+		if err != nil {
+			t.Fatalf("failed to analyze %s: %v", pgn, err)
+		}
+		return ClassifyOpening(moves)
+	}
+
+	// The English reaching the Queen's Gambit Declined
+	opening := analyze("1. c4 e6 2. Nc3 d5 3. d4 Nf6 4. Bg5")
+	if opening == nil || opening.ECO != "D35" || opening.Ply != 5 || !opening.Transposed() {
+		t.Fatalf("expected a transposition into D35 at ply 5, got %+v", opening)
+	}
+	if opening.Transposition != "1. c4 e6 2. Nc3 d5 3. d4 Nf6" || opening.Moves != "1. d4 d5 2. c4 e6 3. Nc3 Nf6" {
+		t.Errorf("unexpected move orders %q and %q", opening.Transposition, opening.Moves)
+	}
+	if opening.Nominal == nil || opening.Nominal.ECO != "A13" {
+		t.Errorf("expected the moves to be nominally the Agincourt Defense, got %+v", opening.Nominal)
+	}
+
+	// The Ruy Lopez in its standard order, past the last opening of the table
+	opening = analyze("1. e4 e5 2. Nf3 Nc6 3. Bb5 a6 4. Bc4")
+	if opening == nil || opening.ECO != "C60" || opening.Transposed() || opening.Nominal == nil || opening.Nominal.ECO != "C60" {
+		t.Errorf("expected the Ruy Lopez without a transposition, got %+v", opening)
+	}
+
+	// 1. Nf3 d5 2. d4 is the Zukertort Variation of the Queen's Pawn Game
+	opening = analyze("1. Nf3 d5 2. d4")
+	if opening == nil || opening.ECO != "D02" || opening.Transposition != "1. Nf3 d5 2. d4" || opening.Nominal.ECO != "A04" {
+		t.Errorf("expected a transposition into D02 from A04, got %+v", opening)
+	}
+
+	if opening := analyze("1. h3 h6 2. a3"); opening != nil {
+		t.Errorf("expected no opening, got %+v", opening)
+	}
+	moves, err := AnalyzeChessGame("[FEN \"4k3/8/8/8/8/8/4P3/4K3 w - - 0 1\"]\n[SetUp \"1\"]\n[Result \"*\"]\n\n1. e4 Kd7 *",
+		WithDepth(1), WithEngineFactory((&FakeEngine{}).NewEngine))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opening := ClassifyOpening(moves); opening != nil {
+		t.Errorf("expected no opening for a game from a position, got %+v", opening)
+	}
+}
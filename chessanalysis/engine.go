@@ -0,0 +1,30 @@
+package chessanalysis
+
+import (
+	"log/slog"
+
+	"github.com/walterschell/chess-analyzer/chessanalysis/uciengine"
+)
+
+var log = slog.Default().With("package", "chessanalysis")
+
+var StartingPositionWhiteScore = uciengine.Centipawns(11)
+
+const StartingPositionWhiteWinProb = 0.01
+const StartingPositionWhiteDrawProb = 0.98
+const StartingPositionWhiteLossProb = 0.01
+
+// The engines themselves are run by the uciengine package. Its types are
+// aliased here, as the analysis API is written in terms of them.
+type (
+	Engine             = uciengine.Engine
+	EngineFactory      = uciengine.EngineFactory
+	StockfishEngine    = uciengine.StockfishEngine
+	SearchLimits       = uciengine.SearchLimits
+	AnalysisResult     = uciengine.AnalysisResult
+	EngineInfo         = uciengine.EngineInfo
+	EngineOption       = uciengine.EngineOption
+	EngineCapabilities = uciengine.EngineCapabilities
+	EngineDescriber    = uciengine.EngineDescriber
+	Score              = uciengine.Score
+)
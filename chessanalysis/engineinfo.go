@@ -0,0 +1,14 @@
+package chessanalysis
+
+// DescribeEngine returns what the engine reported about itself, or false if
+// it doesn't say
+func DescribeEngine(engine Engine) (EngineInfo, bool) {
+	if pooled, ok := engine.(*pooledEngine); ok {
+		engine = pooled.Engine
+	}
+	describer, ok := engine.(EngineDescriber)
+	if !ok {
+		return EngineInfo{}, false
+	}
+	return describer.Info(), true
+}
@@ -0,0 +1,25 @@
+package chessanalysis
+
+import (
+	"context"
+	"testing"
+)
+
+func TestDescribeEngine(t *testing.T) {
+	engine, err := NewEnginePool(1).Acquire(context.Background(), InteractivePriority, (&FakeEngine{}).NewEngine)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer engine.Close()
+	info, ok := DescribeEngine(engine)
+	if !ok {
+		t.Fatal("expected the engine to describe itself")
+	}
+	if info.Name != "FakeEngine" || info.Version != "1.0" || len(info.Options) != 3 {
+		t.Errorf("unexpected engine info %+v", info)
+	}
+	if capabilities := info.Capabilities(); capabilities != (EngineCapabilities{MaxMultiPV: 500, WDL: true}) {
+		t.Errorf("unexpected capabilities %+v", capabilities)
+	}
+
+}
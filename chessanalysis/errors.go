@@ -0,0 +1,38 @@
+package chessanalysis
+
+import (
+	"errors"
+
+	"github.com/walterschell/chess-analyzer/chessanalysis/uciengine"
+)
+
+// Errors returned by the analysis functions. They are wrapped with additional
+// context, so callers should compare against them with errors.Is.
+var (
+	// ErrEngineNotFound is returned when the chess engine binary can't be found
+	ErrEngineNotFound = uciengine.ErrEngineNotFound
+	// ErrEngineTimeout is returned when the chess engine stops responding
+	ErrEngineTimeout = uciengine.ErrEngineTimeout
+	// ErrInvalidPGN is returned when the PGN can't be parsed or contains illegal moves
+	ErrInvalidPGN = errors.New("invalid PGN")
+	// ErrEmptyGame is returned when there is no game to analyze
+	ErrEmptyGame = errors.New("empty game")
+	// ErrInvalidOptions is returned when the analysis options can't be used
+	ErrInvalidOptions = errors.New("invalid analysis options")
+	// ErrAnalysisCancelled is returned when the analysis context is cancelled
+	ErrAnalysisCancelled = errors.New("analysis cancelled")
+	// ErrTablebaseMiss is returned when a tablebase doesn't cover a position
+	ErrTablebaseMiss = errors.New("position not in tablebase")
+	// ErrTimeBudgetExceeded is returned along with the moves analyzed so far
+	// when the analysis runs out of the time given with WithTimeBudget
+	ErrTimeBudgetExceeded = errors.New("analysis time budget exceeded")
+	// ErrIllegalMove is returned when a move given by the caller can't be
+	// played in its position
+	ErrIllegalMove = errors.New("illegal move")
+	// ErrInputTooLarge is returned, as an *InputLimitError, when a PGN
+	// exceeds the InputLimits it is checked against
+	ErrInputTooLarge = errors.New("input too large")
+	// ErrUnsupportedSchema is returned when decoding JSON of a later
+	// SchemaVersion than this package knows
+	ErrUnsupportedSchema = errors.New("unsupported schema version")
+)
@@ -0,0 +1,55 @@
+package chessanalysis
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// EvalBar is a kibitz update cut down to what an evaluation bar shows, small
+// enough to send at every depth of the search
+type EvalBar struct {
+	Ply  int        `json:"ply"`            // Plies before the position, by its FEN's move number
+	CP   *int       `json:"cp,omitempty"`   // White's score in centipawns, unless a mate was found
+	Mate *int       `json:"mate,omitempty"` // Moves to mate, negative when White is being mated
+	WDL  [3]float64 `json:"wdl"`            // White's win, draw and loss chances
+}
+
+// NewEvalBar returns the evaluation bar of the update
+func NewEvalBar(update KibitzUpdate) EvalBar {
+	bar := EvalBar{
+		Ply: fenPly(update.FEN),
+		WDL: [3]float64{roundProb(update.WhiteWinProb), roundProb(update.WhiteDrawProb), roundProb(update.WhiteLossProb)},
+	}
+	if update.WhiteScore.IsMate() {
+		mate := update.WhiteScore.Mate()
+		bar.Mate = &mate
+	} else {
+		cp := update.WhiteScore.CP()
+		bar.CP = &cp
+	}
+	return bar
+}
+
+// fenPly returns how many plies were played before the position given as a
+// FEN, by its side to move and move number, or 0 if it has no move number
+func fenPly(fen string) int {
+	fields := strings.Fields(fen)
+	if len(fields) < 6 {
+		return 0
+	}
+	move, err := strconv.Atoi(fields[5])
+	if err != nil || move < 1 {
+		return 0
+	}
+	ply := 2 * (move - 1)
+	if fields[1] == "b" {
+		ply++
+	}
+	return ply
+}
+
+// roundProb rounds a probability to the permille engines report them in
+func roundProb(prob float64) float64 {
+	return math.Round(prob*1000) / 1000
+}
@@ -0,0 +1,32 @@
+package chessanalysis
+
+import (
+	"testing"
+
+	"github.com/walterschell/chess-analyzer/chessanalysis/uciengine"
+)
+
+func TestEvalBar(t *testing.T) {
+	bar := NewEvalBar(KibitzUpdate{
+		FEN:           "rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq e3 0 1",
+		WhiteScore:    uciengine.Pawns(0.3),
+		WhiteWinProb:  0.0812345,
+		WhiteDrawProb: 0.9,
+		WhiteLossProb: 0.0187655,
+	})
+	if bar.Ply != 1 || bar.CP == nil || *bar.CP != 30 || bar.Mate != nil {
+		t.Errorf("expected +0.30 after White's first move, got %+v", bar)
+	}
+	if bar.WDL != [3]float64{0.081, 0.9, 0.019} {
+		t.Errorf("expected the chances in permille, got %v", bar.WDL)
+	}
+
+	mated, err := uciengine.ParseScore("#-2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bar = NewEvalBar(KibitzUpdate{FEN: "6k1/5ppp/8/8/8/8/5PPP/3r2K1 w - - 0 31", WhiteScore: mated})
+	if bar.Ply != 60 || bar.CP != nil || bar.Mate == nil || *bar.Mate != -2 {
+		t.Errorf("expected White mated in 2 at ply 60, got %+v", bar)
+	}
+}
@@ -0,0 +1,36 @@
+package chessanalysis
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/walterschell/chess-analyzer/chessanalysis/uciengine"
+)
+
+// parseEval parses the value of an [%eval] PGN command: a score in pawns from
+// White's perspective, such as "0.17", or a forced mate such as "#-3"
+func parseEval(value string) (Score, error) {
+	score, err := uciengine.ParseScore(value)
+	if err != nil {
+		return Score{}, fmt.Errorf("invalid evaluation %q", strings.TrimSpace(value))
+	}
+	return score, nil
+}
+
+// analyzeEmbeddedEval fills in a move's analysis from the evaluation the PGN
+// gives the position after it, from White's perspective. The best move isn't
+// known, so it is scored as the position before the move was.
+func analyzeEmbeddedEval(move *MoveAnalysis, whiteScore Score, classifier MoveClassifier) {
+	move.EmbeddedEval = true
+	move.WhiteScore = whiteScore
+	move.WhiteWinProb, move.WhiteDrawProb, move.WhiteLossProb = scoreWDL(whiteScore)
+	move.BestMoveWhiteScore = move.PreviousWhiteScore
+	move.BestMoveWhiteWinProb = move.PreviousWhiteWinProb
+	move.BestMoveWhiteDrawProb = move.PreviousWhiteDrawProb
+	move.BestMoveWhiteLossProb = move.PreviousWhiteLossProb
+	move.Hints = moveHints(move)
+	move.Accuracy = moveAccuracy(move)
+	move.ExpectedPoints = expectedPoints(move)
+	move.CentipawnLoss = centipawnLoss(move)
+	move.Classification = classifier.ClassifyMove(move)
+}
@@ -0,0 +1,314 @@
+package chessanalysis
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+
+	chess "github.com/corentings/chess/v2"
+	"github.com/walterschell/chess-analyzer/chessanalysis/uciengine"
+)
+
+// FakeEngine is a deterministic UCI engine for tests. It speaks the UCI
+// protocol over in-memory pipes and answers searches with scripted
+// evaluations keyed by position, so the analysis pipeline can run without
+// a Stockfish binary installed.
+type FakeEngine struct {
+	// Positions maps a FEN to the evaluation reported when that position is
+	// searched. Only the piece placement, side to move, castling, and en passant
+	// fields are compared. Positions without an entry evaluate to 0.00 with the
+	// first legal move in UCI order as the best move.
+	Positions map[string]FakeEvaluation
+}
+
+// FakeEvaluation is the scripted result of searching a position
+type FakeEvaluation struct {
+	BestMove string         // Best move in UCI notation; defaults to the first legal move
+	Score    int            // Centipawns from the side to move's perspective
+	Mate     int            // Moves to mate for the side to move, reported for the best move instead of Score; 0 for none
+	Moves    map[string]int // Scores of specific moves when restricted with searchmoves
+}
+
+// DefaultFakeMovePenalty is how many centipawns worse than the best move an
+// unscripted move is scored when searched with searchmoves
+const DefaultFakeMovePenalty = 50
+
+// NewEngine starts a UCI session with the fake engine
+func (f *FakeEngine) NewEngine() (Engine, error) {
+	engine, err := uciengine.NewEngine(f.launch)
+	if err != nil {
+		return nil, err
+	}
+	return engine, nil
+}
+
+// launch starts the fake engine loop on a pair of pipes
+func (f *FakeEngine) launch() (*uciengine.Process, error) {
+	commandsReader, commandsWriter := io.Pipe()
+	responsesReader, responsesWriter := io.Pipe()
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		defer responsesWriter.Close()
+		// Commands sent after the engine exits fail instead of blocking
+		defer commandsReader.Close()
+		f.serve(commandsReader, responsesWriter)
+	}()
+
+	return &uciengine.Process{
+		Stdin:  commandsWriter,
+		Stdout: responsesReader,
+		Kill: func() {
+			commandsWriter.Close()
+			responsesReader.Close()
+		},
+		Wait: func() error {
+			<-done
+			return nil
+		},
+	}, nil
+}
+
+// serve answers UCI commands until "quit" or the end of input
+func (f *FakeEngine) serve(commands io.Reader, responses io.Writer) {
+	position := chess.StartingPosition()
+	multiPV := 1
+	scanner := bufio.NewScanner(commands)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		switch fields[0] {
+		case "uci":
+			fmt.Fprintln(responses, "id name FakeEngine 1.0")
+			fmt.Fprintln(responses, "option name MultiPV type spin default 1 min 1 max 500")
+			fmt.Fprintln(responses, "option name UCI_ShowWDL type check default false")
+			fmt.Fprintln(responses, "option name Contempt type spin default 24 min -100 max 100")
+			fmt.Fprintln(responses, "uciok")
+		case "isready":
+			fmt.Fprintln(responses, "readyok")
+		case "setoption":
+			// setoption name MultiPV value N
+			if len(fields) == 5 && fields[2] == "MultiPV" {
+				if lines, err := strconv.Atoi(fields[4]); err == nil && lines > 0 {
+					multiPV = lines
+				}
+			}
+		case "position":
+			pos, err := fakePosition(fields[1:])
+			if err != nil {
+				fmt.Fprintf(responses, "info string invalid position: %v\n", err)
+				continue
+			}
+			position = pos
+		case "go":
+			f.search(position, fields[1:], multiPV, responses)
+		case "quit":
+			return
+		}
+	}
+}
+
+// search writes the scripted result of a "go" command for the position,
+// reporting up to multiPV lines
+func (f *FakeEngine) search(position *chess.Position, args []string, multiPV int, responses io.Writer) {
+	depth := 1
+	mateLimit := 0
+	var searchMoves []string
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "depth":
+			if i+1 < len(args) {
+				depth, _ = strconv.Atoi(args[i+1])
+				i++
+			}
+		case "mate":
+			// A mate search finds the scripted mate if it's short enough
+			if i+1 < len(args) {
+				mateLimit, _ = strconv.Atoi(args[i+1])
+				i++
+			}
+		case "searchmoves":
+			searchMoves = args[i+1:]
+			i = len(args)
+		}
+	}
+
+	eval := f.evaluation(position)
+	move, score := eval.BestMove, eval.Score
+	if len(searchMoves) > 0 && !slices.Contains(searchMoves, eval.BestMove) {
+		move = searchMoves[0]
+		if moveScore, ok := eval.Moves[move]; ok {
+			score = moveScore
+		} else {
+			score = eval.Score - DefaultFakeMovePenalty
+		}
+	}
+
+	if move == "" {
+		// No legal moves: report the terminal position the way Stockfish does
+		if position.Status() == chess.Checkmate {
+			fmt.Fprintln(responses, "info depth 0 score mate 0")
+		} else {
+			fmt.Fprintln(responses, "info depth 0 score cp 0")
+		}
+		fmt.Fprintln(responses, "bestmove (none)")
+		return
+	}
+
+	win, draw, loss := fakeWDL(score)
+	scoreText := fmt.Sprintf("cp %d", score)
+	if eval.Mate != 0 && move == eval.BestMove && (mateLimit == 0 || eval.Mate <= mateLimit) {
+		scoreText = fmt.Sprintf("mate %d", eval.Mate)
+		win, draw, loss = 1000, 0, 0
+		if eval.Mate < 0 {
+			win, loss = 0, 1000
+		}
+	}
+	// Report the shallower iterations the way Stockfish does
+	for shallower := 1; shallower < depth; shallower++ {
+		fmt.Fprintf(responses, "info depth %d seldepth %d multipv 1 score %s wdl %d %d %d nodes %d nps 1000000 hashfull %d tbhits 0 time %d pv %s\n",
+			shallower, shallower, scoreText, win, draw, loss, shallower*1000, shallower, shallower, f.line(position, move))
+	}
+	fmt.Fprintf(responses, "info depth %d seldepth %d multipv 1 score %s wdl %d %d %d nodes %d nps 1000000 hashfull %d tbhits 0 time %d pv %s\n",
+		depth, depth, scoreText, win, draw, loss, depth*1000, depth, depth, f.line(position, move))
+	if len(searchMoves) == 0 {
+		for i, alternative := range f.alternatives(position, eval) {
+			if i+2 > multiPV {
+				break
+			}
+			win, draw, loss := fakeWDL(alternative.score)
+			fmt.Fprintf(responses, "info depth %d seldepth %d multipv %d score cp %d wdl %d %d %d nodes %d nps 1000000 time %d pv %s\n",
+				depth, depth, i+2, alternative.score, win, draw, loss, depth*1000, depth, f.line(position, alternative.move))
+		}
+	}
+	fmt.Fprintf(responses, "bestmove %s\n", move)
+}
+
+// line returns the principal variation for a move: the move followed by the
+// best reply in the resulting position, if there is one
+func (f *FakeEngine) line(position *chess.Position, uci string) string {
+	move, err := chess.UCINotation{}.Decode(position, uci)
+	if err != nil {
+		return uci
+	}
+	if reply := f.evaluation(position.Update(move)).BestMove; reply != "" {
+		return uci + " " + reply
+	}
+	return uci
+}
+
+// fakeAlternative is a move other than the best one with its score
+type fakeAlternative struct {
+	move  string
+	score int
+}
+
+// alternatives returns the legal moves other than the best one, ordered by
+// score and then by UCI notation, for reporting MultiPV lines
+func (f *FakeEngine) alternatives(position *chess.Position, eval FakeEvaluation) []fakeAlternative {
+	var alternatives []fakeAlternative
+	moves := position.ValidMoves()
+	for i := range moves {
+		uci := moveToUci(position, &moves[i])
+		if uci == eval.BestMove {
+			continue
+		}
+		score, ok := eval.Moves[uci]
+		if !ok {
+			score = eval.Score - DefaultFakeMovePenalty
+		}
+		alternatives = append(alternatives, fakeAlternative{move: uci, score: score})
+	}
+	slices.SortFunc(alternatives, func(a, b fakeAlternative) int {
+		if a.score != b.score {
+			return b.score - a.score
+		}
+		return strings.Compare(a.move, b.move)
+	})
+	return alternatives
+}
+
+// evaluation returns the scripted evaluation for the position, filling in defaults
+func (f *FakeEngine) evaluation(position *chess.Position) FakeEvaluation {
+	key := fenKey(position.String())
+	var eval FakeEvaluation
+	for fen, scripted := range f.Positions {
+		if fenKey(fen) == key {
+			eval = scripted
+			break
+		}
+	}
+	if eval.BestMove == "" {
+		moves := position.ValidMoves()
+		uciMoves := make([]string, 0, len(moves))
+		for i := range moves {
+			uciMoves = append(uciMoves, moveToUci(position, &moves[i]))
+		}
+		slices.Sort(uciMoves)
+		if len(uciMoves) > 0 {
+			eval.BestMove = uciMoves[0]
+		}
+	}
+	return eval
+}
+
+// fakePosition builds the position described by the arguments of a UCI "position" command
+func fakePosition(args []string) (*chess.Position, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf("missing position")
+	}
+	game := chess.NewGame()
+	rest := args[1:]
+	switch args[0] {
+	case "startpos":
+	case "fen":
+		end := slices.Index(rest, "moves")
+		if end < 0 {
+			end = len(rest)
+		}
+		fen, err := chess.FEN(strings.Join(rest[:end], " "))
+		if err != nil {
+			return nil, err
+		}
+		game = chess.NewGame(fen)
+		rest = rest[end:]
+	default:
+		return nil, fmt.Errorf("unknown position type %q", args[0])
+	}
+	if len(rest) > 0 && rest[0] == "moves" {
+		for _, uci := range rest[1:] {
+			move, err := chess.UCINotation{}.Decode(game.Position(), uci)
+			if err != nil {
+				return nil, err
+			}
+			if err := game.PushMove(chess.AlgebraicNotation{}.Encode(game.Position(), move), nil); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return game.Position(), nil
+}
+
+// fenKey strips the move counters from a FEN so positions compare regardless of move number
+func fenKey(fen string) string {
+	fields := strings.Fields(fen)
+	if len(fields) > 4 {
+		fields = fields[:4]
+	}
+	return strings.Join(fields, " ")
+}
+
+// fakeWDL derives win/draw/loss permille statistics from a centipawn score
+func fakeWDL(score int) (win, draw, loss int) {
+	winProb, _, lossProb := scoreWDL(uciengine.Centipawns(score))
+	win = int(math.Round(1000 * winProb))
+	loss = int(math.Round(1000 * lossProb))
+	return win, 1000 - win - loss, loss
+}
@@ -0,0 +1,52 @@
+package chessanalysis
+
+import chess "github.com/corentings/chess/v2"
+
+// WithSkipForced skips the engine search for forced moves: the only legal
+// move in a position, and recaptures on the square the opponent just captured
+// on that the search of the opponent's move expected. They are classified
+// Forced and keep the evaluation before the move.
+func WithSkipForced() AnalyzeChessGameOption {
+	return func(opts *AnalyzeChessGameOptions) {
+		opts.SkipForced = true
+	}
+}
+
+// isForcedMove reports whether move, played in before, is the only legal
+// move or the recapture of the move before it that the engine expected, where
+// previousResult is the search of the move before it; nil if it wasn't
+// searched
+func isForcedMove(before *chess.Position, move *chess.Move, previousResult *AnalysisResult) bool {
+	if len(before.ValidMoves()) == 1 {
+		return true
+	}
+	previous := move.Parent()
+	if previousResult == nil || previous == nil || !previous.HasTag(chess.Capture) {
+		return false
+	}
+	if !move.HasTag(chess.Capture) || move.S2() != previous.S2() {
+		return false
+	}
+	expected := previousResult.PlayedLine
+	return len(expected) > 1 && expected[1] == moveToUci(before, move)
+}
+
+// analyzeForcedMove fills in the analysis of a forced move, which is the
+// best move and keeps the evaluation before it
+func analyzeForcedMove(move *MoveAnalysis, playedUci string) {
+	move.WhiteScore = move.PreviousWhiteScore
+	move.WhiteWinProb = move.PreviousWhiteWinProb
+	move.WhiteDrawProb = move.PreviousWhiteDrawProb
+	move.WhiteLossProb = move.PreviousWhiteLossProb
+	move.BestMove = playedUci
+	move.BestMoveSAN = move.MoveText
+	move.BestMoveWhiteScore = move.PreviousWhiteScore
+	move.BestMoveWhiteWinProb = move.PreviousWhiteWinProb
+	move.BestMoveWhiteDrawProb = move.PreviousWhiteDrawProb
+	move.BestMoveWhiteLossProb = move.PreviousWhiteLossProb
+	move.IsBestMove = true
+	move.EngineRank = 1
+	move.Hints = moveHints(move)
+	move.Accuracy = 100
+	move.Classification = Forced
+}
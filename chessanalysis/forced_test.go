@@ -0,0 +1,50 @@
+package chessanalysis
+
+import "testing"
+
+const (
+	onlyMovePgn  = "[Event \"Only move\"]\n\n1. e4 f6 2. Qh5+ g6 *\n"
+	recapturePgn = "[Event \"Recapture\"]\n\n1. e4 d5 2. exd5 Qxd5 *\n"
+)
+
+func TestSkipForced(t *testing.T) {
+	onlyMove, err := AnalyzeChessGame(onlyMovePgn, WithDepth(3), WithSkipForced(), WithEngineFactory((&FakeEngine{}).NewEngine))
+	if err != nil {
+		t.Fatalf("failed to analyze game: %v", err)
+	}
+	for i, move := range onlyMove {
+		if forced := i == 3; (move.Classification == Forced) != forced {
+			t.Errorf("expected %s forced to be %v, got %v", MoveLabel(&move), forced, move.Classification)
+		}
+	}
+	if g6 := onlyMove[3]; g6.Evaluated() || !g6.IsBestMove || g6.Accuracy != 100 || g6.WhiteScore != g6.PreviousWhiteScore {
+		t.Errorf("expected the only move to keep the evaluation before it unsearched, got %+v", g6)
+	}
+
+	// The search of 2. exd5 expects 2... Qxd5, so the recapture is forced
+	recapture := &FakeEngine{Positions: map[string]FakeEvaluation{
+		"rnbqkbnr/ppp1pppp/8/3P4/8/8/PPPP1PPP/RNBQKBNR b KQkq - 0 2": {BestMove: "d8d5"},
+	}}
+	moves, err := AnalyzeChessGame(recapturePgn, WithDepth(3), WithSkipForced(), WithEngineFactory(recapture.NewEngine))
+	if err != nil {
+		t.Fatalf("failed to analyze game: %v", err)
+	}
+	if qxd5 := moves[3]; qxd5.Classification != Forced || qxd5.Evaluated() {
+		t.Errorf("expected the expected recapture to be forced, got %v", qxd5.Classification)
+	}
+	moves, err = AnalyzeChessGame(recapturePgn, WithDepth(3), WithSkipForced(), WithEngineFactory((&FakeEngine{}).NewEngine))
+	if err != nil {
+		t.Fatalf("failed to analyze game: %v", err)
+	}
+	if qxd5 := moves[3]; qxd5.Classification == Forced || !qxd5.Evaluated() {
+		t.Errorf("expected a recapture the engine didn't expect to be searched, got %v", qxd5.Classification)
+	}
+
+	moves, err = AnalyzeChessGame(onlyMovePgn, WithDepth(3), WithEngineFactory((&FakeEngine{}).NewEngine))
+	if err != nil {
+		t.Fatalf("failed to analyze game: %v", err)
+	}
+	if g6 := moves[3]; g6.Classification == Forced || !g6.Evaluated() {
+		t.Errorf("expected forced moves to be searched without WithSkipForced, got %v", g6.Classification)
+	}
+}
@@ -0,0 +1,262 @@
+package chessanalysis
+
+import (
+	"encoding/json"
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// GameAnalysis is the analysis of a complete game
+type GameAnalysis struct {
+	Headers map[string]string
+	Moves   []MoveAnalysis
+	Options EffectiveOptions // Settings the analysis ran with
+	Summary GameSummary
+	// Adjudication is the predicted result of an unfinished game, see AdjudicatePosition
+	Adjudication *Adjudication
+	// Novelty is the first move that left theory, when analyzed with WithTheory
+	Novelty *Novelty
+	// Opening is the ECO opening the game reached, see ClassifyOpening
+	Opening *GameOpening
+	// Heatmaps show where each side's pieces stood and attacked during the game
+	Heatmaps GameHeatmaps
+	// TimeControl is parsed from the TimeControl tag; nil without one
+	TimeControl *TimeControl
+	// Variations are the analyzed sidelines of the game, when analyzed
+	// WithVariations
+	Variations []Variation
+}
+
+// effectiveOptionsJSON is the JSON representation of EffectiveOptions
+type effectiveOptionsJSON struct {
+	Depth                  int               `json:"depth,omitempty"`
+	MoveTimeMs             int64             `json:"moveTimeMs,omitempty"`
+	Nodes                  int64             `json:"nodes,omitempty"`
+	TimeBudgetMs           int64             `json:"timeBudgetMs,omitempty"`
+	Classifier             string            `json:"classifier"`
+	ClassifierProfile      string            `json:"classifierProfile,omitempty"`
+	EngineTimeoutMs        int64             `json:"engineTimeoutMs"`
+	TimeTroubleThresholdMs int64             `json:"timeTroubleThresholdMs"`
+	MultiPV                int               `json:"multiPV"`
+	ExcludeDeadDraw        bool              `json:"excludeDeadDraw,omitempty"`
+	DepthRetries           int               `json:"depthRetries,omitempty"`
+	VerifyMates            bool              `json:"verifyMates,omitempty"`
+	Contempt               int               `json:"contempt,omitempty"`
+	MustWin                string            `json:"mustWin,omitempty"`
+	Side                   string            `json:"side,omitempty"`
+	EarlyStop              *EarlyStop        `json:"earlyStop,omitempty"`
+	RatedThresholds        []RatedThresholds `json:"ratedThresholds,omitempty"`
+	TimeControlProfiles    map[string]string `json:"timeControlProfiles,omitempty"`
+}
+
+// gameAnalysisJSON is the JSON representation of GameAnalysis
+type gameAnalysisJSON struct {
+	SchemaVersion int                  `json:"schemaVersion"` // See SchemaVersion
+	Headers       map[string]string    `json:"headers"`
+	Moves         []MoveAnalysis       `json:"moves"`
+	Options       effectiveOptionsJSON `json:"options"`
+	Summary       GameSummary          `json:"summary"`
+	Adjudication  *Adjudication        `json:"adjudication,omitempty"`
+	Novelty       *Novelty             `json:"novelty,omitempty"`
+	Opening       *GameOpening         `json:"opening,omitempty"`
+	Heatmaps      GameHeatmaps         `json:"heatmaps"`
+	TimeControl   *TimeControl         `json:"timeControl,omitempty"`
+	Variations    []Variation          `json:"variations,omitempty"`
+}
+
+// MarshalJSON implements custom JSON serialization for GameAnalysis
+func (g *GameAnalysis) MarshalJSON() ([]byte, error) {
+	return json.Marshal(gameAnalysisJSON{
+		SchemaVersion: SchemaVersion,
+		Headers:       g.Headers,
+		Moves:         g.Moves,
+		Options: effectiveOptionsJSON{
+			Depth:                  g.Options.Depth,
+			MoveTimeMs:             g.Options.MoveTime.Milliseconds(),
+			Nodes:                  g.Options.Nodes,
+			TimeBudgetMs:           g.Options.TimeBudget.Milliseconds(),
+			Classifier:             g.Options.Classifier,
+			ClassifierProfile:      g.Options.ClassifierProfile,
+			EngineTimeoutMs:        g.Options.EngineTimeout.Milliseconds(),
+			TimeTroubleThresholdMs: g.Options.TimeTroubleThreshold.Milliseconds(),
+			MultiPV:                g.Options.MultiPV,
+			ExcludeDeadDraw:        g.Options.ExcludeDeadDraw,
+			DepthRetries:           g.Options.DepthRetries,
+			VerifyMates:            g.Options.VerifyMates,
+			Contempt:               g.Options.Contempt,
+			MustWin:                g.Options.MustWin,
+			Side:                   g.Options.Side,
+			EarlyStop:              g.Options.EarlyStop,
+			RatedThresholds:        g.Options.RatedThresholds,
+			TimeControlProfiles:    g.Options.TimeControlProfiles,
+		},
+		Summary:      g.Summary,
+		Adjudication: g.Adjudication,
+		Novelty:      g.Novelty,
+		Opening:      g.Opening,
+		Heatmaps:     g.Heatmaps,
+		TimeControl:  g.TimeControl,
+		Variations:   g.Variations,
+	})
+}
+
+// UnmarshalJSON implements custom JSON deserialization for GameAnalysis,
+// reading JSON of earlier schema versions too, see SchemaVersion
+func (g *GameAnalysis) UnmarshalJSON(data []byte) error {
+	data, err := upgradeSchema("game", gameSchemaUpgrades, data)
+	if err != nil {
+		return err
+	}
+	var v gameAnalysisJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	*g = GameAnalysis{
+		Headers: v.Headers,
+		Moves:   v.Moves,
+		Options: EffectiveOptions{
+			Depth:                v.Options.Depth,
+			MoveTime:             time.Duration(v.Options.MoveTimeMs) * time.Millisecond,
+			Nodes:                v.Options.Nodes,
+			TimeBudget:           time.Duration(v.Options.TimeBudgetMs) * time.Millisecond,
+			Classifier:           v.Options.Classifier,
+			ClassifierProfile:    v.Options.ClassifierProfile,
+			EngineTimeout:        time.Duration(v.Options.EngineTimeoutMs) * time.Millisecond,
+			TimeTroubleThreshold: time.Duration(v.Options.TimeTroubleThresholdMs) * time.Millisecond,
+			MultiPV:              v.Options.MultiPV,
+			ExcludeDeadDraw:      v.Options.ExcludeDeadDraw,
+			DepthRetries:         v.Options.DepthRetries,
+			VerifyMates:          v.Options.VerifyMates,
+			Contempt:             v.Options.Contempt,
+			MustWin:              v.Options.MustWin,
+			Side:                 v.Options.Side,
+			EarlyStop:            v.Options.EarlyStop,
+			RatedThresholds:      v.Options.RatedThresholds,
+			TimeControlProfiles:  v.Options.TimeControlProfiles,
+		},
+		Summary:      v.Summary,
+		Adjudication: v.Adjudication,
+		Novelty:      v.Novelty,
+		Opening:      v.Opening,
+		Heatmaps:     v.Heatmaps,
+		TimeControl:  v.TimeControl,
+		Variations:   v.Variations,
+	}
+	return nil
+}
+
+var pgnHeaderPattern = regexp.MustCompile(`(?m)^\s*\[(\w+)\s+"((?:[^"\\]|\\.)*)"\s*\]`)
+
+// parsePGNHeaders returns the tag pairs of the first game in the PGN
+func parsePGNHeaders(pgn string) map[string]string {
+	headers := make(map[string]string)
+	for _, match := range pgnHeaderPattern.FindAllStringSubmatch(pgn, -1) {
+		if _, seen := headers[match[1]]; seen {
+			// A repeated tag means we've reached the next game
+			break
+		}
+		headers[match[1]] = match[2]
+	}
+	return headers
+}
+
+// MinAnalyzedPlies is the fewest moves a game needs for its analysis to say
+// anything; shorter games get a summary saying there's nothing to analyze
+const MinAnalyzedPlies = 2
+
+// TooShortToAnalyze reports whether the PGN is a game with fewer than
+// MinAnalyzedPlies moves, such as a header-only PGN. Empty and unparseable
+// PGNs are left for the analysis to report.
+func TooShortToAnalyze(pgn string) bool {
+	if strings.TrimSpace(pgn) == "" {
+		return false
+	}
+	validation := validateGame(pgn)
+	return validation.Error == nil && validation.Plies < MinAnalyzedPlies
+}
+
+// NewUnanalyzedGame returns the analysis of a game too short to analyze,
+// holding only its headers, with its summary marked as having nothing to
+// analyze
+func NewUnanalyzedGame(pgn string, options EffectiveOptions) *GameAnalysis {
+	game := NewGameAnalysis(pgn, []MoveAnalysis{}, options)
+	game.Summary.NothingToAnalyze = true
+	return game
+}
+
+// AnalyzeGame analyzes a chess game, returning the per-move analysis along with
+// the game headers. A game whose time budget ran out is returned with the moves
+// analyzed so far and its summary marked as partial, and a game too short to
+// analyze without searching anything, see TooShortToAnalyze.
+func AnalyzeGame(pgn string, opts ...AnalyzeChessGameOption) (*GameAnalysis, error) {
+	analysisOpts, err := ResolveOptions(opts...)
+	if err != nil {
+		return nil, err
+	}
+	if TooShortToAnalyze(pgn) {
+		return NewUnanalyzedGame(pgn, analysisOpts.Effective()), nil
+	}
+	moves, err := AnalyzeChessGame(pgn, opts...)
+	partial := errors.Is(err, ErrTimeBudgetExceeded)
+	if err != nil && !partial {
+		return nil, err
+	}
+	game := NewGameAnalysis(pgn, moves, analysisOpts.Effective())
+	if partial {
+		log.Warn("Time budget ran out, returning a partial analysis", "error", err)
+		game.Summary.Partial = true
+		return game, nil
+	}
+	if analysisOpts.Variations {
+		if game.Variations, err = AnalyzeVariations(pgn, opts...); err != nil {
+			return nil, err
+		}
+	}
+	if analysisOpts.Tablebase != nil {
+		game.refineDeadDraw(analysisOpts.Context, analysisOpts.Tablebase)
+	}
+	if analysisOpts.Theory != nil {
+		game.CheckTheory(analysisOpts.Theory)
+	}
+	if game.Unfinished() {
+		game.Adjudication, err = AdjudicatePosition(game.finalFEN(), opts...)
+		if errors.Is(err, ErrAnalysisCancelled) {
+			return nil, err
+		}
+		if err != nil {
+			log.Warn("Failed to adjudicate unfinished game", "error", err)
+		}
+	}
+	return game, nil
+}
+
+// NewGameAnalysis assembles the analysis of a game from its analyzed moves,
+// e.g. after collecting them from AnalyzeChessGameStreaming
+func NewGameAnalysis(pgn string, moves []MoveAnalysis, options EffectiveOptions) *GameAnalysis {
+	headers := parsePGNHeaders(pgn)
+	summary := Summarize(moves)
+	summary.estimateRatings(headers)
+	game := &GameAnalysis{
+		Headers:  headers,
+		Moves:    moves,
+		Options:  options,
+		Summary:  summary,
+		Opening:  ClassifyOpening(moves),
+		Heatmaps: BuildHeatmaps(moves),
+	}
+	if control, err := ParseTimeControlTag(headers["TimeControl"]); err == nil {
+		game.TimeControl = control
+		if game.Options.ClassifierProfile == "" {
+			game.Options.ClassifierProfile = options.TimeControlProfiles[control.Category.String()]
+		}
+	}
+	game.Options.TimeTroubleThreshold = gameTimeTroubleThreshold(options.TimeTroubleThreshold, headers)
+	if options.ratedThresholds != nil {
+		game.Options.RatedThresholds = options.ratedThresholds(headers)
+	}
+	game.assessOpenings()
+	game.setDeadDraw(summary.DeadDraw)
+	return game
+}
@@ -0,0 +1,36 @@
+package chessanalysis
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestAnalyzeGameTooShort(t *testing.T) {
+	failing := func() (Engine, error) {
+		return nil, errors.New("too short games shouldn't start an engine")
+	}
+	for _, pgn := range []string{
+		"[White \"Player 1\"]\n[Black \"Player 2\"]\n[Result \"*\"]\n\n*",
+		"[White \"Player 1\"]\n[Black \"Player 2\"]\n[Result \"1-0\"]\n\n1. e4 1-0",
+	} {
+		if !TooShortToAnalyze(pgn) {
+			t.Errorf("expected %q to be too short to analyze", pgn)
+		}
+		game, err := AnalyzeGame(pgn, WithEngineFactory(failing))
+		if err != nil {
+			t.Fatalf("failed to analyze %q: %v", pgn, err)
+		}
+		if !game.Summary.NothingToAnalyze || len(game.Moves) != 0 || game.Headers["White"] != "Player 1" || game.Adjudication != nil {
+			t.Errorf("unexpected analysis of %q: %+v", pgn, game)
+		}
+	}
+
+	for _, pgn := range []string{"", "1. e4 e5", "1. e4 Ke3"} {
+		if TooShortToAnalyze(pgn) {
+			t.Errorf("expected %q not to count as too short", pgn)
+		}
+	}
+	if _, err := AnalyzeGame("", WithEngineFactory(failing)); !errors.Is(err, ErrEmptyGame) {
+		t.Errorf("expected an empty PGN to stay an error, got %v", err)
+	}
+}
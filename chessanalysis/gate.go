@@ -0,0 +1,81 @@
+package chessanalysis
+
+import "fmt"
+
+// QualityGate is a set of thresholds a game's play must meet, for checking
+// games automatically, such as those of an engine being tuned or training
+// games to review. Thresholds left nil aren't checked.
+type QualityGate struct {
+	// Color is the side checked, "White" or "Black", or both sides if empty
+	Color       string   `json:"color,omitempty"`
+	MaxBlunders *int     `json:"maxBlunders,omitempty"`
+	MinAccuracy *float64 `json:"minAccuracy,omitempty"` // 0-100
+	MaxACPL     *float64 `json:"maxACPL,omitempty"`     // Average centipawn loss
+}
+
+// GateFailure is a threshold of a QualityGate a side didn't meet
+type GateFailure struct {
+	Color  string  `json:"color"`
+	Check  string  `json:"check"` // The threshold's JSON name, such as "maxBlunders"
+	Limit  float64 `json:"limit"`
+	Actual float64 `json:"actual"`
+	Reason string  `json:"reason"` // The failure in words
+}
+
+// GateResult is whether a game passed a QualityGate, and if not, why
+type GateResult struct {
+	Pass     bool          `json:"pass"`
+	Failures []GateFailure `json:"failures"`
+}
+
+// Validate reports whether the gate's color is one it can check
+func (g QualityGate) Validate() error {
+	switch g.Color {
+	case "", "White", "Black":
+		return nil
+	}
+	return fmt.Errorf("invalid color %q, expected White or Black", g.Color)
+}
+
+// Check evaluates the game's play against the gate. It passes when every
+// side checked meets every threshold set.
+func (g QualityGate) Check(game *GameAnalysis) GateResult {
+	result := GateResult{Failures: []GateFailure{}}
+	for _, side := range []struct {
+		color   string
+		summary *PlayerSummary
+	}{{"White", &game.Summary.White}, {"Black", &game.Summary.Black}} {
+		if g.Color != "" && g.Color != side.color {
+			continue
+		}
+		if g.MaxBlunders != nil && side.summary.Blunders > *g.MaxBlunders {
+			result.Failures = append(result.Failures, GateFailure{
+				Color:  side.color,
+				Check:  "maxBlunders",
+				Limit:  float64(*g.MaxBlunders),
+				Actual: float64(side.summary.Blunders),
+				Reason: fmt.Sprintf("%s made %d blunders, more than the %d allowed", side.color, side.summary.Blunders, *g.MaxBlunders),
+			})
+		}
+		if g.MinAccuracy != nil && side.summary.Accuracy < *g.MinAccuracy {
+			result.Failures = append(result.Failures, GateFailure{
+				Color:  side.color,
+				Check:  "minAccuracy",
+				Limit:  *g.MinAccuracy,
+				Actual: side.summary.Accuracy,
+				Reason: fmt.Sprintf("%s played with %.1f%% accuracy, below the %.1f%% required", side.color, side.summary.Accuracy, *g.MinAccuracy),
+			})
+		}
+		if g.MaxACPL != nil && side.summary.ACPL > *g.MaxACPL {
+			result.Failures = append(result.Failures, GateFailure{
+				Color:  side.color,
+				Check:  "maxACPL",
+				Limit:  *g.MaxACPL,
+				Actual: side.summary.ACPL,
+				Reason: fmt.Sprintf("%s lost %.0f centipawns a move on average, more than the %.0f allowed", side.color, side.summary.ACPL, *g.MaxACPL),
+			})
+		}
+	}
+	result.Pass = len(result.Failures) == 0
+	return result
+}
@@ -0,0 +1,35 @@
+package chessanalysis
+
+import "testing"
+
+func TestQualityGate(t *testing.T) {
+	game := testGame("me", "them", "1-0", "C50", []string{"e4", "e5"}, nil)
+	game.Summary.White.Blunders, game.Summary.White.Accuracy, game.Summary.White.ACPL = 0, 92, 15
+	game.Summary.Black.Blunders, game.Summary.Black.Accuracy, game.Summary.Black.ACPL = 2, 70, 80
+	maxBlunders, minAccuracy, maxACPL := 0, 85.0, 50.0
+
+	if result := (QualityGate{}).Check(game); !result.Pass || len(result.Failures) != 0 {
+		t.Errorf("expected a gate without thresholds to pass, got %+v", result)
+	}
+	gate := QualityGate{MaxBlunders: &maxBlunders, MinAccuracy: &minAccuracy, MaxACPL: &maxACPL}
+	result := gate.Check(game)
+	if result.Pass || len(result.Failures) != 3 {
+		t.Fatalf("expected Black to fail all three thresholds, got %+v", result)
+	}
+	for i, check := range []string{"maxBlunders", "minAccuracy", "maxACPL"} {
+		if failure := result.Failures[i]; failure.Color != "Black" || failure.Check != check {
+			t.Errorf("unexpected failure %+v, expected Black's %s", failure, check)
+		}
+	}
+	if reason := result.Failures[0].Reason; reason != "Black made 2 blunders, more than the 0 allowed" {
+		t.Errorf("unexpected reason %q", reason)
+	}
+
+	gate.Color = "White"
+	if result := gate.Check(game); !result.Pass {
+		t.Errorf("expected White alone to pass, got %+v", result)
+	}
+	if err := (QualityGate{Color: "white"}).Validate(); err == nil {
+		t.Error("expected an error for an unknown color")
+	}
+}
@@ -0,0 +1,153 @@
+package chessanalysis
+
+import (
+	"fmt"
+	"math"
+
+	chess "github.com/corentings/chess/v2"
+)
+
+// GuessMaxPoints is the score for guessing the engine's best move. Other
+// guesses lose a point for every GuessPenalty pawns they are worse than it.
+const (
+	GuessMaxPoints = 10
+	GuessPenalty   = 0.1
+)
+
+// GuessResult is the score of one guess in a guess-the-move session
+type GuessResult struct {
+	MoveNumber int     `json:"moveNumber"`
+	Color      string  `json:"color"`
+	Guess      string  `json:"guess"`  // SAN
+	Played     string  `json:"played"` // The move played in the game
+	Best       string  `json:"best"`   // The engine's best move
+	Loss       float64 `json:"loss"`   // Pawns the guess is worse than the best move, when known
+	Known      bool    `json:"known"`  // Whether the guess was among the scored moves
+	Points     int     `json:"points"`
+	Total      int     `json:"total"`     // Running score
+	MaxTotal   int     `json:"maxTotal"`  // Best possible running score
+	Remaining  int     `json:"remaining"` // Moves left to guess
+}
+
+// GuessSession steps through the moves one side played in an analyzed game,
+// scoring a guess for each against the engine's evaluations. Analyze with a
+// MultiPV above 1 so that good moves other than the best one score points.
+type GuessSession struct {
+	game  *GameAnalysis
+	color string
+	ply   int
+	total int
+	max   int
+}
+
+// NewGuessSession starts guessing the moves of the given color in the game
+func NewGuessSession(game *GameAnalysis, color string) (*GuessSession, error) {
+	if color != "White" && color != "Black" {
+		return nil, fmt.Errorf("invalid color %q", color)
+	}
+	s := &GuessSession{game: game, color: color, ply: -1}
+	s.advance()
+	return s, nil
+}
+
+// advance moves to the next move of the session's color
+func (s *GuessSession) advance() {
+	for s.ply++; s.ply < len(s.game.Moves); s.ply++ {
+		if s.game.Moves[s.ply].Color == s.color {
+			return
+		}
+	}
+}
+
+// Current returns the move to guess next, or nil once the game is over. Its
+// FENBefore is the position to show.
+func (s *GuessSession) Current() *MoveAnalysis {
+	if s.ply >= len(s.game.Moves) {
+		return nil
+	}
+	return &s.game.Moves[s.ply]
+}
+
+// remaining counts the moves left to guess after the current one
+func (s *GuessSession) remaining() int {
+	count := 0
+	for i := s.ply + 1; i < len(s.game.Moves); i++ {
+		if s.game.Moves[i].Color == s.color {
+			count++
+		}
+	}
+	return count
+}
+
+// Guess scores a move, given in SAN or UCI, for the current position and
+// moves on to the next one. Illegal moves return an error without advancing.
+func (s *GuessSession) Guess(guess string) (*GuessResult, error) {
+	move := s.Current()
+	if move == nil {
+		return nil, fmt.Errorf("no moves left to guess")
+	}
+	position, err := positionFromFEN(move.FENBefore)
+	if err != nil {
+		return nil, err
+	}
+	decoded, err := decodeMove(position, guess)
+	if err != nil {
+		return nil, err
+	}
+	uci := moveToUci(position, decoded)
+
+	result := &GuessResult{
+		MoveNumber: move.MoveNumber,
+		Color:      move.Color,
+		Guess:      moveToSan(position, decoded),
+		Played:     move.MoveText,
+		Best:       move.BestMoveSAN,
+	}
+	if score, ok := guessScore(move, uci, result.Guess); ok {
+		// The evaluation before the move is the score of the best move
+		best := move.PreviousWhiteScore
+		if len(move.TopMoves) > 0 {
+			best = move.TopMoves[0].WhiteScore
+		}
+		result.Known = true
+		result.Loss = math.Max(0, best.Pawns()-score.Pawns())
+		if move.Color == "Black" {
+			result.Loss = math.Max(0, score.Pawns()-best.Pawns())
+		}
+		result.Points = max(0, GuessMaxPoints-int(math.Round(result.Loss/GuessPenalty)))
+	}
+
+	s.total += result.Points
+	s.max += GuessMaxPoints
+	result.Total = s.total
+	result.MaxTotal = s.max
+	result.Remaining = s.remaining()
+	s.advance()
+	return result, nil
+}
+
+// guessScore returns White's score after the guessed move, if the analysis
+// evaluated it: as one of the engine's top moves, the best move or the move played
+func guessScore(move *MoveAnalysis, uci, san string) (Score, bool) {
+	for _, top := range move.TopMoves {
+		if top.UCI == uci {
+			return top.WhiteScore, true
+		}
+	}
+	switch {
+	case uci == move.BestMove:
+		return move.PreviousWhiteScore, true
+	case san == move.MoveText:
+		return move.WhiteScore, true
+	}
+	return Score{}, false
+}
+
+// positionFromFEN returns the position described by the FEN
+func positionFromFEN(fen string) (*chess.Position, error) {
+	option, err := chess.FEN(fen)
+	if err != nil {
+		return nil, fmt.Errorf("invalid FEN %q: %w", fen, err)
+	}
+	return chess.NewGame(option).Position(), nil
+}
@@ -0,0 +1,64 @@
+package chessanalysis
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestGuessSession(t *testing.T) {
+	game, err := AnalyzeGame(scholarsMatePgn, WithDepth(3), WithMultiPV(3), WithEngineFactory(scholarsMateEngine().NewEngine))
+	if err != nil {
+		t.Fatalf("failed to analyze game: %v", err)
+	}
+	if _, err := NewGuessSession(game, "Green"); err == nil {
+		t.Error("expected an error for an invalid color")
+	}
+	session, err := NewGuessSession(game, "Black")
+	if err != nil {
+		t.Fatalf("failed to start session: %v", err)
+	}
+	if move := session.Current(); move == nil || move.MoveText != "e5" {
+		t.Fatalf("expected to guess 1... e5 first, got %v", move)
+	}
+	for _, illegal := range []string{"Ke2", "e8e1"} {
+		if _, err := session.Guess(illegal); !errors.Is(err, ErrIllegalMove) {
+			t.Errorf("expected an error for the illegal guess %s, got %v", illegal, err)
+		}
+	}
+	if move := session.Current(); move == nil || move.MoveText != "e5" {
+		t.Fatalf("expected illegal guesses not to advance, got %v", move)
+	}
+
+	// Unscripted positions prefer the first move in UCI order
+	result, err := session.Guess("a7a5")
+	if err != nil {
+		t.Fatalf("failed to guess: %v", err)
+	}
+	if result.Guess != "a5" || result.Points != GuessMaxPoints || result.Remaining != 2 {
+		t.Errorf("unexpected result for the best move: %+v", result)
+	}
+
+	// The second line is an unscripted move half a pawn worse
+	if result, err = session.Guess(game.Moves[3].TopMoves[1].Move); err != nil {
+		t.Fatalf("failed to guess: %v", err)
+	}
+	if !result.Known || result.Points != 5 {
+		t.Errorf("unexpected result for the second line: %+v", result)
+	}
+
+	if result, err = session.Guess("Nf6"); err != nil {
+		t.Fatalf("failed to guess: %v", err)
+	}
+	if result.Played != "Nf6" || result.Best != "g6" || result.Points != 0 || result.Loss != 9 {
+		t.Errorf("unexpected result for the blunder: %+v", result)
+	}
+	if result.Total != 15 || result.MaxTotal != 3*GuessMaxPoints || result.Remaining != 0 {
+		t.Errorf("unexpected running score %d/%d", result.Total, result.MaxTotal)
+	}
+	if session.Current() != nil {
+		t.Error("expected the session to be over")
+	}
+	if _, err := session.Guess("g6"); err == nil {
+		t.Error("expected an error guessing after the last move")
+	}
+}
@@ -0,0 +1,49 @@
+package chessanalysis
+
+import "unicode"
+
+// Heatmap counts, for each square, how often one side occupied or attacked
+// it over the positions of a game. Squares are indexed by rank, with 0 the
+// first rank, then file, with 0 the a-file.
+type Heatmap struct {
+	Occupation [8][8]int `json:"occupation"`
+	Attacks    [8][8]int `json:"attacks"` // Number of the side's pieces attacking the square, summed over positions
+}
+
+// GameHeatmaps are the heatmaps of both sides of a game
+type GameHeatmaps struct {
+	White Heatmap `json:"white"`
+	Black Heatmap `json:"black"`
+}
+
+// add includes a position in both sides' heatmaps
+func (h *GameHeatmaps) add(fen string) {
+	b := parseBoard(fen)
+	for rank := 0; rank < 8; rank++ {
+		for file := 0; file < 8; file++ {
+			if piece := b[rank][file]; piece != 0 {
+				if unicode.IsUpper(piece) {
+					h.White.Occupation[rank][file]++
+				} else {
+					h.Black.Occupation[rank][file]++
+				}
+			}
+			h.White.Attacks[rank][file] += len(b.attackers(rank, file, true))
+			h.Black.Attacks[rank][file] += len(b.attackers(rank, file, false))
+		}
+	}
+}
+
+// BuildHeatmaps counts the occupied and attacked squares in every position of
+// the game, from the position before the first move to the final one
+func BuildHeatmaps(moves []MoveAnalysis) GameHeatmaps {
+	var heatmaps GameHeatmaps
+	if len(moves) == 0 {
+		return heatmaps
+	}
+	heatmaps.add(moves[0].FENBefore)
+	for i := range moves {
+		heatmaps.add(moves[i].FENAfter)
+	}
+	return heatmaps
+}
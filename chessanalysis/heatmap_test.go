@@ -0,0 +1,33 @@
+package chessanalysis
+
+import "testing"
+
+func TestBuildHeatmaps(t *testing.T) {
+	moves := []MoveAnalysis{{
+		FENBefore: "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1",
+		FENAfter:  "rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq e3 0 1",
+	}}
+	heatmaps := BuildHeatmaps(moves)
+
+	if got := heatmaps.White.Occupation[1][4]; got != 1 {
+		t.Errorf("expected e2 occupied once, got %d", got)
+	}
+	if got := heatmaps.White.Occupation[3][4]; got != 1 {
+		t.Errorf("expected e4 occupied once, got %d", got)
+	}
+	if got := heatmaps.Black.Occupation[7][4]; got != 2 {
+		t.Errorf("expected Black's king on e8 twice, got %d", got)
+	}
+	// f3 is attacked by the e2 and g2 pawns and the knight, then by the g2
+	// pawn, the knight and the queen once 1. e4 opens its diagonal
+	if got := heatmaps.White.Attacks[2][5]; got != 6 {
+		t.Errorf("expected 6 attacks on f3, got %d", got)
+	}
+	if got := heatmaps.Black.Attacks[2][5]; got != 0 {
+		t.Errorf("expected no black attacks on f3, got %d", got)
+	}
+
+	if empty := BuildHeatmaps(nil); empty != (GameHeatmaps{}) {
+		t.Error("expected empty heatmaps without moves")
+	}
+}
@@ -0,0 +1,316 @@
+package chessanalysis
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/bits"
+	"slices"
+	"strings"
+	"time"
+
+	chess "github.com/corentings/chess/v2"
+	"github.com/walterschell/chess-analyzer/chessanalysis/uciengine"
+)
+
+// HeuristicEngineName is the name the heuristic evaluator reports, see
+// DescribeEngine
+const HeuristicEngineName = "Heuristic evaluator"
+
+// heuristicPieceValues are the centipawns each piece is worth, in the order of
+// Board.MarshalBinary: king, queen, rook, bishop, knight, pawn
+var heuristicPieceValues = [6]int{0, 900, 500, 330, 320, 100}
+
+// heuristicMobility is the centipawns each square a piece attacks is worth
+const heuristicMobility = 4
+
+// heuristicCaptureDepth is how many captures deep the heuristic evaluator
+// follows exchanges after each move
+const heuristicCaptureDepth = 4
+
+// heuristicMate is the score of being checkmated, beyond any material score
+const heuristicMate = 1_000_000
+
+// HeuristicEngine is a static evaluator for when no UCI engine can be started.
+// It counts material and the squares the pieces attack, and follows each move
+// with the exchanges it starts, so it sees hanging pieces and mates in one but
+// little else. Its evaluations are rough, and analyses mark the moves it
+// searched as Heuristic.
+type HeuristicEngine struct{}
+
+// NewHeuristicEngine starts a heuristic evaluator, which can't fail
+func NewHeuristicEngine() (Engine, error) {
+	return HeuristicEngine{}, nil
+}
+
+// HeuristicFallback wraps factory so that an engine that fails to start is
+// replaced by a HeuristicEngine, keeping analyses going without one
+func HeuristicFallback(factory EngineFactory) EngineFactory {
+	return func() (Engine, error) {
+		engine, err := factory()
+		if err != nil {
+			log.Warn("Can't start the engine, falling back to heuristic evaluation", "error", err)
+			return NewHeuristicEngine()
+		}
+		return engine, nil
+	}
+}
+
+// IsHeuristic reports whether the engine is a HeuristicEngine
+func IsHeuristic(engine Engine) bool {
+	if pooled, ok := engine.(*pooledEngine); ok {
+		engine = pooled.Engine
+	}
+	_, ok := engine.(HeuristicEngine)
+	return ok
+}
+
+// Info describes the evaluator, which has no options
+func (HeuristicEngine) Info() EngineInfo {
+	return EngineInfo{Name: HeuristicEngineName, Options: []EngineOption{}}
+}
+
+// AnalyzeLastMove evaluates the last of the moves against every other move of
+// the position before it
+func (e HeuristicEngine) AnalyzeLastMove(moves []string, limits SearchLimits) (*AnalysisResult, error) {
+	if len(moves) == 0 {
+		return nil, fmt.Errorf("no moves provided")
+	}
+	position := chess.StartingPosition()
+	for _, uci := range moves[:len(moves)-1] {
+		move, err := chess.UCINotation{}.Decode(position, uci)
+		if err != nil {
+			return nil, fmt.Errorf("invalid move %q: %w", uci, err)
+		}
+		position = position.Update(move)
+	}
+	return e.search(position, moves[len(moves)-1], limits)
+}
+
+// AnalyzePosition evaluates the position given as a FEN by its best move
+func (e HeuristicEngine) AnalyzePosition(fen string, limits SearchLimits) (*AnalysisResult, error) {
+	position, err := positionFromFEN(fen)
+	if err != nil {
+		return nil, err
+	}
+	return e.search(position, "", limits)
+}
+
+// Close does nothing, as there is no process to stop
+func (HeuristicEngine) Close() error {
+	return nil
+}
+
+// heuristicLine is a move with its score from the mover's perspective and
+// the exchange expected after it
+type heuristicLine struct {
+	move  string
+	score Score
+	line  []string
+}
+
+// search scores every move of the position, reporting the played move if
+// one is given and the best move otherwise
+func (HeuristicEngine) search(position *chess.Position, played string, limits SearchLimits) (*AnalysisResult, error) {
+	start := time.Now()
+	var nodes int64
+	moves := position.ValidMoves()
+	if len(moves) == 0 {
+		// No legal moves: report the terminal position the way Stockfish does
+		result := &AnalysisResult{}
+		if position.Status() == chess.Checkmate {
+			result.WhiteScore = uciengine.Mated()
+			if position.Turn() == chess.Black {
+				result.WhiteScore = result.WhiteScore.Negate()
+			}
+		}
+		result.BestMoveWhiteScore = result.WhiteScore
+		result.WhiteWinProb, result.WhiteDrawProb, result.WhiteLossProb = scoreWDL(result.WhiteScore)
+		result.BestMoveWhiteWinProb, result.BestMoveWhiteDrawProb, result.BestMoveWhiteLossProb = scoreWDL(result.WhiteScore)
+		return result, nil
+	}
+
+	lines := make([]heuristicLine, 0, len(moves))
+	for i := range moves {
+		uci := moveToUci(position, &moves[i])
+		after := position.Update(&moves[i])
+		score, reply := quiesce(after, heuristicCaptureDepth, &nodes)
+		line := heuristicLine{move: uci, line: append([]string{uci}, reply...)}
+		switch {
+		case -score >= heuristicMate/2:
+			line.score = uciengine.MateIn(1)
+		case -score <= -heuristicMate/2:
+			line.score = uciengine.MateIn(-1)
+		default:
+			line.score = uciengine.Centipawns(-score)
+		}
+		lines = append(lines, line)
+	}
+	slices.SortStableFunc(lines, func(a, b heuristicLine) int {
+		if c := b.score.Compare(a.score); c != 0 {
+			return c
+		}
+		return strings.Compare(a.move, b.move)
+	})
+
+	best := lines[0]
+	if played == "" {
+		played = best.move
+	}
+	i := slices.IndexFunc(lines, func(line heuristicLine) bool { return line.move == played })
+	if i < 0 {
+		return nil, fmt.Errorf("illegal move %q", played)
+	}
+	playedLine := lines[i]
+
+	// Scores are from the mover's perspective
+	whiteScore, bestWhiteScore := playedLine.score, best.score
+	if position.Turn() == chess.Black {
+		whiteScore, bestWhiteScore = whiteScore.Negate(), bestWhiteScore.Negate()
+	}
+	spent := time.Since(start)
+	result := &AnalysisResult{
+		WhiteScore:         whiteScore,
+		BestMove:           best.move,
+		BestMoveWhiteScore: bestWhiteScore,
+		Depth:              1,
+		SelDepth:           len(playedLine.line),
+		Nodes:              nodes,
+		TimeSpent:          spent,
+		PlayedLine:         playedLine.line,
+		BestLine:           best.line,
+	}
+	if spent > 0 {
+		result.NPS = int64(float64(nodes) / spent.Seconds())
+	}
+	result.WhiteWinProb, result.WhiteDrawProb, result.WhiteLossProb = scoreWDL(whiteScore)
+	result.BestMoveWhiteWinProb, result.BestMoveWhiteDrawProb, result.BestMoveWhiteLossProb = scoreWDL(bestWhiteScore)
+	for _, line := range lines[:min(max(limits.MultiPV, 1), len(lines))] {
+		result.TopMoves = append(result.TopMoves, line.move)
+		result.TopScores = append(result.TopScores, line.score)
+		result.TopLines = append(result.TopLines, line.line)
+	}
+	return result, nil
+}
+
+// quiesce scores the position from the side to move's perspective, following
+// captures up to depth plies deep, and returns the captures it expects. The
+// side to move may always decline to capture.
+func quiesce(position *chess.Position, depth int, nodes *int64) (int, []string) {
+	*nodes++
+	moves := position.ValidMoves()
+	if len(moves) == 0 {
+		if position.Status() == chess.Checkmate {
+			return -heuristicMate, nil
+		}
+		return 0, nil
+	}
+	best := heuristicEval(position.Board())
+	if position.Turn() == chess.Black {
+		best = -best
+	}
+	var line []string
+	if depth == 0 {
+		return best, nil
+	}
+	for i := range moves {
+		if !moves[i].HasTag(chess.Capture) && !moves[i].HasTag(chess.EnPassant) {
+			continue
+		}
+		score, reply := quiesce(position.Update(&moves[i]), depth-1, nodes)
+		if -score > best {
+			best = -score
+			line = append([]string{moveToUci(position, &moves[i])}, reply...)
+		}
+	}
+	return best, line
+}
+
+// heuristicEval scores the board from White's perspective by its material
+// and the squares each side's pieces attack
+func heuristicEval(board *chess.Board) int {
+	data, err := board.MarshalBinary()
+	if err != nil {
+		return 0
+	}
+	// Bitboards of White's pieces come first, then Black's, with the bit of
+	// square s at 63 - s
+	var pieces [12]uint64
+	var white, black uint64
+	for i := range pieces {
+		pieces[i] = binary.BigEndian.Uint64(data[8*i:])
+		if i < 6 {
+			white |= pieces[i]
+		} else {
+			black |= pieces[i]
+		}
+	}
+	occupied := white | black
+
+	score := 0
+	for i, bb := range pieces {
+		kind := i % 6
+		sign, own := 1, white
+		if i >= 6 {
+			sign, own = -1, black
+		}
+		score += sign * heuristicPieceValues[kind] * bits.OnesCount64(bb)
+		directions := heuristicMoves[kind]
+		if len(directions) == 0 {
+			continue
+		}
+		for bb != 0 {
+			square := bits.LeadingZeros64(bb)
+			bb &^= 1 << (63 - square)
+			attacks := heuristicAttacks(square, directions, kind != heuristicKnight, occupied) &^ own
+			score += sign * heuristicMobility * bits.OnesCount64(attacks)
+		}
+	}
+	return score
+}
+
+// heuristicKnight is the knight's place in heuristicPieceValues
+const heuristicKnight = 4
+
+var (
+	heuristicStraight = [][2]int{{1, 0}, {-1, 0}, {0, 1}, {0, -1}}
+	heuristicDiagonal = [][2]int{{1, 1}, {1, -1}, {-1, 1}, {-1, -1}}
+)
+
+// heuristicMoves are the file and rank steps each piece attacks along, in
+// the order of heuristicPieceValues. Kings and pawns aren't counted for
+// mobility.
+var heuristicMoves = [6][][2]int{
+	nil,
+	append(slices.Clone(heuristicStraight), heuristicDiagonal...),
+	heuristicStraight,
+	heuristicDiagonal,
+	{{1, 2}, {2, 1}, {2, -1}, {1, -2}, {-1, -2}, {-2, -1}, {-2, 1}, {-1, 2}},
+	nil,
+}
+
+// heuristicAttacks returns the squares a piece on the square attacks taking
+// the steps, repeating them until blocked if it slides, as a bitboard
+func heuristicAttacks(square int, steps [][2]int, slides bool, occupied uint64) uint64 {
+	var attacks uint64
+	for _, step := range steps {
+		file, rank := square%8, square/8
+		for {
+			file, rank = file+step[0], rank+step[1]
+			if file < 0 || file > 7 || rank < 0 || rank > 7 {
+				break
+			}
+			bit := uint64(1) << (63 - (8*rank + file))
+			attacks |= bit
+			if !slides || occupied&bit != 0 {
+				break
+			}
+		}
+	}
+	return attacks
+}
+
+// Heuristic reports whether any move of the game was evaluated by a
+// HeuristicEngine, making the analysis a rough one
+func (g *GameAnalysis) Heuristic() bool {
+	return slices.ContainsFunc(g.Moves, func(move MoveAnalysis) bool { return move.Heuristic })
+}
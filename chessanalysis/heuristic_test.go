@@ -0,0 +1,92 @@
+package chessanalysis
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/walterschell/chess-analyzer/chessanalysis/uciengine"
+)
+
+func TestHeuristicEval(t *testing.T) {
+	start, err := positionFromFEN("rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if score := heuristicEval(start.Board()); score != 0 {
+		t.Errorf("expected the starting position even, got %d", score)
+	}
+	// White is a rook up, and its rook attacks the open file and rank
+	rookUp, err := positionFromFEN("4k3/8/8/8/8/8/8/R3K3 w - - 0 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if score := heuristicEval(rookUp.Board()); score != 500+heuristicMobility*10 {
+		t.Errorf("expected a rook and its 10 squares for White, got %d", score)
+	}
+}
+
+func TestHeuristicEngine(t *testing.T) {
+	engine, err := NewHeuristicEngine()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info, ok := DescribeEngine(engine); !ok || info.Name != HeuristicEngineName {
+		t.Errorf("expected the heuristic evaluator to describe itself, got %+v", info)
+	}
+
+	// Black's queen hangs to the knight
+	result, err := engine.AnalyzePosition("4k3/8/8/3q4/8/4N3/8/4K3 w - - 0 1", SearchLimits{MultiPV: 3})
+	if err != nil {
+		t.Fatalf("failed to analyze position: %v", err)
+	}
+	if result.BestMove != "e3d5" || result.WhiteScore.CP() < 300 || len(result.TopMoves) != 3 {
+		t.Errorf("expected Nxd5 winning the queen, got %s at %s with %v", result.BestMove, result.WhiteScore, result.TopMoves)
+	}
+
+	// Black takes the queen White left en prise
+	result, err = engine.AnalyzeLastMove([]string{"e2e4", "d7d5", "d1g4", "c8g4"}, SearchLimits{})
+	if err != nil {
+		t.Fatalf("failed to analyze moves: %v", err)
+	}
+	if result.WhiteScore.CP() > -700 || result.BestMove != "c8g4" {
+		t.Errorf("expected Bxg4 best for Black at a queen up, got %s at %s", result.BestMove, result.WhiteScore)
+	}
+
+	// Fool's mate is found as a mate in one
+	result, err = engine.AnalyzeLastMove([]string{"f2f3", "e7e5", "g2g4", "a7a6"}, SearchLimits{})
+	if err != nil {
+		t.Fatalf("failed to analyze moves: %v", err)
+	}
+	if result.BestMove != "d8h4" || result.BestMoveWhiteScore != uciengine.MateIn(-1) {
+		t.Errorf("expected Qh4# missed, got %s at %s", result.BestMove, result.BestMoveWhiteScore)
+	}
+
+	var update KibitzUpdate
+	if err := Kibitz(context.Background(), engine, "4k3/8/8/3q4/8/4N3/8/4K3 w - - 0 1", SearchLimits{}, func(u KibitzUpdate) { update = u }); err != nil {
+		t.Fatalf("failed to kibitz: %v", err)
+	}
+	if !update.Heuristic || update.BestMove != "Nxd5" {
+		t.Errorf("expected a heuristic kibitz of Nxd5, got %+v", update)
+	}
+}
+
+func TestHeuristicFallback(t *testing.T) {
+	missing := func() (Engine, error) { return nil, errors.New("stockfish not found") }
+	if _, err := AnalyzeChessGame(scholarsMatePgn, WithEngineFactory(missing)); err == nil {
+		t.Fatal("expected the analysis to fail without an engine")
+	}
+
+	analyzed, err := AnalyzeGame(scholarsMatePgn, WithEngineFactory(HeuristicFallback(missing)))
+	if err != nil {
+		t.Fatalf("failed to analyze game: %v", err)
+	}
+	if !analyzed.Heuristic() {
+		t.Error("expected the game analyzed heuristically")
+	}
+	for _, move := range analyzed.Moves {
+		if checkmate := move.TerminalStatus != ""; move.Heuristic == checkmate || !move.Evaluated() || move.BestMove == "" {
+			t.Errorf("expected %s evaluated heuristically, got %+v", MoveLabel(&move), move)
+		}
+	}
+}
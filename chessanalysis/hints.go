@@ -0,0 +1,135 @@
+package chessanalysis
+
+import (
+	"unicode"
+
+	chess "github.com/corentings/chess/v2"
+)
+
+// MoveHints are visualization hints for a move, so that boards showing it
+// don't have to derive them from the FENs and lines
+type MoveHints struct {
+	// Played is the move played
+	Played *BoardArrow `json:"played,omitempty"`
+	// BestMove is the engine's best move in the position before the move,
+	// unless the move played was the best
+	BestMove *BoardArrow `json:"bestMove,omitempty"`
+	// Refutation is an arrow for each ply of MoveAnalysis.Refutation,
+	// played from the position after the move
+	Refutation []BoardArrow `json:"refutation,omitempty"`
+	// Hanging are the squares of pieces of either side left hanging after the
+	// move: attacked and either undefended or attacked by a less valuable piece
+	Hanging []string `json:"hanging,omitempty"`
+}
+
+// moveHints derives the visualization hints for an analyzed move
+func moveHints(move *MoveAnalysis) MoveHints {
+	var hints MoveHints
+	if played := playedMoveUCI(move); played != "" {
+		hints.Played = &BoardArrow{From: played[0:2], To: played[2:4], Color: LastMoveArrowColor}
+	}
+	if move.BestMove != "" && !move.IsBestMove && len(move.BestMove) >= 4 {
+		hints.BestMove = &BoardArrow{From: move.BestMove[0:2], To: move.BestMove[2:4], Color: BestMoveArrowColor}
+	}
+	if position, err := positionFromFEN(move.FENAfter); err == nil {
+		for _, san := range move.Refutation {
+			reply, err := chess.AlgebraicNotation{}.Decode(position, san)
+			if err != nil {
+				break
+			}
+			uci := moveToUci(position, reply)
+			hints.Refutation = append(hints.Refutation, BoardArrow{From: uci[0:2], To: uci[2:4], Color: RefutationArrowColor})
+			position = position.Update(reply)
+		}
+	}
+	if move.FENAfter != "" {
+		b := parseBoard(move.FENAfter)
+		hints.Hanging = b.hangingSquares()
+	}
+	return hints
+}
+
+// pieceValues are the conventional material values of the pieces by uppercase letter
+var pieceValues = map[rune]int{'P': 1, 'N': 3, 'B': 3, 'R': 5, 'Q': 9, 'K': 100}
+
+// knightOffsets and kingOffsets are the rank and file steps of those pieces
+var (
+	knightOffsets = [][2]int{{1, 2}, {2, 1}, {2, -1}, {1, -2}, {-1, -2}, {-2, -1}, {-2, 1}, {-1, 2}}
+	kingOffsets   = [][2]int{{1, 0}, {1, 1}, {0, 1}, {-1, 1}, {-1, 0}, {-1, -1}, {0, -1}, {1, -1}}
+)
+
+// attackers returns the letters of the white or black pieces attacking a square
+func (b *board) attackers(rank, file int, white bool) []rune {
+	own := func(piece rune) bool {
+		return piece != 0 && unicode.IsUpper(piece) == white
+	}
+	at := func(r, f int) rune {
+		if r < 0 || r > 7 || f < 0 || f > 7 {
+			return 0
+		}
+		return b[r][f]
+	}
+
+	var found []rune
+	// Pawns attack diagonally forward, so look one rank behind the square
+	pawnRank := rank - 1
+	if !white {
+		pawnRank = rank + 1
+	}
+	for _, f := range []int{file - 1, file + 1} {
+		if piece := at(pawnRank, f); own(piece) && unicode.ToUpper(piece) == 'P' {
+			found = append(found, piece)
+		}
+	}
+	for _, offset := range knightOffsets {
+		if piece := at(rank+offset[0], file+offset[1]); own(piece) && unicode.ToUpper(piece) == 'N' {
+			found = append(found, piece)
+		}
+	}
+	for _, offset := range kingOffsets {
+		if piece := at(rank+offset[0], file+offset[1]); own(piece) && unicode.ToUpper(piece) == 'K' {
+			found = append(found, piece)
+		}
+		// Slide until the first piece, which attacks if it moves along this line
+		diagonal := offset[0] != 0 && offset[1] != 0
+		for r, f := rank+offset[0], file+offset[1]; r >= 0 && r <= 7 && f >= 0 && f <= 7; r, f = r+offset[0], f+offset[1] {
+			piece := b[r][f]
+			if piece == 0 {
+				continue
+			}
+			upper := unicode.ToUpper(piece)
+			if own(piece) && (upper == 'Q' || (diagonal && upper == 'B') || (!diagonal && upper == 'R')) {
+				found = append(found, piece)
+			}
+			break
+		}
+	}
+	return found
+}
+
+// hangingSquares returns the squares of pieces other than kings that are
+// attacked and either undefended or attacked by a less valuable piece
+func (b *board) hangingSquares() []string {
+	var squares []string
+	for rank := 0; rank < 8; rank++ {
+		for file := 0; file < 8; file++ {
+			piece := b[rank][file]
+			if piece == 0 || unicode.ToUpper(piece) == 'K' {
+				continue
+			}
+			white := unicode.IsUpper(piece)
+			attackers := b.attackers(rank, file, !white)
+			if len(attackers) == 0 {
+				continue
+			}
+			cheapest := pieceValues['K']
+			for _, attacker := range attackers {
+				cheapest = min(cheapest, pieceValues[unicode.ToUpper(attacker)])
+			}
+			if len(b.attackers(rank, file, white)) == 0 || cheapest < pieceValues[unicode.ToUpper(piece)] {
+				squares = append(squares, string(rune('a'+file))+string(rune('1'+rank)))
+			}
+		}
+	}
+	return squares
+}
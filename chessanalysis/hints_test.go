@@ -0,0 +1,54 @@
+package chessanalysis
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestHangingSquares(t *testing.T) {
+	tests := []struct {
+		name string
+		fen  string
+		want []string
+	}{
+		{"starting position", "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", nil},
+		// The d5 pawn is defended by the queen but not the e4 pawn
+		{"undefended pawn", "rnbqkbnr/ppp1pppp/8/3p4/4P3/8/PPPP1PPP/RNBQKBNR w KQkq - 0 2", []string{"e4"}},
+		// The knight is defended but attacked by a pawn
+		{"attacked by a pawn", "4k3/8/8/3p4/4N3/8/8/4KR2 w - - 0 1", []string{"e4"}},
+		// The bishop attacks the undefended rook, which can't attack it back
+		{"undefended rook", "4k3/8/8/8/8/8/1b6/R3K3 w - - 0 1", []string{"a1"}},
+		// The rook attacks the queen and is defended through the empty d-file
+		{"defended by a slider", "3qk3/8/8/8/8/8/3r4/3QK3 w - - 0 1", []string{"d1"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			b := parseBoard(test.fen)
+			if got := b.hangingSquares(); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("expected %v, got %v", test.want, got)
+			}
+		})
+	}
+}
+
+func TestMoveHints(t *testing.T) {
+	moves, err := AnalyzeChessGame(scholarsMatePgn, WithDepth(3), WithEngineFactory(scholarsMateEngine().NewEngine))
+	if err != nil {
+		t.Fatalf("failed to analyze game: %v", err)
+	}
+	hints := moves[5].Hints
+	want := MoveHints{
+		Played:     &BoardArrow{From: "g8", To: "f6", Color: LastMoveArrowColor},
+		BestMove:   &BoardArrow{From: "g7", To: "g6", Color: BestMoveArrowColor},
+		Refutation: []BoardArrow{{From: "h5", To: "f7", Color: RefutationArrowColor}},
+		Hanging:    []string{"e4", "h5"},
+	}
+	if !reflect.DeepEqual(hints, want) {
+		got, _ := json.Marshal(hints)
+		t.Errorf("unexpected hints for 3... Nf6: %s", got)
+	}
+	if moves[6].Hints.BestMove != nil {
+		t.Error("expected no best move arrow for the best move")
+	}
+}
@@ -0,0 +1,55 @@
+package chessanalysis
+
+// centipawnLossBucketBounds are the upper bounds of the centipawn loss
+// histogram buckets. The last bucket holds everything up to maxCentipawnLoss.
+var centipawnLossBucketBounds = []float64{10, 25, 50, 100, 200, 500}
+
+// HistogramBucket counts the values in [Min, Max). The last bucket of a
+// histogram also includes its Max.
+type HistogramBucket struct {
+	Min   float64 `json:"min"`
+	Max   float64 `json:"max"`
+	Count int     `json:"count"`
+}
+
+// newCentipawnLossHistogram returns empty centipawn loss buckets
+func newCentipawnLossHistogram() []HistogramBucket {
+	histogram := make([]HistogramBucket, 0, len(centipawnLossBucketBounds)+1)
+	lower := 0.0
+	for _, upper := range centipawnLossBucketBounds {
+		histogram = append(histogram, HistogramBucket{Min: lower, Max: upper})
+		lower = upper
+	}
+	return append(histogram, HistogramBucket{Min: lower, Max: maxCentipawnLoss})
+}
+
+// addToHistogram counts a value in the bucket that holds it
+func addToHistogram(histogram []HistogramBucket, value float64) {
+	for i := range histogram {
+		if value < histogram[i].Max || i == len(histogram)-1 {
+			histogram[i].Count++
+			return
+		}
+	}
+}
+
+// AggregateSummary combines the named player's move quality over a batch of
+// games, including the centipawn loss histogram. The estimated rating is the
+// move-weighted mean of the per-game estimates.
+func AggregateSummary(games []*GameAnalysis, player string) PlayerSummary {
+	var summary PlayerSummary
+	for _, game := range games {
+		color := game.PlayerColor(player)
+		if color == "" {
+			continue
+		}
+		for i := range game.Moves {
+			if game.Moves[i].Color == color {
+				summary.record(&game.Moves[i])
+			}
+		}
+	}
+	summary.complete()
+	summary.EstimatedRating = EstimatePlayerRating(games, player).Rating
+	return summary
+}
@@ -0,0 +1,45 @@
+package chessanalysis
+
+import "testing"
+
+func TestCentipawnLossHistogram(t *testing.T) {
+	moves := []MoveAnalysis{
+		{Color: "White", CentipawnLoss: 0},
+		{Color: "Black", CentipawnLoss: 30},
+		{Color: "White", CentipawnLoss: 9.9},
+		{Color: "Black", CentipawnLoss: maxCentipawnLoss},
+		{Color: "White", CentipawnLoss: 150},
+	}
+	summary := Summarize(moves)
+
+	white := summary.White.CentipawnLossHistogram
+	if len(white) != len(centipawnLossBucketBounds)+1 {
+		t.Fatalf("expected %d buckets, got %d", len(centipawnLossBucketBounds)+1, len(white))
+	}
+	if white[0].Min != 0 || white[0].Max != 10 || white[0].Count != 2 || white[4].Count != 1 {
+		t.Errorf("unexpected White histogram %+v", white)
+	}
+	black := summary.Black.CentipawnLossHistogram
+	if black[2].Count != 1 || black[len(black)-1].Count != 1 || black[len(black)-1].Max != maxCentipawnLoss {
+		t.Errorf("unexpected Black histogram %+v", black)
+	}
+
+	if empty := Summarize(nil); len(empty.White.CentipawnLossHistogram) != len(white) {
+		t.Errorf("expected empty buckets for a player without moves, got %+v", empty.White.CentipawnLossHistogram)
+	}
+}
+
+func TestAggregateSummary(t *testing.T) {
+	first := testGame("me", "them", "1-0", "C50", []string{"e4", "e5"}, map[int]MoveClassification{1: Blunder})
+	first.Moves[0].CentipawnLoss = 60
+	second := testGame("them", "me", "0-1", "C50", []string{"e4", "e5"}, map[int]MoveClassification{1: Blunder})
+	second.Moves[1].CentipawnLoss = 300
+
+	summary := AggregateSummary([]*GameAnalysis{first, second}, "me")
+	if summary.Moves != 2 || summary.Blunders != 1 || summary.ACPL != 180 {
+		t.Errorf("unexpected aggregate %+v", summary)
+	}
+	if summary.CentipawnLossHistogram[3].Count != 1 || summary.CentipawnLossHistogram[5].Count != 1 {
+		t.Errorf("unexpected aggregate histogram %+v", summary.CentipawnLossHistogram)
+	}
+}
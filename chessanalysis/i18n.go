@@ -0,0 +1,117 @@
+package chessanalysis
+
+import "fmt"
+
+// Translations maps message IDs, such as "classification.Blunder", to their
+// text in a language. Texts with arguments are fmt formats, which may use
+// explicit argument indexes such as %[2]s to reorder them. Messages missing
+// from a translation fall back to EnglishMessages.
+type Translations map[string]string
+
+// EnglishMessages are the texts of every message ID, and the template for
+// translations. JSON keeps classifications by their English name, which
+// frontends look up as "classification." followed by the name.
+var EnglishMessages = Translations{
+	"classification.Neutral":      "Neutral",
+	"classification.Blunder":      "Blunder",
+	"classification.Questionable": "Questionable",
+	"classification.Good":         "Good",
+	"classification.Excellent":    "Excellent",
+	"classification.Winning":      "Winning",
+	"classification.Best":         "Best",
+	"classification.Brilliant":    "Brilliant",
+	"classification.Book":         "Book",
+	"classification.Forced":       "Forced",
+
+	"markdown.title":             "Game analysis",
+	"markdown.players":           "%s vs %s",
+	"markdown.partial":           "Partial analysis: the time budget ran out after %d moves.",
+	"markdown.nothingToAnalyze":  "Nothing to analyze: the game has fewer than %d moves.",
+	"markdown.heuristic":         "Heuristic only: no engine could be started, so the moves were evaluated by material and mobility alone.",
+	"markdown.tag":               "Tag",
+	"markdown.value":             "Value",
+	"markdown.white":             "White",
+	"markdown.black":             "Black",
+	"markdown.accuracy":          "Accuracy",
+	"markdown.acpl":              "ACPL",
+	"markdown.bestMoveAgreement": "Best move agreement",
+	"markdown.expectedPoints":    "Expected points",
+	"markdown.threwAway":         "%s threw away %.1f expected points in the %s",
+	"markdown.accuracyByPhase":   "Accuracy by phase",
+	"markdown.deadDraw":          "The game was a dead draw after **%s**: the last %d moves were a formality.",
+	"markdown.estimatedRating":   "Estimated rating",
+	"markdown.ratingPrior":       "Rating tag",
+	"markdown.moveQualityRating": "Rating shown by the moves",
+	"markdown.leftBook":          "Left book",
+	"markdown.criticalMoments":   "Critical moments",
+	"markdown.bestWas":           ", best was %s",
+	"markdown.missedMate":        ", missing mate in %d",
+	"markdown.practicalTry":      ", best practical try was %s",
+	"markdown.position":          "position",
+	"markdown.none":              "None",
+	"markdown.sacrifices":        "Sacrifices",
+	"markdown.sacrifice":         "**%s** gives up %d pawns of material",
+	"markdown.missedSacrifice":   "**%s** missed the sacrifice %s, giving up %d pawns of material",
+	"markdown.resourcefulness":   "Lost positions saved",
+	"markdown.swindles":          "Swindles",
+	"markdown.swindle":           "**%s** let %s back into the game, from %.0f%% to %.0f%%",
+	"markdown.missedDraws":       "Missed draws",
+	"markdown.missedDraw":        "**%s** left the game lost, missing a draw by %s with %s",
+	"markdown.practicalChances":  "Practical chances",
+	"markdown.mustWin":           "%s had to win, and ended the game with %.0f%% winning chances.\n",
+	"markdown.practicalMistake":  "**%s** cost %.0f points of winning chances, leaving %.0f%%",
+	"markdown.transposition":     "The game transposed into the **%s %s** with %s.",
+	"markdown.nominalOpening":    " Its moves began as the %s %s.",
+	"markdown.openingQuality":    "Out of the opening",
+	"markdown.leftBookWith":      "%s left the book with **%s** at %s",
+	"markdown.emergedWith":       "%s came out of the opening with **%s** at %s",
+	"markdown.firstInaccuracy":   "; the first mistake of the opening was **%s** (-%.0f cp)",
+	"markdown.keptRepertoire":    "; kept to the repertoire",
+	"markdown.leftRepertoire":    "; left the repertoire",
+
+	"missedDraw.repetition": "repetition",
+	"missedDraw.fiftyMove":  "the fifty-move rule",
+	"missedDraw.stalemate":  "stalemate",
+	"missedDraw.fortress":   "a fortress",
+
+	"phase.Opening":    "opening",
+	"phase.Middlegame": "middlegame",
+	"phase.Endgame":    "endgame",
+
+	"phaseTitle.Opening":    "Opening",
+	"phaseTitle.Middlegame": "Middlegame",
+	"phaseTitle.Endgame":    "Endgame",
+}
+
+// Text returns the message with the ID, formatted with the arguments, in the
+// translation or else in English
+func (t Translations) Text(id string, args ...any) string {
+	format, ok := t[id]
+	if !ok {
+		format = EnglishMessages[id]
+	}
+	if len(args) == 0 {
+		return format
+	}
+	return fmt.Sprintf(format, args...)
+}
+
+// Classification returns the label of the classification
+func (t Translations) Classification(classification MoveClassification) string {
+	return t.Text("classification." + classification.String())
+}
+
+// Merged returns the translation with every missing message filled in from
+// EnglishMessages, as a frontend needs it
+func (t Translations) Merged() Translations {
+	merged := make(Translations, len(EnglishMessages))
+	for id, text := range EnglishMessages {
+		merged[id] = text
+	}
+	for id, text := range t {
+		if _, ok := EnglishMessages[id]; ok {
+			merged[id] = text
+		}
+	}
+	return merged
+}
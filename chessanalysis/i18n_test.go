@@ -0,0 +1,23 @@
+package chessanalysis
+
+import "testing"
+
+func TestTranslations(t *testing.T) {
+	for c := range MoveClassification(len(moveClassificationNames)) {
+		if label := Translations(nil).Classification(c); label != c.String() {
+			t.Errorf("expected the English label of %s, got %q", c, label)
+		}
+	}
+
+	german := Translations{"classification.Blunder": "Patzer", "unknown.id": "Unbekannt"}
+	if label := german.Classification(Blunder); label != "Patzer" {
+		t.Errorf("expected the translated label, got %q", label)
+	}
+	merged := german.Merged()
+	if len(merged) != len(EnglishMessages) {
+		t.Errorf("expected every message and nothing else, got %d of %d", len(merged), len(EnglishMessages))
+	}
+	if merged["classification.Blunder"] != "Patzer" || merged["classification.Good"] != "Good" {
+		t.Errorf("expected translations over English, got %v", merged)
+	}
+}
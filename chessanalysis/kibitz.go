@@ -0,0 +1,148 @@
+package chessanalysis
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/walterschell/chess-analyzer/chessanalysis/uciengine"
+)
+
+// KibitzUpdate is the engine's evaluation of a position as of the deepest
+// depth it has searched so far
+type KibitzUpdate struct {
+	FEN        string `json:"fen"`
+	Depth      int    `json:"depth"`
+	WhiteScore Score  `json:"whiteScore"`
+	// White's win/draw/loss chances, estimated from the score for engines
+	// that don't report them
+	WhiteWinProb  float64  `json:"whiteWinProb"`
+	WhiteDrawProb float64  `json:"whiteDrawProb"`
+	WhiteLossProb float64  `json:"whiteLossProb"`
+	BestMove      string   `json:"bestMove"` // SAN
+	Line          []string `json:"line"`     // Principal variation in SAN
+	Nodes         int64    `json:"nodes"`
+	NPS           int64    `json:"nps"`
+	Final         bool     `json:"final"` // The search is over
+	// Heuristic is set when the evaluation is a HeuristicEngine's, for want
+	// of a real engine
+	Heuristic bool `json:"heuristic,omitempty"`
+}
+
+// Kibitzer is an Engine that reports its evaluation while it searches
+type Kibitzer interface {
+	// Kibitz searches the position given as a FEN, calling update each time
+	// the search reaches a new depth, until the limits are reached or ctx is done
+	Kibitz(ctx context.Context, fen string, limits SearchLimits, update func(KibitzUpdate)) error
+}
+
+// searchWatcher is implemented by engines that report their search as it
+// goes, as uciengine's StockfishEngine does
+type searchWatcher interface {
+	Watch(ctx context.Context, fen string, limits SearchLimits, progress func(*uciengine.SearchInfo)) (*uciengine.SearchInfo, error)
+}
+
+// Kibitz searches the position given as a FEN with the engine, calling update
+// each time the search reaches a new depth and once more with the final
+// evaluation. Engines that neither are Kibitzers nor report their search as
+// it goes only report the final evaluation. Searches stopped because ctx is
+// done return ErrAnalysisCancelled without a final update.
+func Kibitz(ctx context.Context, engine Engine, fen string, limits SearchLimits, update func(KibitzUpdate)) error {
+	if kibitzer, ok := engine.(Kibitzer); ok {
+		return kibitzer.Kibitz(ctx, fen, limits, update)
+	}
+	if watcher, ok := engine.(searchWatcher); ok {
+		return kibitzWatched(ctx, watcher, fen, limits, update)
+	}
+	position, err := positionFromFEN(fen)
+	if err != nil {
+		return err
+	}
+	result, err := engine.AnalyzePosition(fen, limits)
+	if err != nil {
+		return err
+	}
+	if ctx.Err() != nil {
+		return fmt.Errorf("%w: %v", ErrAnalysisCancelled, ctx.Err())
+	}
+	bestLine := uciLineToSan(position, result.PlayedLine)
+	kibitz := KibitzUpdate{
+		FEN:        fen,
+		Depth:      result.Depth,
+		WhiteScore: result.WhiteScore,
+		Line:       bestLine,
+		Nodes:      result.Nodes,
+		NPS:        result.NPS,
+		Final:      true,
+		Heuristic:  IsHeuristic(engine),
+	}
+	kibitz.setWDL(result.WhiteWinProb, result.WhiteDrawProb, result.WhiteLossProb)
+	if len(bestLine) > 0 {
+		kibitz.BestMove = bestLine[0]
+	}
+	update(kibitz)
+	return nil
+}
+
+// kibitzWatched searches the position given as a FEN, reporting every depth
+// the engine completes
+func kibitzWatched(ctx context.Context, watcher searchWatcher, fen string, limits SearchLimits, update func(KibitzUpdate)) error {
+	position, err := positionFromFEN(fen)
+	if err != nil {
+		return err
+	}
+	// Scores are from the side to move's perspective
+	black := false
+	if fields := strings.Fields(fen); len(fields) > 1 && fields[1] == "b" {
+		black = true
+	}
+	progress := func(info *uciengine.SearchInfo, final bool) KibitzUpdate {
+		line := uciLineToSan(position, info.PV)
+		kibitz := KibitzUpdate{
+			FEN:        fen,
+			Depth:      info.Depth,
+			WhiteScore: info.Score,
+			Line:       line,
+			Nodes:      info.Nodes,
+			NPS:        info.NPS,
+			Final:      final,
+		}
+		if black {
+			kibitz.WhiteScore = kibitz.WhiteScore.Negate()
+			kibitz.setWDL(info.LossProb, info.DrawProb, info.WinProb)
+		} else {
+			kibitz.setWDL(info.WinProb, info.DrawProb, info.LossProb)
+		}
+		if len(line) > 0 {
+			kibitz.BestMove = line[0]
+		}
+		return kibitz
+	}
+
+	best, err := watcher.Watch(ctx, fen, limits, func(info *uciengine.SearchInfo) {
+		update(progress(info, false))
+	})
+	if err != nil {
+		return err
+	}
+	if ctx.Err() != nil {
+		return fmt.Errorf("%w: %v", ErrAnalysisCancelled, ctx.Err())
+	}
+	update(progress(best, true))
+	return nil
+}
+
+// setWDL sets White's win/draw/loss chances, estimating them from the score
+// if the engine reported none
+func (u *KibitzUpdate) setWDL(win, draw, loss float64) {
+	if !hasWDL(win, draw, loss) {
+		win, draw, loss = scoreWDL(u.WhiteScore)
+	}
+	u.WhiteWinProb, u.WhiteDrawProb, u.WhiteLossProb = win, draw, loss
+}
+
+// Kibitz reports the search of the pooled engine as it goes. Live searches
+// aren't shared with the rest of the pool.
+func (e *pooledEngine) Kibitz(ctx context.Context, fen string, limits SearchLimits, update func(KibitzUpdate)) error {
+	return Kibitz(ctx, e.Engine, fen, limits, update)
+}
@@ -0,0 +1,76 @@
+package chessanalysis
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/walterschell/chess-analyzer/chessanalysis/uciengine"
+)
+
+func TestKibitz(t *testing.T) {
+	const afterE4 = "rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq e3 0 1"
+	fake := &FakeEngine{Positions: map[string]FakeEvaluation{
+		afterE4: {BestMove: "c7c5", Score: -30},
+	}}
+	engine, err := fake.NewEngine()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer engine.Close()
+
+	var updates []KibitzUpdate
+	err = Kibitz(context.Background(), engine, afterE4, SearchLimits{Depth: 4}, func(update KibitzUpdate) {
+		updates = append(updates, update)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(updates) != 5 {
+		t.Fatalf("expected an update per depth and a final one, got %+v", updates)
+	}
+	for i, update := range updates[:4] {
+		if update.Depth != i+1 || update.Final {
+			t.Errorf("expected a live update at depth %d, got %+v", i+1, update)
+		}
+	}
+	final := updates[4]
+	if !final.Final || final.Depth != 4 || final.FEN != afterE4 {
+		t.Errorf("expected a final update at depth 4, got %+v", final)
+	}
+	// Black's evaluation is reported from White's perspective
+	if final.WhiteScore != uciengine.Pawns(0.3) || final.BestMove != "c5" || len(final.Line) == 0 || final.Line[0] != "c5" {
+		t.Errorf("expected +0.30 with c5 best, got %+v", final)
+	}
+	if !hasWDL(final.WhiteWinProb, final.WhiteDrawProb, final.WhiteLossProb) || final.WhiteWinProb <= final.WhiteLossProb {
+		t.Errorf("expected White's chances to favor White, got %+v", final)
+	}
+}
+
+func TestKibitzCancelled(t *testing.T) {
+	engine, err := NewEnginePool(1).Acquire(context.Background(), InteractivePriority, (&FakeEngine{}).NewEngine)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer engine.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	var updates []KibitzUpdate
+	err = Kibitz(ctx, engine, BenchmarkPositions[0], SearchLimits{Depth: 2}, func(update KibitzUpdate) {
+		updates = append(updates, update)
+	})
+	if !errors.Is(err, ErrAnalysisCancelled) {
+		t.Fatalf("expected ErrAnalysisCancelled, got %v", err)
+	}
+	for _, update := range updates {
+		if update.Final {
+			t.Errorf("expected no final update from a cancelled search, got %+v", update)
+		}
+	}
+
+	// The engine is still usable once the cancelled search has stopped
+	if _, err := engine.AnalyzePosition(BenchmarkPositions[0], SearchLimits{Depth: 2}); err != nil {
+		t.Errorf("expected the engine to search again, got %v", err)
+	}
+}
@@ -0,0 +1,131 @@
+package chessanalysis
+
+import "fmt"
+
+// Penalties deducted from a king's safety score of 100
+const (
+	missingShieldPenalty = 10 // Per file beside or in front of the king without a pawn shielding it
+	semiOpenFilePenalty  = 10 // Per file near the king without a friendly pawn
+	openFilePenalty      = 5  // Extra for a file near the king without any pawns
+	kingAttackPenalty    = 4  // Per attack by an enemy piece on the king or a square around it
+)
+
+// DefaultKingSafetyDrop is how many points a king's safety has to drop in a
+// single move to count as a collapse
+const DefaultKingSafetyDrop = 25
+
+// KingSafetyScore is a simple measure of how safe one side's king is, from 0
+// (exposed) to 100 (safe), along with the factors it's computed from
+type KingSafetyScore struct {
+	Score         int `json:"score"`
+	MissingShield int `json:"missingShield"` // Files near the king without a pawn one or two ranks in front of it
+	OpenFiles     int `json:"openFiles"`     // Files near the king without a friendly pawn
+	Attacks       int `json:"attacks"`       // Attacks by enemy pieces on the king's square and the squares around it
+}
+
+// KingSafety is the safety of both kings after a move
+type KingSafety struct {
+	Ply   int             `json:"ply"` // Index of the move within the game
+	White KingSafetyScore `json:"white"`
+	Black KingSafetyScore `json:"black"`
+}
+
+// side returns the score of the side with the given color
+func (k *KingSafety) side(color string) KingSafetyScore {
+	if color == "White" {
+		return k.White
+	}
+	return k.Black
+}
+
+// kingSafety scores the safety of the white or black king
+func (b *board) kingSafety(white bool) KingSafetyScore {
+	king, pawn, enemyPawn, forward := 'K', 'P', 'p', 1
+	if !white {
+		king, pawn, enemyPawn, forward = 'k', 'p', 'P', -1
+	}
+	kingRank, kingFile := -1, -1
+	for rank := 0; rank < 8; rank++ {
+		for file := 0; file < 8; file++ {
+			if b[rank][file] == king {
+				kingRank, kingFile = rank, file
+			}
+		}
+	}
+	var score KingSafetyScore
+	if kingRank < 0 {
+		return score
+	}
+
+	penalty := 0
+	for file := max(kingFile-1, 0); file <= min(kingFile+1, 7); file++ {
+		shielded := false
+		for step := 1; step <= 2; step++ {
+			rank := kingRank + step*forward
+			if rank >= 0 && rank <= 7 && b[rank][file] == pawn {
+				shielded = true
+			}
+		}
+		if !shielded {
+			score.MissingShield++
+		}
+		if b.pawnsOnFile(pawn, file) == 0 {
+			score.OpenFiles++
+			penalty += semiOpenFilePenalty
+			if b.pawnsOnFile(enemyPawn, file) == 0 {
+				penalty += openFilePenalty
+			}
+		}
+		for rank := max(kingRank-1, 0); rank <= min(kingRank+1, 7); rank++ {
+			score.Attacks += len(b.attackers(rank, file, !white))
+		}
+	}
+	penalty += score.MissingShield*missingShieldPenalty + score.Attacks*kingAttackPenalty
+	score.Score = max(0, 100-penalty)
+	return score
+}
+
+// KingSafetyTimeline returns the safety of both kings after every move
+func KingSafetyTimeline(moves []MoveAnalysis) []KingSafety {
+	timeline := make([]KingSafety, 0, len(moves))
+	for i := range moves {
+		b := parseBoard(moves[i].FENAfter)
+		timeline = append(timeline, KingSafety{Ply: i, White: b.kingSafety(true), Black: b.kingSafety(false)})
+	}
+	return timeline
+}
+
+// KingSafetyCollapse is a move after which a king's safety dropped sharply
+type KingSafetyCollapse struct {
+	Ply   int    `json:"ply"` // Index of the move within the game
+	Move  string `json:"move"`
+	Color string `json:"color"` // Side whose king became unsafe
+	From  int    `json:"from"`
+	To    int    `json:"to"`
+}
+
+func (c KingSafetyCollapse) String() string {
+	return fmt.Sprintf("%s's king safety collapsed after %s", c.Color, c.Move)
+}
+
+// DetectKingSafetyCollapses returns the moves after which either king's
+// safety score dropped by at least drop points, in the order they were played
+func DetectKingSafetyCollapses(moves []MoveAnalysis, timeline []KingSafety, drop int) []KingSafetyCollapse {
+	collapses := []KingSafetyCollapse{}
+	for i := 1; i < len(timeline) && i < len(moves); i++ {
+		for _, color := range []string{"White", "Black"} {
+			from, to := timeline[i-1].side(color).Score, timeline[i].side(color).Score
+			if from-to < drop {
+				continue
+			}
+			collapses = append(collapses, KingSafetyCollapse{
+				Ply:   i,
+				Move:  MoveLabel(&moves[i]),
+				Color: color,
+				From:  from,
+				To:    to,
+			})
+		}
+	}
+	return collapses
+}
@@ -0,0 +1,42 @@
+package chessanalysis
+
+import "testing"
+
+func TestKingSafety(t *testing.T) {
+	start := parseBoard("rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1")
+	if got := start.kingSafety(true); got != (KingSafetyScore{Score: 100}) {
+		t.Errorf("expected a safe king in the starting position, got %+v", got)
+	}
+
+	// Castled king after g4: the g-pawn no longer shields the king
+	weakened := parseBoard("r4rk1/ppp2ppp/8/8/6P1/8/PPP2P1P/R4RK1 b - - 0 18")
+	if got := weakened.kingSafety(true); got.MissingShield != 1 || got.OpenFiles != 0 || got.Score != 90 {
+		t.Errorf("unexpected safety after g4: %+v", got)
+	}
+
+	// A queen on the open g-file attacking the king's surroundings
+	exposed := parseBoard("r5k1/ppp2ppp/8/8/8/8/PPP2P1P/R4qK1 w - - 0 20")
+	if got := exposed.kingSafety(true); got.OpenFiles != 1 || got.Attacks == 0 || got.Score >= 70 {
+		t.Errorf("expected an exposed king, got %+v", got)
+	}
+}
+
+func TestDetectKingSafetyCollapses(t *testing.T) {
+	moves := []MoveAnalysis{
+		{MoveNumber: 18, Color: "White", MoveText: "Kh1", FENAfter: "r4rk1/ppp2ppp/8/8/8/8/PPP2PPP/R4R1K b - - 1 18"},
+		{MoveNumber: 18, Color: "Black", MoveText: "Qh4", FENAfter: "r4rk1/ppp2ppp/8/8/7q/8/PPP2PPP/R4R1K w - - 2 19"},
+		{MoveNumber: 19, Color: "White", MoveText: "g3", FENAfter: "r4rk1/ppp2ppp/8/8/7q/6P1/PPP2P1P/R4R1K b - - 0 19"},
+		{MoveNumber: 19, Color: "Black", MoveText: "Qxh2#", FENAfter: "r4rk1/ppp2ppp/8/8/8/6P1/PPP2P1q/R4R1K w - - 0 20"},
+	}
+	timeline := KingSafetyTimeline(moves)
+	if len(timeline) != 4 || timeline[3].Ply != 3 {
+		t.Fatalf("unexpected timeline %+v", timeline)
+	}
+	collapses := DetectKingSafetyCollapses(moves, timeline, DefaultKingSafetyDrop)
+	if len(collapses) != 1 {
+		t.Fatalf("expected 1 collapse, got %+v (timeline %+v)", collapses, timeline)
+	}
+	if got := collapses[0].String(); got != "White's king safety collapsed after 19... Qxh2#" {
+		t.Errorf("unexpected collapse %q", got)
+	}
+}
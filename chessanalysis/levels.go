@@ -0,0 +1,183 @@
+package chessanalysis
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// ClassifierProfile is a named set of move classification thresholds suited
+// to a level of play. The thresholds are changes in the mover's win or loss
+// probability: a drop of 0.2 in the chances to win is a blunder between club
+// players, but a routine inaccuracy between beginners and a lost game
+// between masters.
+type ClassifierProfile struct {
+	Name         string  `json:"name"`
+	Description  string  `json:"description"`
+	Rating       int     `json:"rating"`       // Typical rating of the players the profile suits, see RatingScaler
+	Blunder      float64 `json:"blunder"`      // Drop in win, or rise in loss, probability making a blunder
+	Questionable float64 `json:"questionable"` // Drop in win, or rise in loss, probability making a questionable move
+	Good         float64 `json:"good"`         // Rise in win, or drop in loss, probability making a good move
+	Excellent    float64 `json:"excellent"`    // Rise in win, or drop in loss, probability making an excellent move
+}
+
+// DefaultClassifierProfile is the profile of DefaultMoveClassifier
+const DefaultClassifierProfile = "club"
+
+// ClassifierProfiles are the preset classifier profiles, from the most to the
+// least forgiving:
+//
+//   - beginner, for players under about 1200 Elo: blunder 0.30,
+//     questionable 0.15, good 0.08, excellent 0.15
+//   - club, for players of about 1200 to 2000 Elo: blunder 0.20,
+//     questionable 0.10, good 0.05, excellent 0.10
+//   - expert, for players over about 2000 Elo: blunder 0.12,
+//     questionable 0.06, good 0.03, excellent 0.06
+var ClassifierProfiles = []ClassifierProfile{
+	{Name: "beginner", Description: "Players under about 1200 Elo, where only big swings are flagged", Rating: 900, Blunder: 0.30, Questionable: 0.15, Good: 0.08, Excellent: 0.15},
+	{Name: "club", Description: "Club players of about 1200 to 2000 Elo", Rating: 1600, Blunder: 0.20, Questionable: 0.10, Good: 0.05, Excellent: 0.10},
+	{Name: "expert", Description: "Players over about 2000 Elo, where small inaccuracies matter", Rating: 2300, Blunder: 0.12, Questionable: 0.06, Good: 0.03, Excellent: 0.06},
+}
+
+// ClassifierProfileByName returns the preset classifier profile with the name
+func ClassifierProfileByName(name string) (ClassifierProfile, error) {
+	for _, profile := range ClassifierProfiles {
+		if profile.Name == name {
+			return profile, nil
+		}
+	}
+	return ClassifierProfile{}, fmt.Errorf("%w: unknown classifier profile %q", ErrInvalidOptions, name)
+}
+
+// Classifier returns a move classifier with the profile's thresholds
+func (p ClassifierProfile) Classifier() MoveClassifier {
+	return &ThresholdMoveClassifier{
+		blunderWinProbThreshold:       p.Blunder,
+		blunderLossProbThreshold:      p.Blunder,
+		questionableWinProbThreshold:  p.Questionable,
+		questionableLossProbThreshold: p.Questionable,
+		goodWinProbThreshold:          p.Good,
+		goodLossProbThreshold:         p.Good,
+		excellentWinProbThreshold:     p.Excellent,
+		excellentLossProbThreshold:    p.Excellent,
+	}
+}
+
+// WithClassifierProfile classifies moves with the thresholds of the preset
+// classifier profile with the name, instead of the MoveClassifier
+func WithClassifierProfile(name string) AnalyzeChessGameOption {
+	return func(opts *AnalyzeChessGameOptions) {
+		opts.ClassifierProfile = name
+	}
+}
+
+// RatingScaler adapts the thresholds of a classifier profile to the rating of
+// the player whose moves they classify. A drop of 0.1 in the chances to win
+// is routine at 900 but notable at 2300.
+type RatingScaler func(profile ClassifierProfile, rating int) ClassifierProfile
+
+// Bounds of the factor DefaultRatingScaler scales thresholds by
+const (
+	minRatingScale = 0.5
+	maxRatingScale = 2.0
+)
+
+// DefaultRatingScaler doubles the profile's thresholds for every 1000 points
+// the player is rated below the profile's Rating, and halves them for every
+// 1000 above, up to a factor of two either way. The club profile scaled to
+// 900 or to 2300 is then close to the beginner or the expert one.
+func DefaultRatingScaler(profile ClassifierProfile, rating int) ClassifierProfile {
+	scale := math.Pow(2, float64(profile.Rating-rating)/1000)
+	scale = math.Max(minRatingScale, math.Min(maxRatingScale, scale))
+	profile.Blunder *= scale
+	profile.Questionable *= scale
+	profile.Good *= scale
+	profile.Excellent *= scale
+	return profile
+}
+
+// WithRatingScaling classifies each side's moves with the thresholds of the
+// classifier profile, DefaultClassifierProfile unless WithClassifierProfile
+// names another, scaled by scaler to the side's rating from the WhiteElo and
+// BlackElo tags, instead of the MoveClassifier. Sides without a rating get
+// the profile's thresholds. The thresholds applied are recorded in the
+// game's EffectiveOptions.RatedThresholds.
+func WithRatingScaling(scaler RatingScaler) AnalyzeChessGameOption {
+	return func(opts *AnalyzeChessGameOptions) {
+		opts.RatingScaler = scaler
+	}
+}
+
+// RatedThresholds are the classification thresholds applied to one side's
+// moves by WithRatingScaling
+type RatedThresholds struct {
+	Color        string  `json:"color"`
+	Rating       int     `json:"rating,omitempty"` // From the side's Elo tag; 0 if it had none
+	Blunder      float64 `json:"blunder"`
+	Questionable float64 `json:"questionable"`
+	Good         float64 `json:"good"`
+	Excellent    float64 `json:"excellent"`
+}
+
+// ratedProfiles returns the profile scaled to the rating of each side of a
+// game with the headers, White's first
+func ratedProfiles(profile ClassifierProfile, scaler RatingScaler, headers map[string]string) []RatedThresholds {
+	var thresholds []RatedThresholds
+	for _, color := range []string{"White", "Black"} {
+		scaled := profile
+		rating, err := strconv.Atoi(headers[color+"Elo"])
+		if err == nil && rating > 0 {
+			scaled = scaler(profile, rating)
+		} else {
+			rating = 0
+		}
+		thresholds = append(thresholds, RatedThresholds{
+			Color:        color,
+			Rating:       rating,
+			Blunder:      scaled.Blunder,
+			Questionable: scaled.Questionable,
+			Good:         scaled.Good,
+			Excellent:    scaled.Excellent,
+		})
+	}
+	return thresholds
+}
+
+// classifierFor returns the classifier of the moves of a game with the
+// headers: the MoveClassifier or the profile of the game's speed class, or
+// with rating scaling one classifying each side's moves by its own thresholds
+func (o *AnalyzeChessGameOptions) classifierFor(headers map[string]string) MoveClassifier {
+	if o.RatingScaler == nil {
+		if o.ClassifierProfile == "" && timeControlProfile(o.TimeControlProfiles, headers) != "" {
+			return o.baseProfile(headers).Classifier()
+		}
+		return o.MoveClassifier
+	}
+	classifiers := map[string]MoveClassifier{}
+	for _, side := range ratedProfiles(o.baseProfile(headers), o.RatingScaler, headers) {
+		classifiers[side.Color] = ClassifierProfile{
+			Blunder:      side.Blunder,
+			Questionable: side.Questionable,
+			Good:         side.Good,
+			Excellent:    side.Excellent,
+		}.Classifier()
+	}
+	return MoveClassifierFunc(func(move *MoveAnalysis) MoveClassification {
+		return classifiers[move.Color].ClassifyMove(move)
+	})
+}
+
+// baseProfile returns the classifier profile of a game with the headers,
+// which rating scaling starts from
+func (o *AnalyzeChessGameOptions) baseProfile(headers map[string]string) ClassifierProfile {
+	name := o.ClassifierProfile
+	if name == "" {
+		name = timeControlProfile(o.TimeControlProfiles, headers)
+	}
+	if name == "" {
+		name = DefaultClassifierProfile
+	}
+	// validate has checked the name
+	profile, _ := ClassifierProfileByName(name)
+	return profile
+}
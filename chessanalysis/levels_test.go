@@ -0,0 +1,102 @@
+package chessanalysis
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+)
+
+func TestClassifierProfiles(t *testing.T) {
+	tests := []struct {
+		profile string
+		drop    float64 // In White's win probability, from 0.5
+		want    MoveClassification
+	}{
+		{"beginner", 0.14, Neutral},
+		{"club", 0.14, Questionable},
+		{"expert", 0.14, Blunder},
+		{"beginner", 0.25, Questionable},
+		{"club", 0.25, Blunder},
+		{"expert", 0.04, Neutral},
+	}
+	for _, test := range tests {
+		profile, err := ClassifierProfileByName(test.profile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		move := MoveAnalysis{Color: "White", PreviousWhiteWinProb: 0.5, WhiteWinProb: 0.5 - test.drop, PreviousWhiteLossProb: 0.2, WhiteLossProb: 0.2}
+		if got := profile.Classifier().ClassifyMove(&move); got != test.want {
+			t.Errorf("%s classifies a %.2f drop as %s, want %s", test.profile, test.drop, got, test.want)
+		}
+	}
+
+	opts, err := ResolveOptions(WithClassifierProfile("expert"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	move := MoveAnalysis{Color: "Black", PreviousWhiteLossProb: 0.5, WhiteLossProb: 0.36}
+	if got := opts.MoveClassifier.ClassifyMove(&move); got != Blunder {
+		t.Errorf("expected the expert profile to classify a 0.14 drop as a blunder, got %s", got)
+	}
+	if opts.Effective().ClassifierProfile != "expert" {
+		t.Errorf("expected the profile in the effective options, got %+v", opts.Effective())
+	}
+}
+
+func TestRatingScaling(t *testing.T) {
+	club, err := ClassifierProfileByName("club")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if scaled := DefaultRatingScaler(club, club.Rating); scaled != club {
+		t.Errorf("expected the profile's own rating to leave it alone, got %+v", scaled)
+	}
+	if scaled := DefaultRatingScaler(club, 900); math.Abs(scaled.Blunder-0.325) > 0.001 {
+		t.Errorf("expected the club profile at 900 close to the beginner one, got %+v", scaled)
+	}
+	if scaled := DefaultRatingScaler(club, 5000); scaled.Blunder != club.Blunder/2 {
+		t.Errorf("expected the scale capped at a half, got %+v", scaled)
+	}
+
+	opts, err := ResolveOptions(WithRatingScaling(DefaultRatingScaler))
+	if err != nil {
+		t.Fatal(err)
+	}
+	classifier := opts.classifierFor(map[string]string{"WhiteElo": "900", "BlackElo": "2300"})
+	// A 0.25 drop is routine at 900 and a 0.14 drop a blunder at 2300
+	white := MoveAnalysis{Color: "White", PreviousWhiteWinProb: 0.5, WhiteWinProb: 0.25, PreviousWhiteLossProb: 0.2, WhiteLossProb: 0.2}
+	if got := classifier.ClassifyMove(&white); got != Questionable {
+		t.Errorf("expected a 0.25 drop at 900 to be questionable, got %s", got)
+	}
+	black := MoveAnalysis{Color: "Black", PreviousWhiteLossProb: 0.5, WhiteLossProb: 0.36}
+	if got := classifier.ClassifyMove(&black); got != Blunder {
+		t.Errorf("expected a 0.14 drop at 2300 to be a blunder, got %s", got)
+	}
+
+	// The scaler is pluggable, and the thresholds applied are recorded
+	flat := func(profile ClassifierProfile, rating int) ClassifierProfile {
+		return ClassifierProfile{Blunder: 0.5, Questionable: 0.4, Good: 0.3, Excellent: 0.4}
+	}
+	pgn := "[WhiteElo \"1500\"]\n[BlackElo \"?\"]\n" + scholarsMatePgn
+	game, err := AnalyzeGame(pgn, WithDepth(3), WithEngineFactory(scholarsMateEngine().NewEngine), WithRatingScaling(flat))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(game)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded GameAnalysis
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	thresholds := decoded.Options.RatedThresholds
+	if len(thresholds) != 2 || thresholds[0].Rating != 1500 || thresholds[0].Blunder != 0.5 || thresholds[1].Rating != 0 || thresholds[1].Blunder != club.Blunder {
+		t.Errorf("expected White's thresholds scaled and Black's the profile's, got %+v", thresholds)
+	}
+	for _, move := range game.Moves {
+		if move.Color == "White" && move.Classification == Blunder {
+			t.Errorf("expected no blunders for White with a 0.5 threshold, got %s", MoveLabel(&move))
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package chessanalysis
+
+import "fmt"
+
+// InputLimits bound the PGN a server accepts, so that pathological input
+// can't tie up its engines. A zero limit is no limit.
+type InputLimits struct {
+	MaxPGNBytes int `json:"maxPgnBytes,omitempty"`
+	MaxGames    int `json:"maxGames,omitempty"` // Games per submission
+	MaxPlies    int `json:"maxPlies,omitempty"` // Plies per game
+}
+
+// DefaultInputLimits are generous for any real game or tournament
+var DefaultInputLimits = InputLimits{MaxPGNBytes: 1 << 20, MaxGames: 200, MaxPlies: 1000}
+
+// InputLimitError is the limit a PGN exceeds. It wraps ErrInputTooLarge.
+type InputLimitError struct {
+	Limit  string `json:"limit"` // "maxPgnBytes", "maxGames" or "maxPlies"
+	Max    int    `json:"max"`
+	Actual int    `json:"actual"`
+	Game   int    `json:"game,omitempty"` // Game exceeding maxPlies, from 1
+}
+
+func (e *InputLimitError) Error() string {
+	switch e.Limit {
+	case "maxPgnBytes":
+		return fmt.Sprintf("%v: the PGN is %d bytes, more than the %d allowed", ErrInputTooLarge, e.Actual, e.Max)
+	case "maxGames":
+		return fmt.Sprintf("%v: the PGN has %d games, more than the %d allowed", ErrInputTooLarge, e.Actual, e.Max)
+	default:
+		return fmt.Sprintf("%v: game %d has %d plies, more than the %d allowed", ErrInputTooLarge, e.Game, e.Actual, e.Max)
+	}
+}
+
+func (e *InputLimitError) Unwrap() error {
+	return ErrInputTooLarge
+}
+
+// Check returns an *InputLimitError for the first limit the PGN exceeds, or
+// nil. Games that can't be parsed aren't counted against MaxPlies; analyzing
+// them reports why.
+func (l InputLimits) Check(pgn string) error {
+	if l.MaxPGNBytes > 0 && len(pgn) > l.MaxPGNBytes {
+		return &InputLimitError{Limit: "maxPgnBytes", Max: l.MaxPGNBytes, Actual: len(pgn)}
+	}
+	if l.MaxGames <= 0 && l.MaxPlies <= 0 {
+		return nil
+	}
+	games := ValidatePGN(pgn).Games
+	if l.MaxGames > 0 && len(games) > l.MaxGames {
+		return &InputLimitError{Limit: "maxGames", Max: l.MaxGames, Actual: len(games)}
+	}
+	for i, game := range games {
+		if err := l.checkPlies(game.Plies, i+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CheckGame returns an *InputLimitError if an analyzed game, as sent back by
+// a client, has more plies than MaxPlies
+func (l InputLimits) CheckGame(game *GameAnalysis) error {
+	return l.checkPlies(len(game.Moves), 1)
+}
+
+func (l InputLimits) checkPlies(plies, game int) error {
+	if l.MaxPlies > 0 && plies > l.MaxPlies {
+		return &InputLimitError{Limit: "maxPlies", Max: l.MaxPlies, Actual: plies, Game: game}
+	}
+	return nil
+}
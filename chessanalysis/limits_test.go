@@ -0,0 +1,38 @@
+package chessanalysis
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestInputLimits(t *testing.T) {
+	game := `[Event "Game"]` + "\n\n" + scholarsMatePgn
+	database := strings.Repeat(game+"\n\n", 3)
+	for _, test := range []struct {
+		limits InputLimits
+		want   *InputLimitError
+	}{
+		{InputLimits{}, nil},
+		{DefaultInputLimits, nil},
+		{InputLimits{MaxPGNBytes: 10}, &InputLimitError{Limit: "maxPgnBytes", Max: 10, Actual: len(database)}},
+		{InputLimits{MaxGames: 2}, &InputLimitError{Limit: "maxGames", Max: 2, Actual: 3}},
+		{InputLimits{MaxGames: 3, MaxPlies: 6}, &InputLimitError{Limit: "maxPlies", Max: 6, Actual: 7, Game: 1}},
+	} {
+		err := test.limits.Check(database)
+		if test.want == nil {
+			if err != nil {
+				t.Errorf("expected %+v to allow the PGN, got %v", test.limits, err)
+			}
+			continue
+		}
+		var limitErr *InputLimitError
+		if !errors.As(err, &limitErr) || *limitErr != *test.want || !errors.Is(err, ErrInputTooLarge) {
+			t.Errorf("expected %+v to report %+v, got %v", test.limits, test.want, err)
+		}
+	}
+
+	if err := (InputLimits{MaxPlies: 2}).CheckGame(&GameAnalysis{Moves: make([]MoveAnalysis, 3)}); !errors.Is(err, ErrInputTooLarge) {
+		t.Errorf("expected a game of 3 plies to exceed 2, got %v", err)
+	}
+}
@@ -0,0 +1,43 @@
+package chessanalysis
+
+import "time"
+
+// moverScore returns a score from White's perspective from the perspective of
+// the side of the given color
+func moverScore(color string, whiteScore Score) Score {
+	if color == "Black" {
+		return whiteScore.Negate()
+	}
+	return whiteScore
+}
+
+// detectMissedMate marks a move that gave up the forced mate the engine's
+// best move had
+func detectMissedMate(move *MoveAnalysis) {
+	if move.IsBestMove {
+		return
+	}
+	best := moverScore(move.Color, move.BestMoveWhiteScore)
+	if missesMate(best, moverScore(move.Color, move.WhiteScore)) {
+		move.MissedMate = best.Mate()
+	}
+}
+
+// verifyMissedMate confirms the mate a move missed with a search for nothing
+// but a mate in as many moves, which finds a real one more surely than the
+// move's own search. A mate the search doesn't find is taken back, since a
+// shallow search can see mates that aren't there.
+func verifyMissedMate(engine Engine, move *MoveAnalysis, timeout time.Duration) error {
+	result, err := engine.AnalyzePosition(move.FENBefore, SearchLimits{Mate: move.MissedMate, Timeout: timeout})
+	if err != nil {
+		return err
+	}
+	found := moverScore(move.Color, result.BestMoveWhiteScore)
+	if !found.IsMate() || !found.Winning() || found.Mate() > move.MissedMate {
+		log.Info("Mate search didn't confirm the missed mate", "move", MoveLabel(move), "mate", move.MissedMate)
+		move.MissedMate = 0
+		return nil
+	}
+	move.MissedMate, move.MateVerified = found.Mate(), true
+	return nil
+}
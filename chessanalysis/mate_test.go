@@ -0,0 +1,77 @@
+package chessanalysis
+
+import (
+	"testing"
+
+	"github.com/walterschell/chess-analyzer/chessanalysis/uciengine"
+)
+
+// missedMatePgn is the Scholar's mate with White missing the mate in one
+const missedMatePgn = "[Result \"*\"]\n\n1. e4 e5 2. Qh5 Nc6 3. Bc4 Nf6 4. Qf3 *"
+
+// missedMateEngine has the mate in one as the best move before 4. Qf3
+func missedMateEngine() *FakeEngine {
+	return &FakeEngine{
+		Positions: map[string]FakeEvaluation{
+			"r1bqkb1r/pppp1ppp/2n2n2/4p2Q/2B1P3/8/PPPP1PPP/RNB1K1NR w KQkq - 4 4": {
+				BestMove: "h5f7",
+				Score:    900,
+				Mate:     1,
+			},
+		},
+	}
+}
+
+// mateBlindEngine finds no mate when searching for one, like a shallow
+// search's mate that isn't there
+type mateBlindEngine struct {
+	Engine
+}
+
+func (e mateBlindEngine) AnalyzePosition(fen string, limits SearchLimits) (*AnalysisResult, error) {
+	if limits.Mate > 0 {
+		limits.Mate, limits.Depth = 0, 1
+		result, err := e.Engine.AnalyzePosition(fen, limits)
+		if err == nil {
+			result.BestMoveWhiteScore = uciengine.Centipawns(300)
+		}
+		return result, err
+	}
+	return e.Engine.AnalyzePosition(fen, limits)
+}
+
+func TestMissedMate(t *testing.T) {
+	blind := func() (Engine, error) {
+		engine, err := missedMateEngine().NewEngine()
+		return mateBlindEngine{Engine: engine}, err
+	}
+	tests := []struct {
+		name         string
+		opts         []AnalyzeChessGameOption
+		wantMate     int
+		wantVerified bool
+	}{
+		{"unverified", []AnalyzeChessGameOption{WithEngineFactory(missedMateEngine().NewEngine)}, 1, false},
+		{"verified", []AnalyzeChessGameOption{WithEngineFactory(missedMateEngine().NewEngine), WithMateVerification()}, 1, true},
+		{"not confirmed", []AnalyzeChessGameOption{WithEngineFactory(blind), WithMateVerification()}, 0, false},
+	}
+	for _, test := range tests {
+		game, err := AnalyzeGame(missedMatePgn, append(test.opts, WithDepth(3))...)
+		if err != nil {
+			t.Fatalf("%s: failed to analyze game: %v", test.name, err)
+		}
+		qf3 := game.Moves[6]
+		if qf3.MissedMate != test.wantMate || qf3.MateVerified != test.wantVerified {
+			t.Errorf("%s: expected 4. Qf3 to miss mate in %d (verified %t), got %d (%t)",
+				test.name, test.wantMate, test.wantVerified, qf3.MissedMate, qf3.MateVerified)
+		}
+		if game.Summary.White.MissedMates != min(test.wantMate, 1) {
+			t.Errorf("%s: expected %d missed mates for White, got %d", test.name, min(test.wantMate, 1), game.Summary.White.MissedMates)
+		}
+		for _, move := range game.Moves[:6] {
+			if move.MissedMate != 0 {
+				t.Errorf("%s: expected %s not to miss a mate, got %d", test.name, move.MoveText, move.MissedMate)
+			}
+		}
+	}
+}
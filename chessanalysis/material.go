@@ -0,0 +1,45 @@
+package chessanalysis
+
+import "unicode"
+
+// MaterialBalance is the material each side has after a move, in pawns
+// using the conventional piece values
+type MaterialBalance struct {
+	Ply   int `json:"ply"` // Index of the move within the game
+	White int `json:"white"`
+	Black int `json:"black"`
+}
+
+// Balance is White's material advantage
+func (m MaterialBalance) Balance() int {
+	return m.White - m.Black
+}
+
+// material counts the material of both sides, not counting the kings
+func (b *board) material() (white, black int) {
+	for rank := 0; rank < 8; rank++ {
+		for file := 0; file < 8; file++ {
+			piece := b[rank][file]
+			if piece == 0 || unicode.ToUpper(piece) == 'K' {
+				continue
+			}
+			if unicode.IsUpper(piece) {
+				white += pieceValues[piece]
+			} else {
+				black += pieceValues[unicode.ToUpper(piece)]
+			}
+		}
+	}
+	return white, black
+}
+
+// MaterialTimeline returns the material balance after every move
+func MaterialTimeline(moves []MoveAnalysis) []MaterialBalance {
+	timeline := make([]MaterialBalance, 0, len(moves))
+	for i := range moves {
+		b := parseBoard(moves[i].FENAfter)
+		white, black := b.material()
+		timeline = append(timeline, MaterialBalance{Ply: i, White: white, Black: black})
+	}
+	return timeline
+}
@@ -0,0 +1,21 @@
+package chessanalysis
+
+import "testing"
+
+func TestMaterialTimeline(t *testing.T) {
+	moves := []MoveAnalysis{
+		{FENAfter: "rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq e3 0 1"},
+		{FENAfter: "rnbqkbnr/ppp1pppp/8/3p4/4P3/8/PPPP1PPP/RNBQKBNR w KQkq d6 0 2"},
+		{FENAfter: "rnbqkbnr/ppp1pppp/8/3P4/8/8/PPPP1PPP/RNBQKBNR b KQkq - 0 2"},
+	}
+	timeline := MaterialTimeline(moves)
+	if len(timeline) != 3 {
+		t.Fatalf("expected 3 entries, got %d", len(timeline))
+	}
+	if timeline[0].White != 39 || timeline[0].Black != 39 || timeline[0].Balance() != 0 {
+		t.Errorf("expected equal starting material, got %+v", timeline[0])
+	}
+	if timeline[2].Ply != 2 || timeline[2].Balance() != 1 {
+		t.Errorf("expected White a pawn up after 2. exd5, got %+v", timeline[2])
+	}
+}
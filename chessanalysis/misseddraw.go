@@ -0,0 +1,99 @@
+package chessanalysis
+
+import (
+	"strconv"
+	"strings"
+
+	chess "github.com/corentings/chess/v2"
+)
+
+// Drawing resources a move in a lost position missed, see MoveAnalysis.MissedDraw
+const (
+	MissedDrawRepetition = "repetition" // The best move repeated the position a third time
+	MissedDrawFiftyMove  = "fiftyMove"  // The best move reached fifty moves without a capture or pawn move
+	MissedDrawStalemate  = "stalemate"  // The engine's line after the best move ends in stalemate
+	MissedDrawFortress   = "fortress"   // The best move held the draw a piece or more down
+)
+
+const (
+	// missedDrawLost is the mover's expected score, in percent, at or below
+	// which the move played left them lost
+	missedDrawLost = 25
+	// missedDrawHeld is how far from an even score, in percentage points,
+	// the best move's expected score may be for it to hold the draw
+	missedDrawHeld = 15
+	// fortressMaterial is how many pawns of material down the mover has to be
+	// for a held draw to count as a fortress
+	fortressMaterial = 3
+)
+
+// positionKey identifies a position for repetitions: the placement, the side
+// to move, the castling rights and the en passant square of its FEN
+func positionKey(fen string) string {
+	fields := strings.Fields(fen)
+	if len(fields) < 4 {
+		return fen
+	}
+	return strings.Join(fields[:4], " ")
+}
+
+// detectMissedDraw marks a move that left its side lost when the engine's best
+// move held a draw by a concrete resource. repetitions counts the positions of
+// the game so far by positionKey.
+func detectMissedDraw(move *MoveAnalysis, position *chess.Position, result *AnalysisResult, repetitions map[string]int) {
+	if move.IsBestMove || move.TerminalStatus != "" || len(result.BestLine) == 0 {
+		return
+	}
+	played := moverExpectation(move.Color, move.WhiteScore, move.WhiteWinProb, move.WhiteDrawProb, move.WhiteLossProb)
+	best := moverExpectation(move.Color, move.BestMoveWhiteScore, move.BestMoveWhiteWinProb, move.BestMoveWhiteDrawProb, move.BestMoveWhiteLossProb)
+	if played > missedDrawLost || best < 50-missedDrawHeld || best > 50+missedDrawHeld {
+		return
+	}
+	bestMove, err := chess.UCINotation{}.Decode(position, result.BestLine[0])
+	if err != nil {
+		return
+	}
+	next := position.Update(bestMove)
+	fields := strings.Fields(next.String())
+	halfMoves := 0
+	if len(fields) > 4 {
+		halfMoves, _ = strconv.Atoi(fields[4])
+	}
+
+	switch {
+	case repetitions[positionKey(next.String())] >= 2:
+		move.MissedDraw = MissedDrawRepetition
+	case halfMoves >= 100:
+		move.MissedDraw = MissedDrawFiftyMove
+	case lineEndsInStalemate(position, result.BestLine):
+		move.MissedDraw = MissedDrawStalemate
+	case materialDeficit(position) >= fortressMaterial:
+		move.MissedDraw = MissedDrawFortress
+	}
+}
+
+// lineEndsInStalemate reports whether playing the line, given in UCI
+// notation, from the position reaches stalemate
+func lineEndsInStalemate(position *chess.Position, line []string) bool {
+	for _, uci := range line {
+		move, err := chess.UCINotation{}.Decode(position, uci)
+		if err != nil {
+			return false
+		}
+		position = position.Update(move)
+		if terminalMethod(position) == chess.Stalemate {
+			return true
+		}
+	}
+	return false
+}
+
+// materialDeficit returns how many pawns of material the side to move is down
+func materialDeficit(position *chess.Position) int {
+	b := parseBoard(position.String())
+	white, black := b.material()
+	if position.Turn() == chess.White {
+		return black - white
+	}
+	return white - black
+}
@@ -0,0 +1,53 @@
+package chessanalysis
+
+import (
+	"testing"
+
+	"github.com/walterschell/chess-analyzer/chessanalysis/uciengine"
+)
+
+func TestDetectMissedDraw(t *testing.T) {
+	// Black is lost, but 1... Rb6+ 2. Qxb6 is stalemate
+	const fen = "k7/1r6/2K5/1Q6/8/8/8/8 b - - 0 60"
+	stalemate := []string{"b7b6", "b5b6"}
+	tests := []struct {
+		name        string
+		fen         string
+		bestLine    []string
+		repetitions map[string]int
+		played      float64
+		best        float64
+		want        string
+	}{
+		{"Stalemate", fen, stalemate, nil, 10, 0, MissedDrawStalemate},
+		{"Repetition", fen, stalemate, map[string]int{positionKey("k7/8/1rK5/1Q6/8/8/8/8 w - - 1 61"): 2}, 10, 0, MissedDrawRepetition},
+		{"Fifty moves", "k7/1r6/2K5/1Q6/8/8/8/8 b - - 99 90", []string{"b7b8"}, nil, 10, 0, MissedDrawFiftyMove},
+		{"Fortress", fen, []string{"b7b8"}, nil, 10, 0, MissedDrawFortress},
+		{"Not lost", fen, stalemate, nil, 0.2, 0, ""},
+		{"Best move loses too", fen, stalemate, nil, 10, 8, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			position, err := positionFromFEN(test.fen)
+			if err != nil {
+				t.Fatal(err)
+			}
+			move := &MoveAnalysis{Color: "Black", WhiteScore: uciengine.Pawns(test.played), BestMoveWhiteScore: uciengine.Pawns(test.best)}
+			detectMissedDraw(move, position, &AnalysisResult{BestLine: test.bestLine}, test.repetitions)
+			if move.MissedDraw != test.want {
+				t.Errorf("expected missed draw %q, got %q", test.want, move.MissedDraw)
+			}
+		})
+	}
+}
+
+func TestMissedDrawsReportedSeparately(t *testing.T) {
+	moves := []MoveAnalysis{
+		{MoveNumber: 60, Color: "Black", MoveText: "Rb8", BestMoveSAN: "Rb6+", Classification: Blunder, MissedDraw: MissedDrawStalemate},
+		{MoveNumber: 61, Color: "White", MoveText: "Qa6+", Classification: Best},
+	}
+	game := NewGameAnalysis("", moves, EffectiveOptions{})
+	if game.Summary.Black.MissedDraws != 1 || game.Summary.Black.Blunders != 1 {
+		t.Errorf("unexpected Black summary %+v", game.Summary.Black)
+	}
+}
@@ -0,0 +1,194 @@
+package chessanalysis
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// MoveJSONOptions choose how much of each move's analysis its JSON carries,
+// for clients on slow connections: the full analysis of an 80 move game runs
+// to hundreds of kilobytes
+type MoveJSONOptions struct {
+	// Compact leaves out the fields that are zero or follow from others, see
+	// derivedMoveKeys, and shortens the keys, see CompactMoveKeys
+	Compact bool
+	// Fields are the keys to keep, by their full names; nil keeps them all.
+	// See ParseMoveFields.
+	Fields []string
+}
+
+// CompactMoveKeys are the short keys of compact move JSON, by the full keys
+// they stand for. It lists every key of a move's JSON.
+var CompactMoveKeys = map[string]string{
+	"schemaVersion":         "v",
+	"moveNumber":            "n",
+	"color":                 "c",
+	"moveText":              "m",
+	"piece":                 "p",
+	"isCapture":             "x",
+	"isCheck":               "ck",
+	"isPromotion":           "pr",
+	"fenBefore":             "fb",
+	"fenAfter":              "fa",
+	"whiteScore":            "s",
+	"previousWhiteScore":    "ps",
+	"classification":        "cl",
+	"classificationSymbol":  "sy",
+	"isBestMove":            "ib",
+	"bestMove":              "b",
+	"bestMoveSAN":           "bs",
+	"bestMoveWhiteScore":    "bws",
+	"whiteWinProb":          "w",
+	"whiteDrawProb":         "d",
+	"whiteLossProb":         "l",
+	"bestMoveWhiteWinProb":  "bw",
+	"bestMoveWhiteDrawProb": "bd",
+	"bestMoveWhiteLossProb": "bl",
+	"previousWhiteWinProb":  "pw",
+	"previousWhiteDrawProb": "pd",
+	"previousWhiteLossProb": "pl",
+	"depth":                 "dp",
+	"requestedDepth":        "rd",
+	"depthRetries":          "dr",
+	"selDepth":              "sd",
+	"nodes":                 "nd",
+	"nps":                   "nps",
+	"timeSpentMs":           "t",
+	"reusedFrom":            "rf",
+	"phase":                 "ph",
+	"clockMs":               "clk",
+	"refutation":            "rt",
+	"bestReply":             "br",
+	"bestReplyUCI":          "bru",
+	"timeTrouble":           "tt",
+	"engineRank":            "er",
+	"sharpness":             "sh",
+	"topMoves":              "tm",
+	"hints":                 "h",
+	"sacrifice":             "sc",
+	"sacrificeMaterial":     "scm",
+	"missedDraw":            "md",
+	"missedMate":            "mm",
+	"mateVerified":          "mv",
+	"practicalChances":      "pc",
+	"practicalLoss":         "plo",
+	"practicalTry":          "pt",
+	"bestMoveSacrifice":     "bsc",
+	"bestSacrificeMaterial": "bscm",
+	"accuracy":              "a",
+	"expectedPoints":        "ep",
+	"centipawnLoss":         "cpl",
+	"annotation":            "an",
+	"embeddedEval":          "ee",
+	"skipped":               "sk",
+	"decided":               "dc",
+	"heuristic":             "hu",
+	"terminalStatus":        "ts",
+	"secondOpinion":         "so",
+	"diagnostics":           "dg",
+}
+
+// derivedMoveKeys are left out of compact move JSON as clients can work them
+// out: the draw probabilities are what the win and loss probabilities leave,
+// and the previous score and probabilities are those of the move before
+var derivedMoveKeys = []string{
+	"whiteDrawProb", "bestMoveWhiteDrawProb", "previousWhiteDrawProb",
+	"previousWhiteScore", "previousWhiteWinProb", "previousWhiteLossProb",
+}
+
+// zeroJSONValues are the encodings of the zero values compact move JSON
+// leaves out
+var zeroJSONValues = []string{`0`, `false`, `""`, `null`, `[]`, `{}`}
+
+// ParseMoveFields parses a comma-separated list of move JSON keys, such as
+// "moveText,whiteScore,classification", checking that each is a key of a
+// move's JSON
+func ParseMoveFields(list string) ([]string, error) {
+	var fields []string
+	for _, field := range strings.Split(list, ",") {
+		fields = append(fields, strings.TrimSpace(field))
+	}
+	return fields, MoveJSONOptions{Fields: fields}.Validate()
+}
+
+// Validate checks that the Fields are keys of a move's JSON
+func (o MoveJSONOptions) Validate() error {
+	for _, field := range o.Fields {
+		if _, ok := CompactMoveKeys[field]; !ok {
+			return fmt.Errorf("%w: unknown move field %q", ErrInvalidOptions, field)
+		}
+	}
+	return nil
+}
+
+// full reports whether the options leave moves' JSON as it is
+func (o MoveJSONOptions) full() bool {
+	return !o.Compact && o.Fields == nil
+}
+
+// MarshalMove encodes the analysis of a move as JSON with the options
+func (o MoveJSONOptions) MarshalMove(move *MoveAnalysis) ([]byte, error) {
+	data, err := json.Marshal(move)
+	if err != nil || o.full() {
+		return data, err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	selected := make(map[string]json.RawMessage, len(fields))
+	for key, value := range fields {
+		if o.keeps(key, value) {
+			if o.Compact {
+				key = CompactMoveKeys[key]
+			}
+			selected[key] = value
+		}
+	}
+	return json.Marshal(selected)
+}
+
+// keeps reports whether a field of a move's JSON is written with the options
+func (o MoveJSONOptions) keeps(key string, value json.RawMessage) bool {
+	if o.Fields != nil && !slices.Contains(o.Fields, key) {
+		return false
+	}
+	if !o.Compact {
+		return true
+	}
+	if slices.Contains(derivedMoveKeys, key) {
+		return false
+	}
+	for _, zero := range zeroJSONValues {
+		if bytes.Equal(value, []byte(zero)) {
+			return false
+		}
+	}
+	return true
+}
+
+// MarshalGame encodes the analysis of a game as JSON, with its moves encoded
+// with the options and the rest of it in full
+func (o MoveJSONOptions) MarshalGame(game *GameAnalysis) ([]byte, error) {
+	data, err := json.Marshal(game)
+	if err != nil || o.full() {
+		return data, err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	moves := make([]json.RawMessage, len(game.Moves))
+	for i := range game.Moves {
+		if moves[i], err = o.MarshalMove(&game.Moves[i]); err != nil {
+			return nil, err
+		}
+	}
+	if fields["moves"], err = json.Marshal(moves); err != nil {
+		return nil, err
+	}
+	return json.Marshal(fields)
+}
@@ -0,0 +1,89 @@
+package chessanalysis
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/walterschell/chess-analyzer/chessanalysis/uciengine"
+)
+
+func TestCompactMoveKeys(t *testing.T) {
+	short := map[string]string{}
+	fields := reflect.TypeOf(moveAnalysisJSON{})
+	for i := 0; i < fields.NumField(); i++ {
+		key, _, _ := strings.Cut(fields.Field(i).Tag.Get("json"), ",")
+		compact, ok := CompactMoveKeys[key]
+		if !ok {
+			t.Errorf("no compact key for %q", key)
+		}
+		if other, ok := short[compact]; ok {
+			t.Errorf("%q and %q share the compact key %q", key, other, compact)
+		}
+		short[compact] = key
+	}
+	if len(CompactMoveKeys) != fields.NumField() {
+		t.Errorf("expected a compact key per move JSON key, got %d for %d", len(CompactMoveKeys), fields.NumField())
+	}
+}
+
+func TestMoveJSONOptions(t *testing.T) {
+	move := &MoveAnalysis{
+		MoveNumber:           1,
+		Color:                "White",
+		MoveText:             "e4",
+		WhiteScore:           uciengine.Pawns(0.3),
+		WhiteWinProb:         0.1,
+		WhiteDrawProb:        0.85,
+		WhiteLossProb:        0.05,
+		PreviousWhiteWinProb: 0.08,
+		Depth:                12,
+		TimeSpent:            time.Second,
+		Classification:       Best,
+	}
+	decode := func(data []byte, err error) map[string]any {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var fields map[string]any
+		if err := json.Unmarshal(data, &fields); err != nil {
+			t.Fatal(err)
+		}
+		return fields
+	}
+
+	full := decode(MoveJSONOptions{}.MarshalMove(move))
+	compact := decode(MoveJSONOptions{Compact: true}.MarshalMove(move))
+	if compact["m"] != "e4" || compact["w"] != 0.1 || compact["t"] != 1000.0 || compact["cl"] != "Best" {
+		t.Errorf("unexpected compact move %v", compact)
+	}
+	for _, left := range []string{"d", "pw", "x", "nd", "moveText"} {
+		if _, ok := compact[left]; ok {
+			t.Errorf("expected %q left out of the compact move %v", left, compact)
+		}
+	}
+	if len(compact) >= len(full) {
+		t.Errorf("expected fewer compact fields than the %d full ones, got %d", len(full), len(compact))
+	}
+
+	selected := decode(MoveJSONOptions{Fields: []string{"moveText", "whiteScore", "isCapture"}}.MarshalMove(move))
+	if len(selected) != 3 || selected["moveText"] != "e4" || selected["isCapture"] != false {
+		t.Errorf("unexpected selected fields %v", selected)
+	}
+
+	game := &GameAnalysis{Headers: map[string]string{"White": "me"}, Moves: []MoveAnalysis{*move}}
+	encoded := decode(MoveJSONOptions{Fields: []string{"moveText"}}.MarshalGame(game))
+	if moves := encoded["moves"].([]any); len(moves) != 1 || len(moves[0].(map[string]any)) != 1 || encoded["headers"] == nil {
+		t.Errorf("unexpected game %v", encoded)
+	}
+
+	if fields, err := ParseMoveFields("moveText, whiteScore"); err != nil || len(fields) != 2 || fields[1] != "whiteScore" {
+		t.Errorf("ParseMoveFields = %q, %v", fields, err)
+	}
+	if _, err := ParseMoveFields("moveText,m"); err == nil {
+		t.Error("expected compact keys to be rejected as fields")
+	}
+}
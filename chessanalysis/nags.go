@@ -0,0 +1,128 @@
+package chessanalysis
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// nagSymbols are the move assessment NAGs that have a traditional symbol
+var nagSymbols = map[string]string{
+	"$1": "!",
+	"$2": "?",
+	"$3": "!!",
+	"$4": "??",
+	"$5": "!?",
+	"$6": "?!",
+}
+
+// NAGMapping maps move classifications to the annotation glyphs written after
+// moves in PGN, either numeric NAGs such as "$2" or their symbols such as "?",
+// and the glyphs of imported PGNs back to classifications
+type NAGMapping struct {
+	glyphs          map[MoveClassification]string
+	classifications map[string]MoveClassification // By numeric NAG
+}
+
+// NumericNAGs writes classifications as numeric NAGs: $1 for good moves, $2
+// for questionable ones, $3 for excellent and brilliant ones, and $4 for
+// blunders
+var NumericNAGs = mustNAGMapping(map[MoveClassification]string{
+	Good:         "$1",
+	Questionable: "$2",
+	Excellent:    "$3",
+	Brilliant:    "$3",
+	Blunder:      "$4",
+})
+
+// SymbolNAGs writes classifications as the symbols of NumericNAGs, such as
+// "?" for questionable moves
+var SymbolNAGs = mustNAGMapping(map[MoveClassification]string{
+	Good:         "!",
+	Questionable: "?",
+	Excellent:    "!!",
+	Brilliant:    "!!",
+	Blunder:      "??",
+})
+
+// NewNAGMapping returns a mapping writing each classification as the given
+// glyph: a numeric NAG from $1 to $255 or one of the symbols !, ?, !!, ??, !?
+// and ?!. Classifications without a glyph are written without one. When
+// several classifications share a glyph, it is read back as the first of them
+// in the order of MoveClassification.
+func NewNAGMapping(glyphs map[MoveClassification]string) (*NAGMapping, error) {
+	m := &NAGMapping{glyphs: make(map[MoveClassification]string), classifications: make(map[string]MoveClassification)}
+	classifications := make([]MoveClassification, 0, len(glyphs))
+	for classification := range glyphs {
+		classifications = append(classifications, classification)
+	}
+	slices.Sort(classifications)
+	for _, classification := range classifications {
+		glyph := glyphs[classification]
+		if glyph == "" {
+			continue
+		}
+		nag, ok := numericNAG(glyph)
+		if !ok {
+			return nil, fmt.Errorf("%w: %q is not a NAG", ErrInvalidOptions, glyph)
+		}
+		m.glyphs[classification] = glyph
+		if _, ok := m.classifications[nag]; !ok {
+			m.classifications[nag] = classification
+		}
+	}
+	return m, nil
+}
+
+// mustNAGMapping returns the mapping of NewNAGMapping, panicking on invalid glyphs
+func mustNAGMapping(glyphs map[MoveClassification]string) *NAGMapping {
+	m, err := NewNAGMapping(glyphs)
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
+
+// NAGMappingByName returns NumericNAGs for "numeric" and SymbolNAGs for "symbols"
+func NAGMappingByName(name string) (*NAGMapping, error) {
+	switch name {
+	case "numeric":
+		return NumericNAGs, nil
+	case "symbols":
+		return SymbolNAGs, nil
+	default:
+		return nil, fmt.Errorf("%w: unknown NAG mapping %q", ErrInvalidOptions, name)
+	}
+}
+
+// numericNAG returns the numeric form of a glyph, such as "$2" for "?"
+func numericNAG(glyph string) (string, bool) {
+	if digits, ok := strings.CutPrefix(glyph, "$"); ok {
+		n, err := strconv.Atoi(digits)
+		return "$" + strconv.Itoa(n), err == nil && n >= 0 && n <= 255
+	}
+	for nag, symbol := range nagSymbols {
+		if symbol == glyph {
+			return nag, true
+		}
+	}
+	return "", false
+}
+
+// Glyph returns the glyph written after moves of the classification, or ""
+func (m *NAGMapping) Glyph(classification MoveClassification) string {
+	return m.glyphs[classification]
+}
+
+// Classification returns the classification a glyph of an imported PGN stands
+// for, in either its numeric or its symbol form, or false if the mapping has
+// none
+func (m *NAGMapping) Classification(glyph string) (MoveClassification, bool) {
+	nag, ok := numericNAG(glyph)
+	if !ok {
+		return Neutral, false
+	}
+	classification, ok := m.classifications[nag]
+	return classification, ok
+}
@@ -0,0 +1,64 @@
+package chessanalysis
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestNAGMapping(t *testing.T) {
+	if NumericNAGs.Glyph(Good) != "$1" || NumericNAGs.Glyph(Blunder) != "$4" {
+		t.Errorf("expected numeric NAGs, got %s and %s", NumericNAGs.Glyph(Good), NumericNAGs.Glyph(Blunder))
+	}
+	if SymbolNAGs.Glyph(Good) != "!" || SymbolNAGs.Glyph(Blunder) != "??" {
+		t.Errorf("expected symbols, got %s and %s", SymbolNAGs.Glyph(Good), SymbolNAGs.Glyph(Blunder))
+	}
+
+	// Questionable moves as dubious rather than mistakes
+	dubious, err := NewNAGMapping(map[MoveClassification]string{Questionable: "$6", Blunder: "$4", Excellent: "!!", Brilliant: "!!"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		glyph string
+		want  MoveClassification
+		ok    bool
+	}{
+		{"$6", Questionable, true},
+		{"?!", Questionable, true},
+		{"??", Blunder, true},
+		{"$3", Excellent, true}, // The first of the classifications sharing the glyph
+		{"$2", Neutral, false},
+		{"", Neutral, false},
+	}
+	for _, test := range tests {
+		if got, ok := dubious.Classification(test.glyph); got != test.want || ok != test.ok {
+			t.Errorf("Classification(%q) = %s, %v, want %s, %v", test.glyph, got, ok, test.want, test.ok)
+		}
+	}
+
+	if _, err := NewNAGMapping(map[MoveClassification]string{Blunder: "bad"}); !errors.Is(err, ErrInvalidOptions) {
+		t.Errorf("expected an invalid glyph to be refused, got %v", err)
+	}
+	if _, err := NAGMappingByName("emoji"); !errors.Is(err, ErrInvalidOptions) {
+		t.Errorf("expected an unknown mapping to be refused, got %v", err)
+	}
+}
+
+func TestImportedNAGs(t *testing.T) {
+	pgn := strings.Replace(scholarsMatePgn, "Nf6", "Nf6??", 1)
+	moves, err := AnalyzeChessGame(pgn, WithEngineFactory(scholarsMateEngine().NewEngine), WithDepth(4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	move := moves[5]
+	if move.Annotation != "??" {
+		t.Fatalf("expected 3...Nf6 to keep its annotation, got %q", move.Annotation)
+	}
+	if classification, ok := NumericNAGs.Classification(move.Annotation); !ok || classification != Blunder {
+		t.Errorf("expected ?? to be read back as a blunder, got %s", classification)
+	}
+	if moves[4].Annotation != "" {
+		t.Errorf("expected 3. Bc4 to have no annotation, got %q", moves[4].Annotation)
+	}
+}
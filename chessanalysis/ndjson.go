@@ -0,0 +1,182 @@
+package chessanalysis
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// lichessExportGame is a game in the NDJSON format of the Lichess game export
+// API, of which the fields needed to write it as PGN are used
+type lichessExportGame struct {
+	ID         string `json:"id"`
+	Rated      bool   `json:"rated"`
+	Variant    string `json:"variant"`
+	Speed      string `json:"speed"`
+	CreatedAt  int64  `json:"createdAt"` // Milliseconds since the epoch
+	Status     string `json:"status"`
+	Winner     string `json:"winner"`
+	InitialFEN string `json:"initialFen"`
+	Players    struct {
+		White lichessExportPlayer `json:"white"`
+		Black lichessExportPlayer `json:"black"`
+	} `json:"players"`
+	Opening *struct {
+		ECO  string `json:"eco"`
+		Name string `json:"name"`
+	} `json:"opening"`
+	Clock *struct {
+		Initial   int `json:"initial"`   // Seconds
+		Increment int `json:"increment"` // Seconds
+	} `json:"clock"`
+	Moves    string `json:"moves"`  // SAN, separated by spaces
+	Clocks   []int  `json:"clocks"` // Mover's remaining time after each move, in centiseconds
+	Analysis []struct {
+		Eval *int `json:"eval"` // Centipawns from White's perspective
+		Mate *int `json:"mate"` // Moves to mate, negative when Black mates
+	} `json:"analysis"` // Server analysis of the position after each move
+	PGN string `json:"pgn"` // Only with pgnInJson
+}
+
+type lichessExportPlayer struct {
+	User *struct {
+		Name string `json:"name"`
+	} `json:"user"`
+	Rating  int `json:"rating"`
+	AILevel int `json:"aiLevel"`
+}
+
+// name is how the player appears in the PGN
+func (p *lichessExportPlayer) name() string {
+	switch {
+	case p.User != nil:
+		return p.User.Name
+	case p.AILevel > 0:
+		return fmt.Sprintf("Stockfish level %d", p.AILevel)
+	}
+	return "Anonymous"
+}
+
+// ReadLichessNDJSON reads games in the NDJSON format of the Lichess game
+// export API (application/x-ndjson), one JSON object per line, and returns
+// them as a PGN database. Clocks and the server analysis, where Lichess has
+// one, become [%clk] and [%eval] annotations, which WithEmbeddedEvals reuses
+// instead of searching again. Games exported with pgnInJson keep Lichess's own
+// PGN. Variant games, which can't be analyzed, are left out.
+func ReadLichessNDJSON(r io.Reader) (string, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+	var games []string
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		var game lichessExportGame
+		if err := json.Unmarshal(scanner.Bytes(), &game); err != nil {
+			return "", fmt.Errorf("%w: line %d: %v", ErrInvalidPGN, line, err)
+		}
+		if game.Variant != "" && game.Variant != "standard" && game.Variant != "fromPosition" {
+			continue
+		}
+		if game.PGN != "" {
+			games = append(games, strings.TrimSpace(game.PGN))
+			continue
+		}
+		games = append(games, strings.TrimSpace(game.pgn()))
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	return strings.Join(games, "\n\n"), nil
+}
+
+// result is the game's PGN result
+func (g *lichessExportGame) result() string {
+	switch {
+	case g.Winner == "white":
+		return "1-0"
+	case g.Winner == "black":
+		return "0-1"
+	}
+	switch g.Status {
+	case "", "created", "started", "aborted", "unknownFinish":
+		return "*"
+	}
+	return "1/2-1/2"
+}
+
+// pgn writes the game as PGN from its JSON fields
+func (g *lichessExportGame) pgn() string {
+	mode := "Casual"
+	if g.Rated {
+		mode = "Rated"
+	}
+	headers := map[string]string{
+		"Event":  strings.TrimSpace(fmt.Sprintf("%s %s game", mode, g.Speed)),
+		"Site":   "https://lichess.org/" + g.ID,
+		"White":  g.Players.White.name(),
+		"Black":  g.Players.Black.name(),
+		"Result": g.result(),
+	}
+	if g.CreatedAt > 0 {
+		headers["Date"] = time.UnixMilli(g.CreatedAt).UTC().Format("2006.01.02")
+	}
+	if rating := g.Players.White.Rating; rating > 0 {
+		headers["WhiteElo"] = fmt.Sprint(rating)
+	}
+	if rating := g.Players.Black.Rating; rating > 0 {
+		headers["BlackElo"] = fmt.Sprint(rating)
+	}
+	if g.Opening != nil {
+		headers["ECO"], headers["Opening"] = g.Opening.ECO, g.Opening.Name
+	}
+	if g.Clock != nil {
+		headers["TimeControl"] = fmt.Sprintf("%d+%d", g.Clock.Initial, g.Clock.Increment)
+	}
+	moveNumber, black := 1, false
+	if g.InitialFEN != "" {
+		headers["SetUp"], headers["FEN"] = "1", g.InitialFEN
+		moveNumber, black = fullMoveNumber(g.InitialFEN), strings.Fields(g.InitialFEN)[1] == "b"
+	}
+
+	var pgn strings.Builder
+	WritePGNHeaders(&pgn, headers)
+	var tokens []string
+	commented := false
+	for ply, san := range strings.Fields(g.Moves) {
+		if !black {
+			tokens = append(tokens, fmt.Sprintf("%d.", moveNumber))
+		} else if ply == 0 || commented {
+			tokens = append(tokens, fmt.Sprintf("%d...", moveNumber))
+		}
+		tokens = append(tokens, san)
+
+		var commands []string
+		if ply < len(g.Analysis) {
+			if eval := g.Analysis[ply]; eval.Mate != nil {
+				commands = append(commands, fmt.Sprintf("[%%eval #%d]", *eval.Mate))
+			} else if eval.Eval != nil {
+				commands = append(commands, fmt.Sprintf("[%%eval %.2f]", float64(*eval.Eval)/100))
+			}
+		}
+		if ply < len(g.Clocks) {
+			commands = append(commands, "[%clk "+formatClockCommand(time.Duration(g.Clocks[ply])*10*time.Millisecond)+"]")
+		}
+		commented = len(commands) > 0
+		if commented {
+			tokens = append(tokens, "{ "+strings.Join(commands, " ")+" }")
+		}
+
+		if black {
+			moveNumber++
+		}
+		black = !black
+	}
+	tokens = append(tokens, headers["Result"])
+	pgn.WriteString(strings.Join(tokens, " "))
+	pgn.WriteString("\n")
+	return pgn.String()
+}
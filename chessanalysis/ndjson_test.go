@@ -0,0 +1,96 @@
+package chessanalysis
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/walterschell/chess-analyzer/chessanalysis/uciengine"
+)
+
+const lichessNDJSON = `{"id":"abcd1234","rated":true,"variant":"standard","speed":"blitz","createdAt":1700000000000,"status":"mate","winner":"white","players":{"white":{"user":{"name":"Player 1"},"rating":1500},"black":{"aiLevel":2}},"clock":{"initial":180,"increment":0},"moves":"e4 e5 Qh5 Nc6 Bc4 Nf6 Qxf7#","clocks":[18000,17850,17700,17600,17500,17400,17300],"analysis":[{"eval":30},{"eval":25},{"eval":10},{"eval":15},{"eval":20},{"mate":1},{"mate":0}]}
+{"id":"variant1","variant":"atomic","moves":"e4 e5"}
+
+{"id":"withpgn1","variant":"standard","moves":"d4","pgn":"[Event \"Casual rapid game\"]\n[Result \"*\"]\n\n1. d4 { [%eval 0.2] } *\n"}
+`
+
+func TestReadLichessNDJSON(t *testing.T) {
+	pgn, err := ReadLichessNDJSON(strings.NewReader(lichessNDJSON))
+	if err != nil {
+		t.Fatalf("failed to read NDJSON: %v", err)
+	}
+	games, err := SplitPGN(pgn)
+	if err != nil || len(games) != 2 {
+		t.Fatalf("expected the two standard games, got %d (%v):\n%s", len(games), err, pgn)
+	}
+	for _, want := range []string{
+		`[Site "https://lichess.org/abcd1234"]`,
+		`[Black "Stockfish level 2"]`,
+		`[Date "2023.11.14"]`,
+		`[WhiteElo "1500"]`,
+		`[TimeControl "180+0"]`,
+		"1. e4 { [%eval 0.30] [%clk 0:03:00.0] } 1... e5 { [%eval 0.25] [%clk 0:02:58.5] }",
+		"3... Nf6 { [%eval #1] [%clk 0:02:54.0] }",
+	} {
+		if !strings.Contains(games[0], want) {
+			t.Errorf("expected the first game to contain %q:\n%s", want, games[0])
+		}
+	}
+	if !strings.Contains(games[1], "1. d4 { [%eval 0.2] }") {
+		t.Errorf("expected the PGN exported by Lichess to be kept:\n%s", games[1])
+	}
+
+	if _, err := ReadLichessNDJSON(strings.NewReader("{not json}\n")); !errors.Is(err, ErrInvalidPGN) {
+		t.Errorf("expected ErrInvalidPGN for a malformed line, got %v", err)
+	}
+}
+
+func TestEmbeddedEvals(t *testing.T) {
+	pgn, err := ReadLichessNDJSON(strings.NewReader(strings.SplitN(lichessNDJSON, "\n", 2)[0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	noEngine := func() (Engine, error) { return nil, errors.New("no engine wanted") }
+	moves, err := AnalyzeChessGame(pgn, WithEmbeddedEvals(), WithEngineFactory(noEngine))
+	if err != nil {
+		t.Fatalf("expected a fully evaluated game to need no engine, got %v", err)
+	}
+	nf6 := &moves[5]
+	if !nf6.EmbeddedEval || nf6.WhiteScore != uciengine.MateIn(1) || nf6.PreviousWhiteScore != uciengine.Pawns(0.2) || nf6.Classification != Blunder {
+		t.Errorf("expected 3... Nf6 to be a blunder into mate, got %+v", nf6)
+	}
+	if !moves[0].HasClock || moves[1].Clock.Seconds() != 178.5 {
+		t.Errorf("expected the clocks to be read, got %v and %v", moves[0].Clock, moves[1].Clock)
+	}
+
+	// Moves without an evaluation are still searched
+	partial := strings.Replace(pgn, "{ [%eval 0.30] [%clk 0:03:00.0] }", "", 1)
+	moves, err = AnalyzeChessGame(partial, WithEmbeddedEvals(), WithDepth(3), WithEngineFactory(scholarsMateEngine().NewEngine))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if moves[0].EmbeddedEval || moves[0].Depth != 3 || !moves[1].EmbeddedEval || moves[1].WhiteScore != uciengine.Pawns(0.25) {
+		t.Errorf("expected only 1. e4 to be searched, got %+v and %+v", moves[0], moves[1])
+	}
+	// With an engine at hand, blunders get a refutation all the same
+	if !moves[5].EmbeddedEval || !reflect.DeepEqual(moves[5].Refutation, []string{"Qxf7#"}) {
+		t.Errorf("expected 3... Nf6 to be refuted by Qxf7#, got %v", moves[5].Refutation)
+	}
+
+	// Without the option, the evaluations are ignored
+	if _, err := AnalyzeChessGame(pgn, WithEngineFactory(noEngine)); err == nil {
+		t.Error("expected the engine to be needed without WithEmbeddedEvals")
+	}
+}
+
+func TestParseEval(t *testing.T) {
+	for value, want := range map[string]Score{"0.17": uciengine.Pawns(0.17), "-1.5": uciengine.Pawns(-1.5), "#3": uciengine.MateIn(3), "#-2": uciengine.MateIn(-2), "#-0": uciengine.Mated()} {
+		if got, err := parseEval(value); err != nil || got != want {
+			t.Errorf("parseEval(%q) = %v, %v; want %v", value, got, err, want)
+		}
+	}
+	if _, err := parseEval("+-"); err == nil {
+		t.Error("expected an invalid evaluation to fail")
+	}
+}
@@ -0,0 +1,181 @@
+package chessanalysis
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	chess "github.com/corentings/chess/v2"
+)
+
+// isNullMove reports whether a movetext token is a null move, in which the
+// side to move passes. Annotators write them as "--" or "Z0", to show what a
+// side threatens.
+func isNullMove(token string) bool {
+	san := strings.TrimRight(strings.TrimLeft(token, "0123456789."), "!?")
+	return san == "--" || san == "Z0"
+}
+
+// passTurn returns the position after a null move: the same board with the
+// other side to move and no en passant capture
+func passTurn(position *chess.Position) (*chess.Position, error) {
+	fields := strings.Fields(position.String())
+	if len(fields) != 6 {
+		return nil, fmt.Errorf("unexpected FEN %q", position.String())
+	}
+	halfMoves, _ := strconv.Atoi(fields[4])
+	fullMoves, _ := strconv.Atoi(fields[5])
+	fields[1], fields[3], fields[4] = "b", "-", strconv.Itoa(halfMoves+1)
+	if position.Turn() == chess.Black {
+		fields[1], fields[5] = "w", strconv.Itoa(fullMoves+1)
+	}
+	return positionFromFEN(strings.Join(fields, " "))
+}
+
+// splitNullMoves splits the movetext of a game at the null moves of its
+// mainline, returning the tag pairs and the stretches of movetext between
+// null moves. Variations holding null moves are left out, as only the
+// mainline is analyzed.
+func splitNullMoves(pgn string) (tags string, stretches []string) {
+	var stretch strings.Builder
+	for i := 0; i < len(pgn); {
+		c := pgn[i]
+		end := i + 1
+		switch {
+		case c == '[' && stretch.Len() == 0 && len(stretches) == 0:
+			// A tag pair, up to the end of its line
+			if end = strings.IndexByte(pgn[i:], '\n'); end < 0 {
+				end = len(pgn)
+			} else {
+				end += i + 1
+			}
+			tags += pgn[i:end]
+		case c == '{' || c == ';':
+			// A comment, up to its closing brace or the end of the line
+			closing := byte('}')
+			if c == ';' {
+				closing = '\n'
+			}
+			if j := strings.IndexByte(pgn[i:], closing); j >= 0 {
+				end = i + j + 1
+			} else {
+				end = len(pgn)
+			}
+			stretch.WriteString(pgn[i:end])
+		case c == '(':
+			depth := 0
+			for end = i; end < len(pgn); end++ {
+				if pgn[end] == '(' {
+					depth++
+				} else if pgn[end] == ')' {
+					depth--
+				}
+				if depth == 0 {
+					end++
+					break
+				}
+			}
+			if variation := pgn[i:min(end, len(pgn))]; !containsNullMove(variation) {
+				stretch.WriteString(variation)
+			}
+		case strings.ContainsRune(" \t\r\n", rune(c)):
+			stretch.WriteByte(c)
+		default:
+			for end < len(pgn) && !strings.ContainsRune(" \t\r\n{}();", rune(pgn[end])) {
+				end++
+			}
+			if token := pgn[i:end]; isNullMove(token) {
+				stretches = append(stretches, stretch.String())
+				stretch.Reset()
+			} else {
+				stretch.WriteString(token)
+			}
+		}
+		i = min(end, len(pgn))
+	}
+	return tags, append(stretches, stretch.String())
+}
+
+// containsNullMove reports whether movetext holds a null move
+func containsNullMove(movetext string) bool {
+	for _, token := range strings.FieldsFunc(movetext, func(r rune) bool {
+		return strings.ContainsRune(" \t\r\n()", r)
+	}) {
+		if isNullMove(token) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseMainline parses the mainline of a PGN game, with nil in place of its
+// null moves, which the chess library can't parse. Games with null moves are
+// parsed a stretch at a time, each stretch starting from the position the
+// null move before it left.
+func parseMainline(pgn string) ([]*chess.Move, error) {
+	if !containsNullMove(pgn) {
+		pgnOpt, err := chess.PGN(strings.NewReader(pgn))
+		if err != nil {
+			return nil, err
+		}
+		return chess.NewGame(pgnOpt).Moves(), nil
+	}
+
+	tags, stretches := splitNullMoves(pgn)
+	var moves []*chess.Move
+	var position *chess.Position
+	for i, stretch := range stretches {
+		text := tags + "\n" + stretch
+		if i > 0 {
+			text = fmt.Sprintf("[SetUp \"1\"]\n[FEN \"%s\"]\n\n%s", position, stretch)
+		}
+		if i < len(stretches)-1 {
+			// Only the last stretch has the result
+			text += " *"
+		}
+		pgnOpt, err := chess.PGN(strings.NewReader(text))
+		if err != nil {
+			return nil, err
+		}
+		game := chess.NewGame(pgnOpt)
+		stretchMoves := game.Moves()
+		moves = append(moves, stretchMoves...)
+		if i == len(stretches)-1 {
+			break
+		}
+		if len(stretchMoves) > 0 && stretchMoves[len(stretchMoves)-1].HasTag(chess.Check) {
+			return nil, fmt.Errorf("null move after %d moves while in check", len(moves))
+		}
+		if position, err = passTurn(game.Position()); err != nil {
+			return nil, err
+		}
+		moves = append(moves, nil)
+	}
+	return moves, nil
+}
+
+// analyzeFromPositions searches a move by the positions before and after it,
+// for moves the engine can't reach by replaying the game, such as those after
+// a null move. The position before the move gives the best move, and the one
+// after it the played move's score, unless it was the best move.
+func analyzeFromPositions(engine Engine, fenBefore, fenAfter, move string, limits SearchLimits) (*AnalysisResult, error) {
+	result, err := engine.AnalyzePosition(fenBefore, limits)
+	if err != nil {
+		return nil, err
+	}
+	result.BestLine = result.PlayedLine
+	if result.BestMove == move {
+		return result, nil
+	}
+	played, err := engine.AnalyzePosition(fenAfter, limits)
+	if err != nil {
+		return nil, err
+	}
+	result.WhiteScore = played.WhiteScore
+	result.WhiteWinProb, result.WhiteDrawProb, result.WhiteLossProb = played.WhiteWinProb, played.WhiteDrawProb, played.WhiteLossProb
+	result.Depth, result.SelDepth = played.Depth, played.SelDepth
+	result.Nodes, result.NPS, result.TimeSpent = played.Nodes, played.NPS, played.TimeSpent
+	result.HashFull, result.TBHits = played.HashFull, played.TBHits
+	result.PlayedLine = append([]string{move}, played.PlayedLine...)
+	return result, nil
+}
@@ -0,0 +1,71 @@
+package chessanalysis
+
+import (
+	"sync/atomic"
+	"testing"
+
+	chess "github.com/corentings/chess/v2"
+)
+
+// Black passes on move 2 to show White's threat
+const nullMovePgn = "[Result \"*\"]\n\n1. e4 e5 2. Nf3 -- {threatening Nxe5} 3. Nxe5 Nc6 *"
+
+func TestParseMainlineNullMoves(t *testing.T) {
+	moves, err := parseMainline(nullMovePgn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(moves) != 6 || moves[3] != nil {
+		t.Fatalf("expected 6 plies with the fourth a null move, got %v", moves)
+	}
+	before := moves[4].Parent().Position()
+	if got, want := before.String(), "rnbqkbnr/pppp1ppp/8/4p3/4P3/5N2/PPPP1PPP/RNBQKB1R w KQkq - 2 3"; got != want {
+		t.Errorf("expected the null move to pass the turn, got %s, want %s", got, want)
+	}
+	if moves[5].Position().Turn() != chess.White {
+		t.Errorf("expected White to move after 3...Nc6")
+	}
+
+	// Variations with null moves are left out, and Z0 is a null move too
+	moves, err = parseMainline("[Result \"*\"]\n\n1. e4 (1. d4 -- 2. c4) e5 2. Z0 {passing} Nc6 *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(moves) != 4 || moves[2] != nil || moves[3].Parent().Position().Turn() != chess.Black {
+		t.Errorf("unexpected mainline %v", moves)
+	}
+
+	if _, err := parseMainline("[Result \"*\"]\n\n1. e4 f5 2. Qh5+ -- *"); err == nil {
+		t.Error("expected a null move in check to fail")
+	}
+}
+
+func TestAnalyzeNullMoves(t *testing.T) {
+	var searches atomic.Int32
+	factory := func() (Engine, error) {
+		engine, err := (&FakeEngine{}).NewEngine()
+		return lastMoveCountingEngine{Engine: engine, searches: &searches}, err
+	}
+	moves, err := AnalyzeChessGame(nullMovePgn, WithDepth(3), WithEngineFactory(factory))
+	if err != nil {
+		t.Fatalf("failed to analyze game: %v", err)
+	}
+	var labels []string
+	for i := range moves {
+		labels = append(labels, MoveLabel(&moves[i]))
+	}
+	if got, want := labels, []string{"1. e4", "1... e5", "2. Nf3", "3. Nxe5", "3... Nc6"}; len(got) != len(want) || got[3] != want[3] || got[4] != want[4] {
+		t.Errorf("expected the null move to keep the numbering, got %v", got)
+	}
+	if got := searches.Load(); got != 3 {
+		t.Errorf("expected only the moves before the null move replayed, got %d", got)
+	}
+	if nxe5 := moves[3]; nxe5.BestMove == "" || nxe5.Depth == 0 {
+		t.Errorf("expected 3.Nxe5 searched by its position, got %+v", nxe5)
+	}
+
+	validation := ValidatePGN(nullMovePgn)
+	if !validation.Valid || validation.Games[0].Plies != 6 {
+		t.Errorf("expected a valid game of 6 plies, got %+v", validation)
+	}
+}
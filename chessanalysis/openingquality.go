@@ -0,0 +1,163 @@
+package chessanalysis
+
+import "strings"
+
+// OpeningQuality is how a player came out of the opening
+type OpeningQuality struct {
+	// Ply and Move are where the player emerged from the opening: the move
+	// that left the book, or their last move of the opening phase when the
+	// game wasn't checked against theory
+	Ply        int    `json:"ply"`
+	Move       string `json:"move"`
+	WhiteScore Score  `json:"whiteScore"` // Evaluation after Move
+	LeftBook   bool   `json:"leftBook"`   // Whether Move left the book, rather than ending the opening phase
+	// FirstInaccuracy is the player's first questionable move or blunder of
+	// the opening phase; nil if they made none
+	FirstInaccuracy *OpeningInaccuracy `json:"firstInaccuracy,omitempty"`
+	// InRepertoire reports whether the player kept to their repertoire until
+	// it ran out or the opponent left it, see WithRepertoire; nil without a
+	// repertoire or if the game never reached a position the player prepared
+	InRepertoire *bool `json:"inRepertoire,omitempty"`
+}
+
+// OpeningInaccuracy is a mistake of the opening phase
+type OpeningInaccuracy struct {
+	Ply            int     `json:"ply"` // Index of the move within the game
+	Move           string  `json:"move"`
+	Classification string  `json:"classification"`
+	CentipawnLoss  float64 `json:"centipawnLoss"`
+}
+
+// WithRepertoire checks the opening choices of the named player, by the
+// game's White and Black tags, against their repertoire, see
+// OpeningQuality.InRepertoire. Several players each have their own.
+func WithRepertoire(player string, repertoire *Repertoire) AnalyzeChessGameOption {
+	return func(opts *AnalyzeChessGameOptions) {
+		repertoires := make(map[string]*Repertoire, len(opts.Repertoires)+1)
+		for name, r := range opts.Repertoires {
+			repertoires[name] = r
+		}
+		repertoires[player] = repertoire
+		opts.Repertoires = repertoires
+	}
+}
+
+// AssessOpening returns how the player of the given color came out of the
+// opening, from where they left the book if exit is given, and the
+// repertoire they prepared if one is given. It returns nil if the player
+// made no moves, or had them all skipped with WithSide.
+func AssessOpening(moves []MoveAnalysis, color string, exit *BookExit, repertoire *Repertoire) *OpeningQuality {
+	if exit != nil && len(exit.BookMoves) == 0 && exit.Ply == firstMoveOf(moves, color) {
+		// The player was never in the book, as when it doesn't know the
+		// opening at all
+		exit = nil
+	}
+	var quality *OpeningQuality
+	inBook := false
+	for i := range moves {
+		move := &moves[i]
+		if move.Color != color || move.Skipped {
+			continue
+		}
+		if quality == nil {
+			// Games set up from a later position may leave the opening
+			// phase before the player's first move
+			quality = &OpeningQuality{Ply: i, Move: MoveLabel(move), WhiteScore: move.WhiteScore}
+		}
+		if exit == nil && !quality.LeftBook {
+			switch {
+			case move.Classification == Book:
+				inBook = true
+				quality.Ply, quality.Move, quality.WhiteScore = i, MoveLabel(move), move.WhiteScore
+			case inBook:
+				// Moves skipped as book moves show where the player left
+				// it when the game wasn't checked against theory
+				quality.Ply, quality.Move, quality.WhiteScore, quality.LeftBook = i, MoveLabel(move), move.WhiteScore, true
+			case move.Phase == Opening:
+				quality.Ply, quality.Move, quality.WhiteScore = i, MoveLabel(move), move.WhiteScore
+			}
+		}
+		if move.Phase == Opening && quality.FirstInaccuracy == nil &&
+			(move.Classification == Questionable || move.Classification == Blunder) {
+			quality.FirstInaccuracy = &OpeningInaccuracy{
+				Ply:            i,
+				Move:           MoveLabel(move),
+				Classification: move.Classification.String(),
+				CentipawnLoss:  move.CentipawnLoss,
+			}
+		}
+	}
+	if quality == nil {
+		return nil
+	}
+	if exit != nil {
+		quality.Ply, quality.Move, quality.WhiteScore, quality.LeftBook = exit.Ply, exit.Move, exit.WhiteScore, true
+	}
+	if repertoire != nil {
+		if kept, ok := keptRepertoire(moves, color, repertoire); ok {
+			quality.InRepertoire = &kept
+		}
+	}
+	return quality
+}
+
+// firstMoveOf returns the index of the first move of the side of the given
+// color, or -1 if they made none
+func firstMoveOf(moves []MoveAnalysis, color string) int {
+	for i := range moves {
+		if moves[i].Color == color {
+			return i
+		}
+	}
+	return -1
+}
+
+// keptRepertoire reports whether the side of the given color played their
+// repertoire moves in every position of it they reached before the game left
+// it. It reports false for ok if they reached none.
+func keptRepertoire(moves []MoveAnalysis, color string, repertoire *Repertoire) (kept, ok bool) {
+	for i := range moves {
+		move := &moves[i]
+		known, followed, valid := checkTheory(move, repertoire)
+		if !valid || len(known) == 0 {
+			break
+		}
+		if move.Color == color {
+			if !followed {
+				return false, true
+			}
+			ok = true
+		} else if !followed {
+			break
+		}
+	}
+	return ok, ok
+}
+
+// repertoireOf returns the repertoire of the named player, matched as
+// PlayerColor matches names, or nil if they have none
+func (o *EffectiveOptions) repertoireOf(player string) *Repertoire {
+	for name, repertoire := range o.repertoires {
+		if player != "" && strings.EqualFold(name, player) {
+			return repertoire
+		}
+	}
+	return nil
+}
+
+// assessOpenings sets how each player came out of the opening, from their
+// book exits and the repertoires of the options
+func (g *GameAnalysis) assessOpenings() {
+	for _, color := range []string{"White", "Black"} {
+		player := g.Summary.player(color)
+		player.OpeningQuality = AssessOpening(g.Moves, color, player.BookExit, g.Options.repertoireOf(g.Headers[color]))
+	}
+}
+
+// CheckTheory finds the game's novelty and where each player left the book
+// against theory, and how that leaves them out of the opening
+func (g *GameAnalysis) CheckTheory(theory Theory) {
+	g.Novelty = FindNovelty(g.Moves, theory)
+	g.Summary.White.BookExit, g.Summary.Black.BookExit = FindBookExits(g.Moves, theory)
+	g.assessOpenings()
+}
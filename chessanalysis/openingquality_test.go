@@ -0,0 +1,66 @@
+package chessanalysis
+
+import "testing"
+
+func TestAssessOpening(t *testing.T) {
+	game, err := AnalyzeGame(scholarsMatePgn, WithDepth(3), WithEngineFactory(scholarsMateEngine().NewEngine))
+	if err != nil {
+		t.Fatalf("failed to analyze game: %v", err)
+	}
+	// Without theory the players come out of the opening with their last
+	// move of the opening phase
+	black := game.Summary.Black.OpeningQuality
+	if black == nil || black.LeftBook || black.Ply != 5 || black.WhiteScore != game.Moves[5].WhiteScore {
+		t.Fatalf("expected Black to come out of the opening with 3... Nf6, got %+v", black)
+	}
+	if black.FirstInaccuracy == nil || black.FirstInaccuracy.Move != "3... Nf6" || black.FirstInaccuracy.Classification != "Blunder" {
+		t.Errorf("expected 3... Nf6 to be Black's first mistake, got %+v", black.FirstInaccuracy)
+	}
+	if black.InRepertoire != nil {
+		t.Errorf("expected no repertoire check without a repertoire, got %v", *black.InRepertoire)
+	}
+
+	moves := append([]MoveAnalysis(nil), game.Moves...)
+	moves[0].Classification, moves[2].Classification = Book, Book
+	if white := AssessOpening(moves, "White", nil, nil); white == nil || !white.LeftBook || white.Move != "3. Bc4" {
+		t.Errorf("expected White to leave the book skipped as book moves with 3. Bc4, got %+v", white)
+	}
+	exit := &BookExit{Ply: 2, Move: "2. Qh5", BookMoves: []string{"Nf3"}}
+	if white := AssessOpening(game.Moves, "White", exit, nil); white == nil || !white.LeftBook || white.Move != "2. Qh5" {
+		t.Errorf("expected White to leave the book at the book exit, got %+v", white)
+	}
+	// Theory that doesn't know the game has every player leave it at once
+	exit = &BookExit{Ply: 0, Move: "1. e4"}
+	if white := AssessOpening(game.Moves, "White", exit, nil); white == nil || white.LeftBook || white.Ply != 6 {
+		t.Errorf("expected White never in the book to come out of the opening phase, got %+v", white)
+	}
+}
+
+func TestOpeningRepertoire(t *testing.T) {
+	for _, test := range []struct {
+		name       string
+		repertoire string
+		color      string
+		want       *bool
+	}{
+		{"player deviated", "1. e4 e5 2. Nf3 *", "White", new(bool)},
+		{"kept while it lasted", "1. e4 e5 2. Qh5 Nc6 *", "Black", func() *bool { kept := true; return &kept }()},
+		{"opponent left it first", "1. d4 d5 *", "Black", nil},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			repertoire, err := NewRepertoire("[Event \"Repertoire\"]\n\n" + test.repertoire)
+			if err != nil {
+				t.Fatal(err)
+			}
+			game, err := AnalyzeGame(scholarsMatePgn, WithDepth(3), WithRepertoire("player 1", repertoire), WithRepertoire("Player 2", repertoire),
+				WithEngineFactory(scholarsMateEngine().NewEngine))
+			if err != nil {
+				t.Fatalf("failed to analyze game: %v", err)
+			}
+			got := game.Summary.player(test.color).OpeningQuality.InRepertoire
+			if (got == nil) != (test.want == nil) || (got != nil && *got != *test.want) {
+				t.Errorf("expected %v, got %v", test.want, got)
+			}
+		})
+	}
+}
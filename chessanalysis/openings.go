@@ -0,0 +1,214 @@
+package chessanalysis
+
+import (
+	"fmt"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// OpeningStats is one player's results and move quality in one opening
+type OpeningStats struct {
+	ECO      string  `json:"eco"`
+	Name     string  `json:"name"`
+	Games    int     `json:"games"`
+	Wins     int     `json:"wins"`
+	Draws    int     `json:"draws"`
+	Losses   int     `json:"losses"`
+	Score    float64 `json:"score"`    // Points per game, from 0 to 1
+	Accuracy float64 `json:"accuracy"` // Mean accuracy over the player's moves
+	// TypicalBlunderMove is the median move number of the player's blunders, or 0 if there were none
+	TypicalBlunderMove int `json:"typicalBlunderMove"`
+	// CommonDeviation is the move most often played where a game left the
+	// most common line of this opening, e.g. "6. d3"
+	CommonDeviation      string `json:"commonDeviation,omitempty"`
+	CommonDeviationCount int    `json:"commonDeviationCount,omitempty"`
+}
+
+// PlayerColor returns the color the named player had in the game, or "" if
+// they didn't play in it. Names are compared case-insensitively.
+func (g *GameAnalysis) PlayerColor(player string) string {
+	switch {
+	case strings.EqualFold(g.Headers["White"], player):
+		return "White"
+	case strings.EqualFold(g.Headers["Black"], player):
+		return "Black"
+	default:
+		return ""
+	}
+}
+
+// PlayerScore returns the points the side with the given color scored, and
+// whether the game has a decisive or drawn result
+func (g *GameAnalysis) PlayerScore(color string) (float64, bool) {
+	switch g.Headers["Result"] {
+	case "1-0":
+		if color == "White" {
+			return 1, true
+		}
+		return 0, true
+	case "0-1":
+		if color == "Black" {
+			return 1, true
+		}
+		return 0, true
+	case "1/2-1/2":
+		return 0.5, true
+	default:
+		return 0, false
+	}
+}
+
+// OpeningName returns the name of the game's opening from its headers
+func (g *GameAnalysis) OpeningName() string {
+	if name := g.Headers["Opening"]; name != "" {
+		return name
+	}
+	if url := g.Headers["ECOUrl"]; url != "" {
+		return strings.ReplaceAll(path.Base(url), "-", " ")
+	}
+	return ""
+}
+
+// OpeningReport aggregates the named player's games per ECO code, sorted by
+// number of games played, to show which openings cost them the most
+func OpeningReport(games []*GameAnalysis, player string) []OpeningStats {
+	type openingGames struct {
+		stats    OpeningStats
+		games    []*GameAnalysis
+		blunders []int
+		moves    int
+	}
+	openings := make(map[string]*openingGames)
+	var order []string
+
+	for _, game := range games {
+		color := game.PlayerColor(player)
+		if color == "" {
+			continue
+		}
+		eco := game.Headers["ECO"]
+		if eco == "" {
+			eco = "?"
+		}
+		opening, ok := openings[eco]
+		if !ok {
+			opening = &openingGames{stats: OpeningStats{ECO: eco, Name: game.OpeningName()}}
+			openings[eco] = opening
+			order = append(order, eco)
+		}
+		opening.games = append(opening.games, game)
+		opening.stats.Games++
+
+		if score, ok := game.PlayerScore(color); ok {
+			opening.stats.Score += score
+			switch score {
+			case 1:
+				opening.stats.Wins++
+			case 0:
+				opening.stats.Losses++
+			default:
+				opening.stats.Draws++
+			}
+		}
+		for _, move := range game.Moves {
+			if move.Color != color {
+				continue
+			}
+			opening.moves++
+			opening.stats.Accuracy += move.Accuracy
+			if move.Classification == Blunder {
+				opening.blunders = append(opening.blunders, move.MoveNumber)
+			}
+		}
+	}
+
+	report := make([]OpeningStats, 0, len(order))
+	for _, eco := range order {
+		opening := openings[eco]
+		stats := opening.stats
+		stats.Score /= float64(stats.Games)
+		if opening.moves > 0 {
+			stats.Accuracy /= float64(opening.moves)
+		}
+		if len(opening.blunders) > 0 {
+			slices.Sort(opening.blunders)
+			stats.TypicalBlunderMove = opening.blunders[len(opening.blunders)/2]
+		}
+		stats.CommonDeviation, stats.CommonDeviationCount = commonDeviation(opening.games)
+		report = append(report, stats)
+	}
+	sort.SliceStable(report, func(i, j int) bool {
+		return report[i].Games > report[j].Games
+	})
+	return report
+}
+
+// LichessAnalysisURL returns a link that opens the position on the Lichess
+// analysis board. FENs only contain URL-safe characters apart from spaces.
+func LichessAnalysisURL(fen string) string {
+	return "https://lichess.org/analysis/" + strings.ReplaceAll(fen, " ", "_")
+}
+
+// MoveLabel formats a move with its number, e.g. "6. d3" or "6... Nf6"
+func MoveLabel(move *MoveAnalysis) string {
+	separator := ". "
+	if move.Color == "Black" {
+		separator = "... "
+	}
+	return fmt.Sprintf("%d%s%s", move.MoveNumber, separator, move.MoveText)
+}
+
+// commonDeviation finds where each game left the most common line among the
+// games and returns the most frequent deviating move
+func commonDeviation(games []*GameAnalysis) (string, int) {
+	if len(games) < 2 {
+		return "", 0
+	}
+	counts := make(map[string]int)
+	for _, game := range games {
+		for ply, move := range game.Moves {
+			if mainLineMove(games, game.Moves[:ply]) == move.MoveText {
+				continue
+			}
+			counts[MoveLabel(&move)]++
+			break
+		}
+	}
+
+	deviation, count := "", 0
+	for move, n := range counts {
+		if n > count || (n == count && move < deviation) {
+			deviation, count = move, n
+		}
+	}
+	return deviation, count
+}
+
+// mainLineMove returns the move most often played after the given moves among the games
+func mainLineMove(games []*GameAnalysis, prefix []MoveAnalysis) string {
+	counts := make(map[string]int)
+	best, bestCount := "", 0
+	for _, game := range games {
+		if len(game.Moves) <= len(prefix) {
+			continue
+		}
+		matches := true
+		for i := range prefix {
+			if game.Moves[i].MoveText != prefix[i].MoveText {
+				matches = false
+				break
+			}
+		}
+		if !matches {
+			continue
+		}
+		move := game.Moves[len(prefix)].MoveText
+		counts[move]++
+		if counts[move] > bestCount || (counts[move] == bestCount && move < best) {
+			best, bestCount = move, counts[move]
+		}
+	}
+	return best
+}
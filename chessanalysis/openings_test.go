@@ -0,0 +1,78 @@
+package chessanalysis
+
+import "testing"
+
+// testGame builds an analyzed game from SAN moves with the given classifications by ply
+func testGame(white, black, result, eco string, moves []string, classifications map[int]MoveClassification) *GameAnalysis {
+	game := &GameAnalysis{
+		Headers: map[string]string{"White": white, "Black": black, "Result": result, "ECO": eco},
+	}
+	for i, san := range moves {
+		color := "White"
+		if i%2 == 1 {
+			color = "Black"
+		}
+		game.Moves = append(game.Moves, MoveAnalysis{
+			MoveNumber:     i/2 + 1,
+			Color:          color,
+			MoveText:       san,
+			Accuracy:       80,
+			Classification: classifications[i],
+		})
+	}
+	return game
+}
+
+func TestOpeningReport(t *testing.T) {
+	games := []*GameAnalysis{
+		testGame("me", "them", "1-0", "C50", []string{"e4", "e5", "Nf3", "Nc6", "Bc4", "Bc5"}, nil),
+		testGame("me", "them", "0-1", "C50", []string{"e4", "e5", "Nf3", "Nc6", "Bc4", "Nf6"}, map[int]MoveClassification{4: Blunder}),
+		testGame("them", "Me", "1/2-1/2", "B01", []string{"e4", "d5"}, nil),
+		testGame("someone", "else", "1-0", "C50", []string{"e4", "e5"}, nil),
+	}
+
+	report := OpeningReport(games, "me")
+	if len(report) != 2 {
+		t.Fatalf("expected 2 openings, got %d", len(report))
+	}
+
+	italian := report[0]
+	if italian.ECO != "C50" || italian.Games != 2 || italian.Wins != 1 || italian.Losses != 1 {
+		t.Errorf("unexpected C50 stats: %+v", italian)
+	}
+	if italian.Score != 0.5 || italian.Accuracy != 80 {
+		t.Errorf("unexpected C50 score %.2f or accuracy %.2f", italian.Score, italian.Accuracy)
+	}
+	if italian.TypicalBlunderMove != 3 {
+		t.Errorf("expected typical blunder on move 3, got %d", italian.TypicalBlunderMove)
+	}
+	if italian.CommonDeviation != "3... Nf6" || italian.CommonDeviationCount != 1 {
+		t.Errorf("unexpected common deviation %q (%d)", italian.CommonDeviation, italian.CommonDeviationCount)
+	}
+
+	scandinavian := report[1]
+	if scandinavian.ECO != "B01" || scandinavian.Draws != 1 || scandinavian.Score != 0.5 {
+		t.Errorf("unexpected B01 stats: %+v", scandinavian)
+	}
+}
+
+func TestAnalyzeChessGames(t *testing.T) {
+	database := scholarsMatePgn + "\n" + `
+[Event "Short Game"]
+[White "Player 3"]
+[Black "Player 4"]
+[Result "*"]
+
+1. d4 d5 *
+`
+	games, err := AnalyzeChessGames(database, WithEngineFactory((&FakeEngine{}).NewEngine))
+	if err != nil {
+		t.Fatalf("failed to analyze games: %v", err)
+	}
+	if len(games) != 2 {
+		t.Fatalf("expected 2 analyzed games, got %d", len(games))
+	}
+	if games[1].Headers["White"] != "Player 3" || len(games[1].Moves) != 2 {
+		t.Errorf("unexpected second game: %v with %d moves", games[1].Headers, len(games[1].Moves))
+	}
+}
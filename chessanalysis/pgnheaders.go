@@ -0,0 +1,37 @@
+package chessanalysis
+
+import (
+	"fmt"
+	"io"
+	"slices"
+)
+
+// pgnTagOrder is the order of the Seven Tag Roster, which comes first in a PGN
+var pgnTagOrder = []string{"Event", "Site", "Date", "Round", "White", "Black", "Result"}
+
+// WritePGNHeaders writes the tag pairs of a PGN game and the blank line after
+// them: the Seven Tag Roster, with "?" or "*" for missing tags, and then the
+// other tags in alphabetical order
+func WritePGNHeaders(w io.Writer, headers map[string]string) {
+	for _, tag := range pgnTagOrder {
+		value := headers[tag]
+		if value == "" {
+			value = "?"
+			if tag == "Result" {
+				value = "*"
+			}
+		}
+		fmt.Fprintf(w, "[%s %q]\n", tag, value)
+	}
+	var extra []string
+	for tag := range headers {
+		if !slices.Contains(pgnTagOrder, tag) {
+			extra = append(extra, tag)
+		}
+	}
+	slices.Sort(extra)
+	for _, tag := range extra {
+		fmt.Fprintf(w, "[%s %q]\n", tag, headers[tag])
+	}
+	io.WriteString(w, "\n")
+}
@@ -0,0 +1,64 @@
+package chessanalysis
+
+import (
+	"fmt"
+
+	chess "github.com/corentings/chess/v2"
+)
+
+// GamePhase is the stage of the game a move was played in
+type GamePhase int
+
+const (
+	Opening GamePhase = iota
+	Middlegame
+	Endgame
+)
+
+var gamePhaseNames = []string{"Opening", "Middlegame", "Endgame"}
+
+func (p GamePhase) String() string {
+	return gamePhaseNames[p]
+}
+
+// ParseGamePhase returns the phase with the given name
+func ParseGamePhase(name string) (GamePhase, error) {
+	for i, n := range gamePhaseNames {
+		if n == name {
+			return GamePhase(i), nil
+		}
+	}
+	return Opening, fmt.Errorf("unknown game phase %q", name)
+}
+
+const (
+	// openingMaxMoveNumber is the last move number that can still be part of the opening
+	openingMaxMoveNumber = 12
+	// middlegamePieceCount is the number of knights, bishops, rooks, and queens
+	// left on the board at or below which the opening is over
+	middlegamePieceCount = 10
+	// endgamePieceCount is the number of knights, bishops, rooks, and queens
+	// left on the board at or below which the endgame has started
+	endgamePieceCount = 6
+)
+
+// detectPhase classifies the position a move is played from. Phases only move
+// forward, so previous is the phase of the preceding move.
+func detectPhase(position *chess.Position, moveNumber int, previous GamePhase) GamePhase {
+	pieces := 0
+	for _, piece := range position.Board().SquareMap() {
+		switch piece.Type() {
+		case chess.Knight, chess.Bishop, chess.Rook, chess.Queen:
+			pieces++
+		}
+	}
+
+	phase := Opening
+	switch {
+	case pieces <= endgamePieceCount:
+		phase = Endgame
+	case pieces <= middlegamePieceCount || moveNumber > openingMaxMoveNumber:
+		phase = Middlegame
+	}
+	return max(phase, previous)
+}
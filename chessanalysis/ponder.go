@@ -0,0 +1,122 @@
+package chessanalysis
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// maxKibitzCacheSize is how many positions a KibitzCache keeps before
+// forgetting the oldest
+const maxKibitzCacheSize = 10000
+
+// KibitzCache keeps the final kibitz evaluations of positions, so that a
+// position searched ahead of time by Ponder is shown straight away. It is safe
+// for concurrent use.
+type KibitzCache struct {
+	mu      sync.Mutex
+	updates map[string]KibitzUpdate // By fenKey
+	added   map[string]time.Time    // When each update was kept, see Purge
+	order   []string                // Keys, oldest first
+}
+
+// NewKibitzCache returns an empty cache
+func NewKibitzCache() *KibitzCache {
+	return &KibitzCache{updates: make(map[string]KibitzUpdate), added: make(map[string]time.Time)}
+}
+
+// Get returns the deepest evaluation of the position given as a FEN, if it
+// has been searched
+func (c *KibitzCache) Get(fen string) (KibitzUpdate, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	update, ok := c.updates[fenKey(fen)]
+	if ok {
+		// Positions reached by other move orders differ in their move counters
+		update.FEN = fen
+	}
+	return update, ok
+}
+
+// Put keeps a final evaluation, unless the position was searched deeper
+// already
+func (c *KibitzCache) Put(update KibitzUpdate) {
+	key := fenKey(update.FEN)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if cached, ok := c.updates[key]; ok {
+		if cached.Depth < update.Depth {
+			c.updates[key], c.added[key] = update, time.Now()
+		}
+		return
+	}
+	if len(c.order) >= maxKibitzCacheSize {
+		delete(c.updates, c.order[0])
+		delete(c.added, c.order[0])
+		c.order = c.order[1:]
+	}
+	c.updates[key], c.added[key] = update, time.Now()
+	c.order = append(c.order, key)
+}
+
+// Purge forgets the evaluations kept before the given time, returning how
+// many it forgot
+func (c *KibitzCache) Purge(before time.Time) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	kept := c.order[:0]
+	for _, key := range c.order {
+		if c.added[key].Before(before) {
+			delete(c.updates, key)
+			delete(c.added, key)
+		} else {
+			kept = append(kept, key)
+		}
+	}
+	purged := len(c.order) - len(kept)
+	c.order = kept
+	return purged
+}
+
+// Ponder searches the positions given as FENs ahead of time with an idle
+// engine of the pool, keeping their evaluations in cache. It does nothing if
+// every engine is busy, and gives way, abandoning the search in progress, as
+// soon as an analysis is waiting for an engine. Positions already in cache at
+// the depth of limits are skipped.
+func Ponder(ctx context.Context, pool *EnginePool, factory EngineFactory, cache *KibitzCache, fens []string, limits SearchLimits) error {
+	var todo []string
+	for _, fen := range fens {
+		if cached, ok := cache.Get(fen); !ok || cached.Depth < limits.Depth {
+			todo = append(todo, fen)
+		}
+	}
+	if len(todo) == 0 {
+		return nil
+	}
+	engine, ok, err := pool.TryAcquire(factory)
+	if !ok || err != nil {
+		return err
+	}
+	defer engine.Close()
+	ctx, giveWay := context.WithCancel(ctx)
+	defer giveWay()
+	for _, fen := range todo {
+		if pool.Waiting() > 0 {
+			return nil
+		}
+		err := Kibitz(ctx, engine, fen, limits, func(update KibitzUpdate) {
+			if update.Final {
+				cache.Put(update)
+			} else if pool.Waiting() > 0 {
+				giveWay()
+			}
+		})
+		if err != nil {
+			if pool.Waiting() > 0 {
+				return nil
+			}
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package chessanalysis
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/walterschell/chess-analyzer/chessanalysis/uciengine"
+)
+
+func TestPonder(t *testing.T) {
+	const afterE4 = "rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq e3 0 1"
+	fake := &FakeEngine{Positions: map[string]FakeEvaluation{
+		afterE4: {BestMove: "c7c5", Score: -30},
+	}}
+	pool := NewEnginePool(1)
+	cache := NewKibitzCache()
+	fens := []string{BenchmarkPositions[0], afterE4}
+	if err := Ponder(context.Background(), pool, fake.NewEngine, cache, fens, SearchLimits{Depth: 6}); err != nil {
+		t.Fatal(err)
+	}
+	for _, fen := range fens {
+		if update, ok := cache.Get(fen); !ok || update.Depth != 6 || !update.Final {
+			t.Errorf("expected %s to be searched to depth 6, got %+v", fen, update)
+		}
+	}
+	// The same position reached at another move number is found too
+	update, ok := cache.Get("rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq e3 4 9")
+	if !ok || update.WhiteScore != uciengine.Pawns(0.3) || update.FEN != "rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq e3 4 9" {
+		t.Errorf("expected the cached evaluation under the requested FEN, got %+v", update)
+	}
+	// A shallower search doesn't replace a deeper one
+	cache.Put(KibitzUpdate{FEN: afterE4, Depth: 2, Final: true})
+	if update, _ := cache.Get(afterE4); update.Depth != 6 {
+		t.Errorf("expected the deeper evaluation to be kept, got %+v", update)
+	}
+	if free := freeEngines(pool); free != 1 {
+		t.Errorf("expected the engine to be free again, got %d free", free)
+	}
+}
+
+func TestKibitzCachePurge(t *testing.T) {
+	cache := NewKibitzCache()
+	cache.Put(KibitzUpdate{FEN: BenchmarkPositions[0], Depth: 6, Final: true})
+	cache.Put(KibitzUpdate{FEN: BenchmarkPositions[1], Depth: 6, Final: true})
+	if purged := cache.Purge(time.Now().Add(-time.Hour)); purged != 0 {
+		t.Errorf("expected nothing kept in the last hour purged, got %d", purged)
+	}
+	if purged := cache.Purge(time.Now().Add(time.Second)); purged != 2 {
+		t.Errorf("expected 2 evaluations purged, got %d", purged)
+	}
+	if _, ok := cache.Get(BenchmarkPositions[0]); ok {
+		t.Error("expected the purged evaluation to be forgotten")
+	}
+	// The cache fills up again after a purge
+	cache.Put(KibitzUpdate{FEN: BenchmarkPositions[0], Depth: 6, Final: true})
+	if _, ok := cache.Get(BenchmarkPositions[0]); !ok {
+		t.Error("expected a new evaluation to be kept")
+	}
+}
+
+func TestPonderGivesWay(t *testing.T) {
+	factory := (&FakeEngine{}).NewEngine
+	pool := NewEnginePool(1)
+	busy, err := pool.Acquire(context.Background(), InteractivePriority, factory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache := NewKibitzCache()
+	if err := Ponder(context.Background(), pool, factory, cache, BenchmarkPositions[:1], SearchLimits{Depth: 2}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := cache.Get(BenchmarkPositions[0]); ok {
+		t.Error("expected no pondering while every engine is busy")
+	}
+
+	// Analyses queued for the engine are counted as waiting
+	waiting := make(chan struct{})
+	go func() {
+		defer close(waiting)
+		engine, err := pool.Acquire(context.Background(), BackgroundPriority, factory)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		engine.Close()
+	}()
+	waitForQueue(t, pool, BackgroundPriority, 1)
+	if pool.Waiting() != 1 {
+		t.Errorf("expected 1 analysis waiting, got %d", pool.Waiting())
+	}
+	busy.Close()
+	<-waiting
+	if free := freeEngines(pool); free != 1 {
+		t.Errorf("expected the engine to be free again, got %d free", free)
+	}
+}
@@ -0,0 +1,254 @@
+package chessanalysis
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/walterschell/chess-analyzer/chessanalysis/uciengine"
+)
+
+// Priority orders the analyses waiting for an engine from an EnginePool
+type Priority int
+
+const (
+	BackgroundPriority  Priority = iota // Batch analyses and imports nobody is watching
+	InteractivePriority                 // Analyses a user is waiting on
+)
+
+// EnginePool limits how many engines run at once. When every engine is busy,
+// the next one to close goes to the highest priority analysis waiting, and to
+// the longest waiting among analyses of the same priority, so a big background
+// import doesn't hold up interactive requests. Engines from the pool that are
+// asked for the same search at the same time run it once and share the result.
+// It is safe for concurrent use.
+type EnginePool struct {
+	mu        sync.Mutex
+	free      int
+	waiting   [InteractivePriority + 1][]chan struct{}
+	searches  map[string]*search // Searches in progress by what they search
+	coalesced int
+	hashMB    int // Hash size of each engine, see SetHashMB
+	threads   int // Threads of each engine, see SetThreads
+}
+
+// engineResizer is implemented by engines whose Hash and Threads can be
+// changed once they have started
+type engineResizer interface {
+	SetHash(mb int)
+	SetThreads(threads int)
+}
+
+// search is a search in progress whose result is shared by everyone asking for it
+type search struct {
+	done   chan struct{}
+	result *AnalysisResult
+	err    error
+}
+
+// NewEnginePool creates a pool that runs at most size engines at once. Each
+// engine's Hash and Threads are its share of the memory and cores available,
+// see uciengine.AutoHashMB and uciengine.AutoThreads.
+func NewEnginePool(size int) *EnginePool {
+	return &EnginePool{
+		free:     size,
+		searches: make(map[string]*search),
+		hashMB:   uciengine.AutoHashMB(size),
+		threads:  uciengine.AutoThreads(size),
+	}
+}
+
+// SetHashMB sets the Hash size, in MB, of the engines the pool starts from now
+// on, instead of their share of the memory available
+func (p *EnginePool) SetHashMB(mb int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.hashMB = mb
+}
+
+// SetThreads sets how many threads the engines the pool starts from now on
+// search with, instead of their share of the cores
+func (p *EnginePool) SetThreads(threads int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.threads = threads
+}
+
+// Coalesced returns how many searches shared the result of an identical
+// search already in progress instead of running their own
+func (p *EnginePool) Coalesced() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.coalesced
+}
+
+// coalesce runs the search identified by key, unless the same search is
+// already in progress, in which case it waits for that one's result
+func (p *EnginePool) coalesce(key string, run func() (*AnalysisResult, error)) (*AnalysisResult, error) {
+	p.mu.Lock()
+	if inProgress, ok := p.searches[key]; ok {
+		p.coalesced++
+		p.mu.Unlock()
+		<-inProgress.done
+		if inProgress.err != nil {
+			return nil, inProgress.err
+		}
+		// Callers may modify their result
+		return inProgress.result.Clone(), nil
+	}
+	s := &search{done: make(chan struct{})}
+	p.searches[key] = s
+	p.mu.Unlock()
+
+	s.result, s.err = run()
+	p.mu.Lock()
+	delete(p.searches, key)
+	p.mu.Unlock()
+	close(s.done)
+	if s.err != nil {
+		return nil, s.err
+	}
+	return s.result.Clone(), nil
+}
+
+// Acquire waits until the pool has room for an engine, then starts one with
+// the factory. Closing the engine makes room for the next one.
+func (p *EnginePool) Acquire(ctx context.Context, priority Priority, factory EngineFactory) (Engine, error) {
+	if priority < BackgroundPriority || priority > InteractivePriority {
+		return nil, fmt.Errorf("%w: unknown priority %d", ErrInvalidOptions, priority)
+	}
+	if err := p.wait(ctx, priority); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrAnalysisCancelled, err)
+	}
+	return p.start(factory)
+}
+
+// start starts an engine in a slot the caller holds, freeing the slot if it
+// fails
+func (p *EnginePool) start(factory EngineFactory) (Engine, error) {
+	engine, err := factory()
+	if err != nil {
+		p.release()
+		return nil, err
+	}
+	p.mu.Lock()
+	hashMB, threads := p.hashMB, p.threads
+	p.mu.Unlock()
+	if resizer, ok := engine.(engineResizer); ok {
+		if hashMB > 0 {
+			resizer.SetHash(hashMB)
+		}
+		if threads > 0 {
+			resizer.SetThreads(threads)
+		}
+	}
+	return &pooledEngine{Engine: engine, pool: p}, nil
+}
+
+// TryAcquire starts an engine with the factory if the pool has room for one
+// right now, without waiting. It reports false if every engine is busy.
+func (p *EnginePool) TryAcquire(factory EngineFactory) (Engine, bool, error) {
+	p.mu.Lock()
+	if p.free == 0 {
+		p.mu.Unlock()
+		return nil, false, nil
+	}
+	p.free--
+	p.mu.Unlock()
+	engine, err := p.start(factory)
+	return engine, err == nil, err
+}
+
+// Waiting returns how many analyses are waiting for an engine
+func (p *EnginePool) Waiting() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	waiting := 0
+	for _, queue := range p.waiting {
+		waiting += len(queue)
+	}
+	return waiting
+}
+
+// wait blocks until a slot is handed to the caller or ctx is done
+func (p *EnginePool) wait(ctx context.Context, priority Priority) error {
+	p.mu.Lock()
+	if p.free > 0 {
+		// Slots are only free while nobody is waiting
+		p.free--
+		p.mu.Unlock()
+		return nil
+	}
+	ready := make(chan struct{})
+	p.waiting[priority] = append(p.waiting[priority], ready)
+	p.mu.Unlock()
+
+	select {
+	case <-ready:
+		return nil
+	case <-ctx.Done():
+		p.mu.Lock()
+		if i := slices.Index(p.waiting[priority], ready); i >= 0 {
+			p.waiting[priority] = slices.Delete(p.waiting[priority], i, i+1)
+			p.mu.Unlock()
+			return ctx.Err()
+		}
+		p.mu.Unlock()
+		// The slot was handed over as the context finished; pass it on
+		p.release()
+		return ctx.Err()
+	}
+}
+
+// release hands a slot to the next waiting analysis, or frees it
+func (p *EnginePool) release() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for priority := len(p.waiting) - 1; priority >= 0; priority-- {
+		if len(p.waiting[priority]) > 0 {
+			next := p.waiting[priority][0]
+			p.waiting[priority] = p.waiting[priority][1:]
+			close(next)
+			return
+		}
+	}
+	p.free++
+}
+
+// pooledEngine shares identical searches with the other engines of its pool
+// and returns its slot to the pool when closed
+type pooledEngine struct {
+	Engine
+	pool *EnginePool
+	once sync.Once
+}
+
+func (e *pooledEngine) AnalyzeLastMove(moves []string, limits SearchLimits) (*AnalysisResult, error) {
+	key := fmt.Sprintf("%q moves %s %+v", e.kind(), strings.Join(moves, " "), limits)
+	return e.pool.coalesce(key, func() (*AnalysisResult, error) {
+		return e.Engine.AnalyzeLastMove(moves, limits)
+	})
+}
+
+func (e *pooledEngine) AnalyzePosition(fen string, limits SearchLimits) (*AnalysisResult, error) {
+	key := fmt.Sprintf("%q fen %s %+v", e.kind(), fen, limits)
+	return e.pool.coalesce(key, func() (*AnalysisResult, error) {
+		return e.Engine.AnalyzePosition(fen, limits)
+	})
+}
+
+// kind tells engines whose searches aren't interchangeable apart by the name
+// they report, so that a HeuristicEngine standing in for Stockfish, or Lc0
+// sharing the pool with it, doesn't share its searches with the others
+func (e *pooledEngine) kind() string {
+	info, _ := DescribeEngine(e.Engine)
+	return info.Name
+}
+
+func (e *pooledEngine) Close() error {
+	err := e.Engine.Close()
+	e.once.Do(e.pool.release)
+	return err
+}
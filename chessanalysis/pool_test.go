@@ -0,0 +1,201 @@
+package chessanalysis
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/walterschell/chess-analyzer/chessanalysis/uciengine"
+)
+
+// waitForQueue waits until the pool has n analyses waiting at the priority
+func waitForQueue(t *testing.T, pool *EnginePool, priority Priority, n int) {
+	t.Helper()
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		pool.mu.Lock()
+		waiting := len(pool.waiting[priority])
+		pool.mu.Unlock()
+		if waiting == n {
+			return
+		}
+	}
+	t.Fatalf("expected %d analyses waiting at priority %d", n, priority)
+}
+
+// freeEngines returns how many engines the pool could start without waiting
+func freeEngines(pool *EnginePool) int {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	return pool.free
+}
+
+func TestEnginePoolPriorities(t *testing.T) {
+	factory := (&FakeEngine{}).NewEngine
+	pool := NewEnginePool(1)
+	busy, err := pool.Acquire(context.Background(), BackgroundPriority, factory)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	started := make(chan Priority, 2)
+	acquire := func(priority Priority) {
+		engine, err := pool.Acquire(context.Background(), priority, factory)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		engine.Close()
+		started <- priority
+	}
+	go acquire(BackgroundPriority)
+	waitForQueue(t, pool, BackgroundPriority, 1)
+	go acquire(InteractivePriority)
+	waitForQueue(t, pool, InteractivePriority, 1)
+
+	busy.Close()
+	if first, second := <-started, <-started; first != InteractivePriority || second != BackgroundPriority {
+		t.Errorf("expected the interactive analysis to start first, got %d then %d", first, second)
+	}
+	if free := freeEngines(pool); free != 1 {
+		t.Errorf("expected the engine to be free again, got %d free", free)
+	}
+}
+
+func TestEnginePoolCancellation(t *testing.T) {
+	factory := (&FakeEngine{}).NewEngine
+	pool := NewEnginePool(1)
+	busy, err := pool.Acquire(context.Background(), InteractivePriority, factory)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		_, err := pool.Acquire(ctx, BackgroundPriority, factory)
+		done <- err
+	}()
+	waitForQueue(t, pool, BackgroundPriority, 1)
+	cancel()
+	if err := <-done; !errors.Is(err, ErrAnalysisCancelled) {
+		t.Errorf("expected a cancelled wait, got %v", err)
+	}
+	waitForQueue(t, pool, BackgroundPriority, 0)
+
+	busy.Close()
+	busy.Close() // Closing twice frees the slot once
+	if free := freeEngines(pool); free != 1 {
+		t.Errorf("expected one free engine, got %d", free)
+	}
+
+	// Analyses wait for the pool before starting their engine
+	moves, err := AnalyzeChessGame(scholarsMatePgn, WithEngineFactory(scholarsMateEngine().NewEngine), WithEnginePool(pool, InteractivePriority))
+	if err != nil || len(moves) != 7 {
+		t.Errorf("expected the pooled analysis to finish, got %d moves and %v", len(moves), err)
+	}
+	if free := freeEngines(pool); free != 1 {
+		t.Errorf("expected the analysis to return its engine, got %d free", free)
+	}
+}
+
+// countingEngine counts its searches, which wait for release
+type countingEngine struct {
+	Engine
+	searches *atomic.Int32
+	release  chan struct{}
+}
+
+func (e countingEngine) AnalyzePosition(fen string, limits SearchLimits) (*AnalysisResult, error) {
+	e.searches.Add(1)
+	<-e.release
+	return e.Engine.AnalyzePosition(fen, limits)
+}
+
+func TestEnginePoolCoalescesSearches(t *testing.T) {
+	var searches atomic.Int32
+	release := make(chan struct{})
+	factory := func() (Engine, error) {
+		engine, err := (&FakeEngine{}).NewEngine()
+		return countingEngine{Engine: engine, searches: &searches, release: release}, err
+	}
+	pool := NewEnginePool(2)
+	limits := SearchLimits{Depth: 3, Timeout: uciengine.DefaultEngineTimeout}
+	const fen = "rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq - 0 1"
+
+	results := make(chan *AnalysisResult, 2)
+	for i := 0; i < 2; i++ {
+		engine, err := pool.Acquire(context.Background(), InteractivePriority, factory)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer engine.Close()
+		go func() {
+			result, err := engine.AnalyzePosition(fen, limits)
+			if err != nil {
+				t.Error(err)
+			}
+			results <- result
+		}()
+	}
+	for deadline := time.Now().Add(time.Second); pool.Coalesced() == 0 && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	first, second := <-results, <-results
+	if searches.Load() != 1 || pool.Coalesced() != 1 {
+		t.Errorf("expected one search shared by both engines, got %d searches and %d coalesced", searches.Load(), pool.Coalesced())
+	}
+	if first == nil || second == nil || first == second || first.BestMove != second.BestMove {
+		t.Errorf("expected both engines to get their own copy of the result, got %+v and %+v", first, second)
+	}
+	if len(first.PlayedLine) == 0 || len(first.TopMoves) == 0 {
+		t.Fatalf("expected the result to have lines, got %+v", first)
+	}
+	first.PlayedLine[0], first.TopMoves[0] = "a1a1", "a1a1"
+	if second.PlayedLine[0] == "a1a1" || second.TopMoves[0] == "a1a1" {
+		t.Error("expected the copies not to share their lines")
+	}
+}
+
+func TestEnginePoolKeepsEnginesApart(t *testing.T) {
+	var searches atomic.Int32
+	release := make(chan struct{})
+	factory := func() (Engine, error) {
+		engine, err := (&FakeEngine{}).NewEngine()
+		return countingEngine{Engine: engine, searches: &searches, release: release}, err
+	}
+	pool := NewEnginePool(2)
+	limits := SearchLimits{Depth: 3, Timeout: uciengine.DefaultEngineTimeout}
+	const fen = "rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq - 0 1"
+
+	engine, err := pool.Acquire(context.Background(), InteractivePriority, factory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer engine.Close()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if _, err := engine.AnalyzePosition(fen, limits); err != nil {
+			t.Error(err)
+		}
+	}()
+	for deadline := time.Now().Add(time.Second); searches.Load() == 0 && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+
+	// The same search by a heuristic evaluator runs on its own
+	heuristic, err := pool.Acquire(context.Background(), InteractivePriority, NewHeuristicEngine)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer heuristic.Close()
+	result, err := heuristic.AnalyzePosition(fen, limits)
+	close(release)
+	<-done
+	if err != nil || pool.Coalesced() != 0 || result.Depth != 1 {
+		t.Errorf("expected the heuristic search kept apart from the engine's, got %+v after %d coalesced (%v)", result, pool.Coalesced(), err)
+	}
+}
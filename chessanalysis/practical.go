@@ -0,0 +1,67 @@
+package chessanalysis
+
+import (
+	"fmt"
+	"math"
+)
+
+// PracticalMistakeThreshold is how many percentage points of the must-win
+// side's winning chances a move has to cost its player, in practical mode,
+// to be reported as a practical mistake
+const PracticalMistakeThreshold = 10.0
+
+// WithContempt has engines with a Contempt option score a draw as worse than
+// even for the side to move by contempt, in the engine's units, so they steer
+// away from drawish lines; see SearchLimits.Contempt
+func WithContempt(contempt int) AnalyzeChessGameOption {
+	return func(opts *AnalyzeChessGameOptions) {
+		opts.Contempt = contempt
+	}
+}
+
+// WithPracticalMode judges the game for a must-win situation of the side of
+// the given color, "White" or "Black", such as the last round of a tournament.
+// A draw is then as bad as a loss for that side and as good as a win for the
+// defender, so every move gets the must-win side's chances of winning as its
+// PracticalChances, and PracticalLoss counts what it cost its player: the
+// chances the must-win side gave up, or those the defender let them have.
+func WithPracticalMode(mustWin string) AnalyzeChessGameOption {
+	return func(opts *AnalyzeChessGameOptions) {
+		opts.MustWin = mustWin
+	}
+}
+
+// validateMustWin checks the side of WithPracticalMode
+func validateMustWin(mustWin string) error {
+	switch mustWin {
+	case "", "White", "Black":
+		return nil
+	}
+	return fmt.Errorf("%w: the side that must win is %q, not White or Black", ErrInvalidOptions, mustWin)
+}
+
+// winningChances returns the chances of the side of the given color winning,
+// in percent, from the win/draw/loss chances when there are some and from the
+// score otherwise
+func winningChances(color string, whiteScore Score, whiteWinProb, whiteDrawProb, whiteLossProb float64) float64 {
+	if !hasWDL(whiteWinProb, whiteDrawProb, whiteLossProb) {
+		whiteWinProb, _, whiteLossProb = scoreWDL(whiteScore)
+	}
+	if color == "White" {
+		return 100 * whiteWinProb
+	}
+	return 100 * whiteLossProb
+}
+
+// judgePractically sets the practical chances of a move for the side that
+// must win
+func judgePractically(move *MoveAnalysis, mustWin string) {
+	before := winningChances(mustWin, move.PreviousWhiteScore, move.PreviousWhiteWinProb, move.PreviousWhiteDrawProb, move.PreviousWhiteLossProb)
+	after := winningChances(mustWin, move.WhiteScore, move.WhiteWinProb, move.WhiteDrawProb, move.WhiteLossProb)
+	move.PracticalChances = after
+	if move.Color == mustWin {
+		move.PracticalLoss = math.Max(0, before-after)
+	} else {
+		move.PracticalLoss = math.Max(0, after-before)
+	}
+}
@@ -0,0 +1,60 @@
+package chessanalysis
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/walterschell/chess-analyzer/chessanalysis/uciengine"
+)
+
+func TestContempt(t *testing.T) {
+	fake := scholarsMateEngine()
+	var transcript bytes.Buffer
+	factory := func() (Engine, error) {
+		return uciengine.NewEngine(uciengine.RecordingLauncher(fake.launch, &transcript))
+	}
+	game, err := AnalyzeGame(scholarsMatePgn, WithDepth(2), WithContempt(50), WithEngineFactory(factory))
+	if err != nil {
+		t.Fatalf("failed to analyze game: %v", err)
+	}
+	if sent := strings.Count(transcript.String(), "setoption name Contempt value 50"); sent != 1 {
+		t.Errorf("expected the contempt to be set once, got %d times in:\n%s", sent, transcript.String())
+	}
+	if game.Options.Contempt != 50 {
+		t.Errorf("expected the contempt in the effective options, got %d", game.Options.Contempt)
+	}
+
+	transcript.Reset()
+	if _, err := AnalyzeGame(scholarsMatePgn, WithDepth(2), WithEngineFactory(factory)); err != nil {
+		t.Fatalf("failed to analyze game: %v", err)
+	}
+	if strings.Contains(transcript.String(), "setoption name Contempt") {
+		t.Errorf("expected the engine's default contempt to be kept, got:\n%s", transcript.String())
+	}
+}
+
+func TestPracticalMode(t *testing.T) {
+	if _, err := ResolveOptions(WithPracticalMode("white")); !errors.Is(err, ErrInvalidOptions) {
+		t.Errorf("expected a lowercase side to be rejected, got %v", err)
+	}
+
+	game, err := AnalyzeGame(scholarsMatePgn, WithDepth(3), WithPracticalMode("Black"), WithEngineFactory(scholarsMateEngine().NewEngine))
+	if err != nil {
+		t.Fatalf("failed to analyze game: %v", err)
+	}
+	// 3...Nf6 throws away Black's chances, and White's mate ends them
+	bc4, nf6, mate := game.Moves[4], game.Moves[5], game.Moves[6]
+	if bc4.PracticalChances == 0 || nf6.PracticalChances != 0 || nf6.PracticalLoss != bc4.PracticalChances {
+		t.Errorf("expected 3...Nf6 to cost Black their %.1f%% winning chances, got %.1f points leaving %.1f%%",
+			bc4.PracticalChances, nf6.PracticalLoss, nf6.PracticalChances)
+	}
+	if mate.PracticalChances != 0 || mate.PracticalLoss != 0 {
+		t.Errorf("expected White's mate to leave Black no chances without costing White any, got %.1f%% and %.1f", mate.PracticalChances, mate.PracticalLoss)
+	}
+	// White is the defender, so their moves cost them what they let Black have
+	if e4 := game.Moves[0]; e4.PracticalLoss != e4.PracticalChances-winningChances("Black", StartingPositionWhiteScore, StartingPositionWhiteWinProb, StartingPositionWhiteDrawProb, StartingPositionWhiteLossProb) {
+		t.Errorf("expected 1. e4 to cost White the chances it gave Black, got %.1f leaving them %.1f%%", e4.PracticalLoss, e4.PracticalChances)
+	}
+}
@@ -0,0 +1,77 @@
+package chessanalysis
+
+import chess "github.com/corentings/chess/v2"
+
+const (
+	// practicalTryLost is the mover's expected score, in percent, at or
+	// below which a position is lost enough to look for a practical try
+	practicalTryLost = 25
+	// practicalTryMargin is how many pawns worse than the best move a
+	// defensive try may score and still be considered
+	practicalTryMargin = 2.0
+	// practicalTryReplies is how many of the opponent's replies to each try
+	// are searched to judge how easily they could go wrong
+	practicalTryReplies = 4
+)
+
+// PracticalTry is the defensive move in a lost position that sets the
+// opponent the most problems, which isn't necessarily the engine's best move.
+// See WithPracticalTries.
+type PracticalTry struct {
+	Move       string `json:"move"` // SAN
+	UCI        string `json:"uci"`
+	WhiteScore Score  `json:"whiteScore"`
+	// OpponentSharpness is how sharp the position is for the opponent after
+	// the try, from 0 to 1: the fraction of their best replies other than the
+	// first that throw the win away. See positionSharpness.
+	OpponentSharpness float64 `json:"opponentSharpness"`
+}
+
+// WithPracticalTries looks for the most complicating defence in every
+// position the mover was lost in, among the engine's top moves, and reports
+// it as the move's PracticalTry alongside the best move. Each try costs a
+// search of the opponent's replies, and tries need a MultiPV above 1 to have
+// moves to choose from.
+func WithPracticalTries() AnalyzeChessGameOption {
+	return func(opts *AnalyzeChessGameOptions) {
+		opts.PracticalTries = true
+	}
+}
+
+// needsPracticalTry reports whether the mover was lost before the move, with
+// other defences than the best move to consider
+func needsPracticalTry(move *MoveAnalysis) bool {
+	if len(move.TopMoves) < 2 {
+		return false
+	}
+	best := moverExpectation(move.Color, move.BestMoveWhiteScore, move.BestMoveWhiteWinProb, move.BestMoveWhiteDrawProb, move.BestMoveWhiteLossProb)
+	return best <= practicalTryLost
+}
+
+// findPracticalTry searches the position after each of the engine's top
+// moves close enough to the best one, returning the try whose position is the
+// sharpest for the opponent. Ties go to the better scoring try.
+func findPracticalTry(engine Engine, move *MoveAnalysis, before *chess.Position, limits SearchLimits) (*PracticalTry, error) {
+	limits.MultiPV = max(limits.MultiPV, practicalTryReplies)
+	best := moverScore(move.Color, move.TopMoves[0].WhiteScore)
+	var try *PracticalTry
+	for _, candidate := range move.TopMoves {
+		score := moverScore(move.Color, candidate.WhiteScore)
+		if best.Pawns()-score.Pawns() > practicalTryMargin {
+			continue
+		}
+		played, err := chess.UCINotation{}.Decode(before, candidate.UCI)
+		if err != nil {
+			continue
+		}
+		result, err := engine.AnalyzePosition(before.Update(played).String(), limits)
+		if err != nil {
+			return nil, err
+		}
+		sharpness := positionSharpness(result.TopScores)
+		if try == nil || sharpness > try.OpponentSharpness {
+			try = &PracticalTry{Move: candidate.Move, UCI: candidate.UCI, WhiteScore: candidate.WhiteScore, OpponentSharpness: sharpness}
+		}
+	}
+	return try, nil
+}
@@ -0,0 +1,70 @@
+package chessanalysis
+
+import (
+	"testing"
+
+	chess "github.com/corentings/chess/v2"
+	"github.com/walterschell/chess-analyzer/chessanalysis/uciengine"
+)
+
+// lostDefenceEngine has Black lost before 3...Nf6, with 3...Qf6 the defence
+// after which every White reply but one throws the win away
+func lostDefenceEngine(t *testing.T) *FakeEngine {
+	t.Helper()
+	const beforeNf6 = "r1bqkbnr/pppp1ppp/2n5/4p2Q/2B1P3/8/PPPP1PPP/RNB1K1NR b KQkq - 3 3"
+	position, err := positionFromFEN(beforeNf6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	qf6, err := chess.UCINotation{}.Decode(position, "d8f6")
+	if err != nil {
+		t.Fatal(err)
+	}
+	afterQf6 := position.Update(qf6)
+	replies := map[string]int{}
+	for _, reply := range afterQf6.ValidMoves() {
+		replies[moveToUci(afterQf6, &reply)] = -100
+	}
+	return &FakeEngine{
+		Positions: map[string]FakeEvaluation{
+			beforeNf6: {
+				BestMove: "g7g6",
+				Score:    -500,
+				Moves:    map[string]int{"d8f6": -520, "g8f6": -900},
+			},
+			afterQf6.String(): {
+				BestMove: "b1c3",
+				Score:    550,
+				Moves:    replies,
+			},
+		},
+	}
+}
+
+func TestPracticalTries(t *testing.T) {
+	engine := lostDefenceEngine(t)
+	moves, err := AnalyzeChessGame(scholarsMatePgn, WithDepth(2), WithMultiPV(3), WithEngineFactory(engine.NewEngine))
+	if err != nil {
+		t.Fatalf("failed to analyze game: %v", err)
+	}
+	if try := moves[5].PracticalTry; try != nil {
+		t.Errorf("expected no practical try without WithPracticalTries, got %+v", try)
+	}
+
+	moves, err = AnalyzeChessGame(scholarsMatePgn, WithDepth(2), WithMultiPV(3), WithPracticalTries(), WithEngineFactory(engine.NewEngine))
+	if err != nil {
+		t.Fatalf("failed to analyze game: %v", err)
+	}
+	nf6 := moves[5]
+	if nf6.BestMoveSAN != "g6" || nf6.BestMoveWhiteScore != uciengine.Pawns(5) {
+		t.Errorf("expected g6 to stay the best move at +5 for White, got %s at %v", nf6.BestMoveSAN, nf6.BestMoveWhiteScore)
+	}
+	if try := nf6.PracticalTry; try == nil || try.Move != "Qf6" || try.UCI != "d8f6" || try.OpponentSharpness != 1 || try.WhiteScore != uciengine.Pawns(5.2) {
+		t.Errorf("expected Qf6 as Black's practical try before 3...Nf6, got %+v", try)
+	}
+	for _, move := range moves[:5] {
+		if move.PracticalTry != nil {
+			t.Errorf("expected no practical try for %s in a position that wasn't lost, got %+v", move.MoveText, move.PracticalTry)
+		}
+	}
+}
@@ -0,0 +1,242 @@
+package chessanalysis
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// GameSource fetches a player's recent games from an online service
+type GameSource interface {
+	// RecentGames returns up to max of the player's most recent games as a PGN database
+	RecentGames(ctx context.Context, player string, max int) (string, error)
+}
+
+// LichessURL is the base URL of the Lichess API
+const LichessURL = "https://lichess.org"
+
+// LichessGameSource fetches games from the Lichess game export API
+type LichessGameSource struct {
+	Client *http.Client
+	URL    string
+}
+
+// NewLichessGameSource returns a game source for lichess.org
+func NewLichessGameSource() *LichessGameSource {
+	return &LichessGameSource{
+		Client: &http.Client{Timeout: time.Minute},
+		URL:    LichessURL,
+	}
+}
+
+// RecentGames implements GameSource
+func (s *LichessGameSource) RecentGames(ctx context.Context, player string, max int) (string, error) {
+	query := url.Values{
+		"max":     {fmt.Sprint(max)},
+		"clocks":  {"true"},
+		"opening": {"true"},
+	}
+	endpoint := fmt.Sprintf("%s/api/games/user/%s?%s", s.URL, url.PathEscape(player), query.Encode())
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return "", err
+	}
+	request.Header.Set("Accept", "application/x-chess-pgn")
+	response, err := s.Client.Do(request)
+	if err != nil {
+		return "", fmt.Errorf("fetching games of %s: %w", player, err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("fetching games of %s: %s", player, response.Status)
+	}
+	pgn, err := io.ReadAll(response.Body)
+	if err != nil {
+		return "", fmt.Errorf("fetching games of %s: %w", player, err)
+	}
+	return string(pgn), nil
+}
+
+// PhaseMistakes counts a player's mistakes in one phase of the game
+type PhaseMistakes struct {
+	Moves       int     `json:"moves"`
+	Mistakes    int     `json:"mistakes"` // Questionable moves and blunders
+	Blunders    int     `json:"blunders"`
+	MistakeRate float64 `json:"mistakeRate"` // Percentage of moves that were mistakes
+}
+
+// StructureStats is how often a player blundered in positions with a structure feature
+type StructureStats struct {
+	Feature     string  `json:"feature"`
+	Moves       int     `json:"moves"`
+	Blunders    int     `json:"blunders"`
+	BlunderRate float64 `json:"blunderRate"`          // Percentage of moves that were blunders
+	ExampleFEN  string  `json:"exampleFen,omitempty"` // A position where the player blundered
+}
+
+// PrepDossier summarizes an opponent's recent games for preparation
+type PrepDossier struct {
+	Player  string         `json:"player"`
+	Games   int            `json:"games"`
+	Summary PlayerSummary  `json:"summary"`
+	AsWhite []OpeningStats `json:"asWhite"` // Openings played as White, most played first
+	AsBlack []OpeningStats `json:"asBlack"`
+	// Mistakes by phase name, see GamePhase
+	MistakesByPhase map[string]*PhaseMistakes `json:"mistakesByPhase"`
+	// BlunderProneStructures are the structure features the player blunders in
+	// most often, highest blunder rate first
+	BlunderProneStructures []StructureStats `json:"blunderProneStructures"`
+}
+
+// minStructureMoves is how many moves with a feature are needed before its blunder rate is reported
+const minStructureMoves = 5
+
+// PrepareDossier builds a preparation dossier on the named player from their analyzed games
+func PrepareDossier(games []*GameAnalysis, player string) *PrepDossier {
+	dossier := &PrepDossier{
+		Player:          player,
+		Summary:         AggregateSummary(games, player),
+		MistakesByPhase: make(map[string]*PhaseMistakes),
+	}
+	for _, name := range gamePhaseNames {
+		dossier.MistakesByPhase[name] = &PhaseMistakes{}
+	}
+
+	var asWhite, asBlack []*GameAnalysis
+	structures := make(map[string]*StructureStats)
+	for _, game := range games {
+		color := game.PlayerColor(player)
+		switch color {
+		case "White":
+			asWhite = append(asWhite, game)
+		case "Black":
+			asBlack = append(asBlack, game)
+		default:
+			continue
+		}
+		dossier.Games++
+
+		for i := range game.Moves {
+			move := &game.Moves[i]
+			if move.Color != color {
+				continue
+			}
+			blunder := move.Classification == Blunder
+			phase := dossier.MistakesByPhase[move.Phase.String()]
+			phase.Moves++
+			if blunder || move.Classification == Questionable {
+				phase.Mistakes++
+			}
+			if blunder {
+				phase.Blunders++
+			}
+
+			for _, feature := range structureFeatures(move.FENBefore, color) {
+				stats, ok := structures[feature]
+				if !ok {
+					stats = &StructureStats{Feature: feature}
+					structures[feature] = stats
+				}
+				stats.Moves++
+				if blunder {
+					stats.Blunders++
+					if stats.ExampleFEN == "" {
+						stats.ExampleFEN = move.FENBefore
+					}
+				}
+			}
+		}
+	}
+	for _, phase := range dossier.MistakesByPhase {
+		phase.MistakeRate = percentage(phase.Mistakes, phase.Moves)
+	}
+
+	dossier.AsWhite = OpeningReport(asWhite, player)
+	dossier.AsBlack = OpeningReport(asBlack, player)
+
+	dossier.BlunderProneStructures = []StructureStats{}
+	for _, stats := range structures {
+		if stats.Blunders == 0 || stats.Moves < minStructureMoves {
+			continue
+		}
+		stats.BlunderRate = percentage(stats.Blunders, stats.Moves)
+		dossier.BlunderProneStructures = append(dossier.BlunderProneStructures, *stats)
+	}
+	sort.Slice(dossier.BlunderProneStructures, func(i, j int) bool {
+		a, b := dossier.BlunderProneStructures[i], dossier.BlunderProneStructures[j]
+		if a.BlunderRate != b.BlunderRate {
+			return a.BlunderRate > b.BlunderRate
+		}
+		return a.Feature < b.Feature
+	})
+	return dossier
+}
+
+// PrepareForOpponent fetches the opponent's recent games, analyzes them and
+// builds a dossier. Games that fail to analyze are skipped and reported in the
+// returned error along with the dossier of the others.
+func PrepareForOpponent(ctx context.Context, source GameSource, player string, max int, opts ...AnalyzeChessGameOption) (*PrepDossier, error) {
+	pgn, err := source.RecentGames(ctx, player, max)
+	if err != nil {
+		return nil, err
+	}
+	opts = append(opts, WithContext(ctx))
+	games, err := AnalyzeChessGames(pgn, opts...)
+	if games == nil && err != nil {
+		return nil, err
+	}
+	return PrepareDossier(games, player), err
+}
+
+// escapeMarkdownCell escapes text for use in a markdown table cell
+func escapeMarkdownCell(text string) string {
+	return strings.ReplaceAll(text, "|", `\|`)
+}
+
+// Markdown renders the dossier for reading before a game
+func (d *PrepDossier) Markdown() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "## Preparation: %s\n\n", escapeMarkdownCell(d.Player))
+	fmt.Fprintf(&b, "%d games, accuracy %.1f, ACPL %.1f, estimated rating %d\n",
+		d.Games, d.Summary.Accuracy, d.Summary.ACPL, d.Summary.EstimatedRating)
+
+	for _, side := range []struct {
+		name     string
+		openings []OpeningStats
+	}{{"White", d.AsWhite}, {"Black", d.AsBlack}} {
+		fmt.Fprintf(&b, "\n### Openings as %s\n\n", side.name)
+		if len(side.openings) == 0 {
+			b.WriteString("None\n")
+			continue
+		}
+		b.WriteString("| ECO | Opening | Games | Score | Accuracy |\n|---|---|---:|---:|---:|\n")
+		for _, opening := range side.openings {
+			fmt.Fprintf(&b, "| %s | %s | %d | %.0f%% | %.1f |\n", opening.ECO, escapeMarkdownCell(opening.Name),
+				opening.Games, 100*opening.Score, opening.Accuracy)
+		}
+	}
+
+	b.WriteString("\n### Mistakes by phase\n\n| Phase | Moves | Mistakes | Blunders | Mistake rate |\n|---|---:|---:|---:|---:|\n")
+	for _, name := range gamePhaseNames {
+		phase := d.MistakesByPhase[name]
+		fmt.Fprintf(&b, "| %s | %d | %d | %d | %.1f%% |\n", name, phase.Moves, phase.Mistakes, phase.Blunders, phase.MistakeRate)
+	}
+
+	b.WriteString("\n### Blunder-prone structures\n\n")
+	if len(d.BlunderProneStructures) == 0 {
+		b.WriteString("None\n")
+	}
+	for _, structure := range d.BlunderProneStructures {
+		fmt.Fprintf(&b, "- %s: %d blunders in %d moves (%.1f%%)", structure.Feature, structure.Blunders, structure.Moves, structure.BlunderRate)
+		if structure.ExampleFEN != "" {
+			fmt.Fprintf(&b, " — [example](%s)", LichessAnalysisURL(structure.ExampleFEN))
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
@@ -0,0 +1,88 @@
+package chessanalysis
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+type stubGameSource string
+
+func (s stubGameSource) RecentGames(ctx context.Context, player string, max int) (string, error) {
+	return string(s), nil
+}
+
+func TestStructureFeatures(t *testing.T) {
+	// Queen's Gambit Accepted structure after exd4 exd4: White has an isolated d-pawn
+	iqp := "r1bqkb1r/pp3ppp/2n2n2/8/3P4/2N2N2/PP3PPP/R1BQKB1R w KQkq - 0 8"
+	features := structureFeatures(iqp, "White")
+	for _, want := range []string{IsolatedQueenPawnFeature, IsolatedPawnFeature} {
+		if !slices.Contains(features, want) {
+			t.Errorf("expected %q for White, got %v", want, features)
+		}
+	}
+	if slices.Contains(structureFeatures(iqp, "Black"), IsolatedQueenPawnFeature) {
+		t.Error("expected no isolated queen's pawn for Black")
+	}
+
+	open := "4k3/pp3ppp/8/8/8/8/PP3PPP/4K3 w - - 0 1"
+	if !slices.Contains(structureFeatures(open, "White"), OpenCenterFeature) {
+		t.Errorf("expected an open center, got %v", structureFeatures(open, "White"))
+	}
+
+	french := "rnbqkbnr/ppp2ppp/4p3/3pP3/3P4/8/PPP2PPP/RNBQKBNR b KQkq - 0 3"
+	if !slices.Contains(structureFeatures(french, "Black"), LockedCenterFeature) {
+		t.Errorf("expected a locked center, got %v", structureFeatures(french, "Black"))
+	}
+}
+
+func TestPrepareForOpponent(t *testing.T) {
+	dossier, err := PrepareForOpponent(context.Background(), stubGameSource(scholarsMatePgn), "player 2", 10,
+		WithDepth(3), WithEngineFactory(scholarsMateEngine().NewEngine))
+	if err != nil {
+		t.Fatalf("failed to prepare: %v", err)
+	}
+	if dossier.Games != 1 || len(dossier.AsBlack) != 1 || len(dossier.AsWhite) != 0 {
+		t.Errorf("unexpected games %d, as White %d, as Black %d", dossier.Games, len(dossier.AsWhite), len(dossier.AsBlack))
+	}
+	opening := dossier.MistakesByPhase[Opening.String()]
+	if opening.Moves != 3 || opening.Blunders != 1 {
+		t.Errorf("unexpected opening mistakes: %+v", opening)
+	}
+	markdown := dossier.Markdown()
+	for _, want := range []string{"## Preparation: player 2", "### Openings as Black", "| Opening | 3 |"} {
+		if !strings.Contains(markdown, want) {
+			t.Errorf("expected markdown to contain %q:\n%s", want, markdown)
+		}
+	}
+}
+
+func TestLichessGameSource(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/games/user/someone" || r.URL.Query().Get("max") != "5" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Header.Get("Accept") != "application/x-chess-pgn" {
+			http.Error(w, "bad accept header", http.StatusNotAcceptable)
+			return
+		}
+		w.Write([]byte(scholarsMatePgn))
+	}))
+	defer server.Close()
+
+	source := &LichessGameSource{Client: server.Client(), URL: server.URL}
+	pgn, err := source.RecentGames(context.Background(), "someone", 5)
+	if err != nil {
+		t.Fatalf("failed to fetch games: %v", err)
+	}
+	if pgn != scholarsMatePgn {
+		t.Errorf("unexpected PGN %q", pgn)
+	}
+	if _, err := source.RecentGames(context.Background(), "nobody", 5); err == nil {
+		t.Error("expected an error for a missing user")
+	}
+}
@@ -0,0 +1,276 @@
+package chessanalysis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	chess "github.com/corentings/chess/v2"
+)
+
+// DefaultRelayInterval is how often a relay is polled when no interval is given
+const DefaultRelayInterval = 30 * time.Second
+
+// RelayBoard is the analysis so far of one game of a relay
+type RelayBoard struct {
+	Board   int               `json:"board"` // Position of the game in the relay, from 1
+	Headers map[string]string `json:"headers"`
+	Moves   []MoveAnalysis    `json:"moves"`
+}
+
+// RelayUpdate is the analysis of a move newly played on one board of a relay
+type RelayUpdate struct {
+	Board   int               `json:"board"`
+	Headers map[string]string `json:"headers"`
+	Move    *MoveAnalysis     `json:"move"`
+}
+
+// Relay follows a live tournament relay: a PGN database at a URL that is
+// republished as the games go on, with each board's new moves appended. Only
+// the moves played since the last poll are reported. Boards are re-analyzed
+// through a SearchCache shared by the whole relay, so the moves analyzed in
+// earlier polls don't reach the engine again. It is safe for concurrent use.
+type Relay struct {
+	URL      string
+	Client   *http.Client
+	Interval time.Duration // How often Follow polls
+
+	opts     []AnalyzeChessGameOption
+	cache    *SearchCache
+	updating sync.Mutex // Serializes updates
+	mu       sync.Mutex
+	boards   map[string]*RelayBoard // By relayGameKey
+}
+
+// NewRelay returns a relay following the PGN at the URL, analyzing its moves
+// with the given options
+func NewRelay(url string, opts ...AnalyzeChessGameOption) *Relay {
+	return &Relay{
+		URL:      url,
+		Client:   &http.Client{Timeout: time.Minute},
+		Interval: DefaultRelayInterval,
+		opts:     opts,
+		cache:    NewSearchCache(),
+		boards:   make(map[string]*RelayBoard),
+	}
+}
+
+// Boards returns the analysis so far of every game of the relay, in board order
+func (r *Relay) Boards() []RelayBoard {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	boards := make([]RelayBoard, 0, len(r.boards))
+	for _, board := range r.boards {
+		boards = append(boards, *board)
+	}
+	slices.SortFunc(boards, func(a, b RelayBoard) int { return a.Board - b.Board })
+	return boards
+}
+
+// RelayBoardOverview is one game of a relay at a glance
+type RelayBoardOverview struct {
+	Board      int    `json:"board"`
+	White      string `json:"white"`
+	Black      string `json:"black"`
+	Result     string `json:"result"`
+	Plies      int    `json:"plies"`
+	LastMove   string `json:"lastMove,omitempty"` // e.g. "23... Rxe4"
+	WhiteScore Score  `json:"whiteScore"`         // After the last move
+}
+
+// Overview returns the current evaluation of every game of the relay, in board order
+func (r *Relay) Overview() []RelayBoardOverview {
+	boards := r.Boards()
+	overview := make([]RelayBoardOverview, 0, len(boards))
+	for _, board := range boards {
+		game := RelayBoardOverview{
+			Board:      board.Board,
+			White:      board.Headers["White"],
+			Black:      board.Headers["Black"],
+			Result:     board.Headers["Result"],
+			Plies:      len(board.Moves),
+			WhiteScore: StartingPositionWhiteScore,
+		}
+		if len(board.Moves) > 0 {
+			last := &board.Moves[len(board.Moves)-1]
+			game.LastMove, game.WhiteScore = MoveLabel(last), last.WhiteScore
+		}
+		overview = append(overview, game)
+	}
+	return overview
+}
+
+// Follow polls the relay every Interval until ctx is done, calling update with
+// the analysis of each new move. Failed polls are logged and tried again at
+// the next interval.
+func (r *Relay) Follow(ctx context.Context, update func(RelayUpdate)) error {
+	interval := r.Interval
+	if interval <= 0 {
+		interval = DefaultRelayInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		updates, err := r.Poll(ctx)
+		for _, u := range updates {
+			update(u)
+		}
+		if ctx.Err() != nil {
+			return fmt.Errorf("%w: %v", ErrAnalysisCancelled, ctx.Err())
+		}
+		if err != nil {
+			log.Warn("Failed to poll relay", "url", r.URL, "error", err)
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return fmt.Errorf("%w: %v", ErrAnalysisCancelled, ctx.Err())
+		}
+	}
+}
+
+// Poll fetches the relay once and returns the analysis of every move played
+// since the last poll
+func (r *Relay) Poll(ctx context.Context) ([]RelayUpdate, error) {
+	pgn, err := r.fetch(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return r.Update(ctx, pgn)
+}
+
+// fetch downloads the relay's PGN database
+func (r *Relay) fetch(ctx context.Context) (string, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, r.URL, nil)
+	if err != nil {
+		return "", err
+	}
+	request.Header.Set("Accept", "application/x-chess-pgn")
+	response, err := r.Client.Do(request)
+	if err != nil {
+		return "", fmt.Errorf("fetching relay %s: %w", r.URL, err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("fetching relay %s: %s", r.URL, response.Status)
+	}
+	pgn, err := io.ReadAll(response.Body)
+	if err != nil {
+		return "", fmt.Errorf("fetching relay %s: %w", r.URL, err)
+	}
+	return string(pgn), nil
+}
+
+// Update analyzes the moves of the relay's PGN database played since the last
+// update. A board whose earlier moves were corrected is reported again from
+// the first move that changed. Boards that fail to analyze are reported in the
+// returned error, which joins the error of each; the other boards are still
+// updated.
+func (r *Relay) Update(ctx context.Context, pgn string) ([]RelayUpdate, error) {
+	r.updating.Lock()
+	defer r.updating.Unlock()
+	games, err := SplitPGN(pgn)
+	if err != nil {
+		return nil, err
+	}
+	var updates []RelayUpdate
+	var errs []error
+	for i, text := range games {
+		boardUpdates, err := r.updateBoard(ctx, text, i+1)
+		updates = append(updates, boardUpdates...)
+		if errors.Is(err, ErrAnalysisCancelled) {
+			return updates, errors.Join(append(errs, err)...)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("board %d: %w", i+1, err))
+		}
+	}
+	return updates, errors.Join(errs...)
+}
+
+// UpdateGame analyzes the moves of one game of the relay played since it was
+// last updated. A game new to the relay is numbered after the boards it has.
+func (r *Relay) UpdateGame(ctx context.Context, pgn string) ([]RelayUpdate, error) {
+	r.updating.Lock()
+	defer r.updating.Unlock()
+	return r.updateBoard(ctx, pgn, 0)
+}
+
+// updateBoard analyzes the moves of the game played since its last update. A
+// zero number keeps the board's number, or numbers a new board after the others.
+// The caller must hold the updating lock.
+func (r *Relay) updateBoard(ctx context.Context, pgn string, number int) ([]RelayUpdate, error) {
+	headers := parsePGNHeaders(pgn)
+	plies, final, err := mainlineEnd(pgn)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	key := relayGameKey(headers, number)
+	board, ok := r.boards[key]
+	if !ok {
+		board = &RelayBoard{Board: len(r.boards) + 1}
+		r.boards[key] = board
+	}
+	if number > 0 {
+		board.Board = number
+	}
+	board.Headers = headers
+	previous := board.Moves
+	r.mu.Unlock()
+	if plies == len(previous) && (plies == 0 || previous[plies-1].FENAfter == final) {
+		return nil, nil
+	}
+
+	opts := append(append([]AnalyzeChessGameOption{}, r.opts...), WithSearchCache(r.cache), WithContext(ctx))
+	moves, err := AnalyzeChessGame(pgn, opts...)
+	if err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	board.Moves = moves
+	number = board.Board
+	r.mu.Unlock()
+	var updates []RelayUpdate
+	for ply := sharedPlies(previous, moves); ply < len(moves); ply++ {
+		updates = append(updates, RelayUpdate{Board: number, Headers: headers, Move: &moves[ply]})
+	}
+	return updates, nil
+}
+
+// relayGameKey identifies a game of a relay across polls by its round and
+// players, or by its board number when it names no players
+func relayGameKey(headers map[string]string, number int) string {
+	if headers["White"] == "" && headers["Black"] == "" {
+		return fmt.Sprintf("#%d", number)
+	}
+	return strings.Join([]string{headers["Round"], headers["White"], headers["Black"]}, "\x00")
+}
+
+// mainlineEnd returns how many moves the mainline of a game has and the
+// position they lead to
+func mainlineEnd(pgn string) (int, string, error) {
+	pgnOpt, err := chess.PGN(strings.NewReader(pgn))
+	if err != nil {
+		return 0, "", fmt.Errorf("%w: %v", ErrInvalidPGN, err)
+	}
+	game := chess.NewGame(pgnOpt)
+	return len(game.Moves()), game.Position().String(), nil
+}
+
+// sharedPlies returns how many moves two analyses of a game have in common
+// from the start
+func sharedPlies(previous, moves []MoveAnalysis) int {
+	shared := 0
+	for shared < len(previous) && shared < len(moves) && previous[shared].FENAfter == moves[shared].FENAfter {
+		shared++
+	}
+	return shared
+}
@@ -0,0 +1,52 @@
+package chessanalysis
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRelay(t *testing.T) {
+	var first, second string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "[Event \"Open\"]\n[Round \"1.1\"]\n[White \"A\"]\n[Black \"B\"]\n[Result \"*\"]\n\n%s *\n\n", first)
+		fmt.Fprintf(w, "[Event \"Open\"]\n[Round \"1.2\"]\n[White \"C\"]\n[Black \"D\"]\n[Result \"*\"]\n\n%s *\n", second)
+	}))
+	defer server.Close()
+
+	relay := NewRelay(server.URL, WithDepth(1), WithEngineFactory((&FakeEngine{}).NewEngine))
+	poll := func(want ...string) {
+		t.Helper()
+		updates, err := relay.Poll(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, update := range updates {
+			got = append(got, fmt.Sprintf("%d:%s", update.Board, update.Move.MoveText))
+		}
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("expected updates %v, got %v", want, got)
+		}
+	}
+
+	first, second = "1. e4 e5", "1. d4"
+	poll("1:e4", "1:e5", "2:d4")
+	// Nothing new was played
+	poll()
+	first = "1. e4 e5 2. Nf3"
+	poll("1:Nf3")
+	if stats := relay.cache.Stats(); stats.Hits != 2 {
+		t.Errorf("expected the moves analyzed earlier to be reused, got %+v", stats)
+	}
+	// A corrected move is reported again
+	second = "1. c4"
+	poll("2:c4")
+
+	boards := relay.Boards()
+	if len(boards) != 2 || boards[0].Board != 1 || len(boards[0].Moves) != 3 || boards[1].Headers["White"] != "C" {
+		t.Errorf("unexpected boards %+v", boards)
+	}
+}
@@ -0,0 +1,96 @@
+package chessanalysis
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	chess "github.com/corentings/chess/v2"
+)
+
+// Repertoire is a player's prepared opening lines, including variations. It
+// implements Theory, so moves are ordered as they appear in the PGN.
+type Repertoire struct {
+	positions map[string][]string // Repertoire moves in UCI notation by position
+}
+
+// NewRepertoire builds a repertoire from a PGN database, following every
+// variation of every game
+func NewRepertoire(pgn string) (*Repertoire, error) {
+	games, err := SplitPGN(pgn)
+	if err != nil {
+		return nil, err
+	}
+	repertoire := &Repertoire{positions: make(map[string][]string)}
+	for i, text := range games {
+		pgnOpt, err := chess.PGN(strings.NewReader(text))
+		if err != nil {
+			return nil, fmt.Errorf("%w: repertoire game %d: %v", ErrInvalidPGN, i+1, err)
+		}
+		repertoire.add(chess.NewGame(pgnOpt).GetRootMove())
+	}
+	return repertoire, nil
+}
+
+// add records the moves played from node and everything after them
+func (r *Repertoire) add(node *chess.Move) {
+	position := node.Position()
+	key := theoryKey(position.String())
+	for _, child := range node.Children() {
+		uci := moveToUci(position, child)
+		if !slices.Contains(r.positions[key], uci) {
+			r.positions[key] = append(r.positions[key], uci)
+		}
+		r.add(child)
+	}
+}
+
+// Moves implements Theory
+func (r *Repertoire) Moves(fen string) []string {
+	return r.positions[theoryKey(fen)]
+}
+
+// RepertoireDeviation is where a game left a repertoire
+type RepertoireDeviation struct {
+	Game  int    `json:"game"` // Index of the game in the report input
+	Ply   int    `json:"ply"`  // Index of the deviating move within the game
+	Move  string `json:"move"`
+	Color string `json:"color"`
+	// ByPlayer is true when the repertoire's owner deviated and false when their opponent did
+	ByPlayer        bool     `json:"byPlayer"`
+	RepertoireMoves []string `json:"repertoireMoves"` // The prepared moves in SAN
+	RepertoireLine  string   `json:"repertoireLine"`  // The prepared line that was left
+	// EvalCost is the centipawns the deviating move lost from the deviating side's perspective
+	EvalCost       float64 `json:"evalCost"`
+	Classification string  `json:"classification"`
+}
+
+// RepertoireReport finds where each of the named player's games left their
+// repertoire. Games that stayed within the repertoire, or never reached a
+// position in it, have no deviation and are left out.
+func RepertoireReport(games []*GameAnalysis, repertoire *Repertoire, player string) []RepertoireDeviation {
+	deviations := []RepertoireDeviation{}
+	for i, game := range games {
+		color := game.PlayerColor(player)
+		if color == "" {
+			continue
+		}
+		ply, repertoireMoves, ok := firstDeviation(game.Moves, repertoire)
+		if !ok {
+			continue
+		}
+		move := &game.Moves[ply]
+		deviations = append(deviations, RepertoireDeviation{
+			Game:            i,
+			Ply:             ply,
+			Move:            MoveLabel(move),
+			Color:           move.Color,
+			ByPlayer:        move.Color == color,
+			RepertoireMoves: repertoireMoves,
+			RepertoireLine:  referenceLine(game.Moves, ply, repertoireMoves),
+			EvalCost:        move.CentipawnLoss,
+			Classification:  move.Classification.String(),
+		})
+	}
+	return deviations
+}
@@ -0,0 +1,58 @@
+package chessanalysis
+
+import (
+	"reflect"
+	"testing"
+)
+
+const whiteRepertoire = `
+[Event "1. e4 repertoire"]
+
+1. e4 e5 (1... c5 2. Nf3 d6 (2... Nc6 3. d4) 3. d4) 2. Nf3 Nc6 3. Bb5 *
+`
+
+func TestRepertoireReport(t *testing.T) {
+	repertoire, err := NewRepertoire(whiteRepertoire)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if moves := repertoire.Moves("rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq - 0 1"); !reflect.DeepEqual(moves, []string{"e7e5", "c7c5"}) {
+		t.Errorf("unexpected repertoire moves after 1. e4: %v", moves)
+	}
+
+	analyze := func(pgn string) *GameAnalysis {
+		t.Helper()
+		game, err := AnalyzeGame(pgn, WithEngineFactory(scholarsMateEngine().NewEngine))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return game
+	}
+	games := []*GameAnalysis{
+		analyze(scholarsMatePgn),
+		analyze("[White \"Player 2\"]\n[Black \"Player 1\"]\n[Result \"0-1\"]\n\n1. e4 e5 2. Qh5 Nc6 0-1"),
+		analyze("[White \"Player 1\"]\n[Black \"Player 3\"]\n[Result \"1-0\"]\n\n1. e4 d5 2. exd5 1-0"),
+		analyze("[White \"Player 1\"]\n[Black \"Player 3\"]\n[Result \"1-0\"]\n\n1. e4 c5 2. Nf3 Nc6 3. d4 1-0"),
+	}
+
+	deviations := RepertoireReport(games, repertoire, "player 1")
+	if len(deviations) != 3 {
+		t.Fatalf("expected 3 deviations, got %+v", deviations)
+	}
+	mine := deviations[0]
+	if mine.Game != 0 || mine.Move != "2. Qh5" || !mine.ByPlayer || !reflect.DeepEqual(mine.RepertoireMoves, []string{"Nf3"}) {
+		t.Errorf("unexpected deviation by the player %+v", mine)
+	}
+	if mine.RepertoireLine != "1. e4 e5 2. Nf3" {
+		t.Errorf("unexpected repertoire line %q", mine.RepertoireLine)
+	}
+	// The second game follows the same moves but the player had Black
+	theirs := deviations[1]
+	if theirs.Game != 1 || theirs.Move != "2. Qh5" || theirs.ByPlayer {
+		t.Errorf("unexpected deviation by the opponent %+v", theirs)
+	}
+	opponent := deviations[2]
+	if opponent.Game != 2 || opponent.Move != "1... d5" || opponent.ByPlayer || !reflect.DeepEqual(opponent.RepertoireMoves, []string{"e5", "c5"}) {
+		t.Errorf("unexpected deviation by the opponent %+v", opponent)
+	}
+}
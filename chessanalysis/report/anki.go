@@ -0,0 +1,86 @@
+package report
+
+import (
+	"encoding/csv"
+	"fmt"
+	"html"
+	"io"
+	"strings"
+
+	"github.com/walterschell/chess-analyzer/chessanalysis"
+)
+
+// AnkiCard is a spaced-repetition flashcard drilling one of a player's mistakes
+type AnkiCard struct {
+	Front string // The position and a prompt to find a better move
+	Back  string // The best move and the line that refutes the move played
+	Tags  []string
+}
+
+// MistakeCards makes a card for each questionable move and blunder the named
+// player made in the games. An empty player includes both sides' mistakes.
+func MistakeCards(games []*chessanalysis.GameAnalysis, player string) []AnkiCard {
+	cards := []AnkiCard{}
+	for _, game := range games {
+		color := ""
+		if player != "" {
+			if color = game.PlayerColor(player); color == "" {
+				continue
+			}
+		}
+		for i := range game.Moves {
+			move := &game.Moves[i]
+			if color != "" && move.Color != color {
+				continue
+			}
+			if move.Classification != chessanalysis.Blunder && move.Classification != chessanalysis.Questionable {
+				continue
+			}
+			cards = append(cards, mistakeCard(game, move))
+		}
+	}
+	return cards
+}
+
+// mistakeCard builds the card for a single mistake. Fields are HTML, as Anki
+// renders them.
+func mistakeCard(game *chessanalysis.GameAnalysis, move *chessanalysis.MoveAnalysis) AnkiCard {
+	var front strings.Builder
+	fmt.Fprintf(&front, "%s<br>", html.EscapeString(move.FENBefore))
+	fmt.Fprintf(&front, "%s to move. The game continued %s%s — find a better move.",
+		move.Color, html.EscapeString(chessanalysis.MoveLabel(move)), move.Symbol())
+	if move.FENBefore != "" {
+		fmt.Fprintf(&front, `<br><a href="%s">Open on Lichess</a>`, html.EscapeString(chessanalysis.LichessAnalysisURL(move.FENBefore)))
+	}
+
+	var back strings.Builder
+	fmt.Fprintf(&back, "Best: %s", html.EscapeString(chessanalysis.FormatLine(move.MoveNumber, move.Color, []string{move.BestMoveSAN})))
+	if len(move.Refutation) > 0 {
+		line := append([]string{move.MoveText}, move.Refutation...)
+		fmt.Fprintf(&back, "<br>Refutation: %s", html.EscapeString(chessanalysis.FormatLine(move.MoveNumber, move.Color, line)))
+	}
+	fmt.Fprintf(&back, "<br>Cost: %.0f centipawns", move.CentipawnLoss)
+
+	tags := []string{"chess-analyzer", strings.ToLower(move.Classification.String()), strings.ToLower(move.Phase.String())}
+	if eco := game.Headers["ECO"]; eco != "" {
+		tags = append(tags, eco)
+	}
+	return AnkiCard{Front: front.String(), Back: back.String(), Tags: tags}
+}
+
+// WriteAnkiCSV writes the cards as a CSV file for Anki's File > Import, with
+// header lines that tell Anki the separator, that fields contain HTML and
+// which column holds the tags
+func WriteAnkiCSV(w io.Writer, cards []AnkiCard) error {
+	if _, err := io.WriteString(w, "#separator:Comma\n#html:true\n#columns:Front,Back,Tags\n#tags column:3\n"); err != nil {
+		return err
+	}
+	writer := csv.NewWriter(w)
+	for _, card := range cards {
+		if err := writer.Write([]string{card.Front, card.Back, strings.Join(card.Tags, " ")}); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
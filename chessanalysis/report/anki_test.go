@@ -0,0 +1,44 @@
+package report
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/walterschell/chess-analyzer/chessanalysis"
+)
+
+func TestMistakeCards(t *testing.T) {
+	game, err := chessanalysis.AnalyzeGame(scholarsMatePgn, chessanalysis.WithDepth(3), chessanalysis.WithEngineFactory(scholarsMateEngine().NewEngine))
+	if err != nil {
+		t.Fatalf("failed to analyze game: %v", err)
+	}
+	games := []*chessanalysis.GameAnalysis{game}
+	if cards := MistakeCards(games, "Player 1"); len(cards) != 0 {
+		t.Errorf("expected no cards for White, got %d", len(cards))
+	}
+
+	cards := MistakeCards(games, "Player 2")
+	if len(cards) != 1 {
+		t.Fatalf("expected 1 card for Black, got %d", len(cards))
+	}
+	card := cards[0]
+	if !strings.Contains(card.Front, game.Moves[5].FENBefore) || !strings.Contains(card.Front, "3... Nf6??") {
+		t.Errorf("unexpected front %q", card.Front)
+	}
+	if !strings.Contains(card.Back, "Refutation: 3... Nf6 4. Qxf7#") {
+		t.Errorf("unexpected back %q", card.Back)
+	}
+
+	var csv bytes.Buffer
+	if err := WriteAnkiCSV(&csv, cards); err != nil {
+		t.Fatalf("failed to write deck: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(csv.String()), "\n")
+	if len(lines) != 5 || lines[0] != "#separator:Comma" {
+		t.Fatalf("unexpected deck:\n%s", csv.String())
+	}
+	if !strings.HasSuffix(lines[4], ",chess-analyzer blunder opening") {
+		t.Errorf("unexpected tags in %q", lines[4])
+	}
+}
@@ -0,0 +1,81 @@
+package report
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+
+	"github.com/walterschell/chess-analyzer/chessanalysis"
+)
+
+// csvColumns is the header row of the per-move CSV export
+var csvColumns = []string{
+	"game", "white", "black", "ply", "move_number", "color", "move", "fen_before",
+	"white_score", "previous_white_score", "best_move", "best_move_white_score",
+	"white_win", "white_draw", "white_loss", "classification", "accuracy", "centipawn_loss",
+	"phase", "depth", "nodes", "engine_time_ms", "clock_seconds", "time_trouble",
+}
+
+// WriteCSV writes the analysis of the games as CSV for spreadsheets, with a
+// header row and then one row per ply. Games are numbered from 1 in the game
+// column. Win, draw and loss chances are from White's perspective, from 0 to
+// 1, and clock_seconds is left empty where the PGN didn't record the clock.
+func WriteCSV(w io.Writer, games ...*chessanalysis.GameAnalysis) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(csvColumns); err != nil {
+		return err
+	}
+	for i, game := range games {
+		for ply := range game.Moves {
+			if err := writer.Write(csvRow(i+1, ply+1, game, &game.Moves[ply])); err != nil {
+				return err
+			}
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// csvRow returns the CSV columns of one move of a game
+func csvRow(game, ply int, analysis *chessanalysis.GameAnalysis, move *chessanalysis.MoveAnalysis) []string {
+	number := func(value float64) string {
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	}
+	// Scores are in pawns, or a mate such as "#-4"
+	score := func(value chessanalysis.Score) string {
+		if value.IsMate() {
+			return value.String()
+		}
+		return number(value.Pawns())
+	}
+	clock := ""
+	if move.HasClock {
+		clock = number(move.Clock.Seconds())
+	}
+	return []string{
+		strconv.Itoa(game),
+		analysis.Headers["White"],
+		analysis.Headers["Black"],
+		strconv.Itoa(ply),
+		strconv.Itoa(move.MoveNumber),
+		move.Color,
+		move.MoveText,
+		move.FENBefore,
+		score(move.WhiteScore),
+		score(move.PreviousWhiteScore),
+		move.BestMoveSAN,
+		score(move.BestMoveWhiteScore),
+		number(move.WhiteWinProb),
+		number(move.WhiteDrawProb),
+		number(move.WhiteLossProb),
+		move.Classification.String(),
+		number(move.Accuracy),
+		number(move.CentipawnLoss),
+		move.Phase.String(),
+		strconv.Itoa(move.Depth),
+		strconv.FormatInt(move.Nodes, 10),
+		strconv.FormatInt(move.TimeSpent.Milliseconds(), 10),
+		clock,
+		strconv.FormatBool(move.TimeTrouble),
+	}
+}
@@ -0,0 +1,52 @@
+package report
+
+import (
+	"bytes"
+	"encoding/csv"
+	"slices"
+	"testing"
+
+	"github.com/walterschell/chess-analyzer/chessanalysis"
+)
+
+func TestWriteCSV(t *testing.T) {
+	pgn := `[White "Player 1"]
+[Black "Player 2"]
+[Result "1-0"]
+
+1. e4 {[%clk 0:03:00]} e5 {[%clk 0:02:58.5]} 2. Qh5 Nc6 3. Bc4 Nf6 4. Qxf7# 1-0`
+	game, err := chessanalysis.AnalyzeGame(pgn, chessanalysis.WithDepth(3), chessanalysis.WithEngineFactory(scholarsMateEngine().NewEngine))
+	if err != nil {
+		t.Fatalf("failed to analyze game: %v", err)
+	}
+	var output bytes.Buffer
+	if err := WriteCSV(&output, game, game); err != nil {
+		t.Fatalf("failed to write CSV: %v", err)
+	}
+	rows, err := csv.NewReader(&output).ReadAll()
+	if err != nil {
+		t.Fatalf("failed to read CSV back: %v", err)
+	}
+	if len(rows) != 1+2*len(game.Moves) || !slices.Equal(rows[0], csvColumns) {
+		t.Fatalf("expected a header and %d rows, got:\n%v", 2*len(game.Moves), rows)
+	}
+	column := func(row []string, name string) string {
+		return row[slices.Index(csvColumns, name)]
+	}
+
+	e5, nf6 := rows[2], rows[6]
+	for name, want := range map[string]string{
+		"game": "1", "white": "Player 1", "ply": "2", "move_number": "1", "color": "Black",
+		"move": "e5", "clock_seconds": "178.5", "time_trouble": "false",
+	} {
+		if got := column(e5, name); got != want {
+			t.Errorf("expected %s of 1... e5 to be %q, got %q", name, want, got)
+		}
+	}
+	if column(nf6, "classification") != "Blunder" || column(nf6, "clock_seconds") != "" || column(nf6, "depth") != "3" {
+		t.Errorf("unexpected row for 3... Nf6: %v", nf6)
+	}
+	if last := rows[len(rows)-1]; column(last, "game") != "2" || column(last, "move") != "Qxf7#" {
+		t.Errorf("expected the second game to end the export, got %v", last)
+	}
+}
@@ -0,0 +1,295 @@
+// Package report renders analyzed games for people and other programs: the
+// Markdown report of a game, CSV for spreadsheets, annotated PGN and the
+// Markdown crosstable of a tournament. The analysis itself is done by the
+// chessanalysis package.
+package report
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/walterschell/chess-analyzer/chessanalysis"
+)
+
+// markdownHeaders are the PGN tags shown in markdown reports, in order
+var markdownHeaders = []string{"Event", "Site", "Date", "White", "Black", "Result", "ECO", "Opening", "TimeControl"}
+
+// escapeCell escapes text for use in a markdown table cell
+func escapeCell(text string) string {
+	return strings.ReplaceAll(text, "|", `\|`)
+}
+
+// thrownAwayPoints is how many expected points a player must lose in a phase
+// of the game for the report to point it out
+const thrownAwayPoints = 0.5
+
+// markdownOptions are the settings for rendering markdown reports
+type markdownOptions struct {
+	boardURL     string
+	translations chessanalysis.Translations
+}
+
+// MarkdownOption customizes a markdown report
+type MarkdownOption func(*markdownOptions)
+
+// WithBoardImages shows a board image of each critical moment, rendered by
+// the webapp's board endpoint at the given base URL, e.g. "https://example.com"
+func WithBoardImages(baseURL string) MarkdownOption {
+	return func(o *markdownOptions) {
+		o.boardURL = strings.TrimSuffix(baseURL, "/")
+	}
+}
+
+// WithTranslations writes the report in the language of the translations
+func WithTranslations(translations chessanalysis.Translations) MarkdownOption {
+	return func(o *markdownOptions) {
+		o.translations = translations
+	}
+}
+
+// boardImageURL returns the URL of an SVG of the position before the move,
+// with arrows for the move played and the best move
+func boardImageURL(baseURL string, move *chessanalysis.MoveAnalysis) string {
+	query := url.Values{"fen": {move.FENBefore}}
+	var arrows []string
+	if played := move.Hints.Played; played != nil {
+		arrows = append(arrows, "last:"+played.From+played.To)
+	}
+	if best := move.Hints.BestMove; best != nil {
+		arrows = append(arrows, "best:"+best.From+best.To)
+	}
+	if len(arrows) > 0 {
+		query.Set("arrows", strings.Join(arrows, ","))
+	}
+	return baseURL + "/api/v1/board.svg?" + query.Encode()
+}
+
+// accuracyCell formats an accuracy for a table cell, "-" if there is none
+func accuracyCell(accuracy *float64) string {
+	if accuracy == nil {
+		return "-"
+	}
+	return fmt.Sprintf("%.1f", *accuracy)
+}
+
+// bookExitCell describes the book exit for a table cell
+func bookExitCell(e *chessanalysis.BookExit) string {
+	if e == nil {
+		return "-"
+	}
+	text := fmt.Sprintf("%s (%s)", e.Move, e.WhiteScore.Format())
+	if len(e.BookMoves) > 0 {
+		text += ", book was " + e.BookMoves[0]
+	}
+	return escapeCell(text)
+}
+
+// openingQualityText describes how the named player came out of the opening
+func openingQualityText(t chessanalysis.Translations, player string, quality *chessanalysis.OpeningQuality) string {
+	id := "markdown.emergedWith"
+	if quality.LeftBook {
+		id = "markdown.leftBookWith"
+	}
+	text := t.Text(id, player, quality.Move, quality.WhiteScore.Format())
+	if inaccuracy := quality.FirstInaccuracy; inaccuracy != nil {
+		text += t.Text("markdown.firstInaccuracy", inaccuracy.Move, inaccuracy.CentipawnLoss)
+	}
+	switch {
+	case quality.InRepertoire == nil:
+	case *quality.InRepertoire:
+		text += t.Text("markdown.keptRepertoire")
+	default:
+		text += t.Text("markdown.leftRepertoire")
+	}
+	return text
+}
+
+// ratingCell shows a rating tag for a table cell, "-" for a player without one
+func ratingCell(rating int) string {
+	if rating <= 0 {
+		return "-"
+	}
+	return fmt.Sprint(rating)
+}
+
+// Markdown renders a summary of the game suitable for pasting into issues,
+// chat or blog posts: the game headers, each player's accuracy and move
+// classifications, and the critical moments with links to their positions
+func Markdown(g *chessanalysis.GameAnalysis, opts ...MarkdownOption) string {
+	var options markdownOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	var b strings.Builder
+	t := options.translations
+	title := t.Text("markdown.title")
+	if g.Headers["White"] != "" || g.Headers["Black"] != "" {
+		title = t.Text("markdown.players", g.Headers["White"], g.Headers["Black"])
+	}
+	fmt.Fprintf(&b, "## %s\n\n", escapeCell(title))
+	if g.Summary.Partial {
+		fmt.Fprintf(&b, "> %s\n\n", t.Text("markdown.partial", len(g.Moves)))
+	}
+	if g.Heuristic() {
+		fmt.Fprintf(&b, "> %s\n\n", t.Text("markdown.heuristic"))
+	}
+
+	fmt.Fprintf(&b, "| %s | %s |\n|---|---|\n", t.Text("markdown.tag"), t.Text("markdown.value"))
+	for _, tag := range markdownHeaders {
+		if value := g.Headers[tag]; value != "" {
+			fmt.Fprintf(&b, "| %s | %s |\n", tag, escapeCell(value))
+		}
+	}
+	if opening := g.Opening; opening != nil && opening.Transposed() {
+		fmt.Fprintf(&b, "\n%s", t.Text("markdown.transposition", opening.ECO, opening.Name, opening.Transposition))
+		if opening.Nominal != nil {
+			b.WriteString(t.Text("markdown.nominalOpening", opening.Nominal.ECO, opening.Nominal.Name))
+		}
+		b.WriteString("\n")
+	}
+	if g.Summary.NothingToAnalyze {
+		fmt.Fprintf(&b, "\n> %s\n", t.Text("markdown.nothingToAnalyze", chessanalysis.MinAnalyzedPlies))
+		return b.String()
+	}
+
+	counts := map[string]map[chessanalysis.MoveClassification]int{"White": {}, "Black": {}}
+	for _, move := range g.Moves {
+		counts[move.Color][move.Classification]++
+	}
+	fmt.Fprintf(&b, "\n| | %s | %s |\n|---|---:|---:|\n", t.Text("markdown.white"), t.Text("markdown.black"))
+	fmt.Fprintf(&b, "| %s | %.1f | %.1f |\n", t.Text("markdown.accuracy"), g.Summary.White.Accuracy, g.Summary.Black.Accuracy)
+	fmt.Fprintf(&b, "| %s | %.1f | %.1f |\n", t.Text("markdown.acpl"), g.Summary.White.ACPL, g.Summary.Black.ACPL)
+	fmt.Fprintf(&b, "| %s | %.0f%% | %.0f%% |\n", t.Text("markdown.bestMoveAgreement"), g.Summary.White.BestMoveAgreement, g.Summary.Black.BestMoveAgreement)
+	fmt.Fprintf(&b, "| %s | %+.2f | %+.2f |\n", t.Text("markdown.expectedPoints"), g.Summary.White.ExpectedPoints, g.Summary.Black.ExpectedPoints)
+	fmt.Fprintf(&b, "| %s | %d | %d |\n", t.Text("markdown.estimatedRating"), g.Summary.White.EstimatedRating, g.Summary.Black.EstimatedRating)
+	if g.Summary.White.RatingPrior > 0 || g.Summary.Black.RatingPrior > 0 {
+		// The estimate is seeded with the tags, so the parts it came from are shown too
+		fmt.Fprintf(&b, "| %s | %s | %s |\n", t.Text("markdown.ratingPrior"), ratingCell(g.Summary.White.RatingPrior), ratingCell(g.Summary.Black.RatingPrior))
+		fmt.Fprintf(&b, "| %s | %d | %d |\n", t.Text("markdown.moveQualityRating"), g.Summary.White.MoveQualityRating, g.Summary.Black.MoveQualityRating)
+	}
+	if g.Summary.White.LostPositions > 0 || g.Summary.Black.LostPositions > 0 {
+		fmt.Fprintf(&b, "| %s | %d/%d | %d/%d |\n", t.Text("markdown.resourcefulness"),
+			g.Summary.White.Swindles, g.Summary.White.LostPositions, g.Summary.Black.Swindles, g.Summary.Black.LostPositions)
+	}
+	if g.Summary.White.BookExit != nil || g.Summary.Black.BookExit != nil {
+		fmt.Fprintf(&b, "| %s | %s | %s |\n", t.Text("markdown.leftBook"), bookExitCell(g.Summary.White.BookExit), bookExitCell(g.Summary.Black.BookExit))
+	}
+	for c := chessanalysis.Forced; c > chessanalysis.Neutral; c-- {
+		fmt.Fprintf(&b, "| %s | %d | %d |\n", t.Classification(c), counts["White"][c], counts["Black"][c])
+	}
+
+	fmt.Fprintf(&b, "\n| %s | %s | %s |\n|---|---:|---:|\n", t.Text("markdown.accuracyByPhase"), t.Text("markdown.white"), t.Text("markdown.black"))
+	for _, row := range g.Summary.AccuracyByPhase {
+		fmt.Fprintf(&b, "| %s | %s | %s |\n", t.Text("phaseTitle."+row.Phase), accuracyCell(row.White), accuracyCell(row.Black))
+	}
+
+	var thrownAway []string
+	for _, player := range []struct {
+		name    string
+		summary *chessanalysis.PlayerSummary
+	}{{t.Text("markdown.white"), &g.Summary.White}, {t.Text("markdown.black"), &g.Summary.Black}} {
+		for _, phase := range []chessanalysis.GamePhase{chessanalysis.Opening, chessanalysis.Middlegame, chessanalysis.Endgame} {
+			if lost := -player.summary.Phase(phase).ExpectedPoints; lost >= thrownAwayPoints {
+				thrownAway = append(thrownAway, "- "+t.Text("markdown.threwAway", player.name, lost, t.Text("phase."+phase.String())))
+			}
+		}
+	}
+	if len(thrownAway) > 0 {
+		b.WriteString("\n" + strings.Join(thrownAway, "\n") + "\n")
+	}
+
+	var openings []string
+	for _, player := range []struct {
+		name    string
+		quality *chessanalysis.OpeningQuality
+	}{{t.Text("markdown.white"), g.Summary.White.OpeningQuality}, {t.Text("markdown.black"), g.Summary.Black.OpeningQuality}} {
+		if player.quality != nil {
+			openings = append(openings, "- "+openingQualityText(t, player.name, player.quality))
+		}
+	}
+	if len(openings) > 0 {
+		fmt.Fprintf(&b, "\n### %s\n\n", t.Text("markdown.openingQuality"))
+		b.WriteString(strings.Join(openings, "\n") + "\n")
+	}
+
+	if draw := g.Summary.DeadDraw; draw != nil {
+		fmt.Fprintf(&b, "\n> %s\n", t.Text("markdown.deadDraw", draw.Move, draw.Moves()))
+	}
+
+	fmt.Fprintf(&b, "\n### %s\n\n", t.Text("markdown.criticalMoments"))
+	critical := 0
+	for i := range g.Moves {
+		move := &g.Moves[i]
+		if (move.Classification != chessanalysis.Blunder && move.Classification != chessanalysis.Questionable) || move.MissedDraw != "" {
+			// Missed draws are listed on their own
+			continue
+		}
+		critical++
+		fmt.Fprintf(&b, "- **%s** %s (-%.0f cp)", chessanalysis.MoveLabel(move), t.Classification(move.Classification), move.CentipawnLoss)
+		if move.BestMoveSAN != "" && !move.IsBestMove {
+			b.WriteString(t.Text("markdown.bestWas", move.BestMoveSAN))
+		}
+		if move.MissedMate > 0 {
+			b.WriteString(t.Text("markdown.missedMate", move.MissedMate))
+		}
+		if try := move.PracticalTry; try != nil && try.UCI != move.BestMove {
+			b.WriteString(t.Text("markdown.practicalTry", try.Move))
+		}
+		if move.FENBefore != "" {
+			fmt.Fprintf(&b, " — [%s](%s)", t.Text("markdown.position"), chessanalysis.LichessAnalysisURL(move.FENBefore))
+		}
+		b.WriteString("\n")
+		if options.boardURL != "" && move.FENBefore != "" {
+			fmt.Fprintf(&b, "\n  ![%s](%s)\n\n", chessanalysis.MoveLabel(move), boardImageURL(options.boardURL, move))
+		}
+	}
+	if critical == 0 {
+		b.WriteString(t.Text("markdown.none") + "\n")
+	}
+
+	var missedDraws []string
+	for i := range g.Moves {
+		if move := &g.Moves[i]; move.MissedDraw != "" {
+			missedDraws = append(missedDraws, "- "+t.Text("markdown.missedDraw", chessanalysis.MoveLabel(move), t.Text("missedDraw."+move.MissedDraw), move.BestMoveSAN))
+		}
+	}
+	if len(missedDraws) > 0 {
+		fmt.Fprintf(&b, "\n### %s\n\n", t.Text("markdown.missedDraws"))
+		b.WriteString(strings.Join(missedDraws, "\n") + "\n")
+	}
+
+	if mustWin := g.Options.MustWin; mustWin != "" && len(g.Moves) > 0 {
+		fmt.Fprintf(&b, "\n### %s\n\n", t.Text("markdown.practicalChances"))
+		last := &g.Moves[len(g.Moves)-1]
+		b.WriteString(t.Text("markdown.mustWin", t.Text("markdown."+strings.ToLower(mustWin)), last.PracticalChances) + "\n")
+		for i := range g.Moves {
+			if move := &g.Moves[i]; move.PracticalLoss >= chessanalysis.PracticalMistakeThreshold {
+				b.WriteString("- " + t.Text("markdown.practicalMistake", chessanalysis.MoveLabel(move), move.PracticalLoss, move.PracticalChances) + "\n")
+			}
+		}
+	}
+
+	if len(g.Summary.Swindles) > 0 {
+		fmt.Fprintf(&b, "\n### %s\n\n", t.Text("markdown.swindles"))
+		for _, swindle := range g.Summary.Swindles {
+			b.WriteString("- " + t.Text("markdown.swindle", swindle.Move, t.Text("markdown."+strings.ToLower(swindle.Color)), swindle.From, swindle.To) + "\n")
+		}
+	}
+
+	var sacrifices []string
+	for i := range g.Moves {
+		move := &g.Moves[i]
+		switch {
+		case move.Sacrifice:
+			sacrifices = append(sacrifices, "- "+t.Text("markdown.sacrifice", chessanalysis.MoveLabel(move), move.SacrificeMaterial))
+		case move.BestMoveSacrifice:
+			sacrifices = append(sacrifices, "- "+t.Text("markdown.missedSacrifice", chessanalysis.MoveLabel(move), move.BestMoveSAN, move.BestSacrificeMaterial))
+		}
+	}
+	if len(sacrifices) > 0 {
+		fmt.Fprintf(&b, "\n### %s\n\n", t.Text("markdown.sacrifices"))
+		b.WriteString(strings.Join(sacrifices, "\n") + "\n")
+	}
+	return b.String()
+}
@@ -0,0 +1,199 @@
+package report
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/walterschell/chess-analyzer/chessanalysis"
+	"github.com/walterschell/chess-analyzer/chessanalysis/uciengine"
+)
+
+func TestGameAnalysisMarkdown(t *testing.T) {
+	game, err := chessanalysis.AnalyzeGame(scholarsMatePgn, chessanalysis.WithEngineFactory(scholarsMateEngine().NewEngine))
+	if err != nil {
+		t.Fatal(err)
+	}
+	markdown := Markdown(game)
+	for _, want := range []string{
+		"## Player 1 vs Player 2",
+		"| Result | 1-0 |",
+		"| Accuracy |",
+		"| Blunder | 0 | 1 |",
+		"| Expected points | -0.20 | -0.70 |",
+		"| Opening | 78.3 | 46.6 |",
+		"| Middlegame | - | - |",
+		"- Black threw away 0.7 expected points in the opening",
+		"- **3... Nf6** Blunder",
+		"best was g6",
+		"(https://lichess.org/analysis/r1bqkbnr/pppp1ppp/2n5/4p2Q/2B1P3/8/PPPP1PPP/RNB1K1NR_b_KQkq_-_3_3)",
+	} {
+		if !strings.Contains(markdown, want) {
+			t.Errorf("markdown missing %q:\n%s", want, markdown)
+		}
+	}
+	if strings.Contains(markdown, "Rating tag") || strings.Contains(markdown, "Heuristic only") {
+		t.Errorf("expected no rating tags or heuristic warning for a game without them:\n%s", markdown)
+	}
+
+	game, err = chessanalysis.AnalyzeGame("[WhiteElo \"1850\"]\n"+scholarsMatePgn, chessanalysis.WithEngineFactory(scholarsMateEngine().NewEngine))
+	if err != nil {
+		t.Fatal(err)
+	}
+	markdown = Markdown(game)
+	want := fmt.Sprintf("| Rating shown by the moves | %d | %d |", game.Summary.White.MoveQualityRating, game.Summary.Black.MoveQualityRating)
+	if !strings.Contains(markdown, "| Rating tag | 1850 | - |") || !strings.Contains(markdown, want) {
+		t.Errorf("expected the rating tags and the estimates from the moves:\n%s", markdown)
+	}
+}
+
+func TestGameAnalysisMarkdownHeuristic(t *testing.T) {
+	missing := func() (chessanalysis.Engine, error) { return nil, fmt.Errorf("stockfish not found") }
+	game, err := chessanalysis.AnalyzeGame(scholarsMatePgn, chessanalysis.WithEngineFactory(chessanalysis.HeuristicFallback(missing)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if markdown := Markdown(game); !strings.Contains(markdown, "> Heuristic only: no engine could be started") {
+		t.Errorf("expected the heuristic evaluation called out:\n%s", markdown)
+	}
+}
+
+func TestGameAnalysisMarkdownBoardImages(t *testing.T) {
+	game, err := chessanalysis.AnalyzeGame(scholarsMatePgn, chessanalysis.WithEngineFactory(scholarsMateEngine().NewEngine))
+	if err != nil {
+		t.Fatal(err)
+	}
+	markdown := Markdown(game, WithBoardImages("https://example.com/"))
+	want := "![3... Nf6](https://example.com/api/v1/board.svg?arrows=last%3Ag8f6%2Cbest%3Ag7g6&fen=r1bqkbnr%2Fpppp1ppp%2F2n5%2F4p2Q%2F2B1P3%2F8%2FPPPP1PPP%2FRNB1K1NR+b+KQkq+-+3+3)"
+	if !strings.Contains(markdown, want) {
+		t.Errorf("markdown missing %q:\n%s", want, markdown)
+	}
+}
+
+func TestGameAnalysisMarkdownTranslated(t *testing.T) {
+	game, err := chessanalysis.AnalyzeGame(scholarsMatePgn, chessanalysis.WithEngineFactory(scholarsMateEngine().NewEngine))
+	if err != nil {
+		t.Fatal(err)
+	}
+	french := chessanalysis.Translations{
+		"classification.Blunder":   "Gaffe",
+		"markdown.players":         "%[2]s contre %[1]s",
+		"markdown.bestWas":         ", le meilleur coup était %s",
+		"markdown.criticalMoments": "Moments critiques",
+	}
+	markdown := Markdown(game, WithTranslations(french))
+	for _, want := range []string{
+		"## Player 2 contre Player 1",
+		"| Gaffe | 0 | 1 |",
+		"### Moments critiques",
+		"- **3... Nf6** Gaffe",
+		"le meilleur coup était g6",
+		"| Accuracy |", // Untranslated messages stay in English
+	} {
+		if !strings.Contains(markdown, want) {
+			t.Errorf("markdown missing %q:\n%s", want, markdown)
+		}
+	}
+}
+
+func TestMarkdownSections(t *testing.T) {
+	missedDraw := chessanalysis.NewGameAnalysis("", []chessanalysis.MoveAnalysis{
+		{MoveNumber: 60, Color: "Black", MoveText: "Rb8", BestMoveSAN: "Rb6+", Classification: chessanalysis.Blunder, MissedDraw: chessanalysis.MissedDrawStalemate},
+		{MoveNumber: 61, Color: "White", MoveText: "Qa6+", Classification: chessanalysis.Best},
+	}, chessanalysis.EffectiveOptions{})
+
+	swindle := &chessanalysis.GameAnalysis{Summary: chessanalysis.GameSummary{
+		Black:    chessanalysis.PlayerSummary{LostPositions: 2, Swindles: 1},
+		Swindles: []chessanalysis.Swindle{{Ply: 2, Move: "2. Qh5", Color: "Black", From: 5, To: 50}},
+	}}
+
+	bookExits := &chessanalysis.GameAnalysis{Summary: chessanalysis.GameSummary{
+		White: chessanalysis.PlayerSummary{BookExit: &chessanalysis.BookExit{Move: "2. Qh5", WhiteScore: uciengine.Pawns(-0.5), BookMoves: []string{"Nf3"}}},
+		Black: chessanalysis.PlayerSummary{BookExit: &chessanalysis.BookExit{Move: "2... Nc6", WhiteScore: uciengine.Pawns(0.5)}},
+	}}
+
+	tests := []struct {
+		name    string
+		game    *chessanalysis.GameAnalysis
+		want    []string
+		notWant []string
+	}{
+		{
+			name: "Partial",
+			game: &chessanalysis.GameAnalysis{Moves: []chessanalysis.MoveAnalysis{{MoveNumber: 1, Color: "White", MoveText: "e4"}}, Summary: chessanalysis.GameSummary{Partial: true}},
+			want: []string{"Partial analysis"},
+		},
+		{
+			name:    "Nothing to analyze",
+			game:    &chessanalysis.GameAnalysis{Headers: map[string]string{"White": "Player 1"}, Summary: chessanalysis.GameSummary{NothingToAnalyze: true}},
+			want:    []string{"Nothing to analyze"},
+			notWant: []string{"Accuracy"},
+		},
+		{
+			name: "Transposition",
+			game: &chessanalysis.GameAnalysis{Opening: &chessanalysis.GameOpening{
+				ECOOpening:    chessanalysis.ECOOpening{ECO: "D35", Name: "Queen's Gambit Declined: Normal Defense", Moves: "1. d4 d5 2. c4 e6 3. Nc3 Nf6"},
+				Ply:           5,
+				Nominal:       &chessanalysis.ECOOpening{ECO: "A13", Name: "English Opening: Agincourt Defense", Moves: "1. c4 e6"},
+				Transposition: "1. c4 e6 2. Nc3 d5 3. d4 Nf6",
+			}},
+			want: []string{"The game transposed into the **D35 Queen's Gambit Declined: Normal Defense** with 1. c4 e6 2. Nc3 d5 3. d4 Nf6. Its moves began as the A13 English Opening: Agincourt Defense."},
+		},
+		{
+			name: "Book exits",
+			game: bookExits,
+			want: []string{"| Left book | 2. Qh5 (-0.50), book was Nf3 | 2... Nc6 (+0.50) |"},
+		},
+		{
+			name: "Opening quality",
+			game: &chessanalysis.GameAnalysis{Summary: chessanalysis.GameSummary{
+				White: chessanalysis.PlayerSummary{OpeningQuality: &chessanalysis.OpeningQuality{
+					Ply: 22, Move: "12. Nf3", WhiteScore: uciengine.Pawns(0.4), LeftBook: true, InRepertoire: new(bool),
+					FirstInaccuracy: &chessanalysis.OpeningInaccuracy{Ply: 14, Move: "8. h3", Classification: "Questionable", CentipawnLoss: 60},
+				}},
+				Black: chessanalysis.PlayerSummary{OpeningQuality: &chessanalysis.OpeningQuality{Ply: 23, Move: "12... Nc6", WhiteScore: uciengine.Pawns(0.3)}},
+			}},
+			want: []string{
+				"### Out of the opening",
+				"- White left the book with **12. Nf3** at +0.40; the first mistake of the opening was **8. h3** (-60 cp); left the repertoire",
+				"- Black came out of the opening with **12... Nc6** at +0.30\n",
+			},
+		},
+		{
+			name: "Sacrifice",
+			game: &chessanalysis.GameAnalysis{Moves: []chessanalysis.MoveAnalysis{{MoveNumber: 3, Color: "White", MoveText: "Bxf7+", Sacrifice: true, SacrificeMaterial: 2}}},
+			want: []string{"- **3. Bxf7+** gives up 2 pawns of material"},
+		},
+		{
+			name: "Dead draw",
+			game: &chessanalysis.GameAnalysis{Summary: chessanalysis.GameSummary{DeadDraw: &chessanalysis.DeadDraw{Ply: 4, Move: "3. Ke3", Plies: 11}}},
+			want: []string{"dead draw after **3. Ke3**: the last 6 moves were a formality"},
+		},
+		{
+			name:    "Missed draw",
+			game:    missedDraw,
+			want:    []string{"### Missed draws\n\n- **60... Rb8** left the game lost, missing a draw by stalemate with Rb6+"},
+			notWant: []string{"- **60... Rb8** Blunder"},
+		},
+		{
+			name: "Swindle",
+			game: swindle,
+			want: []string{"| Lost positions saved | 0/0 | 1/2 |", "### Swindles\n\n- **2. Qh5** let Black back into the game, from 5% to 50%"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			markdown := Markdown(test.game)
+			for _, want := range test.want {
+				if !strings.Contains(markdown, want) {
+					t.Errorf("markdown missing %q:\n%s", want, markdown)
+				}
+			}
+			for _, notWant := range test.notWant {
+				if strings.Contains(markdown, notWant) {
+					t.Errorf("markdown unexpectedly contains %q:\n%s", notWant, markdown)
+				}
+			}
+		})
+	}
+}
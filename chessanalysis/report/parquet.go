@@ -0,0 +1,404 @@
+package report
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+	"strconv"
+
+	"github.com/walterschell/chess-analyzer/chessanalysis"
+)
+
+// The Parquet file is written without a library: uncompressed data pages with
+// PLAIN encoding, one page per column chunk, and the footer metadata in
+// Thrift's compact protocol. That is enough for pandas, DuckDB and Spark.
+// See https://parquet.apache.org/docs/file-format/ for the layout.
+
+// parquetMagic starts and ends every Parquet file
+const parquetMagic = "PAR1"
+
+// parquetRowGroupSize is how many plies are written per row group
+const parquetRowGroupSize = 100_000
+
+// Parquet physical types
+const (
+	parquetBoolean   = 0
+	parquetInt64     = 2
+	parquetDouble    = 5
+	parquetByteArray = 6
+)
+
+// Parquet encodings
+const (
+	parquetPlain = 0
+	parquetRLE   = 3
+)
+
+// parquetRow is one analyzed ply and the game it was played in
+type parquetRow struct {
+	game   int // From 1, in the order the games were given
+	ply    int // From 1
+	info   *chessanalysis.GameAnalysis
+	move   *chessanalysis.MoveAnalysis
+	elo    [2]int64 // White and Black ratings, or 0 if the game has none
+	hasElo [2]bool
+}
+
+// parquetColumn is a column of the Parquet export
+type parquetColumn struct {
+	name     string
+	kind     int32 // Physical type
+	optional bool
+	// value returns the column's value for a row: a bool, int64, float64 or
+	// string, or nil for a null in an optional column
+	value func(row *parquetRow) any
+}
+
+// parquetHeader returns a string column holding a PGN header of the game
+func parquetHeader(name, tag string) parquetColumn {
+	return parquetColumn{name: name, kind: parquetByteArray, value: func(row *parquetRow) any { return row.info.Headers[tag] }}
+}
+
+// parquetElo returns a rating column, null for games without the rating
+func parquetElo(name string, side int) parquetColumn {
+	return parquetColumn{name: name, kind: parquetInt64, optional: true, value: func(row *parquetRow) any {
+		if !row.hasElo[side] {
+			return nil
+		}
+		return row.elo[side]
+	}}
+}
+
+// parquetColumns are the columns of the Parquet export: the game's metadata
+// and then the same per-ply data as the CSV export
+var parquetColumns = []parquetColumn{
+	{"game", parquetInt64, false, func(row *parquetRow) any { return int64(row.game) }},
+	parquetHeader("event", "Event"),
+	parquetHeader("site", "Site"),
+	parquetHeader("date", "Date"),
+	parquetHeader("round", "Round"),
+	parquetHeader("white", "White"),
+	parquetHeader("black", "Black"),
+	parquetElo("white_elo", 0),
+	parquetElo("black_elo", 1),
+	parquetHeader("result", "Result"),
+	parquetHeader("eco", "ECO"),
+	parquetHeader("opening", "Opening"),
+	parquetHeader("time_control", "TimeControl"),
+	{"ply", parquetInt64, false, func(row *parquetRow) any { return int64(row.ply) }},
+	{"move_number", parquetInt64, false, func(row *parquetRow) any { return int64(row.move.MoveNumber) }},
+	{"color", parquetByteArray, false, func(row *parquetRow) any { return row.move.Color }},
+	{"move", parquetByteArray, false, func(row *parquetRow) any { return row.move.MoveText }},
+	{"fen_before", parquetByteArray, false, func(row *parquetRow) any { return row.move.FENBefore }},
+	{"white_score", parquetDouble, false, func(row *parquetRow) any { return row.move.WhiteScore.Pawns() }},
+	{"previous_white_score", parquetDouble, false, func(row *parquetRow) any { return row.move.PreviousWhiteScore.Pawns() }},
+	{"best_move", parquetByteArray, false, func(row *parquetRow) any { return row.move.BestMoveSAN }},
+	{"best_move_white_score", parquetDouble, false, func(row *parquetRow) any { return row.move.BestMoveWhiteScore.Pawns() }},
+	{"is_best_move", parquetBoolean, false, func(row *parquetRow) any { return row.move.IsBestMove }},
+	{"white_win", parquetDouble, false, func(row *parquetRow) any { return row.move.WhiteWinProb }},
+	{"white_draw", parquetDouble, false, func(row *parquetRow) any { return row.move.WhiteDrawProb }},
+	{"white_loss", parquetDouble, false, func(row *parquetRow) any { return row.move.WhiteLossProb }},
+	{"classification", parquetByteArray, false, func(row *parquetRow) any { return row.move.Classification.String() }},
+	{"accuracy", parquetDouble, false, func(row *parquetRow) any { return row.move.Accuracy }},
+	{"centipawn_loss", parquetDouble, false, func(row *parquetRow) any { return row.move.CentipawnLoss }},
+	{"phase", parquetByteArray, false, func(row *parquetRow) any { return row.move.Phase.String() }},
+	{"depth", parquetInt64, false, func(row *parquetRow) any { return int64(row.move.Depth) }},
+	{"nodes", parquetInt64, false, func(row *parquetRow) any { return row.move.Nodes }},
+	{"engine_time_ms", parquetInt64, false, func(row *parquetRow) any { return row.move.TimeSpent.Milliseconds() }},
+	{"clock_seconds", parquetDouble, true, func(row *parquetRow) any {
+		if !row.move.HasClock {
+			return nil
+		}
+		return row.move.Clock.Seconds()
+	}},
+	{"time_trouble", parquetBoolean, false, func(row *parquetRow) any { return row.move.TimeTrouble }},
+}
+
+// parquetChunk is where a column chunk was written, for the footer
+type parquetChunk struct {
+	offset int64
+	size   int64 // Including the page header
+	values int64
+}
+
+// WriteParquet writes the analysis of the games as a Parquet file for data
+// analysis tools such as pandas and DuckDB, with one row per ply across all
+// the games. Each row has the game's metadata from its PGN headers, numbered
+// from 1 in the game column, followed by the same per-ply columns as
+// report.WriteCSV. Ratings and clocks the PGN didn't record are null.
+func WriteParquet(w io.Writer, games ...*chessanalysis.GameAnalysis) error {
+	var rows []parquetRow
+	for i, game := range games {
+		row := parquetRow{game: i + 1, info: game}
+		for side, tag := range []string{"WhiteElo", "BlackElo"} {
+			if elo, err := strconv.ParseInt(game.Headers[tag], 10, 64); err == nil {
+				row.elo[side], row.hasElo[side] = elo, true
+			}
+		}
+		for ply := range game.Moves {
+			row.ply, row.move = ply+1, &game.Moves[ply]
+			rows = append(rows, row)
+		}
+	}
+
+	out := &countingWriter{w: w}
+	if _, err := io.WriteString(out, parquetMagic); err != nil {
+		return err
+	}
+	var groups [][]parquetChunk
+	for start := 0; start < len(rows); start += parquetRowGroupSize {
+		group := rows[start:min(start+parquetRowGroupSize, len(rows))]
+		var chunks []parquetChunk
+		for i := range parquetColumns {
+			chunk := parquetChunk{offset: out.n, values: int64(len(group))}
+			if err := writeParquetPage(out, &parquetColumns[i], group); err != nil {
+				return err
+			}
+			chunk.size = out.n - chunk.offset
+			chunks = append(chunks, chunk)
+		}
+		groups = append(groups, chunks)
+	}
+
+	footer := parquetFooter(int64(len(rows)), groups)
+	if _, err := out.Write(footer); err != nil {
+		return err
+	}
+	if err := binary.Write(out, binary.LittleEndian, uint32(len(footer))); err != nil {
+		return err
+	}
+	_, err := io.WriteString(out, parquetMagic)
+	return err
+}
+
+// writeParquetPage writes a column of a row group as a single data page
+func writeParquetPage(w io.Writer, column *parquetColumn, rows []parquetRow) error {
+	var page bytes.Buffer
+	var values []any
+	defined := make([]bool, len(rows))
+	for i := range rows {
+		if value := column.value(&rows[i]); value != nil {
+			values = append(values, value)
+			defined[i] = true
+		}
+	}
+	if column.optional {
+		// Definition levels, prefixed with their length
+		levels := parquetLevels(defined)
+		binary.Write(&page, binary.LittleEndian, uint32(len(levels)))
+		page.Write(levels)
+	}
+	if column.kind == parquetBoolean {
+		bits := make([]bool, len(values))
+		for i, value := range values {
+			bits[i] = value.(bool)
+		}
+		page.Write(parquetBitPack(bits))
+	}
+	for _, value := range values {
+		switch value := value.(type) {
+		case int64:
+			binary.Write(&page, binary.LittleEndian, value)
+		case float64:
+			binary.Write(&page, binary.LittleEndian, math.Float64bits(value))
+		case string:
+			binary.Write(&page, binary.LittleEndian, uint32(len(value)))
+			page.WriteString(value)
+		}
+	}
+
+	var header thriftWriter
+	header.begin()
+	header.i32(1, 0) // DATA_PAGE
+	header.i32(2, int32(page.Len()))
+	header.i32(3, int32(page.Len()))
+	header.structField(5)
+	header.i32(1, int32(len(rows)))
+	header.i32(2, parquetPlain)
+	header.i32(3, parquetRLE)
+	header.i32(4, parquetRLE)
+	header.end()
+	header.end()
+	if _, err := w.Write(header.Bytes()); err != nil {
+		return err
+	}
+	_, err := w.Write(page.Bytes())
+	return err
+}
+
+// parquetBitPack packs bits into bytes, least significant bit first, as
+// PLAIN encoding does with booleans
+func parquetBitPack(bits []bool) []byte {
+	packed := make([]byte, (len(bits)+7)/8)
+	for i, bit := range bits {
+		if bit {
+			packed[i/8] |= 1 << (i % 8)
+		}
+	}
+	return packed
+}
+
+// parquetLevels encodes the definition levels of an optional column as a
+// single bit-packed run of Parquet's RLE/bit packing hybrid encoding
+func parquetLevels(defined []bool) []byte {
+	packed := parquetBitPack(defined)
+	return append(binary.AppendUvarint(nil, uint64(len(packed))<<1|1), packed...)
+}
+
+// parquetFooter returns the file's metadata: its schema and where each column
+// chunk of each row group was written
+func parquetFooter(rows int64, groups [][]parquetChunk) []byte {
+	var meta thriftWriter
+	meta.begin()
+	meta.i32(1, 1) // Version
+	meta.list(2, thriftStruct, len(parquetColumns)+1)
+	meta.begin()
+	meta.string(4, "schema")
+	meta.i32(5, int32(len(parquetColumns)))
+	meta.end()
+	for _, column := range parquetColumns {
+		meta.begin()
+		meta.i32(1, column.kind)
+		repetition := int32(0) // REQUIRED
+		if column.optional {
+			repetition = 1 // OPTIONAL
+		}
+		meta.i32(3, repetition)
+		meta.string(4, column.name)
+		if column.kind == parquetByteArray {
+			meta.i32(6, 0) // UTF8
+		}
+		meta.end()
+	}
+	meta.i64(3, rows)
+	meta.list(4, thriftStruct, len(groups))
+	for _, chunks := range groups {
+		meta.begin()
+		meta.list(1, thriftStruct, len(chunks))
+		var size int64
+		for i, chunk := range chunks {
+			column := &parquetColumns[i]
+			size += chunk.size
+			meta.begin()
+			meta.i64(2, chunk.offset)
+			meta.structField(3)
+			meta.i32(1, column.kind)
+			meta.list(2, thriftI32, 2)
+			meta.varint(zigzag(parquetPlain))
+			meta.varint(zigzag(parquetRLE))
+			meta.list(3, thriftBinary, 1)
+			meta.rawString(column.name)
+			meta.i32(4, 0) // UNCOMPRESSED
+			meta.i64(5, chunk.values)
+			meta.i64(6, chunk.size)
+			meta.i64(7, chunk.size)
+			meta.i64(9, chunk.offset)
+			meta.end()
+			meta.end()
+		}
+		meta.i64(2, size)
+		meta.i64(3, chunks[0].values)
+		meta.end()
+	}
+	meta.string(6, "chess-analyzer")
+	meta.end()
+	return meta.Bytes()
+}
+
+// Thrift compact protocol types
+const (
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+// thriftWriter encodes structs in Thrift's compact protocol, in which each
+// field is written as the difference from the previous field's ID
+type thriftWriter struct {
+	bytes.Buffer
+	lastField []int16 // ID of the last field written in each open struct, innermost last
+}
+
+// begin starts a struct, at the top level or as an element of a list
+func (t *thriftWriter) begin() {
+	t.lastField = append(t.lastField, 0)
+}
+
+// end finishes the innermost open struct
+func (t *thriftWriter) end() {
+	t.WriteByte(0)
+	t.lastField = t.lastField[:len(t.lastField)-1]
+}
+
+func (t *thriftWriter) field(id int16, kind byte) {
+	last := &t.lastField[len(t.lastField)-1]
+	if delta := id - *last; delta > 0 && delta <= 15 {
+		t.WriteByte(byte(delta)<<4 | kind)
+	} else {
+		t.WriteByte(kind)
+		t.varint(zigzag(int64(id)))
+	}
+	*last = id
+}
+
+func (t *thriftWriter) varint(value uint64) {
+	t.Write(binary.AppendUvarint(nil, value))
+}
+
+func (t *thriftWriter) i32(id int16, value int32) {
+	t.field(id, thriftI32)
+	t.varint(zigzag(int64(value)))
+}
+
+func (t *thriftWriter) i64(id int16, value int64) {
+	t.field(id, thriftI64)
+	t.varint(zigzag(value))
+}
+
+func (t *thriftWriter) string(id int16, value string) {
+	t.field(id, thriftBinary)
+	t.rawString(value)
+}
+
+// rawString writes a string without a field header, as a list element
+func (t *thriftWriter) rawString(value string) {
+	t.varint(uint64(len(value)))
+	t.WriteString(value)
+}
+
+// list starts a list field; its elements follow
+func (t *thriftWriter) list(id int16, kind byte, size int) {
+	t.field(id, thriftList)
+	if size < 15 {
+		t.WriteByte(byte(size)<<4 | kind)
+		return
+	}
+	t.WriteByte(0xf0 | kind)
+	t.varint(uint64(size))
+}
+
+// structField starts a struct field, which end finishes
+func (t *thriftWriter) structField(id int16) {
+	t.field(id, thriftStruct)
+	t.begin()
+}
+
+// zigzag maps signed integers to unsigned ones for varint encoding
+func zigzag(value int64) uint64 {
+	return uint64(value<<1 ^ value>>63)
+}
+
+// countingWriter counts the bytes written, for the offsets in the footer
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
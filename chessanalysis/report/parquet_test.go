@@ -0,0 +1,254 @@
+package report
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/walterschell/chess-analyzer/chessanalysis"
+)
+
+func TestWriteParquet(t *testing.T) {
+	pgn := `[White "Player 1"]
+[Black "Player 2"]
+[WhiteElo "1500"]
+[Result "1-0"]
+
+1. e4 {[%clk 0:03:00]} e5 {[%clk 0:02:58.5]} 2. Qh5 Nc6 3. Bc4 Nf6 4. Qxf7# 1-0`
+	game, err := chessanalysis.AnalyzeGame(pgn, chessanalysis.WithDepth(3), chessanalysis.WithEngineFactory(scholarsMateEngine().NewEngine))
+	if err != nil {
+		t.Fatalf("failed to analyze game: %v", err)
+	}
+	// A second game without ratings, for nulls in the rating columns
+	unrated := *game
+	unrated.Headers = map[string]string{"White": "Player 1", "Black": "Player 2", "Result": "1-0"}
+	var output bytes.Buffer
+	if err := WriteParquet(&output, game, &unrated); err != nil {
+		t.Fatalf("failed to write Parquet: %v", err)
+	}
+	file := output.Bytes()
+	if !bytes.HasPrefix(file, []byte(parquetMagic)) || !bytes.HasSuffix(file, []byte(parquetMagic)) {
+		t.Fatalf("expected the file to start and end with %q", parquetMagic)
+	}
+	footerSize := int(binary.LittleEndian.Uint32(file[len(file)-8:]))
+	if footerSize <= 0 || footerSize > len(file)-12 {
+		t.Fatalf("invalid footer size %d in a file of %d bytes", footerSize, len(file))
+	}
+	footer := file[len(file)-8-footerSize : len(file)-8]
+	for _, column := range parquetColumns {
+		if !bytes.Contains(footer, []byte(column.name)) {
+			t.Errorf("expected column %s in the footer", column.name)
+		}
+	}
+	// The first column chunk, of game numbers, follows the magic number
+	if !bytes.Contains(file[:100], binary.LittleEndian.AppendUint64(nil, 2)) {
+		t.Errorf("expected the second game's number in the first column chunk")
+	}
+
+	// Read the footer back and check it against the column chunks
+	reader := thriftReader{data: footer}
+	meta := reader.readStruct()
+	if reader.err != nil {
+		t.Fatalf("failed to read the footer: %v", reader.err)
+	}
+	plies := len(game.Moves)
+	if rows := meta[3]; rows != int64(2*plies) {
+		t.Errorf("expected %d rows, got %v", 2*plies, rows)
+	}
+	groups, _ := meta[4].([]any)
+	if len(groups) != 1 {
+		t.Fatalf("expected one row group, got %d", len(groups))
+	}
+	chunks, _ := groups[0].(map[int16]any)[1].([]any)
+	if len(chunks) != len(parquetColumns) {
+		t.Fatalf("expected %d column chunks, got %d", len(parquetColumns), len(chunks))
+	}
+	offset := int64(len(parquetMagic))
+	var eloOffset, eloSize int64
+	for i, chunk := range chunks {
+		chunkMeta, _ := chunk.(map[int16]any)[3].(map[int16]any)
+		name := parquetColumns[i].name
+		if path, _ := chunkMeta[3].([]any); len(path) != 1 || path[0] != name {
+			t.Errorf("expected chunk %d to be column %s, got %v", i, name, path)
+		}
+		if chunkMeta[9] != offset || chunk.(map[int16]any)[2] != offset {
+			t.Errorf("expected column %s at offset %d, got %v", name, offset, chunkMeta[9])
+		}
+		if chunkMeta[5] != int64(2*plies) {
+			t.Errorf("expected %d values in column %s, got %v", 2*plies, name, chunkMeta[5])
+		}
+		size, _ := chunkMeta[6].(int64)
+		if name == "white_elo" {
+			eloOffset, eloSize = offset, size
+		}
+		offset += size
+	}
+	if footerStart := int64(len(file) - 8 - footerSize); offset != footerStart {
+		t.Errorf("expected the column chunks to end at the footer, at %d, got %d", footerStart, offset)
+	}
+
+	// Decode the white_elo column: null for every ply of the unrated game
+	page := thriftReader{data: file[eloOffset : eloOffset+eloSize]}
+	header := page.readStruct()
+	if page.err != nil {
+		t.Fatalf("failed to read the white_elo page header: %v", page.err)
+	}
+	if values := header[5].(map[int16]any)[1]; values != int64(2*plies) {
+		t.Errorf("expected %d values in the white_elo page, got %v", 2*plies, values)
+	}
+	data := page.data[page.pos:]
+	if pageSize := header[3]; pageSize != int64(len(data)) {
+		t.Fatalf("expected a white_elo page of %v bytes, got %d", pageSize, len(data))
+	}
+	levelsSize := int(binary.LittleEndian.Uint32(data))
+	defined := readParquetLevels(t, data[4:4+levelsSize], 2*plies)
+	data = data[4+levelsSize:]
+	for ply, isDefined := range defined {
+		if isDefined != (ply < plies) {
+			t.Fatalf("expected white_elo to be defined for the first game's %d plies only, got %v", plies, defined)
+		}
+		if !isDefined {
+			continue
+		}
+		if elo := int64(binary.LittleEndian.Uint64(data)); elo != 1500 {
+			t.Errorf("expected a white_elo of 1500 at ply %d, got %d", ply+1, elo)
+		}
+		data = data[8:]
+	}
+	if len(data) != 0 {
+		t.Errorf("expected %d bytes left over after the white_elo values", len(data))
+	}
+}
+
+// readParquetLevels decodes the definition levels of an optional column from
+// the RLE/bit packing hybrid encoding with a bit width of 1
+func readParquetLevels(t *testing.T, data []byte, count int) []bool {
+	t.Helper()
+	var levels []bool
+	for len(data) > 0 {
+		header, n := binary.Uvarint(data)
+		if n <= 0 {
+			t.Fatalf("invalid run header in the definition levels")
+		}
+		data = data[n:]
+		if header&1 == 0 {
+			// An RLE run of a one-byte value
+			levels = append(levels, slices.Repeat([]bool{data[0] == 1}, int(header>>1))...)
+			data = data[1:]
+			continue
+		}
+		// A bit-packed run of groups of 8 values, a byte each at this width
+		groups := int(header >> 1)
+		for _, packed := range data[:groups] {
+			for bit := range 8 {
+				levels = append(levels, packed&(1<<bit) != 0)
+			}
+		}
+		data = data[groups:]
+	}
+	if len(levels) < count {
+		t.Fatalf("expected %d definition levels, got %d", count, len(levels))
+	}
+	// The last bit-packed group is padded to 8 values
+	return levels[:count]
+}
+
+// thriftReader decodes structs in Thrift's compact protocol as thriftWriter
+// encodes them, into maps of field IDs to int64s, strings, lists and structs
+type thriftReader struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+func (t *thriftReader) byte() byte {
+	if t.pos >= len(t.data) {
+		t.err = fmt.Errorf("unexpected end of data at %d", t.pos)
+		return 0
+	}
+	t.pos++
+	return t.data[t.pos-1]
+}
+
+func (t *thriftReader) varint() uint64 {
+	value, n := binary.Uvarint(t.data[min(t.pos, len(t.data)):])
+	if n <= 0 {
+		t.err = fmt.Errorf("invalid varint at %d", t.pos)
+		return 0
+	}
+	t.pos += n
+	return value
+}
+
+func (t *thriftReader) readStruct() map[int16]any {
+	fields := map[int16]any{}
+	var last int16
+	for t.err == nil {
+		header := t.byte()
+		if header == 0 {
+			break
+		}
+		if delta := int16(header >> 4); delta != 0 {
+			last += delta
+		} else {
+			last = int16(unzigzag(t.varint()))
+		}
+		fields[last] = t.readValue(header & 0x0f)
+	}
+	return fields
+}
+
+func (t *thriftReader) readValue(kind byte) any {
+	switch kind {
+	case thriftI32, thriftI64:
+		return unzigzag(t.varint())
+	case thriftBinary:
+		size := int(t.varint())
+		if t.pos+size > len(t.data) {
+			t.err = fmt.Errorf("string of %d bytes past the end of data at %d", size, t.pos)
+			return ""
+		}
+		t.pos += size
+		return string(t.data[t.pos-size : t.pos])
+	case thriftList:
+		header := t.byte()
+		size := int(header >> 4)
+		if size == 15 {
+			size = int(t.varint())
+		}
+		var list []any
+		for range size {
+			if t.err != nil {
+				break
+			}
+			list = append(list, t.readValue(header&0x0f))
+		}
+		return list
+	case thriftStruct:
+		return t.readStruct()
+	}
+	t.err = fmt.Errorf("unsupported type %d at %d", kind, t.pos)
+	return nil
+}
+
+// unzigzag reverses zigzag
+func unzigzag(value uint64) int64 {
+	return int64(value>>1) ^ -int64(value&1)
+}
+
+func TestThriftWriter(t *testing.T) {
+	var thrift thriftWriter
+	thrift.begin()
+	thrift.i32(1, -1)
+	thrift.string(20, "ab")
+	thrift.structField(21)
+	thrift.i64(1, 300)
+	thrift.end()
+	thrift.end()
+	want := []byte{0x15, 0x01, 0x08, 0x28, 0x02, 'a', 'b', 0x1c, 0x16, 0xd8, 0x04, 0x00, 0x00}
+	if !bytes.Equal(thrift.Bytes(), want) {
+		t.Errorf("expected % x, got % x", want, thrift.Bytes())
+	}
+}
@@ -0,0 +1,155 @@
+package report
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	chess "github.com/corentings/chess/v2"
+	"github.com/walterschell/chess-analyzer/chessanalysis"
+)
+
+// pgnOptions are the settings for writing annotated PGNs
+type pgnOptions struct {
+	nags *chessanalysis.NAGMapping
+}
+
+// PGNOption customizes an annotated PGN
+type PGNOption func(*pgnOptions)
+
+// WithNAGs writes the classifications as the glyphs of nags instead of
+// numeric NAGs
+func WithNAGs(nags *chessanalysis.NAGMapping) PGNOption {
+	return func(o *pgnOptions) {
+		o.nags = nags
+	}
+}
+
+// maxPGNVariations is how many of the engine's top lines are written as
+// variations of a mistake
+const maxPGNVariations = 3
+
+// AnnotatedPGN writes a game as PGN with the analysis of each move: its
+// classification as a NAG, the engine's evaluation as a [%eval] comment, and
+// where the move was a mistake the engine's choices as variations. Analyses
+// with a MultiPV above 1 give up to maxPGNVariations of the engine's top
+// lines, each evaluated; others give the best move alone. Moves that weren't
+// evaluated are written without annotations.
+func AnnotatedPGN(headers map[string]string, moves []chessanalysis.MoveAnalysis, opts ...PGNOption) string {
+	options := pgnOptions{nags: chessanalysis.NumericNAGs}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	var pgn strings.Builder
+	chessanalysis.WritePGNHeaders(&pgn, headers)
+
+	var tokens []string
+	for i := range moves {
+		move := &moves[i]
+		if move.Color == "White" {
+			tokens = append(tokens, fmt.Sprintf("%d.", move.MoveNumber))
+		} else if i == 0 || moves[i-1].Evaluated() {
+			// Black's move needs its number after a game start or a comment
+			tokens = append(tokens, fmt.Sprintf("%d...", move.MoveNumber))
+		}
+		tokens = append(tokens, move.MoveText)
+		if !move.Evaluated() {
+			continue
+		}
+		if nag := options.nags.Glyph(move.Classification); nag != "" {
+			tokens = append(tokens, nag)
+		}
+		tokens = append(tokens, fmt.Sprintf("{[%%eval %s]}", evalValue(move.WhiteScore)))
+		if move.Classification == chessanalysis.Blunder || move.Classification == chessanalysis.Questionable {
+			tokens = append(tokens, variations(move)...)
+		}
+	}
+	result := headers["Result"]
+	if result == "" {
+		result = "*"
+	}
+	tokens = append(tokens, result)
+	pgn.WriteString(strings.Join(tokens, " "))
+	pgn.WriteString("\n")
+	return pgn.String()
+}
+
+// variations returns the engine's choices in place of a move as PGN
+// variations: its top lines other than the move, or without them its best move
+func variations(move *chessanalysis.MoveAnalysis) []string {
+	if len(move.TopMoves) < 2 {
+		if move.BestMoveSAN == "" {
+			return nil
+		}
+		return []string{variation(move, []string{move.BestMoveSAN}, move.BestMoveWhiteScore)}
+	}
+	var variations []string
+	for _, top := range move.TopMoves {
+		if top.Move == move.MoveText {
+			continue
+		}
+		line := top.Line
+		if len(line) == 0 {
+			line = []string{top.Move}
+		}
+		variations = append(variations, variation(move, line, top.WhiteScore))
+		if len(variations) == maxPGNVariations {
+			break
+		}
+	}
+	return variations
+}
+
+// variation writes a line played instead of a move as a PGN variation, with
+// the line's evaluation after its first move
+func variation(move *chessanalysis.MoveAnalysis, line []string, score chessanalysis.Score) string {
+	tokens := make([]string, 0, 2*len(line)+1)
+	number, white := move.MoveNumber, move.Color == "White"
+	for i, san := range line {
+		switch {
+		case white:
+			tokens = append(tokens, fmt.Sprintf("%d.", number))
+		case i <= 1:
+			// Black's move needs its number at the start and after the comment
+			tokens = append(tokens, fmt.Sprintf("%d...", number))
+		}
+		tokens = append(tokens, san)
+		if i == 0 {
+			tokens = append(tokens, fmt.Sprintf("{[%%eval %s]}", evalValue(score)))
+		}
+		if !white {
+			number++
+		}
+		white = !white
+	}
+	return "(" + strings.Join(tokens, " ") + ")"
+}
+
+// SessionPGN writes the games of a UCI analysis session, as returned by
+// UCIProxy.Games, as an annotated PGN database
+func SessionPGN(games [][]chessanalysis.MoveAnalysis, opts ...PGNOption) string {
+	var pgn strings.Builder
+	for i, moves := range games {
+		headers := map[string]string{
+			"Event": fmt.Sprintf("UCI analysis session, game %d", i+1),
+			"Date":  time.Now().Format("2006.01.02"),
+		}
+		if fen := moves[0].FENBefore; fen != chess.StartingPosition().String() {
+			headers["SetUp"], headers["FEN"] = "1", fen
+		}
+		if i > 0 {
+			pgn.WriteString("\n")
+		}
+		pgn.WriteString(AnnotatedPGN(headers, moves, opts...))
+	}
+	return pgn.String()
+}
+
+// evalValue formats a score for an [%eval] command: pawns to two decimals, or
+// a mate such as "#-3"
+func evalValue(score chessanalysis.Score) string {
+	if score.IsMate() {
+		return score.String()
+	}
+	return fmt.Sprintf("%.2f", score.Pawns())
+}
@@ -0,0 +1,82 @@
+package report
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/walterschell/chess-analyzer/chessanalysis"
+	"github.com/walterschell/chess-analyzer/chessanalysis/uciengine"
+)
+
+func TestAnnotatedPGN(t *testing.T) {
+	moves := []chessanalysis.MoveAnalysis{
+		{MoveNumber: 1, Color: "White", MoveText: "e4", Depth: 10, Classification: chessanalysis.Good},
+		{MoveNumber: 1, Color: "Black", MoveText: "f6", Depth: 10, Classification: chessanalysis.Blunder},
+	}
+	if pgn := AnnotatedPGN(nil, moves); !strings.Contains(pgn, "1. e4 $1 ") || !strings.Contains(pgn, "1... f6 $4 ") {
+		t.Errorf("expected numeric NAGs, got %s", pgn)
+	}
+	if pgn := AnnotatedPGN(nil, moves, WithNAGs(chessanalysis.SymbolNAGs)); !strings.Contains(pgn, "1. e4 ! ") || !strings.Contains(pgn, "1... f6 ?? ") {
+		t.Errorf("expected symbols, got %s", pgn)
+	}
+}
+
+func TestAnnotatedPGNVariations(t *testing.T) {
+	moves := []chessanalysis.MoveAnalysis{
+		{MoveNumber: 1, Color: "White", MoveText: "g4", Depth: 10, Classification: chessanalysis.Questionable, BestMoveSAN: "e4",
+			TopMoves: []chessanalysis.EngineMove{
+				{Move: "e4", WhiteScore: uciengine.Pawns(0.3), Line: []string{"e4", "e5", "Nf3"}},
+				{Move: "d4", WhiteScore: uciengine.Pawns(0.2), Line: []string{"d4", "d5"}},
+				{Move: "g4", WhiteScore: uciengine.Pawns(-0.5)},
+				{Move: "c4", WhiteScore: uciengine.Pawns(0.1)},
+				{Move: "Nf3", WhiteScore: uciengine.Pawns(0.1)},
+			}},
+		{MoveNumber: 1, Color: "Black", MoveText: "f6", Depth: 10, Classification: chessanalysis.Blunder, BestMoveSAN: "d5",
+			TopMoves: []chessanalysis.EngineMove{
+				{Move: "d5", WhiteScore: uciengine.Pawns(-0.4), Line: []string{"d5", "h3", "e5"}},
+				{Move: "e5", WhiteScore: uciengine.Pawns(-0.3)},
+			}},
+	}
+	pgn := AnnotatedPGN(nil, moves)
+	for _, want := range []string{
+		"1. g4 $2 {[%eval 0.00]} (1. e4 {[%eval 0.30]} 1... e5 2. Nf3) (1. d4 {[%eval 0.20]} 1... d5) (1. c4 {[%eval 0.10]}) 1... f6",
+		"1... f6 $4 {[%eval 0.00]} (1... d5 {[%eval -0.40]} 2. h3 e5) (1... e5 {[%eval -0.30]}) *",
+	} {
+		if !strings.Contains(pgn, want) {
+			t.Errorf("expected the annotated PGN to contain %q:\n%s", want, pgn)
+		}
+	}
+	if games, err := chessanalysis.SplitPGN(pgn); err != nil || len(games) != 1 {
+		t.Errorf("expected the annotated PGN to parse, got %d games (%v)", len(games), err)
+	}
+}
+
+func TestSessionPGN(t *testing.T) {
+	games := [][]chessanalysis.MoveAnalysis{
+		{
+			{MoveNumber: 1, Color: "White", MoveText: "e4", Depth: 10, WhiteScore: uciengine.Pawns(-3), Classification: chessanalysis.Blunder, BestMoveSAN: "d4", BestMoveWhiteScore: uciengine.Pawns(0.3),
+				FENBefore: "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1"},
+			{MoveNumber: 1, Color: "Black", MoveText: "e5", Depth: 10, Classification: chessanalysis.Blunder, BestMoveSAN: "c5"},
+		},
+		{
+			{MoveNumber: 1, Color: "White", MoveText: "d4", Depth: 10, IsBestMove: true, FENBefore: "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1"},
+			{MoveNumber: 1, Color: "Black", MoveText: "Nf6", Depth: 10},
+		},
+	}
+	pgn := SessionPGN(games)
+	for _, want := range []string{
+		`[Event "UCI analysis session, game 1"]`,
+		"1. e4 $4 {[%eval -3.00]} (1. d4 {[%eval 0.30]}) 1... e5 $4",
+		`[Event "UCI analysis session, game 2"]`,
+	} {
+		if !strings.Contains(pgn, want) {
+			t.Errorf("expected the annotated PGN to contain %q:\n%s", want, pgn)
+		}
+	}
+	if strings.Contains(pgn, "[SetUp") {
+		t.Errorf("expected games from the starting position without a FEN:\n%s", pgn)
+	}
+	if games, err := chessanalysis.SplitPGN(pgn); err != nil || len(games) != 2 {
+		t.Errorf("expected the annotated PGN to parse as two games, got %d (%v)", len(games), err)
+	}
+}
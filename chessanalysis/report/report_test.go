@@ -0,0 +1,32 @@
+package report
+
+import "github.com/walterschell/chess-analyzer/chessanalysis"
+
+const scholarsMatePgn = `
+[Event "Scholar's Mate"]
+[White "Player 1"]
+[Black "Player 2"]
+[Result "1-0"]
+
+1. e4 e5 2. Qh5 Nc6 3. Bc4 Nf6 4. Qxf7# 1-0
+`
+
+// scholarsMateEngine finds 3... Nf6 a blunder, with 3... g6 best, and
+// 4. Qxf7# the best move
+func scholarsMateEngine() *chessanalysis.FakeEngine {
+	return &chessanalysis.FakeEngine{
+		Positions: map[string]chessanalysis.FakeEvaluation{
+			// Before 3...Nf6
+			"r1bqkbnr/pppp1ppp/2n5/4p2Q/2B1P3/8/PPPP1PPP/RNB1K1NR b KQkq - 3 3": {
+				BestMove: "g7g6",
+				Score:    0,
+				Moves:    map[string]int{"g8f6": -900},
+			},
+			// Before 4.Qxf7#
+			"r1bqkb1r/pppp1ppp/2n2n2/4p2Q/2B1P3/8/PPPP1PPP/RNB1K1NR w KQkq - 4 4": {
+				BestMove: "h5f7",
+				Score:    900,
+			},
+		},
+	}
+}
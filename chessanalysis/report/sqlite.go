@@ -0,0 +1,385 @@
+package report
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+
+	"github.com/walterschell/chess-analyzer/chessanalysis"
+)
+
+// The SQLite database is written without a driver, since the drivers need
+// cgo: every table is a table b-tree built bottom-up from its rows in rowid
+// order, with no indexes and no free pages. See
+// https://www.sqlite.org/fileformat.html for the layout.
+
+// sqlitePageSize is the page size of the database, all of which is usable
+const sqlitePageSize = 4096
+
+// sqliteHeaderSize is the size of the database header at the start of page 1
+const sqliteHeaderSize = 100
+
+// sqliteSchema is the schema of the SQLite export. Every table's first column
+// is its INTEGER PRIMARY KEY, which SQLite stores as the rowid.
+var sqliteSchema = []struct{ name, sql string }{
+	{"games", `CREATE TABLE games (
+  id INTEGER PRIMARY KEY,
+  event TEXT, site TEXT, date TEXT, round TEXT, white TEXT, black TEXT,
+  white_elo INTEGER, black_elo INTEGER, result TEXT, eco TEXT, opening TEXT, time_control TEXT,
+  white_accuracy REAL, black_accuracy REAL, white_acpl REAL, black_acpl REAL
+)`},
+	{"classifications", `CREATE TABLE classifications (
+  id INTEGER PRIMARY KEY,
+  name TEXT NOT NULL,
+  symbol TEXT NOT NULL
+)`},
+	{"moves", `CREATE TABLE moves (
+  id INTEGER PRIMARY KEY,
+  game_id INTEGER NOT NULL REFERENCES games(id),
+  ply INTEGER NOT NULL, move_number INTEGER NOT NULL, color TEXT NOT NULL,
+  san TEXT NOT NULL, fen_before TEXT NOT NULL, fen_after TEXT NOT NULL, phase TEXT NOT NULL,
+  clock_seconds REAL, time_trouble INTEGER NOT NULL
+)`},
+	{"evaluations", `CREATE TABLE evaluations (
+  move_id INTEGER PRIMARY KEY REFERENCES moves(id),
+  white_score REAL, previous_white_score REAL,
+  best_move TEXT, best_move_uci TEXT, best_move_white_score REAL, is_best_move INTEGER,
+  white_win REAL, white_draw REAL, white_loss REAL,
+  classification_id INTEGER REFERENCES classifications(id),
+  accuracy REAL, centipawn_loss REAL,
+  depth INTEGER, nodes INTEGER, engine_time_ms INTEGER, embedded_eval INTEGER
+)`},
+}
+
+// sqliteRow is a row of a table: its rowid, and the values of its columns,
+// each nil, bool, int64, float64 or string. An INTEGER PRIMARY KEY column is
+// nil, since SQLite reads it from the rowid.
+type sqliteRow struct {
+	id     int64
+	values []any
+}
+
+// WriteSQLite writes the analysis of the games as an SQLite database for
+// querying with plain SQL. Games are numbered from 1 in the games table, and
+// each ply is a row of the moves table with its engine evaluation in the
+// evaluations table under the same ID; classifications names the
+// classification of each evaluation. Ratings, clocks and evaluations the
+// analysis doesn't have are NULL.
+func WriteSQLite(w io.Writer, games ...*chessanalysis.GameAnalysis) error {
+	var gameRows, moveRows, evalRows, classificationRows []sqliteRow
+	for c := chessanalysis.Neutral; c <= chessanalysis.Forced; c++ {
+		classificationRows = append(classificationRows, sqliteRow{sqliteClassificationID(c), []any{nil, c.String(), chessanalysis.ASCIISymbols.Symbol(c)}})
+	}
+	for i, game := range games {
+		gameID := int64(i + 1)
+		elo := func(tag string) any {
+			if rating, err := strconv.ParseInt(game.Headers[tag], 10, 64); err == nil {
+				return rating
+			}
+			return nil
+		}
+		header := func(tag string) any {
+			if value, ok := game.Headers[tag]; ok {
+				return value
+			}
+			return nil
+		}
+		white, black := &game.Summary.White, &game.Summary.Black
+		gameRows = append(gameRows, sqliteRow{gameID, []any{
+			nil, header("Event"), header("Site"), header("Date"), header("Round"), header("White"), header("Black"),
+			elo("WhiteElo"), elo("BlackElo"), header("Result"), header("ECO"), header("Opening"), header("TimeControl"),
+			white.Accuracy, black.Accuracy, white.ACPL, black.ACPL,
+		}})
+		for ply := range game.Moves {
+			move := &game.Moves[ply]
+			moveID := int64(len(moveRows) + 1)
+			var clock any
+			if move.HasClock {
+				clock = move.Clock.Seconds()
+			}
+			moveRows = append(moveRows, sqliteRow{moveID, []any{
+				nil, gameID, int64(ply + 1), int64(move.MoveNumber), move.Color,
+				move.MoveText, move.FENBefore, move.FENAfter, move.Phase.String(),
+				clock, move.TimeTrouble,
+			}})
+			if !move.Evaluated() {
+				continue
+			}
+			var bestMove, bestMoveUCI any
+			if move.BestMove != "" {
+				bestMove, bestMoveUCI = move.BestMoveSAN, move.BestMove
+			}
+			evalRows = append(evalRows, sqliteRow{moveID, []any{
+				nil, move.WhiteScore.Pawns(), move.PreviousWhiteScore.Pawns(),
+				bestMove, bestMoveUCI, move.BestMoveWhiteScore.Pawns(), move.IsBestMove,
+				move.WhiteWinProb, move.WhiteDrawProb, move.WhiteLossProb,
+				sqliteClassificationID(move.Classification), move.Accuracy, move.CentipawnLoss,
+				int64(move.Depth), move.Nodes, move.TimeSpent.Milliseconds(), move.EmbeddedEval,
+			}})
+		}
+	}
+
+	var db sqliteDatabase
+	db.allocate() // Page 1 holds the schema, written once the tables' root pages are known
+	var schemaRows []sqliteRow
+	for i, rows := range [][]sqliteRow{gameRows, classificationRows, moveRows, evalRows} {
+		table := sqliteSchema[i]
+		root := db.writeTable(rows)
+		schemaRows = append(schemaRows, sqliteRow{int64(i + 1), []any{"table", table.name, table.name, int64(root), table.sql}})
+	}
+	cells := db.leafCells(schemaRows)
+	if !sqliteFits(sqliteHeaderSize+8, cells) {
+		return fmt.Errorf("schema doesn't fit on the first page")
+	}
+	writeSQLiteLeaf(db.pages[0], sqliteHeaderSize, cells)
+	writeSQLiteHeader(db.pages[0], len(db.pages))
+
+	for _, page := range db.pages {
+		if _, err := w.Write(page); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sqliteClassificationID is the ID of a classification in the classifications
+// table, numbered from 1 like the other tables
+func sqliteClassificationID(classification chessanalysis.MoveClassification) int64 {
+	return int64(classification) + 1
+}
+
+// sqliteDatabase is the pages of a database being written, page 1 first
+type sqliteDatabase struct {
+	pages [][]byte
+}
+
+// allocate adds an empty page and returns its page number
+func (d *sqliteDatabase) allocate() int {
+	d.pages = append(d.pages, make([]byte, sqlitePageSize))
+	return len(d.pages)
+}
+
+// sqliteMaxChildren is how many children an interior page has room for: a
+// cell of a page number and a rowid of up to 9 bytes, plus its cell pointer,
+// for each child but the last
+const sqliteMaxChildren = (sqlitePageSize-12)/(2+4+9) + 1
+
+// sqliteChild is a page of a b-tree level and the largest rowid beneath it
+type sqliteChild struct {
+	page     int
+	maxRowid int64
+}
+
+// writeTable writes the rows, in rowid order, as a table b-tree and returns
+// its root page
+func (d *sqliteDatabase) writeTable(rows []sqliteRow) int {
+	cells := d.leafCells(rows)
+	// Fill leaf pages with as many cells as fit
+	var level []sqliteChild
+	for start := 0; start < len(cells) || len(level) == 0; {
+		end := start
+		for end < len(cells) && sqliteFits(8, cells[start:end+1]) {
+			end++
+		}
+		page := d.allocate()
+		writeSQLiteLeaf(d.pages[page-1], 0, cells[start:end])
+		child := sqliteChild{page: page}
+		if end > start {
+			child.maxRowid = rows[end-1].id
+		}
+		level = append(level, child)
+		start = end
+	}
+	// Add interior levels until a single page is the root, spreading the
+	// children evenly so that no page is left with a single child
+	for len(level) > 1 {
+		pages := (len(level) + sqliteMaxChildren - 1) / sqliteMaxChildren
+		var parents []sqliteChild
+		for p := range pages {
+			start, end := p*len(level)/pages, (p+1)*len(level)/pages
+			// Every child but the last of a page has a cell; the last is the
+			// page's right-most pointer
+			var interior [][]byte
+			for _, child := range level[start : end-1] {
+				cell := binary.BigEndian.AppendUint32(nil, uint32(child.page))
+				interior = append(interior, appendSQLiteVarint(cell, uint64(child.maxRowid)))
+			}
+			page := d.allocate()
+			buffer := d.pages[page-1]
+			writeSQLiteCells(buffer, 0, 12, interior)
+			buffer[0] = 0x05 // Interior table b-tree page
+			binary.BigEndian.PutUint32(buffer[8:], uint32(level[end-1].page))
+			parents = append(parents, sqliteChild{page: page, maxRowid: level[end-1].maxRowid})
+		}
+		level = parents
+	}
+	return level[0].page
+}
+
+// leafCells encodes the rows as the cells of table b-tree leaf pages, writing
+// the part of a large row that doesn't fit on its page to overflow pages
+func (d *sqliteDatabase) leafCells(rows []sqliteRow) [][]byte {
+	const usable = sqlitePageSize
+	const maxLocal = usable - 35
+	const minLocal = (usable-12)*32/255 - 23
+	cells := make([][]byte, 0, len(rows))
+	for _, row := range rows {
+		payload := sqliteRecord(row.values)
+		cell := appendSQLiteVarint(nil, uint64(len(payload)))
+		cell = appendSQLiteVarint(cell, uint64(row.id))
+		if len(payload) <= maxLocal {
+			cells = append(cells, append(cell, payload...))
+			continue
+		}
+		local := minLocal + (len(payload)-minLocal)%(usable-4)
+		if local > maxLocal {
+			local = minLocal
+		}
+		cell = append(cell, payload[:local]...)
+		overflow := payload[local:]
+		next := d.allocate()
+		cell = binary.BigEndian.AppendUint32(cell, uint32(next))
+		for len(overflow) > 0 {
+			page := d.pages[next-1]
+			n := copy(page[4:], overflow)
+			overflow = overflow[n:]
+			if len(overflow) > 0 {
+				next = d.allocate()
+				binary.BigEndian.PutUint32(page, uint32(next))
+			}
+		}
+		cells = append(cells, cell)
+	}
+	return cells
+}
+
+// sqliteFits reports whether the cells fit on a page after a header ending at
+// the given offset, along with their cell pointers
+func sqliteFits(headerEnd int, cells [][]byte) bool {
+	size := headerEnd
+	for _, cell := range cells {
+		size += 2 + len(cell)
+	}
+	return size <= sqlitePageSize
+}
+
+// writeSQLiteLeaf writes the cells as a table b-tree leaf page whose header
+// starts at offset
+func writeSQLiteLeaf(page []byte, offset int, cells [][]byte) {
+	writeSQLiteCells(page, offset, 8, cells)
+	page[offset] = 0x0d // Leaf table b-tree page
+}
+
+// writeSQLiteCells writes the cells of a b-tree page from its end backwards,
+// their pointers after the page header, and the cell count and start of the
+// cell content in the header
+func writeSQLiteCells(page []byte, offset, headerSize int, cells [][]byte) {
+	content := sqlitePageSize
+	for i, cell := range cells {
+		content -= len(cell)
+		copy(page[content:], cell)
+		binary.BigEndian.PutUint16(page[offset+headerSize+2*i:], uint16(content))
+	}
+	binary.BigEndian.PutUint16(page[offset+3:], uint16(len(cells)))
+	binary.BigEndian.PutUint16(page[offset+5:], uint16(content))
+}
+
+// writeSQLiteHeader writes the database header at the start of page 1
+func writeSQLiteHeader(page []byte, pages int) {
+	copy(page, "SQLite format 3\x00")
+	binary.BigEndian.PutUint16(page[16:], sqlitePageSize)
+	page[18], page[19] = 1, 1 // Legacy rollback journal
+	page[21], page[22], page[23] = 64, 32, 32
+	binary.BigEndian.PutUint32(page[24:], 1) // File change counter
+	binary.BigEndian.PutUint32(page[28:], uint32(pages))
+	binary.BigEndian.PutUint32(page[40:], 1) // Schema cookie
+	binary.BigEndian.PutUint32(page[44:], 4) // Schema format
+	binary.BigEndian.PutUint32(page[56:], 1) // UTF-8
+	binary.BigEndian.PutUint32(page[92:], 1) // Version valid for the change counter
+	binary.BigEndian.PutUint32(page[96:], 3045000)
+}
+
+// sqliteRecord encodes values in SQLite's record format: a header of serial
+// types, one per value, followed by the values
+func sqliteRecord(values []any) []byte {
+	var types, body []byte
+	for _, value := range values {
+		if b, ok := value.(bool); ok {
+			value = int64(0)
+			if b {
+				value = int64(1)
+			}
+		}
+		switch value := value.(type) {
+		case nil:
+			types = appendSQLiteVarint(types, 0)
+		case int64:
+			switch {
+			case value == 0:
+				types = appendSQLiteVarint(types, 8)
+			case value == 1:
+				types = appendSQLiteVarint(types, 9)
+			default:
+				// The smallest of the 1, 2, 3, 4, 6 and 8 byte integer types
+				serialType, size := 6, 8
+				for i, n := range []int{1, 2, 3, 4, 6} {
+					if bound := int64(1) << (8*n - 1); value >= -bound && value < bound {
+						serialType, size = i+1, n
+						break
+					}
+				}
+				types = appendSQLiteVarint(types, uint64(serialType))
+				body = append(body, binary.BigEndian.AppendUint64(nil, uint64(value))[8-size:]...)
+			}
+		case float64:
+			types = appendSQLiteVarint(types, 7)
+			body = binary.BigEndian.AppendUint64(body, math.Float64bits(value))
+		case string:
+			types = appendSQLiteVarint(types, uint64(13+2*len(value)))
+			body = append(body, value...)
+		default:
+			panic(fmt.Sprintf("unsupported SQLite value %T", value))
+		}
+	}
+	headerSize := len(types) + 1
+	for len(appendSQLiteVarint(nil, uint64(headerSize)))+len(types) != headerSize {
+		headerSize = len(appendSQLiteVarint(nil, uint64(headerSize))) + len(types)
+	}
+	record := appendSQLiteVarint(nil, uint64(headerSize))
+	record = append(record, types...)
+	return append(record, body...)
+}
+
+// appendSQLiteVarint appends a value in SQLite's varint encoding: big-endian
+// groups of 7 bits with the high bit set on all but the last byte, and all 8
+// bits used by a ninth byte
+func appendSQLiteVarint(b []byte, value uint64) []byte {
+	if value > 1<<56-1 {
+		var buf [9]byte
+		buf[8] = byte(value)
+		value >>= 8
+		for i := 7; i >= 0; i-- {
+			buf[i] = byte(value&0x7f) | 0x80
+			value >>= 7
+		}
+		return append(b, buf[:]...)
+	}
+	var groups []byte
+	for {
+		groups = append(groups, byte(value&0x7f))
+		value >>= 7
+		if value == 0 {
+			break
+		}
+	}
+	for i := len(groups) - 1; i >= 0; i-- {
+		group := groups[i]
+		if i > 0 {
+			group |= 0x80
+		}
+		b = append(b, group)
+	}
+	return b
+}
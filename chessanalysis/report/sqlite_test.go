@@ -0,0 +1,94 @@
+package report
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/walterschell/chess-analyzer/chessanalysis"
+)
+
+func TestAppendSQLiteVarint(t *testing.T) {
+	for _, test := range []struct {
+		value uint64
+		want  []byte
+	}{
+		{0, []byte{0x00}},
+		{127, []byte{0x7f}},
+		{128, []byte{0x81, 0x00}},
+		{300, []byte{0x82, 0x2c}},
+		{1<<56 - 1, []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x7f}},
+		{1 << 56, []byte{0x80, 0xc0, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x00}},
+		{1<<64 - 1, bytes.Repeat([]byte{0xff}, 9)},
+	} {
+		if got := appendSQLiteVarint(nil, test.value); !bytes.Equal(got, test.want) {
+			t.Errorf("expected %d to encode as %x, got %x", test.value, test.want, got)
+		}
+	}
+}
+
+func TestWriteSQLite(t *testing.T) {
+	pgn := `[White "Player 1"]
+[Black "Player 2"]
+[WhiteElo "1500"]
+[Result "1-0"]
+
+1. e4 {[%clk 0:03:00]} e5 {[%clk 0:02:58.5]} 2. Qh5 Nc6 3. Bc4 Nf6 4. Qxf7# 1-0`
+	game, err := chessanalysis.AnalyzeGame(pgn, chessanalysis.WithDepth(3), chessanalysis.WithEngineFactory(scholarsMateEngine().NewEngine))
+	if err != nil {
+		t.Fatalf("failed to analyze game: %v", err)
+	}
+	// A header too large for a page spills onto overflow pages, and enough
+	// games need interior pages in the moves table
+	long := *game
+	long.Headers = map[string]string{"Event": strings.Repeat("Long event ", 1000)}
+	games := []*chessanalysis.GameAnalysis{game, &long}
+	for range 500 {
+		games = append(games, game)
+	}
+
+	var output bytes.Buffer
+	if err := WriteSQLite(&output, games...); err != nil {
+		t.Fatalf("failed to write SQLite database: %v", err)
+	}
+	if !bytes.HasPrefix(output.Bytes(), []byte("SQLite format 3\x00")) || output.Len()%sqlitePageSize != 0 {
+		t.Fatalf("expected whole pages after the SQLite header, got %d bytes", output.Len())
+	}
+
+	sqlite3, err := exec.LookPath("sqlite3")
+	if err != nil {
+		t.Skip("sqlite3 not found on PATH")
+	}
+	path := filepath.Join(t.TempDir(), "analysis.db")
+	if err := os.WriteFile(path, output.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	query := func(sql string) string {
+		out, err := exec.Command(sqlite3, path, sql).CombinedOutput()
+		if err != nil {
+			t.Fatalf("failed to query %q: %v\n%s", sql, err, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+	if got := query("PRAGMA integrity_check"); got != "ok" {
+		t.Fatalf("expected a consistent database, got:\n%s", got)
+	}
+	if got, want := query("SELECT count(*) FROM moves"), "3514"; got != want {
+		t.Errorf("expected %s moves, got %s", want, got)
+	}
+	if got := query("SELECT white, white_elo, black_elo IS NULL FROM games WHERE id = 1"); got != "Player 1|1500|1" {
+		t.Errorf("unexpected first game: %s", got)
+	}
+	if got := query("SELECT length(event) FROM games WHERE id = 2"); got != "11000" {
+		t.Errorf("expected the long event to read back whole, got length %s", got)
+	}
+	got := query(`SELECT m.san, m.clock_seconds, c.name, e.depth FROM moves m
+JOIN evaluations e ON e.move_id = m.id JOIN classifications c ON c.id = e.classification_id
+WHERE m.game_id = 1 AND m.ply IN (2, 6) ORDER BY m.ply`)
+	if want := "e5|178.5|" + game.Moves[1].Classification.String() + "|3\nNf6||Blunder|3"; got != want {
+		t.Errorf("unexpected moves of the first game:\n%s", got)
+	}
+}
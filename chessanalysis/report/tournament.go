@@ -0,0 +1,56 @@
+package report
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/walterschell/chess-analyzer/chessanalysis"
+)
+
+// TournamentMarkdown renders the crosstable, followed by each player's
+// aggregate move quality
+func TournamentMarkdown(t *chessanalysis.Tournament) string {
+	var b strings.Builder
+	title := "Tournament"
+	if t.Event != "" {
+		title = t.Event
+	}
+	fmt.Fprintf(&b, "## %s\n\n| # | Player |", escapeCell(title))
+	for i := range t.Players {
+		fmt.Fprintf(&b, " %d |", i+1)
+	}
+	b.WriteString(" Points |\n|---:|---|")
+	b.WriteString(strings.Repeat("---|", len(t.Players)))
+	b.WriteString("---:|\n")
+	for i, player := range t.Players {
+		fmt.Fprintf(&b, "| %d | %s |", i+1, escapeCell(player.Name))
+		for j, result := range player.Results {
+			if i == j {
+				result = "X"
+			}
+			fmt.Fprintf(&b, " %s |", result)
+		}
+		fmt.Fprintf(&b, " %g |\n", player.Points)
+	}
+
+	b.WriteString("\n| Player | Games | Accuracy | ACPL | Blunders | Opponents' Elo | Opponents' estimated rating |\n")
+	b.WriteString("|---|---:|---:|---:|---:|---:|---:|\n")
+	for _, player := range t.Players {
+		elo := "-"
+		if player.AverageOpponentElo > 0 {
+			elo = strconv.Itoa(player.AverageOpponentElo)
+		}
+		fmt.Fprintf(&b, "| %s | %d | %.1f | %.1f | %d | %s | %d |\n", escapeCell(player.Name),
+			player.Games, player.Accuracy, player.ACPL, player.Blunders, elo, player.AverageOpponentEstimate)
+	}
+	return b.String()
+}
+
+// WriteTournamentMarkdown writes the crosstable of the games as a markdown
+// report
+func WriteTournamentMarkdown(w io.Writer, games ...*chessanalysis.GameAnalysis) error {
+	_, err := io.WriteString(w, TournamentMarkdown(chessanalysis.NewTournament(games)))
+	return err
+}
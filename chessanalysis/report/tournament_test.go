@@ -0,0 +1,44 @@
+package report
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/walterschell/chess-analyzer/chessanalysis"
+)
+
+func TestTournamentMarkdown(t *testing.T) {
+	tournament := &chessanalysis.Tournament{
+		Event: "Club Championship",
+		Games: 4,
+		Players: []chessanalysis.TournamentPlayer{
+			{Name: "alice", Games: 3, Points: 1.5, Accuracy: 80, AverageOpponentElo: 1600, AverageOpponentEstimate: 1800, Results: []string{"", "½", "1*"}},
+			{Name: "carol", Games: 2, Points: 1.5, Accuracy: 80, Results: []string{"½", "", "1"}},
+			{Name: "bob", Games: 3, Accuracy: 80, Blunders: 1, Results: []string{"0*", "0", ""}},
+		},
+	}
+	markdown := TournamentMarkdown(tournament)
+	for _, want := range []string{"## Club Championship", "| 1 | alice | X | ½ | 1* | 1.5 |", "| bob | 3 | 80.0 | 0.0 | 1 | - | 0 |", "| alice | 3 | 80.0 | 0.0 | 0 | 1600 | 1800 |"} {
+		if !strings.Contains(markdown, want) {
+			t.Errorf("markdown missing %q:\n%s", want, markdown)
+		}
+	}
+	if markdown := TournamentMarkdown(&chessanalysis.Tournament{}); !strings.HasPrefix(markdown, "## Tournament\n") {
+		t.Errorf("expected a default title, got:\n%s", markdown)
+	}
+}
+
+func TestWriteTournamentMarkdown(t *testing.T) {
+	game := chessanalysis.NewGameAnalysis("[White \"alice\"]\n[Black \"bob\"]\n[Result \"1-0\"]\n\n1. e4 1-0", nil, chessanalysis.EffectiveOptions{})
+	var buf bytes.Buffer
+	if err := WriteTournamentMarkdown(&buf, game); err != nil {
+		t.Fatal(err)
+	}
+	if want := TournamentMarkdown(chessanalysis.NewTournament([]*chessanalysis.GameAnalysis{game})); buf.String() != want {
+		t.Errorf("expected the crosstable of the game, got:\n%s", buf.String())
+	}
+	if !strings.Contains(buf.String(), "| 1 | alice | X | 1 | 1 |") {
+		t.Errorf("expected alice to lead the crosstable:\n%s", buf.String())
+	}
+}
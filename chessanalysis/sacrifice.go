@@ -0,0 +1,62 @@
+package chessanalysis
+
+import chess "github.com/corentings/chess/v2"
+
+// MinSacrificeMaterial is how many pawns' worth of material a move has to
+// give up over the engine's line to count as a sacrifice. It's above a pawn
+// so that gambits and uneven trades don't count.
+const MinSacrificeMaterial = 2
+
+// maxSacrificeScoreLoss is how many percentage points of expected score a
+// sacrifice may cost and still count as sound
+const maxSacrificeScoreLoss = 5
+
+// SacrificedMaterial returns how many pawns of material the side to move
+// gives up by playing the line, given in UCI notation, from the position.
+// Illegal moves end the line.
+func SacrificedMaterial(position *chess.Position, line []string) int {
+	mover := position.Turn()
+	balance := func(position *chess.Position) int {
+		b := parseBoard(position.String())
+		white, black := b.material()
+		if mover == chess.White {
+			return white - black
+		}
+		return black - white
+	}
+
+	before := balance(position)
+	for _, uci := range line {
+		move, err := chess.UCINotation{}.Decode(position, uci)
+		if err != nil {
+			break
+		}
+		position = position.Update(move)
+	}
+	return before - balance(position)
+}
+
+// detectSacrifices marks the played and best moves as sacrifices when they
+// give up material over the engine's lines while keeping the mover's
+// evaluation from dropping below equal
+func detectSacrifices(move *MoveAnalysis, position *chess.Position, result *AnalysisResult) {
+	moverScore := func(whiteScore Score) Score {
+		if move.Color == "Black" {
+			return whiteScore.Negate()
+		}
+		return whiteScore
+	}
+
+	if material := SacrificedMaterial(position, result.PlayedLine); material >= MinSacrificeMaterial &&
+		!moverScore(move.WhiteScore).Less(Score{}) && expectedScoreLoss(move) <= maxSacrificeScoreLoss {
+		move.Sacrifice = true
+		move.SacrificeMaterial = material
+	}
+
+	// The evaluation before the move is the best move's score
+	if material := SacrificedMaterial(position, result.BestLine); material >= MinSacrificeMaterial &&
+		!moverScore(move.PreviousWhiteScore).Less(Score{}) {
+		move.BestMoveSacrifice = true
+		move.BestSacrificeMaterial = material
+	}
+}
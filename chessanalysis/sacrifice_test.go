@@ -0,0 +1,60 @@
+package chessanalysis
+
+import (
+	"testing"
+
+	chess "github.com/corentings/chess/v2"
+)
+
+// bishopSacrificePgn has White sacrificing a bishop for the f7 pawn
+const bishopSacrificePgn = `[White "Attacker"]
+[Black "Defender"]
+[Result "*"]
+
+1. e4 e5 2. Bc4 Nc6 3. Bxf7+ Kxf7 *`
+
+func TestSacrificedMaterial(t *testing.T) {
+	position, err := positionFromFEN("r1bqkbnr/pppp1ppp/2n5/4p3/2B1P3/8/PPPP1PPP/RNBQK1NR w KQkq - 2 3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := SacrificedMaterial(position, []string{"c4f7", "e8f7"}); got != 2 {
+		t.Errorf("expected Bxf7+ Kxf7 to give up 2 pawns, got %d", got)
+	}
+	if got := SacrificedMaterial(position, []string{"c4f7"}); got != -1 {
+		t.Errorf("expected Bxf7+ alone to win a pawn, got %d", got)
+	}
+	if got := SacrificedMaterial(chess.StartingPosition(), []string{"e2e4", "e7e5"}); got != 0 {
+		t.Errorf("expected no material change, got %d", got)
+	}
+}
+
+func TestSacrificeDetection(t *testing.T) {
+	engine := &FakeEngine{
+		Positions: map[string]FakeEvaluation{
+			// Before 3. Bxf7+, which the engine likes
+			"r1bqkbnr/pppp1ppp/2n5/4p3/2B1P3/8/PPPP1PPP/RNBQK1NR w KQkq - 2 3": {BestMove: "c4f7", Score: 100},
+			// After 3. Bxf7+ Black's best reply takes the bishop
+			"r1bqkbnr/pppp1Bpp/2n5/4p3/4P3/8/PPPP1PPP/RNBQK1NR b KQkq - 0 3": {BestMove: "e8f7", Score: -100},
+		},
+	}
+	game, err := AnalyzeGame(bishopSacrificePgn, WithDepth(3), WithEngineFactory(engine.NewEngine))
+	if err != nil {
+		t.Fatalf("failed to analyze game: %v", err)
+	}
+	sacrifice := game.Moves[4]
+	if !sacrifice.Sacrifice || sacrifice.SacrificeMaterial != 2 {
+		t.Errorf("expected 3. Bxf7+ to sacrifice 2 pawns, got %v (%d)", sacrifice.Sacrifice, sacrifice.SacrificeMaterial)
+	}
+	if !sacrifice.BestMoveSacrifice || sacrifice.BestSacrificeMaterial != 2 {
+		t.Errorf("expected the best move to be the sacrifice")
+	}
+	if sacrifice.Classification != Brilliant {
+		t.Errorf("expected 3. Bxf7+ to be brilliant, got %s", sacrifice.Classification)
+	}
+	for i, move := range game.Moves {
+		if i != 4 && (move.Sacrifice || move.BestMoveSacrifice) {
+			t.Errorf("unexpected sacrifice on %s", MoveLabel(&move))
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package chessanalysis
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/walterschell/chess-analyzer/chessanalysis/uciengine"
+)
+
+// SchemaVersion is the version of the JSON of GameAnalysis and MoveAnalysis,
+// written to both as schemaVersion. The JSON keeps to these rules, so that
+// frontends and stored analyses survive the types changing:
+//
+//   - Fields may be added within a version. Readers ignore fields they don't
+//     know, and fields that can be left out are zero when they are.
+//   - Renaming or removing a field, or changing its type, unit or meaning,
+//     takes a new version, with an upgrade from the version before it, see
+//     moveSchemaUpgrades. UnmarshalJSON reads every version up to this one.
+//   - JSON of a later version is rejected with ErrUnsupportedSchema rather
+//     than misread.
+//
+// Version 1 is the JSON from before the version was written, whose scores
+// may be numbers of pawns. Version 2 writes every score as a Score.
+const SchemaVersion = 2
+
+// schemaUpgrade upgrades JSON of one schema version to the next
+type schemaUpgrade func(data []byte) ([]byte, error)
+
+// moveSchemaUpgrades upgrade the JSON of a move from each version, by the
+// version they upgrade from
+var moveSchemaUpgrades = map[int]schemaUpgrade{
+	1: upgradePawnScores(
+		[]string{"whiteScore"}, []string{"previousWhiteScore"}, []string{"bestMoveWhiteScore"},
+		[]string{"topMoves", "*", "whiteScore"},
+		[]string{"secondOpinion", "whiteScore"}, []string{"secondOpinion", "bestMoveWhiteScore"},
+	),
+}
+
+// gameSchemaUpgrades upgrade the JSON of a game, but for its moves, which
+// moveSchemaUpgrades upgrade by their own version
+var gameSchemaUpgrades = map[int]schemaUpgrade{
+	1: upgradePawnScores(
+		[]string{"adjudication", "whiteScore"}, []string{"novelty", "whiteScore"},
+		[]string{"summary", "white", "bookExit", "whiteScore"}, []string{"summary", "black", "bookExit", "whiteScore"},
+	),
+}
+
+// upgradeSchema upgrades the JSON of a kind of value to SchemaVersion with
+// its upgrades. JSON without a schemaVersion is version 1.
+func upgradeSchema(kind string, upgrades map[int]schemaUpgrade, data []byte) ([]byte, error) {
+	var header struct {
+		SchemaVersion int `json:"schemaVersion"`
+	}
+	if err := json.Unmarshal(data, &header); err != nil {
+		return nil, err
+	}
+	if header.SchemaVersion > SchemaVersion {
+		return nil, fmt.Errorf("%w: %s JSON is version %d, this package reads up to %d",
+			ErrUnsupportedSchema, kind, header.SchemaVersion, SchemaVersion)
+	}
+	var err error
+	for version := max(header.SchemaVersion, 1); version < SchemaVersion; version++ {
+		if data, err = upgrades[version](data); err != nil {
+			return nil, fmt.Errorf("upgrading %s JSON from version %d: %w", kind, version, err)
+		}
+	}
+	return data, nil
+}
+
+// upgradePawnScores upgrades the scores at the paths, given as object keys
+// with "*" for each element of an array, that are numbers of pawns to Scores
+func upgradePawnScores(paths ...[]string) schemaUpgrade {
+	return func(data []byte) ([]byte, error) {
+		var err error
+		for _, path := range paths {
+			if data, err = upgradePawnScore(data, path); err != nil {
+				return nil, err
+			}
+		}
+		return data, nil
+	}
+}
+
+// upgradePawnScore upgrades the score at the path within data, if there is
+// one and it is a number of pawns
+func upgradePawnScore(data []byte, path []string) ([]byte, error) {
+	data = bytes.TrimSpace(data)
+	if len(path) == 0 {
+		var pawns float64
+		if json.Unmarshal(data, &pawns) != nil {
+			// Already a Score, or not a score at all
+			return data, nil
+		}
+		return json.Marshal(uciengine.Pawns(pawns))
+	}
+	if path[0] == "*" {
+		var elements []json.RawMessage
+		if json.Unmarshal(data, &elements) != nil || elements == nil {
+			return data, nil
+		}
+		for i := range elements {
+			upgraded, err := upgradePawnScore(elements[i], path[1:])
+			if err != nil {
+				return nil, err
+			}
+			elements[i] = upgraded
+		}
+		return json.Marshal(elements)
+	}
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(data, &fields) != nil || fields == nil {
+		return data, nil
+	}
+	value, ok := fields[path[0]]
+	if !ok {
+		return data, nil
+	}
+	upgraded, err := upgradePawnScore(value, path[1:])
+	if err != nil {
+		return nil, err
+	}
+	fields[path[0]] = upgraded
+	return json.Marshal(fields)
+}
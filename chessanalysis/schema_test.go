@@ -0,0 +1,64 @@
+package chessanalysis
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/walterschell/chess-analyzer/chessanalysis/uciengine"
+)
+
+func TestUpgradeVersion1JSON(t *testing.T) {
+	// As written before scores were a Score
+	const move = `{"moveNumber": 1, "color": "White", "moveText": "e4", "classification": "Best", "phase": "Opening",
+		"whiteScore": 0.3, "previousWhiteScore": 0.11, "bestMoveWhiteScore": -1.25,
+		"topMoves": [{"move": "e4", "uci": "e2e4", "whiteScore": 0.3}, {"move": "d4", "uci": "d2d4", "whiteScore": {"cp": 25}}],
+		"secondOpinion": {"whiteScore": 0.5, "bestMoveWhiteScore": 0.5}}`
+	var decoded MoveAnalysis
+	if err := json.Unmarshal([]byte(move), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.WhiteScore != uciengine.Pawns(0.3) || decoded.PreviousWhiteScore != uciengine.Centipawns(11) || decoded.BestMoveWhiteScore != uciengine.Centipawns(-125) {
+		t.Errorf("unexpected scores %v, %v and %v", decoded.WhiteScore, decoded.PreviousWhiteScore, decoded.BestMoveWhiteScore)
+	}
+	if decoded.TopMoves[0].WhiteScore != uciengine.Centipawns(30) || decoded.TopMoves[1].WhiteScore != uciengine.Centipawns(25) {
+		t.Errorf("unexpected top move scores %+v", decoded.TopMoves)
+	}
+	if decoded.SecondOpinion.WhiteScore != uciengine.Centipawns(50) {
+		t.Errorf("unexpected second opinion %+v", decoded.SecondOpinion)
+	}
+
+	game := `{"headers": {"White": "me"}, "moves": [` + move + `], "options": {"classifier": "x"},
+		"summary": {"white": {"bookExit": {"ply": 4, "move": "Nc3", "whiteScore": 0.2}}},
+		"adjudication": {"result": "1-0", "whiteScore": 3}}`
+	var decodedGame GameAnalysis
+	if err := json.Unmarshal([]byte(game), &decodedGame); err != nil {
+		t.Fatal(err)
+	}
+	if *decodedGame.Adjudication.WhiteScore != uciengine.Centipawns(300) || decodedGame.Summary.White.BookExit.WhiteScore != uciengine.Centipawns(20) {
+		t.Errorf("unexpected game scores %+v and %+v", decodedGame.Adjudication, decodedGame.Summary.White.BookExit)
+	}
+	if decodedGame.Moves[0].WhiteScore != uciengine.Centipawns(30) {
+		t.Errorf("expected the game's moves upgraded, got %v", decodedGame.Moves[0].WhiteScore)
+	}
+
+	encoded, err := json.Marshal(&decodedGame)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(encoded), `{"schemaVersion":2,`) || !strings.Contains(string(encoded), `"moves":[{"schemaVersion":2,`) {
+		t.Errorf("expected the game and its moves written as version 2, got %s", encoded)
+	}
+}
+
+func TestUnsupportedSchemaVersion(t *testing.T) {
+	var move MoveAnalysis
+	if err := json.Unmarshal([]byte(`{"schemaVersion": 3, "classification": "Best"}`), &move); !errors.Is(err, ErrUnsupportedSchema) {
+		t.Errorf("expected ErrUnsupportedSchema for a move, got %v", err)
+	}
+	var game GameAnalysis
+	if err := json.Unmarshal([]byte(`{"schemaVersion": 99}`), &game); !errors.Is(err, ErrUnsupportedSchema) {
+		t.Errorf("expected ErrUnsupportedSchema for a game, got %v", err)
+	}
+}
@@ -0,0 +1,236 @@
+package chessanalysis
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	chess "github.com/corentings/chess/v2"
+)
+
+// ScreeningDisclaimer heads every screening report. Engine-match statistics
+// vary widely between honest players, openings and styles of game, so the
+// report can only point a reviewer at games worth a closer look.
+const ScreeningDisclaimer = "These are statistical indicators, not verdicts. " +
+	"Strong, well-prepared or simply lucky players regularly match engines closely, " +
+	"and no figure here shows on its own that a player had assistance."
+
+// MinScreeningMoves is how many moves a depth of a screening report needs
+// before its figures are compared with typical ones; fewer say too little
+const MinScreeningMoves = 100
+
+// ScreeningReference is how closely players of a rating typically match the
+// engine, as rough figures for human play: the percentage of moves that were
+// the engine's first choice and among its top three, and the average
+// centipawn loss
+type ScreeningReference struct {
+	Rating int     `json:"rating"`
+	Top1   float64 `json:"top1"`
+	Top3   float64 `json:"top3"`
+	ACPL   float64 `json:"acpl"`
+}
+
+// screeningReferences are the typical figures at some ratings, interpolated
+// between for the others. They are deliberately rounded: engines, depths
+// and time controls all move them by several points.
+var screeningReferences = []ScreeningReference{
+	{Rating: 800, Top1: 25, Top3: 45, ACPL: 110},
+	{Rating: 1200, Top1: 31, Top3: 54, ACPL: 80},
+	{Rating: 1600, Top1: 38, Top3: 62, ACPL: 55},
+	{Rating: 2000, Top1: 45, Top3: 70, ACPL: 38},
+	{Rating: 2400, Top1: 52, Top3: 77, ACPL: 25},
+	{Rating: 2800, Top1: 58, Top3: 83, ACPL: 16},
+}
+
+// TypicalEngineMatch returns the typical figures for a rating, interpolated
+// between those of screeningReferences and clamped to their range
+func TypicalEngineMatch(rating int) ScreeningReference {
+	first, last := screeningReferences[0], screeningReferences[len(screeningReferences)-1]
+	if rating <= first.Rating {
+		return ScreeningReference{Rating: rating, Top1: first.Top1, Top3: first.Top3, ACPL: first.ACPL}
+	}
+	if rating >= last.Rating {
+		return ScreeningReference{Rating: rating, Top1: last.Top1, Top3: last.Top3, ACPL: last.ACPL}
+	}
+	i := sort.Search(len(screeningReferences), func(i int) bool { return screeningReferences[i].Rating >= rating })
+	low, high := screeningReferences[i-1], screeningReferences[i]
+	t := float64(rating-low.Rating) / float64(high.Rating-low.Rating)
+	interpolate := func(a, b float64) float64 { return a + t*(b-a) }
+	return ScreeningReference{
+		Rating: rating,
+		Top1:   interpolate(low.Top1, high.Top1),
+		Top3:   interpolate(low.Top3, high.Top3),
+		ACPL:   interpolate(low.ACPL, high.ACPL),
+	}
+}
+
+// ScreeningDepth is how closely a player matched the engine searching to one
+// depth. Book moves and moves with a single legal reply aren't counted, as
+// every player matches the engine on those.
+type ScreeningDepth struct {
+	Depth int     `json:"depth"` // 0 for analyses limited by time or nodes
+	Games int     `json:"games"`
+	Moves int     `json:"moves"` // Counted moves
+	Top1  float64 `json:"top1"`  // Percentage of counted moves that were the engine's first choice
+	// Top3 is the percentage among the engine's top three, when
+	// Top3Available: the analyses ran with a MultiPV of 3 or more
+	Top3          float64 `json:"top3"`
+	Top3Available bool    `json:"top3Available"`
+	ACPL          float64 `json:"acpl"`
+	// LongestStreak is the most counted moves in a row within a game that
+	// were the engine's first choice
+	LongestStreak int `json:"longestStreak"`
+	// Notes compare the figures with the typical ones, in words
+	Notes []string `json:"notes"`
+}
+
+// ScreeningReport is a fair-play reviewer's summary of how closely a player's
+// moves matched the engine at each depth the games were analyzed to, next to
+// what is typical for the player's rating. See ScreeningDisclaimer.
+type ScreeningReport struct {
+	Player     string `json:"player"`
+	Disclaimer string `json:"disclaimer"`
+	Rating     int    `json:"rating"`
+	// RatingSource is "tags" for the mean of the player's rating tags, or
+	// "estimated" for games without them, see EstimatePlayerRating
+	RatingSource string             `json:"ratingSource"`
+	Typical      ScreeningReference `json:"typical"`
+	Depths       []ScreeningDepth   `json:"depths"` // Shallowest first
+}
+
+// screenedMove reports whether a move counts towards the engine-match
+// figures: it was evaluated and the player had a choice
+func screenedMove(move *MoveAnalysis) bool {
+	if move.Classification == Book || !move.Evaluated() {
+		return false
+	}
+	fen, err := chess.FEN(move.FENBefore)
+	if err != nil {
+		return true
+	}
+	return len(chess.NewGame(fen).Position().ValidMoves()) > 1
+}
+
+// ScreenPlayer reports how closely the named player's moves matched the
+// engine. The games may hold several analyses of the same games, each to a
+// different depth, which get a row each: matches that hold up as the engine
+// searches deeper say more than those at a single depth.
+func ScreenPlayer(games []*GameAnalysis, player string) *ScreeningReport {
+	report := &ScreeningReport{Player: player, Disclaimer: ScreeningDisclaimer, Depths: []ScreeningDepth{}}
+	byDepth := map[int]*ScreeningDepth{}
+	ratings, rated := 0, 0
+	for _, game := range games {
+		color := game.PlayerColor(player)
+		if color == "" {
+			continue
+		}
+		if rating, err := strconv.Atoi(game.Headers[color+"Elo"]); err == nil && rating > 0 {
+			ratings += rating
+			rated++
+		}
+		depth, ok := byDepth[game.Options.Depth]
+		if !ok {
+			depth = &ScreeningDepth{Depth: game.Options.Depth, Notes: []string{}}
+			byDepth[game.Options.Depth] = depth
+		}
+		depth.Games++
+		depth.Top3Available = depth.Top3Available || game.Options.MultiPV >= 3
+		streak := 0
+		for i := range game.Moves {
+			move := &game.Moves[i]
+			if move.Color != color || !screenedMove(move) {
+				continue
+			}
+			depth.Moves++
+			depth.ACPL += move.CentipawnLoss
+			if move.IsBestMove || move.EngineRank == 1 {
+				depth.Top1++
+				streak++
+				depth.LongestStreak = max(depth.LongestStreak, streak)
+			} else {
+				streak = 0
+			}
+			if move.IsBestMove || (move.EngineRank > 0 && move.EngineRank <= 3) {
+				depth.Top3++
+			}
+		}
+	}
+
+	if rated > 0 {
+		report.Rating, report.RatingSource = int(math.Round(float64(ratings)/float64(rated))), "tags"
+	} else {
+		report.Rating, report.RatingSource = EstimatePlayerRating(games, player).Rating, "estimated"
+	}
+	report.Typical = TypicalEngineMatch(report.Rating)
+	for _, depth := range byDepth {
+		if depth.Moves > 0 {
+			moves := float64(depth.Moves)
+			depth.Top1 = 100 * depth.Top1 / moves
+			depth.Top3 = 100 * depth.Top3 / moves
+			depth.ACPL /= moves
+		}
+		if !depth.Top3Available {
+			depth.Top3 = 0
+		}
+		depth.Notes = screeningNotes(depth, report.Typical)
+		report.Depths = append(report.Depths, *depth)
+	}
+	sort.Slice(report.Depths, func(i, j int) bool { return report.Depths[i].Depth < report.Depths[j].Depth })
+	return report
+}
+
+// screeningNotes compares a depth's figures with the typical ones, noting
+// engine matches 10 points above typical as above it and 20 points as well
+// above it. Players on a good day reach either.
+func screeningNotes(depth *ScreeningDepth, typical ScreeningReference) []string {
+	if depth.Moves < MinScreeningMoves {
+		return []string{fmt.Sprintf("Only %d moves were counted, too few to compare with typical figures", depth.Moves)}
+	}
+	notes := []string{}
+	compare := func(name string, value, typical float64) {
+		switch difference := value - typical; {
+		case difference >= 20:
+			notes = append(notes, fmt.Sprintf("%s match of %.0f%% is well above the typical %.0f%%", name, value, typical))
+		case difference >= 10:
+			notes = append(notes, fmt.Sprintf("%s match of %.0f%% is above the typical %.0f%%", name, value, typical))
+		}
+	}
+	compare("Top-1", depth.Top1, typical.Top1)
+	if depth.Top3Available {
+		compare("Top-3", depth.Top3, typical.Top3)
+	}
+	if depth.ACPL < typical.ACPL/2 {
+		notes = append(notes, fmt.Sprintf("Average centipawn loss of %.0f is under half the typical %.0f", depth.ACPL, typical.ACPL))
+	}
+	if len(notes) == 0 {
+		notes = append(notes, "Within the typical range for the rating")
+	}
+	return notes
+}
+
+// Markdown renders the report for reading, headed by its disclaimer
+func (r *ScreeningReport) Markdown() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "## Engine-correlation screening: %s\n\n", r.Player)
+	fmt.Fprintf(&b, "> %s\n\n", r.Disclaimer)
+	fmt.Fprintf(&b, "Rating %d (%s). Typical at this rating: top-1 %.0f%%, top-3 %.0f%%, ACPL %.0f.\n\n",
+		r.Rating, r.RatingSource, r.Typical.Top1, r.Typical.Top3, r.Typical.ACPL)
+	b.WriteString("| Depth | Games | Moves | Top-1 | Top-3 | ACPL | Longest streak |\n|---:|---:|---:|---:|---:|---:|---:|\n")
+	for _, depth := range r.Depths {
+		top3 := "-"
+		if depth.Top3Available {
+			top3 = fmt.Sprintf("%.1f%%", depth.Top3)
+		}
+		fmt.Fprintf(&b, "| %d | %d | %d | %.1f%% | %s | %.1f | %d |\n",
+			depth.Depth, depth.Games, depth.Moves, depth.Top1, top3, depth.ACPL, depth.LongestStreak)
+	}
+	for _, depth := range r.Depths {
+		fmt.Fprintf(&b, "\n**Depth %d**\n\n", depth.Depth)
+		for _, note := range depth.Notes {
+			fmt.Fprintf(&b, "- %s\n", note)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,90 @@
+package chessanalysis
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// screeningGame returns a game where "me" plays White and matched the engine
+// on the moves given
+func screeningGame(depth, plies int, best map[int]bool) *GameAnalysis {
+	moves := make([]string, plies)
+	for i := range moves {
+		moves[i] = "e4"
+	}
+	game := testGame("me", "them", "1-0", "C50", moves, nil)
+	game.Headers["WhiteElo"] = "1400"
+	game.Options.Depth, game.Options.MultiPV = depth, 3
+	for i := range game.Moves {
+		game.Moves[i].Depth = depth
+		game.Moves[i].IsBestMove = best[i]
+		game.Moves[i].CentipawnLoss = 10
+	}
+	return game
+}
+
+func TestScreenPlayer(t *testing.T) {
+	shallow := screeningGame(12, 8, map[int]bool{0: true, 2: true, 6: true})
+	shallow.Moves[0].Classification = Book
+	shallow.Moves[4].EngineRank = 2
+	deep := screeningGame(20, 8, map[int]bool{0: true, 2: true, 4: true, 6: true})
+
+	report := ScreenPlayer([]*GameAnalysis{deep, shallow}, "me")
+	if report.Rating != 1400 || report.RatingSource != "tags" || report.Typical.Top1 != 34.5 {
+		t.Errorf("unexpected rating and typical figures %+v", report)
+	}
+	if len(report.Depths) != 2 || report.Depths[0].Depth != 12 || report.Depths[1].Depth != 20 {
+		t.Fatalf("expected a row per depth, shallowest first, got %+v", report.Depths)
+	}
+	// The book move isn't counted
+	if row := report.Depths[0]; row.Moves != 3 || row.Top1 != 100*2.0/3 || row.Top3 != 100 || row.LongestStreak != 1 {
+		t.Errorf("unexpected depth 12 row %+v", row)
+	}
+	if row := report.Depths[1]; row.Moves != 4 || row.Top1 != 100 || row.LongestStreak != 4 || row.ACPL != 10 {
+		t.Errorf("unexpected depth 20 row %+v", row)
+	}
+	if notes := report.Depths[1].Notes; len(notes) != 1 || !strings.HasPrefix(notes[0], "Only 4 moves") {
+		t.Errorf("expected a small sample note, got %q", notes)
+	}
+
+	markdown := report.Markdown()
+	for _, want := range []string{ScreeningDisclaimer, "| 20 | 1 | 4 | 100.0% | 100.0% | 10.0 | 4 |"} {
+		if !strings.Contains(markdown, want) {
+			t.Errorf("markdown missing %q:\n%s", want, markdown)
+		}
+	}
+	data, err := json.Marshal(report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded ScreeningReport
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Markdown() != markdown {
+		t.Errorf("expected the same report after a round trip, got %s", data)
+	}
+}
+
+func TestScreeningNotes(t *testing.T) {
+	best := map[int]bool{}
+	for i := 0; i < 400; i += 2 {
+		best[i] = i%10 != 0
+	}
+	report := ScreenPlayer([]*GameAnalysis{screeningGame(20, 400, best)}, "me")
+	notes := report.Depths[0].Notes
+	if len(notes) != 3 || !strings.Contains(notes[0], "Top-1 match of 80% is well above the typical 34%") ||
+		!strings.HasPrefix(notes[2], "Average centipawn loss") {
+		t.Errorf("unexpected notes %q", notes)
+	}
+
+	for i := range best {
+		best[i] = i%6 == 0
+	}
+	report = ScreenPlayer([]*GameAnalysis{screeningGame(20, 400, best)}, "me")
+	report.Depths[0].ACPL = report.Typical.ACPL
+	if notes := screeningNotes(&report.Depths[0], report.Typical); len(notes) != 1 || notes[0] != "Within the typical range for the rating" {
+		t.Errorf("unexpected notes %q", notes)
+	}
+}
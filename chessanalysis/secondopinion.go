@@ -0,0 +1,94 @@
+package chessanalysis
+
+import (
+	"math"
+
+	chess "github.com/corentings/chess/v2"
+)
+
+// DisagreementThreshold is how many percentage points of White's expected
+// score the two engines of a second-opinion analysis must differ by for a
+// move to be flagged as one they disagree on
+const DisagreementThreshold = 20.0
+
+// SecondOpinion is how the second engine of an analysis, given with
+// WithSecondOpinion, saw a move
+type SecondOpinion struct {
+	Engine             string  `json:"engine,omitempty"` // The name the engine gave, if it did
+	WhiteScore         Score   `json:"whiteScore"`
+	WhiteWinProb       float64 `json:"whiteWinProb"`
+	WhiteDrawProb      float64 `json:"whiteDrawProb"`
+	WhiteLossProb      float64 `json:"whiteLossProb"`
+	BestMove           string  `json:"bestMove"` // UCI
+	BestMoveSAN        string  `json:"bestMoveSAN"`
+	BestMoveWhiteScore Score   `json:"bestMoveWhiteScore"`
+	Depth              int     `json:"depth"`
+	// Disagreement is how many percentage points of White's expected score
+	// the engines' evaluations after the move are apart
+	Disagreement float64 `json:"disagreement"`
+	// Disagrees is whether Disagreement reaches DisagreementThreshold. Such
+	// positions are often the most instructive of a game.
+	Disagrees bool `json:"disagrees"`
+}
+
+// WithSecondOpinion searches every move with a second engine too, such as
+// Lc0 alongside Stockfish, reporting its evaluation as the move's
+// SecondOpinion. The second engine is started straight from factory, without
+// waiting for the EnginePool.
+func WithSecondOpinion(factory EngineFactory) AnalyzeChessGameOption {
+	return func(opts *AnalyzeChessGameOptions) {
+		opts.SecondOpinion = factory
+	}
+}
+
+// newSecondOpinion compares the second engine's result for a move with the
+// analysis of the first
+func newSecondOpinion(analysis *MoveAnalysis, before *chess.Position, result *AnalysisResult, engine string) *SecondOpinion {
+	opinion := &SecondOpinion{
+		Engine:             engine,
+		WhiteScore:         result.WhiteScore,
+		WhiteWinProb:       result.WhiteWinProb,
+		WhiteDrawProb:      result.WhiteDrawProb,
+		WhiteLossProb:      result.WhiteLossProb,
+		BestMove:           result.BestMove,
+		BestMoveWhiteScore: result.BestMoveWhiteScore,
+		Depth:              result.Depth,
+	}
+	if result.BestMove != "" {
+		if move, err := (chess.UCINotation{}).Decode(before, result.BestMove); err == nil {
+			opinion.BestMoveSAN = chess.AlgebraicNotation{}.Encode(before, move)
+		}
+	}
+
+	// Compare win/draw/loss chances when both engines report them, and the
+	// scores otherwise
+	first, second := 0.0, 0.0
+	if hasWDL(analysis.WhiteWinProb, analysis.WhiteDrawProb, analysis.WhiteLossProb) &&
+		hasWDL(result.WhiteWinProb, result.WhiteDrawProb, result.WhiteLossProb) {
+		first = expectedScore("White", analysis.WhiteWinProb, analysis.WhiteDrawProb, analysis.WhiteLossProb)
+		second = expectedScore("White", result.WhiteWinProb, result.WhiteDrawProb, result.WhiteLossProb)
+	} else {
+		first, second = scoreExpectation(analysis.WhiteScore), scoreExpectation(result.WhiteScore)
+	}
+	opinion.Disagreement = math.Abs(first - second)
+	opinion.Disagrees = opinion.Disagreement >= DisagreementThreshold
+	return opinion
+}
+
+// hasWDL reports whether an engine reported win/draw/loss chances
+func hasWDL(win, draw, loss float64) bool {
+	return win+draw+loss > 0
+}
+
+// scoreExpectation converts a score into White's expected score in percent,
+// with the curve Lichess uses for engines without win/draw/loss chances. A
+// forced mate is a certain result.
+func scoreExpectation(whiteScore Score) float64 {
+	if whiteScore.IsMate() {
+		if whiteScore.Winning() {
+			return 100
+		}
+		return 0
+	}
+	return 100 / (1 + math.Exp(-0.368208*whiteScore.Pawns()))
+}
@@ -0,0 +1,44 @@
+package chessanalysis
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/walterschell/chess-analyzer/chessanalysis/uciengine"
+)
+
+func TestSecondOpinion(t *testing.T) {
+	moves, err := AnalyzeChessGame(scholarsMatePgn, WithDepth(3),
+		WithEngineFactory(scholarsMateEngine().NewEngine),
+		WithSecondOpinion((&FakeEngine{}).NewEngine))
+	if err != nil {
+		t.Fatalf("failed to analyze game: %v", err)
+	}
+	for i, move := range moves {
+		if move.SecondOpinion == nil {
+			t.Fatalf("expected a second opinion of %s", move.MoveText)
+		}
+		// Only the first engine sees the mate on f7 coming; the mate itself
+		// is scored without either engine
+		if want := i == 5; move.SecondOpinion.Disagrees != want {
+			t.Errorf("expected disagreement %v on %s, got %+v", want, move.MoveText, move.SecondOpinion)
+		}
+	}
+	opinion := moves[5].SecondOpinion
+	if opinion.Engine != "FakeEngine" || opinion.WhiteScore != uciengine.Pawns(0.5) || opinion.Disagreement < DisagreementThreshold {
+		t.Errorf("unexpected second opinion of 3...Nf6 %+v", opinion)
+	}
+
+	data, err := json.Marshal(&moves[5])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded MoveAnalysis
+	if err := json.Unmarshal(data, &decoded); err != nil || decoded.SecondOpinion == nil || *decoded.SecondOpinion != *opinion {
+		t.Errorf("expected the second opinion to survive JSON, got %+v (%v)", decoded.SecondOpinion, err)
+	}
+
+	if got, want := scoreExpectation(Score{}), 50.0; got != want {
+		t.Errorf("expected an even score to expect %v, got %v", want, got)
+	}
+}
@@ -0,0 +1,53 @@
+package chessanalysis
+
+// sharpLossThreshold is how many pawns worse than the best move an
+// alternative must score to count as losing
+const sharpLossThreshold = 1.5
+
+// positionSharpness estimates how sharp a position is from the scores of the
+// engine's top moves, best first: the fraction of the alternatives to the best
+// move that lose at least sharpLossThreshold, or give up a forced mate. It's 0
+// when the engine reported a single line, so analyzing with a higher MultiPV
+// gives a finer estimate.
+func positionSharpness(topScores []Score) float64 {
+	if len(topScores) < 2 {
+		return 0
+	}
+	losing := 0
+	for _, score := range topScores[1:] {
+		if missesMate(topScores[0], score) || topScores[0].Pawns()-score.Pawns() >= sharpLossThreshold {
+			losing++
+		}
+	}
+	return float64(losing) / float64(len(topScores)-1)
+}
+
+// missesMate reports whether score gives up the forced mate best has, both
+// from the same side's perspective
+func missesMate(best, score Score) bool {
+	return best.IsMate() && best.Winning() && !(score.IsMate() && score.Winning())
+}
+
+// DefaultSharpThreshold is the sharpness from which LenientInSharpPositions
+// judges mistakes more leniently
+const DefaultSharpThreshold = 0.5
+
+// LenientInSharpPositions wraps a classifier so that mistakes in positions at
+// least threshold sharp are judged one step more leniently: blunders become
+// questionable moves and questionable moves become neutral.
+func LenientInSharpPositions(classifier MoveClassifier, threshold float64) MoveClassifier {
+	return MoveClassifierFunc(func(move *MoveAnalysis) MoveClassification {
+		classification := classifier.ClassifyMove(move)
+		if move.Sharpness < threshold {
+			return classification
+		}
+		switch classification {
+		case Blunder:
+			return Questionable
+		case Questionable:
+			return Neutral
+		default:
+			return classification
+		}
+	})
+}
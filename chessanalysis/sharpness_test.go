@@ -0,0 +1,54 @@
+package chessanalysis
+
+import (
+	"testing"
+
+	"github.com/walterschell/chess-analyzer/chessanalysis/uciengine"
+)
+
+func TestPositionSharpness(t *testing.T) {
+	pawns := func(scores ...float64) []Score {
+		var result []Score
+		for _, score := range scores {
+			result = append(result, uciengine.Pawns(score))
+		}
+		return result
+	}
+	tests := []struct {
+		scores []Score
+		want   float64
+	}{
+		{nil, 0},
+		{pawns(0.3), 0},
+		{pawns(0.3, 0.2, 0.1), 0},
+		{pawns(0.3, -1.2, 0.1), 0.5},
+		{pawns(2, -3, -5, -9), 1},
+		{[]Score{uciengine.MateIn(3), uciengine.Pawns(12), uciengine.MateIn(5)}, 0.5},
+	}
+	for _, test := range tests {
+		if got := positionSharpness(test.scores); got != test.want {
+			t.Errorf("positionSharpness(%v) = %.2f, want %.2f", test.scores, got, test.want)
+		}
+	}
+}
+
+func TestLenientInSharpPositions(t *testing.T) {
+	classifier := LenientInSharpPositions(MoveClassifierFunc(func(move *MoveAnalysis) MoveClassification {
+		return move.Classification
+	}), DefaultSharpThreshold)
+
+	tests := []struct {
+		move MoveAnalysis
+		want MoveClassification
+	}{
+		{MoveAnalysis{Classification: Blunder, Sharpness: 0.2}, Blunder},
+		{MoveAnalysis{Classification: Blunder, Sharpness: 0.5}, Questionable},
+		{MoveAnalysis{Classification: Questionable, Sharpness: 1}, Neutral},
+		{MoveAnalysis{Classification: Best, Sharpness: 1}, Best},
+	}
+	for _, test := range tests {
+		if got := classifier.ClassifyMove(&test.move); got != test.want {
+			t.Errorf("ClassifyMove(%s at sharpness %.1f) = %s, want %s", test.move.Classification, test.move.Sharpness, got, test.want)
+		}
+	}
+}
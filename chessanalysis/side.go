@@ -0,0 +1,46 @@
+package chessanalysis
+
+import "fmt"
+
+// WithSide analyzes the moves of the side of the given color, "White" or
+// "Black", alone, such as a player reviewing their own game. The opponent's
+// moves are replayed but not searched, halving the engine's time: they keep
+// the score of the position before them, are left unclassified and marked
+// Skipped, and count for neither player's statistics.
+func WithSide(color string) AnalyzeChessGameOption {
+	return func(opts *AnalyzeChessGameOptions) {
+		opts.Side = color
+	}
+}
+
+// validateSide checks the side of WithSide
+func validateSide(side string) error {
+	switch side {
+	case "", "White", "Black":
+		return nil
+	}
+	return fmt.Errorf("%w: the side to analyze is %q, not White or Black", ErrInvalidOptions, side)
+}
+
+// skipMove fills in the analysis of a move left unsearched, an opponent's
+// with WithSide or one of a decided game with WithEarlyStop, carrying the
+// score of the position before it, or taking the PGN's evaluation of the
+// position after it when there is one
+func skipMove(move *MoveAnalysis, embeddedEval *Score) {
+	move.Skipped = true
+	move.WhiteScore = move.PreviousWhiteScore
+	move.WhiteWinProb = move.PreviousWhiteWinProb
+	move.WhiteDrawProb = move.PreviousWhiteDrawProb
+	move.WhiteLossProb = move.PreviousWhiteLossProb
+	if embeddedEval != nil {
+		move.WhiteScore = *embeddedEval
+		move.WhiteWinProb, move.WhiteDrawProb, move.WhiteLossProb = scoreWDL(move.WhiteScore)
+	}
+}
+
+// PGNPlayerColor returns the color the player had in the PGN's first game, by
+// its White and Black tags, or "" if neither is theirs
+func PGNPlayerColor(pgn, player string) string {
+	game := GameAnalysis{Headers: parsePGNHeaders(pgn)}
+	return game.PlayerColor(player)
+}
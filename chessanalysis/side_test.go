@@ -0,0 +1,76 @@
+package chessanalysis
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/walterschell/chess-analyzer/chessanalysis/uciengine"
+)
+
+func TestSide(t *testing.T) {
+	if _, err := ResolveOptions(WithSide("black")); !errors.Is(err, ErrInvalidOptions) {
+		t.Errorf("expected a lowercase side to be rejected, got %v", err)
+	}
+
+	fake := scholarsMateEngine()
+	var transcript bytes.Buffer
+	factory := func() (Engine, error) {
+		return uciengine.NewEngine(uciengine.RecordingLauncher(fake.launch, &transcript))
+	}
+	both, err := AnalyzeGame(scholarsMatePgn, WithDepth(3), WithEngineFactory(factory))
+	if err != nil {
+		t.Fatalf("failed to analyze game: %v", err)
+	}
+	bothSearches := strings.Count(transcript.String(), "> go ")
+
+	transcript.Reset()
+	game, err := AnalyzeGame(scholarsMatePgn, WithDepth(3), WithSide("Black"), WithEngineFactory(factory))
+	if err != nil {
+		t.Fatalf("failed to analyze game: %v", err)
+	}
+	if searches := strings.Count(transcript.String(), "> go "); searches == 0 || searches >= bothSearches {
+		t.Errorf("expected fewer searches than the %d of both sides, got %d", bothSearches, searches)
+	}
+	if game.Options.Side != "Black" {
+		t.Errorf("expected the side in the effective options, got %q", game.Options.Side)
+	}
+	if len(game.Moves) != len(both.Moves) {
+		t.Fatalf("expected all %d moves to be replayed, got %d", len(both.Moves), len(game.Moves))
+	}
+	for i, move := range game.Moves {
+		if move.Color == "White" {
+			if !move.Skipped || move.Evaluated() || move.Classification != Neutral {
+				t.Errorf("expected %s to be skipped unclassified, got %+v", MoveLabel(&move), move)
+			}
+			if move.WhiteScore != move.PreviousWhiteScore {
+				t.Errorf("expected %s to keep the score before it, got %v after %v", MoveLabel(&move), move.WhiteScore, move.PreviousWhiteScore)
+			}
+			continue
+		}
+		if move.Skipped || !move.Evaluated() {
+			t.Errorf("expected %s to be searched", MoveLabel(&move))
+		}
+		// Black's moves are judged against the position White's move left,
+		// measured by its best move
+		if move.PreviousWhiteScore != move.BestMoveWhiteScore {
+			t.Errorf("expected %s to be judged from its best move's %v, got %v", MoveLabel(&move), move.BestMoveWhiteScore, move.PreviousWhiteScore)
+		}
+		if move.Classification != both.Moves[i].Classification {
+			t.Errorf("expected %s to be classified %v as when both sides are analyzed, got %v", MoveLabel(&move), both.Moves[i].Classification, move.Classification)
+		}
+	}
+	if game.Summary.White.Moves != 0 || game.Summary.Black.Moves != 3 {
+		t.Errorf("expected only Black's 3 moves in the summary, got %d for White and %d for Black", game.Summary.White.Moves, game.Summary.Black.Moves)
+	}
+}
+
+func TestPGNPlayerColor(t *testing.T) {
+	pgn := "[White \"Alice\"]\n[Black \"Bob\"]\n\n1. e4 e5 *\n"
+	for player, want := range map[string]string{"alice": "White", "Bob": "Black", "Carol": ""} {
+		if got := PGNPlayerColor(pgn, player); got != want {
+			t.Errorf("expected %s to have played %q, got %q", player, want, got)
+		}
+	}
+}
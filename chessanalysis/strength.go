@@ -0,0 +1,140 @@
+package chessanalysis
+
+import (
+	"math"
+	"strconv"
+)
+
+// TimeControlCategory is the speed class of a game, from its TimeControl tag
+type TimeControlCategory int
+
+const (
+	UnknownTimeControl TimeControlCategory = iota
+	Bullet
+	Blitz
+	Rapid
+	Classical
+)
+
+var timeControlCategoryNames = []string{"Unknown", "Bullet", "Blitz", "Rapid", "Classical"}
+
+func (c TimeControlCategory) String() string {
+	if c < 0 || int(c) >= len(timeControlCategoryNames) {
+		return timeControlCategoryNames[UnknownTimeControl]
+	}
+	return timeControlCategoryNames[c]
+}
+
+// ParseTimeControl classifies a PGN TimeControl tag such as "180+2" by the
+// estimated duration of a 40 move game, following the Lichess boundaries.
+// Tags without a base time, e.g. "-" or "?", are UnknownTimeControl.
+// Multi-period controls like "40/7200:3600" are classified by their first
+// period; see ParseTimeControlTag for all of them.
+func ParseTimeControl(tag string) TimeControlCategory {
+	control, err := ParseTimeControlTag(tag)
+	if err != nil {
+		return UnknownTimeControl
+	}
+	return control.Category
+}
+
+// Bounds of estimated ratings
+const (
+	minEstimatedRating = 100
+	maxEstimatedRating = 3200
+)
+
+// timeControlRatingBonus credits faster games, where players of the same
+// strength make more mistakes
+var timeControlRatingBonus = map[TimeControlCategory]float64{
+	Bullet: 300,
+	Blitz:  150,
+	Rapid:  50,
+}
+
+// EstimateRating estimates the playing strength shown by a player's moves.
+// The estimate starts from the widely used exponential fit of rating against
+// average centipawn loss, is adjusted by how often the player found the best
+// move and how often they blundered, and credits faster time controls. It's a
+// rough guide for comparing games, not a substitute for a rating.
+func EstimateRating(summary *PlayerSummary, timeControl TimeControlCategory) int {
+	if summary.Moves == 0 {
+		return 0
+	}
+	moves := float64(summary.Moves)
+	bestMoveRate := float64(summary.BestMoves) / moves
+	blunderRate := float64(summary.Blunders) / moves
+
+	rating := 3100 * math.Exp(-0.01*summary.ACPL)
+	rating += 400 * (bestMoveRate - 0.35)
+	rating -= 1500 * blunderRate
+	rating += timeControlRatingBonus[timeControl]
+	return int(math.Round(math.Max(minEstimatedRating, math.Min(maxEstimatedRating, rating))))
+}
+
+// ratingPriorMoves is how many moves of play a rating tag weighs as much as
+// when seeding a game's estimate. A rating sums up hundreds of games, while a
+// single game's moves say little, so the tag dominates short games and long
+// ones still move the estimate.
+const ratingPriorMoves = 40
+
+// SeedRating combines a rating estimated from moves of play with the
+// player's rating, as a prior worth ratingPriorMoves moves. Without a prior
+// it returns the estimate, and without moves the prior.
+func SeedRating(estimate, moves, prior int) int {
+	if prior <= 0 {
+		return estimate
+	}
+	if moves <= 0 {
+		return prior
+	}
+	weighted := float64(estimate*moves+prior*ratingPriorMoves) / float64(moves+ratingPriorMoves)
+	return int(math.Round(weighted))
+}
+
+// estimateRatings fills in the estimated rating of both players, for the
+// game's TimeControl tag and seeded with their WhiteElo and BlackElo tags.
+// headers may be nil, for a game without tags.
+func (s *GameSummary) estimateRatings(headers map[string]string) {
+	timeControl := ParseTimeControl(headers["TimeControl"])
+	for _, color := range []string{"White", "Black"} {
+		player := s.player(color)
+		player.RatingPrior = 0
+		if rating, err := strconv.Atoi(headers[color+"Elo"]); err == nil && rating > 0 {
+			player.RatingPrior = rating
+		}
+		player.MoveQualityRating = EstimateRating(player, timeControl)
+		player.EstimatedRating = SeedRating(player.MoveQualityRating, player.Moves, player.RatingPrior)
+	}
+}
+
+// RatingEstimate is a player's estimated strength over several games
+type RatingEstimate struct {
+	Games  int `json:"games"`
+	Moves  int `json:"moves"`
+	Rating int `json:"rating"` // Mean of the per-game estimates, weighted by moves played
+}
+
+// EstimatePlayerRating aggregates the named player's per-game rating
+// estimates over a batch of games
+func EstimatePlayerRating(games []*GameAnalysis, player string) RatingEstimate {
+	var estimate RatingEstimate
+	var weighted float64
+	for _, game := range games {
+		color := game.PlayerColor(player)
+		if color == "" {
+			continue
+		}
+		summary := game.Summary.player(color)
+		if summary.Moves == 0 {
+			continue
+		}
+		estimate.Games++
+		estimate.Moves += summary.Moves
+		weighted += float64(summary.EstimatedRating * summary.Moves)
+	}
+	if estimate.Moves > 0 {
+		estimate.Rating = int(math.Round(weighted / float64(estimate.Moves)))
+	}
+	return estimate
+}
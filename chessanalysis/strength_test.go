@@ -0,0 +1,81 @@
+package chessanalysis
+
+import "testing"
+
+func TestParseTimeControl(t *testing.T) {
+	tests := map[string]TimeControlCategory{
+		"60":           Bullet,
+		"120+1":        Bullet,
+		"180+2":        Blitz,
+		"600":          Rapid,
+		"900+10":       Rapid,
+		"1800":         Classical,
+		"40/7200:3600": Classical,
+		"-":            UnknownTimeControl,
+		"?":            UnknownTimeControl,
+		"":             UnknownTimeControl,
+	}
+	for tag, want := range tests {
+		if got := ParseTimeControl(tag); got != want {
+			t.Errorf("ParseTimeControl(%q) = %v, want %v", tag, got, want)
+		}
+	}
+}
+
+func TestEstimateRating(t *testing.T) {
+	strong := &PlayerSummary{AccuracyStats: AccuracyStats{Moves: 40, ACPL: 15}, BestMoves: 24}
+	weak := &PlayerSummary{AccuracyStats: AccuracyStats{Moves: 40, ACPL: 90}, BestMoves: 8, Blunders: 4}
+
+	strongRating := EstimateRating(strong, Classical)
+	weakRating := EstimateRating(weak, Classical)
+	if strongRating <= weakRating {
+		t.Errorf("expected strong play to rate above weak play, got %d and %d", strongRating, weakRating)
+	}
+	if strongRating < 2000 || weakRating > 1500 {
+		t.Errorf("implausible ratings %d and %d", strongRating, weakRating)
+	}
+	if blitz := EstimateRating(weak, Blitz); blitz <= weakRating {
+		t.Errorf("expected the same play to rate higher in blitz, got %d and %d", blitz, weakRating)
+	}
+	if got := EstimateRating(&PlayerSummary{}, Blitz); got != 0 {
+		t.Errorf("expected no estimate without moves, got %d", got)
+	}
+}
+
+func TestEstimatePlayerRating(t *testing.T) {
+	first := testGame("me", "them", "1-0", "C50", []string{"e4", "e5", "Nf3"}, nil)
+	first.Summary.White = PlayerSummary{AccuracyStats: AccuracyStats{Moves: 2}, EstimatedRating: 1500}
+	second := testGame("them", "me", "1-0", "C50", []string{"e4", "e5"}, nil)
+	second.Summary.Black = PlayerSummary{AccuracyStats: AccuracyStats{Moves: 1}, EstimatedRating: 1800}
+	other := testGame("someone", "else", "1-0", "C50", []string{"e4"}, nil)
+
+	estimate := EstimatePlayerRating([]*GameAnalysis{first, second, other}, "me")
+	if estimate.Games != 2 || estimate.Moves != 3 || estimate.Rating != 1600 {
+		t.Errorf("unexpected estimate %+v", estimate)
+	}
+}
+
+func TestSeedRating(t *testing.T) {
+	if got := SeedRating(1200, 40, 2000); got != 1600 {
+		t.Errorf("expected a 40 move game to weigh as much as the tag, got %d", got)
+	}
+	if got := SeedRating(1200, 10, 2000); got != 1840 {
+		t.Errorf("expected a short game to move the tag a little, got %d", got)
+	}
+	if got := SeedRating(1200, 40, 0); got != 1200 {
+		t.Errorf("expected the estimate alone without a tag, got %d", got)
+	}
+	if got := SeedRating(0, 0, 2000); got != 2000 {
+		t.Errorf("expected the tag alone without moves, got %d", got)
+	}
+
+	moves := testGame("me", "them", "1-0", "C50", []string{"e4", "e5", "Nf3", "Nc6"}, nil).Moves
+	game := NewGameAnalysis("[WhiteElo \"2100\"]\n[BlackElo \"-\"]\n\n1. e4 e5 2. Nf3 Nc6 *", moves, EffectiveOptions{})
+	white, black := game.Summary.White, game.Summary.Black
+	if white.RatingPrior != 2100 || white.EstimatedRating != SeedRating(white.MoveQualityRating, white.Moves, 2100) {
+		t.Errorf("expected White's estimate seeded with the tag, got %+v", white)
+	}
+	if black.RatingPrior != 0 || black.EstimatedRating != black.MoveQualityRating {
+		t.Errorf("expected Black's estimate from the moves alone, got %+v", black)
+	}
+}
@@ -0,0 +1,154 @@
+package chessanalysis
+
+import "strings"
+
+// Pawn structure and king placement features used to find blunder-prone structures
+const (
+	IsolatedPawnFeature       = "Isolated pawn"
+	IsolatedQueenPawnFeature  = "Isolated queen's pawn"
+	DoubledPawnsFeature       = "Doubled pawns"
+	OpenCenterFeature         = "Open center"
+	LockedCenterFeature       = "Locked center"
+	OppositeCastlingFeature   = "Opposite-side castling"
+	OpponentPassedPawnFeature = "Opponent passed pawn"
+)
+
+// board is a FEN piece placement indexed by rank (0 is the first rank) then file
+type board [8][8]rune
+
+// parseBoard reads the piece placement field of a FEN
+func parseBoard(fen string) board {
+	var b board
+	placement, _, _ := strings.Cut(fen, " ")
+	for i, rank := range strings.Split(placement, "/") {
+		if i > 7 {
+			break
+		}
+		file := 0
+		for _, r := range rank {
+			if r >= '1' && r <= '8' {
+				file += int(r - '0')
+				continue
+			}
+			if file < 8 {
+				b[7-i][file] = r
+			}
+			file++
+		}
+	}
+	return b
+}
+
+// pawnsOnFile counts the pawns of the given piece letter ('P' or 'p') on a file
+func (b *board) pawnsOnFile(pawn rune, file int) int {
+	if file < 0 || file > 7 {
+		return 0
+	}
+	count := 0
+	for rank := 0; rank < 8; rank++ {
+		if b[rank][file] == pawn {
+			count++
+		}
+	}
+	return count
+}
+
+// isolated reports whether pawns of the given letter on file have no friendly pawns on adjacent files
+func (b *board) isolated(pawn rune, file int) bool {
+	return b.pawnsOnFile(pawn, file) > 0 && b.pawnsOnFile(pawn, file-1) == 0 && b.pawnsOnFile(pawn, file+1) == 0
+}
+
+// hasPassedPawn reports whether the side with the given pawn letter has a passed pawn
+func (b *board) hasPassedPawn(pawn rune) bool {
+	enemy, direction := 'p', 1
+	if pawn == 'p' {
+		enemy, direction = 'P', -1
+	}
+	for rank := 0; rank < 8; rank++ {
+		for file := 0; file < 8; file++ {
+			if b[rank][file] != pawn {
+				continue
+			}
+			passed := true
+			for ahead := rank + direction; ahead >= 0 && ahead < 8 && passed; ahead += direction {
+				for f := max(file-1, 0); f <= min(file+1, 7); f++ {
+					if b[ahead][f] == enemy {
+						passed = false
+					}
+				}
+			}
+			if passed {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// kingFile returns the file of the king with the given letter, or -1
+func (b *board) kingFile(king rune) int {
+	for rank := 0; rank < 8; rank++ {
+		for file := 0; file < 8; file++ {
+			if b[rank][file] == king {
+				return file
+			}
+		}
+	}
+	return -1
+}
+
+// structureFeatures describes the position given as a FEN from the point of
+// view of the side with the given color
+func structureFeatures(fen, color string) []string {
+	b := parseBoard(fen)
+	pawn, opponentPawn := 'P', 'p'
+	if color == "Black" {
+		pawn, opponentPawn = 'p', 'P'
+	}
+
+	var features []string
+	isolated, doubled := false, false
+	for file := 0; file < 8; file++ {
+		if b.isolated(pawn, file) {
+			isolated = true
+		}
+		if b.pawnsOnFile(pawn, file) > 1 {
+			doubled = true
+		}
+	}
+	if b.isolated(pawn, 3) {
+		features = append(features, IsolatedQueenPawnFeature)
+	}
+	if isolated {
+		features = append(features, IsolatedPawnFeature)
+	}
+	if doubled {
+		features = append(features, DoubledPawnsFeature)
+	}
+
+	centerPawns := 0
+	locked := false
+	for file := 3; file <= 4; file++ {
+		centerPawns += b.pawnsOnFile('P', file) + b.pawnsOnFile('p', file)
+		for rank := 0; rank < 7; rank++ {
+			if b[rank][file] == 'P' && b[rank+1][file] == 'p' {
+				locked = true
+			}
+		}
+	}
+	if centerPawns == 0 {
+		features = append(features, OpenCenterFeature)
+	}
+	if locked {
+		features = append(features, LockedCenterFeature)
+	}
+
+	white, black := b.kingFile('K'), b.kingFile('k')
+	if (white >= 0 && white <= 2 && black >= 6) || (black >= 0 && black <= 2 && white >= 6) {
+		features = append(features, OppositeCastlingFeature)
+	}
+	if b.hasPassedPawn(opponentPawn) {
+		features = append(features, OpponentPassedPawnFeature)
+	}
+	return features
+}
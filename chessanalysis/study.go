@@ -0,0 +1,56 @@
+package chessanalysis
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// LichessStudySource fetches the chapters of studies from the Lichess study
+// export API
+type LichessStudySource struct {
+	Client *http.Client
+	URL    string
+}
+
+// NewLichessStudySource returns a study source for lichess.org
+func NewLichessStudySource() *LichessStudySource {
+	return &LichessStudySource{
+		Client: &http.Client{Timeout: time.Minute},
+		URL:    LichessURL,
+	}
+}
+
+// Chapters returns the chapters of the study with the given ID as a PGN
+// database, a game for each chapter with its variations and comments, for
+// AnalyzeChessGames WithVariations. Public and unlisted studies can be
+// fetched; private ones are reported as not found.
+func (s *LichessStudySource) Chapters(ctx context.Context, study string) (string, error) {
+	query := url.Values{
+		"variations": {"true"},
+		"comments":   {"true"},
+		"clocks":     {"true"},
+	}
+	endpoint := fmt.Sprintf("%s/api/study/%s.pgn?%s", s.URL, url.PathEscape(study), query.Encode())
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return "", err
+	}
+	request.Header.Set("Accept", "application/x-chess-pgn")
+	response, err := s.Client.Do(request)
+	if err != nil {
+		return "", fmt.Errorf("fetching study %s: %w", study, err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("fetching study %s: %s", study, response.Status)
+	}
+	pgn, err := io.ReadAll(response.Body)
+	if err != nil {
+		return "", fmt.Errorf("fetching study %s: %w", study, err)
+	}
+	return string(pgn), nil
+}
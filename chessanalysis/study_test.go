@@ -0,0 +1,42 @@
+package chessanalysis
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestLichessStudyChapters(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/study/AbCd1234.pgn" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.URL.Query().Get("variations") != "true" {
+			t.Errorf("expected the variations to be asked for, got %s", r.URL.RawQuery)
+		}
+		fmt.Fprint(w, studyChapterPgn+"\n\n"+studyChapterPgn)
+	}))
+	defer server.Close()
+	source := NewLichessStudySource()
+	source.URL = server.URL
+
+	pgn, err := source.Chapters(context.Background(), "AbCd1234")
+	if err != nil {
+		t.Fatal(err)
+	}
+	games, err := AnalyzeChessGames(pgn, WithDepth(1), WithEngineFactory((&FakeEngine{}).NewEngine), WithVariations())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(games) != 2 || len(games[1].Variations) != 2 {
+		t.Errorf("expected 2 chapters with 2 variations each, got %d", len(games))
+	}
+
+	if _, err := source.Chapters(context.Background(), "Private1"); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("expected a missing study to fail, got %v", err)
+	}
+}
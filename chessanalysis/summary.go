@@ -0,0 +1,399 @@
+package chessanalysis
+
+import (
+	"math"
+	"sort"
+)
+
+// maxCentipawnLoss caps the loss counted for a single move so mate scores don't swamp the average
+const maxCentipawnLoss = 1000
+
+// expectedScore returns the mover's expected score (win + half a draw) in percent
+func expectedScore(color string, whiteWinProb, whiteDrawProb, whiteLossProb float64) float64 {
+	if color == "White" {
+		return 100 * (whiteWinProb + whiteDrawProb/2)
+	}
+	return 100 * (whiteLossProb + whiteDrawProb/2)
+}
+
+// expectedScoreLoss returns how many percentage points of expected score the
+// move cost its player, or 0 if it didn't lose ground
+func expectedScoreLoss(move *MoveAnalysis) float64 {
+	before := expectedScore(move.Color, move.PreviousWhiteWinProb, move.PreviousWhiteDrawProb, move.PreviousWhiteLossProb)
+	after := expectedScore(move.Color, move.WhiteWinProb, move.WhiteDrawProb, move.WhiteLossProb)
+	return math.Max(0, before-after)
+}
+
+// moverExpectation returns the mover's expected score in percent, from the
+// win/draw/loss chances when there are some and from the score otherwise
+func moverExpectation(color string, whiteScore Score, whiteWinProb, whiteDrawProb, whiteLossProb float64) float64 {
+	if hasWDL(whiteWinProb, whiteDrawProb, whiteLossProb) {
+		return expectedScore(color, whiteWinProb, whiteDrawProb, whiteLossProb)
+	}
+	if color == "White" {
+		return scoreExpectation(whiteScore)
+	}
+	return 100 - scoreExpectation(whiteScore)
+}
+
+// expectedPoints returns the expected points the move gained its player,
+// from -1 to 1 and negative where it threw points away
+func expectedPoints(move *MoveAnalysis) float64 {
+	before := moverExpectation(move.Color, move.PreviousWhiteScore, move.PreviousWhiteWinProb, move.PreviousWhiteDrawProb, move.PreviousWhiteLossProb)
+	after := moverExpectation(move.Color, move.WhiteScore, move.WhiteWinProb, move.WhiteDrawProb, move.WhiteLossProb)
+	return (after - before) / 100
+}
+
+// moveAccuracy converts the mover's loss of expected score into a 0-100 accuracy,
+// using the curve popularized by Lichess
+func moveAccuracy(move *MoveAnalysis) float64 {
+	loss := expectedScoreLoss(move)
+	if loss == 0 {
+		return 100
+	}
+	accuracy := 103.1668*math.Exp(-0.04354*loss) - 3.1669
+	return math.Max(0, math.Min(100, accuracy))
+}
+
+// centipawnLoss returns how many centipawns the move lost from the mover's perspective
+func centipawnLoss(move *MoveAnalysis) float64 {
+	loss := float64(move.PreviousWhiteScore.CP() - move.WhiteScore.CP())
+	if move.Color == "Black" {
+		loss = -loss
+	}
+	return math.Max(0, math.Min(maxCentipawnLoss, loss))
+}
+
+// AccuracyStats aggregates move quality over a set of moves
+type AccuracyStats struct {
+	Moves    int     `json:"moves"`
+	Accuracy float64 `json:"accuracy"` // Mean move accuracy, 0-100
+	ACPL     float64 `json:"acpl"`     // Average centipawn loss
+	// BestMoveAgreement is the percentage of moves that were the engine's first choice
+	BestMoveAgreement float64 `json:"bestMoveAgreement"`
+	// TopThreeAgreement is the percentage of moves among the engine's top three.
+	// It only exceeds BestMoveAgreement when analyzing with a MultiPV of 3 or more.
+	TopThreeAgreement float64 `json:"topThreeAgreement"`
+	// ExpectedPoints is the total of MoveAnalysis.ExpectedPoints over the
+	// moves, negative where the player threw points away
+	ExpectedPoints float64 `json:"expectedPoints"`
+}
+
+// add includes a move in the running totals; finish turns the totals into
+// averages, apart from ExpectedPoints
+func (s *AccuracyStats) add(move *MoveAnalysis) {
+	s.Moves++
+	s.Accuracy += move.Accuracy
+	s.ACPL += move.CentipawnLoss
+	s.ExpectedPoints += move.ExpectedPoints
+	if move.IsBestMove {
+		s.BestMoveAgreement++
+	}
+	if move.IsBestMove || (move.EngineRank > 0 && move.EngineRank <= 3) {
+		s.TopThreeAgreement++
+	}
+}
+
+func (s *AccuracyStats) finish() {
+	if s.Moves > 0 {
+		s.Accuracy /= float64(s.Moves)
+		s.ACPL /= float64(s.Moves)
+		s.BestMoveAgreement = 100 * s.BestMoveAgreement / float64(s.Moves)
+		s.TopThreeAgreement = 100 * s.TopThreeAgreement / float64(s.Moves)
+	}
+}
+
+// ConsistencyStats measures how evenly a player performed, for tracking
+// improvement over time
+type ConsistencyStats struct {
+	// WinProbLossStdDev is the standard deviation of the expected score lost
+	// per move, in percentage points
+	WinProbLossStdDev float64 `json:"winProbLossStdDev"`
+	// LongestCleanStreak is the most consecutive moves without a questionable move or blunder
+	LongestCleanStreak int `json:"longestCleanStreak"`
+
+	losses []float64
+	streak int
+}
+
+// add includes a move in the running totals; finish computes the metrics
+func (c *ConsistencyStats) add(move *MoveAnalysis) {
+	c.losses = append(c.losses, expectedScoreLoss(move))
+	if move.Classification == Blunder || move.Classification == Questionable {
+		c.streak = 0
+		return
+	}
+	c.streak++
+	c.LongestCleanStreak = max(c.LongestCleanStreak, c.streak)
+}
+
+func (c *ConsistencyStats) finish() {
+	if len(c.losses) == 0 {
+		return
+	}
+	var mean float64
+	for _, loss := range c.losses {
+		mean += loss
+	}
+	mean /= float64(len(c.losses))
+	var variance float64
+	for _, loss := range c.losses {
+		variance += (loss - mean) * (loss - mean)
+	}
+	c.WinProbLossStdDev = math.Sqrt(variance / float64(len(c.losses)))
+	c.losses = nil
+}
+
+// ClockSegmentStats is the move quality of the moves played in one clock segment
+type ClockSegmentStats struct {
+	AccuracyStats
+	Blunders    int     `json:"blunders"`
+	BlunderRate float64 `json:"blunderRate"` // Percentage of the moves that were blunders
+}
+
+func (s *ClockSegmentStats) add(move *MoveAnalysis) {
+	s.AccuracyStats.add(move)
+	if move.Classification == Blunder {
+		s.Blunders++
+	}
+}
+
+func (s *ClockSegmentStats) finish() {
+	s.AccuracyStats.finish()
+	s.BlunderRate = percentage(s.Blunders, s.Moves)
+}
+
+// PlayerSummary is the move quality of one side of the game
+type PlayerSummary struct {
+	AccuracyStats
+	BestMoves       int `json:"bestMoves"`
+	Blunders        int `json:"blunders"`
+	MissedDraws     int `json:"missedDraws"`     // Moves in lost positions that missed a drawing resource, see MoveAnalysis.MissedDraw
+	MissedMates     int `json:"missedMates"`     // Moves that gave up a forced mate, see MoveAnalysis.MissedMate
+	EstimatedRating int `json:"estimatedRating"` // MoveQualityRating seeded with RatingPrior, see SeedRating
+	// MoveQualityRating is the strength the player's moves showed, see
+	// EstimateRating, and RatingPrior their rating tag, 0 without one
+	MoveQualityRating int              `json:"moveQualityRating"`
+	RatingPrior       int              `json:"ratingPrior,omitempty"`
+	Opening           AccuracyStats    `json:"opening"`
+	Middlegame        AccuracyStats    `json:"middlegame"`
+	Endgame           AccuracyStats    `json:"endgame"`
+	Consistency       ConsistencyStats `json:"consistency"`
+	// LostPositions is how many times the player fell into a lost position,
+	// and Swindles how many of those the opponent let them back from, see
+	// DetectSwindles. Resourcefulness is the percentage of lost positions
+	// they got back from.
+	LostPositions   int     `json:"lostPositions"`
+	Swindles        int     `json:"swindles"`
+	Resourcefulness float64 `json:"resourcefulness"`
+	// NormalTime and TimeTrouble split the moves by MoveAnalysis.TimeTrouble.
+	// Moves without clock data are in neither segment.
+	NormalTime  ClockSegmentStats `json:"normalTime"`
+	TimeTrouble ClockSegmentStats `json:"timeTrouble"`
+	// CentipawnLossHistogram is the distribution of the player's centipawn loss per move
+	CentipawnLossHistogram []HistogramBucket `json:"centipawnLossHistogram"`
+	// BookExit is where the player left the opening book, when analyzed with WithTheory
+	BookExit *BookExit `json:"bookExit,omitempty"`
+	// OpeningQuality is how the player came out of the opening, see AssessOpening
+	OpeningQuality *OpeningQuality `json:"openingQuality,omitempty"`
+}
+
+// Phase returns the stats for the given phase
+func (s *PlayerSummary) Phase(phase GamePhase) *AccuracyStats {
+	switch phase {
+	case Middlegame:
+		return &s.Middlegame
+	case Endgame:
+		return &s.Endgame
+	default:
+		return &s.Opening
+	}
+}
+
+// GameSummary aggregates the analysis of a game per player
+type GameSummary struct {
+	White      PlayerSummary `json:"white"`
+	Black      PlayerSummary `json:"black"`
+	KeyMoments []KeyMoment   `json:"keyMoments"` // The largest swings of the game, see TopSwings
+	// AccuracyByPhase is each player's accuracy in each phase of the game,
+	// one row per phase in the order they're played
+	AccuracyByPhase []PhaseAccuracy `json:"accuracyByPhase"`
+	// TurningPoints are the moves that changed who stands better, using DefaultWinProbBands
+	TurningPoints []TurningPoint `json:"turningPoints"`
+	// Material is the material balance after every move
+	Material []MaterialBalance `json:"material"`
+	// KingSafety is the safety of both kings after every move
+	KingSafety []KingSafety `json:"kingSafety"`
+	// KingSafetyCollapses are the moves after which a king's safety dropped by
+	// at least DefaultKingSafetyDrop
+	KingSafetyCollapses []KingSafetyCollapse `json:"kingSafetyCollapses"`
+	// Partial is set when the time budget given with WithTimeBudget ran out
+	// before every move was analyzed
+	Partial bool `json:"partial,omitempty"`
+	// TerminalStatus is how the final move ended the game, such as
+	// TerminalCheckmate, or "" if the game stopped in a playable position
+	TerminalStatus string `json:"terminalStatus,omitempty"`
+	// NothingToAnalyze is set for games with too few moves to analyze, see
+	// MinAnalyzedPlies
+	NothingToAnalyze bool `json:"nothingToAnalyze,omitempty"`
+	// DeadDraw is where the game became a trivial draw, if it did, see
+	// DetectDeadDraw and WithoutDeadDrawMoves
+	DeadDraw *DeadDraw `json:"deadDraw,omitempty"`
+	// Swindles are the errors that let a lost player back into the game
+	Swindles []Swindle `json:"swindles"`
+}
+
+// PhaseAccuracy is both players' accuracy in one phase of the game, nil for
+// a player who played no move in it
+type PhaseAccuracy struct {
+	Phase string   `json:"phase"`
+	White *float64 `json:"white"`
+	Black *float64 `json:"black"`
+}
+
+// accuracyByPhase cross-tabulates the players' accuracy by phase
+func (s *GameSummary) accuracyByPhase() []PhaseAccuracy {
+	accuracy := func(stats *AccuracyStats) *float64 {
+		if stats.Moves == 0 {
+			return nil
+		}
+		value := stats.Accuracy
+		return &value
+	}
+	var table []PhaseAccuracy
+	for _, phase := range []GamePhase{Opening, Middlegame, Endgame} {
+		table = append(table, PhaseAccuracy{
+			Phase: phase.String(),
+			White: accuracy(s.White.Phase(phase)),
+			Black: accuracy(s.Black.Phase(phase)),
+		})
+	}
+	return table
+}
+
+// DefaultKeyMoments is how many key moments a game summary lists
+const DefaultKeyMoments = 5
+
+// KeyMoment is a move that swung the game
+type KeyMoment struct {
+	Ply            int      `json:"ply"` // Index of the move within the game
+	Move           string   `json:"move"`
+	Color          string   `json:"color"`
+	Swing          float64  `json:"swing"` // Mover's loss of expected score, in percentage points
+	Classification string   `json:"classification"`
+	Refutation     []string `json:"refutation,omitempty"`
+}
+
+// TopSwings ranks the moves that cost their player the most expected score,
+// largest first, returning at most n. Unlike classifications it doesn't depend
+// on any thresholds, so every game has key moments unless no move lost ground.
+func TopSwings(moves []MoveAnalysis, n int) []KeyMoment {
+	moments := []KeyMoment{}
+	for i := range moves {
+		move := &moves[i]
+		swing := expectedScoreLoss(move)
+		if swing == 0 {
+			continue
+		}
+		moments = append(moments, KeyMoment{
+			Ply:            i,
+			Move:           MoveLabel(move),
+			Color:          move.Color,
+			Swing:          swing,
+			Classification: move.Classification.String(),
+			Refutation:     move.Refutation,
+		})
+	}
+	sort.SliceStable(moments, func(i, j int) bool {
+		return moments[i].Swing > moments[j].Swing
+	})
+	if len(moments) > n {
+		moments = moments[:n]
+	}
+	return moments
+}
+
+// player returns the summary for the side with the given color
+func (s *GameSummary) player(color string) *PlayerSummary {
+	if color == "White" {
+		return &s.White
+	}
+	return &s.Black
+}
+
+// record includes a move in the player's totals
+func (s *PlayerSummary) record(move *MoveAnalysis) {
+	if s.CentipawnLossHistogram == nil {
+		s.CentipawnLossHistogram = newCentipawnLossHistogram()
+	}
+	addToHistogram(s.CentipawnLossHistogram, move.CentipawnLoss)
+	s.add(move)
+	s.Consistency.add(move)
+	if move.TimeTrouble {
+		s.TimeTrouble.add(move)
+	} else if move.HasClock {
+		s.NormalTime.add(move)
+	}
+	s.Phase(move.Phase).add(move)
+	if move.IsBestMove {
+		s.BestMoves++
+	}
+	if move.Classification == Blunder {
+		s.Blunders++
+	}
+	if move.MissedDraw != "" {
+		s.MissedDraws++
+	}
+	if move.MissedMate > 0 {
+		s.MissedMates++
+	}
+}
+
+// complete turns the player's totals into averages
+func (s *PlayerSummary) complete() {
+	if s.CentipawnLossHistogram == nil {
+		s.CentipawnLossHistogram = newCentipawnLossHistogram()
+	}
+	s.finish()
+	s.Consistency.finish()
+	s.NormalTime.finish()
+	s.TimeTrouble.finish()
+	s.Opening.finish()
+	s.Middlegame.finish()
+	s.Endgame.finish()
+}
+
+// Summarize aggregates per-move analysis into per-player statistics. Ratings
+// are estimated without regard to the time control or the players' ratings;
+// NewGameAnalysis refines them using the game's tags.
+func Summarize(moves []MoveAnalysis) GameSummary {
+	var summary GameSummary
+	summary.summarizePlayers(moves)
+	summary.estimateRatings(nil)
+	summary.KeyMoments = TopSwings(moves, DefaultKeyMoments)
+	summary.TurningPoints = DetectTurningPoints(moves, DefaultWinProbBands)
+	summary.Material = MaterialTimeline(moves)
+	summary.KingSafety = KingSafetyTimeline(moves)
+	summary.KingSafetyCollapses = DetectKingSafetyCollapses(moves, summary.KingSafety, DefaultKingSafetyDrop)
+	summary.DeadDraw = DetectDeadDraw(moves, DefaultDeadDrawCriteria)
+	summary.Swindles = DetectSwindles(moves)
+	if len(moves) > 0 {
+		summary.TerminalStatus = moves[len(moves)-1].TerminalStatus
+	}
+	return summary
+}
+
+// summarizePlayers computes each player's statistics over the moves, leaving
+// out those skipped as the opponent's with WithSide
+func (s *GameSummary) summarizePlayers(moves []MoveAnalysis) {
+	s.White, s.Black = PlayerSummary{}, PlayerSummary{}
+	for i := range moves {
+		if !moves[i].Skipped {
+			s.player(moves[i].Color).record(&moves[i])
+		}
+	}
+	s.White.complete()
+	s.Black.complete()
+	s.recordResourcefulness(moves)
+	s.AccuracyByPhase = s.accuracyByPhase()
+}
@@ -0,0 +1,133 @@
+package chessanalysis
+
+import (
+	"math"
+	"testing"
+
+	chess "github.com/corentings/chess/v2"
+	"github.com/walterschell/chess-analyzer/chessanalysis/uciengine"
+)
+
+func TestSummarize(t *testing.T) {
+	moves := []MoveAnalysis{
+		{Color: "White", Phase: Opening, Accuracy: 100, CentipawnLoss: 0},
+		{Color: "Black", Phase: Opening, Accuracy: 90, CentipawnLoss: 20},
+		{Color: "White", Phase: Middlegame, Accuracy: 50, CentipawnLoss: 200},
+		{Color: "Black", Phase: Endgame, Accuracy: 70, CentipawnLoss: 40},
+	}
+	summary := Summarize(moves)
+
+	if summary.White.Moves != 2 || summary.White.Accuracy != 75 || summary.White.ACPL != 100 {
+		t.Errorf("unexpected White summary: %+v", summary.White.AccuracyStats)
+	}
+	if summary.White.Middlegame.Moves != 1 || summary.White.Middlegame.ACPL != 200 {
+		t.Errorf("unexpected White middlegame summary: %+v", summary.White.Middlegame)
+	}
+	if summary.Black.Endgame.Accuracy != 70 || summary.Black.Opening.Accuracy != 90 {
+		t.Errorf("unexpected Black phase summary: %+v", summary.Black)
+	}
+
+	table := summary.AccuracyByPhase
+	if len(table) != 3 || table[0].Phase != "Opening" || *table[0].White != 100 || *table[0].Black != 90 {
+		t.Fatalf("unexpected accuracy by phase %+v", table)
+	}
+	if *table[1].White != 50 || table[1].Black != nil || table[2].White != nil || *table[2].Black != 70 {
+		t.Errorf("expected phases without moves to have no accuracy, got %+v and %+v", table[1], table[2])
+	}
+}
+
+func TestConsistency(t *testing.T) {
+	moves := []MoveAnalysis{
+		{Color: "White", PreviousWhiteDrawProb: 1, WhiteDrawProb: 1},
+		{Color: "White", PreviousWhiteDrawProb: 1, WhiteDrawProb: 1},
+		{Color: "White", PreviousWhiteDrawProb: 1, WhiteDrawProb: 0.8, WhiteLossProb: 0.2, Classification: Questionable},
+		{Color: "White", PreviousWhiteDrawProb: 1, WhiteDrawProb: 1},
+	}
+	consistency := Summarize(moves).White.Consistency
+	if consistency.LongestCleanStreak != 2 {
+		t.Errorf("expected longest clean streak of 2, got %d", consistency.LongestCleanStreak)
+	}
+	// Losses of 0, 0, 10 and 0 points have a mean of 2.5
+	if want := math.Sqrt(75.0 / 4); math.Abs(consistency.WinProbLossStdDev-want) > 1e-9 {
+		t.Errorf("expected standard deviation %.4f, got %.4f", want, consistency.WinProbLossStdDev)
+	}
+}
+
+func TestTopSwings(t *testing.T) {
+	moves := []MoveAnalysis{
+		{MoveNumber: 1, Color: "White", MoveText: "e4", PreviousWhiteDrawProb: 1, WhiteDrawProb: 1},
+		{MoveNumber: 1, Color: "Black", MoveText: "f6", PreviousWhiteDrawProb: 1, WhiteWinProb: 0.2, WhiteDrawProb: 0.8},
+		{MoveNumber: 2, Color: "White", MoveText: "d4", PreviousWhiteWinProb: 0.2, PreviousWhiteDrawProb: 0.8, WhiteWinProb: 0.2, WhiteDrawProb: 0.8},
+		{MoveNumber: 2, Color: "Black", MoveText: "g5", PreviousWhiteWinProb: 0.2, PreviousWhiteDrawProb: 0.8, WhiteWinProb: 1,
+			Classification: Blunder, Refutation: []string{"Qh5#"}},
+	}
+	moments := TopSwings(moves, 5)
+	if len(moments) != 2 {
+		t.Fatalf("expected 2 key moments, got %+v", moments)
+	}
+	if moments[0].Move != "2... g5" || moments[0].Ply != 3 || math.Abs(moments[0].Swing-40) > 1e-9 || moments[0].Refutation[0] != "Qh5#" {
+		t.Errorf("unexpected top swing %+v", moments[0])
+	}
+	if moments[1].Move != "1... f6" || math.Abs(moments[1].Swing-10) > 1e-9 {
+		t.Errorf("unexpected second swing %+v", moments[1])
+	}
+	if top := TopSwings(moves, 1); len(top) != 1 || top[0].Ply != 3 {
+		t.Errorf("expected only the largest swing, got %+v", top)
+	}
+}
+
+func TestExpectedPoints(t *testing.T) {
+	moves := []MoveAnalysis{
+		// Black throws away a draw in the middlegame, then White half of the win
+		{Color: "Black", Phase: Middlegame, PreviousWhiteDrawProb: 1, WhiteWinProb: 0.8, WhiteDrawProb: 0.2},
+		{Color: "White", Phase: Endgame, PreviousWhiteWinProb: 0.8, PreviousWhiteDrawProb: 0.2, WhiteWinProb: 0.4, WhiteDrawProb: 0.6},
+		// Without win/draw/loss chances, the scores are compared
+		{Color: "Black", Phase: Endgame, PreviousWhiteScore: Score{}, WhiteScore: Score{}},
+	}
+	for i := range moves {
+		moves[i].ExpectedPoints = expectedPoints(&moves[i])
+	}
+	if math.Abs(moves[0].ExpectedPoints+0.4) > 1e-9 || math.Abs(moves[1].ExpectedPoints+0.2) > 1e-9 || moves[2].ExpectedPoints != 0 {
+		t.Errorf("unexpected expected points %.2f, %.2f and %.2f", moves[0].ExpectedPoints, moves[1].ExpectedPoints, moves[2].ExpectedPoints)
+	}
+	summary := Summarize(moves)
+	if math.Abs(summary.Black.ExpectedPoints+0.4) > 1e-9 || math.Abs(summary.Black.Middlegame.ExpectedPoints+0.4) > 1e-9 || summary.Black.Endgame.ExpectedPoints != 0 {
+		t.Errorf("unexpected Black expected points %+v", summary.Black)
+	}
+	if math.Abs(summary.White.Endgame.ExpectedPoints+0.2) > 1e-9 {
+		t.Errorf("unexpected White endgame expected points %.2f", summary.White.Endgame.ExpectedPoints)
+	}
+}
+
+func TestMoveAccuracy(t *testing.T) {
+	best := &MoveAnalysis{Color: "White", PreviousWhiteDrawProb: 1, WhiteDrawProb: 1}
+	if accuracy := moveAccuracy(best); accuracy != 100 {
+		t.Errorf("expected accuracy 100 when nothing is lost, got %.2f", accuracy)
+	}
+
+	// Black throws away a drawn position
+	blunder := &MoveAnalysis{Color: "Black", PreviousWhiteDrawProb: 1, WhiteWinProb: 1}
+	if accuracy := moveAccuracy(blunder); accuracy > 10 {
+		t.Errorf("expected low accuracy for a losing blunder, got %.2f", accuracy)
+	}
+	if loss := centipawnLoss(&MoveAnalysis{Color: "Black", PreviousWhiteScore: uciengine.Pawns(0.5), WhiteScore: uciengine.Pawns(2)}); math.Abs(loss-150) > 1e-9 {
+		t.Errorf("expected 150 centipawn loss, got %.2f", loss)
+	}
+}
+
+func TestDetectPhase(t *testing.T) {
+	if phase := detectPhase(chess.StartingPosition(), 1, Opening); phase != Opening {
+		t.Errorf("expected starting position to be the opening, got %s", phase)
+	}
+	if phase := detectPhase(chess.StartingPosition(), 20, Opening); phase != Middlegame {
+		t.Errorf("expected move 20 to be the middlegame, got %s", phase)
+	}
+
+	rookEnding, err := chess.FEN("8/5pk1/6p1/8/8/6P1/r4PK1/4R3 w - - 0 40")
+	if err != nil {
+		t.Fatalf("failed to parse FEN: %v", err)
+	}
+	if phase := detectPhase(chess.NewGame(rookEnding).Position(), 40, Middlegame); phase != Endgame {
+		t.Errorf("expected rook ending to be the endgame, got %s", phase)
+	}
+}
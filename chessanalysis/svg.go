@@ -0,0 +1,260 @@
+package chessanalysis
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io/fs"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Arrow colors used by the reports, matching the Lichess analysis board
+const (
+	BestMoveArrowColor   = "#15781b"
+	LastMoveArrowColor   = "#003088"
+	RefutationArrowColor = "#882020"
+	DefaultArrowColor    = "#e68f00"
+)
+
+// HangingPieceColor highlights the squares of hanging pieces
+const HangingPieceColor = "#ff3b30"
+
+// DefaultPieceURL is where board SVGs load piece images from unless they are
+// embedded with WithPieceImages: the webapp's static piece set
+const DefaultPieceURL = "/static/pieces/"
+
+// boardSquareSize is the width of a square in SVG units
+const boardSquareSize = 45
+
+// BoardArrow is an arrow drawn from one square to another, e.g. for a move
+type BoardArrow struct {
+	From  string `json:"from"`
+	To    string `json:"to"`
+	Color string `json:"color"`
+}
+
+// ParseArrows parses a comma-separated list of arrows given as UCI moves. A
+// move can be prefixed with "best:", "last:" or "refutation:" to draw it in the
+// color used for that kind of move, e.g. "last:e2e4,best:g8f6".
+func ParseArrows(spec string) ([]BoardArrow, error) {
+	var arrows []BoardArrow
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		color := DefaultArrowColor
+		if kind, move, ok := strings.Cut(item, ":"); ok {
+			switch kind {
+			case "best":
+				color = BestMoveArrowColor
+			case "last":
+				color = LastMoveArrowColor
+			case "refutation":
+				color = RefutationArrowColor
+			default:
+				return nil, fmt.Errorf("unknown arrow kind %q", kind)
+			}
+			item = move
+		}
+		if len(item) < 4 || !validSquare(item[0:2]) || !validSquare(item[2:4]) {
+			return nil, fmt.Errorf("invalid arrow %q", item)
+		}
+		arrows = append(arrows, BoardArrow{From: item[0:2], To: item[2:4], Color: color})
+	}
+	return arrows, nil
+}
+
+// validSquare reports whether the text is a square name like "e4"
+func validSquare(square string) bool {
+	return len(square) == 2 && square[0] >= 'a' && square[0] <= 'h' && square[1] >= '1' && square[1] <= '8'
+}
+
+// boardOptions are the settings for rendering a board
+type boardOptions struct {
+	arrows     []BoardArrow
+	highlights []string
+	flipped    bool
+	pieceURL   string
+	pieces     fs.FS
+	frameDelay time.Duration // Time each move is shown in animations
+}
+
+// BoardOption customizes a rendered board
+type BoardOption func(*boardOptions)
+
+// WithArrows draws arrows on the board
+func WithArrows(arrows ...BoardArrow) BoardOption {
+	return func(o *boardOptions) {
+		o.arrows = append(o.arrows, arrows...)
+	}
+}
+
+// WithHighlights marks squares, e.g. those of hanging pieces
+func WithHighlights(squares ...string) BoardOption {
+	return func(o *boardOptions) {
+		o.highlights = append(o.highlights, squares...)
+	}
+}
+
+// WithMoveHints draws a move's hints on a board of the position after it:
+// the move played, its refutation and the hanging pieces
+func WithMoveHints(hints MoveHints) BoardOption {
+	return func(o *boardOptions) {
+		if hints.Played != nil {
+			o.arrows = append(o.arrows, *hints.Played)
+		}
+		o.arrows = append(o.arrows, hints.Refutation...)
+		o.highlights = append(o.highlights, hints.Hanging...)
+	}
+}
+
+// WithOrientation sets the side shown at the bottom of the board
+func WithOrientation(color string) BoardOption {
+	return func(o *boardOptions) {
+		o.flipped = color == "Black"
+	}
+}
+
+// WithPieceURL loads piece images from the given URL prefix, which is
+// followed by names like "wK.png"
+func WithPieceURL(prefix string) BoardOption {
+	return func(o *boardOptions) {
+		o.pieceURL = prefix
+	}
+}
+
+// WithPieceImages embeds piece images read from the file system, which holds
+// PNGs named like "wK.png", so the SVG is self-contained
+func WithPieceImages(pieces fs.FS) BoardOption {
+	return func(o *boardOptions) {
+		o.pieces = pieces
+	}
+}
+
+// WithFrameDelay sets how long each move is shown in game animations
+func WithFrameDelay(delay time.Duration) BoardOption {
+	return func(o *boardOptions) {
+		o.frameDelay = delay
+	}
+}
+
+// BoardSVG renders the position as an SVG image
+func BoardSVG(fen string, opts ...BoardOption) (string, error) {
+	if _, err := positionFromFEN(fen); err != nil {
+		return "", err
+	}
+	options := boardOptions{pieceURL: DefaultPieceURL}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	for _, arrow := range options.arrows {
+		if !validSquare(arrow.From) || !validSquare(arrow.To) {
+			return "", fmt.Errorf("invalid arrow from %q to %q", arrow.From, arrow.To)
+		}
+	}
+	for _, square := range options.highlights {
+		if !validSquare(square) {
+			return "", fmt.Errorf("invalid square %q", square)
+		}
+	}
+	b := parseBoard(fen)
+
+	// squareOrigin returns the top left corner of a square
+	squareOrigin := func(file, rank int) (int, int) {
+		if options.flipped {
+			return (7 - file) * boardSquareSize, rank * boardSquareSize
+		}
+		return file * boardSquareSize, (7 - rank) * boardSquareSize
+	}
+
+	var svg strings.Builder
+	size := 8 * boardSquareSize
+	fmt.Fprintf(&svg, `<svg xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink" viewBox="0 0 %d %d" width="%d" height="%d">`, size, size, size, size)
+	svg.WriteString("\n<defs>")
+	colors := arrowColors(options.arrows)
+	for i, color := range colors {
+		fmt.Fprintf(&svg, `<marker id="arrowhead-%d" orient="auto" markerWidth="4" markerHeight="8" refX="2.05" refY="2.01"><path d="M0,0 V4 L3,2 Z" fill="%s"/></marker>`, i, color)
+	}
+	svg.WriteString("</defs>\n")
+
+	for rank := 0; rank < 8; rank++ {
+		for file := 0; file < 8; file++ {
+			x, y := squareOrigin(file, rank)
+			fill := "#f0d9b5"
+			if (rank+file)%2 == 0 {
+				fill = "#b58863"
+			}
+			fmt.Fprintf(&svg, `<rect x="%d" y="%d" width="%d" height="%d" fill="%s"/>`+"\n", x, y, boardSquareSize, boardSquareSize, fill)
+		}
+	}
+
+	for _, square := range options.highlights {
+		x, y := squareOrigin(int(square[0]-'a'), int(square[1]-'1'))
+		fmt.Fprintf(&svg, `<rect x="%d" y="%d" width="%d" height="%d" fill="%s" opacity="0.5"/>`+"\n", x, y, boardSquareSize, boardSquareSize, HangingPieceColor)
+	}
+
+	images := make(map[rune]string)
+	for rank := 0; rank < 8; rank++ {
+		for file := 0; file < 8; file++ {
+			piece := b[rank][file]
+			if piece == 0 {
+				continue
+			}
+			href, ok := images[piece]
+			if !ok {
+				var err error
+				if href, err = options.pieceHref(piece); err != nil {
+					return "", err
+				}
+				images[piece] = href
+			}
+			x, y := squareOrigin(file, rank)
+			fmt.Fprintf(&svg, `<image x="%d" y="%d" width="%d" height="%d" xlink:href="%s"/>`+"\n", x, y, boardSquareSize, boardSquareSize, href)
+		}
+	}
+
+	for _, arrow := range options.arrows {
+		fromX, fromY := squareOrigin(int(arrow.From[0]-'a'), int(arrow.From[1]-'1'))
+		toX, toY := squareOrigin(int(arrow.To[0]-'a'), int(arrow.To[1]-'1'))
+		marker := slices.Index(colors, arrow.Color)
+		half := boardSquareSize / 2
+		fmt.Fprintf(&svg, `<line x1="%d" y1="%d" x2="%d" y2="%d" stroke="%s" stroke-width="9" stroke-linecap="round" opacity="0.8" marker-end="url(#arrowhead-%d)"/>`+"\n",
+			fromX+half, fromY+half, toX+half, toY+half, arrow.Color, marker)
+	}
+	svg.WriteString("</svg>\n")
+	return svg.String(), nil
+}
+
+// arrowColors returns the distinct colors of the arrows, which each need a marker
+func arrowColors(arrows []BoardArrow) []string {
+	var colors []string
+	for _, arrow := range arrows {
+		if !slices.Contains(colors, arrow.Color) {
+			colors = append(colors, arrow.Color)
+		}
+	}
+	return colors
+}
+
+// pieceImageName returns the file name of the image of a FEN piece letter, e.g. "bN.png"
+func pieceImageName(piece rune) string {
+	if piece >= 'a' && piece <= 'z' {
+		return "b" + strings.ToUpper(string(piece)) + ".png"
+	}
+	return "w" + string(piece) + ".png"
+}
+
+// pieceHref returns the image reference for a FEN piece letter
+func (o *boardOptions) pieceHref(piece rune) (string, error) {
+	name := pieceImageName(piece)
+	if o.pieces == nil {
+		return o.pieceURL + name, nil
+	}
+	image, err := fs.ReadFile(o.pieces, name)
+	if err != nil {
+		return "", fmt.Errorf("loading piece image: %w", err)
+	}
+	return "data:image/png;base64," + base64.StdEncoding.EncodeToString(image), nil
+}
@@ -0,0 +1,77 @@
+package chessanalysis
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestParseArrows(t *testing.T) {
+	arrows, err := ParseArrows("last:e2e4, best:g8f6,d2d4")
+	if err != nil {
+		t.Fatalf("failed to parse arrows: %v", err)
+	}
+	want := []BoardArrow{
+		{From: "e2", To: "e4", Color: LastMoveArrowColor},
+		{From: "g8", To: "f6", Color: BestMoveArrowColor},
+		{From: "d2", To: "d4", Color: DefaultArrowColor},
+	}
+	if len(arrows) != len(want) {
+		t.Fatalf("expected %d arrows, got %v", len(want), arrows)
+	}
+	for i := range want {
+		if arrows[i] != want[i] {
+			t.Errorf("arrow %d: expected %+v, got %+v", i, want[i], arrows[i])
+		}
+	}
+	for _, invalid := range []string{"e2", "i2e4", "next:e2e4"} {
+		if _, err := ParseArrows(invalid); err == nil {
+			t.Errorf("expected an error parsing %q", invalid)
+		}
+	}
+}
+
+func TestBoardSVG(t *testing.T) {
+	fen := "rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq e3 0 1"
+	svg, err := BoardSVG(fen, WithArrows(BoardArrow{From: "e2", To: "e4", Color: LastMoveArrowColor}))
+	if err != nil {
+		t.Fatalf("failed to render board: %v", err)
+	}
+	if got := strings.Count(svg, "<image "); got != 32 {
+		t.Errorf("expected 32 pieces, got %d", got)
+	}
+	// The white king starts on e1, the fifth square of the bottom row
+	if !strings.Contains(svg, `x="180" y="315" width="45" height="45" xlink:href="/static/pieces/wK.png"`) {
+		t.Errorf("expected the white king on e1:\n%s", svg)
+	}
+	if !strings.Contains(svg, `<line x1="202" y1="292" x2="202" y2="202" stroke="#003088"`) {
+		t.Errorf("expected an arrow from e2 to e4:\n%s", svg)
+	}
+
+	flipped, err := BoardSVG(fen, WithOrientation("Black"), WithPieceImages(fstest.MapFS{
+		"wK.png": {Data: []byte("king")},
+		"wQ.png": {Data: []byte("queen")}, "wR.png": {}, "wB.png": {}, "wN.png": {}, "wP.png": {},
+		"bK.png": {}, "bQ.png": {}, "bR.png": {}, "bB.png": {}, "bN.png": {}, "bP.png": {},
+	}))
+	if err != nil {
+		t.Fatalf("failed to render flipped board: %v", err)
+	}
+	if !strings.Contains(flipped, `x="135" y="0" width="45" height="45" xlink:href="data:image/png;base64,a2luZw=="`) {
+		t.Errorf("expected an embedded white king on e1 at the top:\n%s", flipped)
+	}
+
+	highlighted, err := BoardSVG(fen, WithMoveHints(MoveHints{Hanging: []string{"e4"}}))
+	if err != nil {
+		t.Fatalf("failed to render highlighted board: %v", err)
+	}
+	if !strings.Contains(highlighted, `<rect x="180" y="180" width="45" height="45" fill="`+HangingPieceColor) {
+		t.Errorf("expected e4 to be highlighted:\n%s", highlighted)
+	}
+	if _, err := BoardSVG(fen, WithHighlights("z9")); err == nil {
+		t.Error("expected an error for an invalid square")
+	}
+
+	if _, err := BoardSVG("not a fen"); err == nil {
+		t.Error("expected an error for an invalid FEN")
+	}
+}
@@ -0,0 +1,68 @@
+package chessanalysis
+
+const (
+	// swindleLost is a player's expected score, in percent, at or below which
+	// they're lost
+	swindleLost = 25
+	// swindleRecovered is the expected score a lost player has to get back to,
+	// in percent, for the game to count as saved
+	swindleRecovered = 40
+)
+
+// Swindle is an opponent's error that let a lost player back into the game
+type Swindle struct {
+	Ply   int     `json:"ply"`   // Index of the opponent's move within the game
+	Move  string  `json:"move"`  // The opponent's move, e.g. "38. Qxb7"
+	Color string  `json:"color"` // The player who was let back in
+	From  float64 `json:"from"`  // The player's expected score before the move, in percent
+	To    float64 `json:"to"`    // The player's expected score after it
+}
+
+// lostEpisodes walks the game calling found for each swindle, and returns
+// how many times each player fell into a lost position
+func lostEpisodes(moves []MoveAnalysis, found func(Swindle)) map[string]int {
+	episodes := map[string]int{}
+	lost := map[string]bool{}
+	previous := map[string]float64{"White": 50, "Black": 50}
+	for i := range moves {
+		move := &moves[i]
+		for _, color := range []string{"White", "Black"} {
+			expectation := moverExpectation(color, move.WhiteScore, move.WhiteWinProb, move.WhiteDrawProb, move.WhiteLossProb)
+			switch {
+			case !lost[color] && expectation <= swindleLost:
+				lost[color] = true
+				episodes[color]++
+			case lost[color] && expectation >= swindleRecovered:
+				lost[color] = false
+				if move.Color != color {
+					found(Swindle{Ply: i, Move: MoveLabel(move), Color: color, From: previous[color], To: expectation})
+				}
+			}
+			previous[color] = expectation
+		}
+	}
+	return episodes
+}
+
+// DetectSwindles returns the opponents' errors that let a lost player back
+// into the game, in the order they were played
+func DetectSwindles(moves []MoveAnalysis) []Swindle {
+	swindles := []Swindle{}
+	lostEpisodes(moves, func(swindle Swindle) {
+		swindles = append(swindles, swindle)
+	})
+	return swindles
+}
+
+// recordResourcefulness counts how often each player was lost and got back
+// into the game
+func (s *GameSummary) recordResourcefulness(moves []MoveAnalysis) {
+	episodes := lostEpisodes(moves, func(swindle Swindle) {
+		s.player(swindle.Color).Swindles++
+	})
+	for _, color := range []string{"White", "Black"} {
+		player := s.player(color)
+		player.LostPositions = episodes[color]
+		player.Resourcefulness = percentage(player.Swindles, player.LostPositions)
+	}
+}
@@ -0,0 +1,33 @@
+package chessanalysis
+
+import "testing"
+
+func TestDetectSwindles(t *testing.T) {
+	moves := []MoveAnalysis{
+		{MoveNumber: 1, Color: "White", MoveText: "e4", WhiteDrawProb: 1},
+		// Black blunders into a lost position
+		{MoveNumber: 1, Color: "Black", MoveText: "f6", WhiteWinProb: 0.9, WhiteDrawProb: 0.1},
+		// White lets Black back in
+		{MoveNumber: 2, Color: "White", MoveText: "Qh5", WhiteDrawProb: 1},
+		// Black is lost again, and only gets back in by the engine changing its mind
+		{MoveNumber: 2, Color: "Black", MoveText: "g5", WhiteWinProb: 1},
+		{MoveNumber: 3, Color: "White", MoveText: "h4", WhiteWinProb: 1},
+		{MoveNumber: 3, Color: "Black", MoveText: "h6", WhiteDrawProb: 1},
+	}
+	swindles := DetectSwindles(moves)
+	if len(swindles) != 1 {
+		t.Fatalf("expected one swindle, got %+v", swindles)
+	}
+	if swindle := swindles[0]; swindle.Ply != 2 || swindle.Move != "2. Qh5" || swindle.Color != "Black" || swindle.From != 5 || swindle.To != 50 {
+		t.Errorf("unexpected swindle %+v", swindle)
+	}
+
+	game := NewGameAnalysis("", moves, EffectiveOptions{})
+	black, white := game.Summary.Black, game.Summary.White
+	if black.LostPositions != 2 || black.Swindles != 1 || black.Resourcefulness != 50 {
+		t.Errorf("unexpected Black resourcefulness %d/%d (%.0f%%)", black.Swindles, black.LostPositions, black.Resourcefulness)
+	}
+	if white.LostPositions != 0 || white.Resourcefulness != 0 {
+		t.Errorf("expected White never to be lost, got %+v", white)
+	}
+}
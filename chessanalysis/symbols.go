@@ -0,0 +1,66 @@
+package chessanalysis
+
+import "fmt"
+
+// ClassificationSymbols are the symbols shown after moves of each
+// classification, such as "??" for blunders
+type ClassificationSymbols map[MoveClassification]string
+
+// ASCIISymbols are symbols that read the same in any encoding, and the
+// default
+var ASCIISymbols = ClassificationSymbols{
+	Blunder:      "??",
+	Questionable: "?",
+	Good:         "!",
+	Excellent:    "!!",
+	Winning:      "+-",
+	Best:         "*",
+	Brilliant:    "!!",
+}
+
+// UnicodeSymbols are the typographic symbols of chess literature, for
+// frontends that display UTF-8
+var UnicodeSymbols = ClassificationSymbols{
+	Blunder:      "⁇",
+	Questionable: "?",
+	Good:         "!",
+	Excellent:    "‼",
+	Winning:      "+−",
+	Best:         "★",
+	Brilliant:    "‼",
+}
+
+// ClassificationSymbolsByName returns ASCIISymbols for "ascii" and
+// UnicodeSymbols for "unicode"
+func ClassificationSymbolsByName(name string) (ClassificationSymbols, error) {
+	switch name {
+	case "ascii":
+		return ASCIISymbols, nil
+	case "unicode":
+		return UnicodeSymbols, nil
+	default:
+		return nil, fmt.Errorf("%w: unknown classification symbols %q", ErrInvalidOptions, name)
+	}
+}
+
+// Symbol returns the symbol of the classification, or "" for classifications
+// shown without one
+func (s ClassificationSymbols) Symbol(classification MoveClassification) string {
+	return s[classification]
+}
+
+// WithClassificationSymbols shows the moves' classifications with the
+// symbols, in their JSON and in reports such as Anki cards
+func WithClassificationSymbols(symbols ClassificationSymbols) AnalyzeChessGameOption {
+	return func(opts *AnalyzeChessGameOptions) {
+		opts.Symbols = symbols
+	}
+}
+
+// Symbol returns the symbol the move's classification is shown with
+func (m *MoveAnalysis) Symbol() string {
+	if m.ClassificationSymbol != "" {
+		return m.ClassificationSymbol
+	}
+	return ASCIISymbols.Symbol(m.Classification)
+}
@@ -0,0 +1,52 @@
+package chessanalysis
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestClassificationSymbols(t *testing.T) {
+	for c := range MoveClassification(len(moveClassificationNames)) {
+		for _, r := range ASCIISymbols.Symbol(c) {
+			if r > 0x7f {
+				t.Errorf("expected an ASCII symbol for %s, got %q", c, ASCIISymbols.Symbol(c))
+			}
+		}
+	}
+
+	moves, err := AnalyzeChessGame(scholarsMatePgn, WithEngineFactory(scholarsMateEngine().NewEngine), WithDepth(4),
+		WithClassificationSymbols(UnicodeSymbols))
+	if err != nil {
+		t.Fatal(err)
+	}
+	blunder := moves[5]
+	if blunder.Classification != Blunder || blunder.ClassificationSymbol != "⁇" {
+		t.Fatalf("expected 3...Nf6 to be a blunder shown as ⁇, got %s %q", blunder.Classification, blunder.ClassificationSymbol)
+	}
+	data, err := json.Marshal(&blunder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded MoveAnalysis
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.ClassificationSymbol != "⁇" {
+		t.Errorf("expected the symbol to survive JSON, got %q in %s", decoded.ClassificationSymbol, data)
+	}
+	if symbol := blunder.Symbol(); symbol != "⁇" {
+		t.Errorf("expected reports to show the chosen symbol, got %q", symbol)
+	}
+
+	// Without a choice, moves show the ASCII symbols
+	decoded.ClassificationSymbol = ""
+	if data, _ := json.Marshal(&decoded); !strings.Contains(string(data), `"classificationSymbol":"??"`) {
+		t.Errorf("expected the ASCII symbol, got %s", data)
+	}
+
+	if _, err := ClassificationSymbolsByName("emoji"); !errors.Is(err, ErrInvalidOptions) {
+		t.Errorf("expected unknown symbols to be refused, got %v", err)
+	}
+}
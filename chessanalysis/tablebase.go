@@ -0,0 +1,93 @@
+package chessanalysis
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Tablebase looks up the theoretical result of endgame positions
+type Tablebase interface {
+	// Probe returns the result of the position given as a FEN with best play,
+	// as "1-0", "0-1" or "1/2-1/2". It returns ErrTablebaseMiss for positions
+	// the tablebase doesn't cover.
+	Probe(ctx context.Context, fen string) (string, error)
+}
+
+// LichessTablebaseURL is the endpoint of the public Lichess tablebase for standard chess
+const LichessTablebaseURL = "https://tablebase.lichess.ovh/standard"
+
+// maxTablebasePieces is the most pieces, kings included, the Lichess tablebase covers
+const maxTablebasePieces = 7
+
+// LichessTablebase probes the Lichess tablebase HTTP API
+type LichessTablebase struct {
+	Client *http.Client
+	URL    string
+}
+
+// NewLichessTablebase returns a client for the public Lichess tablebase
+func NewLichessTablebase() *LichessTablebase {
+	return &LichessTablebase{
+		Client: &http.Client{Timeout: 10 * time.Second},
+		URL:    LichessTablebaseURL,
+	}
+}
+
+// Probe implements Tablebase
+func (t *LichessTablebase) Probe(ctx context.Context, fen string) (string, error) {
+	placement, _, _ := strings.Cut(fen, " ")
+	pieces := 0
+	for _, r := range placement {
+		if strings.ContainsRune("pnbrqkPNBRQK", r) {
+			pieces++
+		}
+	}
+	if pieces > maxTablebasePieces {
+		return "", fmt.Errorf("%w: %d pieces", ErrTablebaseMiss, pieces)
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, t.URL+"?fen="+url.QueryEscape(fen), nil)
+	if err != nil {
+		return "", err
+	}
+	response, err := t.Client.Do(request)
+	if err != nil {
+		return "", fmt.Errorf("probing tablebase: %w", err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("probing tablebase: %s", response.Status)
+	}
+
+	var body struct {
+		Category string `json:"category"`
+	}
+	if err := json.NewDecoder(response.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("probing tablebase: %w", err)
+	}
+	whiteToMove := !strings.Contains(fen, " b ")
+	// Cursed wins and blessed losses are drawn under the 50 move rule
+	switch body.Category {
+	case "win":
+		return sideToMoveResult(whiteToMove, true), nil
+	case "loss":
+		return sideToMoveResult(whiteToMove, false), nil
+	case "draw", "cursed-win", "blessed-loss":
+		return "1/2-1/2", nil
+	default:
+		return "", fmt.Errorf("%w: category %q", ErrTablebaseMiss, body.Category)
+	}
+}
+
+// sideToMoveResult returns the game result when the side to move wins or loses
+func sideToMoveResult(whiteToMove, wins bool) string {
+	if whiteToMove == wins {
+		return "1-0"
+	}
+	return "0-1"
+}
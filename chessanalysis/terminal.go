@@ -0,0 +1,86 @@
+package chessanalysis
+
+import (
+	chess "github.com/corentings/chess/v2"
+	"github.com/walterschell/chess-analyzer/chessanalysis/uciengine"
+)
+
+// Ways a move can end the game, see MoveAnalysis.TerminalStatus
+const (
+	TerminalCheckmate            = "checkmate"
+	TerminalStalemate            = "stalemate"
+	TerminalInsufficientMaterial = "insufficient material"
+)
+
+// terminalMethod returns how the game ends in the given position, or
+// chess.NoMethod if play goes on
+func terminalMethod(position *chess.Position) chess.Method {
+	if status := position.Status(); status != chess.NoMethod {
+		return status
+	}
+	// Insufficient material is only detected by a game in the position
+	fenOpt, err := chess.FEN(position.String())
+	if err != nil {
+		return chess.NoMethod
+	}
+	if chess.NewGame(fenOpt).Method() == chess.InsufficientMaterial {
+		return chess.InsufficientMaterial
+	}
+	return chess.NoMethod
+}
+
+// terminalStatus returns the MoveAnalysis.TerminalStatus of a game ending
+func terminalStatus(method chess.Method) string {
+	switch method {
+	case chess.Checkmate:
+		return TerminalCheckmate
+	case chess.Stalemate:
+		return TerminalStalemate
+	case chess.InsufficientMaterial:
+		return TerminalInsufficientMaterial
+	}
+	return ""
+}
+
+// checkmateResult scores a move that checkmates, which is always the best
+// move, without asking the engine. The mate counts as found at the given
+// depth.
+func checkmateResult(move, color string, depth int) *AnalysisResult {
+	// The mover has mated, which is a mate in 0 from their perspective
+	score, win, loss := uciengine.MateIn(0), 1.0, 0.0
+	if color == "Black" {
+		score, win, loss = score.Negate(), loss, win
+	}
+	return &AnalysisResult{
+		WhiteScore:            score,
+		WhiteWinProb:          win,
+		WhiteLossProb:         loss,
+		BestMove:              move,
+		BestMoveWhiteScore:    score,
+		BestMoveWhiteWinProb:  win,
+		BestMoveWhiteLossProb: loss,
+		Depth:                 depth,
+		PlayedLine:            []string{move},
+		BestLine:              []string{move},
+		TopMoves:              []string{move},
+		TopScores:             []Score{uciengine.MateIn(0)},
+	}
+}
+
+// analyzeDrawingMove scores a move that ends the game in a draw. Only the
+// position before the move is searched, for the best move; the played move
+// is scored as the draw it is.
+func analyzeDrawingMove(engine Engine, fenBefore, move string, limits SearchLimits) (*AnalysisResult, error) {
+	result, err := engine.AnalyzePosition(fenBefore, limits)
+	if err != nil {
+		return nil, err
+	}
+	if result.BestMove == move {
+		result.BestMoveWhiteScore = Score{}
+		result.BestMoveWhiteWinProb, result.BestMoveWhiteDrawProb, result.BestMoveWhiteLossProb = 0, 1, 0
+	}
+	result.WhiteScore = Score{}
+	result.WhiteWinProb, result.WhiteDrawProb, result.WhiteLossProb = 0, 1, 0
+	result.PlayedLine = []string{move}
+	return result, nil
+}
@@ -0,0 +1,98 @@
+package chessanalysis
+
+import (
+	"sync/atomic"
+	"testing"
+
+	chess "github.com/corentings/chess/v2"
+	"github.com/walterschell/chess-analyzer/chessanalysis/uciengine"
+)
+
+// Sam Loyd's stalemate in ten moves
+const loydStalematePgn = "[Result \"1/2-1/2\"]\n\n1. e3 a5 2. Qh5 Ra6 3. Qxa5 h5 4. h4 Rah6 5. Qxc7 f6 6. Qxd7+ Kf7 7. Qxb7 Qd3 8. Qxb8 Qh7 9. Qxc8 Kg6 10. Qe6 1/2-1/2"
+
+// lastMoveCountingEngine counts the moves it is asked to search
+type lastMoveCountingEngine struct {
+	Engine
+	searches *atomic.Int32
+}
+
+func (e lastMoveCountingEngine) AnalyzeLastMove(moves []string, limits SearchLimits) (*AnalysisResult, error) {
+	e.searches.Add(1)
+	return e.Engine.AnalyzeLastMove(moves, limits)
+}
+
+func TestCheckmateIsNotSearched(t *testing.T) {
+	var searches atomic.Int32
+	factory := func() (Engine, error) {
+		engine, err := scholarsMateEngine().NewEngine()
+		return lastMoveCountingEngine{Engine: engine, searches: &searches}, err
+	}
+	game, err := AnalyzeGame(scholarsMatePgn, WithDepth(3), WithEngineFactory(factory))
+	if err != nil {
+		t.Fatalf("failed to analyze game: %v", err)
+	}
+	if got := searches.Load(); got != int32(len(game.Moves)-1) {
+		t.Errorf("expected every move but the mate to be searched, got %d searches", got)
+	}
+	mate := game.Moves[len(game.Moves)-1]
+	if mate.TerminalStatus != TerminalCheckmate || !mate.IsBestMove || mate.BestMoveSAN != "Qxf7#" ||
+		mate.WhiteScore != uciengine.MateIn(0) || mate.WhiteWinProb != 1 || mate.Depth != 3 || mate.Classification != Best {
+		t.Errorf("unexpected analysis of the mate %+v", mate)
+	}
+	for _, move := range game.Moves[:len(game.Moves)-1] {
+		if move.TerminalStatus != "" {
+			t.Errorf("expected %s not to end the game, got %q", move.MoveText, move.TerminalStatus)
+		}
+	}
+	if game.Summary.TerminalStatus != TerminalCheckmate {
+		t.Errorf("expected the summary to end in checkmate, got %q", game.Summary.TerminalStatus)
+	}
+}
+
+func TestStalemateScoredAsDraw(t *testing.T) {
+	var searches atomic.Int32
+	factory := func() (Engine, error) {
+		engine, err := (&FakeEngine{}).NewEngine()
+		return lastMoveCountingEngine{Engine: engine, searches: &searches}, err
+	}
+	moves, err := AnalyzeChessGame(loydStalematePgn, WithDepth(3), WithEngineFactory(factory))
+	if err != nil {
+		t.Fatalf("failed to analyze game: %v", err)
+	}
+	if got := searches.Load(); got != int32(len(moves)-1) {
+		t.Errorf("expected only the position before the stalemate to be searched, got %d searches", got)
+	}
+	stalemate := moves[len(moves)-1]
+	if stalemate.MoveText != "Qe6" || stalemate.TerminalStatus != TerminalStalemate ||
+		stalemate.WhiteScore != (Score{}) || stalemate.WhiteDrawProb != 1 || stalemate.BestMove == "" {
+		t.Errorf("unexpected analysis of the stalemate %+v", stalemate)
+	}
+	if summary := Summarize(moves); summary.TerminalStatus != TerminalStalemate {
+		t.Errorf("expected the summary to end in stalemate, got %q", summary.TerminalStatus)
+	}
+}
+
+func TestTerminalMethod(t *testing.T) {
+	tests := []struct {
+		fen  string
+		want chess.Method
+	}{
+		{"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", chess.NoMethod},
+		{"r1bqkb1r/pppp1Qpp/2n2n2/4p3/2B1P3/8/PPPP1PPP/RNB1K1NR b KQkq - 0 4", chess.Checkmate},
+		{"k7/8/1Q6/8/8/8/8/K7 b - - 0 1", chess.Stalemate},
+		{"k7/8/8/8/8/8/8/KB6 b - - 0 1", chess.InsufficientMaterial},
+	}
+	for _, tt := range tests {
+		fenOpt, err := chess.FEN(tt.fen)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := terminalMethod(chess.NewGame(fenOpt).Position()); got != tt.want {
+			t.Errorf("terminalMethod(%q) = %v, want %v", tt.fen, got, tt.want)
+		}
+	}
+	if got := terminalStatus(chess.InsufficientMaterial); got != TerminalInsufficientMaterial {
+		t.Errorf("unexpected status %q", got)
+	}
+}
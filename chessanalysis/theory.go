@@ -0,0 +1,361 @@
+package chessanalysis
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	chess "github.com/corentings/chess/v2"
+	"github.com/walterschell/chess-analyzer/chessanalysis/uciengine"
+)
+
+// Theory is a reference of known opening moves, such as an opening book or a
+// database of master games
+type Theory interface {
+	// Moves returns the known moves in the position given as a FEN, in UCI
+	// notation and most popular first, or nil if the position isn't known
+	Moves(fen string) []string
+}
+
+// TheoryEvaluator is implemented by theory that knows the evaluation of its
+// positions
+type TheoryEvaluator interface {
+	// Evaluate returns the evaluation in pawns from White's point of view of
+	// the position given as a FEN, or false if it isn't known
+	Evaluate(fen string) (float64, bool)
+}
+
+// PolyglotTheory is theory backed by a polyglot opening book
+type PolyglotTheory struct {
+	book   *chess.PolyglotBook
+	hasher *chess.ZobristHasher
+}
+
+// NewPolyglotTheory loads a polyglot opening book
+func NewPolyglotTheory(book []byte) (*PolyglotTheory, error) {
+	loaded, err := chess.LoadFromBytes(book)
+	if err != nil {
+		return nil, fmt.Errorf("loading polyglot book: %w", err)
+	}
+	return &PolyglotTheory{book: loaded, hasher: chess.NewZobristHasher()}, nil
+}
+
+// Moves implements Theory. Book moves are ordered by weight.
+func (t *PolyglotTheory) Moves(fen string) []string {
+	hash, err := t.hasher.HashPosition(fen)
+	if err != nil {
+		return nil
+	}
+	var moves []string
+	for _, entry := range t.book.FindMoves(chess.ZobristHashToUint64(hash)) {
+		move := chess.DecodeMove(entry.Move).ToMove()
+		moves = append(moves, move.String())
+	}
+	return moves
+}
+
+// BookShelf is theory from named polyglot books that can be added, replaced
+// and removed while analyses use it. Moves are looked up in every book, in
+// name order, without repeats.
+type BookShelf struct {
+	lock  sync.RWMutex
+	books map[string]*PolyglotTheory
+}
+
+// NewBookShelf returns an empty shelf
+func NewBookShelf() *BookShelf {
+	return &BookShelf{books: make(map[string]*PolyglotTheory)}
+}
+
+// Put loads a polyglot book onto the shelf under the name, replacing the book
+// of that name, if any. The shelf is unchanged if the book doesn't load.
+func (s *BookShelf) Put(name string, book []byte) error {
+	loaded, err := NewPolyglotTheory(book)
+	if err != nil {
+		return err
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.books[name] = loaded
+	return nil
+}
+
+// Remove takes the book of the name off the shelf, reporting whether there
+// was one
+func (s *BookShelf) Remove(name string) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	_, ok := s.books[name]
+	delete(s.books, name)
+	return ok
+}
+
+// Names returns the names of the books on the shelf, sorted
+func (s *BookShelf) Names() []string {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return slices.Sorted(maps.Keys(s.books))
+}
+
+// Moves implements Theory
+func (s *BookShelf) Moves(fen string) []string {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	var moves []string
+	for _, name := range slices.Sorted(maps.Keys(s.books)) {
+		for _, move := range s.books[name].Moves(fen) {
+			if !slices.Contains(moves, move) {
+				moves = append(moves, move)
+			}
+		}
+	}
+	return moves
+}
+
+// DefaultTheoryPlies is how many plies of each reference game count as theory
+const DefaultTheoryPlies = 30
+
+// PGNTheory is theory built from the opening moves of a database of reference games
+type PGNTheory struct {
+	positions map[string]map[string]int // Move counts by position
+	evals     map[string]float64        // Evaluations by position, from %eval comments
+}
+
+// NewPGNTheory builds theory from the first maxPlies plies of each game in the
+// PGN database. Positions reached by theory moves annotated with a [%eval]
+// comment, as in Lichess exports, are evaluated.
+func NewPGNTheory(pgn string, maxPlies int) (*PGNTheory, error) {
+	games, err := SplitPGN(pgn)
+	if err != nil {
+		return nil, err
+	}
+	theory := &PGNTheory{positions: make(map[string]map[string]int), evals: make(map[string]float64)}
+	for i, text := range games {
+		pgnOpt, err := chess.PGN(strings.NewReader(text))
+		if err != nil {
+			return nil, fmt.Errorf("%w: reference game %d: %v", ErrInvalidPGN, i+1, err)
+		}
+		game := chess.NewGame(pgnOpt)
+		for ply, move := range game.Moves() {
+			if ply >= maxPlies {
+				break
+			}
+			before := move.Parent().Position()
+			key := theoryKey(before.String())
+			if theory.positions[key] == nil {
+				theory.positions[key] = make(map[string]int)
+			}
+			theory.positions[key][moveToUci(before, move)]++
+			if eval, ok := move.GetCommand("eval"); ok {
+				if score, err := strconv.ParseFloat(eval, 64); err == nil {
+					theory.evals[theoryKey(move.Position().String())] = score
+				}
+			}
+		}
+	}
+	return theory, nil
+}
+
+// theoryKey identifies a position by its piece placement, side to move and
+// castling rights. The en passant field is left out since FENs disagree on
+// whether to record it when no capture is possible.
+func theoryKey(fen string) string {
+	fields := strings.Fields(fen)
+	if len(fields) > 3 {
+		fields = fields[:3]
+	}
+	return strings.Join(fields, " ")
+}
+
+// Moves implements Theory. Moves are ordered by how many games played them.
+func (t *PGNTheory) Moves(fen string) []string {
+	counts := t.positions[theoryKey(fen)]
+	moves := make([]string, 0, len(counts))
+	for move := range counts {
+		moves = append(moves, move)
+	}
+	slices.SortFunc(moves, func(a, b string) int {
+		if counts[a] != counts[b] {
+			return counts[b] - counts[a]
+		}
+		return strings.Compare(a, b)
+	})
+	if len(moves) == 0 {
+		return nil
+	}
+	return moves
+}
+
+// Evaluate implements TheoryEvaluator. Mate scores aren't recorded.
+func (t *PGNTheory) Evaluate(fen string) (float64, bool) {
+	score, ok := t.evals[theoryKey(fen)]
+	return score, ok
+}
+
+// analyzeBookMove fills in the evaluation of a book move in place of an
+// engine search. The evaluation before the move is kept unless theory knows
+// the position after it.
+func analyzeBookMove(move *MoveAnalysis, theory Theory) {
+	move.WhiteScore = move.PreviousWhiteScore
+	move.WhiteWinProb = move.PreviousWhiteWinProb
+	move.WhiteDrawProb = move.PreviousWhiteDrawProb
+	move.WhiteLossProb = move.PreviousWhiteLossProb
+	if evaluator, ok := theory.(TheoryEvaluator); ok {
+		if score, ok := evaluator.Evaluate(move.FENAfter); ok {
+			move.WhiteScore = uciengine.Pawns(score)
+			move.WhiteWinProb, move.WhiteDrawProb, move.WhiteLossProb = scoreWDL(move.WhiteScore)
+		}
+	}
+	move.Accuracy = 100
+	move.Classification = Book
+}
+
+// Novelty is the first move of a game that left known theory
+type Novelty struct {
+	Ply            int    `json:"ply"` // Index of the move within the game
+	Move           string `json:"move"`
+	WhiteScore     Score  `json:"whiteScore"`
+	Classification string `json:"classification"`
+	// TheoryMoves are the known moves in the position in SAN, most popular first
+	TheoryMoves []string `json:"theoryMoves"`
+	// ReferenceLine is the theory line the game deviated from, e.g. "1. e4 e5 2. Nf3 Nc6 3. Bb5"
+	ReferenceLine string `json:"referenceLine"`
+}
+
+// FindNovelty returns the first move that deviated from theory in a position
+// theory knows, or nil if the game never left theory or left known positions
+// some other way, e.g. by starting from a position theory doesn't know
+func FindNovelty(moves []MoveAnalysis, theory Theory) *Novelty {
+	ply, theoryMoves, ok := firstDeviation(moves, theory)
+	if !ok {
+		return nil
+	}
+	move := &moves[ply]
+	return &Novelty{
+		Ply:            ply,
+		Move:           MoveLabel(move),
+		WhiteScore:     move.WhiteScore,
+		Classification: move.Classification.String(),
+		TheoryMoves:    theoryMoves,
+		ReferenceLine:  referenceLine(moves, ply, theoryMoves),
+	}
+}
+
+// firstDeviation finds the first move played in a position theory knows that
+// isn't one of the known moves, returning its index and the known moves in
+// SAN. It reports false if there is no such move before the game leaves the
+// known positions.
+func firstDeviation(moves []MoveAnalysis, theory Theory) (int, []string, bool) {
+	for i := range moves {
+		known, followed, ok := checkTheory(&moves[i], theory)
+		if !ok || len(known) == 0 {
+			return 0, nil, false
+		}
+		if !followed {
+			return i, known, true
+		}
+	}
+	return 0, nil, false
+}
+
+// checkTheory returns the known moves in SAN for the position before the
+// move, which are empty if theory doesn't know the position, and whether the
+// move played is one of them. It reports false if the move can't be decoded.
+func checkTheory(move *MoveAnalysis, theory Theory) ([]string, bool, bool) {
+	known := theory.Moves(move.FENBefore)
+	if len(known) == 0 {
+		return nil, false, true
+	}
+	position, err := positionFromFEN(move.FENBefore)
+	if err != nil {
+		return nil, false, false
+	}
+	played, err := chess.AlgebraicNotation{}.Decode(position, move.MoveText)
+	if err != nil {
+		return nil, false, false
+	}
+	knownSans := make([]string, 0, len(known))
+	for _, uci := range known {
+		knownSans = append(knownSans, uciLineToSan(position, []string{uci})...)
+	}
+	return knownSans, slices.Contains(known, moveToUci(position, played)), true
+}
+
+// BookExit is the first move a player made outside the opening book
+type BookExit struct {
+	Ply        int    `json:"ply"` // Index of the move within the game
+	Move       string `json:"move"`
+	WhiteScore Score  `json:"whiteScore"` // Evaluation after the move
+	// BookMoves are the book moves the player declined in SAN, most popular
+	// first. They are empty if the opponent had already left the book.
+	BookMoves []string `json:"bookMoves,omitempty"`
+}
+
+// FindBookExits returns the first move each player made outside the book, or
+// nil for a player who stayed in the book for the whole game
+func FindBookExits(moves []MoveAnalysis, theory Theory) (white, black *BookExit) {
+	for i := range moves {
+		move := &moves[i]
+		exit := &white
+		if move.Color == "Black" {
+			exit = &black
+		}
+		if *exit != nil {
+			continue
+		}
+		known, followed, ok := checkTheory(move, theory)
+		if !ok || followed {
+			continue
+		}
+		*exit = &BookExit{
+			Ply:        i,
+			Move:       MoveLabel(move),
+			WhiteScore: move.WhiteScore,
+			BookMoves:  known,
+		}
+		if white != nil && black != nil {
+			break
+		}
+	}
+	return white, black
+}
+
+// referenceLine formats the moves played before the deviation at ply followed
+// by the first known move, e.g. "1. e4 e5 2. Nf3"
+func referenceLine(moves []MoveAnalysis, ply int, known []string) string {
+	line := make([]string, 0, ply+1)
+	for i := range moves[:ply] {
+		line = append(line, moves[i].MoveText)
+	}
+	if len(known) > 0 {
+		line = append(line, known[0])
+	}
+	return FormatLine(moves[0].MoveNumber, moves[0].Color, line)
+}
+
+// FormatLine formats SAN moves starting at the given move number and color,
+// e.g. "1. e4 e5 2. Nf3" or "4... Nf6 5. d3"
+func FormatLine(moveNumber int, color string, sans []string) string {
+	var b strings.Builder
+	black := color == "Black"
+	for i, san := range sans {
+		if i > 0 {
+			b.WriteString(" ")
+		}
+		switch {
+		case !black:
+			fmt.Fprintf(&b, "%d. ", moveNumber)
+		case i == 0:
+			fmt.Fprintf(&b, "%d... ", moveNumber)
+		}
+		b.WriteString(san)
+		if black {
+			moveNumber++
+		}
+		black = !black
+	}
+	return b.String()
+}
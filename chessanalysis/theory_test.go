@@ -0,0 +1,189 @@
+package chessanalysis
+
+import (
+	"encoding/binary"
+	"reflect"
+	"testing"
+
+	"github.com/walterschell/chess-analyzer/chessanalysis/uciengine"
+)
+
+const referenceGames = `
+[Event "Reference 1"]
+
+1. e4 e5 2. Nf3 Nc6 3. Bb5 a6 1-0
+
+[Event "Reference 2"]
+
+1. e4 e5 2. Nf3 Nc6 3. Bb5 Nf6 1/2-1/2
+
+[Event "Reference 3"]
+
+1. e4 c5 2. Nf3 0-1
+`
+
+func TestPGNTheoryNovelty(t *testing.T) {
+	theory, err := NewPGNTheory(referenceGames, DefaultTheoryPlies)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if moves := theory.Moves("rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq - 0 1"); !reflect.DeepEqual(moves, []string{"e7e5", "c7c5"}) {
+		t.Errorf("unexpected theory after 1. e4: %v", moves)
+	}
+
+	game, err := AnalyzeGame(scholarsMatePgn, WithEngineFactory(scholarsMateEngine().NewEngine), WithTheory(theory))
+	if err != nil {
+		t.Fatal(err)
+	}
+	novelty := game.Novelty
+	if novelty == nil {
+		t.Fatal("expected a novelty")
+	}
+	if novelty.Ply != 2 || novelty.Move != "2. Qh5" || !reflect.DeepEqual(novelty.TheoryMoves, []string{"Nf3"}) {
+		t.Errorf("unexpected novelty %+v", novelty)
+	}
+	if novelty.ReferenceLine != "1. e4 e5 2. Nf3" {
+		t.Errorf("unexpected reference line %q", novelty.ReferenceLine)
+	}
+
+	// A game that stays within theory has no novelty
+	inTheory := []MoveAnalysis{game.Moves[0], game.Moves[1]}
+	if novelty := FindNovelty(inTheory, theory); novelty != nil {
+		t.Errorf("expected no novelty, got %+v", novelty)
+	}
+}
+
+func TestFindBookExits(t *testing.T) {
+	theory, err := NewPGNTheory(referenceGames, DefaultTheoryPlies)
+	if err != nil {
+		t.Fatal(err)
+	}
+	game, err := AnalyzeGame(scholarsMatePgn, WithEngineFactory(scholarsMateEngine().NewEngine), WithTheory(theory))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	white := game.Summary.White.BookExit
+	if white == nil || white.Ply != 2 || white.Move != "2. Qh5" || !reflect.DeepEqual(white.BookMoves, []string{"Nf3"}) {
+		t.Errorf("unexpected book exit for White: %+v", white)
+	}
+	if white != nil && white.WhiteScore != game.Moves[2].WhiteScore {
+		t.Errorf("expected the evaluation after 2. Qh5, got %v", white.WhiteScore)
+	}
+	// Black was out of book once White left it
+	black := game.Summary.Black.BookExit
+	if black == nil || black.Ply != 3 || black.Move != "2... Nc6" || len(black.BookMoves) != 0 {
+		t.Errorf("unexpected book exit for Black: %+v", black)
+	}
+
+	white, black = FindBookExits(game.Moves[:2], theory)
+	if white != nil || black != nil {
+		t.Errorf("expected no book exits within theory, got %+v and %+v", white, black)
+	}
+}
+
+func TestSkipBook(t *testing.T) {
+	theory, err := NewPGNTheory(`
+[Event "Reference"]
+
+1. e4 { [%eval 0.3] } e5 { [%eval 0.25] } 2. Nf3 Nc6 1-0
+`, DefaultTheoryPlies)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if score, ok := theory.Evaluate("rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq e3 0 1"); !ok || score != 0.3 {
+		t.Errorf("expected an evaluation of 0.3 after 1. e4, got %.2f (%t)", score, ok)
+	}
+
+	moves, err := AnalyzeChessGame(scholarsMatePgn, WithEngineFactory(scholarsMateEngine().NewEngine), WithTheory(theory), WithSkipBook())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for ply, score := range []float64{0.3, 0.25} {
+		move := &moves[ply]
+		if move.Classification != Book || move.WhiteScore != uciengine.Pawns(score) || move.Depth != 0 || move.Accuracy != 100 {
+			t.Errorf("expected %s to be an unsearched book move evaluated at %.2f, got %+v", move.MoveText, score, move)
+		}
+	}
+	// 2. Qh5 left the book, so it was searched starting from the book evaluation
+	if move := &moves[2]; move.Classification == Book || move.Depth == 0 || move.PreviousWhiteScore != uciengine.Pawns(0.25) {
+		t.Errorf("expected 2. Qh5 to be searched, got %+v", move)
+	}
+}
+
+func TestPolyglotTheory(t *testing.T) {
+	// Polyglot moves pack the destination and origin squares as file | rank<<3
+	square := func(file, rank uint16) uint16 { return file | rank<<3 }
+	entry := func(from, to, weight uint16) []byte {
+		data := make([]byte, 16)
+		binary.BigEndian.PutUint64(data, 0x463b96181691fc9c) // Starting position
+		binary.BigEndian.PutUint16(data[8:], to|from<<6)
+		binary.BigEndian.PutUint16(data[10:], weight)
+		return data
+	}
+	book := append(entry(square(3, 1), square(3, 3), 5), entry(square(4, 1), square(4, 3), 10)...)
+
+	theory, err := NewPolyglotTheory(book)
+	if err != nil {
+		t.Fatal(err)
+	}
+	moves := theory.Moves("rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1")
+	if !reflect.DeepEqual(moves, []string{"e2e4", "d2d4"}) {
+		t.Errorf("unexpected book moves %v", moves)
+	}
+	if moves := theory.Moves("rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq - 0 1"); moves != nil {
+		t.Errorf("expected no book moves after 1. e4, got %v", moves)
+	}
+}
+
+func TestBookShelf(t *testing.T) {
+	entry := func(move uint16) []byte {
+		data := make([]byte, 16)
+		binary.BigEndian.PutUint64(data, 0x463b96181691fc9c) // Starting position
+		binary.BigEndian.PutUint16(data[8:], move)
+		binary.BigEndian.PutUint16(data[10:], 1)
+		return data
+	}
+	const start = "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1"
+	e4, d4 := uint16(28|12<<6), uint16(27|11<<6)
+
+	shelf := NewBookShelf()
+	if moves := shelf.Moves(start); moves != nil {
+		t.Errorf("expected an empty shelf to know no moves, got %v", moves)
+	}
+	if err := shelf.Put("a", entry(e4)); err != nil {
+		t.Fatal(err)
+	}
+	if err := shelf.Put("b", append(entry(d4), entry(e4)...)); err != nil {
+		t.Fatal(err)
+	}
+	if moves := shelf.Moves(start); !reflect.DeepEqual(moves, []string{"e2e4", "d2d4"}) {
+		t.Errorf("expected the moves of both books, got %v", moves)
+	}
+
+	// A book that doesn't load leaves the one it would replace in place
+	if err := shelf.Put("a", []byte("not a book")); err == nil {
+		t.Error("expected an invalid book to be rejected")
+	}
+	if err := shelf.Put("b", entry(d4)); err != nil {
+		t.Fatal(err)
+	}
+	if moves := shelf.Moves(start); !reflect.DeepEqual(moves, []string{"e2e4", "d2d4"}) {
+		t.Errorf("unexpected moves after replacing a book: %v", moves)
+	}
+	if !shelf.Remove("a") || shelf.Remove("a") || !reflect.DeepEqual(shelf.Names(), []string{"b"}) {
+		t.Errorf("expected only book b to be left, got %v", shelf.Names())
+	}
+	if moves := shelf.Moves(start); !reflect.DeepEqual(moves, []string{"d2d4"}) {
+		t.Errorf("unexpected moves after removing a book: %v", moves)
+	}
+}
+
+func TestFormatLine(t *testing.T) {
+	if line := FormatLine(1, "White", []string{"e4", "e5", "Nf3"}); line != "1. e4 e5 2. Nf3" {
+		t.Errorf("unexpected line %q", line)
+	}
+	if line := FormatLine(4, "Black", []string{"Nf6", "d3"}); line != "4... Nf6 5. d3" {
+		t.Errorf("unexpected line %q", line)
+	}
+}
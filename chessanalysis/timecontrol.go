@@ -0,0 +1,164 @@
+package chessanalysis
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TimeControlStage is a period of a game's time control, as the PGN
+// TimeControl tag gives them: "40/5400+30" is 40 moves in 90 minutes with
+// 30 seconds added per move, "1800" the rest of the game in 30 minutes, and
+// "*180" a sandclock of 3 minutes
+type TimeControlStage struct {
+	Moves            int  `json:"moves,omitempty"` // Moves to make in the period; 0 for the rest of the game
+	BaseSeconds      int  `json:"baseSeconds"`
+	IncrementSeconds int  `json:"incrementSeconds,omitempty"`
+	Sandclock        bool `json:"sandclock,omitempty"`
+}
+
+// TimeControl is a game's time control, parsed from its TimeControl tag
+type TimeControl struct {
+	Tag      string              `json:"tag"`
+	Category TimeControlCategory `json:"category"` // From the first stage, see ParseTimeControl
+	Stages   []TimeControlStage  `json:"stages"`
+}
+
+// ParseTimeControlTag parses a PGN TimeControl tag into its stages, which are
+// separated by colons, as in "40/7200:3600". It fails for tags without a time
+// control, such as "?" for an unknown one and "-" for none.
+func ParseTimeControlTag(tag string) (*TimeControl, error) {
+	tag = strings.TrimSpace(tag)
+	if tag == "" || tag == "?" || tag == "-" {
+		return nil, fmt.Errorf("no time control in %q", tag)
+	}
+	control := &TimeControl{Tag: tag}
+	for _, field := range strings.Split(tag, ":") {
+		stage, err := parseTimeControlStage(field)
+		if err != nil {
+			return nil, fmt.Errorf("invalid time control %q: %w", tag, err)
+		}
+		control.Stages = append(control.Stages, stage)
+	}
+	control.Category = control.Stages[0].category()
+	return control, nil
+}
+
+// parseTimeControlStage parses a stage of a TimeControl tag
+func parseTimeControlStage(field string) (TimeControlStage, error) {
+	var stage TimeControlStage
+	if rest, ok := strings.CutPrefix(field, "*"); ok {
+		stage.Sandclock, field = true, rest
+	}
+	if moves, rest, ok := strings.Cut(field, "/"); ok {
+		n, err := strconv.Atoi(moves)
+		if err != nil || n <= 0 {
+			return stage, fmt.Errorf("invalid number of moves %q", moves)
+		}
+		stage.Moves, field = n, rest
+	}
+	base, increment, hasIncrement := strings.Cut(field, "+")
+	seconds, err := strconv.Atoi(base)
+	if err != nil || seconds < 0 {
+		return stage, fmt.Errorf("invalid base time %q", base)
+	}
+	stage.BaseSeconds = seconds
+	if hasIncrement {
+		if stage.IncrementSeconds, err = strconv.Atoi(increment); err != nil || stage.IncrementSeconds < 0 {
+			return stage, fmt.Errorf("invalid increment %q", increment)
+		}
+	}
+	return stage, nil
+}
+
+// estimatedGame returns how long a 40 move game lasts for each player in
+// the stage, as the Lichess speed classes are measured
+func (s TimeControlStage) estimatedGame() time.Duration {
+	return time.Duration(s.BaseSeconds+40*s.IncrementSeconds) * time.Second
+}
+
+// category classifies the stage following the Lichess boundaries
+func (s TimeControlStage) category() TimeControlCategory {
+	switch estimated := s.estimatedGame(); {
+	case estimated < 3*time.Minute:
+		return Bullet
+	case estimated < 8*time.Minute:
+		return Blitz
+	case estimated < 25*time.Minute:
+		return Rapid
+	default:
+		return Classical
+	}
+}
+
+// Bounds of the time trouble threshold of a time control
+const minTimeTroubleThreshold = 10 * time.Second
+
+// TimeTroubleThreshold returns the remaining time below which a player of
+// the time control is short of time: a tenth of a 40 move game in the first
+// stage, from 10 seconds up to DefaultClockThreshold. Two minutes are
+// plenty in bullet, where the whole game takes less, but little in
+// classical chess.
+func (c *TimeControl) TimeTroubleThreshold() time.Duration {
+	threshold := c.Stages[0].estimatedGame() / 10
+	return max(minTimeTroubleThreshold, min(DefaultClockThreshold, threshold))
+}
+
+// MarshalText encodes the category by its name, such as "Blitz"
+func (c TimeControlCategory) MarshalText() ([]byte, error) {
+	return []byte(c.String()), nil
+}
+
+// UnmarshalText decodes a category encoded by MarshalText
+func (c *TimeControlCategory) UnmarshalText(text []byte) error {
+	index := slices.Index(timeControlCategoryNames, string(text))
+	if index < 0 {
+		return fmt.Errorf("unknown time control category %q", text)
+	}
+	*c = TimeControlCategory(index)
+	return nil
+}
+
+// DefaultTimeControlProfiles classify bullet games with the beginner profile,
+// as moves made in a second or two can't be held to the standard of those
+// thought over, and the other speeds with DefaultClassifierProfile
+var DefaultTimeControlProfiles = map[TimeControlCategory]string{
+	Bullet: "beginner",
+}
+
+// WithTimeControlProfiles classifies the moves of games with a TimeControl
+// tag with the classifier profile profiles gives their speed class, such as
+// DefaultTimeControlProfiles, when no profile is given with
+// WithClassifierProfile. Other games are classified with the MoveClassifier.
+// The profile used is recorded in the game's
+// EffectiveOptions.ClassifierProfile.
+func WithTimeControlProfiles(profiles map[TimeControlCategory]string) AnalyzeChessGameOption {
+	return func(opts *AnalyzeChessGameOptions) {
+		opts.TimeControlProfiles = profiles
+	}
+}
+
+// timeControlProfile returns the name of the profile the time control
+// profiles give a game with the headers, or "" if they give none
+func timeControlProfile(profiles map[TimeControlCategory]string, headers map[string]string) string {
+	control, err := ParseTimeControlTag(headers["TimeControl"])
+	if err != nil {
+		return ""
+	}
+	return profiles[control.Category]
+}
+
+// gameTimeTroubleThreshold returns the time trouble threshold of a game with
+// the headers: threshold if given, or that of the game's time control
+func gameTimeTroubleThreshold(threshold time.Duration, headers map[string]string) time.Duration {
+	if threshold > 0 {
+		return threshold
+	}
+	control, err := ParseTimeControlTag(headers["TimeControl"])
+	if err != nil {
+		return DefaultClockThreshold
+	}
+	return control.TimeTroubleThreshold()
+}
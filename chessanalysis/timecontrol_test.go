@@ -0,0 +1,105 @@
+package chessanalysis
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseTimeControlTag(t *testing.T) {
+	tests := map[string][]TimeControlStage{
+		"180+2":              {{BaseSeconds: 180, IncrementSeconds: 2}},
+		"40/7200:3600":       {{Moves: 40, BaseSeconds: 7200}, {BaseSeconds: 3600}},
+		"40/5400+30:1800+30": {{Moves: 40, BaseSeconds: 5400, IncrementSeconds: 30}, {BaseSeconds: 1800, IncrementSeconds: 30}},
+		"*180":               {{BaseSeconds: 180, Sandclock: true}},
+	}
+	for tag, want := range tests {
+		control, err := ParseTimeControlTag(tag)
+		if err != nil || !reflect.DeepEqual(control.Stages, want) {
+			t.Errorf("ParseTimeControlTag(%q) = %+v, %v; want stages %+v", tag, control, err, want)
+		}
+	}
+	for _, tag := range []string{"", "?", "-", "abc", "180+", "0/60", "40/7200:", "-60"} {
+		if control, err := ParseTimeControlTag(tag); err == nil {
+			t.Errorf("ParseTimeControlTag(%q) = %+v, want an error", tag, control)
+		}
+	}
+}
+
+func TestTimeControlTimeTroubleThreshold(t *testing.T) {
+	tests := map[string]time.Duration{
+		"60":           10 * time.Second,
+		"180+2":        26 * time.Second,
+		"600":          time.Minute,
+		"40/7200:3600": DefaultClockThreshold,
+	}
+	for tag, want := range tests {
+		control, err := ParseTimeControlTag(tag)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := control.TimeTroubleThreshold(); got != want {
+			t.Errorf("time trouble threshold of %q = %v, want %v", tag, got, want)
+		}
+	}
+}
+
+func TestTimeControlJSON(t *testing.T) {
+	control, err := ParseTimeControlTag("180+2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(control)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"tag":"180+2","category":"Blitz","stages":[{"baseSeconds":180,"incrementSeconds":2}]}`; string(data) != want {
+		t.Errorf("got %s, want %s", data, want)
+	}
+	var decoded TimeControl
+	if err := json.Unmarshal(data, &decoded); err != nil || !reflect.DeepEqual(&decoded, control) {
+		t.Errorf("round trip gave %+v, %v", decoded, err)
+	}
+	if err := json.Unmarshal([]byte(`{"category":"Hyperbullet"}`), &decoded); err == nil {
+		t.Error("expected an unknown category to fail")
+	}
+}
+
+func TestAnalyzeChessGameTimeControl(t *testing.T) {
+	pgn := `[White "Player 1"]
+[Black "Player 2"]
+[TimeControl "60"]
+
+1. e4 {[%clk 0:01:00]} e5 {[%clk 0:00:09]} 2. Qh5 Nc6 3. Bc4 Nf6 4. Qxf7# 1-0`
+	opts := []AnalyzeChessGameOption{WithEngineFactory(scholarsMateEngine().NewEngine), WithTimeControlProfiles(DefaultTimeControlProfiles)}
+	game, err := AnalyzeGame(pgn, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if game.TimeControl == nil || game.TimeControl.Category != Bullet {
+		t.Fatalf("expected a bullet time control, got %+v", game.TimeControl)
+	}
+	// Two minutes would put the whole of a one minute game in time trouble
+	if game.Moves[0].TimeTrouble || !game.Moves[1].TimeTrouble || game.Options.TimeTroubleThreshold != 10*time.Second {
+		t.Errorf("expected only 1... e5 in time trouble under 10s, got %v, %v and %v",
+			game.Moves[0].TimeTrouble, game.Moves[1].TimeTrouble, game.Options.TimeTroubleThreshold)
+	}
+	if game.Options.ClassifierProfile != "beginner" || game.Options.TimeControlProfiles["Bullet"] != "beginner" {
+		t.Errorf("expected the beginner profile for bullet, got %+v", game.Options)
+	}
+
+	// A profile given outranks that of the speed class
+	game, err = AnalyzeGame(pgn, append(opts, WithClassifierProfile("expert"))...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if game.Options.ClassifierProfile != "expert" {
+		t.Errorf("expected the expert profile, got %q", game.Options.ClassifierProfile)
+	}
+
+	if _, err := AnalyzeChessGame(pgn, WithEngineFactory(scholarsMateEngine().NewEngine),
+		WithTimeControlProfiles(map[TimeControlCategory]string{Blitz: "grandmaster"})); err == nil {
+		t.Error("expected an unknown profile to be rejected")
+	}
+}
@@ -0,0 +1,133 @@
+package chessanalysis
+
+import (
+	"encoding/json"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+)
+
+// TournamentPlayer is one player's standing and aggregate move quality in a
+// tournament
+type TournamentPlayer struct {
+	Name     string  `json:"name"`
+	Games    int     `json:"games"`
+	Points   float64 `json:"points"` // From the games with a result
+	Accuracy float64 `json:"accuracy"`
+	ACPL     float64 `json:"acpl"`
+	Blunders int     `json:"blunders"`
+	// AverageOpponentElo is the mean of the opponents' WhiteElo or BlackElo
+	// tags, over the games that have them, or 0 if none do
+	AverageOpponentElo int `json:"averageOpponentElo"`
+	// AverageOpponentEstimate is the mean of the opponents' ratings as
+	// estimated from their moves, see EstimateRating
+	AverageOpponentEstimate int `json:"averageOpponentEstimate"`
+	// Results are the player's results against each player, in the order of
+	// Tournament.Players: one character per game, "1", "½" or "0", with "*"
+	// for unfinished games, and "" against players they didn't meet
+	Results []string `json:"results"`
+}
+
+// Tournament is the crosstable of a tournament's games, with the players
+// ranked by points
+type Tournament struct {
+	Event   string             `json:"event,omitempty"`
+	Games   int                `json:"games"`
+	Players []TournamentPlayer `json:"players"`
+}
+
+// resultSymbol returns how a crosstable shows a game's result for a player
+func resultSymbol(game *GameAnalysis, color string) string {
+	score, ok := game.PlayerScore(color)
+	switch {
+	case !ok:
+		return "*"
+	case score == 1:
+		return "1"
+	case score == 0:
+		return "0"
+	default:
+		return "½"
+	}
+}
+
+// NewTournament builds the crosstable of a tournament from its analyzed
+// games. Players are told apart by the White and Black tags.
+func NewTournament(games []*GameAnalysis) *Tournament {
+	type standing struct {
+		TournamentPlayer
+		summary                 PlayerSummary
+		elo, eloGames           int
+		estimate, estimateGames int
+		results                 map[string]string
+	}
+	standings := make(map[string]*standing)
+	var order []string
+	player := func(name string) *standing {
+		s, ok := standings[name]
+		if !ok {
+			s = &standing{TournamentPlayer: TournamentPlayer{Name: name}, results: make(map[string]string)}
+			standings[name] = s
+			order = append(order, name)
+		}
+		return s
+	}
+
+	tournament := &Tournament{Games: len(games)}
+	for _, game := range games {
+		if tournament.Event == "" {
+			tournament.Event = game.Headers["Event"]
+		}
+		names := map[string]string{"White": game.Headers["White"], "Black": game.Headers["Black"]}
+		for _, colors := range [][2]string{{"White", "Black"}, {"Black", "White"}} {
+			color, opponentColor := colors[0], colors[1]
+			s := player(names[color])
+			s.Games++
+			if score, ok := game.PlayerScore(color); ok {
+				s.Points += score
+			}
+			s.results[names[opponentColor]] += resultSymbol(game, color)
+			if elo, err := strconv.Atoi(game.Headers[opponentColor+"Elo"]); err == nil && elo > 0 {
+				s.elo += elo
+				s.eloGames++
+			}
+			if opponent := game.Summary.player(opponentColor); opponent.Moves > 0 {
+				s.estimate += opponent.EstimatedRating
+				s.estimateGames++
+			}
+			for i := range game.Moves {
+				if game.Moves[i].Color == color {
+					s.summary.record(&game.Moves[i])
+				}
+			}
+		}
+	}
+
+	sort.SliceStable(order, func(i, j int) bool {
+		return standings[order[i]].Points > standings[order[j]].Points
+	})
+	for _, name := range order {
+		s := standings[name]
+		s.summary.complete()
+		s.Accuracy, s.ACPL, s.Blunders = s.summary.Accuracy, s.summary.ACPL, s.summary.Blunders
+		if s.eloGames > 0 {
+			s.AverageOpponentElo = int(math.Round(float64(s.elo) / float64(s.eloGames)))
+		}
+		if s.estimateGames > 0 {
+			s.AverageOpponentEstimate = int(math.Round(float64(s.estimate) / float64(s.estimateGames)))
+		}
+		for _, opponent := range order {
+			s.Results = append(s.Results, s.results[opponent])
+		}
+		tournament.Players = append(tournament.Players, s.TournamentPlayer)
+	}
+	return tournament
+}
+
+// WriteTournamentJSON writes the crosstable of the games as JSON
+func WriteTournamentJSON(w io.Writer, games ...*GameAnalysis) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(NewTournament(games))
+}
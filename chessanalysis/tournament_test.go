@@ -0,0 +1,56 @@
+package chessanalysis
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestNewTournament(t *testing.T) {
+	games := []*GameAnalysis{
+		testGame("alice", "bob", "1-0", "C50", []string{"e4", "e5"}, map[int]MoveClassification{1: Blunder}),
+		testGame("carol", "alice", "1/2-1/2", "B01", []string{"e4", "d5"}, nil),
+		testGame("bob", "carol", "0-1", "D00", []string{"d4", "d5"}, nil),
+		testGame("alice", "bob", "*", "C50", []string{"e4", "e5"}, nil),
+	}
+	games[0].Headers["Event"] = "Club Championship"
+	games[0].Headers["BlackElo"] = "1500"
+	games[1].Headers["WhiteElo"] = "1700"
+	games[1].Summary.White = PlayerSummary{AccuracyStats: AccuracyStats{Moves: 1}, EstimatedRating: 1800}
+
+	tournament := NewTournament(games)
+	if tournament.Event != "Club Championship" || tournament.Games != 4 || len(tournament.Players) != 3 {
+		t.Fatalf("unexpected tournament %+v", tournament)
+	}
+	var names []string
+	for _, player := range tournament.Players {
+		names = append(names, player.Name)
+	}
+	if want := []string{"alice", "carol", "bob"}; !reflect.DeepEqual(names, want) {
+		t.Fatalf("expected players ranked %v, got %v", want, names)
+	}
+
+	alice := tournament.Players[0]
+	if alice.Games != 3 || alice.Points != 1.5 || !reflect.DeepEqual(alice.Results, []string{"", "½", "1*"}) {
+		t.Errorf("unexpected standing of alice %+v", alice)
+	}
+	if alice.AverageOpponentElo != 1600 || alice.AverageOpponentEstimate != 1800 || alice.Accuracy != 80 {
+		t.Errorf("unexpected aggregates of alice %+v", alice)
+	}
+	if bob := tournament.Players[2]; bob.Points != 0 || bob.Blunders != 1 || !reflect.DeepEqual(bob.Results, []string{"0*", "0", ""}) {
+		t.Errorf("unexpected standing of bob %+v", bob)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteTournamentJSON(&buf, games...); err != nil {
+		t.Fatal(err)
+	}
+	var decoded Tournament
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(&decoded, tournament) {
+		t.Errorf("unexpected tournament after round trip: %s", buf.String())
+	}
+}
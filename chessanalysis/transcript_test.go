@@ -0,0 +1,82 @@
+package chessanalysis
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/walterschell/chess-analyzer/chessanalysis/uciengine"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite golden transcripts in testdata")
+
+const scholarsMateTranscript = "testdata/scholars_mate.uci"
+
+func TestTranscriptRecordAndReplay(t *testing.T) {
+	var transcript bytes.Buffer
+	recording := func() (Engine, error) {
+		return uciengine.NewEngine(uciengine.RecordingLauncher(scholarsMateEngine().launch, &transcript))
+	}
+	recorded, err := AnalyzeChessGame(scholarsMatePgn, WithDepth(3), WithEngineFactory(recording))
+	if err != nil {
+		t.Fatalf("failed to analyze game while recording: %v", err)
+	}
+
+	if *updateGolden {
+		if err := os.WriteFile(scholarsMateTranscript, transcript.Bytes(), 0644); err != nil {
+			t.Fatalf("failed to update golden transcript: %v", err)
+		}
+	}
+
+	replaying := func() (Engine, error) {
+		return uciengine.NewReplayEngine(bytes.NewReader(transcript.Bytes()))
+	}
+	replayed, err := AnalyzeChessGame(scholarsMatePgn, WithDepth(3), WithEngineFactory(replaying))
+	if err != nil {
+		t.Fatalf("failed to analyze game from replay: %v", err)
+	}
+	if !reflect.DeepEqual(recorded, replayed) {
+		t.Errorf("replayed analysis differs from recorded analysis")
+	}
+}
+
+func TestTranscriptGolden(t *testing.T) {
+	results, err := AnalyzeChessGame(scholarsMatePgn, WithDepth(3), WithEngineFactory(uciengine.ReplayEngineFactory(scholarsMateTranscript)))
+	if err != nil {
+		t.Fatalf("failed to analyze game from golden transcript: %v", err)
+	}
+	if len(results) != 7 {
+		t.Fatalf("expected 7 analyzed moves, got %d", len(results))
+	}
+	if results[5].Classification != Blunder {
+		t.Errorf("expected 3...Nf6 to be a blunder, got %s", results[5].Classification)
+	}
+	if !reflect.DeepEqual(results[5].Refutation, []string{"Qxf7#"}) {
+		t.Errorf("expected 3...Nf6 to be refuted by Qxf7#, got %v", results[5].Refutation)
+	}
+}
+
+func TestTranscriptReplayOnOtherMachine(t *testing.T) {
+	// The golden transcript was recorded with another Hash size and Threads,
+	// and the pool resizes the engine once it has started
+	pool := NewEnginePool(1)
+	pool.SetHashMB(64)
+	pool.SetThreads(3)
+	results, err := AnalyzeChessGame(scholarsMatePgn, WithDepth(3),
+		WithEngineFactory(uciengine.ReplayEngineFactory(scholarsMateTranscript)), WithEnginePool(pool, BackgroundPriority))
+	if err != nil || len(results) != 7 {
+		t.Fatalf("expected the transcript to replay with other machine options, got %d moves (%v)", len(results), err)
+	}
+}
+
+func TestTranscriptReplayMismatch(t *testing.T) {
+	replaying := func() (Engine, error) {
+		return uciengine.ReplayEngineFactory(scholarsMateTranscript)()
+	}
+	// A different depth sends different commands than the recording
+	if _, err := AnalyzeChessGame(scholarsMatePgn, WithDepth(5), WithEngineFactory(replaying)); err == nil {
+		t.Error("expected an error replaying a transcript with different commands")
+	}
+}
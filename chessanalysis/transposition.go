@@ -0,0 +1,137 @@
+package chessanalysis
+
+import (
+	"container/list"
+	"sync"
+
+	chess "github.com/corentings/chess/v2"
+)
+
+// SearchCache remembers engine searches by position, move and search limits,
+// so a move played again in a repeated or transposed position isn't searched
+// twice. Positions are identified by their Zobrist hash, which ignores the
+// move clocks. Each analysis uses its own cache unless one is shared with
+// WithSearchCache, as AnalyzeChessGames does for all the games of a database.
+// Once full, the least recently used search makes way for the next. It is
+// safe for concurrent use.
+type SearchCache struct {
+	mu       sync.Mutex
+	hasher   *chess.ZobristHasher
+	size     int
+	searches map[searchKey]*list.Element // Of recent, by key
+	recent   *list.List                  // Of *cachedSearch, most recently used first
+	stats    SearchCacheStats
+}
+
+// DefaultSearchCacheSize is how many searches NewSearchCache keeps, enough
+// for the openings of thousands of games
+const DefaultSearchCacheSize = 100_000
+
+type searchKey struct {
+	position string // Zobrist hash of the position before the move
+	move     string // UCI
+	limits   SearchLimits
+}
+
+type cachedSearch struct {
+	key    searchKey
+	result *AnalysisResult
+	label  string // Move that was searched, e.g. "3. Nf3"
+}
+
+// SearchCacheStats counts the lookups of a SearchCache
+type SearchCacheStats struct {
+	Hits      int `json:"hits"`
+	Misses    int `json:"misses"`
+	Evictions int `json:"evictions"` // Searches dropped to keep the cache to its size
+}
+
+// HitRate returns the percentage of lookups that found an earlier search
+func (s SearchCacheStats) HitRate() float64 {
+	return percentage(s.Hits, s.Hits+s.Misses)
+}
+
+// NewSearchCache creates an empty search cache of DefaultSearchCacheSize
+func NewSearchCache() *SearchCache {
+	return NewSearchCacheSize(DefaultSearchCacheSize)
+}
+
+// NewSearchCacheSize creates an empty search cache keeping at most size
+// searches, at least one
+func NewSearchCacheSize(size int) *SearchCache {
+	return &SearchCache{
+		hasher:   chess.NewZobristHasher(),
+		size:     max(size, 1),
+		searches: make(map[searchKey]*list.Element),
+		recent:   list.New(),
+	}
+}
+
+// Len returns how many searches the cache holds
+func (c *SearchCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.recent.Len()
+}
+
+// Stats returns how many lookups found an earlier search so far
+func (c *SearchCache) Stats() SearchCacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stats
+}
+
+// key identifies the move played from the position given as a FEN. The
+// caller must hold the lock, since the hasher isn't safe for concurrent use.
+func (c *SearchCache) key(fen, move string, limits SearchLimits) (searchKey, bool) {
+	hash, err := c.hasher.HashPosition(fen)
+	if err != nil {
+		return searchKey{}, false
+	}
+	return searchKey{position: hash, move: move, limits: limits}, true
+}
+
+// lookup returns the earlier search of the move played from the position, and
+// the label of the move it was made for. The result reports no search effort
+// since the engine wasn't asked again.
+func (c *SearchCache) lookup(fen, move string, limits SearchLimits) (*AnalysisResult, string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key, ok := c.key(fen, move, limits)
+	if !ok {
+		return nil, "", false
+	}
+	element, ok := c.searches[key]
+	if !ok {
+		c.stats.Misses++
+		return nil, "", false
+	}
+	c.stats.Hits++
+	c.recent.MoveToFront(element)
+	cached := element.Value.(*cachedSearch)
+	result := cached.result.Clone()
+	result.Nodes, result.NPS, result.TimeSpent = 0, 0, 0
+	return result, cached.label, true
+}
+
+// store records the search of the move played from the position
+func (c *SearchCache) store(fen, move string, limits SearchLimits, result *AnalysisResult, label string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key, ok := c.key(fen, move, limits)
+	if !ok {
+		return
+	}
+	if element, ok := c.searches[key]; ok {
+		element.Value = &cachedSearch{key: key, result: result, label: label}
+		c.recent.MoveToFront(element)
+		return
+	}
+	c.searches[key] = c.recent.PushFront(&cachedSearch{key: key, result: result, label: label})
+	for c.recent.Len() > c.size {
+		oldest := c.recent.Back()
+		c.recent.Remove(oldest)
+		delete(c.searches, oldest.Value.(*cachedSearch).key)
+		c.stats.Evictions++
+	}
+}
@@ -0,0 +1,86 @@
+package chessanalysis
+
+import "testing"
+
+func TestRepeatedPositionsReuseSearches(t *testing.T) {
+	const shufflePgn = "[Result \"*\"]\n\n1. Nf3 Nf6 2. Ng1 Ng8 3. Nf3 Nf6 4. e4 *"
+	moves, err := AnalyzeChessGame(shufflePgn, WithDepth(1), WithEngineFactory((&FakeEngine{}).NewEngine))
+	if err != nil {
+		t.Fatal(err)
+	}
+	reused := map[int]string{4: "1. Nf3", 5: "1... Nf6"}
+	for ply := range moves {
+		move := &moves[ply]
+		if move.ReusedFrom != reused[ply] {
+			t.Errorf("expected %s to reuse %q, got %q", MoveLabel(move), reused[ply], move.ReusedFrom)
+		}
+	}
+
+	original, repeated := &moves[0], &moves[4]
+	if repeated.WhiteScore != original.WhiteScore || repeated.BestMove != original.BestMove || repeated.Classification != original.Classification {
+		t.Errorf("expected 3. Nf3 to match 1. Nf3, got %+v and %+v", repeated, original)
+	}
+	if repeated.Depth != original.Depth || repeated.Nodes != 0 {
+		t.Errorf("expected the reused search to keep its depth without reporting nodes, got depth %d and %d nodes", repeated.Depth, repeated.Nodes)
+	}
+}
+
+func TestSearchCacheSharedAcrossGames(t *testing.T) {
+	const database = `
+[Event "King's Knight"]
+[Result "*"]
+
+1. e4 e5 2. Nf3 *
+
+[Event "Bishop's Opening"]
+[Result "*"]
+
+1. e4 e5 2. Bc4 *
+`
+	cache := NewSearchCache()
+	games, err := AnalyzeChessGames(database, WithDepth(1), WithEngineFactory((&FakeEngine{}).NewEngine), WithSearchCache(cache))
+	if err != nil {
+		t.Fatal(err)
+	}
+	second := games[1].Moves
+	if second[0].ReusedFrom != "1. e4" || second[1].ReusedFrom != "1... e5" || second[2].ReusedFrom != "" {
+		t.Errorf("expected the second game to reuse the shared opening, got %q, %q and %q", second[0].ReusedFrom, second[1].ReusedFrom, second[2].ReusedFrom)
+	}
+	if stats := cache.Stats(); stats.Hits != 2 || stats.Misses != 4 || stats.HitRate() != 100.0/3 {
+		t.Errorf("unexpected cache stats %+v", stats)
+	}
+
+	// Searches with other limits aren't reused
+	moves, err := AnalyzeChessGame(database, WithDepth(2), WithEngineFactory((&FakeEngine{}).NewEngine), WithSearchCache(cache))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if moves[0].ReusedFrom != "" {
+		t.Errorf("expected a search at another depth, got one reused from %q", moves[0].ReusedFrom)
+	}
+}
+
+func TestSearchCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	const fen = "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1"
+	limits := SearchLimits{Depth: 1}
+	cache := NewSearchCacheSize(2)
+	cache.store(fen, "e2e4", limits, &AnalysisResult{}, "1. e4")
+	cache.store(fen, "d2d4", limits, &AnalysisResult{}, "1. d4")
+	cache.lookup(fen, "e2e4", limits)
+	cache.store(fen, "c2c4", limits, &AnalysisResult{}, "1. c4")
+
+	if cache.Len() != 2 {
+		t.Errorf("expected the cache to keep to its size, got %d searches", cache.Len())
+	}
+	if _, _, ok := cache.lookup(fen, "d2d4", limits); ok {
+		t.Error("expected the least recently used search to be evicted")
+	}
+	for _, move := range []string{"e2e4", "c2c4"} {
+		if _, _, ok := cache.lookup(fen, move, limits); !ok {
+			t.Errorf("expected the search of %s to be kept", move)
+		}
+	}
+	if stats := cache.Stats(); stats.Evictions != 1 || stats.Hits != 3 || stats.Misses != 1 {
+		t.Errorf("unexpected cache stats %+v", stats)
+	}
+}
@@ -0,0 +1,82 @@
+package chessanalysis
+
+// GameState is who stands better in a position, judged by White's expected score
+type GameState int
+
+const (
+	BlackWinning GameState = iota
+	BlackBetter
+	Equal
+	WhiteBetter
+	WhiteWinning
+)
+
+var gameStateNames = []string{"BlackWinning", "BlackBetter", "Equal", "WhiteBetter", "WhiteWinning"}
+
+func (s GameState) String() string {
+	return gameStateNames[s]
+}
+
+// WinProbBands are the boundaries between game states, as White's expected
+// score (win probability plus half the draw probability) from 0 to 1. The
+// bands are mirrored for Black, so a position where White's expected score is
+// at most 1-Winning is winning for Black.
+type WinProbBands struct {
+	Better  float64 // Expected score from which a side stands better
+	Winning float64 // Expected score from which a side is winning
+}
+
+// DefaultWinProbBands are the bands used for game summaries
+var DefaultWinProbBands = WinProbBands{Better: 0.6, Winning: 0.8}
+
+// state returns the game state for White's win/draw/loss probabilities
+func (b WinProbBands) state(whiteWinProb, whiteDrawProb, whiteLossProb float64) GameState {
+	return b.stateAt(expectedScore("White", whiteWinProb, whiteDrawProb, whiteLossProb) / 100)
+}
+
+// stateAt returns the game state for White's expected score, from 0 to 1
+func (b WinProbBands) stateAt(score float64) GameState {
+	switch {
+	case score >= b.Winning:
+		return WhiteWinning
+	case score >= b.Better:
+		return WhiteBetter
+	case score <= 1-b.Winning:
+		return BlackWinning
+	case score <= 1-b.Better:
+		return BlackBetter
+	default:
+		return Equal
+	}
+}
+
+// TurningPoint is a move after which the game changed state
+type TurningPoint struct {
+	Ply   int    `json:"ply"` // Index of the move within the game
+	Move  string `json:"move"`
+	Color string `json:"color"`
+	From  string `json:"from"`
+	To    string `json:"to"`
+}
+
+// DetectTurningPoints returns the moves where the game crossed from one band
+// to another, in the order they were played
+func DetectTurningPoints(moves []MoveAnalysis, bands WinProbBands) []TurningPoint {
+	points := []TurningPoint{}
+	for i := range moves {
+		move := &moves[i]
+		from := bands.state(move.PreviousWhiteWinProb, move.PreviousWhiteDrawProb, move.PreviousWhiteLossProb)
+		to := bands.state(move.WhiteWinProb, move.WhiteDrawProb, move.WhiteLossProb)
+		if from == to {
+			continue
+		}
+		points = append(points, TurningPoint{
+			Ply:   i,
+			Move:  MoveLabel(move),
+			Color: move.Color,
+			From:  from.String(),
+			To:    to.String(),
+		})
+	}
+	return points
+}
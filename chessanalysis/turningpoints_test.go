@@ -0,0 +1,34 @@
+package chessanalysis
+
+import "testing"
+
+func TestDetectTurningPoints(t *testing.T) {
+	moves := []MoveAnalysis{
+		{MoveNumber: 1, Color: "White", MoveText: "e4", PreviousWhiteDrawProb: 1, WhiteDrawProb: 1},
+		{MoveNumber: 1, Color: "Black", MoveText: "f6", PreviousWhiteDrawProb: 1, WhiteWinProb: 0.3, WhiteDrawProb: 0.7},
+		{MoveNumber: 2, Color: "White", MoveText: "d4", PreviousWhiteWinProb: 0.3, PreviousWhiteDrawProb: 0.7, WhiteWinProb: 0.3, WhiteDrawProb: 0.7},
+		{MoveNumber: 2, Color: "Black", MoveText: "g5", PreviousWhiteWinProb: 0.3, PreviousWhiteDrawProb: 0.7, WhiteWinProb: 1},
+		{MoveNumber: 3, Color: "White", MoveText: "Kd2", PreviousWhiteWinProb: 1, WhiteLossProb: 0.9, WhiteDrawProb: 0.1},
+	}
+
+	points := DetectTurningPoints(moves, DefaultWinProbBands)
+	want := []TurningPoint{
+		{Ply: 1, Move: "1... f6", Color: "Black", From: "Equal", To: "WhiteBetter"},
+		{Ply: 3, Move: "2... g5", Color: "Black", From: "WhiteBetter", To: "WhiteWinning"},
+		{Ply: 4, Move: "3. Kd2", Color: "White", From: "WhiteWinning", To: "BlackWinning"},
+	}
+	if len(points) != len(want) {
+		t.Fatalf("expected %d turning points, got %+v", len(want), points)
+	}
+	for i := range want {
+		if points[i] != want[i] {
+			t.Errorf("turning point %d = %+v, want %+v", i, points[i], want[i])
+		}
+	}
+
+	// Wider bands ignore the small edge after 1...f6
+	wide := DetectTurningPoints(moves, WinProbBands{Better: 0.7, Winning: 0.9})
+	if len(wide) != 2 || wide[0].Ply != 3 || wide[0].From != "Equal" {
+		t.Errorf("unexpected turning points with wide bands: %+v", wide)
+	}
+}
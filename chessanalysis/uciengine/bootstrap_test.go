@@ -0,0 +1,88 @@
+package uciengine
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestStockfishBootstrap(t *testing.T) {
+	binary := []byte("#!/bin/sh\necho stockfish\n")
+	var archive bytes.Buffer
+	files := tar.NewWriter(&archive)
+	files.WriteHeader(&tar.Header{Name: "stockfish/", Typeflag: tar.TypeDir, Mode: 0o755})
+	files.WriteHeader(&tar.Header{Name: "stockfish/README.md", Typeflag: tar.TypeReg, Mode: 0o644, Size: 5})
+	files.Write([]byte("hello"))
+	files.WriteHeader(&tar.Header{Name: "stockfish/stockfish-ubuntu-x86-64", Typeflag: tar.TypeReg, Mode: 0o755, Size: int64(len(binary))})
+	files.Write(binary)
+	files.Close()
+	sum := sha256.Sum256(archive.Bytes())
+
+	// The test's archive is pinned in place of the official one
+	official := stockfishArchives["linux/amd64"]
+	t.Cleanup(func() { stockfishArchives["linux/amd64"] = official })
+	stockfishArchives["linux/amd64"] = stockfishArchive{Name: official.Name, SHA256: hex.EncodeToString(sum[:])}
+	downloads := 0
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/releases/tags/" + StockfishRelease:
+			json.NewEncoder(w).Encode(map[string]any{"assets": []stockfishAsset{
+				{Name: "stockfish-ubuntu-x86-64.tar", URL: server.URL + "/download/stockfish-ubuntu-x86-64.tar"},
+			}})
+		case "/download/stockfish-ubuntu-x86-64.tar":
+			downloads++
+			w.Write(archive.Bytes())
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	bootstrap := &StockfishBootstrap{Client: server.Client(), URL: server.URL + "/releases", Dir: t.TempDir()}
+	installed, err := bootstrap.install(context.Background(), "linux/amd64")
+	if err != nil {
+		t.Fatalf("failed to install Stockfish: %v", err)
+	}
+	got, err := os.ReadFile(installed)
+	if err != nil || !bytes.Equal(got, binary) {
+		t.Errorf("expected the binary at %s, got %q (%v)", installed, got, err)
+	}
+	if info, err := os.Stat(installed); err != nil || info.Mode().Perm()&0o100 == 0 {
+		t.Errorf("expected the binary to be executable, got %v (%v)", info.Mode(), err)
+	}
+	if again, err := bootstrap.install(context.Background(), "linux/amd64"); err != nil || again != installed || downloads != 1 {
+		t.Errorf("expected the cached binary without another download, got %s after %d downloads (%v)", again, downloads, err)
+	}
+
+	// A download that doesn't match its pinned checksum is refused, and not
+	// kept
+	stockfishArchives["linux/amd64"] = stockfishArchive{Name: official.Name, SHA256: strings.Repeat("0", 64)}
+	bootstrap.Dir = t.TempDir()
+	if _, err := bootstrap.install(context.Background(), "linux/amd64"); err == nil || !strings.Contains(err.Error(), "checksum") {
+		t.Errorf("expected a checksum error, got %v", err)
+	}
+	if entries, _ := os.ReadDir(bootstrap.Dir + "/" + StockfishRelease); len(entries) != 0 {
+		t.Errorf("expected nothing left after a failed download, got %d files", len(entries))
+	}
+
+	// Nor is an archive without a pinned checksum downloaded at all
+	stockfishArchives["linux/amd64"] = stockfishArchive{Name: official.Name}
+	downloads = 0
+	if _, err := bootstrap.install(context.Background(), "linux/amd64"); !errors.Is(err, ErrEngineNotFound) || downloads != 0 {
+		t.Errorf("expected an archive without a pinned checksum refused before downloading, got %v after %d downloads", err, downloads)
+	}
+
+	if _, err := bootstrap.install(context.Background(), "plan9/386"); !errors.Is(err, ErrEngineNotFound) {
+		t.Errorf("expected ErrEngineNotFound for a platform without builds, got %v", err)
+	}
+}
@@ -0,0 +1,41 @@
+// Package uciengine runs UCI chess engines such as Stockfish: it starts and
+// restarts their processes, sizes their Hash and Threads to the machine, and
+// searches positions and moves within SearchLimits. It is the engine layer of
+// the chessanalysis package and can be used on its own.
+package uciengine
+
+// Engine evaluates moves for the analysis pipeline
+type Engine interface {
+	// AnalyzeLastMove evaluates the last of the given UCI moves, played from the
+	// starting position, along with the best move in the position before it
+	AnalyzeLastMove(moves []string, limits SearchLimits) (*AnalysisResult, error)
+	// AnalyzePosition searches the position given as a FEN. The best move's
+	// scores are reported both as the played and the best move scores.
+	AnalyzePosition(fen string, limits SearchLimits) (*AnalysisResult, error)
+	// Close shuts the engine down
+	Close() error
+}
+
+// EngineFactory starts a new engine
+type EngineFactory func() (Engine, error)
+
+// StockfishEngineFactory starts a Stockfish engine from the PATH
+func StockfishEngineFactory() (Engine, error) {
+	engine, err := NewStockfishEngine()
+	if err != nil {
+		return nil, err
+	}
+	return engine, nil
+}
+
+// UCIEngineFactory starts the named UCI engine binary, such as "lc0", from
+// the PATH or by its path
+func UCIEngineFactory(binary string) EngineFactory {
+	return func() (Engine, error) {
+		engine, err := NewEngine(ExecLauncher(binary))
+		if err != nil {
+			return nil, err
+		}
+		return engine, nil
+	}
+}
@@ -0,0 +1,129 @@
+package uciengine
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// EngineInfo is what a UCI engine reports about itself when it starts: its
+// "id" and "option" lines
+type EngineInfo struct {
+	Name    string         `json:"name"`
+	Version string         `json:"version,omitempty"`
+	Author  string         `json:"author,omitempty"`
+	Options []EngineOption `json:"options"`
+}
+
+// EngineOption is an option the engine accepts with setoption
+type EngineOption struct {
+	Name    string   `json:"name"`
+	Type    string   `json:"type"` // check, spin, combo, button or string
+	Default string   `json:"default,omitempty"`
+	Min     *int     `json:"min,omitempty"`  // Spin options only
+	Max     *int     `json:"max,omitempty"`  // Spin options only
+	Vars    []string `json:"vars,omitempty"` // Combo options only
+}
+
+// EngineCapabilities are the features of an engine the analysis makes use of
+type EngineCapabilities struct {
+	MaxMultiPV int  `json:"maxMultiPV"` // How many lines the engine can report; 1 without MultiPV
+	WDL        bool `json:"wdl"`        // Whether the engine reports win/draw/loss chances, with UCI_ShowWDL
+	Chess960   bool `json:"chess960"`   // Whether the engine plays Chess960, with UCI_Chess960
+}
+
+// EngineDescriber is implemented by engines that know their EngineInfo
+type EngineDescriber interface {
+	Info() EngineInfo
+}
+
+// Option returns the option with the given name, compared case-insensitively
+// as UCI does, or nil if the engine has no such option
+func (info *EngineInfo) Option(name string) *EngineOption {
+	for i := range info.Options {
+		if strings.EqualFold(info.Options[i].Name, name) {
+			return &info.Options[i]
+		}
+	}
+	return nil
+}
+
+// Capabilities returns the features the engine's options provide
+func (info *EngineInfo) Capabilities() EngineCapabilities {
+	capabilities := EngineCapabilities{MaxMultiPV: 1}
+	if option := info.Option("MultiPV"); option != nil && option.Max != nil {
+		capabilities.MaxMultiPV = *option.Max
+	}
+	capabilities.WDL = info.Option("UCI_ShowWDL") != nil
+	capabilities.Chess960 = info.Option("UCI_Chess960") != nil
+	return capabilities
+}
+
+// parseEngineID adds an "id name" or "id author" line to the engine info. The
+// version is split off the end of the name, as in "Stockfish 16.1".
+func (info *EngineInfo) parseEngineID(line string) {
+	if author, ok := strings.CutPrefix(line, "id author "); ok {
+		info.Author = strings.TrimSpace(author)
+		return
+	}
+	name, ok := strings.CutPrefix(line, "id name ")
+	if !ok {
+		return
+	}
+	info.Name = strings.TrimSpace(name)
+	if i := strings.LastIndex(info.Name, " "); i > 0 && strings.IndexFunc(info.Name[i+1:], unicode.IsDigit) >= 0 {
+		info.Name, info.Version = info.Name[:i], info.Name[i+1:]
+	}
+}
+
+// parseUCIOption parses an "option" line such as
+// "option name MultiPV type spin default 1 min 1 max 500". Option names and
+// string defaults may contain spaces.
+func parseUCIOption(line string) (EngineOption, bool) {
+	fields := strings.Fields(line)
+	if len(fields) < 5 || fields[0] != "option" || fields[1] != "name" {
+		return EngineOption{}, false
+	}
+	var option EngineOption
+	var key string
+	var value []string
+	set := func() {
+		joined := strings.Join(value, " ")
+		switch key {
+		case "name":
+			option.Name = joined
+		case "type":
+			option.Type = joined
+		case "default":
+			if joined != "<empty>" {
+				option.Default = joined
+			}
+		case "min", "max":
+			if n, err := strconv.Atoi(joined); err == nil {
+				if key == "min" {
+					option.Min = &n
+				} else {
+					option.Max = &n
+				}
+			}
+		case "var":
+			option.Vars = append(option.Vars, joined)
+		}
+	}
+	for _, field := range fields[1:] {
+		switch field {
+		case "name", "type", "default", "min", "max", "var":
+			// Keywords only start a new value outside of the name
+			if key != "name" || field == "type" {
+				if key != "" {
+					set()
+				}
+				key, value = field, nil
+				continue
+			}
+		}
+		value = append(value, field)
+	}
+	set()
+	return option, option.Name != "" && option.Type != ""
+}
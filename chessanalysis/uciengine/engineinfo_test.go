@@ -0,0 +1,39 @@
+package uciengine
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseUCIOption(t *testing.T) {
+	intPtr := func(n int) *int { return &n }
+	for line, want := range map[string]EngineOption{
+		"option name MultiPV type spin default 1 min 1 max 500": {Name: "MultiPV", Type: "spin", Default: "1", Min: intPtr(1), Max: intPtr(500)},
+		"option name UCI_ShowWDL type check default false":      {Name: "UCI_ShowWDL", Type: "check", Default: "false"},
+		"option name Clear Hash type button":                    {Name: "Clear Hash", Type: "button"},
+		"option name SyzygyPath type string default <empty>":    {Name: "SyzygyPath", Type: "string"},
+		"option name Style type combo default Normal var Solid var Normal var Risky": {
+			Name: "Style", Type: "combo", Default: "Normal", Vars: []string{"Solid", "Normal", "Risky"},
+		},
+	} {
+		option, ok := parseUCIOption(line)
+		if !ok || !reflect.DeepEqual(option, want) {
+			t.Errorf("expected %q to parse as %+v, got %+v (%v)", line, want, option, ok)
+		}
+	}
+	if _, ok := parseUCIOption("info string hello"); ok {
+		t.Error("expected a line other than an option not to parse")
+	}
+}
+
+func TestParseEngineID(t *testing.T) {
+	var stockfish EngineInfo
+	stockfish.parseEngineID("id name Stockfish dev-20240101-abcdef")
+	stockfish.parseEngineID("id author the Stockfish developers (see AUTHORS file)")
+	if stockfish.Name != "Stockfish" || stockfish.Version != "dev-20240101-abcdef" || stockfish.Author != "the Stockfish developers (see AUTHORS file)" {
+		t.Errorf("unexpected engine ID %+v", stockfish)
+	}
+	if capabilities := stockfish.Capabilities(); capabilities.MaxMultiPV != 1 || capabilities.WDL {
+		t.Errorf("expected an engine without options to report one line, got %+v", capabilities)
+	}
+}
@@ -0,0 +1,12 @@
+package uciengine
+
+import "errors"
+
+// Errors returned by the engines. They are wrapped with additional context,
+// so callers should compare against them with errors.Is.
+var (
+	// ErrEngineNotFound is returned when the chess engine binary can't be found
+	ErrEngineNotFound = errors.New("chess engine not found")
+	// ErrEngineTimeout is returned when the chess engine stops responding
+	ErrEngineTimeout = errors.New("chess engine timed out")
+)
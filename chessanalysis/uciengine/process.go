@@ -0,0 +1,48 @@
+package uciengine
+
+import "fmt"
+
+// ProcessLimits restrict the operating system resources of engine processes,
+// so that engines analyzing in the background don't starve the rest of the
+// host. The zero value restricts nothing. They are only supported on Linux.
+type ProcessLimits struct {
+	Nice        int // Niceness the engine runs at, from 1 (a little below normal priority) to 19 (lowest); 0 leaves it
+	MaxMemoryMB int // Address space the engine may use, which must leave room for its Hash; 0 for no limit
+	CPUs        int // How many of the available cores the engine may run on; 0 for all
+	// Sandbox confines the engine, which reads positions from untrusted
+	// games, to what it needs to search them, see sandboxedLauncher
+	Sandbox bool
+}
+
+// LimitedEngineFactory starts the named UCI engine binary, such as
+// "stockfish", with its process restricted to limits
+func LimitedEngineFactory(binary string, limits ProcessLimits) EngineFactory {
+	return func() (Engine, error) {
+		launch := ExecLauncher(binary)
+		if limits.Sandbox {
+			launch = sandboxedLauncher(binary)
+		}
+		engine, err := NewEngine(limitedLauncher(launch, limits))
+		if err != nil {
+			return nil, err
+		}
+		return engine, nil
+	}
+}
+
+// limitedLauncher applies limits to the processes launch starts, before the
+// engine is sent anything
+func limitedLauncher(launch Launcher, limits ProcessLimits) Launcher {
+	return func() (*Process, error) {
+		process, err := launch()
+		if err != nil || limits == (ProcessLimits{Sandbox: limits.Sandbox}) {
+			return process, err
+		}
+		if err := applyProcessLimits(process.PID, limits); err != nil {
+			process.Kill()
+			process.Wait()
+			return nil, fmt.Errorf("failed to limit engine process: %w", err)
+		}
+		return process, nil
+	}
+}
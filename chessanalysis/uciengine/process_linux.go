@@ -0,0 +1,55 @@
+package uciengine
+
+import (
+	"fmt"
+	"syscall"
+	"unsafe"
+)
+
+// applyProcessLimits restricts the process with the given ID
+func applyProcessLimits(pid int, limits ProcessLimits) error {
+	if limits.Nice != 0 {
+		if err := syscall.Setpriority(syscall.PRIO_PROCESS, pid, limits.Nice); err != nil {
+			return fmt.Errorf("setting niceness %d: %w", limits.Nice, err)
+		}
+	}
+	if limits.MaxMemoryMB > 0 {
+		limit := syscall.Rlimit{Cur: uint64(limits.MaxMemoryMB) << 20, Max: uint64(limits.MaxMemoryMB) << 20}
+		_, _, errno := syscall.RawSyscall6(syscall.SYS_PRLIMIT64, uintptr(pid), syscall.RLIMIT_AS,
+			uintptr(unsafe.Pointer(&limit)), 0, 0, 0)
+		if errno != 0 {
+			return fmt.Errorf("limiting memory to %d MB: %w", limits.MaxMemoryMB, errno)
+		}
+	}
+	if limits.CPUs > 0 {
+		if err := limitCPUs(pid, limits.CPUs); err != nil {
+			return fmt.Errorf("limiting to %d CPUs: %w", limits.CPUs, err)
+		}
+	}
+	return nil
+}
+
+// cpuSet is a CPU affinity mask of up to 1024 CPUs, as sched_setaffinity takes
+type cpuSet [16]uint64
+
+// limitCPUs restricts the process to the first cpus of the CPUs this process
+// may run on
+func limitCPUs(pid, cpus int) error {
+	var allowed cpuSet
+	if _, _, errno := syscall.RawSyscall(syscall.SYS_SCHED_GETAFFINITY, 0,
+		unsafe.Sizeof(allowed), uintptr(unsafe.Pointer(&allowed))); errno != 0 {
+		return errno
+	}
+	var limited cpuSet
+	for cpu := 0; cpu < len(allowed)*64 && cpus > 0; cpu++ {
+		if allowed[cpu/64]&(1<<(cpu%64)) != 0 {
+			limited[cpu/64] |= 1 << (cpu % 64)
+			cpus--
+		}
+	}
+	if _, _, errno := syscall.RawSyscall(syscall.SYS_SCHED_SETAFFINITY, uintptr(pid),
+		unsafe.Sizeof(limited), uintptr(unsafe.Pointer(&limited))); errno != 0 {
+		return errno
+	}
+	return nil
+}
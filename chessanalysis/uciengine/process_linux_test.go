@@ -0,0 +1,49 @@
+package uciengine
+
+import (
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestApplyProcessLimits(t *testing.T) {
+	cmd := exec.Command("sleep", "30")
+	if err := cmd.Start(); err != nil {
+		t.Skipf("can't start a process to limit: %v", err)
+	}
+	defer func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	}()
+	if err := applyProcessLimits(cmd.Process.Pid, ProcessLimits{Nice: 15, MaxMemoryMB: 256, CPUs: 1}); err != nil {
+		t.Fatalf("failed to limit process: %v", err)
+	}
+
+	proc := "/proc/" + strconv.Itoa(cmd.Process.Pid)
+	stat, err := os.ReadFile(proc + "/stat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The niceness is the 19th field, and the command before it has no spaces
+	if fields := strings.Fields(string(stat)); len(fields) < 19 || fields[18] != "15" {
+		t.Errorf("expected niceness 15, got %q", fields[18])
+	}
+	limits, err := os.ReadFile(proc + "/limits")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(limits), strconv.Itoa(256<<20)) {
+		t.Errorf("expected a 256 MB address space limit, got:\n%s", limits)
+	}
+	status, err := os.ReadFile(proc + "/status")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range strings.Split(string(status), "\n") {
+		if list, ok := strings.CutPrefix(line, "Cpus_allowed_list:"); ok && strings.ContainsAny(strings.TrimSpace(list), ",-") {
+			t.Errorf("expected a single CPU, got %s", list)
+		}
+	}
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package uciengine
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// applyProcessLimits fails, as limiting processes is only supported on Linux
+func applyProcessLimits(pid int, limits ProcessLimits) error {
+	return fmt.Errorf("engine process limits are not supported on %s", runtime.GOOS)
+}
@@ -0,0 +1,93 @@
+package uciengine
+
+import (
+	"bufio"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+const (
+	// DefaultHashMB is the engine's Hash size, in MB, when the memory
+	// available can't be found out
+	DefaultHashMB = 128
+	// MinHashMB and MaxHashMB bound the Hash size AutoHashMB chooses for each
+	// engine. Searches of the depths analyses use gain little beyond the cap.
+	MinHashMB = 16
+	MaxHashMB = 2048
+)
+
+// AutoHashMB returns the Hash size, in MB, for each of the given number of
+// engines running at once: half the memory available, shared between them.
+func AutoHashMB(engines int) int {
+	return hashForMemory(availableMemory(), engines)
+}
+
+// AutoThreads returns the Threads setting for each of the given number of
+// engines running at once, so that together they use every core without
+// oversubscribing them
+func AutoThreads(engines int) int {
+	return threadsForCores(runtime.NumCPU(), engines)
+}
+
+// threadsForCores shares cores between engines, giving each at least one
+func threadsForCores(cores, engines int) int {
+	return max(cores/max(engines, 1), 1)
+}
+
+// hashForMemory shares half of memory bytes between engines, within
+// MinHashMB and MaxHashMB, or returns DefaultHashMB if memory is unknown
+func hashForMemory(memory uint64, engines int) int {
+	if memory == 0 {
+		return DefaultHashMB
+	}
+	share := memory / 2 / uint64(max(engines, 1)) >> 20
+	return int(min(max(share, MinHashMB), MaxHashMB))
+}
+
+// availableMemory returns the bytes of memory the process may still use: what
+// the system has available, within the limit of its control group if it has
+// one. It returns 0 if neither can be read, as on systems other than Linux.
+func availableMemory() uint64 {
+	memory := uint64(0)
+	if meminfo, err := os.ReadFile("/proc/meminfo"); err == nil {
+		memory, _ = memInfoAvailable(string(meminfo))
+	}
+	// cgroup v2, then v1
+	for _, path := range []string{"/sys/fs/cgroup/memory.max", "/sys/fs/cgroup/memory/memory.limit_in_bytes"} {
+		value, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		if limit, ok := cgroupMemoryLimit(string(value)); ok && (memory == 0 || limit < memory) {
+			memory = limit
+		}
+		break
+	}
+	return memory
+}
+
+// memInfoAvailable returns the MemAvailable of /proc/meminfo in bytes
+func memInfoAvailable(meminfo string) (uint64, bool) {
+	scanner := bufio.NewScanner(strings.NewReader(meminfo))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || fields[0] != "MemAvailable:" {
+			continue
+		}
+		kB, err := strconv.ParseUint(fields[1], 10, 64)
+		return kB << 10, err == nil
+	}
+	return 0, false
+}
+
+// cgroupMemoryLimit parses a control group's memory limit. Unlimited groups
+// have "max" in cgroup v2 and a value near the largest int64 in v1.
+func cgroupMemoryLimit(value string) (uint64, bool) {
+	limit, err := strconv.ParseUint(strings.TrimSpace(value), 10, 64)
+	if err != nil || limit >= 1<<62 {
+		return 0, false
+	}
+	return limit, true
+}
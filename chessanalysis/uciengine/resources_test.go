@@ -0,0 +1,50 @@
+package uciengine
+
+import "testing"
+
+func TestHashForMemory(t *testing.T) {
+	for _, test := range []struct {
+		memory  uint64
+		engines int
+		want    int
+	}{
+		{0, 1, DefaultHashMB},
+		{512 << 20, 1, 256},
+		{64 << 30, 1, MaxHashMB},
+		{16 << 30, 16, 512},
+		{256 << 20, 32, MinHashMB},
+	} {
+		if got := hashForMemory(test.memory, test.engines); got != test.want {
+			t.Errorf("expected %d MB for %d engines in %d bytes, got %d", test.want, test.engines, test.memory, got)
+		}
+	}
+}
+
+func TestThreadsForCores(t *testing.T) {
+	for _, test := range []struct{ cores, engines, want int }{
+		{8, 1, 8},
+		{8, 2, 4},
+		{8, 3, 2},
+		{4, 16, 1},
+		{4, 0, 4},
+	} {
+		if got := threadsForCores(test.cores, test.engines); got != test.want {
+			t.Errorf("expected %d threads for %d engines on %d cores, got %d", test.want, test.engines, test.cores, got)
+		}
+	}
+}
+
+func TestAvailableMemoryParsing(t *testing.T) {
+	meminfo := "MemTotal:       16318536 kB\nMemFree:         1234567 kB\nMemAvailable:    8388608 kB\n"
+	if memory, ok := memInfoAvailable(meminfo); !ok || memory != 8<<30 {
+		t.Errorf("expected 8 GiB available, got %d (%v)", memory, ok)
+	}
+	if _, ok := memInfoAvailable("MemTotal: 1 kB\n"); ok {
+		t.Error("expected no MemAvailable to be found")
+	}
+	for value, want := range map[string]uint64{"1073741824\n": 1 << 30, "max\n": 0, "9223372036854771712\n": 0} {
+		if limit, ok := cgroupMemoryLimit(value); limit != want || ok != (want != 0) {
+			t.Errorf("expected %q to limit memory to %d, got %d (%v)", value, want, limit, ok)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package uciengine
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// sandboxedLauncher returns a launcher running the named engine binary, from
+// the PATH or by its path, confined by sandboxCommand: in an empty working
+// directory of its own, removed once it exits, with no environment, and
+// where the platform allows it, without network access or the right to
+// write files. System calls aren't filtered: a seccomp filter is out of
+// scope, as its allow list would have to follow each engine's and each
+// architecture's system calls, and the namespaces and limits already take
+// away what an engine could do with them.
+func sandboxedLauncher(name string) Launcher {
+	return func() (*Process, error) {
+		if filepath.Base(name) != name {
+			// A relative path would be looked up in the new working directory
+			absolute, err := filepath.Abs(name)
+			if err != nil {
+				return nil, err
+			}
+			name = absolute
+		}
+		dir, err := os.MkdirTemp("", "chess-engine-")
+		if err != nil {
+			return nil, fmt.Errorf("failed to create engine directory: %w", err)
+		}
+		cmd := exec.Command(name)
+		cmd.Dir = dir
+		cmd.Env = []string{}
+		if err := sandboxCommand(cmd); err != nil {
+			os.RemoveAll(dir)
+			return nil, fmt.Errorf("failed to sandbox engine: %w", err)
+		}
+		process, err := startCommand(cmd)
+		if err != nil {
+			os.RemoveAll(dir)
+			return nil, err
+		}
+		wait := process.Wait
+		process.Wait = func() error {
+			defer os.RemoveAll(dir)
+			return wait()
+		}
+		return process, nil
+	}
+}
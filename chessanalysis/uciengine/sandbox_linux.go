@@ -0,0 +1,78 @@
+package uciengine
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// sandboxOpenFiles is how many files a sandboxed engine may have open, which
+// leaves room for its network file and tablebases
+const sandboxOpenFiles = 256
+
+// sandboxHelper is the argument the server runs itself with to start a
+// sandboxed engine, see runSandboxHelper
+const sandboxHelper = "__chess-analyzer-sandbox-engine"
+
+func init() {
+	if len(os.Args) == 3 && os.Args[1] == sandboxHelper {
+		runSandboxHelper(os.Args[2])
+	}
+}
+
+// sandboxCommand runs the command in user and network namespaces of its own,
+// so that it has no network but loopback, and kills it if the server dies
+// first. Unprivileged user namespaces must be enabled for it to start. The
+// command is started through runSandboxHelper, so that the engine is limited
+// from its first instruction on.
+func sandboxCommand(cmd *exec.Cmd) error {
+	if cmd.Err != nil {
+		// Starting it reports the engine missing
+		return nil
+	}
+	self, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	cmd.Args = []string{self, sandboxHelper, cmd.Path}
+	cmd.Path = self
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Cloneflags:  syscall.CLONE_NEWUSER | syscall.CLONE_NEWNET | syscall.CLONE_NEWIPC,
+		UidMappings: []syscall.SysProcIDMap{{ContainerID: os.Getuid(), HostID: os.Getuid(), Size: 1}},
+		GidMappings: []syscall.SysProcIDMap{{ContainerID: os.Getgid(), HostID: os.Getgid(), Size: 1}},
+		Pdeathsig:   syscall.SIGKILL,
+	}
+	return nil
+}
+
+// runSandboxHelper applies applySandboxLimits to this process, started by
+// sandboxCommand in the sandbox's namespaces, and then replaces it with the
+// engine, which keeps them. It never returns.
+func runSandboxHelper(engine string) {
+	if err := applySandboxLimits(); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to sandbox engine: %v\n", err)
+		os.Exit(1)
+	}
+	err := syscall.Exec(engine, []string{engine}, os.Environ())
+	fmt.Fprintf(os.Stderr, "failed to start %s: %v\n", engine, err)
+	os.Exit(1)
+}
+
+// applySandboxLimits stops the process writing to files or dumping core, and
+// bounds the files it may open
+func applySandboxLimits() error {
+	for _, limit := range []struct {
+		resource int
+		value    uint64
+	}{
+		{syscall.RLIMIT_FSIZE, 0},
+		{syscall.RLIMIT_CORE, 0},
+		{syscall.RLIMIT_NOFILE, sandboxOpenFiles},
+	} {
+		if err := syscall.Setrlimit(limit.resource, &syscall.Rlimit{Cur: limit.value, Max: limit.value}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package uciengine
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSandboxedLauncher(t *testing.T) {
+	// A stand-in engine reporting what it sees of its surroundings once it
+	// is sent something, as engines only act on what they are sent
+	script := filepath.Join(t.TempDir(), "engine.sh")
+	os.WriteFile(script, []byte(`#!/bin/sh
+read command
+echo "dir $(pwd)"
+echo "env $(env | grep -cv '^PWD=\|^SHLVL=\|^_=')"
+echo "interfaces $(tail -n +3 /proc/net/dev | cut -d: -f1 | tr -d ' ' | tr '\n' ' ')"
+echo "write $( (echo x > written) 2>/dev/null && echo ok || echo refused)"
+echo "files $(ulimit -n)"
+`), 0o755)
+	t.Setenv("ENGINE_SECRET", "1")
+
+	process, err := sandboxedLauncher(script)()
+	if err != nil {
+		t.Skipf("can't sandbox processes here: %v", err)
+	}
+	process.Stdin.Write([]byte("uci\n"))
+	report := make(map[string]string)
+	lines := bufio.NewScanner(process.Stdout)
+	for lines.Scan() {
+		key, value, _ := strings.Cut(lines.Text(), " ")
+		report[key] = strings.TrimSpace(value)
+	}
+	process.Wait()
+
+	dir := report["dir"]
+	if !strings.HasPrefix(filepath.Base(dir), "chess-engine-") {
+		t.Errorf("expected a working directory of its own, got %q", dir)
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("expected the working directory removed once the engine exited, got %v", err)
+	}
+	if report["env"] != "0" {
+		t.Errorf("expected no environment, got %s variables", report["env"])
+	}
+	if report["interfaces"] != "lo" {
+		t.Errorf("expected only loopback, got %q", report["interfaces"])
+	}
+	if report["write"] != "refused" {
+		t.Errorf("expected writing files to be refused, got %q", report["write"])
+	}
+	if report["files"] != "256" {
+		t.Errorf("expected at most 256 open files, got %q", report["files"])
+	}
+}
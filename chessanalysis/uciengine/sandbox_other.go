@@ -0,0 +1,14 @@
+//go:build !linux
+
+package uciengine
+
+import (
+	"fmt"
+	"os/exec"
+	"runtime"
+)
+
+// sandboxCommand fails, as sandboxing engines is only supported on Linux
+func sandboxCommand(cmd *exec.Cmd) error {
+	return fmt.Errorf("engine sandboxing is not supported on %s", runtime.GOOS)
+}
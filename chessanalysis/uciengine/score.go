@@ -0,0 +1,235 @@
+package uciengine
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// MatePawns is the score in pawns a forced mate counts as where a score has
+// to be a number, such as in centipawn loss and win probabilities
+const MatePawns = 10
+
+// scoreKind tells centipawn scores apart from mate scores
+type scoreKind uint8
+
+const (
+	centipawnScore scoreKind = iota
+	mateScore                // The side the score is from mates in moves
+	matedScore               // The side the score is from is mated in moves
+)
+
+// Score is an engine evaluation: either a score in centipawns or a forced
+// mate in a number of moves. The zero Score is an even position. Whose
+// perspective a score is from is up to where it's kept.
+type Score struct {
+	kind       scoreKind
+	centipawns int
+	moves      int // Moves until mate, for mate scores
+}
+
+// Centipawns returns a score of the given centipawns
+func Centipawns(centipawns int) Score {
+	return Score{centipawns: centipawns}
+}
+
+// Pawns returns a score of the given pawns, rounded to the nearest centipawn
+func Pawns(pawns float64) Score {
+	return Score{centipawns: int(math.Round(pawns * 100))}
+}
+
+// MateIn returns a forced mate in the given number of moves, or being mated
+// in -moves moves if moves is negative. Use Mated for a position that is
+// already checkmate.
+func MateIn(moves int) Score {
+	if moves < 0 {
+		return Score{kind: matedScore, moves: -moves}
+	}
+	return Score{kind: mateScore, moves: moves}
+}
+
+// Mated returns the score of the side that has been checkmated, "#-0"
+func Mated() Score {
+	return Score{kind: matedScore}
+}
+
+// IsMate reports whether the score is a forced mate, for either side
+func (s Score) IsMate() bool {
+	return s.kind != centipawnScore
+}
+
+// Mate returns the number of moves to mate, negative if the side the score is
+// from is being mated, and 0 for centipawn scores. A position that is already
+// checkmate is 0 as well; see IsMate and Winning.
+func (s Score) Mate() int {
+	if s.kind == matedScore {
+		return -s.moves
+	}
+	return s.moves
+}
+
+// Winning reports whether the score favors the side it is from: a positive
+// centipawn score, or a forced mate by that side
+func (s Score) Winning() bool {
+	switch s.kind {
+	case mateScore:
+		return true
+	case matedScore:
+		return false
+	}
+	return s.centipawns > 0
+}
+
+// CP returns the score in centipawns, with a forced mate counting as
+// MatePawns
+func (s Score) CP() int {
+	switch s.kind {
+	case mateScore:
+		return MatePawns * 100
+	case matedScore:
+		return -MatePawns * 100
+	}
+	return s.centipawns
+}
+
+// Pawns returns the score in pawns, with a forced mate counting as MatePawns
+func (s Score) Pawns() float64 {
+	return float64(s.CP()) / 100
+}
+
+// Negate returns the score from the other side's perspective
+func (s Score) Negate() Score {
+	switch s.kind {
+	case mateScore:
+		s.kind = matedScore
+	case matedScore:
+		s.kind = mateScore
+	default:
+		s.centipawns = -s.centipawns
+	}
+	return s
+}
+
+// rank orders scores for comparison: mates beat any centipawn score, a
+// quicker mate beats a slower one, and being mated later beats sooner
+func (s Score) rank() (tier int, value int) {
+	switch s.kind {
+	case mateScore:
+		return 1, -s.moves
+	case matedScore:
+		return -1, s.moves
+	}
+	return 0, s.centipawns
+}
+
+// Compare returns -1 if s is worse than other for the side they are from, 1
+// if it is better, and 0 if they are equal
+func (s Score) Compare(other Score) int {
+	tier, value := s.rank()
+	otherTier, otherValue := other.rank()
+	if tier != otherTier {
+		return compareInts(tier, otherTier)
+	}
+	return compareInts(value, otherValue)
+}
+
+// compareInts returns -1, 0 or 1 as a is less than, equal to or greater than b
+func compareInts(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// Less reports whether s is worse than other for the side they are from
+func (s Score) Less(other Score) bool {
+	return s.Compare(other) < 0
+}
+
+// String formats the score in pawns with a sign, such as "+2.3" or "-0.45",
+// or as a mate such as "#4" or "#-4"
+func (s Score) String() string {
+	switch s.kind {
+	case mateScore:
+		return fmt.Sprintf("#%d", s.moves)
+	case matedScore:
+		return fmt.Sprintf("#-%d", s.moves)
+	}
+	pawns := strconv.FormatFloat(float64(s.centipawns)/100, 'f', -1, 64)
+	if s.centipawns > 0 {
+		return "+" + pawns
+	}
+	return pawns
+}
+
+// Format formats the score as String does, but with centipawn scores to two
+// decimals, such as "+2.30", the way the reports print evaluations
+func (s Score) Format() string {
+	if s.IsMate() {
+		return s.String()
+	}
+	return fmt.Sprintf("%+.2f", s.Pawns())
+}
+
+// ParseScore parses a score as String formats it, or as a PGN [%eval]
+// command gives it: pawns such as "0.17" or "+2.3", or a mate such as "#-3"
+func ParseScore(value string) (Score, error) {
+	value = strings.TrimSpace(value)
+	if mate, ok := strings.CutPrefix(value, "#"); ok {
+		moves, err := strconv.Atoi(mate)
+		if err != nil {
+			return Score{}, fmt.Errorf("invalid score %q", value)
+		}
+		if strings.HasPrefix(mate, "-") {
+			return Score{kind: matedScore, moves: -moves}, nil
+		}
+		return MateIn(moves), nil
+	}
+	pawns, err := strconv.ParseFloat(value, 64)
+	if err != nil || math.IsNaN(pawns) || math.IsInf(pawns, 0) {
+		return Score{}, fmt.Errorf("invalid score %q", value)
+	}
+	return Pawns(pawns), nil
+}
+
+// jsonScore is how a Score is marshaled: {"cp": 230} or {"mate": -4}. Mate
+// is a json.Number so that being mated on the board keeps its sign, as -0.
+type jsonScore struct {
+	CP   *int        `json:"cp,omitempty"`
+	Mate json.Number `json:"mate,omitempty"`
+}
+
+// MarshalJSON encodes the score as {"cp": centipawns} or {"mate": moves}, with
+// negative moves when the side the score is from is being mated
+func (s Score) MarshalJSON() ([]byte, error) {
+	if s.IsMate() {
+		return json.Marshal(jsonScore{Mate: json.Number(strings.TrimPrefix(s.String(), "#"))})
+	}
+	return json.Marshal(jsonScore{CP: &s.centipawns})
+}
+
+// UnmarshalJSON decodes a score encoded by MarshalJSON
+func (s *Score) UnmarshalJSON(data []byte) error {
+	var decoded jsonScore
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+	switch {
+	case decoded.Mate != "":
+		score, err := ParseScore("#" + decoded.Mate.String())
+		if err != nil {
+			return err
+		}
+		*s = score
+	case decoded.CP != nil:
+		*s = Centipawns(*decoded.CP)
+	default:
+		return fmt.Errorf("score %s has neither cp nor mate", data)
+	}
+	return nil
+}
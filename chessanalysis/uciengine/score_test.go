@@ -0,0 +1,79 @@
+package uciengine
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestScoreString(t *testing.T) {
+	tests := []struct {
+		score Score
+		want  string
+	}{
+		{Centipawns(230), "+2.3"},
+		{Centipawns(-45), "-0.45"},
+		{Score{}, "0"},
+		{MateIn(4), "#4"},
+		{MateIn(-4), "#-4"},
+		{Mated(), "#-0"},
+	}
+	for _, test := range tests {
+		if got := test.score.String(); got != test.want {
+			t.Errorf("String() = %q, want %q", got, test.want)
+		}
+		parsed, err := ParseScore(test.want)
+		if err != nil || parsed != test.score {
+			t.Errorf("ParseScore(%q) = %v, %v, want %v", test.want, parsed, err, test.score)
+		}
+	}
+	if got := Centipawns(230).Format(); got != "+2.30" {
+		t.Errorf("Format() = %q, want +2.30", got)
+	}
+}
+
+func TestScoreCompare(t *testing.T) {
+	// Worst to best for the side the scores are from
+	ordered := []Score{Mated(), MateIn(-1), MateIn(-5), Centipawns(-2500), Score{}, Centipawns(2500), MateIn(5), MateIn(1)}
+	for i := 1; i < len(ordered); i++ {
+		if !ordered[i-1].Less(ordered[i]) || ordered[i].Compare(ordered[i-1]) != 1 {
+			t.Errorf("expected %v to be worse than %v", ordered[i-1], ordered[i])
+		}
+	}
+	for _, score := range ordered {
+		if score.Negate().Negate() != score {
+			t.Errorf("negating %v twice gave %v", score, score.Negate().Negate())
+		}
+	}
+	if MateIn(3).Negate() != MateIn(-3) || Mated().Negate().String() != "#0" {
+		t.Errorf("unexpected negated mates %v and %v", MateIn(3).Negate(), Mated().Negate())
+	}
+	if MateIn(-2).Pawns() != -MatePawns || Centipawns(150).Pawns() != 1.5 {
+		t.Errorf("unexpected pawns %v and %v", MateIn(-2).Pawns(), Centipawns(150).Pawns())
+	}
+}
+
+func TestScoreJSON(t *testing.T) {
+	tests := []struct {
+		score Score
+		want  string
+	}{
+		{Centipawns(230), `{"cp":230}`},
+		{Score{}, `{"cp":0}`},
+		{MateIn(-4), `{"mate":-4}`},
+		{Mated(), `{"mate":-0}`},
+	}
+	for _, test := range tests {
+		data, err := json.Marshal(test.score)
+		if err != nil || string(data) != test.want {
+			t.Errorf("Marshal(%v) = %s, %v, want %s", test.score, data, err, test.want)
+		}
+		var decoded Score
+		if err := json.Unmarshal(data, &decoded); err != nil || decoded != test.score {
+			t.Errorf("Unmarshal(%s) = %v, %v, want %v", data, decoded, err, test.score)
+		}
+	}
+	var decoded Score
+	if err := json.Unmarshal([]byte(`{}`), &decoded); err == nil {
+		t.Error("expected an error for a score with neither cp nor mate")
+	}
+}
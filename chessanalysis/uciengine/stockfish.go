@@ -0,0 +1,756 @@
+package uciengine
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var log = slog.Default().With("package", "uciengine")
+
+// StockfishEngine talks to Stockfish, or any other UCI engine, over its
+// standard input and output. It restarts the engine if it stops responding.
+type StockfishEngine struct {
+	launch    Launcher
+	process   *Process
+	stdout    *bufio.Scanner
+	ready     bool
+	mutex     sync.Mutex
+	responses chan string
+	multiPV   int // Number of lines the engine is currently set to report
+	contempt  int // Contempt the engine is set to, 0 for its default
+	hashMB    int // Hash size the engine is set to, kept across restarts
+	threads   int // Threads the engine is set to, kept across restarts
+	info      EngineInfo
+	// position is the last position command sent and positionMoves the moves
+	// it plays, so the next ply of the same game can extend it in place
+	position      []byte
+	positionMoves []string
+
+	transcriptLock sync.Mutex
+	transcript     io.Writer // Records the conversation, if set, see Record
+}
+
+// Process is a running UCI engine the client talks to over stdin and stdout.
+// It needn't be an operating system process: anything speaking UCI over a
+// pair of streams will do.
+type Process struct {
+	Stdin  io.WriteCloser
+	Stdout io.Reader
+	Kill   func()       // Forcibly terminates the engine
+	Wait   func() error // Waits for the engine to exit
+	PID    int          // Of the engine's operating system process, or 0 if it has none
+}
+
+// Launcher starts a new engine process
+type Launcher func() (*Process, error)
+
+// ExecLauncher returns a launcher running the named engine binary, from the
+// PATH or by its path
+func ExecLauncher(name string) Launcher {
+	return func() (*Process, error) {
+		return startCommand(exec.Command(name))
+	}
+}
+
+// startCommand starts an engine command, talking to it over its stdin and
+// stdout
+func startCommand(cmd *exec.Cmd) (*Process, error) {
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create stdin pipe: %v", err)
+	}
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create stdout pipe: %v", err)
+	}
+
+	if err := cmd.Start(); err != nil {
+		if errors.Is(err, exec.ErrNotFound) {
+			return nil, fmt.Errorf("%w: %v", ErrEngineNotFound, err)
+		}
+		return nil, fmt.Errorf("failed to start %s: %w", cmd.Path, err)
+	}
+
+	return &Process{
+		Stdin:  stdin,
+		Stdout: stdout,
+		Kill: func() {
+			cmd.Process.Kill()
+		},
+		Wait: cmd.Wait,
+		PID:  cmd.Process.Pid,
+	}, nil
+}
+
+type AnalysisResult struct {
+	WhiteScore            Score
+	WhiteWinProb          float64
+	WhiteDrawProb         float64
+	WhiteLossProb         float64
+	BestMove              string
+	BestMoveWhiteScore    Score
+	BestMoveWhiteWinProb  float64
+	BestMoveWhiteDrawProb float64
+	BestMoveWhiteLossProb float64
+	Depth                 int           // Depth reached by the search of the played move
+	SelDepth              int           // Selective depth reached by the search of the played move
+	Nodes                 int64         // Nodes searched for the played move
+	NPS                   int64         // Search speed in nodes per second
+	HashFull              int           // Permille of the hash table in use after searching the played move
+	TBHits                int64         // Tablebase positions found by the search of the played move
+	TimeSpent             time.Duration // Time the engine spent searching the played move
+	PlayedLine            []string      // Principal variation in UCI notation, starting with the played move
+	BestLine              []string      // Principal variation in UCI notation, starting with the best move
+	TopMoves              []string      // The engine's top choices in UCI notation, best first; see SearchLimits.MultiPV
+	TopScores             []Score       // Scores of TopMoves from the mover's perspective
+	TopLines              [][]string    // Principal variation of each of TopMoves in UCI notation, where the engine gave one
+}
+
+// Clone returns a copy of the result that shares no slices with it, so either
+// can be modified without affecting the other
+func (r *AnalysisResult) Clone() *AnalysisResult {
+	clone := *r
+	clone.PlayedLine = slices.Clone(r.PlayedLine)
+	clone.BestLine = slices.Clone(r.BestLine)
+	clone.TopMoves = slices.Clone(r.TopMoves)
+	clone.TopScores = slices.Clone(r.TopScores)
+	clone.TopLines = nil
+	for _, line := range r.TopLines {
+		clone.TopLines = append(clone.TopLines, slices.Clone(line))
+	}
+	return &clone
+}
+
+// DefaultEngineTimeout is how long a single engine exchange may take before the engine is told to stop
+const DefaultEngineTimeout = 60 * time.Second
+
+// StopGracePeriod is how long the engine has to answer "stop", or to exit
+// after "quit", before it is considered hung
+const StopGracePeriod = 5 * time.Second
+
+// NewStockfishEngine creates and initializes a new Stockfish engine instance
+func NewStockfishEngine() (*StockfishEngine, error) {
+	return NewEngine(ExecLauncher("stockfish"))
+}
+
+// NewEngine starts and initializes a UCI engine with the given launcher
+func NewEngine(launch Launcher) (*StockfishEngine, error) {
+	engine := &StockfishEngine{
+		launch:  launch,
+		hashMB:  AutoHashMB(1),
+		threads: AutoThreads(1),
+	}
+	if err := engine.start(); err != nil {
+		return nil, err
+	}
+	return engine, nil
+}
+
+// start launches the engine process and initializes it
+func (e *StockfishEngine) start() error {
+	process, err := e.launch()
+	if err != nil {
+		return err
+	}
+
+	e.process = process
+	e.stdout = bufio.NewScanner(process.Stdout)
+	e.responses = make(chan string, 100)
+	e.ready = false
+	e.multiPV = 1
+	e.contempt = 0
+	e.info = EngineInfo{}
+
+	// Initialize engine
+	go e.readOutput(e.stdout, e.responses)
+	if err := e.initialize(); err != nil {
+		e.kill()
+		return err
+	}
+
+	return nil
+}
+
+// kill forcibly terminates the engine process
+func (e *StockfishEngine) kill() {
+	e.ready = false
+	e.process.Kill()
+	e.process.Wait()
+}
+
+// restart replaces a hung engine process with a fresh one
+func (e *StockfishEngine) restart() error {
+	log.Warn("Restarting unresponsive Stockfish engine")
+	e.kill()
+	return e.start()
+}
+
+// initialize sets up the Stockfish engine with UCI protocol
+func (e *StockfishEngine) initialize() error {
+	e.sendCommand("uci")
+	e.sendCommand(fmt.Sprintf("setoption name Hash value %d", e.hashMB))
+	e.sendCommand(fmt.Sprintf("setoption name Threads value %d", e.threads))
+	e.sendCommand("setoption name Ponder value false")
+	e.sendCommand("setoption name UCI_ShowWDL value true")
+	e.sendCommand("isready")
+
+	// Wait for readyok
+	timer := time.NewTimer(DefaultEngineTimeout)
+	defer timer.Stop()
+	for {
+		select {
+		case response, ok := <-e.responses:
+			if !ok {
+				return fmt.Errorf("engine initialization failed")
+			}
+			if strings.Contains(response, "readyok") {
+				e.ready = true
+				return nil
+			}
+			if strings.HasPrefix(response, "id ") {
+				e.info.parseEngineID(response)
+			} else if option, ok := parseUCIOption(response); ok {
+				e.info.Options = append(e.info.Options, option)
+			}
+		case <-timer.C:
+			return fmt.Errorf("%w: no readyok after %v", ErrEngineTimeout, DefaultEngineTimeout)
+		}
+	}
+}
+
+// Info implements EngineDescriber with what the engine reported when it started
+func (e *StockfishEngine) Info() EngineInfo {
+	return e.info
+}
+
+// sendCommand sends a command to the Stockfish engine
+func (e *StockfishEngine) sendCommand(cmd string) error {
+	log.Debug("sending command", "command", cmd)
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.record(transcriptSent, cmd)
+	_, err := fmt.Fprintln(e.process.Stdin, cmd)
+	return err
+}
+
+// sendLine sends a command held in a buffer, such as the position command,
+// without copying it into a string
+func (e *StockfishEngine) sendLine(cmd []byte) error {
+	if log.Enabled(context.Background(), slog.LevelDebug) {
+		log.Debug("sending command", "command", string(cmd))
+	}
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.transcriptLock.Lock()
+	if e.transcript != nil {
+		fmt.Fprintf(e.transcript, "%s%s\n", transcriptSent, cmd)
+	}
+	e.transcriptLock.Unlock()
+	_, err := fmt.Fprintf(e.process.Stdin, "%s\n", cmd)
+	return err
+}
+
+// readOutput continuously reads engine output
+func (e *StockfishEngine) readOutput(stdout *bufio.Scanner, responses chan<- string) {
+	for stdout.Scan() {
+		response := stdout.Text()
+		log.Debug("received response", "response", response)
+		e.record(transcriptReceived, response)
+		responses <- response
+	}
+	close(responses)
+}
+
+// Record writes the engine's UCI conversation from now on to w, in the format
+// of RecordingLauncher's transcripts, one Write per line, or stops recording
+// it if w is nil. Unlike RecordingLauncher it can tap an engine a factory
+// already started, although it misses the conversation before it was called.
+func (e *StockfishEngine) Record(w io.Writer) {
+	e.transcriptLock.Lock()
+	defer e.transcriptLock.Unlock()
+	e.transcript = w
+}
+
+// record writes a line of the conversation to the transcript, if recording.
+// Failing to record never fails the conversation with the engine itself.
+func (e *StockfishEngine) record(prefix, line string) {
+	e.transcriptLock.Lock()
+	defer e.transcriptLock.Unlock()
+	if e.transcript != nil {
+		io.WriteString(e.transcript, prefix+line+"\n")
+	}
+}
+
+// SearchLimits bounds a single engine search. Exactly one of Depth, MoveTime,
+// Nodes, and Mate should be set.
+type SearchLimits struct {
+	Depth    int
+	MoveTime time.Duration
+	Nodes    int64
+	Mate     int           // Searches only for a mate in this many moves, with "go mate"
+	Timeout  time.Duration // How long the search may run before the engine is told to stop
+	MultiPV  int           // Number of best moves to report; 0 or 1 reports only the best move
+	// Contempt is how much worse than even the side to move scores a draw,
+	// in the engine's units: centipawns for Stockfish, which dropped the
+	// option in version 14, and Elo for Lc0. Engines without a Contempt
+	// option ignore it, and 0 keeps the engine's default.
+	Contempt int
+}
+
+// goCommand returns the UCI "go" command for the limits
+func (l SearchLimits) goCommand() string {
+	switch {
+	case l.MoveTime > 0:
+		return fmt.Sprintf("go movetime %d", l.MoveTime.Milliseconds())
+	case l.Nodes > 0:
+		return fmt.Sprintf("go nodes %d", l.Nodes)
+	case l.Mate > 0:
+		return fmt.Sprintf("go mate %d", l.Mate)
+	default:
+		return fmt.Sprintf("go depth %d", l.Depth)
+	}
+}
+
+// SearchInfo holds what the engine reported for a single search
+type SearchInfo struct {
+	BestMove  string
+	Score     Score // From the side to move's perspective
+	WinProb   float64
+	DrawProb  float64
+	LossProb  float64
+	Depth     int
+	SelDepth  int
+	Nodes     int64
+	NPS       int64
+	HashFull  int   // Permille of the hash table in use
+	TBHits    int64 // Positions found in the endgame tablebases
+	TimeSpent time.Duration
+	PV        []string   // Principal variation in UCI notation
+	TopMoves  []string   // First move of each MultiPV line, best first
+	TopScores []Score    // Score of each MultiPV line
+	TopLines  [][]string // Principal variation of each MultiPV line
+}
+
+// ParseInfoLine updates info with the fields present in a UCI "info" line.
+// Lines after the first MultiPV line only contribute their first move,
+// score and principal variation to TopMoves, TopScores and TopLines.
+func ParseInfoLine(line string, info *SearchInfo) {
+	fields := strings.Fields(line)
+	if rank := infoMultiPV(fields); rank > 1 {
+		var alternative SearchInfo
+		parseInfoFields(fields, &alternative)
+		if len(alternative.PV) > 0 {
+			info.setTopLine(rank, alternative.PV, alternative.Score)
+		}
+		return
+	}
+	parseInfoFields(fields, info)
+}
+
+// parseInfoFields updates info with the fields of an info line
+func parseInfoFields(fields []string, info *SearchInfo) {
+	for i := 1; i < len(fields); i++ {
+		switch fields[i] {
+		case "depth":
+			if i+1 < len(fields) {
+				info.Depth, _ = strconv.Atoi(fields[i+1])
+				i++
+			}
+		case "seldepth":
+			if i+1 < len(fields) {
+				info.SelDepth, _ = strconv.Atoi(fields[i+1])
+				i++
+			}
+		case "nodes":
+			if i+1 < len(fields) {
+				info.Nodes, _ = strconv.ParseInt(fields[i+1], 10, 64)
+				i++
+			}
+		case "nps":
+			if i+1 < len(fields) {
+				info.NPS, _ = strconv.ParseInt(fields[i+1], 10, 64)
+				i++
+			}
+		case "hashfull":
+			if i+1 < len(fields) {
+				info.HashFull, _ = strconv.Atoi(fields[i+1])
+				i++
+			}
+		case "tbhits":
+			if i+1 < len(fields) {
+				info.TBHits, _ = strconv.ParseInt(fields[i+1], 10, 64)
+				i++
+			}
+		case "time":
+			if i+1 < len(fields) {
+				ms, _ := strconv.ParseInt(fields[i+1], 10, 64)
+				info.TimeSpent = time.Duration(ms) * time.Millisecond
+				i++
+			}
+		case "score":
+			if i+2 < len(fields) {
+				if value, err := strconv.Atoi(fields[i+2]); err == nil {
+					info.Score = infoScore(fields[i+1], value, info.Score)
+				}
+				i += 2
+			}
+		case "wdl":
+			// Win/draw/loss statistics are reported in permille
+			if i+3 < len(fields) {
+				win, _ := strconv.Atoi(fields[i+1])
+				draw, _ := strconv.Atoi(fields[i+2])
+				loss, _ := strconv.Atoi(fields[i+3])
+				info.WinProb = float64(win) / 1000.0
+				info.DrawProb = float64(draw) / 1000.0
+				info.LossProb = float64(loss) / 1000.0
+				i += 3
+			}
+		case "pv":
+			// The principal variation runs to the end of the line
+			info.PV = append(info.PV[:0], fields[i+1:]...)
+			if len(info.PV) > 0 {
+				info.setTopLine(1, info.PV, info.Score)
+			}
+			return
+		}
+	}
+}
+
+// infoScore returns the score of an info line's "score cp" or "score mate"
+// field, or score if the unit is neither. A mate in 0 means the side to move
+// is already checkmated.
+func infoScore(unit string, value int, score Score) Score {
+	switch {
+	case unit == "cp":
+		return Centipawns(value)
+	case unit == "mate" && value == 0:
+		return Mated()
+	case unit == "mate":
+		return MateIn(value)
+	}
+	return score
+}
+
+// infoMultiPV returns the MultiPV rank of an info line, or 0 if it has none
+func infoMultiPV(fields []string) int {
+	for i := 1; i+1 < len(fields); i++ {
+		switch fields[i] {
+		case "multipv":
+			rank, _ := strconv.Atoi(fields[i+1])
+			return rank
+		case "pv":
+			return 0
+		}
+	}
+	return 0
+}
+
+// setTopLine records the principal variation and score of the MultiPV line
+// with the given rank
+func (info *SearchInfo) setTopLine(rank int, pv []string, score Score) {
+	for len(info.TopMoves) < rank {
+		info.TopMoves = append(info.TopMoves, "")
+		info.TopScores = append(info.TopScores, Score{})
+		info.TopLines = append(info.TopLines, nil)
+	}
+	info.TopMoves[rank-1] = pv[0]
+	info.TopScores[rank-1] = score
+	info.TopLines[rank-1] = append(info.TopLines[rank-1][:0], pv...)
+}
+
+// setMultiPV sets how many lines the engine reports, if it isn't already set to that
+func (e *StockfishEngine) setMultiPV(lines int) {
+	lines = max(lines, 1)
+	if lines == e.multiPV {
+		return
+	}
+	e.sendCommand(fmt.Sprintf("setoption name MultiPV value %d", lines))
+	e.multiPV = lines
+}
+
+// setContempt sets the engine's Contempt option, if it has one and it isn't
+// already set to that; 0 restores the option's default
+func (e *StockfishEngine) setContempt(contempt int) {
+	option := e.info.Option("Contempt")
+	if contempt == e.contempt || option == nil {
+		return
+	}
+	value := strconv.Itoa(contempt)
+	if contempt == 0 {
+		value = option.Default
+	}
+	e.sendCommand(fmt.Sprintf("setoption name %s value %s", option.Name, value))
+	e.contempt = contempt
+}
+
+// SetHash resizes the engine's hash table, if it isn't already that size
+func (e *StockfishEngine) SetHash(mb int) {
+	if mb == e.hashMB {
+		return
+	}
+	e.sendCommand(fmt.Sprintf("setoption name Hash value %d", mb))
+	e.hashMB = mb
+}
+
+// SetThreads sets how many threads the engine searches with, if it isn't
+// already set to that
+func (e *StockfishEngine) SetThreads(threads int) {
+	if threads == e.threads {
+		return
+	}
+	e.sendCommand(fmt.Sprintf("setoption name Threads value %d", threads))
+	e.threads = threads
+}
+
+// readSearch consumes engine output until "bestmove", returning the final search info.
+// If the search overruns the timeout the engine is told to stop, and if it doesn't
+// answer within the grace period it is restarted and ErrEngineTimeout is returned.
+func (e *StockfishEngine) readSearch(timeout time.Duration) (*SearchInfo, error) {
+	return e.watchSearch(context.Background(), timeout, nil)
+}
+
+// watchSearch is readSearch calling progress each time the search reaches a
+// new depth. The engine is also told to stop once ctx is done, and the search
+// info so far is returned when it does.
+func (e *StockfishEngine) watchSearch(ctx context.Context, timeout time.Duration, progress func(*SearchInfo)) (*SearchInfo, error) {
+	if timeout <= 0 {
+		timeout = DefaultEngineTimeout
+	}
+	info := &SearchInfo{}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	stopped := false
+	cancelled := ctx.Done()
+	reported := 0
+	for {
+		select {
+		case response, ok := <-e.responses:
+			if !ok {
+				return nil, fmt.Errorf("engine closed output before bestmove")
+			}
+			if strings.HasPrefix(response, "info ") && !strings.Contains(response, " string ") {
+				ParseInfoLine(response, info)
+				if progress != nil && info.Depth > reported && len(info.PV) > 0 {
+					reported = info.Depth
+					progress(info)
+				}
+			}
+			if strings.HasPrefix(response, "bestmove") {
+				parts := strings.Fields(response)
+				if len(parts) >= 2 {
+					info.BestMove = parts[1]
+				}
+				return info, nil
+			}
+		case <-timer.C:
+			if stopped {
+				if err := e.restart(); err != nil {
+					log.Error("Failed to restart Stockfish", "error", err)
+				}
+				return nil, fmt.Errorf("%w: no response to stop", ErrEngineTimeout)
+			}
+			log.Warn("Engine search overran timeout, sending stop", "timeout", timeout)
+			e.sendCommand("stop")
+			stopped = true
+			timer.Reset(StopGracePeriod)
+		case <-cancelled:
+			cancelled = nil
+			if !stopped {
+				e.sendCommand("stop")
+				stopped = true
+				timer.Reset(StopGracePeriod)
+			}
+		}
+	}
+}
+
+// setPositionBeforeLastMove sends the position before the last of the given moves
+func (e *StockfishEngine) setPositionBeforeLastMove(moves []string) {
+	e.sendLine(e.positionCommand(moves[:len(moves)-1]))
+}
+
+// positionCommand returns the command setting up the position after the moves,
+// in a buffer kept until the next call. Successive plies of a game append to
+// the previous command instead of joining every move again.
+func (e *StockfishEngine) positionCommand(moves []string) []byte {
+	if len(moves) == 0 {
+		return []byte("position startpos")
+	}
+	played := len(e.positionMoves)
+	switch {
+	case played == len(moves) && slices.Equal(e.positionMoves, moves):
+		return e.position
+	case played > 0 && played == len(moves)-1 && slices.Equal(e.positionMoves, moves[:played]):
+		e.position = append(append(e.position, ' '), moves[played]...)
+	default:
+		e.position = append(e.position[:0], "position startpos moves"...)
+		for _, move := range moves {
+			e.position = append(append(e.position, ' '), move...)
+		}
+	}
+	e.positionMoves = append(e.positionMoves[:0], moves...)
+	return e.position
+}
+
+// AnalyzeLastMove analyzes the last of the given moves within the given search limits
+func (e *StockfishEngine) AnalyzeLastMove(moves []string, limits SearchLimits) (*AnalysisResult, error) {
+	if !e.ready {
+		return nil, fmt.Errorf("engine not ready")
+	}
+	if len(moves) == 0 {
+		return nil, fmt.Errorf("no moves provided")
+	}
+
+	// Get the last move
+	lastMove := moves[len(moves)-1]
+
+	// First analysis: Find what the best move would have been from the position before the last move
+	e.setMultiPV(limits.MultiPV)
+	e.setContempt(limits.Contempt)
+	e.setPositionBeforeLastMove(moves)
+	e.sendCommand(limits.goCommand())
+	best, err := e.readSearch(limits.Timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &AnalysisResult{
+		BestMove:              best.BestMove,
+		BestMoveWhiteScore:    best.Score,
+		BestMoveWhiteWinProb:  best.WinProb,
+		BestMoveWhiteDrawProb: best.DrawProb,
+		BestMoveWhiteLossProb: best.LossProb,
+		BestLine:              best.PV,
+		TopMoves:              best.TopMoves,
+		TopLines:              best.TopLines,
+	}
+	if len(result.TopMoves) == 0 && best.BestMove != "" {
+		result.TopMoves = []string{best.BestMove}
+		best.TopScores = []Score{best.Score}
+	}
+	result.TopScores = best.TopScores
+
+	// If the chosen move is different from the best move, evaluate it
+	played := best
+	if best.BestMove != lastMove {
+		// Evaluate the specific last move using searchmoves
+		e.setMultiPV(1)
+		e.setPositionBeforeLastMove(moves)
+		e.sendCommand(fmt.Sprintf("%s searchmoves %s", limits.goCommand(), lastMove))
+		played, err = e.readSearch(limits.Timeout)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// If the chosen move is the best move, this reuses the same score and WDL statistics
+	result.WhiteScore = played.Score
+	result.WhiteWinProb = played.WinProb
+	result.WhiteDrawProb = played.DrawProb
+	result.WhiteLossProb = played.LossProb
+	result.Depth = played.Depth
+	result.SelDepth = played.SelDepth
+	result.Nodes = played.Nodes
+	result.NPS = played.NPS
+	result.HashFull = played.HashFull
+	result.TBHits = played.TBHits
+	result.TimeSpent = played.TimeSpent
+	result.PlayedLine = played.PV
+
+	// If move was black, negate the scores and flip the win/loss probabilities
+	if len(moves)%2 == 0 {
+		result.WhiteScore = result.WhiteScore.Negate()
+		result.WhiteWinProb, result.WhiteLossProb = result.WhiteLossProb, result.WhiteWinProb
+		result.BestMoveWhiteScore = result.BestMoveWhiteScore.Negate()
+		result.BestMoveWhiteWinProb, result.BestMoveWhiteLossProb = result.BestMoveWhiteLossProb, result.BestMoveWhiteWinProb
+	}
+
+	return result, nil
+}
+
+// AnalyzePosition searches the position given as a FEN within the given search limits
+func (e *StockfishEngine) AnalyzePosition(fen string, limits SearchLimits) (*AnalysisResult, error) {
+	if !e.ready {
+		return nil, fmt.Errorf("engine not ready")
+	}
+	e.setMultiPV(limits.MultiPV)
+	e.setContempt(limits.Contempt)
+	e.sendCommand("position fen " + fen)
+	e.sendCommand(limits.goCommand())
+	best, err := e.readSearch(limits.Timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	// Scores are from the side to move's perspective
+	score, win, loss := best.Score, best.WinProb, best.LossProb
+	if fields := strings.Fields(fen); len(fields) > 1 && fields[1] == "b" {
+		score, win, loss = score.Negate(), loss, win
+	}
+	result := &AnalysisResult{
+		WhiteScore:            score,
+		WhiteWinProb:          win,
+		WhiteDrawProb:         best.DrawProb,
+		WhiteLossProb:         loss,
+		BestMove:              best.BestMove,
+		BestMoveWhiteScore:    score,
+		BestMoveWhiteWinProb:  win,
+		BestMoveWhiteDrawProb: best.DrawProb,
+		BestMoveWhiteLossProb: loss,
+		Depth:                 best.Depth,
+		SelDepth:              best.SelDepth,
+		Nodes:                 best.Nodes,
+		NPS:                   best.NPS,
+		HashFull:              best.HashFull,
+		TBHits:                best.TBHits,
+		TimeSpent:             best.TimeSpent,
+		PlayedLine:            best.PV,
+		TopMoves:              best.TopMoves,
+		TopScores:             best.TopScores,
+		TopLines:              best.TopLines,
+	}
+	return result, nil
+}
+
+// Watch searches the position given as a FEN within the given search limits,
+// calling progress each time the search reaches a new depth. The search is
+// stopped once ctx is done, returning what the engine found so far. Scores are
+// from the side to move's perspective.
+func (e *StockfishEngine) Watch(ctx context.Context, fen string, limits SearchLimits, progress func(*SearchInfo)) (*SearchInfo, error) {
+	if !e.ready {
+		return nil, fmt.Errorf("engine not ready")
+	}
+	e.setMultiPV(limits.MultiPV)
+	e.setContempt(limits.Contempt)
+	e.sendCommand("position fen " + fen)
+	e.sendCommand(limits.goCommand())
+	return e.watchSearch(ctx, limits.Timeout, progress)
+}
+
+// Close shuts down the Stockfish engine, killing it if it doesn't exit on its own
+func (e *StockfishEngine) Close() error {
+	e.sendCommand("quit")
+	done := make(chan error, 1)
+	go func() {
+		done <- e.process.Wait()
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(StopGracePeriod):
+		log.Warn("Stockfish did not exit after quit, killing it")
+		e.process.Kill()
+		return <-done
+	}
+}
@@ -0,0 +1,86 @@
+package uciengine
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseInfoLineMultiPV(t *testing.T) {
+	var info SearchInfo
+	ParseInfoLine("info depth 10 multipv 1 score cp 35 wdl 100 850 50 pv e2e4 e7e5", &info)
+	ParseInfoLine("info depth 10 multipv 2 score cp 20 wdl 80 860 60 pv d2d4 d7d5", &info)
+	ParseInfoLine("info depth 10 multipv 3 score mate -4 wdl 0 0 1000 pv f2f3 e7e5", &info)
+	if info.Score != Centipawns(35) || info.WinProb != 0.1 {
+		t.Errorf("expected only the first line to set the score, got %v and %.3f", info.Score, info.WinProb)
+	}
+	if !reflect.DeepEqual(info.TopMoves, []string{"e2e4", "d2d4", "f2f3"}) || !reflect.DeepEqual(info.PV, []string{"e2e4", "e7e5"}) {
+		t.Errorf("unexpected top moves %v and pv %v", info.TopMoves, info.PV)
+	}
+	if !reflect.DeepEqual(info.TopScores, []Score{Centipawns(35), Centipawns(20), MateIn(-4)}) {
+		t.Errorf("unexpected top scores %v", info.TopScores)
+	}
+	if !reflect.DeepEqual(info.TopLines, [][]string{{"e2e4", "e7e5"}, {"d2d4", "d7d5"}, {"f2f3", "e7e5"}}) {
+		t.Errorf("unexpected top lines %v", info.TopLines)
+	}
+}
+
+func TestParseInfoLineDiagnostics(t *testing.T) {
+	var info SearchInfo
+	ParseInfoLine("info depth 24 seldepth 31 multipv 1 score cp 18 nodes 1843551 nps 921775 hashfull 412 tbhits 37 time 2000 pv e2e4", &info)
+	if info.SelDepth != 31 || info.HashFull != 412 || info.TBHits != 37 || info.Nodes != 1843551 {
+		t.Errorf("unexpected diagnostics %+v", info)
+	}
+}
+
+func TestPositionCommand(t *testing.T) {
+	engine := &StockfishEngine{}
+	tests := []struct {
+		moves []string
+		want  string
+	}{
+		{nil, "position startpos"},
+		{[]string{"e2e4"}, "position startpos moves e2e4"},
+		{[]string{"e2e4", "e7e5"}, "position startpos moves e2e4 e7e5"},
+		{[]string{"e2e4", "e7e5"}, "position startpos moves e2e4 e7e5"},
+		{[]string{"d2d4", "d7d5"}, "position startpos moves d2d4 d7d5"},
+		{[]string{"d2d4", "d7d5", "c2c4"}, "position startpos moves d2d4 d7d5 c2c4"},
+	}
+	for _, test := range tests {
+		if command := string(engine.positionCommand(test.moves)); command != test.want {
+			t.Errorf("positionCommand(%v) = %q, want %q", test.moves, command, test.want)
+		}
+	}
+}
+
+func BenchmarkPositionCommand(b *testing.B) {
+	// The plies of a long game, each sent after the one before it
+	moves := make([]string, 200)
+	for i := range moves {
+		moves[i] = []string{"g1f3", "g8f6", "f3g1", "f6g8"}[i%4]
+	}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		engine := &StockfishEngine{}
+		for ply := range moves {
+			engine.positionCommand(moves[:ply+1])
+		}
+	}
+}
+
+func TestGoCommand(t *testing.T) {
+	tests := []struct {
+		limits SearchLimits
+		want   string
+	}{
+		{SearchLimits{Depth: 12}, "go depth 12"},
+		{SearchLimits{MoveTime: 1500 * time.Millisecond}, "go movetime 1500"},
+		{SearchLimits{Nodes: 100000}, "go nodes 100000"},
+		{SearchLimits{Mate: 3}, "go mate 3"},
+	}
+	for _, test := range tests {
+		if command := test.limits.goCommand(); command != test.want {
+			t.Errorf("goCommand(%+v) = %q, want %q", test.limits, command, test.want)
+		}
+	}
+}
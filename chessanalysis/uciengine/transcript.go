@@ -0,0 +1,252 @@
+package uciengine
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Transcripts record a UCI conversation one line per message. Lines sent to the
+// engine are prefixed with "> " and lines received from it with "< ", in the
+// order they were observed.
+const (
+	transcriptSent     = "> "
+	transcriptReceived = "< "
+)
+
+// transcriptWriter writes prefixed lines to a shared transcript
+type transcriptWriter struct {
+	mutex   *sync.Mutex
+	w       io.Writer
+	prefix  string
+	partial []byte
+}
+
+// Write records every complete line in p, buffering any trailing partial line.
+// Failing to record never fails the conversation with the engine itself.
+func (t *transcriptWriter) Write(p []byte) (int, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.partial = append(t.partial, p...)
+	for {
+		i := bytes.IndexByte(t.partial, '\n')
+		if i < 0 {
+			return len(p), nil
+		}
+		line := strings.TrimRight(string(t.partial[:i]), "\r")
+		if _, err := fmt.Fprintf(t.w, "%s%s\n", t.prefix, line); err != nil {
+			log.Warn("Failed to record transcript line", "error", err)
+		}
+		t.partial = t.partial[i+1:]
+	}
+}
+
+// RecordingLauncher wraps launch so the conversation with every started engine is written to w
+func RecordingLauncher(launch Launcher, w io.Writer) Launcher {
+	return func() (*Process, error) {
+		process, err := launch()
+		if err != nil {
+			return nil, err
+		}
+		mutex := &sync.Mutex{}
+		sent := &transcriptWriter{mutex: mutex, w: w, prefix: transcriptSent}
+		received := &transcriptWriter{mutex: mutex, w: w, prefix: transcriptReceived}
+		return &Process{
+			Stdin: struct {
+				io.Writer
+				io.Closer
+			}{io.MultiWriter(sent, process.Stdin), process.Stdin},
+			Stdout: io.TeeReader(process.Stdout, received),
+			Kill:   process.Kill,
+			Wait:   process.Wait,
+		}, nil
+	}
+}
+
+// ReplayLauncher plays back a recorded transcript as the engine. Every command
+// sent must match the next recorded command; the responses recorded after it
+// are then replayed. A mismatch ends the engine's output, failing the search.
+// Options sized to the machine, such as Hash, match whatever their value and
+// may be sent or recorded where the other side has none, so that transcripts
+// replay anywhere.
+func ReplayLauncher(transcript []byte) Launcher {
+	return func() (*Process, error) {
+		commandsReader, commandsWriter := io.Pipe()
+		responsesReader, responsesWriter := io.Pipe()
+		done := make(chan struct{})
+
+		go func() {
+			defer close(done)
+			defer responsesWriter.Close()
+			// Commands sent after the engine exits fail instead of blocking
+			defer commandsReader.Close()
+			replayTranscript(transcript, commandsReader, responsesWriter)
+		}()
+
+		return &Process{
+			Stdin:  commandsWriter,
+			Stdout: responsesReader,
+			Kill: func() {
+				commandsWriter.Close()
+				responsesReader.Close()
+			},
+			Wait: func() error {
+				<-done
+				return nil
+			},
+		}, nil
+	}
+}
+
+// replayTranscript answers commands with the responses recorded after them
+func replayTranscript(transcript []byte, commands io.Reader, responses io.Writer) {
+	lines := strings.Split(strings.TrimRight(string(transcript), "\n"), "\n")
+	next := 0
+
+	// Responses recorded before the first command are sent straight away
+	replayResponses := func() {
+		for next < len(lines) && strings.HasPrefix(lines[next], transcriptReceived) {
+			fmt.Fprintln(responses, strings.TrimPrefix(lines[next], transcriptReceived))
+			next++
+		}
+	}
+	replayResponses()
+
+	scanner := bufio.NewScanner(commands)
+	for scanner.Scan() {
+		command := scanner.Text()
+		// Skip the machine options recorded where none was sent
+		for next < len(lines) && isMachineOption(strings.TrimPrefix(lines[next], transcriptSent)) && !isMachineOption(command) {
+			next++
+			replayResponses()
+		}
+		if next >= len(lines) {
+			log.Error("Replay transcript exhausted", "command", command)
+			return
+		}
+		expected := strings.TrimPrefix(lines[next], transcriptSent)
+		if isMachineOption(command) && optionName(expected) != optionName(command) {
+			// Sent where none was recorded
+			continue
+		}
+		if expected != command && !isMachineOption(command) {
+			log.Error("Replay transcript mismatch", "expected", expected, "command", command, "line", next+1)
+			return
+		}
+		next++
+		replayResponses()
+		if command == "quit" {
+			return
+		}
+	}
+}
+
+// machineOptions are the options whose value depends on the machine
+var machineOptions = []string{"Hash", "Threads"}
+
+// isMachineOption reports whether a command sets one of machineOptions
+func isMachineOption(command string) bool {
+	return slices.Contains(machineOptions, optionName(command))
+}
+
+// optionName returns the name of the option a setoption command sets
+func optionName(command string) string {
+	name, ok := strings.CutPrefix(command, "setoption name ")
+	if !ok {
+		return ""
+	}
+	name, _, _ = strings.Cut(name, " value")
+	return name
+}
+
+// NewRecordingEngine starts Stockfish, writing the UCI conversation to transcript
+func NewRecordingEngine(transcript io.Writer) (*StockfishEngine, error) {
+	return NewEngine(RecordingLauncher(ExecLauncher("stockfish"), transcript))
+}
+
+// NewReplayEngine plays back a recorded UCI transcript as the engine
+func NewReplayEngine(transcript io.Reader) (*StockfishEngine, error) {
+	data, err := io.ReadAll(transcript)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read transcript: %w", err)
+	}
+	return NewEngine(ReplayLauncher(data))
+}
+
+// RecordingEngineFactory starts Stockfish engines that write their UCI conversation
+// to the file at path, replacing any previous recording
+func RecordingEngineFactory(path string) EngineFactory {
+	return func() (Engine, error) {
+		file, err := os.Create(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create transcript: %w", err)
+		}
+		engine, err := NewEngine(closingLauncher(RecordingLauncher(ExecLauncher("stockfish"), file), file))
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		return engine, nil
+	}
+}
+
+// recorder is implemented by engines that can record their UCI conversation
+// once started, as StockfishEngine does
+type recorder interface {
+	Record(w io.Writer)
+}
+
+// RecordingFactory wraps factory so that the engines it starts write their
+// UCI conversation from then on to w, see StockfishEngine.Record. Engines that
+// can't record are started all the same. Several engines may record to the
+// same w at once, so it must be safe for concurrent use.
+func RecordingFactory(factory EngineFactory, w io.Writer) EngineFactory {
+	return func() (Engine, error) {
+		engine, err := factory()
+		if err != nil {
+			return nil, err
+		}
+		if recorder, ok := engine.(recorder); ok {
+			recorder.Record(w)
+		}
+		return engine, nil
+	}
+}
+
+// ReplayEngineFactory starts engines that play back the transcript recorded at path
+func ReplayEngineFactory(path string) EngineFactory {
+	return func() (Engine, error) {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open transcript: %w", err)
+		}
+		defer file.Close()
+		engine, err := NewReplayEngine(file)
+		if err != nil {
+			return nil, err
+		}
+		return engine, nil
+	}
+}
+
+// closingLauncher closes c once the launched engine has exited
+func closingLauncher(launch Launcher, c io.Closer) Launcher {
+	return func() (*Process, error) {
+		process, err := launch()
+		if err != nil {
+			return nil, err
+		}
+		wait := process.Wait
+		process.Wait = func() error {
+			err := wait()
+			c.Close()
+			return err
+		}
+		return process, nil
+	}
+}
@@ -0,0 +1,12 @@
+package uciengine
+
+import "testing"
+
+func TestMachineOptions(t *testing.T) {
+	if !isMachineOption("setoption name Hash value 64") || !isMachineOption("setoption name Threads value 3") {
+		t.Error("expected Hash and Threads to be machine options")
+	}
+	if optionName("setoption name Clear Hash") != "Clear Hash" || isMachineOption("setoption name Clear Hash") {
+		t.Error("expected Clear Hash not to be taken for Hash")
+	}
+}
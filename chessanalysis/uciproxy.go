@@ -0,0 +1,317 @@
+package chessanalysis
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	chess "github.com/corentings/chess/v2"
+	"github.com/walterschell/chess-analyzer/chessanalysis/uciengine"
+)
+
+// UCIProxy lets a chess GUI such as Arena or Cute Chess use a UCI engine
+// through chess-analyzer. The conversation is passed through unchanged, while
+// the engine's evaluation of every position the GUI has it search is recorded.
+// Each game of the session, started by "ucinewgame", is the line of moves the
+// GUI last set up; its moves are classified wherever the positions before and
+// after them were both searched, and Games returns them.
+type UCIProxy struct {
+	launch     uciengine.Launcher
+	classifier MoveClassifier
+
+	mu       sync.Mutex
+	games    []proxyGame
+	evals    map[string]proxyEval // Deepest search of each position, by theoryKey
+	position string               // FEN of the position the GUI set up last
+	searches []string             // FENs of the searches not yet answered, oldest first
+	info     uciengine.SearchInfo // What the oldest search reported so far
+}
+
+// proxyGame is a line of moves set up by the GUI
+type proxyGame struct {
+	start string   // FEN of the starting position
+	moves []string // UCI
+}
+
+// proxyEval is what the engine reported for a position
+type proxyEval struct {
+	score    Score  // From the side to move's perspective
+	bestMove string // UCI
+	depth    int
+}
+
+// NewUCIProxy returns a proxy for the named engine binary, classifying the
+// session's moves with the default classifier
+func NewUCIProxy(engine string) *UCIProxy {
+	return newUCIProxy(uciengine.ExecLauncher(engine))
+}
+
+// newUCIProxy returns a proxy for the engine started by launch
+func newUCIProxy(launch uciengine.Launcher) *UCIProxy {
+	return &UCIProxy{
+		launch:     launch,
+		classifier: DefaultMoveClassifier(),
+		games:      []proxyGame{{start: chess.StartingPosition().String()}},
+		evals:      make(map[string]proxyEval),
+		position:   chess.StartingPosition().String(),
+	}
+}
+
+// Run starts the engine and relays commands from gui to it and its output to
+// guiOut, until the GUI sends "quit" or closes its input
+func (p *UCIProxy) Run(gui io.Reader, guiOut io.Writer) error {
+	process, err := p.launch()
+	if err != nil {
+		return err
+	}
+	output := make(chan error, 1)
+	go func() {
+		output <- p.relayEngine(process.Stdout, guiOut)
+	}()
+
+	commands := bufio.NewScanner(gui)
+	quit := false
+	for !quit && commands.Scan() {
+		command := commands.Text()
+		quit = strings.TrimSpace(command) == "quit"
+		p.observeCommand(command)
+		if _, err := io.WriteString(process.Stdin, command+"\n"); err != nil {
+			process.Kill()
+			return fmt.Errorf("writing to engine: %w", err)
+		}
+	}
+	if !quit {
+		// The GUI went away without saying goodbye
+		io.WriteString(process.Stdin, "quit\n")
+	}
+	process.Stdin.Close()
+
+	select {
+	case err = <-output:
+	case <-time.After(uciengine.StopGracePeriod):
+		process.Kill()
+		err = <-output
+	}
+	process.Wait()
+	return err
+}
+
+// relayEngine copies the engine's output to the GUI, recording its searches
+func (p *UCIProxy) relayEngine(engine io.Reader, guiOut io.Writer) error {
+	responses := bufio.NewScanner(engine)
+	for responses.Scan() {
+		response := responses.Text()
+		p.observeResponse(response)
+		if _, err := io.WriteString(guiOut, response+"\n"); err != nil {
+			return fmt.Errorf("writing to GUI: %w", err)
+		}
+	}
+	return responses.Err()
+}
+
+// observeCommand follows the positions the GUI sets up and searches
+func (p *UCIProxy) observeCommand(command string) {
+	fields := strings.Fields(command)
+	if len(fields) == 0 {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	switch fields[0] {
+	case "ucinewgame":
+		if current := p.games[len(p.games)-1]; len(current.moves) > 0 {
+			p.games = append(p.games, proxyGame{start: chess.StartingPosition().String()})
+		}
+	case "position":
+		line, position, err := parseUCIPosition(fields[1:])
+		if err != nil {
+			log.Warn("Ignoring position the proxy can't follow", "command", command, "error", err)
+			return
+		}
+		p.position = position
+		current := &p.games[len(p.games)-1]
+		// Stepping back through the game keeps the moves already played
+		if line.start != current.start || len(line.moves) >= len(current.moves) || !slices.Equal(line.moves, current.moves[:len(line.moves)]) {
+			*current = line
+		}
+	case "go":
+		p.searches = append(p.searches, p.position)
+	}
+}
+
+// observeResponse records the search results the engine reports
+func (p *UCIProxy) observeResponse(response string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.searches) == 0 {
+		return
+	}
+	switch {
+	case strings.HasPrefix(response, "info ") && !strings.Contains(response, " string "):
+		uciengine.ParseInfoLine(response, &p.info)
+	case strings.HasPrefix(response, "bestmove"):
+		fen := p.searches[0]
+		p.searches = p.searches[1:]
+		if parts := strings.Fields(response); len(parts) >= 2 && parts[1] != "(none)" {
+			p.record(fen, proxyEval{score: p.info.Score, bestMove: parts[1], depth: p.info.Depth})
+			p.recordReply(fen, parts[1])
+		}
+		p.info = uciengine.SearchInfo{}
+	}
+}
+
+// record keeps the search of a position unless a deeper one was recorded
+func (p *UCIProxy) record(fen string, eval proxyEval) {
+	key := theoryKey(fen)
+	if eval.depth >= p.evals[key].depth {
+		p.evals[key] = eval
+	}
+}
+
+// recordReply records the engine's expected reply to its best move, from the
+// principal variation of the search just finished. When the engine plays
+// against the user, the positions the user moves from are never searched
+// themselves, and this is what their moves are judged by.
+func (p *UCIProxy) recordReply(fen, bestMove string) {
+	pv := p.info.PV
+	if len(pv) < 2 || pv[0] != bestMove || p.info.Depth < 2 {
+		return
+	}
+	position, err := positionFromFEN(fen)
+	if err != nil {
+		return
+	}
+	move, err := chess.UCINotation{}.Decode(position, bestMove)
+	if err != nil {
+		return
+	}
+	p.record(position.Update(move).String(), proxyEval{score: p.info.Score.Negate(), bestMove: pv[1], depth: p.info.Depth - 1})
+}
+
+// parseUCIPosition returns the line of moves set up by the arguments of a
+// position command and the FEN of the position it leads to
+func parseUCIPosition(args []string) (proxyGame, string, error) {
+	if len(args) == 0 {
+		return proxyGame{}, "", fmt.Errorf("missing position")
+	}
+	var line proxyGame
+	rest := args[1:]
+	switch args[0] {
+	case "startpos":
+		line.start = chess.StartingPosition().String()
+	case "fen":
+		end := slices.Index(rest, "moves")
+		if end < 0 {
+			end = len(rest)
+		}
+		line.start = strings.Join(rest[:end], " ")
+		rest = rest[end:]
+	default:
+		return proxyGame{}, "", fmt.Errorf("unknown position type %q", args[0])
+	}
+	position, err := positionFromFEN(line.start)
+	if err != nil {
+		return proxyGame{}, "", err
+	}
+	if len(rest) > 0 && rest[0] == "moves" {
+		line.moves = rest[1:]
+	}
+	for _, uci := range line.moves {
+		move, err := chess.UCINotation{}.Decode(position, uci)
+		if err != nil {
+			return proxyGame{}, "", fmt.Errorf("illegal move %s: %w", uci, err)
+		}
+		position = position.Update(move)
+	}
+	return line, position.String(), nil
+}
+
+// Games returns the analysis of each game of the session so far. Moves whose
+// positions weren't both searched have no evaluation or classification.
+func (p *UCIProxy) Games() [][]MoveAnalysis {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var games [][]MoveAnalysis
+	for _, game := range p.games {
+		if len(game.moves) > 0 {
+			games = append(games, p.analyzeGame(game))
+		}
+	}
+	return games
+}
+
+// analyzeGame turns the searches recorded for a game's positions into an
+// analysis of its moves. The caller must hold the lock.
+func (p *UCIProxy) analyzeGame(game proxyGame) []MoveAnalysis {
+	position, err := positionFromFEN(game.start)
+	if err != nil {
+		return nil
+	}
+	moves := make([]MoveAnalysis, 0, len(game.moves))
+	for _, uci := range game.moves {
+		move, err := chess.UCINotation{}.Decode(position, uci)
+		if err != nil {
+			break
+		}
+		after := position.Update(move)
+		analysis := MoveAnalysis{
+			MoveNumber: fullMoveNumber(position.String()),
+			Color:      "White",
+			MoveText:   moveToSan(position, move),
+			FENBefore:  position.String(),
+			FENAfter:   after.String(),
+		}
+		if position.Turn() == chess.Black {
+			analysis.Color = "Black"
+		}
+		before, searchedBefore := p.evals[theoryKey(analysis.FENBefore)]
+		reply, searchedAfter := p.evals[theoryKey(analysis.FENAfter)]
+		if searchedBefore && searchedAfter {
+			p.evaluate(&analysis, position, uci, before, reply)
+		}
+		moves = append(moves, analysis)
+		position = after
+	}
+	return moves
+}
+
+// fullMoveNumber returns the move number field of a FEN
+func fullMoveNumber(fen string) int {
+	fields := strings.Fields(fen)
+	if len(fields) < 6 {
+		return 1
+	}
+	number, err := strconv.Atoi(fields[5])
+	if err != nil || number < 1 {
+		return 1
+	}
+	return number
+}
+
+// evaluate fills in a move's scores from the searches of the positions before
+// and after it, and classifies it
+func (p *UCIProxy) evaluate(analysis *MoveAnalysis, position *chess.Position, uci string, before, after proxyEval) {
+	// Scores are from the side to move's perspective
+	beforeScore, afterScore := before.score, after.score.Negate()
+	if analysis.Color == "Black" {
+		beforeScore, afterScore = beforeScore.Negate(), afterScore.Negate()
+	}
+	analysis.PreviousWhiteScore = beforeScore
+	analysis.WhiteScore = afterScore
+	analysis.BestMoveWhiteScore = analysis.PreviousWhiteScore
+	analysis.PreviousWhiteWinProb, analysis.PreviousWhiteDrawProb, analysis.PreviousWhiteLossProb = scoreWDL(beforeScore)
+	analysis.BestMoveWhiteWinProb, analysis.BestMoveWhiteDrawProb, analysis.BestMoveWhiteLossProb = scoreWDL(beforeScore)
+	analysis.WhiteWinProb, analysis.WhiteDrawProb, analysis.WhiteLossProb = scoreWDL(afterScore)
+	analysis.BestMove = before.bestMove
+	analysis.IsBestMove = uci == before.bestMove
+	analysis.Depth = after.depth
+	if best, err := (chess.UCINotation{}).Decode(position, before.bestMove); err == nil {
+		analysis.BestMoveSAN = moveToSan(position, best)
+	}
+	analysis.Classification = p.classifier.ClassifyMove(analysis)
+}
@@ -0,0 +1,87 @@
+package chessanalysis
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/walterschell/chess-analyzer/chessanalysis/uciengine"
+)
+
+func TestUCIProxy(t *testing.T) {
+	const afterE4 = "rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq e3 0 1"
+	fake := &FakeEngine{Positions: map[string]FakeEvaluation{
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1": {BestMove: "d2d4", Score: 30},
+		afterE4: {BestMove: "c7c5", Score: 300},
+	}}
+	proxy := newUCIProxy(fake.launch)
+	guiIn, commands := io.Pipe()
+	responses, guiOut := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		done <- proxy.Run(guiIn, guiOut)
+		guiOut.Close()
+	}()
+	output := bufio.NewScanner(responses)
+	// send sends a command and, like a GUI, waits for the engine's answer to
+	// it, or for the engine to be ready again if it doesn't answer
+	send := func(command, answer string) {
+		t.Helper()
+		if answer == "" {
+			command, answer = command+"\nisready", "readyok"
+		}
+		if _, err := io.WriteString(commands, command+"\n"); err != nil {
+			t.Fatalf("failed to send %q: %v", command, err)
+		}
+		for output.Scan() {
+			if strings.HasPrefix(output.Text(), answer) {
+				return
+			}
+		}
+		t.Fatalf("no %q in answer to %q", answer, command)
+	}
+
+	send("uci", "uciok")
+	send("isready", "readyok")
+	send("ucinewgame", "")
+	// Analyzing a game move by move
+	send("position startpos", "")
+	send("go depth 3", "bestmove")
+	send("position startpos moves e2e4", "")
+	send("go depth 3", "bestmove")
+	send("position startpos moves e2e4 e7e5", "")
+	send("go depth 3", "bestmove")
+	send("position startpos moves e2e4", "")
+	send("ucinewgame", "")
+	// Playing against the engine, which searches only its own turns
+	send("position startpos", "")
+	send("go depth 3", "bestmove")
+	send("position startpos moves d2d4 g8f6", "")
+	send("go depth 3", "bestmove")
+	io.WriteString(commands, "quit\n")
+	for output.Scan() {
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	games := proxy.Games()
+	if len(games) != 2 || len(games[0]) != 2 || len(games[1]) != 2 {
+		t.Fatalf("expected two games of two moves, got %+v", games)
+	}
+	e4, e5 := &games[0][0], &games[0][1]
+	if e4.Classification != Blunder || e4.WhiteScore != uciengine.Pawns(-3) || e4.BestMoveSAN != "d4" {
+		t.Errorf("expected 1. e4 to be a blunder with d4 best, got %+v", e4)
+	}
+	if e5.Classification != Blunder || e5.PreviousWhiteScore != uciengine.Pawns(-3) || e5.BestMoveSAN != "c5" {
+		t.Errorf("expected 1... e5 to throw away Black's advantage, got %+v", e5)
+	}
+	d4, nf6 := &games[1][0], &games[1][1]
+	if !d4.IsBestMove || d4.Depth == 0 {
+		t.Errorf("expected the engine's 1. d4 to be best, got %+v", d4)
+	}
+	if nf6.Depth == 0 {
+		t.Errorf("expected the user's 1... Nf6 to be judged by the engine's expected reply, got %+v", nf6)
+	}
+}
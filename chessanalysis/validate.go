@@ -0,0 +1,184 @@
+package chessanalysis
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	chess "github.com/corentings/chess/v2"
+)
+
+// PGNValidation is what ValidatePGN found in a PGN database
+type PGNValidation struct {
+	Valid bool             `json:"valid"` // Whether every game can be analyzed
+	Games []GameValidation `json:"games"`
+}
+
+// GameValidation is a game of a PGN database as ValidatePGN found it
+type GameValidation struct {
+	Line  int               `json:"line"` // Line of the database the game starts on, from 1
+	Tags  map[string]string `json:"tags"`
+	Plies int               `json:"plies"` // Moves of the game, or before its error
+	Error *PGNSyntaxError   `json:"error,omitempty"`
+}
+
+// PGNSyntaxError is why a game can't be parsed and, when it can be found,
+// where in the database
+type PGNSyntaxError struct {
+	Message string `json:"message"`
+	Line    int    `json:"line,omitempty"`   // From 1, or 0 if the location isn't known
+	Column  int    `json:"column,omitempty"` // In characters, from 1
+	Ply     int    `json:"ply,omitempty"`    // Of the move in error, from 1
+	Token   string `json:"token,omitempty"`  // The text in error
+}
+
+// ValidatePGN parses every game of a PGN database without analyzing it,
+// reporting the tags and length of each, and where a game that can't be
+// parsed goes wrong. It is quick enough to check a PGN as it is typed.
+func ValidatePGN(pgn string) *PGNValidation {
+	validation := &PGNValidation{Games: []GameValidation{}}
+	games, err := SplitPGN(pgn)
+	if err != nil && strings.TrimSpace(pgn) != "" {
+		// Movetext without tags is a single game
+		games = []string{pgn}
+	}
+	offset := 0
+	for _, game := range games {
+		start := offset
+		if i := strings.Index(pgn[offset:], game); i >= 0 {
+			start = offset + i
+			offset = start + len(game)
+		}
+		validated := validateGame(game)
+		validated.Line = strings.Count(pgn[:start], "\n") + 1
+		if validated.Error != nil && validated.Error.Line > 0 {
+			// Make the location relative to the database
+			if validated.Error.Line == 1 {
+				validated.Error.Column += utf8.RuneCountInString(pgn[strings.LastIndex(pgn[:start], "\n")+1 : start])
+			}
+			validated.Error.Line += validated.Line - 1
+		}
+		validation.Games = append(validation.Games, validated)
+	}
+	validation.Valid = len(validation.Games) > 0
+	for _, game := range validation.Games {
+		if game.Error != nil {
+			validation.Valid = false
+		}
+	}
+	return validation
+}
+
+// validateGame parses a single game, locating its error if it has one
+func validateGame(pgn string) GameValidation {
+	validation := GameValidation{Tags: parsePGNHeaders(pgn)}
+	moves, err := parseMainline(pgn)
+	if err == nil {
+		validation.Plies = len(moves)
+		return validation
+	}
+	plies, located := locatePGNError(pgn, validation.Tags["FEN"])
+	if located == nil {
+		// The error is somewhere the movetext walk doesn't look
+		validation.Error = &PGNSyntaxError{Message: err.Error()}
+		return validation
+	}
+	validation.Plies, validation.Error = plies, located
+	return validation
+}
+
+// locatePGNError walks the movetext of a game, playing each move from the
+// starting position, or fen if there is one, and returns the number of
+// moves before the first that isn't legal along with where it is. Comments,
+// variations and annotations are skipped, not checked.
+func locatePGNError(pgn, fen string) (int, *PGNSyntaxError) {
+	position := chess.StartingPosition()
+	if fen != "" {
+		var err error
+		if position, err = positionFromFEN(fen); err != nil {
+			return 0, &PGNSyntaxError{Message: err.Error()}
+		}
+	}
+	at := func(offset int, message, token string, ply int) *PGNSyntaxError {
+		line := strings.Count(pgn[:offset], "\n") + 1
+		column := utf8.RuneCountInString(pgn[strings.LastIndex(pgn[:offset], "\n")+1:offset]) + 1
+		return &PGNSyntaxError{Message: message, Line: line, Column: column, Ply: ply, Token: token}
+	}
+
+	plies := 0
+	for i := 0; i < len(pgn); {
+		c := pgn[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n' || c == '.':
+			i++
+		case c == '[':
+			// A tag pair, up to the end of its line
+			end := strings.IndexByte(pgn[i:], '\n')
+			if end < 0 {
+				end = len(pgn) - i
+			}
+			i += end
+		case c == ';':
+			end := strings.IndexByte(pgn[i:], '\n')
+			if end < 0 {
+				end = len(pgn) - i
+			}
+			i += end
+		case c == '{':
+			end := strings.IndexByte(pgn[i:], '}')
+			if end < 0 {
+				return plies, at(i, "unterminated comment", "{", 0)
+			}
+			i += end + 1
+		case c == '(':
+			depth, j := 0, i
+			for ; j < len(pgn); j++ {
+				if pgn[j] == '(' {
+					depth++
+				} else if pgn[j] == ')' {
+					depth--
+				}
+				if depth == 0 {
+					break
+				}
+			}
+			if j == len(pgn) {
+				return plies, at(i, "unterminated variation", "(", 0)
+			}
+			i = j + 1
+		case c == ')':
+			return plies, at(i, "unmatched end of variation", ")", 0)
+		default:
+			end := i
+			for end < len(pgn) && !strings.ContainsRune(" \t\r\n{}();", rune(pgn[end])) {
+				end++
+			}
+			token := pgn[i:end]
+			switch {
+			case token == "1-0" || token == "0-1" || token == "1/2-1/2" || token == "*":
+			case strings.HasPrefix(token, "$"):
+			case strings.Trim(token, "0123456789.") == "":
+				// A move number
+			case isNullMove(token):
+				next, err := passTurn(position)
+				if err != nil {
+					return plies, at(i, err.Error(), token, plies+1)
+				}
+				position = next
+				plies++
+			default:
+				// Strip the move number of "12.e4" and trailing annotations
+				san := strings.TrimLeft(token, "0123456789.")
+				san = strings.TrimRight(san, "!?")
+				move, err := chess.AlgebraicNotation{}.Decode(position, san)
+				if err != nil {
+					return plies, at(i+strings.Index(token, san), fmt.Sprintf("illegal or unknown move %q", san), san, plies+1)
+				}
+				position = position.Update(move)
+				plies++
+			}
+			i = end
+		}
+	}
+	return plies, nil
+}
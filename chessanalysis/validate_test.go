@@ -0,0 +1,42 @@
+package chessanalysis
+
+import (
+	"testing"
+)
+
+func TestValidatePGN(t *testing.T) {
+	pgn := `[Event "First"]
+[White "Player 1"]
+[Result "1-0"]
+
+1. e4 e5 2. Qh5 Nc6 3. Bc4 Nf6 4. Qxf7# 1-0
+
+[Event "Second"]
+[Result "*"]
+
+1. e4 {[%clk 0:03:00]} e5 (1... c5 2. Nf3) 2. Nf3 Nc6
+3. Bb5 a6 4. Ke3 dxc6 *
+`
+	validation := ValidatePGN(pgn)
+	if validation.Valid || len(validation.Games) != 2 {
+		t.Fatalf("expected two games, one invalid, got %+v", validation)
+	}
+	first, second := validation.Games[0], validation.Games[1]
+	if first.Line != 1 || first.Plies != 7 || first.Tags["White"] != "Player 1" || first.Error != nil {
+		t.Errorf("unexpected first game %+v", first)
+	}
+	if second.Line != 7 || second.Tags["Event"] != "Second" || second.Plies != 6 {
+		t.Errorf("unexpected second game %+v", second)
+	}
+	if err := second.Error; err == nil || err.Line != 11 || err.Column != 14 || err.Ply != 7 || err.Token != "Ke3" {
+		t.Errorf("expected the illegal 4. Ke3 to be located, got %+v", err)
+	}
+
+	if validation := ValidatePGN(`[Event "Unterminated"]` + "\n\n1. e4 { a comment\n"); validation.Valid ||
+		validation.Games[0].Error == nil || validation.Games[0].Error.Line != 3 || validation.Games[0].Error.Column != 7 {
+		t.Errorf("expected the unterminated comment to be located, got %+v", validation.Games[0].Error)
+	}
+	if validation := ValidatePGN(""); validation.Valid || len(validation.Games) != 0 {
+		t.Errorf("expected no games in an empty PGN, got %+v", validation)
+	}
+}
@@ -0,0 +1,141 @@
+package chessanalysis
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	chess "github.com/corentings/chess/v2"
+)
+
+// maxAnalyzedVariations is how many sidelines of a game are analyzed; those
+// after them are left out
+const maxAnalyzedVariations = 50
+
+// Variation is the analysis of a sideline of a game, such as those of the
+// chapters of a Lichess study. Its moves are analyzed as a game played along
+// the line from the start, so their scores and classifications read as the
+// game's do.
+type Variation struct {
+	// Ply is the index, within the line it branches from, of the move its
+	// first move was played instead of
+	Ply   int            `json:"ply"`
+	Moves []MoveAnalysis `json:"moves"`
+	// Variations are the sidelines branching from this one, their Ply
+	// within its Moves
+	Variations []Variation `json:"variations,omitempty"`
+}
+
+// WithVariations analyzes the sidelines of games as well as their mainline,
+// into GameAnalysis.Variations, see AnalyzeVariations. Only AnalyzeGame
+// and the functions built on it analyze them.
+func WithVariations() AnalyzeChessGameOption {
+	return func(opts *AnalyzeChessGameOptions) {
+		opts.Variations = true
+	}
+}
+
+// AnalyzeVariations analyzes the sidelines of the PGN's game, and the
+// sidelines of those, keeping the tree of the PGN. Each line is analyzed as
+// a game from the start with the given options, sharing a SearchCache so
+// that the moves lines have in common are searched once; give the one the
+// mainline was analyzed with to reuse its searches too. Up to
+// maxAnalyzedVariations are analyzed, and sidelines that fail to analyze are
+// left out. Games with null moves have none analyzed.
+func AnalyzeVariations(pgn string, opts ...AnalyzeChessGameOption) ([]Variation, error) {
+	analysisOpts, err := ResolveOptions(opts...)
+	if err != nil {
+		return nil, err
+	}
+	if analysisOpts.SearchCache == nil {
+		opts = append(slices.Clip(opts), WithSearchCache(NewSearchCache()))
+	}
+	if containsNullMove(pgn) {
+		log.Warn("Not analyzing the variations of a game with null moves")
+		return nil, nil
+	}
+	pgnOpt, err := chess.PGN(strings.NewReader(pgn))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPGN, err)
+	}
+	headers := parsePGNHeaders(pgn)
+	// The lines end wherever they do, not with the game's result
+	headers["Result"] = "*"
+	remaining := maxAnalyzedVariations
+	return analyzeVariations(chess.NewGame(pgnOpt).GetRootMove(), nil, 0, headers, &remaining, opts)
+}
+
+// analyzeVariations analyzes the sidelines branching from the line that
+// follows node's first children, where path is the moves played to reach
+// node and ply the index of its children within the line. remaining counts
+// down the sidelines still to be analyzed.
+func analyzeVariations(node *chess.Move, path []*chess.Move, ply int, headers map[string]string, remaining *int, opts []AnalyzeChessGameOption) ([]Variation, error) {
+	var variations []Variation
+	for ; len(node.Children()) > 0; ply++ {
+		for _, sideline := range node.Children()[1:] {
+			if *remaining == 0 {
+				log.Warn("Too many variations, leaving the rest out", "analyzed", maxAnalyzedVariations)
+				return variations, nil
+			}
+			*remaining--
+			variation, err := analyzeVariation(sideline, path, ply, headers, remaining, opts)
+			if errors.Is(err, ErrAnalysisCancelled) {
+				return nil, err
+			}
+			if err != nil {
+				log.Warn("Failed to analyze variation", "ply", ply, "error", err)
+				continue
+			}
+			variations = append(variations, variation)
+		}
+		node = node.Children()[0]
+		path = append(slices.Clip(path), node)
+	}
+	return variations, nil
+}
+
+// analyzeVariation analyzes the sideline starting with first, played
+// instead of the move at ply after path, and the sidelines branching from it
+func analyzeVariation(first *chess.Move, path []*chess.Move, ply int, headers map[string]string, remaining *int, opts []AnalyzeChessGameOption) (Variation, error) {
+	line := append(slices.Clip(path), first)
+	for end := first; len(end.Children()) > 0; {
+		end = end.Children()[0]
+		line = append(line, end)
+	}
+	moves, err := AnalyzeChessGame(linePGN(headers, line), opts...)
+	if err != nil {
+		return Variation{}, err
+	}
+	variation := Variation{Ply: ply, Moves: moves[min(len(path), len(moves)):]}
+	variation.Variations, err = analyzeVariations(first, append(slices.Clip(path), first), 1, headers, remaining, opts)
+	return variation, err
+}
+
+// linePGN writes the PGN of a game with the headers and the moves of line,
+// which starts from the game's first move
+func linePGN(headers map[string]string, line []*chess.Move) string {
+	var pgn strings.Builder
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		fmt.Fprintf(&pgn, "[%s \"%s\"]\n", name, headers[name])
+	}
+	pgn.WriteString("\n")
+	for i, move := range line {
+		before := move.Parent().Position()
+		number := strings.Fields(before.String())[5]
+		switch {
+		case before.Turn() == chess.White:
+			fmt.Fprintf(&pgn, "%s. ", number)
+		case i == 0:
+			fmt.Fprintf(&pgn, "%s... ", number)
+		}
+		pgn.WriteString(moveToSan(before, move) + " ")
+	}
+	pgn.WriteString("*\n")
+	return pgn.String()
+}
@@ -0,0 +1,79 @@
+package chessanalysis
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// studyChapterPgn is a chapter with a sideline, which has one of its own,
+// and a sideline of Black's
+const studyChapterPgn = "[Event \"Openings: Open games\"]\n[Result \"*\"]\n\n" +
+	"1. e4 (1. d4 d5 2. c4 (2. Nf3 Nf6) 2... e6) 1... e5 2. Nf3 (2. Bc4) 2... Nc6 *"
+
+// variationMoves returns the moves of the variation in SAN
+func variationMoves(variation Variation) []string {
+	var moves []string
+	for _, move := range variation.Moves {
+		moves = append(moves, move.MoveText)
+	}
+	return moves
+}
+
+func TestAnalyzeVariations(t *testing.T) {
+	game, err := AnalyzeGame(studyChapterPgn, WithDepth(1), WithEngineFactory((&FakeEngine{}).NewEngine), WithVariations())
+	if err != nil {
+		t.Fatalf("failed to analyze game: %v", err)
+	}
+	if len(game.Moves) != 4 || len(game.Variations) != 2 {
+		t.Fatalf("expected 4 moves and 2 variations, got %d and %+v", len(game.Moves), game.Variations)
+	}
+	queens, bishop := game.Variations[0], game.Variations[1]
+	if queens.Ply != 0 || !reflect.DeepEqual(variationMoves(queens), []string{"d4", "d5", "c4", "e6"}) {
+		t.Errorf("unexpected first variation at %d: %v", queens.Ply, variationMoves(queens))
+	}
+	if len(queens.Variations) != 1 || queens.Variations[0].Ply != 2 ||
+		!reflect.DeepEqual(variationMoves(queens.Variations[0]), []string{"Nf3", "Nf6"}) {
+		t.Errorf("unexpected nested variations %+v", queens.Variations)
+	}
+	if bishop.Ply != 2 || !reflect.DeepEqual(variationMoves(bishop), []string{"Bc4"}) {
+		t.Errorf("unexpected second variation at %d: %v", bishop.Ply, variationMoves(bishop))
+	}
+	if bishop.Moves[0].FENBefore != game.Moves[1].FENAfter || bishop.Moves[0].MoveNumber != 2 {
+		t.Errorf("expected 2. Bc4 to be played after 1... e5, got %s", bishop.Moves[0].FENBefore)
+	}
+
+	data, err := json.Marshal(game)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded GameAnalysis
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded.Variations) != 2 || len(decoded.Variations[0].Variations) != 1 {
+		t.Errorf("expected the tree to survive JSON, got %+v", decoded.Variations)
+	}
+
+	// Without the option only the mainline is analyzed
+	if game, err = AnalyzeGame(studyChapterPgn, WithDepth(1), WithEngineFactory((&FakeEngine{}).NewEngine)); err != nil || game.Variations != nil {
+		t.Errorf("expected no variations, got %+v, %v", game.Variations, err)
+	}
+}
+
+func TestAnalyzeVariationsFromPosition(t *testing.T) {
+	// Black to move in a rook ending, with a sideline of White's
+	const pgn = "[FEN \"8/8/4k3/8/8/4K3/R7/7r b - - 10 40\"]\n[SetUp \"1\"]\n[Result \"*\"]\n\n" +
+		"40... Rh3+ 41. Kd4 (41. Ke2 Rh2+) 41... Rh4+ *"
+	variations, err := AnalyzeVariations(pgn, WithDepth(1), WithEngineFactory((&FakeEngine{}).NewEngine))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(variations) != 1 || !reflect.DeepEqual(variationMoves(variations[0]), []string{"Ke2", "Rh2+"}) {
+		t.Fatalf("unexpected variations %+v", variations)
+	}
+	if fen := variations[0].Moves[0].FENBefore; variations[0].Ply != 1 || !strings.HasPrefix(fen, "8/8/4k3/8/8/4K2r/R7/8 w") {
+		t.Errorf("expected 41. Ke2 to be played after 40... Rh3+, got ply %d from %s", variations[0].Ply, fen)
+	}
+}
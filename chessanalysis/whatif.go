@@ -0,0 +1,127 @@
+package chessanalysis
+
+import (
+	"fmt"
+
+	chess "github.com/corentings/chess/v2"
+)
+
+// WhatIf is the engine's view of an alternative to one of a game's moves,
+// next to the move played and the engine's best move, see AnalyzeWhatIf
+type WhatIf struct {
+	Ply           int     `json:"ply"`  // Index of the replaced move within the game
+	Move          string  `json:"move"` // The alternative in SAN
+	UCI           string  `json:"uci"`
+	WhiteScore    Score   `json:"whiteScore"`
+	WhiteWinProb  float64 `json:"whiteWinProb"`
+	WhiteDrawProb float64 `json:"whiteDrawProb"`
+	WhiteLossProb float64 `json:"whiteLossProb"`
+	Depth         int     `json:"depth"`
+	// Continuation is the engine's line after the alternative, in SAN
+	Continuation   []string `json:"continuation,omitempty"`
+	TerminalStatus string   `json:"terminalStatus,omitempty"` // See MoveAnalysis.TerminalStatus
+	// Classification is how the alternative would have been classified
+	Classification     string `json:"classification"`
+	Played             string `json:"played"` // The move played in SAN
+	PlayedWhiteScore   Score  `json:"playedWhiteScore"`
+	BestMove           string `json:"bestMove"` // SAN
+	BestMoveWhiteScore Score  `json:"bestMoveWhiteScore"`
+	// VersusPlayed and VersusBest are how many percentage points of the
+	// mover's expected score the alternative gains over the move played and
+	// over the best move, negative where it does worse
+	VersusPlayed float64 `json:"versusPlayed"`
+	VersusBest   float64 `json:"versusBest"`
+}
+
+// AnalyzeWhatIf searches an alternative, in SAN or UCI, to the move at ply of
+// an analyzed game, and compares it with the move played and the engine's
+// best move there. The alternative is searched with the given options, which
+// should match those of the game's analysis for a fair comparison.
+func AnalyzeWhatIf(game *GameAnalysis, ply int, alternative string, opts ...AnalyzeChessGameOption) (*WhatIf, error) {
+	analysisOpts, err := ResolveOptions(opts...)
+	if err != nil {
+		return nil, err
+	}
+	if ply < 0 || ply >= len(game.Moves) {
+		return nil, fmt.Errorf("%w: ply %d of a game of %d moves", ErrInvalidOptions, ply, len(game.Moves))
+	}
+	if err := analysisOpts.Context.Err(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrAnalysisCancelled, err)
+	}
+	played := &game.Moves[ply]
+	before, err := positionFromFEN(played.FENBefore)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPGN, err)
+	}
+	move, err := decodeMove(before, alternative)
+	if err != nil {
+		return nil, err
+	}
+	uci := moveToUci(before, move)
+	after := before.Update(move)
+
+	whatIf := &WhatIf{
+		Ply:                ply,
+		Move:               moveToSan(before, move),
+		UCI:                uci,
+		Played:             played.MoveText,
+		PlayedWhiteScore:   played.WhiteScore,
+		BestMove:           played.BestMoveSAN,
+		BestMoveWhiteScore: played.BestMoveWhiteScore,
+	}
+	terminal := terminalMethod(after)
+	whatIf.TerminalStatus = terminalStatus(terminal)
+	var result *AnalysisResult
+	switch terminal {
+	case chess.NoMethod:
+		engine, err := analysisOpts.startEngine()
+		if err != nil {
+			return nil, err
+		}
+		defer engine.Close()
+		if result, err = engine.AnalyzePosition(after.String(), analysisOpts.searchLimits()); err != nil {
+			return nil, fmt.Errorf("searching %s: %w", whatIf.Move, err)
+		}
+		whatIf.Continuation = uciLineToSan(after, result.PlayedLine)
+	case chess.Checkmate:
+		result = checkmateResult(uci, played.Color, analysisOpts.Depth)
+	default:
+		result = &AnalysisResult{WhiteDrawProb: 1}
+	}
+	whatIf.WhiteScore = result.WhiteScore
+	whatIf.WhiteWinProb, whatIf.WhiteDrawProb, whatIf.WhiteLossProb = result.WhiteWinProb, result.WhiteDrawProb, result.WhiteLossProb
+	whatIf.Depth = result.Depth
+
+	alternativeMove := MoveAnalysis{
+		MoveNumber:            played.MoveNumber,
+		Color:                 played.Color,
+		MoveText:              whatIf.Move,
+		Phase:                 played.Phase,
+		FENBefore:             played.FENBefore,
+		FENAfter:              after.String(),
+		PreviousWhiteScore:    played.PreviousWhiteScore,
+		PreviousWhiteWinProb:  played.PreviousWhiteWinProb,
+		PreviousWhiteDrawProb: played.PreviousWhiteDrawProb,
+		PreviousWhiteLossProb: played.PreviousWhiteLossProb,
+		WhiteScore:            whatIf.WhiteScore,
+		WhiteWinProb:          whatIf.WhiteWinProb,
+		WhiteDrawProb:         whatIf.WhiteDrawProb,
+		WhiteLossProb:         whatIf.WhiteLossProb,
+		BestMove:              played.BestMove,
+		BestMoveSAN:           played.BestMoveSAN,
+		BestMoveWhiteScore:    played.BestMoveWhiteScore,
+		BestMoveWhiteWinProb:  played.BestMoveWhiteWinProb,
+		BestMoveWhiteDrawProb: played.BestMoveWhiteDrawProb,
+		BestMoveWhiteLossProb: played.BestMoveWhiteLossProb,
+		IsBestMove:            uci == played.BestMove,
+		TerminalStatus:        whatIf.TerminalStatus,
+	}
+	alternativeMove.Accuracy = moveAccuracy(&alternativeMove)
+	alternativeMove.CentipawnLoss = centipawnLoss(&alternativeMove)
+	whatIf.Classification = analysisOpts.classifierFor(game.Headers).ClassifyMove(&alternativeMove).String()
+
+	expectation := moverExpectation(played.Color, whatIf.WhiteScore, whatIf.WhiteWinProb, whatIf.WhiteDrawProb, whatIf.WhiteLossProb)
+	whatIf.VersusPlayed = expectation - moverExpectation(played.Color, played.WhiteScore, played.WhiteWinProb, played.WhiteDrawProb, played.WhiteLossProb)
+	whatIf.VersusBest = expectation - moverExpectation(played.Color, played.BestMoveWhiteScore, played.BestMoveWhiteWinProb, played.BestMoveWhiteDrawProb, played.BestMoveWhiteLossProb)
+	return whatIf, nil
+}
@@ -0,0 +1,46 @@
+package chessanalysis
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestAnalyzeWhatIf(t *testing.T) {
+	game, err := AnalyzeGame(scholarsMatePgn, WithDepth(3), WithEngineFactory(scholarsMateEngine().NewEngine))
+	if err != nil {
+		t.Fatalf("failed to analyze game: %v", err)
+	}
+	opts := []AnalyzeChessGameOption{WithDepth(3), WithEngineFactory(scholarsMateEngine().NewEngine)}
+
+	// 3...g6 instead of the blunder 3...Nf6
+	whatIf, err := AnalyzeWhatIf(game, 5, "g6", opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if whatIf.Move != "g6" || whatIf.UCI != "g7g6" || whatIf.Played != "Nf6" || whatIf.BestMove != "g6" || whatIf.Depth == 0 {
+		t.Errorf("unexpected what-if %+v", whatIf)
+	}
+	if whatIf.Classification != Best.String() || whatIf.VersusPlayed <= 0 || whatIf.VersusBest != 0 {
+		t.Errorf("expected 3...g6 to be the best move and better than Nf6, got %+v", whatIf)
+	}
+
+	// Moves can be given in UCI, and mates aren't searched
+	mate, err := AnalyzeWhatIf(game, 6, "h5f7", WithEngineFactory(func() (Engine, error) {
+		return nil, errors.New("mates shouldn't start an engine")
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mate.Move != "Qxf7#" || mate.TerminalStatus != TerminalCheckmate || mate.WhiteWinProb != 1 {
+		t.Errorf("unexpected what-if of the mate %+v", mate)
+	}
+
+	for _, illegal := range []string{"Ke2", "e8e1"} {
+		if _, err := AnalyzeWhatIf(game, 5, illegal, opts...); !errors.Is(err, ErrIllegalMove) {
+			t.Errorf("expected %s to be an illegal move, got %v", illegal, err)
+		}
+	}
+	if _, err := AnalyzeWhatIf(game, len(game.Moves), "e4", opts...); !errors.Is(err, ErrInvalidOptions) {
+		t.Errorf("expected a ply past the end of the game to fail, got %v", err)
+	}
+}
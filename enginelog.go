@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/mux"
+)
+
+// maxEngineLogBytes is how much of its engines' UCI conversation a job group
+// keeps, the latest lines
+const maxEngineLogBytes = 256 << 10
+
+// engineLog keeps the latest lines of a UCI transcript written to it, up to
+// maxBytes, dropping the oldest once it is full. Each Write is taken for a
+// line, as uciengine.StockfishEngine.Record writes them. It is safe for
+// concurrent use.
+type engineLog struct {
+	lock     sync.Mutex
+	maxBytes int
+	lines    []string // Oldest first
+	size     int      // Bytes of lines
+	dropped  int      // Lines dropped to stay within maxBytes
+}
+
+func newEngineLog(maxBytes int) *engineLog {
+	return &engineLog{maxBytes: maxBytes}
+}
+
+// Write adds a line to the log. The newest line is kept even if it alone is
+// over maxBytes.
+func (l *engineLog) Write(p []byte) (int, error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.lines = append(l.lines, string(p))
+	l.size += len(p)
+	for l.size > l.maxBytes && len(l.lines) > 1 {
+		l.size -= len(l.lines[0])
+		l.lines[0] = ""
+		l.lines = l.lines[1:]
+		l.dropped++
+	}
+	return len(p), nil
+}
+
+// contents returns the lines kept, oldest first, and how many were dropped
+// before them
+func (l *engineLog) contents() (transcript string, dropped int) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return strings.Join(l.lines, ""), l.dropped
+}
+
+// jobEngineLogHandler writes the UCI conversation of the engines of a job
+// group as a transcript, see uciengine.RecordingLauncher, to debug what the
+// engine said about its games. Only the latest maxEngineLogBytes are kept,
+// and the X-Dropped-Lines header says how many lines were dropped before
+// them. Searches the engine pool shared with an identical search of another
+// analysis were run by that analysis's engine and are in its log instead.
+func (app *Application) jobEngineLogHandler(w http.ResponseWriter, r *http.Request) {
+	group, ok := app.jobs.get(mux.Vars(r)["id"])
+	if !ok {
+		http.Error(w, "Job group not found", http.StatusNotFound)
+		return
+	}
+	transcript, dropped := group.engineLog.contents()
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("X-Dropped-Lines", strconv.Itoa(dropped))
+	if _, err := io.WriteString(w, transcript); err != nil {
+		fmt.Printf("Error writing engine log: %v\n", err)
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/walterschell/chess-analyzer/chessanalysis"
+)
+
+// parseQualityGate reads a quality gate from the query parameters color,
+// maxBlunders, minAccuracy and maxACPL, leaving out those not given
+func parseQualityGate(query url.Values) (chessanalysis.QualityGate, error) {
+	gate := chessanalysis.QualityGate{Color: query.Get("color")}
+	if value := query.Get("maxBlunders"); value != "" {
+		blunders, err := strconv.Atoi(value)
+		if err != nil {
+			return gate, fmt.Errorf("invalid maxBlunders %q", value)
+		}
+		gate.MaxBlunders = &blunders
+	}
+	for name, threshold := range map[string]**float64{"minAccuracy": &gate.MinAccuracy, "maxACPL": &gate.MaxACPL} {
+		if value := query.Get(name); value != "" {
+			limit, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return gate, fmt.Errorf("invalid %s %q", name, value)
+			}
+			*threshold = &limit
+		}
+	}
+	return gate, gate.Validate()
+}
+
+// analysisGateHandler checks a stored analysis against the quality gate of
+// the query parameters, see parseQualityGate, returning a
+// chessanalysis.GateResult. A game that fails the gate is still a successful
+// request: pipelines read pass from the result.
+func (app *Application) analysisGateHandler(w http.ResponseWriter, r *http.Request) {
+	gate, err := parseQualityGate(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	stored, ok := app.storedAnalysis(r.Context(), mux.Vars(r)["id"])
+	if !ok {
+		http.Error(w, "Analysis not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(gate.Check(stored.game)); err != nil {
+		fmt.Printf("Error writing gate result: %v\n", err)
+	}
+}
+
+// runGate implements the "gate" subcommand, which analyzes every game of a
+// PGN file and checks it against the thresholds given, printing whether each
+// passed and why not. It fails if any game did, so scripts can gate on its
+// exit status.
+func runGate(args []string) error {
+	flags := flag.NewFlagSet("gate", flag.ExitOnError)
+	depth := flags.Int("depth", 0, "Search depth (default: the analyzer's default)")
+	color := flags.String("color", "", "Side to check, White or Black (default: both)")
+	maxBlunders := flags.Int("max-blunders", 0, "Most blunders a side may make")
+	minAccuracy := flags.Float64("min-accuracy", 0, "Least accuracy a side must play with, 0-100")
+	maxACPL := flags.Float64("max-acpl", 0, "Highest average centipawn loss a side may have")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: chess-analyzer gate [-depth N] [-color White|Black] [-max-blunders N] [-min-accuracy X] [-max-acpl X] games.pgn|games.ndjson")
+		fmt.Fprintln(flags.Output(), "Only the thresholds given are checked.")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return fmt.Errorf("expected one PGN file")
+	}
+	gate := chessanalysis.QualityGate{Color: *color}
+	flags.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "max-blunders":
+			gate.MaxBlunders = maxBlunders
+		case "min-accuracy":
+			gate.MinAccuracy = minAccuracy
+		case "max-acpl":
+			gate.MaxACPL = maxACPL
+		}
+	})
+	if err := gate.Validate(); err != nil {
+		return err
+	}
+
+	pgn, err := exportGames(flags.Arg(0), "", "")
+	if err != nil {
+		return err
+	}
+	opts := []chessanalysis.AnalyzeChessGameOption{chessanalysis.WithSearchCache(chessanalysis.NewSearchCache())}
+	if *depth > 0 {
+		opts = append(opts, chessanalysis.WithDepth(*depth))
+	}
+	games, err := chessanalysis.AnalyzeChessGames(pgn, opts...)
+	if err != nil {
+		return err
+	}
+	failed := 0
+	for i, game := range games {
+		result := gate.Check(game)
+		verdict := "PASS"
+		if !result.Pass {
+			verdict = "FAIL"
+			failed++
+		}
+		fmt.Printf("%s game %d: %s - %s\n", verdict, i+1, game.Headers["White"], game.Headers["Black"])
+		for _, failure := range result.Failures {
+			fmt.Printf("  %s\n", failure.Reason)
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d games failed the gate", failed, len(games))
+	}
+	return nil
+}
@@ -0,0 +1,316 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/walterschell/chess-analyzer/chessanalysis"
+)
+
+// Page sizes of the analyses listing
+const (
+	defaultHistoryLimit = 20
+	maxHistoryLimit     = 100
+)
+
+// pgnDateLayout is the layout of the PGN Date tag, as in "2024.03.15"
+const pgnDateLayout = "2006.01.02"
+
+// historyResults are the results the analyses listing filters by
+var historyResults = []string{"1-0", "0-1", "1/2-1/2", "*"}
+
+// AnalysisListing describes a stored analysis in the analyses listing
+type AnalysisListing struct {
+	ID            string    `json:"id"`
+	Hash          string    `json:"hash"` // Its ETag
+	Version       int       `json:"version"`
+	Created       time.Time `json:"created"`
+	White         string    `json:"white,omitempty"`
+	Black         string    `json:"black,omitempty"`
+	Event         string    `json:"event,omitempty"`
+	Tags          []string  `json:"tags,omitempty"`  // See AnalysisNotes
+	Owner         string    `json:"owner,omitempty"` // ID of the Account that ran it
+	Private       bool      `json:"private,omitempty"`
+	ECO           string    `json:"eco,omitempty"`
+	Date          string    `json:"date,omitempty"` // As in the PGN Date tag
+	Result        string    `json:"result,omitempty"`
+	Moves         int       `json:"moves"` // Plies analyzed
+	WhiteAccuracy float64   `json:"whiteAccuracy"`
+	BlackAccuracy float64   `json:"blackAccuracy"`
+	WhiteBlunders int       `json:"whiteBlunders"`
+	BlackBlunders int       `json:"blackBlunders"`
+}
+
+// AnalysisPage is a page of the analyses listing. NextOffset is the offset
+// of the next page, or 0 on the last page.
+type AnalysisPage struct {
+	Analyses   []AnalysisListing `json:"analyses"`
+	Total      int               `json:"total"` // Analyses matching the filter, on every page
+	Offset     int               `json:"offset"`
+	NextOffset int               `json:"nextOffset,omitempty"`
+}
+
+// historyFilter selects stored analyses for the listing. Zero fields don't
+// filter.
+type historyFilter struct {
+	viewer      *Account // Who is listing, seeing only their own private analyses
+	mine        bool     // Only the viewer's analyses
+	text        string   // Found in any tag or the notes, ignoring case
+	labels      []string // Tags of the analysis, see AnalysisNotes
+	player      string
+	event       string    // Found in the Event tag, ignoring case
+	eco         string    // Prefix of the ECO code, such as "B9" for B90 to B99
+	from, to    time.Time // Inclusive
+	result      string
+	minAccuracy float64
+	// classifications are the least number of moves of each classification,
+	// by the player if given, else by either side
+	classifications map[chessanalysis.MoveClassification]int
+}
+
+// parseHistoryFilter reads a filter from the query parameters q, text to
+// find in the game's tags or the notes on its analysis, tag, repeated, the
+// tags the analysis needs, player, event, eco, from and to, dates as "2024-03-15" or
+// "2024.03.15", result, a PGN result, minAccuracy, from 0 to 100, and
+// classification, repeated, as in "Blunder:3" for three or more blunders or
+// "Brilliant" for at least one. The mine parameter lists only the analyses
+// of the viewer, which is the filter's.
+func parseHistoryFilter(query url.Values, viewer *Account) (historyFilter, error) {
+	filter := historyFilter{
+		viewer: viewer,
+		text:   strings.ToLower(strings.TrimSpace(query.Get("q"))),
+		labels: query["tag"],
+		player: strings.TrimSpace(query.Get("player")),
+		event:  strings.ToLower(strings.TrimSpace(query.Get("event"))),
+		eco:    strings.ToUpper(strings.TrimSpace(query.Get("eco"))),
+	}
+	for _, bound := range []struct {
+		name string
+		date *time.Time
+	}{{"from", &filter.from}, {"to", &filter.to}} {
+		value := query.Get(bound.name)
+		if value == "" {
+			continue
+		}
+		date, err := time.Parse(pgnDateLayout, strings.ReplaceAll(value, "-", "."))
+		if err != nil {
+			return filter, fmt.Errorf("invalid %s date %q", bound.name, value)
+		}
+		*bound.date = date
+	}
+	if mine := query.Get("mine"); mine != "" {
+		var err error
+		if filter.mine, err = strconv.ParseBool(mine); err != nil {
+			return filter, fmt.Errorf("invalid mine %q", mine)
+		}
+		if filter.mine && viewer == nil {
+			return filter, errors.New("log in to list your analyses")
+		}
+	}
+	if result := query.Get("result"); result != "" {
+		if !slices.Contains(historyResults, result) {
+			return filter, fmt.Errorf("invalid result %q", result)
+		}
+		filter.result = result
+	}
+	if minAccuracy := query.Get("minAccuracy"); minAccuracy != "" {
+		var err error
+		filter.minAccuracy, err = strconv.ParseFloat(minAccuracy, 64)
+		if err != nil || filter.minAccuracy < 0 || filter.minAccuracy > 100 {
+			return filter, fmt.Errorf("invalid minAccuracy %q", minAccuracy)
+		}
+	}
+	for _, count := range query["classification"] {
+		name, minimum, hasMinimum := strings.Cut(count, ":")
+		classification, err := chessanalysis.ParseMoveClassification(name)
+		if err != nil {
+			return filter, fmt.Errorf("invalid classification %q", count)
+		}
+		n := 1
+		if hasMinimum {
+			if n, err = strconv.Atoi(minimum); err != nil || n < 1 {
+				return filter, fmt.Errorf("invalid classification %q", count)
+			}
+		}
+		if filter.classifications == nil {
+			filter.classifications = make(map[chessanalysis.MoveClassification]int)
+		}
+		filter.classifications[classification] = n
+	}
+	return filter, nil
+}
+
+// matches reports whether a stored analysis passes the filter. With a
+// player, minAccuracy applies to that player's accuracy; without one, to
+// either side's. Games without a complete Date tag fail date filters.
+func (f historyFilter) matches(stored storedAnalysis) bool {
+	if !stored.visibleTo(f.viewer) || (f.mine && !stored.ownedBy(f.viewer)) {
+		return false
+	}
+	game := stored.game
+	white, black := game.Summary.White.Accuracy, game.Summary.Black.Accuracy
+	accuracy := max(white, black)
+	if f.player != "" {
+		switch game.PlayerColor(f.player) {
+		case "White":
+			accuracy = white
+		case "Black":
+			accuracy = black
+		default:
+			return false
+		}
+	}
+	if accuracy < f.minAccuracy {
+		return false
+	}
+	if f.result != "" && game.Headers["Result"] != f.result {
+		return false
+	}
+	if f.event != "" && !strings.Contains(strings.ToLower(game.Headers["Event"]), f.event) {
+		return false
+	}
+	if !strings.HasPrefix(strings.ToUpper(game.Headers["ECO"]), f.eco) {
+		return false
+	}
+	if f.text != "" && !tagsContain(game.Headers, f.text) && !stored.notes.contain(f.text) {
+		return false
+	}
+	for _, label := range f.labels {
+		if !stored.notes.hasTag(label) {
+			return false
+		}
+	}
+	if !f.from.IsZero() || !f.to.IsZero() {
+		date, err := time.Parse(pgnDateLayout, game.Headers["Date"])
+		if err != nil || (!f.from.IsZero() && date.Before(f.from)) || (!f.to.IsZero() && date.After(f.to)) {
+			return false
+		}
+	}
+	if f.classifications != nil {
+		color := game.PlayerColor(f.player)
+		counts := make(map[chessanalysis.MoveClassification]int)
+		for i := range game.Moves {
+			if color == "" || game.Moves[i].Color == color {
+				counts[game.Moves[i].Classification]++
+			}
+		}
+		for classification, minimum := range f.classifications {
+			if counts[classification] < minimum {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// tagsContain reports whether any of the tags contains the lower-case text,
+// ignoring case
+func tagsContain(headers map[string]string, text string) bool {
+	for _, value := range headers {
+		if strings.Contains(strings.ToLower(value), text) {
+			return true
+		}
+	}
+	return false
+}
+
+// list returns a page of the stored analyses passing the filter, most
+// recently analyzed first, and how many pass it in all. The store holds at
+// most maxStoredAnalyses, so a scan of them is quick enough to need no
+// indexes.
+func (s *analysisStore) list(filter historyFilter, offset, limit int) ([]AnalysisListing, int) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	listings := []AnalysisListing{}
+	total := 0
+	for i := len(s.order) - 1; i >= 0; i-- {
+		id := s.order[i]
+		stored := s.analyses[id]
+		if !filter.matches(stored) {
+			continue
+		}
+		total++
+		if total <= offset || len(listings) >= limit {
+			continue
+		}
+		game := stored.game
+		listings = append(listings, AnalysisListing{
+			ID:            id,
+			Hash:          stored.hash,
+			Version:       stored.version,
+			Created:       stored.added,
+			White:         game.Headers["White"],
+			Black:         game.Headers["Black"],
+			Event:         game.Headers["Event"],
+			Tags:          stored.notes.Tags,
+			Owner:         stored.owner,
+			Private:       stored.private,
+			ECO:           game.Headers["ECO"],
+			Date:          game.Headers["Date"],
+			Result:        game.Headers["Result"],
+			Moves:         len(game.Moves),
+			WhiteAccuracy: game.Summary.White.Accuracy,
+			BlackAccuracy: game.Summary.Black.Accuracy,
+			WhiteBlunders: game.Summary.White.Blunders,
+			BlackBlunders: game.Summary.Black.Blunders,
+		})
+	}
+	return listings, total
+}
+
+// pageParameter reads a non-negative integer query parameter, or returns
+// fallback if it is missing
+func pageParameter(query url.Values, name string, fallback int) (int, error) {
+	value := query.Get(name)
+	if value == "" {
+		return fallback, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid %s %q", name, value)
+	}
+	return n, nil
+}
+
+// listAnalysesHandler lists or searches the stored analyses, most recently
+// analyzed first, a page at a time: the limit query parameter, up to
+// maxHistoryLimit, sets the page size and offset how many analyses to skip.
+// See parseHistoryFilter for the filters.
+func (app *Application) listAnalysesHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter, err := parseHistoryFilter(query, contextAccount(r.Context()))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	limit, err := pageParameter(query, "limit", defaultHistoryLimit)
+	if err == nil && limit == 0 {
+		err = fmt.Errorf("invalid limit %q", query.Get("limit"))
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	offset, err := pageParameter(query, "offset", 0)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	limit = min(limit, maxHistoryLimit)
+	page := AnalysisPage{Offset: offset}
+	page.Analyses, page.Total = app.analyses.list(filter, offset, limit)
+	if next := offset + len(page.Analyses); len(page.Analyses) > 0 && next < page.Total {
+		page.NextOffset = next
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(page); err != nil {
+		fmt.Printf("Error writing analyses: %v\n", err)
+	}
+}
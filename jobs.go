@@ -0,0 +1,297 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/walterschell/chess-analyzer/chessanalysis"
+	"github.com/walterschell/chess-analyzer/chessanalysis/uciengine"
+)
+
+// maxJobGroups is how many batch job groups the server keeps before forgetting
+// the oldest finished one
+const maxJobGroups = 100
+
+// Statuses of batch games and job groups
+const (
+	jobQueued  = "queued"
+	jobRunning = "running"
+	jobDone    = "done"
+	jobFailed  = "failed"
+)
+
+// jobGroup is the analysis of the games of a multi-game PGN posted to the
+// batch API, which runs in the background one game after the other
+type jobGroup struct {
+	id         string
+	created    time.Time
+	variations bool       // Analyze the games' sidelines too, as for Lichess studies
+	engineLog  *engineLog // The UCI conversation of the group's engines, see jobEngineLogHandler
+
+	lock  sync.Mutex
+	games []*BatchGame
+}
+
+// BatchGame is the progress of a game of a job group
+type BatchGame struct {
+	Game          int    `json:"game"` // From 1, in the order of the PGN
+	Status        string `json:"status"`
+	AnalyzedPlies int    `json:"analyzedPlies"`
+	White         string `json:"white,omitempty"` // Once analyzed
+	Black         string `json:"black,omitempty"`
+	AnalysisID    string `json:"analysisId,omitempty"` // In the analyses API, once analyzed
+	Error         string `json:"error,omitempty"`      // Of failed games
+
+	analysis *chessanalysis.GameAnalysis
+}
+
+// JobGroupStatus is the progress of a job group, as jobGroupHandler returns it
+type JobGroupStatus struct {
+	ID            string      `json:"id"`
+	Status        string      `json:"status"` // Running until every game is done or failed
+	Created       time.Time   `json:"created"`
+	FinishedGames int         `json:"finishedGames"` // Done or failed
+	AnalyzedPlies int         `json:"analyzedPlies"`
+	Games         []BatchGame `json:"games"`
+}
+
+// status returns the group's progress so far
+func (group *jobGroup) status() JobGroupStatus {
+	group.lock.Lock()
+	defer group.lock.Unlock()
+	status := JobGroupStatus{ID: group.id, Status: jobDone, Created: group.created, Games: make([]BatchGame, len(group.games))}
+	for i, game := range group.games {
+		status.Games[i] = *game
+		status.AnalyzedPlies += game.AnalyzedPlies
+		if game.Status == jobDone || game.Status == jobFailed {
+			status.FinishedGames++
+		} else {
+			status.Status = jobRunning
+		}
+	}
+	return status
+}
+
+// analyses returns the analyses of the group's games analyzed so far
+func (group *jobGroup) analyses() []*chessanalysis.GameAnalysis {
+	group.lock.Lock()
+	defer group.lock.Unlock()
+	var games []*chessanalysis.GameAnalysis
+	for _, game := range group.games {
+		if game.analysis != nil {
+			games = append(games, game.analysis)
+		}
+	}
+	return games
+}
+
+// update changes a game of the group under the group's lock
+func (group *jobGroup) update(game *BatchGame, change func(*BatchGame)) {
+	group.lock.Lock()
+	defer group.lock.Unlock()
+	change(game)
+}
+
+// jobStore keeps the job groups of the batch API by ID
+type jobStore struct {
+	lock   sync.Mutex
+	groups map[string]*jobGroup
+	order  []string // IDs, oldest first
+}
+
+func newJobStore() *jobStore {
+	return &jobStore{groups: make(map[string]*jobGroup)}
+}
+
+// add keeps a new group, forgetting the oldest finished group if the store is
+// full. It fails if every group kept is still running.
+func (s *jobStore) add(group *jobGroup) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if len(s.order) >= maxJobGroups {
+		i := 0
+		for i < len(s.order) && s.groups[s.order[i]].status().Status != jobDone {
+			i++
+		}
+		if i == len(s.order) {
+			return fmt.Errorf("%d batches are already running", len(s.order))
+		}
+		delete(s.groups, s.order[i])
+		s.order = append(s.order[:i], s.order[i+1:]...)
+	}
+	s.groups[group.id] = group
+	s.order = append(s.order, group.id)
+	return nil
+}
+
+// get returns the group with the given ID, if it is still kept
+func (s *jobStore) get(id string) (*jobGroup, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	group, ok := s.groups[id]
+	return group, ok
+}
+
+// runJobGroup analyzes the games of the group one after the other at
+// background priority, so that interactive analyses go first, storing each
+// in the analyses API. The games share a search cache, as AnalyzeChessGames'
+// do. done is called once every game is finished. The analyses are public, as
+// the group's reports show them to everyone.
+func (app *Application) runJobGroup(group *jobGroup, pgns []string, depth int, owned ownership, done func()) {
+	defer done()
+	cache := chessanalysis.NewSearchCache()
+	factory := uciengine.RecordingFactory(app.engineFactory, group.engineLog)
+	for i, pgn := range pgns {
+		game := group.games[i]
+		group.update(game, func(game *BatchGame) { game.Status = jobRunning })
+		opts := []chessanalysis.AnalyzeChessGameOption{
+			chessanalysis.WithEngineFactory(factory),
+			chessanalysis.WithEnginePool(app.enginePool, chessanalysis.BackgroundPriority),
+			chessanalysis.WithTheory(app.books),
+			chessanalysis.WithSkipBook(),
+			chessanalysis.WithSearchCache(cache),
+			chessanalysis.WithClassificationSymbols(app.symbols),
+			chessanalysis.WithDepth(depth),
+		}
+		opts = append(opts, app.repertoireOptions()...)
+		if group.variations {
+			opts = append(opts, chessanalysis.WithVariations())
+		}
+		results, errs := chessanalysis.AnalyzeChessGameStreaming(pgn, opts...)
+		var moves []chessanalysis.MoveAnalysis
+		for move := range results {
+			moves = append(moves, *move)
+			group.update(game, func(game *BatchGame) { game.AnalyzedPlies++ })
+		}
+		err := <-errs
+		var id string
+		var stored storedAnalysis
+		if err == nil {
+			id, stored, err = app.storeGame(pgn, moves, opts, owned)
+		}
+		group.update(game, func(game *BatchGame) {
+			if err != nil {
+				game.Status, game.Error = jobFailed, analysisErrorText(err)
+				return
+			}
+			game.Status, game.AnalysisID, game.analysis = jobDone, id, stored.game
+			game.White, game.Black = stored.game.Headers["White"], stored.game.Headers["Black"]
+		})
+	}
+	fmt.Printf("Finished batch %s of %d games\n", group.id, len(pgns))
+}
+
+// batchHandler starts analyzing every game of the multi-game PGN in the
+// request body, to the depth query parameter, and answers 202 Accepted with
+// the new job group's status and its Location. The batch is a job of the API
+// key, if there is one, until its last game is analyzed.
+func (app *Application) batchHandler(w http.ResponseWriter, r *http.Request) {
+	pgn, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxRequestSize))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Reading PGN: %v", err), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err := app.inputLimits().Check(string(pgn)); err != nil {
+		writeInputError(w, err)
+		return
+	}
+	pgns, err := chessanalysis.SplitPGN(string(pgn))
+	if err != nil {
+		http.Error(w, analysisErrorText(err), http.StatusBadRequest)
+		return
+	}
+	app.startJobGroup(w, r, pgns, false)
+}
+
+// startJobGroup starts analyzing the games in the background as a new job
+// group, with their sidelines if variations is set, and answers the request
+// as batchHandler does
+func (app *Application) startJobGroup(w http.ResponseWriter, r *http.Request, pgns []string, variations bool) {
+	key := requestAPIKey(r)
+	depth, _ := strconv.Atoi(r.URL.Query().Get("depth"))
+	if depth <= 0 {
+		depth = defaultAnalysisDepth
+	}
+	depth = min(depth, app.keyDepthCap(key))
+
+	group := &jobGroup{id: randomID(8), created: time.Now(), variations: variations, engineLog: newEngineLog(maxEngineLogBytes)}
+	for i := range pgns {
+		group.games = append(group.games, &BatchGame{Game: i + 1, Status: jobQueued})
+	}
+	done, err := app.startJob(key, true)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusTooManyRequests)
+		return
+	}
+	if err := app.jobs.add(group); err != nil {
+		done()
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	go app.runJobGroup(group, pgns, depth, accountOwnership(r.Context()), done)
+
+	w.Header().Set("Location", "/api/v1/jobs/"+group.id)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	if err := json.NewEncoder(w).Encode(group.status()); err != nil {
+		fmt.Printf("Error writing job group: %v\n", err)
+	}
+}
+
+// jobGroupHandler returns the progress of a job group, a JobGroupStatus
+func (app *Application) jobGroupHandler(w http.ResponseWriter, r *http.Request) {
+	group, ok := app.jobs.get(mux.Vars(r)["id"])
+	if !ok {
+		http.Error(w, "Job group not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(group.status()); err != nil {
+		fmt.Printf("Error writing job group: %v\n", err)
+	}
+}
+
+// reportContentTypes are the content types of the exporters' formats
+var reportContentTypes = map[string]string{
+	"csv":           "text/csv; charset=utf-8",
+	"parquet":       "application/vnd.apache.parquet",
+	"sqlite":        "application/vnd.sqlite3",
+	"tournament":    "application/json",
+	"tournament-md": "text/markdown; charset=utf-8",
+}
+
+// jobGroupReportHandler writes the combined report of the games of a finished
+// job group in the format query parameter, one of the export subcommands'
+// formats such as "tournament-md", or by default as CSV. Failed games are left
+// out of it.
+func (app *Application) jobGroupReportHandler(w http.ResponseWriter, r *http.Request) {
+	group, ok := app.jobs.get(mux.Vars(r)["id"])
+	if !ok {
+		http.Error(w, "Job group not found", http.StatusNotFound)
+		return
+	}
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "csv"
+	}
+	write, ok := exporters[format]
+	if !ok {
+		http.Error(w, fmt.Sprintf("Unknown report format %q", format), http.StatusBadRequest)
+		return
+	}
+	if group.status().Status != jobDone {
+		http.Error(w, "The batch is still running", http.StatusConflict)
+		return
+	}
+	games := group.analyses()
+	w.Header().Set("Content-Type", reportContentTypes[format])
+	if err := write(w, games...); err != nil {
+		fmt.Printf("Error writing report: %v\n", err)
+	}
+}
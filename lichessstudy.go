@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/walterschell/chess-analyzer/chessanalysis"
+	"github.com/walterschell/chess-analyzer/chessanalysis/report"
+)
+
+// studyIDPattern matches the ID of a Lichess study on its own or in a study
+// or chapter URL, such as https://lichess.org/study/AbCd1234/EfGh5678
+var studyIDPattern = regexp.MustCompile(`^(?:https?://[^/]+/study/)?([A-Za-z0-9]{8})(?:/[A-Za-z0-9]{8})?/?$`)
+
+// errLichessForbidden is returned when Lichess refuses to change a study,
+// as it isn't the user's or they didn't grant the server study:write
+var errLichessForbidden = errors.New("Lichess refused to change the study")
+
+// StudyExportRequest is the body of a request to export a stored analysis to
+// a Lichess study
+type StudyExportRequest struct {
+	Study       string `json:"study"`                 // ID or URL of the study
+	Name        string `json:"name,omitempty"`        // Of the chapter, "White - Black" by default
+	Orientation string `json:"orientation,omitempty"` // "white", the default, or "black"
+}
+
+// StudyImportRequest is the body of a request to analyze a Lichess study
+type StudyImportRequest struct {
+	Study string `json:"study"` // ID or URL of the study
+}
+
+// StudyChapter is a chapter added to a Lichess study
+type StudyChapter struct {
+	Study   string `json:"study"`
+	Chapter string `json:"chapter"`
+	Name    string `json:"name"`
+	URL     string `json:"url"`
+}
+
+// importStudyChapter adds the PGN as a chapter of the user's study, with the
+// token of their session
+func (l *lichessLogin) importStudyChapter(ctx context.Context, token, study, name, orientation, pgn string) (StudyChapter, error) {
+	form := url.Values{"pgn": {pgn}, "name": {name}, "orientation": {orientation}}
+	endpoint := fmt.Sprintf("%s/api/study/%s/import-pgn", l.url, study)
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return StudyChapter{}, err
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "Bearer "+token)
+	response, err := l.client.Do(request)
+	if err != nil {
+		return StudyChapter{}, fmt.Errorf("adding the chapter to study %s: %w", study, err)
+	}
+	defer response.Body.Close()
+	switch response.StatusCode {
+	case http.StatusOK:
+	case http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound:
+		return StudyChapter{}, fmt.Errorf("%w %s: %s", errLichessForbidden, study, response.Status)
+	default:
+		return StudyChapter{}, fmt.Errorf("adding the chapter to study %s: %s", study, response.Status)
+	}
+	var imported struct {
+		Chapters []struct {
+			ID   string `json:"id"`
+			Name string `json:"name"`
+		} `json:"chapters"`
+	}
+	if err := json.NewDecoder(response.Body).Decode(&imported); err != nil || len(imported.Chapters) == 0 {
+		return StudyChapter{}, fmt.Errorf("adding the chapter to study %s: invalid response", study)
+	}
+	chapter := imported.Chapters[0]
+	return StudyChapter{
+		Study:   study,
+		Chapter: chapter.ID,
+		Name:    chapter.Name,
+		URL:     fmt.Sprintf("%s/study/%s/%s", l.url, study, chapter.ID),
+	}, nil
+}
+
+// studyExportHandler adds a stored analysis to a Lichess study of the user
+// as a new chapter, its moves annotated as report.AnnotatedPGN writes them,
+// with evaluations, NAGs and the engine's lines. Users must be logged in with
+// Lichess.
+func (app *Application) studyExportHandler(w http.ResponseWriter, r *http.Request) {
+	var request StudyExportRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<10)).Decode(&request); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid study export request: %v", err), http.StatusBadRequest)
+		return
+	}
+	match := studyIDPattern.FindStringSubmatch(strings.TrimSpace(request.Study))
+	if match == nil {
+		http.Error(w, fmt.Sprintf("Invalid study %q", request.Study), http.StatusBadRequest)
+		return
+	}
+	switch request.Orientation {
+	case "":
+		request.Orientation = "white"
+	case "white", "black":
+	default:
+		http.Error(w, fmt.Sprintf("Invalid orientation %q", request.Orientation), http.StatusBadRequest)
+		return
+	}
+	login := app.lichessLogin()
+	_, session, ok := app.requestSession(r)
+	if login == nil || !ok || session.account.Provider != "lichess" {
+		http.Error(w, "Log in with Lichess to export to a study", http.StatusUnauthorized)
+		return
+	}
+	stored, ok := app.storedAnalysis(r.Context(), mux.Vars(r)["id"])
+	if !ok {
+		http.Error(w, "Analysis not found", http.StatusNotFound)
+		return
+	}
+	name := request.Name
+	if name == "" {
+		name = fmt.Sprintf("%s - %s", headerOr(stored.game.Headers, "White", "?"), headerOr(stored.game.Headers, "Black", "?"))
+	}
+	pgn := report.AnnotatedPGN(stored.game.Headers, stored.game.Moves)
+	chapter, err := login.importStudyChapter(r.Context(), session.token, match[1], name, request.Orientation, pgn)
+	switch {
+	case errors.Is(err, errLichessForbidden):
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	fmt.Printf("Exported analysis %s to %s\n", mux.Vars(r)["id"], chapter.URL)
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(chapter); err != nil {
+		fmt.Printf("Error writing study chapter: %v\n", err)
+	}
+}
+
+// lichessStudies returns the source of the studies imported, the Lichess
+// users log in with if that is configured
+func (app *Application) lichessStudies() *chessanalysis.LichessStudySource {
+	source := chessanalysis.NewLichessStudySource()
+	if login := app.lichessLogin(); login != nil {
+		source.URL = login.url
+	}
+	return source
+}
+
+// studyImportHandler fetches the chapters of the Lichess study in the request
+// body, a StudyImportRequest, and analyzes them with their variations as the
+// games of a new job group, to the depth query parameter, answering as
+// batchHandler does. Each chapter's analysis keeps the tree of its
+// sidelines, see chessanalysis.Variation. Only public and unlisted studies
+// can be imported, as the group's analyses are public.
+func (app *Application) studyImportHandler(w http.ResponseWriter, r *http.Request) {
+	var request StudyImportRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<10)).Decode(&request); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid study import request: %v", err), http.StatusBadRequest)
+		return
+	}
+	match := studyIDPattern.FindStringSubmatch(strings.TrimSpace(request.Study))
+	if match == nil {
+		http.Error(w, fmt.Sprintf("Invalid study %q", request.Study), http.StatusBadRequest)
+		return
+	}
+	pgn, err := app.lichessStudies().Chapters(r.Context(), match[1])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	if err := app.inputLimits().Check(pgn); err != nil {
+		writeInputError(w, err)
+		return
+	}
+	pgns, err := chessanalysis.SplitPGN(pgn)
+	if err != nil {
+		http.Error(w, analysisErrorText(err), http.StatusBadRequest)
+		return
+	}
+	fmt.Printf("Importing %d chapters of study %s\n", len(pgns), match[1])
+	app.startJobGroup(w, r, pgns, true)
+}
+
+// headerOr returns the header with the given name, or fallback if the game
+// has none
+func headerOr(headers map[string]string, name, fallback string) string {
+	if value := headers[name]; value != "" && value != "?" {
+		return value
+	}
+	return fallback
+}
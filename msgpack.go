@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// msgpackSubprotocol is the WebSocket subprotocol clients ask for to be sent
+// messages as MessagePack rather than JSON, see msgpackMessage
+const msgpackSubprotocol = "msgpack"
+
+// msgpackMessage encodes a message as MessagePack: a map with the keys and
+// values of its JSON. Messages whose text is itself a JSON object or array,
+// such as analysis and summary messages, carry it decoded as well, so that
+// clients parse one payload instead of two.
+func msgpackMessage(message Message) ([]byte, error) {
+	encoded, err := json.Marshal(message)
+	if err != nil {
+		return nil, err
+	}
+	var value map[string]any
+	if err := decodeJSONNumbers(encoded, &value); err != nil {
+		return nil, err
+	}
+	if text := strings.TrimSpace(message.Text); strings.HasPrefix(text, "{") || strings.HasPrefix(text, "[") {
+		var decoded any
+		if err := decodeJSONNumbers([]byte(text), &decoded); err == nil {
+			value["text"] = decoded
+		}
+	}
+	var b bytes.Buffer
+	if err := writeMsgpack(&b, value); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// decodeJSONNumbers decodes JSON keeping its numbers as json.Number, so that
+// integers stay integers
+func decodeJSONNumbers(data []byte, value any) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	return decoder.Decode(value)
+}
+
+// writeMsgpack encodes a value decoded from JSON, with its numbers as
+// json.Number, in the smallest MessagePack format that holds it. Maps are
+// written with their keys sorted, so equal values encode the same.
+func writeMsgpack(b *bytes.Buffer, value any) error {
+	switch value := value.(type) {
+	case nil:
+		b.WriteByte(0xc0)
+	case bool:
+		if value {
+			b.WriteByte(0xc3)
+		} else {
+			b.WriteByte(0xc2)
+		}
+	case json.Number:
+		if integer, err := value.Int64(); err == nil {
+			writeMsgpackInt(b, integer)
+			return nil
+		}
+		float, err := value.Float64()
+		if err != nil {
+			return err
+		}
+		b.WriteByte(0xcb)
+		b.Write(binary.BigEndian.AppendUint64(nil, math.Float64bits(float)))
+	case string:
+		writeMsgpackHeader(b, len(value), 0xa0, 32, 0xd9, 0xda, 0xdb)
+		b.WriteString(value)
+	case []any:
+		writeMsgpackHeader(b, len(value), 0x90, 16, 0, 0xdc, 0xdd)
+		for _, element := range value {
+			if err := writeMsgpack(b, element); err != nil {
+				return err
+			}
+		}
+	case map[string]any:
+		writeMsgpackHeader(b, len(value), 0x80, 16, 0, 0xde, 0xdf)
+		keys := make([]string, 0, len(value))
+		for key := range value {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			writeMsgpack(b, key)
+			if err := writeMsgpack(b, value[key]); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("can't encode %T as MessagePack", value)
+	}
+	return nil
+}
+
+// writeMsgpackInt writes an integer as a fixint where it fits, and otherwise
+// as the smallest signed or unsigned integer that holds it
+func writeMsgpackInt(b *bytes.Buffer, value int64) {
+	switch {
+	case value >= 0 && value < 128:
+		b.WriteByte(byte(value))
+	case value < 0 && value >= -32:
+		b.WriteByte(byte(value))
+	case value >= 0 && value <= math.MaxUint8:
+		b.Write([]byte{0xcc, byte(value)})
+	case value >= 0 && value <= math.MaxUint16:
+		b.WriteByte(0xcd)
+		b.Write(binary.BigEndian.AppendUint16(nil, uint16(value)))
+	case value >= 0 && value <= math.MaxUint32:
+		b.WriteByte(0xce)
+		b.Write(binary.BigEndian.AppendUint32(nil, uint32(value)))
+	case value >= math.MinInt8 && value <= math.MaxInt8:
+		b.Write([]byte{0xd0, byte(value)})
+	case value >= math.MinInt16 && value <= math.MaxInt16:
+		b.WriteByte(0xd1)
+		b.Write(binary.BigEndian.AppendUint16(nil, uint16(value)))
+	case value >= math.MinInt32 && value <= math.MaxInt32:
+		b.WriteByte(0xd2)
+		b.Write(binary.BigEndian.AppendUint32(nil, uint32(value)))
+	default:
+		b.WriteByte(0xd3)
+		b.Write(binary.BigEndian.AppendUint64(nil, uint64(value)))
+	}
+}
+
+// writeMsgpackHeader writes the header of a string, array or map of the given
+// length: the fix format for lengths below fixLimit, and otherwise the 8-bit
+// (if the type has one), 16-bit or 32-bit length format
+func writeMsgpackHeader(b *bytes.Buffer, length int, fix byte, fixLimit int, format8, format16, format32 byte) {
+	switch {
+	case length < fixLimit:
+		b.WriteByte(fix | byte(length))
+	case format8 != 0 && length <= math.MaxUint8:
+		b.Write([]byte{format8, byte(length)})
+	case length <= math.MaxUint16:
+		b.WriteByte(format16)
+		b.Write(binary.BigEndian.AppendUint16(nil, uint16(length)))
+	default:
+		b.WriteByte(format32)
+		b.Write(binary.BigEndian.AppendUint32(nil, uint32(length)))
+	}
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+// readMsgpack decodes the MessagePack formats writeMsgpack writes, with
+// integers as int64
+func readMsgpack(r *bytes.Reader) (any, error) {
+	format, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	next := func(n int) []byte {
+		b := make([]byte, n)
+		r.Read(b)
+		return b
+	}
+	length := func(size int) int {
+		switch b := next(size); size {
+		case 1:
+			return int(b[0])
+		case 2:
+			return int(binary.BigEndian.Uint16(b))
+		default:
+			return int(binary.BigEndian.Uint32(b))
+		}
+	}
+	readString := func(n int) (any, error) { return string(next(n)), nil }
+	readArray := func(n int) (any, error) {
+		array := make([]any, n)
+		for i := range array {
+			if array[i], err = readMsgpack(r); err != nil {
+				return nil, err
+			}
+		}
+		return array, nil
+	}
+	readMap := func(n int) (any, error) {
+		m := make(map[string]any, n)
+		for range n {
+			key, err := readMsgpack(r)
+			if err != nil {
+				return nil, err
+			}
+			if m[key.(string)], err = readMsgpack(r); err != nil {
+				return nil, err
+			}
+		}
+		return m, nil
+	}
+	switch {
+	case format < 0x80:
+		return int64(format), nil
+	case format >= 0xe0:
+		return int64(int8(format)), nil
+	case format&0xe0 == 0xa0:
+		return readString(int(format & 0x1f))
+	case format&0xf0 == 0x90:
+		return readArray(int(format & 0x0f))
+	case format&0xf0 == 0x80:
+		return readMap(int(format & 0x0f))
+	}
+	switch format {
+	case 0xc0:
+		return nil, nil
+	case 0xc2, 0xc3:
+		return format == 0xc3, nil
+	case 0xcb:
+		return math.Float64frombits(binary.BigEndian.Uint64(next(8))), nil
+	case 0xcc:
+		return int64(next(1)[0]), nil
+	case 0xcd:
+		return int64(binary.BigEndian.Uint16(next(2))), nil
+	case 0xce:
+		return int64(binary.BigEndian.Uint32(next(4))), nil
+	case 0xd0:
+		return int64(int8(next(1)[0])), nil
+	case 0xd1:
+		return int64(int16(binary.BigEndian.Uint16(next(2)))), nil
+	case 0xd2:
+		return int64(int32(binary.BigEndian.Uint32(next(4)))), nil
+	case 0xd3:
+		return int64(binary.BigEndian.Uint64(next(8))), nil
+	case 0xd9:
+		return readString(length(1))
+	case 0xda:
+		return readString(length(2))
+	case 0xdb:
+		return readString(length(4))
+	case 0xdc:
+		return readArray(length(2))
+	case 0xdd:
+		return readArray(length(4))
+	case 0xde:
+		return readMap(length(2))
+	case 0xdf:
+		return readMap(length(4))
+	}
+	return nil, fmt.Errorf("unknown MessagePack format %#x", format)
+}
+
+func TestWriteMsgpack(t *testing.T) {
+	tests := []struct {
+		json    string
+		encoded []byte
+	}{
+		{`null`, []byte{0xc0}},
+		{`true`, []byte{0xc3}},
+		{`5`, []byte{0x05}},
+		{`-3`, []byte{0xfd}},
+		{`200`, []byte{0xcc, 0xc8}},
+		{`-200`, []byte{0xd1, 0xff, 0x38}},
+		{`70000`, []byte{0xce, 0x00, 0x01, 0x11, 0x70}},
+		{`1.5`, []byte{0xcb, 0x3f, 0xf8, 0, 0, 0, 0, 0, 0}},
+		{`"e4"`, []byte{0xa2, 'e', '4'}},
+		{`[1, "a"]`, []byte{0x92, 0x01, 0xa1, 'a'}},
+		{`{"b": 2, "a": 1}`, []byte{0x82, 0xa1, 'a', 0x01, 0xa1, 'b', 0x02}},
+	}
+	for _, test := range tests {
+		var value any
+		if err := decodeJSONNumbers([]byte(test.json), &value); err != nil {
+			t.Fatal(err)
+		}
+		var b bytes.Buffer
+		if err := writeMsgpack(&b, value); err != nil {
+			t.Fatalf("failed to encode %s: %v", test.json, err)
+		}
+		if !bytes.Equal(b.Bytes(), test.encoded) {
+			t.Errorf("expected %s to encode as % x, got % x", test.json, test.encoded, b.Bytes())
+		}
+	}
+
+	long := strings.Repeat("x", 300)
+	var b bytes.Buffer
+	writeMsgpack(&b, long)
+	if decoded, err := readMsgpack(bytes.NewReader(b.Bytes())); err != nil || decoded != long {
+		t.Errorf("expected a 300 byte string to round-trip, got %v (%v)", decoded, err)
+	}
+}
+
+func TestWebsocketMsgpack(t *testing.T) {
+	server := newTestServer(t)
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws"
+	dialer := websocket.Dialer{Subprotocols: []string{msgpackSubprotocol}}
+	conn, _, err := dialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("failed to connect to websocket: %v", err)
+	}
+	defer conn.Close()
+	if conn.Subprotocol() != msgpackSubprotocol {
+		t.Fatalf("expected the server to agree to %q, got %q", msgpackSubprotocol, conn.Subprotocol())
+	}
+
+	if err := conn.WriteJSON(Message{Type: "analyze", PGN: testPgn, Depth: 4}); err != nil {
+		t.Fatalf("failed to send analyze message: %v", err)
+	}
+	messageType, data, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatalf("failed to read analysis: %v", err)
+	}
+	if messageType != websocket.BinaryMessage {
+		t.Fatalf("expected a binary message, got type %d", messageType)
+	}
+	decoded, err := readMsgpack(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("failed to decode analysis: %v", err)
+	}
+	message := decoded.(map[string]any)
+	if message["type"] != "analysis" {
+		t.Fatalf("expected an analysis message, got %v", message["type"])
+	}
+	move, ok := message["text"].(map[string]any)
+	if !ok || move["moveText"] != "e4" || move["depth"] != int64(4) {
+		t.Errorf("expected the analysis of e4 decoded in the text, got %v", message["text"])
+	}
+
+	// As JSON, the analysis in the text is escaped a second time
+	text, _ := json.Marshal(move)
+	asJSON, _ := json.Marshal(Message{Type: "analysis", Text: string(text)})
+	if len(data) >= len(asJSON) {
+		t.Errorf("expected MessagePack to be smaller than JSON, got %d bytes against %d", len(data), len(asJSON))
+	}
+}
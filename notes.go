@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// Limits of the tags and notes on a stored analysis
+const (
+	maxAnalysisTags   = 20
+	maxAnalysisTagLen = 50
+	maxAnalysisNotes  = 8 << 10
+)
+
+// AnalysisNotes are free-form tags and notes on a stored analysis, with which
+// a coach can organize their students' games, such as under "rook endings".
+// They belong to the analysis rather than a version of it, so re-analyzing
+// the game keeps them.
+type AnalysisNotes struct {
+	Tags  []string `json:"tags"`
+	Notes string   `json:"notes"`
+}
+
+// normalize trims the tags and drops the empty ones and those repeated,
+// ignoring case, and checks the tags and notes are within their limits
+func (n *AnalysisNotes) normalize() error {
+	tags := []string{}
+	for _, tag := range n.Tags {
+		tag = strings.TrimSpace(tag)
+		if tag == "" || (AnalysisNotes{Tags: tags}).hasTag(tag) {
+			continue
+		}
+		if len(tag) > maxAnalysisTagLen {
+			return fmt.Errorf("tag %q is longer than %d bytes", tag, maxAnalysisTagLen)
+		}
+		tags = append(tags, tag)
+	}
+	if len(tags) > maxAnalysisTags {
+		return fmt.Errorf("%d tags are more than the %d allowed", len(tags), maxAnalysisTags)
+	}
+	if len(n.Notes) > maxAnalysisNotes {
+		return fmt.Errorf("notes are longer than %d bytes", maxAnalysisNotes)
+	}
+	n.Tags = tags
+	return nil
+}
+
+// hasTag reports whether one of the tags is tag, ignoring case
+func (n AnalysisNotes) hasTag(tag string) bool {
+	return slices.ContainsFunc(n.Tags, func(kept string) bool { return strings.EqualFold(kept, tag) })
+}
+
+// contain reports whether the notes or one of the tags contains the
+// lower-case text, ignoring case
+func (n AnalysisNotes) contain(text string) bool {
+	return strings.Contains(strings.ToLower(n.Notes), text) ||
+		slices.ContainsFunc(n.Tags, func(tag string) bool { return strings.Contains(strings.ToLower(tag), text) })
+}
+
+// annotate replaces the tags and notes on the analysis with the given ID
+func (s *analysisStore) annotate(id string, notes AnalysisNotes) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	stored, ok := s.analyses[id]
+	if !ok {
+		return errAnalysisNotFound
+	}
+	stored.notes = notes
+	s.analyses[id] = stored
+	return nil
+}
+
+// analysisNotesHandler returns the tags and notes on a stored analysis
+func (app *Application) analysisNotesHandler(w http.ResponseWriter, r *http.Request) {
+	stored, ok := app.storedAnalysis(r.Context(), mux.Vars(r)["id"])
+	if !ok {
+		http.Error(w, "Analysis not found", http.StatusNotFound)
+		return
+	}
+	notes := stored.notes
+	if notes.Tags == nil {
+		notes.Tags = []string{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(notes); err != nil {
+		fmt.Printf("Error writing analysis notes: %v\n", err)
+	}
+}
+
+// putAnalysisNotesHandler replaces the tags and notes on a stored analysis
+// with those in the request body, returning them as kept, see
+// AnalysisNotes.normalize
+func (app *Application) putAnalysisNotesHandler(w http.ResponseWriter, r *http.Request) {
+	var notes AnalysisNotes
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 2*maxAnalysisNotes)).Decode(&notes); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid notes: %v", err), http.StatusBadRequest)
+		return
+	}
+	if err := notes.normalize(); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid notes: %v", err), http.StatusBadRequest)
+		return
+	}
+	id := mux.Vars(r)["id"]
+	stored, ok := app.storedAnalysis(r.Context(), id)
+	if !ok {
+		http.Error(w, "Analysis not found", http.StatusNotFound)
+		return
+	}
+	if !stored.editableBy(contextAccount(r.Context())) {
+		http.Error(w, "Only the owner of the analysis can change its notes", http.StatusForbidden)
+		return
+	}
+	if err := app.analyses.annotate(id, notes); errors.Is(err, errAnalysisNotFound) {
+		http.Error(w, "Analysis not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(notes); err != nil {
+		fmt.Printf("Error writing analysis notes: %v\n", err)
+	}
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// APIKeyQuota is what the clients of an API key may use of the server, so
+// that a public instance can be shared between tenants. Limits left at zero
+// don't apply.
+type APIKeyQuota struct {
+	Name string `json:"name,omitempty"` // Who the key belongs to, for the logs
+	// MaxConcurrentJobs is how many analyses, what-ifs, guessing games and
+	// kibitzer searches the key's clients may run at once
+	MaxConcurrentJobs int `json:"maxConcurrentJobs,omitempty"`
+	// MaxEngineSecondsPerDay is how long the key's jobs may run in a day,
+	// from midnight UTC; jobs already running when it is spent finish
+	MaxEngineSecondsPerDay int `json:"maxEngineSecondsPerDay,omitempty"`
+	// MaxDepth caps the depth the key's clients may ask for below the
+	// server's own cap
+	MaxDepth int `json:"maxDepth,omitempty"`
+}
+
+// errQuotaExceeded is returned for jobs over the quota of their API key
+var errQuotaExceeded = errors.New("quota exceeded")
+
+// apiKeyHash identifies an API key without keeping it, like the password
+// hashes of accessControl
+type apiKeyHash [sha256.Size]byte
+
+// apiKeyContextKey is the request context key of the hash of the request's
+// API key, see requestAPIKey
+type apiKeyContextKey struct{}
+
+// apiKeySubprotocolPrefix starts the WebSocket subprotocol that carries an
+// API key, for websockets opened by browsers, which can't set headers. Keys
+// aren't taken from the URL, which ends up in the access log.
+const apiKeySubprotocolPrefix = "key."
+
+// presentedAPIKey returns the API key the request bears: in an X-API-Key
+// header, as a bearer token, or, for websockets, as a subprotocol, see
+// apiKeySubprotocolPrefix
+func presentedAPIKey(r *http.Request) (string, bool) {
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		return key, true
+	}
+	if key, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok && key != "" {
+		return key, true
+	}
+	if protocol, ok := apiKeySubprotocol(r); ok {
+		return strings.TrimPrefix(protocol, apiKeySubprotocolPrefix), true
+	}
+	return "", false
+}
+
+// apiKeySubprotocol returns the subprotocol a websocket request offers its
+// API key as, which the server must accept for browsers to connect if it is
+// the only one offered
+func apiKeySubprotocol(r *http.Request) (string, bool) {
+	for _, protocol := range websocket.Subprotocols(r) {
+		if len(protocol) > len(apiKeySubprotocolPrefix) && strings.HasPrefix(protocol, apiKeySubprotocolPrefix) {
+			return protocol, true
+		}
+	}
+	return "", false
+}
+
+// withAPIKey returns the request's context holding the hash of its API key
+func withAPIKey(ctx context.Context, key apiKeyHash) context.Context {
+	return context.WithValue(ctx, apiKeyContextKey{}, key)
+}
+
+// requestAPIKey returns the hash of the API key the request was let in
+// with, or nil if it wasn't let in with one
+func requestAPIKey(r *http.Request) *apiKeyHash {
+	if key, ok := r.Context().Value(apiKeyContextKey{}).(apiKeyHash); ok {
+		return &key
+	}
+	return nil
+}
+
+// keyUsage is what an API key is using: its jobs running and the time its
+// jobs ran on the current day
+type keyUsage struct {
+	jobs       int
+	day        string // UTC date the engine time was counted on
+	engineTime time.Duration
+}
+
+// quotaTracker counts the jobs and engine time of each API key. Usage is
+// kept by key hash, so it survives reloading the configuration, and only in
+// memory, so restarting the server starts every key's day afresh.
+type quotaTracker struct {
+	lock  sync.Mutex
+	usage map[apiKeyHash]*keyUsage
+	now   func() time.Time
+}
+
+func newQuotaTracker() *quotaTracker {
+	return &quotaTracker{usage: make(map[apiKeyHash]*keyUsage), now: time.Now}
+}
+
+// usageOf returns the key's usage, starting its day afresh if the day
+// changed. The caller must hold lock.
+func (t *quotaTracker) usageOf(key apiKeyHash) *keyUsage {
+	usage, ok := t.usage[key]
+	if !ok {
+		usage = &keyUsage{}
+		t.usage[key] = usage
+	}
+	if day := t.now().UTC().Format(time.DateOnly); usage.day != day {
+		usage.day, usage.engineTime = day, 0
+	}
+	return usage
+}
+
+// start begins a job of the key if its quota allows, returning the function
+// ending it, which charges the key for the time the job ran. Jobs that don't
+// hold a slot of their own, such as pondering, which gives way to any other
+// search, only count against the daily engine time.
+func (t *quotaTracker) start(key apiKeyHash, quota APIKeyQuota, slot bool) (func(), error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	usage := t.usageOf(key)
+	if budget := time.Duration(quota.MaxEngineSecondsPerDay) * time.Second; budget > 0 && usage.engineTime >= budget {
+		return nil, fmt.Errorf("%w: the %d engine seconds of the day are used up", errQuotaExceeded, quota.MaxEngineSecondsPerDay)
+	}
+	if slot {
+		if quota.MaxConcurrentJobs > 0 && usage.jobs >= quota.MaxConcurrentJobs {
+			return nil, fmt.Errorf("%w: %d jobs are already running", errQuotaExceeded, usage.jobs)
+		}
+		usage.jobs++
+	}
+	started := t.now()
+	return func() {
+		t.lock.Lock()
+		defer t.lock.Unlock()
+		usage := t.usageOf(key)
+		usage.engineTime += t.now().Sub(started)
+		if slot {
+			usage.jobs--
+		}
+	}, nil
+}
+
+// keyQuota returns the quota of the API key, and false if it isn't one of
+// the configured keys, as after a reload removing it
+func (app *Application) keyQuota(key apiKeyHash) (APIKeyQuota, bool) {
+	access := app.accessControl()
+	if access == nil {
+		return APIKeyQuota{}, false
+	}
+	quota, ok := access.keys[key]
+	return quota, ok
+}
+
+// keyDepthCap returns the deepest analysis the clients of the API key, if
+// there is one, may ask for
+func (app *Application) keyDepthCap(key *apiKeyHash) int {
+	depth := app.depthCap()
+	if key == nil {
+		return depth
+	}
+	if quota, _ := app.keyQuota(*key); quota.MaxDepth > 0 {
+		return min(depth, quota.MaxDepth)
+	}
+	return depth
+}
+
+// startJob begins a job for the API key, if there is one, returning the
+// function to call when it ends. Jobs over the key's quota, or of a key no
+// longer configured, are refused with an error wrapping errQuotaExceeded.
+func (app *Application) startJob(key *apiKeyHash, slot bool) (func(), error) {
+	if key == nil {
+		return func() {}, nil
+	}
+	quota, ok := app.keyQuota(*key)
+	if !ok {
+		return nil, fmt.Errorf("%w: the API key is no longer valid", errQuotaExceeded)
+	}
+	return app.quotas.start(*key, quota, slot)
+}
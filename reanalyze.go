@@ -0,0 +1,249 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/walterschell/chess-analyzer/chessanalysis"
+	"github.com/walterschell/chess-analyzer/chessanalysis/report"
+)
+
+// maxAnalysisVersions is how many earlier versions of a re-analyzed game the
+// server keeps before forgetting the oldest
+const maxAnalysisVersions = 10
+
+// errAnalysisChanged is returned for re-analyses of a version of an analysis
+// that has since been replaced
+var errAnalysisChanged = errors.New("the analysis has been replaced since")
+
+// replace stores a new version of the analysis with the given ID, keeping the
+// current one among its previous versions, and returns it. With ifHash, only
+// the version with that content hash is replaced, so that of two clients
+// re-analyzing a game at once, the second learns it would undo the first's.
+func (s *analysisStore) replace(id, ifHash string, game *chessanalysis.GameAnalysis, content []byte) (storedAnalysis, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	current, ok := s.analyses[id]
+	if !ok {
+		return storedAnalysis{}, errAnalysisNotFound
+	}
+	if ifHash != "" && ifHash != current.hash {
+		return storedAnalysis{}, errAnalysisChanged
+	}
+	previous := append(slices.Clip(current.previous), current)
+	previous[len(previous)-1].previous = nil
+	if len(previous) > maxAnalysisVersions {
+		previous = previous[len(previous)-maxAnalysisVersions:]
+	}
+	replaced := storedAnalysis{
+		game:      game,
+		pgn:       current.pgn,
+		hash:      contentHash(content),
+		added:     time.Now(),
+		version:   current.version + 1,
+		previous:  previous,
+		notes:     current.notes,
+		ownership: current.ownership,
+	}
+	s.analyses[id] = replaced
+	// The new version is kept as long as a new analysis would be
+	s.order = append(slices.DeleteFunc(s.order, func(stored string) bool { return stored == id }), id)
+	return replaced, nil
+}
+
+// ReanalyzeRequest is the body of a re-analysis request: the settings to
+// analyze a stored game with again
+type ReanalyzeRequest struct {
+	Depth      int    `json:"depth,omitempty"`      // Capped at maxSyncAnalysisDepth, defaultAnalysisDepth if unset
+	Classifier string `json:"classifier,omitempty"` // See chessanalysis.ClassifierProfiles
+	// RatingScaling scales the classifier's thresholds to each player's
+	// rating tag, see chessanalysis.WithRatingScaling
+	RatingScaling bool `json:"ratingScaling,omitempty"`
+	// TimeControlProfiles classifies the moves of games without a
+	// Classifier with the profile of their speed class, see
+	// chessanalysis.DefaultTimeControlProfiles
+	TimeControlProfiles bool `json:"timeControlProfiles,omitempty"`
+}
+
+// reanalyzeHandler analyzes the game of a stored analysis again with the
+// settings in the request body, a ReanalyzeRequest, while the request waits,
+// and replaces the stored analysis with the result in one step: its JSON,
+// CSV and annotated PGN all change together. The version it replaced stays
+// available, see analysisVersionsHandler. An If-Match header with the ETag of
+// the version the client has makes the request fail with 412 Precondition
+// Failed if the analysis has been replaced since.
+func (app *Application) reanalyzeHandler(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	var request ReanalyzeRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<10)).Decode(&request); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid re-analysis request: %v", err), http.StatusBadRequest)
+		return
+	}
+	stored, ok := app.storedAnalysis(r.Context(), id)
+	if !ok {
+		http.Error(w, "Analysis not found", http.StatusNotFound)
+		return
+	}
+	if !stored.editableBy(contextAccount(r.Context())) {
+		http.Error(w, "Only the owner of the analysis can re-analyze it", http.StatusForbidden)
+		return
+	}
+	ifHash := strings.Trim(strings.TrimPrefix(r.Header.Get("If-Match"), "W/"), `"`)
+	if ifHash == "*" {
+		ifHash = ""
+	}
+	if ifHash != "" && ifHash != stored.hash {
+		http.Error(w, errAnalysisChanged.Error(), http.StatusPreconditionFailed)
+		return
+	}
+
+	key := requestAPIKey(r)
+	done, err := app.startJob(key, true)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusTooManyRequests)
+		return
+	}
+	defer done()
+	depth := request.Depth
+	if depth <= 0 {
+		depth = defaultAnalysisDepth
+	}
+	opts := app.requestAnalysisOptions(r.Context(), min(depth, maxSyncAnalysisDepth, app.keyDepthCap(key)))
+	if request.Classifier != "" {
+		if _, err := chessanalysis.ClassifierProfileByName(request.Classifier); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		opts = append(opts, chessanalysis.WithClassifierProfile(request.Classifier))
+	}
+	if request.RatingScaling {
+		opts = append(opts, chessanalysis.WithRatingScaling(chessanalysis.DefaultRatingScaler))
+	}
+	if request.TimeControlProfiles {
+		opts = append(opts, chessanalysis.WithTimeControlProfiles(chessanalysis.DefaultTimeControlProfiles))
+	}
+	if stored.game.Variations != nil {
+		// Games imported from a study keep their sidelines
+		opts = append(opts, chessanalysis.WithVariations())
+	}
+	if side := stored.game.Options.Side; side != "" {
+		// Games analyzed for one side stay so
+		opts = append(opts, chessanalysis.WithSide(side))
+	}
+	moves, err := chessanalysis.AnalyzeChessGame(stored.pgn, opts...)
+	if err != nil {
+		http.Error(w, analysisErrorText(err), http.StatusInternalServerError)
+		return
+	}
+	game, content, err := summarizeGame(stored.pgn, moves, opts)
+	if err != nil {
+		http.Error(w, analysisErrorText(err), http.StatusInternalServerError)
+		return
+	}
+	// Checked again, as the analysis may have been replaced while this one ran
+	replaced, err := app.analyses.replace(id, ifHash, game, content)
+	switch {
+	case errors.Is(err, errAnalysisNotFound):
+		http.Error(w, "Analysis not found", http.StatusNotFound)
+		return
+	case errors.Is(err, errAnalysisChanged):
+		http.Error(w, err.Error(), http.StatusPreconditionFailed)
+		return
+	}
+	w.Header().Set("ETag", `"`+replaced.hash+`"`)
+	w.Header().Set("Content-Location", fmt.Sprintf("/api/v1/analyses/%s/versions/%d", id, replaced.version))
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(content)
+}
+
+// AnalysisVersion describes a version of a stored analysis, as listed by
+// analysisVersionsHandler
+type AnalysisVersion struct {
+	Version    int       `json:"version"` // From 1 for the first analysis
+	Hash       string    `json:"hash"`    // Its ETag
+	Created    time.Time `json:"created"`
+	Depth      int       `json:"depth,omitempty"`
+	Classifier string    `json:"classifier,omitempty"` // Profile, if not the default
+	Current    bool      `json:"current"`
+}
+
+// analysisVersionsHandler lists the versions kept of a stored analysis,
+// oldest first
+func (app *Application) analysisVersionsHandler(w http.ResponseWriter, r *http.Request) {
+	stored, ok := app.storedAnalysis(r.Context(), mux.Vars(r)["id"])
+	if !ok {
+		http.Error(w, "Analysis not found", http.StatusNotFound)
+		return
+	}
+	var versions []AnalysisVersion
+	for _, version := range append(slices.Clip(stored.previous), stored) {
+		versions = append(versions, AnalysisVersion{
+			Version:    version.version,
+			Hash:       version.hash,
+			Created:    version.added,
+			Depth:      version.game.Options.Depth,
+			Classifier: version.game.Options.ClassifierProfile,
+			Current:    version.version == stored.version,
+		})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(versions); err != nil {
+		fmt.Printf("Error writing analysis versions: %v\n", err)
+	}
+}
+
+// versionOf returns the given version of the analysis, if it is still kept
+func (stored storedAnalysis) versionOf(number int) (storedAnalysis, bool) {
+	versions := append(slices.Clip(stored.previous), stored)
+	index := slices.IndexFunc(versions, func(version storedAnalysis) bool { return version.version == number })
+	if index < 0 {
+		return storedAnalysis{}, false
+	}
+	return versions[index], true
+}
+
+// analysisVersionHandler returns a version of a stored analysis as JSON, the
+// current one included, for comparing it with another
+func (app *Application) analysisVersionHandler(w http.ResponseWriter, r *http.Request) {
+	stored, ok := app.storedAnalysis(r.Context(), mux.Vars(r)["id"])
+	if !ok {
+		http.Error(w, "Analysis not found", http.StatusNotFound)
+		return
+	}
+	number, _ := strconv.Atoi(mux.Vars(r)["version"])
+	version, ok := stored.versionOf(number)
+	if !ok {
+		http.Error(w, "Version not found", http.StatusNotFound)
+		return
+	}
+	if notModified(w, r, version.hash) {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(version.game); err != nil {
+		fmt.Printf("Error writing analysis: %v\n", err)
+	}
+}
+
+// analysisPGNHandler returns a stored analysis as an annotated PGN
+func (app *Application) analysisPGNHandler(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	stored, ok := app.storedAnalysis(r.Context(), id)
+	if !ok {
+		http.Error(w, "Analysis not found", http.StatusNotFound)
+		return
+	}
+	if notModified(w, r, stored.hash+"-pgn") {
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-chess-pgn")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="analysis-%s.pgn"`, id))
+	fmt.Fprint(w, report.AnnotatedPGN(stored.game.Headers, stored.game.Moves))
+}
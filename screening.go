@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/walterschell/chess-analyzer/chessanalysis"
+)
+
+// screeningMultiPV is how many lines the screen subcommand has the engine
+// report, enough for top-3 match rates
+const screeningMultiPV = 3
+
+// runScreen implements the "screen" subcommand, which analyzes every game of
+// a PGN file at each of several depths and prints the engine-correlation
+// screening report of one of its players, see chessanalysis.ScreenPlayer
+func runScreen(args []string) error {
+	flags := flag.NewFlagSet("screen", flag.ExitOnError)
+	player := flags.String("player", "", "Player to screen, as named in the White or Black tags")
+	depths := flags.String("depths", "12,20", "Comma-separated search depths to analyze the games to")
+	asJSON := flags.Bool("json", false, "Write the report as JSON instead of Markdown")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: chess-analyzer screen -player name [-depths 12,20] [-json] games.pgn|games.ndjson")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if *player == "" || flags.NArg() != 1 {
+		flags.Usage()
+		return fmt.Errorf("expected a -player and one PGN file")
+	}
+	var screenDepths []int
+	for _, field := range strings.Split(*depths, ",") {
+		depth, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil || depth <= 0 {
+			return fmt.Errorf("invalid depth %q", field)
+		}
+		screenDepths = append(screenDepths, depth)
+	}
+
+	pgn, err := exportGames(flags.Arg(0), "", "")
+	if err != nil {
+		return err
+	}
+	var games []*chessanalysis.GameAnalysis
+	for _, depth := range screenDepths {
+		// Each depth gets its own cache, as a cached search may be of another depth
+		analyzed, err := chessanalysis.AnalyzeChessGames(pgn,
+			chessanalysis.WithDepth(depth),
+			chessanalysis.WithMultiPV(screeningMultiPV),
+			chessanalysis.WithSearchCache(chessanalysis.NewSearchCache()),
+		)
+		if err != nil {
+			return err
+		}
+		games = append(games, analyzed...)
+	}
+	report := chessanalysis.ScreenPlayer(games, *player)
+	if *asJSON {
+		return json.NewEncoder(os.Stdout).Encode(report)
+	}
+	fmt.Print(report.Markdown())
+	return nil
+}
+
+// jobGroupScreeningHandler returns the engine-correlation screening report of
+// the player query parameter over the games of a finished job group, as JSON
+// or, with format=md, as Markdown. Batches run at a single depth, so the
+// report has a single row; the screen subcommand compares several.
+func (app *Application) jobGroupScreeningHandler(w http.ResponseWriter, r *http.Request) {
+	group, ok := app.jobs.get(mux.Vars(r)["id"])
+	if !ok {
+		http.Error(w, "Job group not found", http.StatusNotFound)
+		return
+	}
+	player := r.URL.Query().Get("player")
+	if player == "" {
+		http.Error(w, "A player is needed", http.StatusBadRequest)
+		return
+	}
+	if group.status().Status != jobDone {
+		http.Error(w, "The batch is still running", http.StatusConflict)
+		return
+	}
+	report := chessanalysis.ScreenPlayer(group.analyses(), player)
+	if r.URL.Query().Get("format") == "md" {
+		w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+		fmt.Fprint(w, report.Markdown())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		fmt.Printf("Error writing screening report: %v\n", err)
+	}
+}
@@ -1,21 +1,44 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
 	"embed"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	htmltemplate "html/template"
+	"io"
 	"io/fs"
+	"net"
 	"net/http"
+	"net/netip"
+	"net/url"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
 	"strings"
 	"sync"
+	"syscall"
+	"text/tabwriter"
 	"text/template"
+	"time"
 
 	"github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
 	"github.com/gorilla/websocket"
 	"github.com/walterschell/chess-analyzer/chessanalysis"
+	"github.com/walterschell/chess-analyzer/chessanalysis/report"
+	"github.com/walterschell/chess-analyzer/chessanalysis/uciengine"
 )
 
 const DefaultPort = 8080
@@ -25,6 +48,7 @@ const DefaultPort = 8080
 //go:embed assets/templates/*
 var assets embed.FS
 var static fs.FS
+var pieces fs.FS
 var templates fs.FS
 
 func init() {
@@ -33,6 +57,10 @@ func init() {
 	if err != nil {
 		panic(fmt.Sprintf("Failed to load static files: %v", err))
 	}
+	pieces, err = fs.Sub(static, "pieces")
+	if err != nil {
+		panic(fmt.Sprintf("Failed to load piece images: %v", err))
+	}
 	templates, err = fs.Sub(assets, "assets/templates")
 	if err != nil {
 		panic(fmt.Sprintf("Failed to load templates: %v", err))
@@ -42,14 +70,580 @@ func init() {
 type Client struct {
 	conn        *websocket.Conn
 	application *Application
+	ctx         context.Context // Cancelled when the connection closes
+	cancel      context.CancelFunc
+
+	writeLock sync.Mutex  // Serializes writes to conn, see send
+	msgpack   bool        // Whether the client negotiated MessagePack messages, see msgpackMessage
+	apiKey    *apiKeyHash // The connection was opened with, if any, whose quota its jobs count against
+
+	boardsLock sync.Mutex
+	boards     map[string]*Board // Open boards by ID, see board
+}
+
+// maxBoardsPerClient is how many boards one connection can have open at once
+const maxBoardsPerClient = 16
+
+// Board is one of the boards a client multiplexes over its connection, such
+// as an analysis tab. Each has its own analyses, kibitzer and guess-the-move
+// session, and every message to and from it carries its boardId. Clients
+// that send no boardId use the board with the empty ID.
+type Board struct {
+	client *Client
+	id     string
+	ctx    context.Context // Cancelled when the board or the connection closes
+	cancel context.CancelFunc
+
+	guessLock sync.Mutex
+	guess     *chessanalysis.GuessSession // The guess-the-move session in progress, if any
+
+	kibitzLock sync.Mutex
+	stopKibitz context.CancelFunc // Stops the kibitzer's search in progress, if any
+	stopPonder context.CancelFunc // Stops pondering the next positions, if in progress
+
+	evalLock    sync.Mutex
+	evals       bool                   // Whether the client subscribed to eval messages, see queueEval
+	pendingEval *chessanalysis.EvalBar // The latest evaluation not yet written, if any
+	writingEval bool                   // Whether a goroutine is writing pendingEval
+
+	roomLock sync.Mutex
+	hosting  *Room // The room sharing the board's messages, if any
+	watching *Room // The room the board is a viewer of, if any
+}
+
+// maxRoomHistory is how many messages of the host's current analysis a room
+// keeps to replay to viewers who join late
+const maxRoomHistory = 2000
+
+// roomViewerBacklog is how many messages a viewer can fall behind the host
+// before it is dropped from the room, on top of the history sent on joining
+const roomViewerBacklog = 256
+
+// Room shares the messages of a host's board read-only with viewers on other
+// boards, usually of other connections, as for a club lecture or a stream. Viewers who join
+// late are first sent the messages of the host's current analysis.
+type Room struct {
+	id string
+
+	lock    sync.Mutex
+	history []Message // The host's messages since its analysis started
+	viewers map[*Board]*outbox
+	closed  bool
+}
+
+// outbox queues the messages of a room or of the relay for one client, which
+// its own goroutine writes, so a slow connection holds up neither the sender
+// nor other clients. Its sender queues messages and closes it under a lock of
+// its own.
+type outbox struct {
+	client   *Client
+	messages chan Message
+	last     *Message // Sent once the outbox is closed and drained, if set
+}
+
+// newOutbox makes an outbox holding up to size messages for the client
+func newOutbox(client *Client, size int) *outbox {
+	return &outbox{client: client, messages: make(chan Message, size)}
+}
+
+// push queues the message, or closes the outbox with behind as its last
+// message if the client has fallen too far behind to take it. It reports
+// whether the message was queued.
+func (o *outbox) push(message, behind Message) bool {
+	select {
+	case o.messages <- message:
+		return true
+	default:
+		o.close(&behind)
+		return false
+	}
+}
+
+// close lets the writer go once it has sent the queued messages, followed by
+// last if given
+func (o *outbox) close(last *Message) {
+	o.last = last
+	close(o.messages)
+}
+
+// write sends the queued messages until the outbox is closed, then its last
+// message, if any, calling detach first if given
+func (o *outbox) write(detach func()) {
+	for message := range o.messages {
+		o.client.send(message)
+	}
+	if o.last == nil {
+		return
+	}
+	if detach != nil {
+		detach()
+	}
+	o.client.send(*o.last)
 }
 
 type Application struct {
-	router      *mux.Router
-	templates   *template.Template
-	clients     map[*Client]interface{}
-	clientsLock sync.RWMutex
-	upgrader    websocket.Upgrader
+	router        *mux.Router
+	templates     *template.Template
+	noScript      *htmltemplate.Template // The page for browsers without JavaScript, which shows games' tags, so it escapes them
+	clients       map[*Client]interface{}
+	clientsLock   sync.RWMutex
+	upgrader      websocket.Upgrader
+	engineFactory chessanalysis.EngineFactory
+	secondOpinion chessanalysis.EngineFactory // Second engine searching alongside the first, or nil for one engine
+	enginePool    *chessanalysis.EnginePool   // Shared by every analysis the server runs
+	kibitzCache   *chessanalysis.KibitzCache  // Positions the kibitzer searched or pondered, see Board.ponder
+
+	relay            *chessanalysis.Relay // The live relay being followed, if any
+	relayRound       string               // Lichess broadcast round of the relay, if it is one
+	relaySubscribers map[*Client]*outbox
+	relayLock        sync.Mutex
+
+	analyses *analysisStore // Finished analyses, for the analyses API
+	sessions *sessionStore  // Of users logged in with OAuth, see lichessCallbackHandler
+
+	rooms     map[string]*Room // Open rooms by ID
+	roomsLock sync.Mutex
+
+	books      *chessanalysis.BookShelf // Opening books of the analyses, see booksHandler
+	adminToken string                   // Bearer token of the admin API, which is disabled without one
+	quotas     *quotaTracker            // What each API key is using, see startJob
+	jobs       *jobStore                // Job groups of the batch API, see batchHandler
+
+	engineInfo     *chessanalysis.EngineInfo // What the engine reported when it first started, see enginesHandler
+	engineInfoLock sync.Mutex
+
+	// The settings of the configuration file, which reloading it replaces
+	// while the server runs, see applyConfig
+	limits       chessanalysis.InputLimits             // Largest PGN the server accepts, over the websocket and the API
+	access       *accessControl                        // Who may use the server at all, or nil to let everyone
+	profiles     []AnalysisProfile                     // Analysis settings clients choose by name, see profilesHandler
+	translations map[string]chessanalysis.Translations // By language, see messagesHandler
+	maxDepth     int                                   // Deepest analysis clients may ask for if set, see depthCap
+	configBooks  []string                              // Names of the books loaded from the configuration file
+	retention    RetentionConfig                       // How long analyses and evaluations are kept, see purgeExpired
+	lichess      *lichessLogin                         // Lets users log in with Lichess, if set
+	repertoires  map[string]*chessanalysis.Repertoire  // Players' prepared openings by name, see Config.Repertoires
+	configLock   sync.RWMutex                          // Guards the settings above
+	configPath   string                                // Of the configuration file, if the server was started with one
+	// flagLimits are the input limits of the command line, and limitFlags
+	// those of them given explicitly, which win over the file's
+	flagLimits chessanalysis.InputLimits
+	limitFlags []string
+
+	symbols chessanalysis.ClassificationSymbols // Shown with the classifications of analyses
+}
+
+// Config is the server's configuration file, given with -config
+type Config struct {
+	Access AccessConfig               `json:"access"`
+	Limits *chessanalysis.InputLimits `json:"limits,omitempty"` // Instead of the default input limits
+	// SecondOpinion is a UCI engine binary, such as "lc0", searching every
+	// move of the browser's analyses alongside the main engine
+	SecondOpinion string `json:"secondOpinion,omitempty"`
+	// Profiles replace the default analysis profiles
+	Profiles []AnalysisProfile `json:"profiles,omitempty"`
+	// Translations of the messages clients show, by language such as "fr";
+	// see chessanalysis.EnglishMessages for the message IDs
+	Translations map[string]chessanalysis.Translations `json:"translations,omitempty"`
+	// MaxDepth caps the depth of analyses below maxAnalysisDepth
+	MaxDepth int `json:"maxDepth,omitempty"`
+	// Books are paths of polyglot opening books analyses use, each under its
+	// file name alongside the books added with the admin API
+	Books []string `json:"books,omitempty"`
+	// Retention is how long stored analyses and cached evaluations are kept
+	Retention RetentionConfig `json:"retention"`
+	// OAuth lets users log in, to keep their analyses private
+	OAuth OAuthConfig `json:"oauth"`
+	// Repertoires are paths of PGNs of players' prepared openings, by the
+	// player's name in the White and Black tags, which analyses check their
+	// games against; see chessanalysis.WithRepertoire
+	Repertoires map[string]string `json:"repertoires,omitempty"`
+}
+
+// RetentionConfig is how long each store of the server keeps what it is
+// given, in minutes. Stores left at zero keep everything until they are full
+// and forget the oldest, see maxStoredAnalyses.
+type RetentionConfig struct {
+	AnalysesMinutes int `json:"analysesMinutes,omitempty"` // Of the analyses API
+	EvalsMinutes    int `json:"evalsMinutes,omitempty"`    // Of the kibitzer's evaluations, see chessanalysis.KibitzCache
+}
+
+// retentionInterval is how often expired analyses and evaluations are purged
+const retentionInterval = time.Minute
+
+// AnalysisProfile is a named set of search settings, so that clients choose
+// how thorough an analysis is without knowing engine parameters
+type AnalysisProfile struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Depth       int    `json:"depth,omitempty"`      // Search depth per move; exclusive with MoveTimeMs
+	MoveTimeMs  int    `json:"moveTimeMs,omitempty"` // Search time per move
+	MultiPV     int    `json:"multiPV,omitempty"`    // Engine lines per position, 1 if unset
+	Tablebase   bool   `json:"tablebase,omitempty"`  // Whether unfinished games are adjudicated with the Lichess tablebase
+	// DepthRetries is how many times a search that stops short of Depth is
+	// repeated, see chessanalysis.WithDepthRetries
+	DepthRetries int `json:"depthRetries,omitempty"`
+	// VerifyMates confirms missed mates with a mate search, see
+	// chessanalysis.WithMateVerification
+	VerifyMates bool `json:"verifyMates,omitempty"`
+	// Contempt is passed to engines with a Contempt option, see
+	// chessanalysis.WithContempt
+	Contempt int `json:"contempt,omitempty"`
+	// PracticalTries looks for the most complicating defence in lost
+	// positions, see chessanalysis.WithPracticalTries
+	PracticalTries bool `json:"practicalTries,omitempty"`
+	// SkipForced leaves forced moves unsearched, see
+	// chessanalysis.WithSkipForced
+	SkipForced bool `json:"skipForced,omitempty"`
+	// EarlyStop searches games that are already decided less, see
+	// chessanalysis.WithEarlyStop
+	EarlyStop *chessanalysis.EarlyStop `json:"earlyStop,omitempty"`
+}
+
+// defaultProfiles are the analysis profiles of a server configured without any
+var defaultProfiles = []AnalysisProfile{
+	{Name: "quick", Description: "A fast look at the whole game", Depth: 12, SkipForced: true, EarlyStop: &chessanalysis.EarlyStop{Centipawns: 600, Moves: 6}},
+	{Name: "standard", Description: "A solid analysis for most games", Depth: 18, MultiPV: 2},
+	{Name: "deep", Description: "Five seconds a move, three lines, and tablebases for endgames", MoveTimeMs: 5000, MultiPV: 3, Tablebase: true},
+}
+
+// options returns the analysis options of the profile's search settings
+func (profile AnalysisProfile) options() []chessanalysis.AnalyzeChessGameOption {
+	var opts []chessanalysis.AnalyzeChessGameOption
+	if profile.Depth > 0 {
+		opts = append(opts, chessanalysis.WithDepth(profile.Depth))
+	}
+	if profile.MoveTimeMs > 0 {
+		opts = append(opts, chessanalysis.WithMoveTime(time.Duration(profile.MoveTimeMs)*time.Millisecond))
+	}
+	if profile.MultiPV > 0 {
+		opts = append(opts, chessanalysis.WithMultiPV(profile.MultiPV))
+	}
+	if profile.Tablebase {
+		opts = append(opts, chessanalysis.WithTablebase(chessanalysis.NewLichessTablebase()))
+	}
+	if profile.DepthRetries > 0 {
+		opts = append(opts, chessanalysis.WithDepthRetries(profile.DepthRetries))
+	}
+	if profile.VerifyMates {
+		opts = append(opts, chessanalysis.WithMateVerification())
+	}
+	if profile.Contempt != 0 {
+		opts = append(opts, chessanalysis.WithContempt(profile.Contempt))
+	}
+	if profile.PracticalTries {
+		opts = append(opts, chessanalysis.WithPracticalTries())
+	}
+	if profile.SkipForced {
+		opts = append(opts, chessanalysis.WithSkipForced())
+	}
+	if profile.EarlyStop != nil {
+		opts = append(opts, chessanalysis.WithEarlyStop(*profile.EarlyStop))
+	}
+	return opts
+}
+
+// validateProfiles checks that profiles have distinct names and settings an
+// analysis accepts
+func validateProfiles(profiles []AnalysisProfile) error {
+	names := make(map[string]bool)
+	for _, profile := range profiles {
+		if profile.Name == "" || names[profile.Name] {
+			return fmt.Errorf("analysis profile names must be unique and not empty, got %q", profile.Name)
+		}
+		names[profile.Name] = true
+		if _, err := chessanalysis.ResolveOptions(profile.options()...); err != nil {
+			return fmt.Errorf("analysis profile %s: %w", profile.Name, err)
+		}
+	}
+	return nil
+}
+
+// profile returns the analysis profile with the given name
+func (app *Application) profile(name string) (AnalysisProfile, bool) {
+	app.configLock.RLock()
+	defer app.configLock.RUnlock()
+	for _, profile := range app.profiles {
+		if profile.Name == name {
+			return profile, true
+		}
+	}
+	return AnalysisProfile{}, false
+}
+
+// inputLimits returns the largest PGN the server currently accepts
+func (app *Application) inputLimits() chessanalysis.InputLimits {
+	app.configLock.RLock()
+	defer app.configLock.RUnlock()
+	return app.limits
+}
+
+// repertoireOptions returns the options checking games against the
+// repertoires of the configuration file
+func (app *Application) repertoireOptions() []chessanalysis.AnalyzeChessGameOption {
+	app.configLock.RLock()
+	defer app.configLock.RUnlock()
+	var opts []chessanalysis.AnalyzeChessGameOption
+	for player, repertoire := range app.repertoires {
+		opts = append(opts, chessanalysis.WithRepertoire(player, repertoire))
+	}
+	return opts
+}
+
+// accessControl returns who may currently use the server, or nil for everyone
+func (app *Application) accessControl() *accessControl {
+	app.configLock.RLock()
+	defer app.configLock.RUnlock()
+	return app.access
+}
+
+// depthCap returns the deepest analysis clients may currently ask for
+func (app *Application) depthCap() int {
+	app.configLock.RLock()
+	defer app.configLock.RUnlock()
+	if app.maxDepth > 0 {
+		return min(app.maxDepth, maxAnalysisDepth)
+	}
+	return maxAnalysisDepth
+}
+
+// applyConfig replaces the settings of the configuration file with config's:
+// the access control, input limits, analysis profiles, translations, depth
+// cap, retention and the opening books loaded from the file. The input limits given on
+// the command line still win. Nothing changes if any setting is invalid.
+//
+// Analyses already running keep the settings they started with, and open
+// connections and engines carry on, so the file can be reloaded at any time.
+// The second opinion engine is only read when the server starts.
+func (app *Application) applyConfig(config *Config) error {
+	access, err := newAccessControl(config.Access)
+	if err != nil {
+		return err
+	}
+	lichess, err := newLichessLogin(config.OAuth.Lichess)
+	if err != nil {
+		return err
+	}
+	if config.Profiles != nil {
+		if err := validateProfiles(config.Profiles); err != nil {
+			return err
+		}
+	}
+	if config.MaxDepth < 0 {
+		return fmt.Errorf("the maximum depth can't be negative, got %d", config.MaxDepth)
+	}
+	if config.Retention.AnalysesMinutes < 0 || config.Retention.EvalsMinutes < 0 {
+		return errors.New("retention periods can't be negative")
+	}
+	books := make(map[string][]byte)
+	for _, path := range config.Books {
+		book, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("reading book: %w", err)
+		}
+		if _, err := chessanalysis.NewPolyglotTheory(book); err != nil {
+			return fmt.Errorf("invalid book %s: %w", path, err)
+		}
+		books[filepath.Base(path)] = book
+	}
+	repertoires := make(map[string]*chessanalysis.Repertoire)
+	for player, path := range config.Repertoires {
+		pgn, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("reading repertoire: %w", err)
+		}
+		if repertoires[player], err = chessanalysis.NewRepertoire(string(pgn)); err != nil {
+			return fmt.Errorf("invalid repertoire %s: %w", path, err)
+		}
+	}
+	limits := app.flagLimits
+	if config.Limits != nil {
+		limits = *config.Limits
+		for _, name := range app.limitFlags {
+			switch name {
+			case "max-pgn-bytes":
+				limits.MaxPGNBytes = app.flagLimits.MaxPGNBytes
+			case "max-games":
+				limits.MaxGames = app.flagLimits.MaxGames
+			case "max-plies":
+				limits.MaxPlies = app.flagLimits.MaxPlies
+			}
+		}
+	}
+
+	app.configLock.Lock()
+	defer app.configLock.Unlock()
+	app.access, app.limits, app.translations, app.maxDepth = access, limits, config.Translations, config.MaxDepth
+	app.retention = config.Retention
+	app.lichess = lichess
+	app.repertoires = repertoires
+	if config.Profiles != nil {
+		app.profiles = config.Profiles
+	} else {
+		app.profiles = defaultProfiles
+	}
+	for _, name := range app.configBooks {
+		if books[name] == nil {
+			app.books.Remove(name)
+		}
+	}
+	app.configBooks = app.configBooks[:0]
+	for name, book := range books {
+		app.books.Put(name, book)
+		app.configBooks = append(app.configBooks, name)
+	}
+	return nil
+}
+
+// purgeExpired forgets the analyses and evaluations older than the retention
+// periods at the given time, returning how many of each it forgot
+func (app *Application) purgeExpired(now time.Time) (analyses, evals int) {
+	app.configLock.RLock()
+	retention := app.retention
+	app.configLock.RUnlock()
+	if retention.AnalysesMinutes > 0 {
+		analyses = app.analyses.purge(now.Add(-time.Duration(retention.AnalysesMinutes) * time.Minute))
+	}
+	if retention.EvalsMinutes > 0 {
+		evals = app.kibitzCache.Purge(now.Add(-time.Duration(retention.EvalsMinutes) * time.Minute))
+	}
+	return analyses, evals
+}
+
+// reload reads the configuration file again and applies it, see applyConfig
+func (app *Application) reload() error {
+	if app.configPath == "" {
+		return errNoConfig
+	}
+	config, err := loadConfig(app.configPath)
+	if err != nil {
+		return err
+	}
+	return app.applyConfig(config)
+}
+
+// errNoConfig is returned when reloading a server started without -config
+var errNoConfig = errors.New("the server was started without a configuration file")
+
+// AccessConfig restricts who may use the server, for deployments without a
+// reverse proxy in front of them. It covers every route, the websocket
+// included.
+type AccessConfig struct {
+	AllowedIPs []string          `json:"allowedIps,omitempty"` // Addresses and CIDR ranges of clients allowed in; empty allows any
+	Users      map[string]string `json:"users,omitempty"`      // Passwords by user name for HTTP basic auth; empty requires none
+	// APIKeys are the quotas of the API keys clients may present in place of
+	// a user's password, see presentedAPIKey
+	APIKeys map[string]APIKeyQuota `json:"apiKeys,omitempty"`
+}
+
+// loadConfig reads the configuration file at path
+func loadConfig(path string) (*Config, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	decoder := json.NewDecoder(file)
+	decoder.DisallowUnknownFields()
+	var config Config
+	if err := decoder.Decode(&config); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	return &config, nil
+}
+
+// accessControl is an AccessConfig ready to check requests against
+type accessControl struct {
+	allowed []netip.Prefix
+	users   map[string][sha256.Size]byte // Password hashes, so they compare in constant time whatever their length
+	keys    map[apiKeyHash]APIKeyQuota   // Quotas by API key hash
+}
+
+// newAccessControl checks the configured addresses, returning nil if the
+// configuration lets everyone in
+func newAccessControl(config AccessConfig) (*accessControl, error) {
+	if len(config.AllowedIPs) == 0 && len(config.Users) == 0 && len(config.APIKeys) == 0 {
+		return nil, nil
+	}
+	access := &accessControl{users: make(map[string][sha256.Size]byte), keys: make(map[apiKeyHash]APIKeyQuota)}
+	for _, allowed := range config.AllowedIPs {
+		prefix, err := netip.ParsePrefix(allowed)
+		if err != nil {
+			addr, addrErr := netip.ParseAddr(allowed)
+			if addrErr != nil {
+				return nil, fmt.Errorf("invalid allowed IP %q: %w", allowed, err)
+			}
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		access.allowed = append(access.allowed, prefix.Masked())
+	}
+	for user, password := range config.Users {
+		access.users[user] = sha256.Sum256([]byte(password))
+	}
+	for key, quota := range config.APIKeys {
+		if key == "" {
+			return nil, errors.New("API keys can't be empty")
+		}
+		if quota.MaxConcurrentJobs < 0 || quota.MaxEngineSecondsPerDay < 0 || quota.MaxDepth < 0 {
+			return nil, fmt.Errorf("the quota of API key %q can't be negative", quota.Name)
+		}
+		access.keys[sha256.Sum256([]byte(key))] = quota
+	}
+	return access, nil
+}
+
+// allowedIP reports whether the request comes from an allowed address.
+// Requests over a Unix socket have no address and count as local: the
+// socket's file permissions decide who may connect, and a reverse proxy in
+// front of it checks its own clients.
+func (access *accessControl) allowedIP(r *http.Request) bool {
+	if len(access.allowed) == 0 {
+		return true
+	}
+	if local, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr); ok && local.Network() == "unix" {
+		return true
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range access.allowed {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// authenticated reports whether the request bears the credentials of a user
+func (access *accessControl) authenticated(r *http.Request) bool {
+	if len(access.users) == 0 && len(access.keys) == 0 {
+		return true
+	}
+	user, password, ok := r.BasicAuth()
+	if !ok {
+		return false
+	}
+	want, known := access.users[user]
+	got := sha256.Sum256([]byte(password))
+	return subtle.ConstantTimeCompare(got[:], want[:]) == 1 && known
+}
+
+// apiKey returns the hash of the configured API key the request bears, if
+// it bears one
+func (access *accessControl) apiKey(r *http.Request) (apiKeyHash, bool) {
+	key, ok := presentedAPIKey(r)
+	if !ok {
+		return apiKeyHash{}, false
+	}
+	hash := apiKeyHash(sha256.Sum256([]byte(key)))
+	_, known := access.keys[hash]
+	return hash, known
 }
 
 type Message struct {
@@ -57,6 +651,139 @@ type Message struct {
 	PGN   string `json:"pgn,omitempty"`
 	Text  string `json:"text,omitempty"`
 	Depth int    `json:"depth,omitempty"`
+	Color string `json:"color,omitempty"` // Side to guess in guess-start messages
+	ID    string `json:"id,omitempty"`    // Stored analysis of summary messages, see analysisHandler, or room of room messages
+	Hash  string `json:"hash,omitempty"`  // Content hash of the stored analysis of summary messages, its ETag in the analyses API
+
+	Profile    string `json:"profile,omitempty"`    // Analysis profile of analyze messages, instead of their depth
+	Classifier string `json:"classifier,omitempty"` // Classifier profile of analyze messages, see chessanalysis.ClassifierProfiles
+	// Diagnostics asks analyze messages for each move's engine diagnostics,
+	// see chessanalysis.WithDiagnostics
+	Diagnostics bool `json:"diagnostics,omitempty"`
+	// MustWin judges analyze messages' games for the side, "White" or
+	// "Black", that had to win; see chessanalysis.WithPracticalMode
+	MustWin string `json:"mustWin,omitempty"`
+	// Compact and Fields ask analyze messages for shorter analysis, refined
+	// and summary messages, see chessanalysis.MoveJSONOptions
+	Compact bool     `json:"compact,omitempty"`
+	Fields  []string `json:"fields,omitempty"`
+	// Private keeps the stored analysis of analyze messages to the account the
+	// connection was opened with, see ownership
+	Private bool `json:"private,omitempty"`
+
+	BoardID string `json:"boardId,omitempty"` // Board of the connection the message is for, see Board
+
+	Ply int `json:"ply,omitempty"` // Move of whatif messages, from 0 for White's first
+}
+
+// maxStoredAnalyses is how many finished analyses the server keeps for the
+// analyses API before forgetting the oldest
+const maxStoredAnalyses = 1000
+
+// analysisStore keeps finished game analyses in memory by ID
+type analysisStore struct {
+	lock     sync.Mutex
+	analyses map[string]storedAnalysis
+	order    []string // IDs, oldest first
+}
+
+// storedAnalysis is a finished analysis with the hash of its JSON, which
+// tells clients whether the copy they have is still current
+type storedAnalysis struct {
+	game  *chessanalysis.GameAnalysis
+	pgn   string // The game as it was analyzed, to analyze it again
+	hash  string
+	added time.Time // When it was stored, see purge
+	// version counts the analyses of the game from 1, and previous are the
+	// versions this one replaced, oldest first; see replace
+	version  int
+	previous []storedAnalysis
+	notes    AnalysisNotes // Kept by every version
+	ownership
+}
+
+func newAnalysisStore() *analysisStore {
+	return &analysisStore{analyses: make(map[string]storedAnalysis)}
+}
+
+// contentHash returns the hex-encoded SHA-256 of content, shortened to 128
+// bits, which is plenty to tell versions of an analysis apart
+func contentHash(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:16])
+}
+
+// randomID returns a random ID of the given number of bytes, hex-encoded
+func randomID(bytes int) string {
+	random := make([]byte, bytes)
+	rand.Read(random)
+	return hex.EncodeToString(random)
+}
+
+// add stores the analysis of the game in the PGN, encoded as JSON as
+// content, and returns its new ID and its content hash
+func (s *analysisStore) add(game *chessanalysis.GameAnalysis, pgn string, content []byte, owned ownership) (id, hash string) {
+	id, hash = randomID(8), contentHash(content)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if len(s.order) >= maxStoredAnalyses {
+		delete(s.analyses, s.order[0])
+		s.order = s.order[1:]
+	}
+	s.analyses[id] = storedAnalysis{game: game, pgn: pgn, hash: hash, added: time.Now(), version: 1, ownership: owned}
+	s.order = append(s.order, id)
+	return id, hash
+}
+
+// purge forgets the analyses stored before the given time, returning how
+// many it forgot. Analyses are stored in order, so it stops at the first one
+// to keep.
+func (s *analysisStore) purge(before time.Time) int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	purged := 0
+	for purged < len(s.order) && s.analyses[s.order[purged]].added.Before(before) {
+		delete(s.analyses, s.order[purged])
+		purged++
+	}
+	s.order = s.order[purged:]
+	return purged
+}
+
+// get returns the analysis with the given ID, if it is still stored
+func (s *analysisStore) get(id string) (storedAnalysis, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	stored, ok := s.analyses[id]
+	return stored, ok
+}
+
+// notModified sets the ETag of a response and reports whether the request's
+// If-None-Match already names it, in which case it has answered 304 Not
+// Modified and the handler has nothing more to write
+func notModified(w http.ResponseWriter, r *http.Request, etag string) bool {
+	etag = `"` + etag + `"`
+	w.Header().Set("ETag", etag)
+	for _, match := range strings.Split(r.Header.Get("If-None-Match"), ",") {
+		// If-None-Match compares weakly, so W/ tags match their strong tag
+		match = strings.TrimPrefix(strings.TrimSpace(match), "W/")
+		if match == etag || match == "*" {
+			w.WriteHeader(http.StatusNotModified)
+			return true
+		}
+	}
+	return false
+}
+
+// guessMultiPV is how many engine lines guess-the-move games are analyzed
+// with, so that good moves besides the best one score points
+const guessMultiPV = 5
+
+// GuessPrompt is the position sent to the client for its next guess
+type GuessPrompt struct {
+	MoveNumber int    `json:"moveNumber"`
+	Color      string `json:"color"`
+	FEN        string `json:"fen"`
 }
 
 func NewApplication() *Application {
@@ -66,11 +793,26 @@ func NewApplication() *Application {
 	app := &Application{
 		router:    mux.NewRouter(),
 		templates: template.Must(templateParser.ParseFS(templates, "*.html.gotmpl")),
+		noScript:  htmltemplate.Must(htmltemplate.New("").Delims("[[", "]]").ParseFS(templates, "noscript.html.gotmpl")),
 		clients:   make(map[*Client]interface{}),
 		upgrader: websocket.Upgrader{
 			ReadBufferSize:  1024,
 			WriteBufferSize: 1024,
+			Subprotocols:    []string{msgpackSubprotocol},
 		},
+		engineFactory: uciengine.StockfishEngineFactory,
+		enginePool:    chessanalysis.NewEnginePool(runtime.NumCPU()),
+		kibitzCache:   chessanalysis.NewKibitzCache(),
+
+		relaySubscribers: make(map[*Client]*outbox),
+		analyses:         newAnalysisStore(),
+		sessions:         newSessionStore(),
+		rooms:            make(map[string]*Room),
+		books:            chessanalysis.NewBookShelf(),
+		quotas:           newQuotaTracker(),
+		jobs:             newJobStore(),
+		limits:           chessanalysis.DefaultInputLimits,
+		profiles:         defaultProfiles,
 	}
 
 	app.router.NotFoundHandler = stdoutLogger(http.HandlerFunc(notFoundHandler))
@@ -92,131 +834,2390 @@ func NewApplication() *Application {
 
 	app.router.HandleFunc("/", app.indexHandler)
 	app.router.HandleFunc("/ws", app.wsHandler)
+	app.router.HandleFunc("/noscript", app.noScriptHandler).Methods(http.MethodGet, http.MethodPost)
+	app.router.HandleFunc("/export/anki", app.ankiHandler).Methods(http.MethodPost)
+	app.router.HandleFunc("/export/gif", app.gifHandler).Methods(http.MethodPost)
+	app.router.HandleFunc("/api/v1/board.svg", app.boardHandler).Methods(http.MethodGet)
+	app.router.HandleFunc("/api/v1/broadcasts/{round}/overview", app.broadcastOverviewHandler).Methods(http.MethodGet)
+	app.router.HandleFunc("/api/v1/analyses", app.listAnalysesHandler).Methods(http.MethodGet)
+	app.router.HandleFunc("/api/v1/analyses/{id:[0-9a-f]+}.csv", app.analysisCSVHandler).Methods(http.MethodGet)
+	app.router.HandleFunc("/api/v1/analyses/{id:[0-9a-f]+}", app.analysisHandler).Methods(http.MethodGet)
+	app.router.HandleFunc("/api/v1/analyses/{id:[0-9a-f]+}.pgn", app.analysisPGNHandler).Methods(http.MethodGet)
+	app.router.HandleFunc("/api/v1/analyses/{id:[0-9a-f]+}/whatif", app.whatIfHandler).Methods(http.MethodPost)
+	app.router.HandleFunc("/api/v1/analyses/{id:[0-9a-f]+}/reanalyze", app.reanalyzeHandler).Methods(http.MethodPost)
+	app.router.HandleFunc("/api/v1/analyses/{id:[0-9a-f]+}/versions", app.analysisVersionsHandler).Methods(http.MethodGet)
+	app.router.HandleFunc("/api/v1/analyses/{id:[0-9a-f]+}/versions/{version:[0-9]+}", app.analysisVersionHandler).Methods(http.MethodGet)
+	app.router.HandleFunc("/api/v1/analyses/{id:[0-9a-f]+}/diff", app.analysisDiffHandler).Methods(http.MethodGet)
+	app.router.HandleFunc("/api/v1/analyses/{id:[0-9a-f]+}/gate", app.analysisGateHandler).Methods(http.MethodGet)
+	app.router.HandleFunc("/api/v1/analyses/{id:[0-9a-f]+}/notes", app.analysisNotesHandler).Methods(http.MethodGet)
+	app.router.HandleFunc("/api/v1/analyses/{id:[0-9a-f]+}/notes", app.putAnalysisNotesHandler).Methods(http.MethodPut)
+	app.router.HandleFunc("/api/v1/analyses/{id:[0-9a-f]+}/lichess-study", app.studyExportHandler).Methods(http.MethodPost)
+	app.router.HandleFunc("/api/v1/diff", app.diffHandler).Methods(http.MethodPost)
+	app.router.HandleFunc("/api/v1/account", app.accountHandler).Methods(http.MethodGet)
+	app.router.HandleFunc("/auth/lichess", app.lichessLoginHandler).Methods(http.MethodGet)
+	app.router.HandleFunc("/auth/lichess/callback", app.lichessCallbackHandler).Methods(http.MethodGet)
+	app.router.HandleFunc("/auth/logout", app.logoutHandler).Methods(http.MethodPost)
+	app.router.HandleFunc("/api/v1/engines", app.enginesHandler).Methods(http.MethodGet)
+	app.router.HandleFunc("/api/v1/profiles", app.profilesHandler).Methods(http.MethodGet)
+	app.router.HandleFunc("/api/v1/messages/{lang}", app.messagesHandler).Methods(http.MethodGet)
+	app.router.HandleFunc("/api/v1/validate", app.validateHandler).Methods(http.MethodPost)
+	app.router.HandleFunc("/api/v1/analyze", app.analyzeHandler).Methods(http.MethodPost)
+	app.router.HandleFunc("/api/v1/analyze.ndjson", app.analyzeStreamHandler).Methods(http.MethodPost)
+	app.router.HandleFunc("/api/v1/jobs/batch", app.batchHandler).Methods(http.MethodPost)
+	app.router.HandleFunc("/api/v1/jobs/lichess-study", app.studyImportHandler).Methods(http.MethodPost)
+	app.router.HandleFunc("/api/v1/jobs/{id:[0-9a-f]+}", app.jobGroupHandler).Methods(http.MethodGet)
+	app.router.HandleFunc("/api/v1/jobs/{id:[0-9a-f]+}/report", app.jobGroupReportHandler).Methods(http.MethodGet)
+	app.router.HandleFunc("/api/v1/jobs/{id:[0-9a-f]+}/screening", app.jobGroupScreeningHandler).Methods(http.MethodGet)
+	admin := app.router.PathPrefix(adminPathPrefix).Subrouter()
+	admin.Use(app.requireAdmin)
+	admin.HandleFunc("/books", app.booksHandler).Methods(http.MethodGet)
+	admin.HandleFunc("/reload", app.reloadHandler).Methods(http.MethodPost)
+	admin.HandleFunc("/purge", app.purgeHandler).Methods(http.MethodPost)
+	admin.HandleFunc("/jobs/{id:[0-9a-f]+}/engine-log", app.jobEngineLogHandler).Methods(http.MethodGet)
+	admin.HandleFunc("/books/{name:[A-Za-z0-9._-]+}", app.putBookHandler).Methods(http.MethodPut)
+	admin.HandleFunc("/books/{name:[A-Za-z0-9._-]+}", app.deleteBookHandler).Methods(http.MethodDelete)
 
 	return app
 }
 
-func (app *Application) indexHandler(w http.ResponseWriter, r *http.Request) {
-	templateVars := struct {
-		Title string
-	}{
-		Title: "Chess Game Analyzer",
+// boardHandler renders the position given by the fen query parameter as an
+// SVG, with the optional arrows parameter in the format of ParseArrows,
+// highlights as a comma-separated list of squares and orientation set to
+// Black to flip the board
+func (app *Application) boardHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	arrows, err := chessanalysis.ParseArrows(query.Get("arrows"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
-
-	err := app.templates.ExecuteTemplate(w, "index.html.gotmpl", templateVars)
+	var highlights []string
+	if squares := query.Get("highlights"); squares != "" {
+		highlights = strings.Split(squares, ",")
+	}
+	svg, err := chessanalysis.BoardSVG(query.Get("fen"),
+		chessanalysis.WithArrows(arrows...),
+		chessanalysis.WithHighlights(highlights...),
+		chessanalysis.WithOrientation(query.Get("orientation")),
+		chessanalysis.WithPieceImages(pieces),
+	)
 	if err != nil {
-		fmt.Printf("Error rendering template: %v\n", err)
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
+	w.Header().Set("Content-Type", "image/svg+xml")
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	w.Write([]byte(svg))
 }
 
-func (app *Application) wsHandler(w http.ResponseWriter, r *http.Request) {
-	conn, err := app.upgrader.Upgrade(w, r, nil)
-	if err != nil {
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+// broadcastOverviewHandler returns the current evaluation of every game of
+// the Lichess broadcast round being followed
+func (app *Application) broadcastOverviewHandler(w http.ResponseWriter, r *http.Request) {
+	app.relayLock.Lock()
+	relay, round := app.relay, app.relayRound
+	app.relayLock.Unlock()
+	if relay == nil || round != mux.Vars(r)["round"] {
+		http.Error(w, "Broadcast round is not being followed", http.StatusNotFound)
 		return
 	}
-	fmt.Printf("New websocket connection from %s\n", conn.RemoteAddr())
-	client := &Client{
-		conn:        conn,
-		application: app,
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(relay.Overview()); err != nil {
+		fmt.Printf("Error writing broadcast overview: %v\n", err)
 	}
-	app.clientsLock.Lock()
-	app.clients[client] = nil
-	app.clientsLock.Unlock()
-
-	go func() {
-		for {
-			_, messageBytes, err := client.conn.ReadMessage()
-			if err != nil {
-				fmt.Printf("Error reading message: %v\n", err)
-				app.clientsLock.Lock()
-				delete(app.clients, client)
-				app.clientsLock.Unlock()
-				client.conn.Close()
-				return
-			}
-
-			var message Message
-			if err := json.Unmarshal(messageBytes, &message); err != nil {
-				fmt.Printf("Error parsing message: %v\n", err)
-				continue
-			}
-
-			if message.Type == "analyze" {
-				// Use default depth of 5 if not specified
-				depth := message.Depth
-				if depth <= 0 {
-					depth = 5
-				}
-				if depth > 30 {
-					depth = 30
-				}
+}
 
-				// Start streaming analysis
-				movesChan, errChan := chessanalysis.AnalyzeChessGameStreaming(message.PGN, chessanalysis.WithDepth(depth))
-
-				// Process moves as they come in
-				go func() {
-					for move := range movesChan {
-						if move == nil {
-							continue
-						}
-
-						// Convert analysis to JSON
-						analysisJSON, err := json.Marshal(move)
-						if err != nil {
-							fmt.Printf("Error marshaling analysis: %v\n", err)
-							continue
-						}
-
-						// Send analysis to client
-						response := Message{
-							Type: "analysis",
-							Text: string(analysisJSON),
-						}
-						if err := client.conn.WriteJSON(response); err != nil {
-							fmt.Printf("Error sending analysis: %v\n", err)
-							return
-						}
-					}
-
-					// Check for any errors from the analysis
-					if err := <-errChan; err != nil {
-						response := Message{
-							Type: "analysis",
-							Text: fmt.Sprintf("Analysis error: %v", err),
-						}
-						client.conn.WriteJSON(response)
-					}
-				}()
-			}
+// analysisHandler serves a finished analysis, by the ID sent with its summary
+// message, as JSON. Its ETag is the hash sent with the summary. The compact
+// and fields query parameters shorten the moves' JSON, see moveJSONFormat;
+// those representations have no ETag.
+func (app *Application) analysisHandler(w http.ResponseWriter, r *http.Request) {
+	stored, ok := app.storedAnalysis(r.Context(), mux.Vars(r)["id"])
+	if !ok {
+		http.Error(w, "Analysis not found", http.StatusNotFound)
+		return
+	}
+	format, err := moveJSONFormat(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if format.Compact || format.Fields != nil {
+		// Compact JSON and field selections are other representations
+		data, err := format.MarshalGame(stored.game)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
 		}
-	}()
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(append(data, '\n'))
+		return
+	}
+	if notModified(w, r, stored.hash) {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(stored.game); err != nil {
+		fmt.Printf("Error writing analysis: %v\n", err)
+	}
 }
 
-func (app *Application) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	app.router.ServeHTTP(w, r)
+// moveJSONFormat reads how moves' JSON is encoded from the query parameters
+// compact, a boolean, and fields, a comma-separated list of move JSON keys
+func moveJSONFormat(query url.Values) (chessanalysis.MoveJSONOptions, error) {
+	var format chessanalysis.MoveJSONOptions
+	if compact := query.Get("compact"); compact != "" {
+		var err error
+		if format.Compact, err = strconv.ParseBool(compact); err != nil {
+			return format, fmt.Errorf("invalid compact %q", compact)
+		}
+	}
+	if fields := query.Get("fields"); fields != "" {
+		var err error
+		if format.Fields, err = chessanalysis.ParseMoveFields(fields); err != nil {
+			return format, err
+		}
+	}
+	return format, nil
 }
 
-func notFoundHandler(w http.ResponseWriter, r *http.Request) {
-	http.Error(w, "File Not Found", http.StatusNotFound)
+// analysisCSVHandler serves a finished analysis as CSV, one row per ply, for
+// spreadsheets
+func (app *Application) analysisCSVHandler(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	stored, ok := app.storedAnalysis(r.Context(), id)
+	if !ok {
+		http.Error(w, "Analysis not found", http.StatusNotFound)
+		return
+	}
+	// The CSV is a different representation, so it needs a tag of its own
+	if notModified(w, r, stored.hash+"-csv") {
+		return
+	}
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="analysis-%s.csv"`, id))
+	if err := report.WriteCSV(w, stored.game); err != nil {
+		fmt.Printf("Error writing analysis CSV: %v\n", err)
+	}
 }
 
-func stdoutLogger(next http.Handler) http.Handler {
-	return handlers.LoggingHandler(os.Stdout, next)
+// errAnalysisNotFound is returned for analyses the server doesn't have, or
+// no longer keeps
+var errAnalysisNotFound = errors.New("analysis not found")
+
+// WhatIfRequest is the body of a what-if request: a move to try instead of
+// the game's move at Ply
+type WhatIfRequest struct {
+	Ply  int    `json:"ply"`  // From 0 for White's first move
+	Move string `json:"move"` // SAN or UCI
 }
 
-func main() {
-	var port uint
-	flag.UintVar(&port, "port", DefaultPort, "Port to listen on")
-	flag.Parse()
-	if port == 0 || port > 65535 {
+// whatIf searches an alternative to a move of a stored analysis, with the
+// search settings the analysis used, as a job of the API key if there is one
+func (app *Application) whatIf(ctx context.Context, key *apiKeyHash, id string, request WhatIfRequest) (*chessanalysis.WhatIf, error) {
+	stored, ok := app.storedAnalysis(ctx, id)
+	if !ok {
+		return nil, errAnalysisNotFound
+	}
+	done, err := app.startJob(key, true)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+	game := stored.game
+	opts := []chessanalysis.AnalyzeChessGameOption{
+		chessanalysis.WithEngineFactory(app.engineFactory),
+		chessanalysis.WithEnginePool(app.enginePool, chessanalysis.InteractivePriority),
+		chessanalysis.WithContext(ctx),
+		chessanalysis.WithDepth(min(game.Options.Depth, app.keyDepthCap(key))),
+	}
+	if game.Options.MoveTime > 0 {
+		opts = append(opts, chessanalysis.WithMoveTime(game.Options.MoveTime))
+	}
+	if game.Options.Nodes > 0 {
+		opts = append(opts, chessanalysis.WithNodes(game.Options.Nodes))
+	}
+	if game.Options.ClassifierProfile != "" {
+		opts = append(opts, chessanalysis.WithClassifierProfile(game.Options.ClassifierProfile))
+	}
+	if len(game.Options.RatedThresholds) > 0 {
+		opts = append(opts, chessanalysis.WithRatingScaling(chessanalysis.DefaultRatingScaler))
+	}
+	return chessanalysis.AnalyzeWhatIf(game, request.Ply, request.Move, opts...)
+}
+
+// whatIfHandler searches the move in the request body, a WhatIfRequest, in
+// place of one of a stored analysis, comparing it with the move played and
+// the best move
+func (app *Application) whatIfHandler(w http.ResponseWriter, r *http.Request) {
+	var request WhatIfRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<10)).Decode(&request); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid what-if request: %v", err), http.StatusBadRequest)
+		return
+	}
+	whatIf, err := app.whatIf(r.Context(), requestAPIKey(r), mux.Vars(r)["id"], request)
+	switch {
+	case errors.Is(err, errAnalysisNotFound):
+		http.Error(w, "Analysis not found", http.StatusNotFound)
+		return
+	case errors.Is(err, errQuotaExceeded):
+		http.Error(w, err.Error(), http.StatusTooManyRequests)
+		return
+	case errors.Is(err, chessanalysis.ErrIllegalMove), errors.Is(err, chessanalysis.ErrInvalidOptions):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case err != nil:
+		http.Error(w, analysisErrorText(err), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(whatIf); err != nil {
+		fmt.Printf("Error writing what-if: %v\n", err)
+	}
+}
+
+// EngineDescription is an engine the server analyzes with, as listed by
+// enginesHandler for the options the frontend offers
+type EngineDescription struct {
+	ID string `json:"id"`
+	chessanalysis.EngineInfo
+	Capabilities chessanalysis.EngineCapabilities `json:"capabilities"`
+	Defaults     EngineDefaults                   `json:"defaults"`
+}
+
+// EngineDefaults are the search settings the server uses when a request
+// doesn't choose, and the most it allows
+type EngineDefaults struct {
+	Depth        int `json:"depth"`
+	MaxDepth     int `json:"maxDepth"`
+	QuickDepth   int `json:"quickDepth"` // Depth of the first pass of deeper analyses
+	KibitzDepth  int `json:"kibitzDepth"`
+	GuessMultiPV int `json:"guessMultiPV"`
+}
+
+// enginesHandler lists the engines the server analyzes with. The engine is
+// started once to learn its name and options, which are kept from then on.
+func (app *Application) enginesHandler(w http.ResponseWriter, r *http.Request) {
+	info, err := app.describeEngine(r.Context())
+	if err != nil {
+		http.Error(w, analysisErrorText(err), http.StatusServiceUnavailable)
+		return
+	}
+	engines := []EngineDescription{{
+		ID:           "default",
+		EngineInfo:   *info,
+		Capabilities: info.Capabilities(),
+		Defaults: EngineDefaults{
+			Depth:        defaultAnalysisDepth,
+			MaxDepth:     app.depthCap(),
+			QuickDepth:   quickAnalysisDepth,
+			KibitzDepth:  maxKibitzDepth,
+			GuessMultiPV: guessMultiPV,
+		},
+	}}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(engines); err != nil {
+		fmt.Printf("Error writing engines: %v\n", err)
+	}
+}
+
+// describeEngine returns what the engine reports about itself, starting one
+// from the pool the first time
+func (app *Application) describeEngine(ctx context.Context) (*chessanalysis.EngineInfo, error) {
+	app.engineInfoLock.Lock()
+	defer app.engineInfoLock.Unlock()
+	if app.engineInfo != nil {
+		return app.engineInfo, nil
+	}
+	engine, err := app.enginePool.Acquire(ctx, chessanalysis.InteractivePriority, app.engineFactory)
+	if err != nil {
+		return nil, err
+	}
+	defer engine.Close()
+	info, ok := chessanalysis.DescribeEngine(engine)
+	if !ok {
+		info = chessanalysis.EngineInfo{Name: "Unknown engine", Options: []chessanalysis.EngineOption{}}
+	}
+	app.engineInfo = &info
+	return app.engineInfo, nil
+}
+
+// profilesHandler lists the analysis profiles analyze messages may name
+func (app *Application) profilesHandler(w http.ResponseWriter, r *http.Request) {
+	app.configLock.RLock()
+	profiles := app.profiles
+	app.configLock.RUnlock()
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(profiles); err != nil {
+		fmt.Printf("Error writing profiles: %v\n", err)
+	}
+}
+
+// messagesHandler serves the texts of every message ID in a language, such as
+// the labels of the classifications analyses report by their English name.
+// Messages the language's translation lacks are in English.
+func (app *Application) messagesHandler(w http.ResponseWriter, r *http.Request) {
+	lang := mux.Vars(r)["lang"]
+	app.configLock.RLock()
+	translations, ok := app.translations[lang]
+	app.configLock.RUnlock()
+	if !ok && lang != "en" {
+		http.Error(w, "Language not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(translations.Merged()); err != nil {
+		fmt.Printf("Error writing messages: %v\n", err)
+	}
+}
+
+// maxRequestSize is the largest request body the API reads, whatever the
+// input limits: the PGN validateHandler checks, or the game analysis the
+// export handlers render, which are checked against the input limits once read
+const maxRequestSize = 16 << 20
+
+// InputError is why the server refused input exceeding its input limits. It
+// is the body of the API's 413 responses, and the JSON text of input-error
+// messages.
+type InputError struct {
+	Message string `json:"message"`
+	*chessanalysis.InputLimitError
+}
+
+// inputErrorJSON returns the InputError of err, an *InputLimitError, as JSON
+func inputErrorJSON(err error) []byte {
+	inputError := InputError{Message: err.Error()}
+	errors.As(err, &inputError.InputLimitError)
+	text, _ := json.Marshal(inputError)
+	return text
+}
+
+// writeInputError refuses a request whose input exceeds the input limits
+func writeInputError(w http.ResponseWriter, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusRequestEntityTooLarge)
+	w.Write(inputErrorJSON(err))
+}
+
+// validateHandler parses the PGN in the request body without analyzing it,
+// returning its games with their tags and move counts, and where any game
+// that can't be analyzed goes wrong
+func (app *Application) validateHandler(w http.ResponseWriter, r *http.Request) {
+	pgn, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxRequestSize))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Reading PGN: %v", err), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err := app.inputLimits().Check(string(pgn)); err != nil {
+		writeInputError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(chessanalysis.ValidatePGN(string(pgn))); err != nil {
+		fmt.Printf("Error writing validation: %v\n", err)
+	}
+}
+
+// maxBookSize is the largest opening book the admin API accepts
+const maxBookSize = 512 << 20
+
+// adminPathPrefix is where the admin API lives, the only routes the admin
+// token authorizes
+const adminPathPrefix = "/api/v1/admin"
+
+// requireAdmin only lets requests bearing the admin token through to the
+// handler. The admin API is disabled when the server has no admin token.
+func (app *Application) requireAdmin(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if app.adminToken == "" {
+			http.Error(w, "The admin API is disabled", http.StatusForbidden)
+			return
+		}
+		if !app.hasAdminToken(r) {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// hasAdminToken reports whether the request bears the admin token
+func (app *Application) hasAdminToken(r *http.Request) bool {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && app.adminToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(app.adminToken)) == 1
+}
+
+// reloadHandler reads the configuration file again, see applyConfig
+func (app *Application) reloadHandler(w http.ResponseWriter, r *http.Request) {
+	err := app.reload()
+	switch {
+	case errors.Is(err, errNoConfig):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		http.Error(w, fmt.Sprintf("Invalid configuration: %v", err), http.StatusBadRequest)
+		return
+	}
+	fmt.Printf("Reloaded configuration from %s\n", app.configPath)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// PurgeResult is how many analyses and evaluations purgeHandler forgot
+type PurgeResult struct {
+	Analyses int `json:"analyses"`
+	Evals    int `json:"evals"`
+}
+
+// purgeHandler forgets the expired analyses and evaluations straight away,
+// or with the olderThan query parameter, a duration such as "1h", everything
+// stored longer ago than that whatever the retention periods
+func (app *Application) purgeHandler(w http.ResponseWriter, r *http.Request) {
+	var result PurgeResult
+	if olderThan := r.URL.Query().Get("olderThan"); olderThan != "" {
+		age, err := time.ParseDuration(olderThan)
+		if err != nil || age < 0 {
+			http.Error(w, fmt.Sprintf("Invalid olderThan %q", olderThan), http.StatusBadRequest)
+			return
+		}
+		before := time.Now().Add(-age)
+		result = PurgeResult{Analyses: app.analyses.purge(before), Evals: app.kibitzCache.Purge(before)}
+	} else {
+		result.Analyses, result.Evals = app.purgeExpired(time.Now())
+	}
+	fmt.Printf("Purged %d analyses and %d evaluations\n", result.Analyses, result.Evals)
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		fmt.Printf("Error writing purge result: %v\n", err)
+	}
+}
+
+// booksHandler lists the names of the opening books analyses use
+func (app *Application) booksHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(app.books.Names()); err != nil {
+		fmt.Printf("Error writing books: %v\n", err)
+	}
+}
+
+// putBookHandler adds the polyglot book in the request body to the books
+// analyses use, replacing the book of the same name. Analyses started from
+// then on find their book moves in it.
+func (app *Application) putBookHandler(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	book, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBookSize))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Reading book: %v", err), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if len(book) == 0 {
+		http.Error(w, "The book is empty", http.StatusBadRequest)
+		return
+	}
+	if err := app.books.Put(name, book); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid book: %v", err), http.StatusBadRequest)
+		return
+	}
+	fmt.Printf("Loaded opening book %s (%d bytes)\n", name, len(book))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// deleteBookHandler stops analyses using the named opening book
+func (app *Application) deleteBookHandler(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	if !app.books.Remove(name) {
+		http.Error(w, "Book not found", http.StatusNotFound)
+		return
+	}
+	fmt.Printf("Removed opening book %s\n", name)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// maxSyncAnalysisDepth caps the depth of analyses run while an HTTP request
+// waits for them, so that a game takes seconds rather than minutes
+const maxSyncAnalysisDepth = 12
+
+// analyzeGame analyzes the first game of the PGN while the caller waits, to
+// the depth given or defaultAnalysisDepth, capped at maxSyncAnalysisDepth,
+// and stores it for the analyses API. It is a job of the API key, if there
+// is one. It returns the analysis's ID.
+func (app *Application) analyzeGame(ctx context.Context, key *apiKeyHash, pgn string, depth int, side string, owned ownership) (string, storedAnalysis, error) {
+	if depth <= 0 {
+		depth = defaultAnalysisDepth
+	}
+	done, err := app.startJob(key, true)
+	if err != nil {
+		return "", storedAnalysis{}, err
+	}
+	defer done()
+	opts := app.requestAnalysisOptions(ctx, min(depth, maxSyncAnalysisDepth, app.keyDepthCap(key)))
+	if side != "" {
+		opts = append(opts, chessanalysis.WithSide(side))
+	}
+	moves, err := chessanalysis.AnalyzeChessGame(pgn, opts...)
+	if err != nil {
+		return "", storedAnalysis{}, err
+	}
+	return app.storeGame(pgn, moves, opts, owned)
+}
+
+// requestAnalysisOptions returns the options of the analyses HTTP requests
+// run, to the given depth
+func (app *Application) requestAnalysisOptions(ctx context.Context, depth int) []chessanalysis.AnalyzeChessGameOption {
+	opts := []chessanalysis.AnalyzeChessGameOption{
+		chessanalysis.WithEngineFactory(app.engineFactory),
+		chessanalysis.WithEnginePool(app.enginePool, chessanalysis.InteractivePriority),
+		chessanalysis.WithTheory(app.books),
+		chessanalysis.WithSkipBook(),
+		chessanalysis.WithContext(ctx),
+		chessanalysis.WithClassificationSymbols(app.symbols),
+		chessanalysis.WithDepth(depth),
+	}
+	return append(opts, app.repertoireOptions()...)
+}
+
+// storeGame summarizes the analyzed moves of the game and stores the
+// analysis for the analyses API, returning its ID
+func (app *Application) storeGame(pgn string, moves []chessanalysis.MoveAnalysis, opts []chessanalysis.AnalyzeChessGameOption, owned ownership) (string, storedAnalysis, error) {
+	game, content, err := summarizeGame(pgn, moves, opts)
+	if err != nil {
+		return "", storedAnalysis{}, err
+	}
+	id, hash := app.analyses.add(game, pgn, content, owned)
+	return id, storedAnalysis{game: game, pgn: pgn, hash: hash, version: 1, ownership: owned}, nil
+}
+
+// summarizeGame assembles the analysis of the game from its analyzed moves,
+// and analyzes its sidelines if the options ask for them, returning it with
+// its JSON
+func summarizeGame(pgn string, moves []chessanalysis.MoveAnalysis, opts []chessanalysis.AnalyzeChessGameOption) (*chessanalysis.GameAnalysis, []byte, error) {
+	resolved, err := chessanalysis.ResolveOptions(opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+	game := chessanalysis.NewGameAnalysis(pgn, moves, resolved.Effective())
+	if resolved.Theory != nil {
+		game.CheckTheory(resolved.Theory)
+	}
+	if resolved.Variations {
+		if game.Variations, err = chessanalysis.AnalyzeVariations(pgn, opts...); err != nil {
+			return nil, nil, err
+		}
+	}
+	content, err := json.Marshal(game)
+	if err != nil {
+		return nil, nil, err
+	}
+	return game, content, nil
+}
+
+// requestSide returns the side whose moves alone the request asks to be
+// analyzed, from the side query parameter: "white", "black", or "mine" for
+// the color the logged in user played in the PGN's game by its White and
+// Black tags. It returns "" for both sides.
+func requestSide(r *http.Request, pgn string) (string, error) {
+	switch side := r.URL.Query().Get("side"); side {
+	case "":
+		return "", nil
+	case "white":
+		return "White", nil
+	case "black":
+		return "Black", nil
+	case "mine":
+		account := contextAccount(r.Context())
+		if account == nil {
+			return "", errSideLoginRequired
+		}
+		color := chessanalysis.PGNPlayerColor(pgn, account.Name)
+		if color == "" {
+			return "", fmt.Errorf("%s played neither side of the game", account.Name)
+		}
+		return color, nil
+	default:
+		return "", fmt.Errorf("invalid side %q", side)
+	}
+}
+
+// analyzeHandler analyzes the PGN in the request body while the request
+// waits, to the depth query parameter capped at maxSyncAnalysisDepth, and
+// returns it as JSON, of the side query parameter's moves alone with one,
+// see requestSide. The analysis is stored, and its Location in the analyses
+// API is returned with it.
+func (app *Application) analyzeHandler(w http.ResponseWriter, r *http.Request) {
+	pgn, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxRequestSize))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Reading PGN: %v", err), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err := app.inputLimits().Check(string(pgn)); err != nil {
+		writeInputError(w, err)
+		return
+	}
+	owned, err := requestOwnership(r)
+	if err != nil {
+		http.Error(w, err.Error(), ownershipErrorStatus(err))
+		return
+	}
+	side, err := requestSide(r, string(pgn))
+	if err != nil {
+		http.Error(w, err.Error(), ownershipErrorStatus(err))
+		return
+	}
+	depth, _ := strconv.Atoi(r.URL.Query().Get("depth"))
+	id, stored, err := app.analyzeGame(r.Context(), requestAPIKey(r), string(pgn), depth, side, owned)
+	switch {
+	case errors.Is(err, chessanalysis.ErrInvalidPGN), errors.Is(err, chessanalysis.ErrEmptyGame):
+		http.Error(w, analysisErrorText(err), http.StatusBadRequest)
+		return
+	case errors.Is(err, errQuotaExceeded):
+		http.Error(w, err.Error(), http.StatusTooManyRequests)
+		return
+	case err != nil:
+		http.Error(w, analysisErrorText(err), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Location", "/api/v1/analyses/"+id)
+	w.Header().Set("ETag", `"`+stored.hash+`"`)
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(stored.game); err != nil {
+		fmt.Printf("Error writing analysis: %v\n", err)
+	}
+}
+
+// analyzeStreamHandler analyzes the PGN in the request body to the depth
+// query parameter, of the side query parameter's moves alone with one,
+// streaming each move's analysis as a line of JSON as soon
+// as it is searched, and the whole game analysis, as analyzeHandler returns
+// it, as the last line. Streams aren't held to maxSyncAnalysisDepth, as
+// clients see them progress. The analysis is stored, and its Location and
+// ETag follow the stream as trailers. Errors once the stream has started end
+// it with a line holding only an error.
+func (app *Application) analyzeStreamHandler(w http.ResponseWriter, r *http.Request) {
+	pgn, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxRequestSize))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Reading PGN: %v", err), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err := app.inputLimits().Check(string(pgn)); err != nil {
+		writeInputError(w, err)
+		return
+	}
+	owned, err := requestOwnership(r)
+	if err != nil {
+		http.Error(w, err.Error(), ownershipErrorStatus(err))
+		return
+	}
+	side, err := requestSide(r, string(pgn))
+	if err != nil {
+		http.Error(w, err.Error(), ownershipErrorStatus(err))
+		return
+	}
+	key := requestAPIKey(r)
+	done, err := app.startJob(key, true)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusTooManyRequests)
+		return
+	}
+	defer done()
+	depth, _ := strconv.Atoi(r.URL.Query().Get("depth"))
+	if depth <= 0 {
+		depth = defaultAnalysisDepth
+	}
+	opts := app.requestAnalysisOptions(r.Context(), min(depth, app.keyDepthCap(key)))
+	if side != "" {
+		opts = append(opts, chessanalysis.WithSide(side))
+	}
+	results, errs := chessanalysis.AnalyzeChessGameStreaming(string(pgn), opts...)
+
+	// Games that can't be analyzed fail before their first move, in time to
+	// answer with an error status
+	first, ok := <-results
+	if !ok {
+		err := <-errs
+		if err == nil {
+			err = fmt.Errorf("%w: the game has no moves", chessanalysis.ErrEmptyGame)
+		}
+		status := http.StatusInternalServerError
+		if errors.Is(err, chessanalysis.ErrInvalidPGN) || errors.Is(err, chessanalysis.ErrEmptyGame) {
+			status = http.StatusBadRequest
+		}
+		http.Error(w, analysisErrorText(err), status)
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Trailer", "Location, ETag")
+	encoder := json.NewEncoder(w)
+	flusher := http.NewResponseController(w)
+	var moves []chessanalysis.MoveAnalysis
+	for move := first; move != nil; move = <-results {
+		moves = append(moves, *move)
+		if err := encoder.Encode(move); err != nil {
+			fmt.Printf("Error writing analysis: %v\n", err)
+			return
+		}
+		flusher.Flush()
+	}
+	if err := <-errs; err != nil {
+		encoder.Encode(struct {
+			Error string `json:"error"`
+		}{analysisErrorText(err)})
+		return
+	}
+	id, stored, err := app.storeGame(string(pgn), moves, opts, owned)
+	if err != nil {
+		fmt.Printf("Error storing analysis: %v\n", err)
+		return
+	}
+	if err := encoder.Encode(stored.game); err != nil {
+		fmt.Printf("Error writing analysis: %v\n", err)
+	}
+	w.Header().Set("Location", "/api/v1/analyses/"+id)
+	w.Header().Set("ETag", `"`+stored.hash+`"`)
+}
+
+// noScriptPage is what the page for browsers without JavaScript shows: the
+// form, and once a game is analyzed, its summary and moves
+type noScriptPage struct {
+	PGN      string
+	Depth    int
+	MaxDepth int
+	Error    string
+
+	ID    string // Of the stored analysis, for downloads
+	Game  *chessanalysis.GameAnalysis
+	Moves []noScriptMove
+}
+
+// noScriptMove is a row of the move table of the page for browsers without
+// JavaScript
+type noScriptMove struct {
+	Label  string // See chessanalysis.MoveLabel
+	Symbol string // Of the move's classification
+	Eval   string // White's score after the move
+	Best   string // The engine's move, when it wasn't the one played
+	// Diagram is the URL of the position before a blunder or questionable
+	// move, with the move played and the best move drawn on it
+	Diagram string
+}
+
+// noScriptMoves lays out an analysis's moves for the page for browsers
+// without JavaScript
+func noScriptMoves(moves []chessanalysis.MoveAnalysis) []noScriptMove {
+	rows := make([]noScriptMove, len(moves))
+	for i := range moves {
+		move := &moves[i]
+		rows[i] = noScriptMove{
+			Label:  chessanalysis.MoveLabel(move),
+			Symbol: move.ClassificationSymbol,
+			Eval:   move.WhiteScore.Format(),
+		}
+		if rows[i].Symbol == "" {
+			rows[i].Symbol = chessanalysis.ASCIISymbols.Symbol(move.Classification)
+		}
+		if !move.IsBestMove && move.Classification != chessanalysis.Book {
+			rows[i].Best = move.BestMoveSAN
+		}
+		if (move.Classification == chessanalysis.Blunder || move.Classification == chessanalysis.Questionable) && move.BestMove != "" {
+			arrows := "best:" + move.BestMove
+			if move.Hints.Played != nil {
+				arrows = "last:" + move.Hints.Played.From + move.Hints.Played.To + "," + arrows
+			}
+			query := url.Values{"fen": {move.FENBefore}, "arrows": {arrows}}
+			if move.Color == "Black" {
+				query.Set("orientation", "Black")
+			}
+			rows[i].Diagram = "api/v1/board.svg?" + query.Encode()
+		}
+	}
+	return rows
+}
+
+// noScriptHandler serves a plain HTML form for browsers without JavaScript
+// and, when it is posted, analyzes the game while the browser waits, with
+// the depth capped at maxSyncAnalysisDepth, and renders the result
+func (app *Application) noScriptHandler(w http.ResponseWriter, r *http.Request) {
+	page := noScriptPage{Depth: defaultAnalysisDepth, MaxDepth: maxSyncAnalysisDepth}
+	if r.Method == http.MethodPost {
+		r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
+		page.PGN = r.PostFormValue("pgn")
+		if depth, err := strconv.Atoi(r.PostFormValue("depth")); err == nil && depth > 0 {
+			page.Depth = min(depth, maxSyncAnalysisDepth)
+		}
+		if err := app.inputLimits().Check(page.PGN); err != nil {
+			page.Error = err.Error()
+		} else if id, stored, err := app.analyzeGame(r.Context(), requestAPIKey(r), page.PGN, page.Depth, "", accountOwnership(r.Context())); err != nil {
+			page.Error = analysisErrorText(err)
+		} else {
+			page.ID, page.Game, page.Moves = id, stored.game, noScriptMoves(stored.game.Moves)
+		}
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := app.noScript.ExecuteTemplate(w, "noscript.html.gotmpl", page); err != nil {
+		fmt.Printf("Error rendering template: %v\n", err)
+	}
+}
+
+// readGameAnalysis reads the game analysis in the request body, as sent in the
+// summary message, refusing it if it exceeds the input limits. It reports
+// false once it has written the error.
+func (app *Application) readGameAnalysis(w http.ResponseWriter, r *http.Request) (*chessanalysis.GameAnalysis, bool) {
+	var game chessanalysis.GameAnalysis
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestSize)).Decode(&game); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, fmt.Sprintf("Reading game analysis: %v", err), http.StatusRequestEntityTooLarge)
+			return nil, false
+		}
+		http.Error(w, fmt.Sprintf("Invalid game analysis: %v", err), http.StatusBadRequest)
+		return nil, false
+	}
+	if err := app.inputLimits().CheckGame(&game); err != nil {
+		writeInputError(w, err)
+		return nil, false
+	}
+	return &game, true
+}
+
+// ankiHandler turns a game analysis, as sent in the summary message, into an
+// Anki deck of the mistakes made in the game
+func (app *Application) ankiHandler(w http.ResponseWriter, r *http.Request) {
+	game, ok := app.readGameAnalysis(w, r)
+	if !ok {
+		return
+	}
+	cards := report.MistakeCards([]*chessanalysis.GameAnalysis{game}, r.URL.Query().Get("player"))
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="mistakes.csv"`)
+	if err := report.WriteAnkiCSV(w, cards); err != nil {
+		fmt.Printf("Error writing Anki deck: %v\n", err)
+	}
+}
+
+// gifHandler turns a game analysis, as sent in the summary message, into an
+// animated GIF of the game, with orientation set to Black to flip the board
+func (app *Application) gifHandler(w http.ResponseWriter, r *http.Request) {
+	game, ok := app.readGameAnalysis(w, r)
+	if !ok {
+		return
+	}
+	var animation bytes.Buffer
+	err := chessanalysis.WriteGameGIF(&animation, game,
+		chessanalysis.WithPieceImages(pieces),
+		chessanalysis.WithOrientation(r.URL.Query().Get("orientation")),
+	)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to animate game: %v", err), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "image/gif")
+	w.Header().Set("Content-Disposition", `attachment; filename="game.gif"`)
+	w.Write(animation.Bytes())
+}
+
+func (app *Application) indexHandler(w http.ResponseWriter, r *http.Request) {
+	templateVars := struct {
+		Title string
+	}{
+		Title: "Chess Game Analyzer",
+	}
+
+	err := app.templates.ExecuteTemplate(w, "index.html.gotmpl", templateVars)
+	if err != nil {
+		fmt.Printf("Error rendering template: %v\n", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}
+}
+
+func (app *Application) wsHandler(w http.ResponseWriter, r *http.Request) {
+	upgrader := app.upgrader
+	if protocol, ok := apiKeySubprotocol(r); ok {
+		// Accepted after the others, so that it is only picked if offered alone
+		upgrader.Subprotocols = append(slices.Clone(upgrader.Subprotocols), protocol)
+	}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	fmt.Printf("New websocket connection from %s\n", conn.RemoteAddr())
+	if limits := app.inputLimits(); limits.MaxPGNBytes > 0 {
+		// Room for a PGN at the limit escaped in JSON, so that it is refused
+		// with an input-error rather than by closing the connection. A
+		// connection keeps the limit it opened with.
+		conn.SetReadLimit(2*int64(limits.MaxPGNBytes) + 64<<10)
+	}
+	// The connection's boards run their analyses with the account it was
+	// opened with
+	ctx, cancel := context.WithCancel(withAccount(context.Background(), contextAccount(r.Context())))
+	client := &Client{
+		conn:        conn,
+		application: app,
+		ctx:         ctx,
+		cancel:      cancel,
+		msgpack:     conn.Subprotocol() == msgpackSubprotocol,
+		apiKey:      requestAPIKey(r),
+		boards:      make(map[string]*Board),
+	}
+	app.clientsLock.Lock()
+	app.clients[client] = nil
+	app.clientsLock.Unlock()
+
+	go func() {
+		for {
+			_, messageBytes, err := client.conn.ReadMessage()
+			if err != nil {
+				fmt.Printf("Error reading message: %v\n", err)
+				app.clientsLock.Lock()
+				delete(app.clients, client)
+				app.clientsLock.Unlock()
+				app.unsubscribeFromRelay(client)
+				client.closeBoards()
+				client.cancel()
+				client.conn.Close()
+				return
+			}
+
+			var message Message
+			if err := json.Unmarshal(messageBytes, &message); err != nil {
+				fmt.Printf("Error parsing message: %v\n", err)
+				continue
+			}
+
+			switch message.Type {
+			case "relay-subscribe":
+				app.subscribeToRelay(client)
+				continue
+			case "relay-unsubscribe":
+				app.unsubscribeFromRelay(client)
+				continue
+			case "board-close":
+				client.closeBoard(message.BoardID)
+				continue
+			}
+
+			board, err := client.board(message.BoardID)
+			if err != nil {
+				client.send(Message{Type: "board-error", Text: err.Error(), BoardID: message.BoardID})
+				continue
+			}
+			switch message.Type {
+			case "room-create":
+				board.createRoom()
+				continue
+			case "room-join":
+				board.joinRoom(message.ID)
+				continue
+			case "room-leave":
+				board.leaveRoom()
+				continue
+			}
+			if room := board.watchedRoom(); room != nil {
+				board.send(Message{Type: "board-error", Text: fmt.Sprintf("The board is watching room %s, leave it first", room.id)})
+				continue
+			}
+			if err := app.inputLimits().Check(message.PGN); err != nil {
+				board.send(Message{Type: "input-error", Text: string(inputErrorJSON(err))})
+				continue
+			}
+			switch message.Type {
+			case "guess-start":
+				go board.startGuessing(message)
+			case "guess":
+				board.submitGuess(message.Text)
+			case "kibitz":
+				go board.kibitz(message)
+			case "kibitz-stop":
+				board.stopKibitzing()
+			case "eval-subscribe":
+				board.subscribeEvals(true)
+			case "eval-unsubscribe":
+				board.subscribeEvals(false)
+			case "ponder":
+				go board.ponder(message)
+			case "analyze":
+				go board.analyze(message)
+			case "whatif":
+				go board.whatIf(message)
+			}
+		}
+	}()
+}
+
+// board returns the client's board with the given ID, opening it if it isn't
+// open yet
+func (client *Client) board(id string) (*Board, error) {
+	client.boardsLock.Lock()
+	defer client.boardsLock.Unlock()
+	if board, ok := client.boards[id]; ok {
+		return board, nil
+	}
+	if len(client.boards) >= maxBoardsPerClient {
+		return nil, fmt.Errorf("too many boards open, at most %d are allowed", maxBoardsPerClient)
+	}
+	ctx, cancel := context.WithCancel(client.ctx)
+	board := &Board{client: client, id: id, ctx: ctx, cancel: cancel}
+	client.boards[id] = board
+	return board, nil
+}
+
+// closeBoard stops everything running on the board with the given ID and
+// forgets it
+func (client *Client) closeBoard(id string) {
+	client.boardsLock.Lock()
+	board, ok := client.boards[id]
+	delete(client.boards, id)
+	client.boardsLock.Unlock()
+	if ok {
+		board.close()
+	}
+}
+
+// closeBoards closes every board of the client, once its connection closes
+func (client *Client) closeBoards() {
+	client.boardsLock.Lock()
+	boards := client.boards
+	client.boards = make(map[string]*Board)
+	client.boardsLock.Unlock()
+	for _, board := range boards {
+		board.close()
+	}
+}
+
+// close stops everything running on the board and takes it out of its room
+func (board *Board) close() {
+	board.cancel()
+	board.leaveRoom()
+}
+
+// send writes a message for the board to its client, and to the viewers of
+// the room the board hosts, if any
+func (board *Board) send(message Message) error {
+	message.BoardID = board.id
+	if room := board.hostedRoom(); room != nil {
+		room.broadcast(message)
+	}
+	return board.client.send(message)
+}
+
+// hostedRoom returns the room the board hosts, if any
+func (board *Board) hostedRoom() *Room {
+	board.roomLock.Lock()
+	defer board.roomLock.Unlock()
+	return board.hosting
+}
+
+// watchedRoom returns the room the board is a viewer of, if any
+func (board *Board) watchedRoom() *Room {
+	board.roomLock.Lock()
+	defer board.roomLock.Unlock()
+	return board.watching
+}
+
+// createRoom opens a room sharing the board's messages and sends its ID as a
+// "room-created" message. A board hosts at most one room.
+func (board *Board) createRoom() {
+	board.roomLock.Lock()
+	defer board.roomLock.Unlock()
+	if board.watching != nil {
+		board.client.send(Message{Type: "room-error", Text: "A board watching a room can't host one", BoardID: board.id})
+		return
+	}
+	if board.hosting == nil {
+		room := &Room{id: randomID(4), viewers: make(map[*Board]*outbox)}
+		app := board.client.application
+		app.roomsLock.Lock()
+		app.rooms[room.id] = room
+		app.roomsLock.Unlock()
+		board.hosting = room
+	}
+	board.client.send(Message{Type: "room-created", ID: board.hosting.id, BoardID: board.id})
+}
+
+// joinRoom makes the board a viewer of the room with the given ID, leaving
+// the room it was watching, if any
+func (board *Board) joinRoom(id string) {
+	if board.hostedRoom() != nil {
+		board.send(Message{Type: "room-error", Text: "A board hosting a room can't watch one"})
+		return
+	}
+	board.leaveRoom()
+	app := board.client.application
+	app.roomsLock.Lock()
+	room := app.rooms[id]
+	app.roomsLock.Unlock()
+	if room == nil {
+		board.send(Message{Type: "room-error", Text: fmt.Sprintf("No room %q to join", id)})
+		return
+	}
+	board.roomLock.Lock()
+	defer board.roomLock.Unlock()
+	if !room.join(board) {
+		board.send(Message{Type: "room-error", Text: fmt.Sprintf("No room %q to join", id)})
+		return
+	}
+	board.watching = room
+}
+
+// leaveRoom stops the board watching its room, or closes the room it hosts
+func (board *Board) leaveRoom() {
+	board.roomLock.Lock()
+	hosting, watching := board.hosting, board.watching
+	board.hosting, board.watching = nil, nil
+	board.roomLock.Unlock()
+	if watching != nil {
+		watching.leave(board)
+	}
+	if hosting != nil {
+		app := board.client.application
+		app.roomsLock.Lock()
+		delete(app.rooms, hosting.id)
+		app.roomsLock.Unlock()
+		hosting.close()
+	}
+}
+
+// start begins a new analysis of the host's, forgetting the messages of the
+// last one and sending viewers the game as a "room-analyze" message
+func (room *Room) start(pgn string, depth int) {
+	room.lock.Lock()
+	room.history = nil
+	room.lock.Unlock()
+	room.broadcast(Message{Type: "room-analyze", ID: room.id, PGN: pgn, Depth: depth})
+}
+
+// broadcast queues a message of the host's for every viewer, keeping it for
+// those who join later. Viewers too far behind to take it are dropped.
+func (room *Room) broadcast(message Message) {
+	room.lock.Lock()
+	defer room.lock.Unlock()
+	if len(room.history) < maxRoomHistory {
+		room.history = append(room.history, message)
+	}
+	for board, viewer := range room.viewers {
+		message.BoardID = board.id
+		if !viewer.push(message, Message{Type: "room-error", ID: room.id, BoardID: board.id, Text: "Fell too far behind the room"}) {
+			delete(room.viewers, board)
+		}
+	}
+}
+
+// join adds a viewer, sending it a "room-joined" message followed by the
+// messages of the host's current analysis. It reports whether the room was
+// still open.
+func (room *Room) join(board *Board) bool {
+	room.lock.Lock()
+	defer room.lock.Unlock()
+	if room.closed {
+		return false
+	}
+	viewer := newOutbox(board.client, maxRoomHistory+roomViewerBacklog)
+	viewer.messages <- Message{Type: "room-joined", ID: room.id, BoardID: board.id}
+	for _, message := range room.history {
+		message.BoardID = board.id
+		viewer.messages <- message
+	}
+	room.viewers[board] = viewer
+	// Once the room lets the viewer go, the board no longer watches it
+	go viewer.write(func() {
+		board.roomLock.Lock()
+		if board.watching == room {
+			board.watching = nil
+		}
+		board.roomLock.Unlock()
+	})
+	return true
+}
+
+// leave removes a viewer
+func (room *Room) leave(board *Board) {
+	room.lock.Lock()
+	defer room.lock.Unlock()
+	if viewer, ok := room.viewers[board]; ok {
+		delete(room.viewers, board)
+		viewer.close(nil)
+	}
+}
+
+// close sends every viewer a "room-closed" message, after the messages they
+// have queued, and lets them go
+func (room *Room) close() {
+	room.lock.Lock()
+	defer room.lock.Unlock()
+	room.closed = true
+	for board, viewer := range room.viewers {
+		viewer.close(&Message{Type: "room-closed", ID: room.id, BoardID: board.id})
+	}
+	room.viewers = nil
+}
+
+// quickAnalysisDepth is the depth every move is first analyzed to, so the
+// game fills in at once while the requested depth is searched in the background
+const quickAnalysisDepth = 6
+
+// defaultAnalysisDepth and maxAnalysisDepth bound the depth of analyses and
+// guessing games. The configuration file may cap the depth lower, see
+// Config.MaxDepth.
+const (
+	defaultAnalysisDepth = 5
+	maxAnalysisDepth     = 30
+)
+
+// analyze streams the analysis of each move of the game as an "analysis"
+// message. Games requested deeper than quickAnalysisDepth are first analyzed
+// to that depth, and each move's deeper analysis follows as a "refined"
+// message once it completes, never ahead of the move's first analysis. A
+// summary is sent after each pass over the game.
+func (board *Board) analyze(message Message) {
+	depth := message.Depth
+	if depth <= 0 {
+		depth = defaultAnalysisDepth
+	}
+	maxDepth := board.client.application.keyDepthCap(board.client.apiKey)
+	if depth > maxDepth {
+		depth = maxDepth
+	}
+	// The search settings of the analysis, which a profile chooses instead of
+	// the depth
+	search := []chessanalysis.AnalyzeChessGameOption{chessanalysis.WithDepth(depth)}
+	if message.Profile != "" {
+		profile, ok := board.client.application.profile(message.Profile)
+		if !ok {
+			board.send(Message{Type: "analysis", Text: fmt.Sprintf("Analysis error: unknown analysis profile %q", message.Profile)})
+			return
+		}
+		// Profiles are the server's, held to the depth cap of API keys only
+		if maxDepth < board.client.application.depthCap() && (profile.Depth <= 0 || profile.Depth > maxDepth) {
+			board.send(Message{Type: "quota-error", Text: fmt.Sprintf("%v: the %s profile searches deeper than depth %d", errQuotaExceeded, profile.Name, maxDepth)})
+			return
+		}
+		search, depth = profile.options(), profile.Depth
+	}
+	if message.Classifier != "" {
+		if _, err := chessanalysis.ClassifierProfileByName(message.Classifier); err != nil {
+			board.send(Message{Type: "analysis", Text: analysisErrorText(err)})
+			return
+		}
+		search = append(search, chessanalysis.WithClassifierProfile(message.Classifier))
+	}
+	if message.Diagnostics {
+		search = append(search, chessanalysis.WithDiagnostics())
+	}
+	if message.MustWin != "" {
+		search = append(search, chessanalysis.WithPracticalMode(message.MustWin))
+	}
+	format := chessanalysis.MoveJSONOptions{Compact: message.Compact, Fields: message.Fields}
+	if err := format.Validate(); err != nil {
+		board.send(Message{Type: "analysis", Text: analysisErrorText(err)})
+		return
+	}
+	owned := accountOwnership(board.ctx)
+	if owned.private = message.Private; owned.private && owned.owner == "" {
+		board.send(Message{Type: "analysis", Text: analysisErrorText(errLoginRequired)})
+		return
+	}
+	if chessanalysis.TooShortToAnalyze(message.PGN) {
+		board.sendNoMoves(message.PGN, search)
+		return
+	}
+	done, ok := board.startJob(true)
+	if !ok {
+		return
+	}
+	defer done()
+	if room := board.hostedRoom(); room != nil {
+		room.start(message.PGN, depth)
+	}
+	ctx, cancel := context.WithCancel(board.ctx)
+	defer cancel()
+
+	pass := func(final bool, search ...chessanalysis.AnalyzeChessGameOption) (<-chan *chessanalysis.MoveAnalysis, <-chan error, []chessanalysis.AnalyzeChessGameOption) {
+		opts := []chessanalysis.AnalyzeChessGameOption{
+			chessanalysis.WithEngineFactory(board.client.application.engineFactory),
+			chessanalysis.WithEnginePool(board.client.application.enginePool, chessanalysis.InteractivePriority),
+			chessanalysis.WithTheory(board.client.application.books),
+			chessanalysis.WithSkipBook(),
+			chessanalysis.WithContext(ctx),
+			chessanalysis.WithClassificationSymbols(board.client.application.symbols),
+		}
+		opts = append(opts, search...)
+		opts = append(opts, board.client.application.repertoireOptions()...)
+		// Only the pass the client keeps gets a second opinion
+		if secondOpinion := board.client.application.secondOpinion; secondOpinion != nil && final {
+			opts = append(opts, chessanalysis.WithSecondOpinion(secondOpinion))
+		}
+		moves, errs := chessanalysis.AnalyzeChessGameStreaming(message.PGN, opts...)
+		return moves, errs, opts
+	}
+	// Analyses deeper than the quick depth, or limited by time rather than
+	// depth, first pass over the game at the quick depth
+	var quick, refined <-chan *chessanalysis.MoveAnalysis
+	var quickErrs, refinedErrs <-chan error
+	var quickOpts, refinedOpts []chessanalysis.AnalyzeChessGameOption
+	if depth > 0 && depth <= quickAnalysisDepth {
+		quick, quickErrs, quickOpts = pass(true, search...)
+	} else {
+		quick, quickErrs, quickOpts = pass(false, chessanalysis.WithDepth(quickAnalysisDepth))
+		refined, refinedErrs, refinedOpts = pass(true, search...)
+	}
+
+	var quickMoves, refinedMoves []chessanalysis.MoveAnalysis
+	sentRefined := 0
+	// sendRefined sends the refined moves the client has the first analysis of
+	sendRefined := func() bool {
+		for ; sentRefined < len(refinedMoves) && sentRefined < len(quickMoves); sentRefined++ {
+			if !board.sendAnalysis("refined", &refinedMoves[sentRefined], format) {
+				return false
+			}
+		}
+		return true
+	}
+	for quick != nil || refined != nil {
+		select {
+		case move, ok := <-quick:
+			if !ok {
+				quick = nil
+				if !board.finishPass(message.PGN, quickMoves, quickErrs, quickOpts, format, owned) {
+					return
+				}
+				break
+			}
+			quickMoves = append(quickMoves, *move)
+			if !board.sendAnalysis("analysis", move, format) {
+				return
+			}
+		case move, ok := <-refined:
+			if !ok {
+				refined = nil
+				break
+			}
+			refinedMoves = append(refinedMoves, *move)
+		}
+		if !sendRefined() {
+			return
+		}
+	}
+	if refinedErrs != nil {
+		board.finishPass(message.PGN, refinedMoves, refinedErrs, refinedOpts, format, owned)
+	}
+}
+
+// whatIf answers a "whatif" message, trying the move in its text in place of
+// the move at its ply of the stored analysis with its ID, with a "whatif"
+// message holding the comparison or a "whatif-error" message
+func (board *Board) whatIf(message Message) {
+	whatIf, err := board.client.application.whatIf(board.ctx, board.client.apiKey, message.ID, WhatIfRequest{Ply: message.Ply, Move: message.Text})
+	if errors.Is(err, errQuotaExceeded) {
+		board.send(Message{Type: "quota-error", Text: err.Error(), ID: message.ID})
+		return
+	}
+	if err != nil {
+		if !errors.Is(err, chessanalysis.ErrAnalysisCancelled) {
+			board.send(Message{Type: "whatif-error", Text: analysisErrorText(err), ID: message.ID})
+		}
+		return
+	}
+	whatIfJSON, err := json.Marshal(whatIf)
+	if err != nil {
+		fmt.Printf("Error marshaling what-if: %v\n", err)
+		return
+	}
+	board.send(Message{Type: "whatif", Text: string(whatIfJSON), ID: message.ID, Ply: message.Ply})
+}
+
+// startJob begins a job of the board under the quota of its connection's
+// API key, if there is one, see Application.startJob. Jobs the quota refuses
+// are answered with a "quota-error" message.
+func (board *Board) startJob(slot bool) (func(), bool) {
+	done, err := board.client.application.startJob(board.client.apiKey, slot)
+	if err != nil {
+		board.send(Message{Type: "quota-error", Text: err.Error()})
+		return nil, false
+	}
+	return done, true
+}
+
+// sendNoMoves answers the analysis of a game too short to analyze with a
+// "no_moves" message holding the game's headers and summary
+func (board *Board) sendNoMoves(pgn string, opts []chessanalysis.AnalyzeChessGameOption) {
+	resolved, err := chessanalysis.ResolveOptions(opts...)
+	if err != nil {
+		fmt.Printf("Error resolving analysis options: %v\n", err)
+		return
+	}
+	gameJSON, err := json.Marshal(chessanalysis.NewUnanalyzedGame(pgn, resolved.Effective()))
+	if err != nil {
+		fmt.Printf("Error marshaling summary: %v\n", err)
+		return
+	}
+	board.send(Message{Type: "no_moves", Text: string(gameJSON)})
+}
+
+// sendAnalysis sends the analysis of a move as a message of the given type,
+// encoded in the client's format
+func (board *Board) sendAnalysis(messageType string, move *chessanalysis.MoveAnalysis, format chessanalysis.MoveJSONOptions) bool {
+	analysisJSON, err := format.MarshalMove(move)
+	if err != nil {
+		fmt.Printf("Error marshaling analysis: %v\n", err)
+		return true
+	}
+	if err := board.send(Message{Type: messageType, Text: string(analysisJSON)}); err != nil {
+		fmt.Printf("Error sending analysis: %v\n", err)
+		return false
+	}
+	return true
+}
+
+// finishPass reports the error that ended a pass over the game, or sends the
+// game summary once every move is analyzed, its moves encoded in the client's
+// format, storing the analysis with the ownership. It reports whether the
+// pass succeeded.
+func (board *Board) finishPass(pgn string, moves []chessanalysis.MoveAnalysis, errs <-chan error, opts []chessanalysis.AnalyzeChessGameOption, format chessanalysis.MoveJSONOptions, owned ownership) bool {
+	if err := <-errs; err != nil {
+		if !errors.Is(err, chessanalysis.ErrAnalysisCancelled) {
+			board.send(Message{Type: "analysis", Text: analysisErrorText(err)})
+		}
+		return false
+	}
+	resolved, err := chessanalysis.ResolveOptions(opts...)
+	if err != nil {
+		fmt.Printf("Error resolving analysis options: %v\n", err)
+		return false
+	}
+	game := chessanalysis.NewGameAnalysis(pgn, moves, resolved.Effective())
+	if resolved.Theory != nil {
+		game.CheckTheory(resolved.Theory)
+	}
+	if resolved.Tablebase != nil && game.Unfinished() && len(moves) > 0 {
+		// Only profiles with tablebases adjudicate, as it takes another search
+		adjudication, err := chessanalysis.AdjudicatePosition(moves[len(moves)-1].FENAfter, opts...)
+		if errors.Is(err, chessanalysis.ErrAnalysisCancelled) {
+			return false
+		}
+		if err != nil {
+			fmt.Printf("Error adjudicating game: %v\n", err)
+		}
+		game.Adjudication = adjudication
+	}
+	summaryJSON, err := json.Marshal(game)
+	if err != nil {
+		fmt.Printf("Error marshaling summary: %v\n", err)
+		return false
+	}
+	id, hash := board.client.application.analyses.add(game, pgn, summaryJSON, owned)
+	// The stored analysis keeps the full JSON, which its hash is of
+	if format.Compact || format.Fields != nil {
+		if summaryJSON, err = format.MarshalGame(game); err != nil {
+			fmt.Printf("Error marshaling summary: %v\n", err)
+			return false
+		}
+	}
+	return board.send(Message{Type: "summary", Text: string(summaryJSON), ID: id, Hash: hash}) == nil
+}
+
+// send writes a message to the client, as JSON or, to clients that asked for
+// it, as a binary MessagePack message. Analyses and guessing games write from
+// their own goroutines, so writes are serialized.
+func (client *Client) send(message Message) error {
+	if client.msgpack {
+		encoded, err := msgpackMessage(message)
+		if err != nil {
+			return err
+		}
+		client.writeLock.Lock()
+		defer client.writeLock.Unlock()
+		return client.conn.WriteMessage(websocket.BinaryMessage, encoded)
+	}
+	client.writeLock.Lock()
+	defer client.writeLock.Unlock()
+	return client.conn.WriteJSON(message)
+}
+
+// maxKibitzDepth is how deep the kibitzer searches when no shallower depth is requested
+const maxKibitzDepth = 30
+
+// kibitz streams the engine's evaluation of the position given as a FEN in
+// the message text, sending a "kibitz" message each time the search reaches
+// a new depth and once more when it finishes. Each request replaces the
+// search the kibitzer was running, so only the displayed position is searched.
+//
+// A position already searched, by the kibitzer or by pondering, is answered
+// from cache straight away; if it was searched less deep than requested, the
+// search goes on and only deeper updates follow.
+func (board *Board) kibitz(message Message) {
+	app := board.client.application
+	depth := min(kibitzDepth(message.Depth), app.keyDepthCap(board.client.apiKey))
+	ctx := board.startKibitzing()
+	cached, ok := app.kibitzCache.Get(message.Text)
+	if ok {
+		cached.Final = cached.Depth >= depth
+		board.sendKibitz(cached)
+		if cached.Final {
+			return
+		}
+	}
+	done, ok := board.startJob(true)
+	if !ok {
+		return
+	}
+	defer done()
+	engine, err := app.enginePool.Acquire(ctx, chessanalysis.InteractivePriority, app.engineFactory)
+	if err != nil {
+		if !errors.Is(err, chessanalysis.ErrAnalysisCancelled) {
+			board.send(Message{Type: "kibitz-error", Text: analysisErrorText(err)})
+		}
+		return
+	}
+	defer engine.Close()
+
+	err = chessanalysis.Kibitz(ctx, engine, message.Text, chessanalysis.SearchLimits{Depth: depth}, func(update chessanalysis.KibitzUpdate) {
+		if update.Final {
+			app.kibitzCache.Put(update)
+		} else if update.Depth <= cached.Depth {
+			return
+		}
+		board.sendKibitz(update)
+	})
+	if err != nil && !errors.Is(err, chessanalysis.ErrAnalysisCancelled) {
+		board.send(Message{Type: "kibitz-error", Text: analysisErrorText(err)})
+	}
+}
+
+// kibitzDepth returns how deep the kibitzer searches for a requested depth
+func kibitzDepth(depth int) int {
+	if depth <= 0 || depth > maxKibitzDepth {
+		return maxKibitzDepth
+	}
+	return depth
+}
+
+// sendKibitz sends a "kibitz" message with the update, and an "eval" message
+// if the client subscribed to them
+func (board *Board) sendKibitz(update chessanalysis.KibitzUpdate) {
+	board.queueEval(chessanalysis.NewEvalBar(update))
+	updateJSON, err := json.Marshal(update)
+	if err != nil {
+		fmt.Printf("Error marshaling kibitz update: %v\n", err)
+		return
+	}
+	board.send(Message{Type: "kibitz", Text: string(updateJSON)})
+}
+
+// subscribeEvals starts or stops sending the board's kibitzer evaluations as
+// "eval" messages too
+func (board *Board) subscribeEvals(subscribe bool) {
+	board.evalLock.Lock()
+	defer board.evalLock.Unlock()
+	board.evals = subscribe
+	if !subscribe {
+		board.pendingEval = nil
+	}
+}
+
+// queueEval sends an "eval" message with the evaluation if the client
+// subscribed to them. Evaluations are written by a goroutine of their own,
+// so the search never waits on the connection, and one not yet written when
+// the next arrives is replaced by it, so that a connection busy with bulky
+// analysis messages gets the latest evaluation rather than a backlog.
+func (board *Board) queueEval(bar chessanalysis.EvalBar) {
+	board.evalLock.Lock()
+	defer board.evalLock.Unlock()
+	if !board.evals {
+		return
+	}
+	board.pendingEval = &bar
+	if !board.writingEval {
+		board.writingEval = true
+		go board.writeEvals()
+	}
+}
+
+// writeEvals sends the board's pending evaluations until none is left
+func (board *Board) writeEvals() {
+	for {
+		board.evalLock.Lock()
+		bar := board.pendingEval
+		board.pendingEval = nil
+		if bar == nil {
+			board.writingEval = false
+			board.evalLock.Unlock()
+			return
+		}
+		board.evalLock.Unlock()
+		barJSON, err := json.Marshal(bar)
+		if err != nil {
+			fmt.Printf("Error marshaling eval: %v\n", err)
+			continue
+		}
+		board.send(Message{Type: "eval", Text: string(barJSON)})
+	}
+}
+
+// maxPonderPositions is how many positions a "ponder" message may ask for
+const maxPonderPositions = 4
+
+// ponder searches the positions given as a JSON array of FENs in the message
+// text, usually the next few of the game the client is browsing, while an
+// engine of the pool is idle, so the kibitzer answers from cache when the
+// client steps to them. Pondering gives way to any analysis waiting for an
+// engine, and each request replaces the positions the board was pondering.
+func (board *Board) ponder(message Message) {
+	var fens []string
+	if err := json.Unmarshal([]byte(message.Text), &fens); err != nil {
+		board.send(Message{Type: "kibitz-error", Text: "Invalid ponder request: " + err.Error()})
+		return
+	}
+	if len(fens) > maxPonderPositions {
+		fens = fens[:maxPonderPositions]
+	}
+	board.kibitzLock.Lock()
+	if board.stopPonder != nil {
+		board.stopPonder()
+	}
+	ctx, cancel := context.WithCancel(board.ctx)
+	board.stopPonder = cancel
+	board.kibitzLock.Unlock()
+	defer cancel()
+
+	app := board.client.application
+	// Pondering is only ever a head start, so it quietly gives way to the
+	// quota too
+	done, err := app.startJob(board.client.apiKey, false)
+	if err != nil {
+		return
+	}
+	defer done()
+	limits := chessanalysis.SearchLimits{Depth: min(kibitzDepth(message.Depth), app.keyDepthCap(board.client.apiKey))}
+	err = chessanalysis.Ponder(ctx, app.enginePool, app.engineFactory, app.kibitzCache, fens, limits)
+	if err != nil && !errors.Is(err, chessanalysis.ErrAnalysisCancelled) {
+		// Nobody asked to see these positions yet, so the kibitzer reports
+		// the error when they are
+		fmt.Printf("Error pondering: %v\n", err)
+	}
+}
+
+// startKibitzing stops the kibitzer's search in progress, if any, and returns
+// the context of the next one
+func (board *Board) startKibitzing() context.Context {
+	board.kibitzLock.Lock()
+	defer board.kibitzLock.Unlock()
+	if board.stopKibitz != nil {
+		board.stopKibitz()
+	}
+	ctx, cancel := context.WithCancel(board.ctx)
+	board.stopKibitz = cancel
+	return ctx
+}
+
+// stopKibitzing stops the kibitzer's search in progress and pondering, if any
+func (board *Board) stopKibitzing() {
+	board.kibitzLock.Lock()
+	defer board.kibitzLock.Unlock()
+	if board.stopKibitz != nil {
+		board.stopKibitz()
+		board.stopKibitz = nil
+	}
+	if board.stopPonder != nil {
+		board.stopPonder()
+		board.stopPonder = nil
+	}
+}
+
+// relayFollower reports the moves of a relay's games as they are analyzed,
+// like chessanalysis.Relay and chessanalysis.LichessBroadcast
+type relayFollower interface {
+	Follow(ctx context.Context, update func(chessanalysis.RelayUpdate)) error
+}
+
+// followRelay follows the relay's games with the follower until ctx is done,
+// sending each new move to the subscribed clients as a "relay" message
+func (app *Application) followRelay(ctx context.Context, relay *chessanalysis.Relay, follower relayFollower) {
+	app.relayLock.Lock()
+	app.relay = relay
+	app.relayLock.Unlock()
+	go follower.Follow(ctx, func(update chessanalysis.RelayUpdate) {
+		updateJSON, err := json.Marshal(update)
+		if err != nil {
+			fmt.Printf("Error marshaling relay update: %v\n", err)
+			return
+		}
+		message := Message{Type: "relay", Text: string(updateJSON)}
+		app.relayLock.Lock()
+		defer app.relayLock.Unlock()
+		for client, subscriber := range app.relaySubscribers {
+			if !subscriber.push(message, Message{Type: "relay-error", Text: "Fell too far behind the relay"}) {
+				delete(app.relaySubscribers, client)
+			}
+		}
+	})
+}
+
+// relaySubscriberBacklog is how many relay updates a client can fall behind
+// before it is unsubscribed
+const relaySubscriberBacklog = 256
+
+// subscribeToRelay sends the client the relay's games so far as a
+// "relay-boards" message, followed by each new move as it is analyzed
+func (app *Application) subscribeToRelay(client *Client) {
+	app.relayLock.Lock()
+	defer app.relayLock.Unlock()
+	if app.relay == nil {
+		client.send(Message{Type: "relay-error", Text: "No relay is being followed"})
+		return
+	}
+	boardsJSON, err := json.Marshal(app.relay.Boards())
+	if err != nil {
+		fmt.Printf("Error marshaling relay boards: %v\n", err)
+		return
+	}
+	// Queueing the boards under the lock keeps updates from arriving ahead of
+	// them. A client subscribing again gets them on its outbox, after the
+	// updates it already has queued, as a second writer would race the first.
+	boards := Message{Type: "relay-boards", Text: string(boardsJSON)}
+	if subscriber, ok := app.relaySubscribers[client]; ok {
+		if !subscriber.push(boards, Message{Type: "relay-error", Text: "Fell too far behind the relay"}) {
+			delete(app.relaySubscribers, client)
+		}
+		return
+	}
+	subscriber := newOutbox(client, relaySubscriberBacklog)
+	subscriber.messages <- boards
+	app.relaySubscribers[client] = subscriber
+	go subscriber.write(nil)
+}
+
+// unsubscribeFromRelay stops sending the client the relay's moves
+func (app *Application) unsubscribeFromRelay(client *Client) {
+	app.relayLock.Lock()
+	defer app.relayLock.Unlock()
+	if subscriber, ok := app.relaySubscribers[client]; ok {
+		delete(app.relaySubscribers, client)
+		subscriber.close(nil)
+	}
+}
+
+// startGuessing analyzes the game and starts a guess-the-move session for
+// the requested side
+func (board *Board) startGuessing(message Message) {
+	depth := message.Depth
+	if depth <= 0 {
+		depth = defaultAnalysisDepth
+	}
+	if maxDepth := board.client.application.keyDepthCap(board.client.apiKey); depth > maxDepth {
+		depth = maxDepth
+	}
+	done, ok := board.startJob(true)
+	if !ok {
+		return
+	}
+	defer done()
+	game, err := chessanalysis.AnalyzeGame(message.PGN,
+		chessanalysis.WithDepth(depth),
+		chessanalysis.WithMultiPV(guessMultiPV),
+		chessanalysis.WithEngineFactory(board.client.application.engineFactory),
+		chessanalysis.WithEnginePool(board.client.application.enginePool, chessanalysis.InteractivePriority),
+		chessanalysis.WithContext(board.ctx),
+	)
+	if err != nil {
+		if !errors.Is(err, chessanalysis.ErrAnalysisCancelled) {
+			board.send(Message{Type: "guess-error", Text: analysisErrorText(err)})
+		}
+		return
+	}
+	session, err := chessanalysis.NewGuessSession(game, message.Color)
+	if err != nil {
+		board.send(Message{Type: "guess-error", Text: err.Error()})
+		return
+	}
+	board.guessLock.Lock()
+	defer board.guessLock.Unlock()
+	board.guess = session
+	board.sendGuessPrompt()
+}
+
+// submitGuess scores a guess in the current session and sends the next position
+func (board *Board) submitGuess(move string) {
+	board.guessLock.Lock()
+	defer board.guessLock.Unlock()
+	if board.guess == nil {
+		board.send(Message{Type: "guess-error", Text: "No guess-the-move session in progress"})
+		return
+	}
+	result, err := board.guess.Guess(move)
+	if err != nil {
+		board.send(Message{Type: "guess-error", Text: err.Error()})
+		return
+	}
+	resultJSON, err := json.Marshal(result)
+	if err != nil {
+		fmt.Printf("Error marshaling guess result: %v\n", err)
+		return
+	}
+	if err := board.send(Message{Type: "guess-result", Text: string(resultJSON)}); err != nil {
+		fmt.Printf("Error sending guess result: %v\n", err)
+		return
+	}
+	board.sendGuessPrompt()
+}
+
+// sendGuessPrompt sends the position to guess next, or guess-complete once
+// the session is over. The caller must hold guessLock.
+func (board *Board) sendGuessPrompt() {
+	move := board.guess.Current()
+	if move == nil {
+		board.guess = nil
+		board.send(Message{Type: "guess-complete"})
+		return
+	}
+	promptJSON, err := json.Marshal(GuessPrompt{MoveNumber: move.MoveNumber, Color: move.Color, FEN: move.FENBefore})
+	if err != nil {
+		fmt.Printf("Error marshaling guess prompt: %v\n", err)
+		return
+	}
+	board.send(Message{Type: "guess-position", Text: string(promptJSON)})
+}
+
+// analysisErrorText returns the message shown to the client for an analysis error
+func analysisErrorText(err error) string {
+	switch {
+	case errors.Is(err, chessanalysis.ErrEngineNotFound):
+		return "Analysis error: Stockfish is not installed on the server"
+	case errors.Is(err, chessanalysis.ErrEngineTimeout):
+		return "Analysis error: Stockfish stopped responding"
+	case errors.Is(err, chessanalysis.ErrInvalidPGN):
+		return fmt.Sprintf("Analysis error: the PGN could not be parsed (%v)", err)
+	case errors.Is(err, chessanalysis.ErrEmptyGame):
+		return "Analysis error: no game to analyze"
+	default:
+		return fmt.Sprintf("Analysis error: %v", err)
+	}
+}
+
+func (app *Application) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if access := app.accessControl(); access != nil {
+		if !access.allowedIP(r) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		// The admin API checks its own bearer token in place of basic auth,
+		// as both need the Authorization header
+		if key, ok := access.apiKey(r); ok {
+			r = r.WithContext(withAPIKey(r.Context(), key))
+		} else if !access.authenticated(r) && !isAdminPath(r.URL.Path) {
+			w.Header().Set("WWW-Authenticate", `Basic realm="Chess Analyzer", charset="UTF-8"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+	}
+	if _, session, ok := app.requestSession(r); ok {
+		r = r.WithContext(withAccount(r.Context(), &session.account))
+	}
+	app.router.ServeHTTP(w, r)
+}
+
+// isAdminPath reports whether the path is of the admin API
+func isAdminPath(path string) bool {
+	return path == adminPathPrefix || strings.HasPrefix(path, adminPathPrefix+"/")
+}
+
+func notFoundHandler(w http.ResponseWriter, r *http.Request) {
+	http.Error(w, "File Not Found", http.StatusNotFound)
+}
+
+func stdoutLogger(next http.Handler) http.Handler {
+	return handlers.LoggingHandler(os.Stdout, next)
+}
+
+// runBench implements the "bench" subcommand, which times the engine on a
+// standard suite of positions at several depths
+func runBench(args []string) error {
+	flags := flag.NewFlagSet("bench", flag.ExitOnError)
+	depths := flags.String("depths", "", "Comma-separated search depths to benchmark (default 8,12,16,20)")
+	flags.Parse(args)
+
+	var benchDepths []int
+	if *depths != "" {
+		for _, field := range strings.Split(*depths, ",") {
+			depth, err := strconv.Atoi(strings.TrimSpace(field))
+			if err != nil {
+				return fmt.Errorf("invalid depth %q", field)
+			}
+			benchDepths = append(benchDepths, depth)
+		}
+	}
+
+	results, err := chessanalysis.RunBenchmark(context.Background(), uciengine.StockfishEngineFactory, benchDepths, nil)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "Depth\tNodes/sec\tTime per position")
+	for _, result := range results {
+		fmt.Fprintf(w, "%d\t%d\t%s\n", result.Depth, result.NPS, result.AverageTime.Round(time.Millisecond))
+	}
+	return w.Flush()
+}
+
+// runUCI implements the "uci" subcommand, which chess GUIs run as their
+// engine. It passes the GUI's conversation with the real engine through and
+// appends the session's games, annotated, to a PGN file when the GUI quits.
+// Standard output belongs to the GUI, so errors go to standard error.
+func runUCI(args []string) error {
+	flags := flag.NewFlagSet("uci", flag.ExitOnError)
+	engine := flags.String("engine", "stockfish", "Engine binary to pass searches to")
+	output := flags.String("pgn", "uci-session.pgn", "PGN file the annotated games of each session are appended to")
+	nagsName := flags.String("nags", "numeric", "How moves are annotated: numeric NAGs such as $2, or symbols such as ?")
+	flags.Parse(args)
+	nags, err := chessanalysis.NAGMappingByName(*nagsName)
+	if err != nil {
+		return err
+	}
+
+	proxy := chessanalysis.NewUCIProxy(*engine)
+	if err := proxy.Run(os.Stdin, os.Stdout); err != nil {
+		return err
+	}
+	pgn := report.SessionPGN(proxy.Games(), report.WithNAGs(nags))
+	if pgn == "" {
+		return nil
+	}
+	file, err := os.OpenFile(*output, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintln(file, pgn); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// exporters write batch analyses in the format of each export subcommand
+var exporters = map[string]func(io.Writer, ...*chessanalysis.GameAnalysis) error{
+	"csv":     report.WriteCSV,
+	"parquet": report.WriteParquet,
+	"sqlite":  report.WriteSQLite,
+	// The crosstable of a tournament's games, with each player's aggregates
+	"tournament":    chessanalysis.WriteTournamentJSON,
+	"tournament-md": report.WriteTournamentMarkdown,
+}
+
+// parseMonths parses a comma-separated list of months such as
+// "2024-01,2024-03..2024-06", where ranges include both ends
+func parseMonths(spec string) ([]time.Time, error) {
+	var months []time.Time
+	for _, field := range strings.Split(spec, ",") {
+		first, last, isRange := strings.Cut(strings.TrimSpace(field), "..")
+		from, err := time.Parse("2006-01", first)
+		if err != nil {
+			return nil, fmt.Errorf("invalid month %q, expected YYYY-MM", first)
+		}
+		to := from
+		if isRange {
+			if to, err = time.Parse("2006-01", last); err != nil {
+				return nil, fmt.Errorf("invalid month %q, expected YYYY-MM", last)
+			}
+		}
+		if to.Before(from) {
+			return nil, fmt.Errorf("month range %q ends before it starts", field)
+		}
+		for month := from; !month.After(to); month = month.AddDate(0, 1, 0) {
+			months = append(months, month)
+		}
+	}
+	return months, nil
+}
+
+// exportGames returns the PGN database an export subcommand analyzes: the
+// file's, which may be a Lichess NDJSON export, or the chess.com player's
+// games of the given months
+func exportGames(file, chessComPlayer, months string) (string, error) {
+	if chessComPlayer == "" && strings.HasSuffix(file, ".ndjson") {
+		games, err := os.Open(file)
+		if err != nil {
+			return "", err
+		}
+		defer games.Close()
+		return chessanalysis.ReadLichessNDJSON(games)
+	}
+	if chessComPlayer == "" {
+		pgn, err := os.ReadFile(file)
+		return string(pgn), err
+	}
+	archiveMonths := []time.Time{time.Now()}
+	if months != "" {
+		var err error
+		if archiveMonths, err = parseMonths(months); err != nil {
+			return "", err
+		}
+	}
+	return chessanalysis.NewChessComArchive().Games(context.Background(), chessComPlayer, archiveMonths)
+}
+
+// runExport implements the export subcommands, such as "csv", which analyze
+// every game of a PGN file, or of a chess.com player's monthly archives, and
+// write the analysis of each ply to standard output with write
+func runExport(name string, write func(io.Writer, ...*chessanalysis.GameAnalysis) error, args []string) error {
+	flags := flag.NewFlagSet(name, flag.ExitOnError)
+	depth := flags.Int("depth", 0, "Search depth (default: the analyzer's default)")
+	chessCom := flags.String("chesscom", "", "Analyze this chess.com player's games instead of a PGN file")
+	months := flags.String("months", "", "Months of -chesscom games, e.g. 2024-01,2024-03..2024-06 (default: this month)")
+	reuseEvals := flags.Bool("reuse-evals", true, "Reuse the evaluations annotated in the games with [%eval] instead of searching those moves")
+	excludeDeadDraws := flags.Bool("exclude-dead-draws", false, "Leave the moves played after a game became a dead draw out of the players' statistics")
+	ratingScaling := flags.Bool("rating-scaling", false, "Scale the classification thresholds to each player's WhiteElo or BlackElo tag")
+	timeControlProfiles := flags.Bool("time-control-profiles", false, "Classify bullet games with the beginner thresholds, from their TimeControl tag")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: chess-analyzer %s [-depth N] games.pgn|games.ndjson\n", name)
+		fmt.Fprintf(flags.Output(), "       chess-analyzer %s [-depth N] -chesscom player [-months YYYY-MM,...]\n", name)
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if (*chessCom == "") != (flags.NArg() == 1) || flags.NArg() > 1 {
+		flags.Usage()
+		return fmt.Errorf("expected one PGN file or -chesscom")
+	}
+
+	pgn, err := exportGames(flags.Arg(0), *chessCom, *months)
+	if err != nil {
+		return err
+	}
+	var opts []chessanalysis.AnalyzeChessGameOption
+	if *depth > 0 {
+		opts = append(opts, chessanalysis.WithDepth(*depth))
+	}
+	if *reuseEvals {
+		opts = append(opts, chessanalysis.WithEmbeddedEvals())
+	}
+	if *excludeDeadDraws {
+		opts = append(opts, chessanalysis.WithoutDeadDrawMoves())
+	}
+	if *ratingScaling {
+		opts = append(opts, chessanalysis.WithRatingScaling(chessanalysis.DefaultRatingScaler))
+	}
+	if *timeControlProfiles {
+		opts = append(opts, chessanalysis.WithTimeControlProfiles(chessanalysis.DefaultTimeControlProfiles))
+	}
+	cache := chessanalysis.NewSearchCache()
+	opts = append(opts, chessanalysis.WithSearchCache(cache))
+	games, analysisErr := chessanalysis.AnalyzeChessGames(pgn, opts...)
+	// Standard output is the export, so the cache statistics go to standard error
+	stats := cache.Stats()
+	fmt.Fprintf(os.Stderr, "Search cache: %d hits, %d misses (%.1f%% hit rate), %d evicted\n",
+		stats.Hits, stats.Misses, stats.HitRate(), stats.Evictions)
+	output := bufio.NewWriter(os.Stdout)
+	if err := write(output, games...); err != nil {
+		return err
+	}
+	if err := output.Flush(); err != nil {
+		return err
+	}
+	return analysisErr
+}
+
+func main() {
+	if len(os.Args) > 1 && exporters[os.Args[1]] != nil {
+		if err := runExport(os.Args[1], exporters[os.Args[1]], os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "%s export failed: %v\n", os.Args[1], err)
+			os.Exit(1)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "bench" {
+		if err := runBench(os.Args[2:]); err != nil {
+			fmt.Printf("Benchmark failed: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "gate" {
+		if err := runGate(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "Gate failed: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "screen" {
+		if err := runScreen(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "Screening failed: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "uci" {
+		if err := runUCI(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "UCI session failed: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	var port uint
+	var recordTranscript, replayTranscript, prepareFor string
+	var prepareGames, engines, relayDepth, hashMB, threads int
+	var relayURL, broadcastRound, adminToken, configPath, secondOpinion, symbols, unixSocket string
+	var relayInterval time.Duration
+	var downloadEngine, heuristicFallback bool
+	limits := chessanalysis.DefaultInputLimits
+	var processLimits uciengine.ProcessLimits
+	flag.UintVar(&port, "port", DefaultPort, "Port to listen on")
+	flag.StringVar(&unixSocket, "unix-socket", "", "Unix domain socket to listen on, instead of the port unless -port is given too")
+	flag.StringVar(&recordTranscript, "record-transcript", "", "Record the UCI conversation with Stockfish to this file")
+	flag.StringVar(&replayTranscript, "replay-transcript", "", "Replay a recorded UCI conversation instead of running Stockfish")
+	flag.StringVar(&prepareFor, "prepare-for", "", "Print a preparation dossier on this Lichess user and exit")
+	flag.IntVar(&prepareGames, "prepare-games", 20, "How many recent games -prepare-for analyzes")
+	flag.IntVar(&engines, "engines", runtime.NumCPU(), "How many engines may run at once; interactive analyses go first")
+	flag.IntVar(&threads, "threads", 0, "Threads of each engine; 0 shares the cores between the engines")
+	flag.IntVar(&processLimits.Nice, "engine-nice", 0, "Niceness engines run at, from 1 to 19, so they don't starve the web server (Linux only)")
+	flag.IntVar(&processLimits.MaxMemoryMB, "engine-max-memory", 0, "Memory each engine process may use in MB, which must leave room for its hash; 0 for no limit (Linux only)")
+	flag.IntVar(&processLimits.CPUs, "engine-cpus", 0, "How many cores each engine process may run on; 0 for all (Linux only)")
+	flag.BoolVar(&processLimits.Sandbox, "engine-sandbox", false, "Run engines in an empty directory without network access or the right to write files (Linux only)")
+	flag.BoolVar(&downloadEngine, "download-engine", false, "Download an official Stockfish build into the user's cache directory if Stockfish isn't installed")
+	flag.BoolVar(&heuristicFallback, "heuristic-fallback", true, "Evaluate moves by material and mobility alone, marked heuristic only, if no engine can be started; not with -record-transcript or -replay-transcript")
+	flag.IntVar(&hashMB, "hash", 0, "Hash size of each engine in MB; 0 shares half the memory available between the engines")
+	flag.StringVar(&relayURL, "relay", "", "Follow the live PGN at this URL, analyzing its games as they are played")
+	flag.DurationVar(&relayInterval, "relay-interval", chessanalysis.DefaultRelayInterval, "How often -relay is polled")
+	flag.StringVar(&broadcastRound, "lichess-broadcast", "", "Follow the Lichess broadcast round with this ID, analyzing its games as they are played")
+	flag.IntVar(&relayDepth, "relay-depth", 12, "How deep -relay and -lichess-broadcast moves are analyzed")
+	flag.StringVar(&adminToken, "admin-token", os.Getenv("CHESS_ANALYZER_ADMIN_TOKEN"), "Bearer token of the admin API, which is disabled without one (default $CHESS_ANALYZER_ADMIN_TOKEN)")
+	flag.StringVar(&secondOpinion, "second-opinion", "", "UCI engine binary, such as lc0, to search every move alongside Stockfish, flagging where they disagree")
+	flag.StringVar(&symbols, "symbols", "ascii", "Symbols classifications are shown with: ascii, such as ?? and +-, or unicode, such as ⁇ and +−")
+	flag.StringVar(&configPath, "config", "", "Configuration file, in JSON, with the access control and input limits")
+	flag.IntVar(&limits.MaxPGNBytes, "max-pgn-bytes", limits.MaxPGNBytes, "Largest PGN accepted for analysis, in bytes; 0 for no limit")
+	flag.IntVar(&limits.MaxGames, "max-games", limits.MaxGames, "Most games accepted in one PGN; 0 for no limit")
+	flag.IntVar(&limits.MaxPlies, "max-plies", limits.MaxPlies, "Most plies accepted in one game; 0 for no limit")
+	flag.Parse()
+	if port == 0 || port > 65535 {
 		fmt.Println("Invalid port number")
 		os.Exit(1)
 	}
-	fmt.Printf("Starting server on :%d\n", port)
+	if recordTranscript != "" && replayTranscript != "" {
+		fmt.Println("Only one of -record-transcript and -replay-transcript may be given")
+		os.Exit(1)
+	}
+	if engines < 1 {
+		fmt.Println("At least one engine is needed")
+		os.Exit(1)
+	}
 	app := NewApplication()
+	app.enginePool = chessanalysis.NewEnginePool(engines)
+	var err error
+	if app.symbols, err = chessanalysis.ClassificationSymbolsByName(symbols); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	if hashMB < 0 {
+		fmt.Println("The hash size can't be negative")
+		os.Exit(1)
+	}
+	if hashMB > 0 {
+		app.enginePool.SetHashMB(hashMB)
+	}
+	if threads < 0 {
+		fmt.Println("The number of threads can't be negative")
+		os.Exit(1)
+	}
+	if threads > 0 {
+		if threads*engines > runtime.NumCPU() {
+			fmt.Printf("Warning: %d engines of %d threads oversubscribe the %d cores\n", engines, threads, runtime.NumCPU())
+		}
+		app.enginePool.SetThreads(threads)
+	}
+	app.adminToken = adminToken
+	app.limits, app.flagLimits = limits, limits
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "max-pgn-bytes", "max-games", "max-plies":
+			app.limitFlags = append(app.limitFlags, f.Name)
+		}
+	})
+	if configPath != "" {
+		config, err := loadConfig(configPath)
+		if err != nil {
+			fmt.Printf("Failed to load configuration: %v\n", err)
+			os.Exit(1)
+		}
+		if err := app.applyConfig(config); err != nil {
+			fmt.Printf("Invalid configuration: %v\n", err)
+			os.Exit(1)
+		}
+		app.configPath = configPath
+		if config.SecondOpinion != "" && secondOpinion == "" {
+			secondOpinion = config.SecondOpinion
+		}
+		// SIGHUP reloads the configuration, as the admin API does
+		reloads := make(chan os.Signal, 1)
+		signal.Notify(reloads, syscall.SIGHUP)
+		go func() {
+			for range reloads {
+				if err := app.reload(); err != nil {
+					fmt.Printf("Failed to reload configuration, keeping the old one: %v\n", err)
+					continue
+				}
+				fmt.Printf("Reloaded configuration from %s\n", configPath)
+			}
+		}()
+		// Only the configuration file sets retention periods
+		go func() {
+			for now := range time.Tick(retentionInterval) {
+				if analyses, evals := app.purgeExpired(now); analyses+evals > 0 {
+					fmt.Printf("Purged %d expired analyses and %d evaluations\n", analyses, evals)
+				}
+			}
+		}()
+	}
+	if processLimits.Nice < 0 || processLimits.Nice > 19 || processLimits.MaxMemoryMB < 0 || processLimits.CPUs < 0 {
+		fmt.Println("Engine niceness must be from 0 to 19, and memory and core limits can't be negative")
+		os.Exit(1)
+	}
+	engineBinary := "stockfish"
+	if downloadEngine {
+		bootstrap, err := uciengine.NewStockfishBootstrap()
+		if err == nil {
+			engineBinary, err = bootstrap.Binary(context.Background())
+		}
+		if err != nil {
+			fmt.Printf("Failed to download Stockfish: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Analyzing with %s\n", engineBinary)
+	}
+	if processLimits != (uciengine.ProcessLimits{}) || engineBinary != "stockfish" {
+		app.engineFactory = uciengine.LimitedEngineFactory(engineBinary, processLimits)
+	}
+	if secondOpinion != "" {
+		app.secondOpinion = uciengine.LimitedEngineFactory(secondOpinion, processLimits)
+	}
+	if recordTranscript != "" {
+		app.engineFactory = uciengine.RecordingEngineFactory(recordTranscript)
+	}
+	if replayTranscript != "" {
+		app.engineFactory = uciengine.ReplayEngineFactory(replayTranscript)
+	}
+	if heuristicFallback && recordTranscript == "" && replayTranscript == "" {
+		// A transcript is of a real engine's conversation, so failing to
+		// record or replay one is reported rather than evaluated around
+		app.engineFactory = chessanalysis.HeuristicFallback(app.engineFactory)
+	}
+	if prepareFor != "" {
+		dossier, err := chessanalysis.PrepareForOpponent(context.Background(), chessanalysis.NewLichessGameSource(),
+			prepareFor, prepareGames, chessanalysis.WithEngineFactory(app.engineFactory),
+			chessanalysis.WithEnginePool(app.enginePool, chessanalysis.BackgroundPriority))
+		if dossier == nil {
+			fmt.Printf("Failed to prepare for %s: %v\n", prepareFor, err)
+			os.Exit(1)
+		}
+		if err != nil {
+			fmt.Printf("Some games could not be analyzed: %v\n", err)
+		}
+		fmt.Print(dossier.Markdown())
+		return
+	}
+
+	if relayURL != "" && broadcastRound != "" {
+		fmt.Println("Only one of -relay and -lichess-broadcast may be given")
+		os.Exit(1)
+	}
+	relayOpts := []chessanalysis.AnalyzeChessGameOption{
+		chessanalysis.WithDepth(relayDepth),
+		chessanalysis.WithEngineFactory(app.engineFactory),
+		chessanalysis.WithEnginePool(app.enginePool, chessanalysis.BackgroundPriority),
+		chessanalysis.WithClassificationSymbols(app.symbols),
+	}
+	if relayURL != "" {
+		relay := chessanalysis.NewRelay(relayURL, relayOpts...)
+		relay.Interval = relayInterval
+		fmt.Printf("Following relay %s\n", relayURL)
+		app.followRelay(context.Background(), relay, relay)
+	}
+	if broadcastRound != "" {
+		broadcast := chessanalysis.NewLichessBroadcast(broadcastRound, relayOpts...)
+		broadcast.Relay.Interval = relayInterval
+		fmt.Printf("Following Lichess broadcast round %s\n", broadcastRound)
+		app.relayRound = broadcastRound
+		app.followRelay(context.Background(), broadcast.Relay, broadcast)
+	}
+
+	portGiven := false
+	flag.Visit(func(f *flag.Flag) { portGiven = portGiven || f.Name == "port" })
+	listeners, err := serverListeners(port, portGiven, unixSocket)
+	if err != nil {
+		fmt.Printf("Failed to listen: %v\n", err)
+		os.Exit(1)
+	}
+	server := &http.Server{Handler: app}
+	served := make(chan error, len(listeners))
+	for _, listener := range listeners {
+		fmt.Printf("Starting server on %s\n", listenerName(listener))
+		go func() { served <- server.Serve(listener) }()
+	}
+	fmt.Printf("Server stopped: %v\n", <-served)
+	os.Exit(1)
+}
 
-	http.ListenAndServe(fmt.Sprintf(":%d", port), app)
+// serverListeners returns what the server listens on: the sockets systemd
+// passed it under socket activation, the Unix socket if one is given, and the
+// TCP port. The port is left out when there are other listeners, unless it
+// was given explicitly.
+func serverListeners(port uint, portGiven bool, unixSocket string) ([]net.Listener, error) {
+	listeners, err := systemdListeners()
+	if err != nil {
+		return nil, err
+	}
+	if unixSocket != "" {
+		// A socket file left by a server that didn't shut down cleanly would
+		// make listening fail
+		if info, err := os.Lstat(unixSocket); err == nil && info.Mode()&os.ModeSocket != 0 {
+			os.Remove(unixSocket)
+		}
+		listener, err := net.Listen("unix", unixSocket)
+		if err != nil {
+			return nil, err
+		}
+		listeners = append(listeners, listener)
+	}
+	if len(listeners) == 0 || portGiven {
+		listener, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+		if err != nil {
+			return nil, err
+		}
+		listeners = append(listeners, listener)
+	}
+	return listeners, nil
+}
+
+// systemdListeners returns the sockets systemd passed the server under
+// socket activation, if it did: as many as LISTEN_FDS from file descriptor 3,
+// when LISTEN_PID is this process
+func systemdListeners() ([]net.Listener, error) {
+	if os.Getenv("LISTEN_PID") != strconv.Itoa(os.Getpid()) {
+		return nil, nil
+	}
+	count, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || count < 1 {
+		return nil, fmt.Errorf("invalid LISTEN_FDS %q", os.Getenv("LISTEN_FDS"))
+	}
+	// The variables are for this process only, not the engines it starts
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+	var listeners []net.Listener
+	for fd := 3; fd < 3+count; fd++ {
+		file := os.NewFile(uintptr(fd), fmt.Sprintf("systemd socket %d", fd))
+		listener, err := net.FileListener(file)
+		// The listener has its own copy of the descriptor, which unlike the
+		// inherited one isn't passed on to the engines
+		file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("file descriptor %d: %w", fd, err)
+		}
+		listeners = append(listeners, listener)
+	}
+	return listeners, nil
+}
+
+// listenerName describes what a listener listens on for the log, such as
+// "[::]:8080" or "unix:/run/chess-analyzer.sock"
+func listenerName(listener net.Listener) string {
+	if addr := listener.Addr(); addr.Network() != "tcp" {
+		return addr.Network() + ":" + addr.String()
+	}
+	return listener.Addr().String()
 }
@@ -0,0 +1,2639 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image/gif"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/walterschell/chess-analyzer/chessanalysis"
+)
+
+const testPgn = `
+[Event "Scholar's Mate"]
+[Result "1-0"]
+
+1. e4 e5 2. Qh5 Nc6 3. Bc4 Nf6 4. Qxf7# 1-0
+`
+
+// newTestServer starts the application with a fake engine behind an HTTP test server
+func newTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	app := NewApplication()
+	app.engineFactory = (&chessanalysis.FakeEngine{}).NewEngine
+	server := httptest.NewServer(app)
+	t.Cleanup(server.Close)
+	return server
+}
+
+// dialTestServer opens a websocket connection to the test server
+func dialTestServer(t *testing.T, server *httptest.Server) *websocket.Conn {
+	t.Helper()
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws"
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("failed to connect to websocket: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	return conn
+}
+
+func TestWebsocketAnalysis(t *testing.T) {
+	conn := dialTestServer(t, newTestServer(t))
+
+	if err := conn.WriteJSON(Message{Type: "analyze", PGN: testPgn, Depth: 4}); err != nil {
+		t.Fatalf("failed to send analyze message: %v", err)
+	}
+
+	for i := 0; i < 7; i++ {
+		var response Message
+		if err := conn.ReadJSON(&response); err != nil {
+			t.Fatalf("failed to read analysis %d: %v", i+1, err)
+		}
+		if response.Type != "analysis" {
+			t.Fatalf("expected analysis message, got %q", response.Type)
+		}
+		var move chessanalysis.MoveAnalysis
+		if err := json.Unmarshal([]byte(response.Text), &move); err != nil {
+			t.Fatalf("failed to decode analysis %d: %v (%s)", i+1, err, response.Text)
+		}
+		if move.Depth != 4 {
+			t.Errorf("expected depth 4 for move %d, got %d", i+1, move.Depth)
+		}
+	}
+
+	var response Message
+	if err := conn.ReadJSON(&response); err != nil {
+		t.Fatalf("failed to read summary: %v", err)
+	}
+	if response.Type != "summary" {
+		t.Fatalf("expected summary message, got %q", response.Type)
+	}
+	var game chessanalysis.GameAnalysis
+	if err := json.Unmarshal([]byte(response.Text), &game); err != nil {
+		t.Fatalf("failed to decode summary: %v", err)
+	}
+	if len(game.Moves) != 7 || game.Summary.White.Moves != 4 || game.Summary.Black.Moves != 3 {
+		t.Errorf("unexpected summary move counts: %d moves, %d white, %d black",
+			len(game.Moves), game.Summary.White.Moves, game.Summary.Black.Moves)
+	}
+	if game.Options.Depth != 4 {
+		t.Errorf("expected effective depth 4, got %d", game.Options.Depth)
+	}
+}
+
+func TestAnalysisCSVExport(t *testing.T) {
+	server := newTestServer(t)
+	conn := dialTestServer(t, server)
+	if err := conn.WriteJSON(Message{Type: "analyze", PGN: testPgn, Depth: 4}); err != nil {
+		t.Fatalf("failed to send analyze message: %v", err)
+	}
+	var summary Message
+	for summary.Type != "summary" {
+		if err := conn.ReadJSON(&summary); err != nil {
+			t.Fatalf("failed to read summary: %v", err)
+		}
+	}
+	if summary.ID == "" {
+		t.Fatal("expected the summary to carry the analysis ID")
+	}
+
+	response, err := http.Get(server.URL + "/api/v1/analyses/" + summary.ID + ".csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(response.Body)
+	response.Body.Close()
+	if response.StatusCode != http.StatusOK || response.Header.Get("Content-Type") != "text/csv; charset=utf-8" {
+		t.Fatalf("unexpected response %s (%s): %s", response.Status, response.Header.Get("Content-Type"), body)
+	}
+	lines := strings.Split(strings.TrimSpace(string(body)), "\n")
+	if len(lines) != 8 || !strings.HasPrefix(lines[0], "game,white,black,ply,") || !strings.Contains(lines[7], ",Qxf7#,") {
+		t.Errorf("expected a header and 7 moves, got:\n%s", body)
+	}
+
+	response, err = http.Get(server.URL + "/api/v1/analyses/" + summary.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var game chessanalysis.GameAnalysis
+	err = json.NewDecoder(response.Body).Decode(&game)
+	response.Body.Close()
+	if err != nil || len(game.Moves) != 7 {
+		t.Errorf("expected the analysis as JSON, got %d moves (%v)", len(game.Moves), err)
+	}
+	if etag := response.Header.Get("ETag"); summary.Hash == "" || etag != `"`+summary.Hash+`"` {
+		t.Errorf("expected the ETag to be the summary's hash %q, got %q", summary.Hash, etag)
+	}
+
+	for _, test := range []struct {
+		path, ifNoneMatch string
+		status            int
+	}{
+		{"", `"` + summary.Hash + `"`, http.StatusNotModified},
+		{"", `"0123", W/"` + summary.Hash + `"`, http.StatusNotModified},
+		{"", `"0123"`, http.StatusOK},
+		{".csv", `"` + summary.Hash + `"`, http.StatusOK},
+		{".csv", `"` + summary.Hash + `-csv"`, http.StatusNotModified},
+	} {
+		request, _ := http.NewRequest(http.MethodGet, server.URL+"/api/v1/analyses/"+summary.ID+test.path, nil)
+		request.Header.Set("If-None-Match", test.ifNoneMatch)
+		response, err := http.DefaultClient.Do(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		response.Body.Close()
+		if response.StatusCode != test.status {
+			t.Errorf("expected %d for %q with If-None-Match %s, got %s", test.status, test.path, test.ifNoneMatch, response.Status)
+		}
+	}
+
+	response, err = http.Get(server.URL + "/api/v1/analyses/0123abcd.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown analysis, got %s", response.Status)
+	}
+}
+
+func TestAnalyzeREST(t *testing.T) {
+	server := newTestServer(t)
+	response, err := http.Post(server.URL+"/api/v1/analyze?depth=40", "application/x-chess-pgn", strings.NewReader(testPgn))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var game chessanalysis.GameAnalysis
+	err = json.NewDecoder(response.Body).Decode(&game)
+	response.Body.Close()
+	if err != nil || response.StatusCode != http.StatusOK || len(game.Moves) != 7 {
+		t.Fatalf("expected the analysis of 7 moves, got %s with %d moves (%v)", response.Status, len(game.Moves), err)
+	}
+	if game.Options.Depth != maxSyncAnalysisDepth {
+		t.Errorf("expected the depth capped at %d, got %d", maxSyncAnalysisDepth, game.Options.Depth)
+	}
+
+	location := response.Header.Get("Location")
+	if !strings.HasPrefix(location, "/api/v1/analyses/") {
+		t.Fatalf("expected the location of the stored analysis, got %q", location)
+	}
+	stored, err := http.Get(server.URL + location)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored.Body.Close()
+	if stored.StatusCode != http.StatusOK || stored.Header.Get("ETag") != response.Header.Get("ETag") {
+		t.Errorf("expected the stored analysis with ETag %s, got %s with %s", response.Header.Get("ETag"), stored.Status, stored.Header.Get("ETag"))
+	}
+
+	response, err = http.Post(server.URL+"/api/v1/analyze", "application/x-chess-pgn", strings.NewReader("1. e4 e5 2. Ke3 *"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400 for an illegal game, got %s", response.Status)
+	}
+}
+
+func TestAnalyzeStream(t *testing.T) {
+	server := newTestServer(t)
+	response, err := http.Post(server.URL+"/api/v1/analyze.ndjson?depth=14", "application/x-chess-pgn", strings.NewReader(testPgn))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK || response.Header.Get("Content-Type") != "application/x-ndjson" {
+		t.Fatalf("expected an NDJSON stream, got %s of %s", response.Status, response.Header.Get("Content-Type"))
+	}
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(body), "\n"), "\n")
+	if len(lines) != 8 {
+		t.Fatalf("expected 7 moves and the game, got %d lines", len(lines))
+	}
+	var move chessanalysis.MoveAnalysis
+	if err := json.Unmarshal([]byte(lines[0]), &move); err != nil || move.MoveText != "e4" {
+		t.Errorf("expected the analysis of e4 first, got %s (%v)", lines[0], err)
+	}
+	var game chessanalysis.GameAnalysis
+	if err := json.Unmarshal([]byte(lines[7]), &game); err != nil || len(game.Moves) != 7 || game.Options.Depth != 14 {
+		t.Errorf("expected the game analyzed to depth 14 last, got %s (%v)", lines[7], err)
+	}
+	location := response.Trailer.Get("Location")
+	if !strings.HasPrefix(location, "/api/v1/analyses/") || response.Trailer.Get("ETag") == "" {
+		t.Errorf("expected the location and ETag of the stored analysis in the trailers, got %v", response.Trailer)
+	}
+
+	response, err = http.Post(server.URL+"/api/v1/analyze.ndjson", "application/x-chess-pgn", strings.NewReader("1. e4 e5 2. Ke3 *"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400 for an illegal game, got %s", response.Status)
+	}
+}
+
+func TestAnalyzeSide(t *testing.T) {
+	app := NewApplication()
+	app.engineFactory = (&chessanalysis.FakeEngine{}).NewEngine
+	lichess := fakeLichess(t)
+	if err := app.applyConfig(&Config{OAuth: OAuthConfig{Lichess: &LichessOAuthConfig{ClientID: "test", URL: lichess.URL}}}); err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(app)
+	t.Cleanup(server.Close)
+	cookie := loginWithLichess(t, server)
+	pgn := strings.Replace(testPgn, "[Result", "[White \"Rival\"]\n[Black \"Coach\"]\n[Result", 1)
+	analyze := func(side string, session bool) *http.Response {
+		t.Helper()
+		request, _ := http.NewRequest(http.MethodPost, server.URL+"/api/v1/analyze?depth=4&side="+side, strings.NewReader(pgn))
+		if session {
+			request.AddCookie(cookie)
+		}
+		response, err := http.DefaultClient.Do(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { response.Body.Close() })
+		return response
+	}
+
+	var game chessanalysis.GameAnalysis
+	if err := json.NewDecoder(analyze("mine", true).Body).Decode(&game); err != nil || game.Options.Side != "Black" {
+		t.Fatalf("expected the logged in user's Black moves analyzed, got %+v (%v)", game.Options, err)
+	}
+	if !game.Moves[0].Skipped || game.Moves[1].Skipped || game.Summary.White.Moves != 0 {
+		t.Errorf("expected White's moves skipped, got %+v", game.Summary.White)
+	}
+	for _, test := range []struct {
+		side    string
+		session bool
+		want    int
+	}{
+		{"white", false, http.StatusOK},
+		{"mine", false, http.StatusUnauthorized},
+		{"White", false, http.StatusBadRequest},
+	} {
+		if response := analyze(test.side, test.session); response.StatusCode != test.want {
+			t.Errorf("%s: expected %d, got %s", test.side, test.want, response.Status)
+		}
+	}
+	pgn = testPgn
+	if response := analyze("mine", true); response.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400 for a game the user didn't play, got %s", response.Status)
+	}
+}
+
+func TestBatchJobs(t *testing.T) {
+	server := newTestServer(t)
+	games := strings.Replace(testPgn, `[Result "1-0"]`, `[White "Alice"]
+[Black "Bob"]
+[Result "1-0"]`, 1) + "\n\n" + testPgn
+	response, err := http.Post(server.URL+"/api/v1/jobs/batch?depth=4", "application/x-chess-pgn", strings.NewReader(games))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var status JobGroupStatus
+	json.NewDecoder(response.Body).Decode(&status)
+	response.Body.Close()
+	if response.StatusCode != http.StatusAccepted || len(status.Games) != 2 || response.Header.Get("Location") != "/api/v1/jobs/"+status.ID {
+		t.Fatalf("expected a job group of 2 games, got %s with %+v", response.Status, status)
+	}
+
+	deadline := time.Now().Add(10 * time.Second)
+	for status.Status != jobDone && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		response, err := http.Get(server.URL + "/api/v1/jobs/" + status.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		json.NewDecoder(response.Body).Decode(&status)
+		response.Body.Close()
+	}
+	if status.Status != jobDone || status.FinishedGames != 2 || status.AnalyzedPlies != 14 {
+		t.Fatalf("expected both games of 7 plies analyzed, got %+v", status)
+	}
+	first := status.Games[0]
+	if first.Status != jobDone || first.White != "Alice" || first.AnalysisID == "" {
+		t.Errorf("expected Alice's game stored, got %+v", first)
+	}
+	stored, err := http.Get(server.URL + "/api/v1/analyses/" + first.AnalysisID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored.Body.Close()
+	if stored.StatusCode != http.StatusOK {
+		t.Errorf("expected the game in the analyses API, got %s", stored.Status)
+	}
+
+	report := func(query string) (*http.Response, string) {
+		t.Helper()
+		response, err := http.Get(server.URL + "/api/v1/jobs/" + status.ID + "/report" + query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer response.Body.Close()
+		body, _ := io.ReadAll(response.Body)
+		return response, string(body)
+	}
+	if response, body := report(""); response.StatusCode != http.StatusOK || strings.Count(body, "\n") != 15 {
+		t.Errorf("expected a CSV header and 14 plies, got %s with %q", response.Status, body)
+	}
+	if response, body := report("?format=tournament-md"); response.StatusCode != http.StatusOK || !strings.Contains(body, "Alice") {
+		t.Errorf("expected a crosstable with Alice, got %s with %q", response.Status, body)
+	}
+	if response, _ := report("?format=docx"); response.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400 for an unknown format, got %s", response.Status)
+	}
+
+	screening, err := http.Get(server.URL + "/api/v1/jobs/" + status.ID + "/screening?player=alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var screen chessanalysis.ScreeningReport
+	json.NewDecoder(screening.Body).Decode(&screen)
+	screening.Body.Close()
+	if screening.StatusCode != http.StatusOK || screen.Disclaimer == "" || len(screen.Depths) != 1 || screen.Depths[0].Games != 1 {
+		t.Errorf("expected a screening report of Alice's game, got %s with %+v", screening.Status, screen)
+	}
+	if response, _ := http.Get(server.URL + "/api/v1/jobs/" + status.ID + "/screening"); response.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400 without a player, got %s", response.Status)
+	}
+
+	if response, _ := http.Get(server.URL + "/api/v1/jobs/0123"); response.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown job group, got %s", response.Status)
+	}
+	response, err = http.Post(server.URL+"/api/v1/jobs/batch", "application/x-chess-pgn", strings.NewReader(""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400 without games, got %s", response.Status)
+	}
+}
+
+func TestJobEngineLog(t *testing.T) {
+	app := NewApplication()
+	app.engineFactory = (&chessanalysis.FakeEngine{}).NewEngine
+	app.adminToken = "secret"
+	server := httptest.NewServer(app)
+	t.Cleanup(server.Close)
+	engineLog := func(id, token string) (*http.Response, string) {
+		t.Helper()
+		request, err := http.NewRequest(http.MethodGet, server.URL+"/api/v1/admin/jobs/"+id+"/engine-log", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if token != "" {
+			request.Header.Set("Authorization", "Bearer "+token)
+		}
+		response, err := http.DefaultClient.Do(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer response.Body.Close()
+		body, _ := io.ReadAll(response.Body)
+		return response, string(body)
+	}
+
+	response, err := http.Post(server.URL+"/api/v1/jobs/batch?depth=4", "application/x-chess-pgn", strings.NewReader(testPgn))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var status JobGroupStatus
+	json.NewDecoder(response.Body).Decode(&status)
+	response.Body.Close()
+	deadline := time.Now().Add(10 * time.Second)
+	for status.Status != jobDone && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		group, _ := app.jobs.get(status.ID)
+		status = group.status()
+	}
+	if status.Status != jobDone {
+		t.Fatalf("expected the batch to finish, got %+v", status)
+	}
+
+	if response, _ := engineLog(status.ID, ""); response.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected the engine log to need the admin token, got %s", response.Status)
+	}
+	response, transcript := engineLog(status.ID, "secret")
+	if response.StatusCode != http.StatusOK || response.Header.Get("X-Dropped-Lines") != "0" {
+		t.Fatalf("expected the whole engine log, got %s with %q dropped", response.Status, response.Header.Get("X-Dropped-Lines"))
+	}
+	if !strings.Contains(transcript, "\n> go depth 4") || !strings.Contains(transcript, "\n< bestmove ") {
+		t.Errorf("expected the searches in the engine log, got %q", transcript)
+	}
+	if response, _ := engineLog("abcdef", "secret"); response.StatusCode != http.StatusNotFound {
+		t.Errorf("expected an unknown job to be not found, got %s", response.Status)
+	}
+
+	log := newEngineLog(16)
+	for _, line := range []string{"> isready\n", "< readyok\n", "> go depth 1\n"} {
+		log.Write([]byte(line))
+	}
+	if kept, dropped := log.contents(); kept != "> go depth 1\n" || dropped != 2 {
+		t.Errorf("expected only the latest line to fit, got %q with %d dropped", kept, dropped)
+	}
+}
+
+func TestReanalyze(t *testing.T) {
+	server := newTestServer(t)
+	response, err := http.Post(server.URL+"/api/v1/analyze?depth=4", "application/x-chess-pgn", strings.NewReader(testPgn))
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	location, original := response.Header.Get("Location"), response.Header.Get("ETag")
+	reanalyze := func(body, ifMatch string) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodPost, server.URL+location+"/reanalyze", strings.NewReader(body))
+		if ifMatch != "" {
+			req.Header.Set("If-Match", ifMatch)
+		}
+		response, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return response
+	}
+
+	response = reanalyze(`{"depth": 6}`, original)
+	var game chessanalysis.GameAnalysis
+	json.NewDecoder(response.Body).Decode(&game)
+	response.Body.Close()
+	if response.StatusCode != http.StatusOK || game.Options.Depth != 6 || response.Header.Get("ETag") == original {
+		t.Fatalf("expected a new version at depth 6, got %s at depth %d", response.Status, game.Options.Depth)
+	}
+	if got := response.Header.Get("Content-Location"); got != location+"/versions/2" {
+		t.Errorf("expected the new version's location, got %q", got)
+	}
+	current, err := http.Get(server.URL + location)
+	if err != nil {
+		t.Fatal(err)
+	}
+	current.Body.Close()
+	if current.Header.Get("ETag") != response.Header.Get("ETag") {
+		t.Errorf("expected the stored analysis replaced, got ETag %s", current.Header.Get("ETag"))
+	}
+
+	// The replaced version is still there to compare with
+	versionsResponse, err := http.Get(server.URL + location + "/versions")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var versions []AnalysisVersion
+	json.NewDecoder(versionsResponse.Body).Decode(&versions)
+	versionsResponse.Body.Close()
+	if len(versions) != 2 || versions[0].Depth != 4 || versions[0].Current || !versions[1].Current {
+		t.Errorf("expected versions at depth 4 and then 6, got %+v", versions)
+	}
+	first, err := http.Get(server.URL + location + "/versions/1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	first.Body.Close()
+	if first.StatusCode != http.StatusOK || first.Header.Get("ETag") != original {
+		t.Errorf("expected the first version with ETag %s, got %s with %s", original, first.Status, first.Header.Get("ETag"))
+	}
+
+	if response := reanalyze(`{"depth": 8}`, original); response.StatusCode != http.StatusPreconditionFailed {
+		t.Errorf("expected 412 re-analyzing a replaced version, got %s", response.Status)
+	}
+	if response := reanalyze(`{"classifier": "nonsense"}`, ""); response.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400 for an unknown classifier, got %s", response.Status)
+	}
+	response = reanalyze(`{"ratingScaling": true}`, "")
+	game = chessanalysis.GameAnalysis{}
+	json.NewDecoder(response.Body).Decode(&game)
+	response.Body.Close()
+	if thresholds := game.Options.RatedThresholds; len(thresholds) != 2 || thresholds[0].Rating != 0 || thresholds[0].Blunder != 0.2 {
+		t.Errorf("expected the club thresholds for players without ratings, got %+v", thresholds)
+	}
+
+	pgn, err := http.Get(server.URL + location + ".pgn")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(pgn.Body)
+	pgn.Body.Close()
+	if pgn.StatusCode != http.StatusOK || !strings.Contains(string(body), "Qxf7#") {
+		t.Errorf("expected the annotated PGN, got %s with %q", pgn.Status, body)
+	}
+}
+
+func TestAnalysisDiff(t *testing.T) {
+	server := newTestServer(t)
+	analyze := func(pgn string) (string, chessanalysis.GameAnalysis) {
+		t.Helper()
+		response, err := http.Post(server.URL+"/api/v1/analyze?depth=4", "application/x-chess-pgn", strings.NewReader(pgn))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer response.Body.Close()
+		var game chessanalysis.GameAnalysis
+		json.NewDecoder(response.Body).Decode(&game)
+		return response.Header.Get("Location"), game
+	}
+	getDiff := func(path string) (*http.Response, chessanalysis.AnalysisDiff) {
+		t.Helper()
+		response, err := http.Get(server.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer response.Body.Close()
+		var diff chessanalysis.AnalysisDiff
+		json.NewDecoder(response.Body).Decode(&diff)
+		return response, diff
+	}
+
+	location, shallow := analyze(testPgn)
+	response, err := http.Post(server.URL+location+"/reanalyze", "application/json", strings.NewReader(`{"depth": 6}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var deep chessanalysis.GameAnalysis
+	json.NewDecoder(response.Body).Decode(&deep)
+	response.Body.Close()
+
+	response, diff := getDiff(location + "/diff?version=1")
+	if response.StatusCode != http.StatusOK || diff.Left.Depth != 4 || diff.Right.Depth != 6 || len(diff.Moves) != 7 {
+		t.Fatalf("expected a diff of depth 4 with depth 6, got %s with %+v", response.Status, diff)
+	}
+	if diff.Moves[6].Move != "4. Qxf7#" || diff.Flips != 0 {
+		t.Errorf("unexpected moves %+v", diff.Moves)
+	}
+	if response, _ := getDiff(location + "/diff?version=9"); response.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404 for a version not kept, got %s", response.Status)
+	}
+
+	other, _ := analyze("[Event \"Other\"]\n\n1. d4 d5 2. c4 *")
+	if response, _ := getDiff(location + "/diff?with=" + strings.TrimPrefix(other, "/api/v1/analyses/")); response.StatusCode != http.StatusUnprocessableEntity {
+		t.Errorf("expected 422 diffing different games, got %s", response.Status)
+	}
+
+	body, err := json.Marshal(DiffRequest{Left: &shallow, Right: &deep})
+	if err != nil {
+		t.Fatal(err)
+	}
+	response, err = http.Post(server.URL+"/api/v1/diff", "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	diff = chessanalysis.AnalysisDiff{}
+	json.NewDecoder(response.Body).Decode(&diff)
+	response.Body.Close()
+	if response.StatusCode != http.StatusOK || diff.Left.Depth != 4 || diff.Right.Depth != 6 || len(diff.Moves) != 7 {
+		t.Errorf("expected a diff of the posted analyses, got %s with %+v", response.Status, diff)
+	}
+	response, err = http.Post(server.URL+"/api/v1/diff", "application/json", strings.NewReader(`{"left": {}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400 without a right analysis, got %s", response.Status)
+	}
+}
+
+func TestAnalysisGate(t *testing.T) {
+	server := newTestServer(t)
+	response, err := http.Post(server.URL+"/api/v1/analyze?depth=4", "application/x-chess-pgn", strings.NewReader(testPgn))
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	location := response.Header.Get("Location")
+	gate := func(query string) (*http.Response, chessanalysis.GateResult) {
+		t.Helper()
+		response, err := http.Get(server.URL + location + "/gate?" + query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer response.Body.Close()
+		var result chessanalysis.GateResult
+		json.NewDecoder(response.Body).Decode(&result)
+		return response, result
+	}
+
+	if response, result := gate("maxBlunders=0"); response.StatusCode != http.StatusOK || !result.Pass {
+		t.Errorf("expected a game without blunders to pass, got %s with %+v", response.Status, result)
+	}
+	response, result := gate("minAccuracy=101&color=Black")
+	if response.StatusCode != http.StatusOK || result.Pass || len(result.Failures) != 1 || result.Failures[0].Color != "Black" {
+		t.Errorf("expected Black to fail an impossible accuracy, got %s with %+v", response.Status, result)
+	}
+	for _, query := range []string{"color=white", "maxBlunders=none"} {
+		if response, _ := gate(query); response.StatusCode != http.StatusBadRequest {
+			t.Errorf("expected 400 for %s, got %s", query, response.Status)
+		}
+	}
+}
+
+func TestCompactAnalysisJSON(t *testing.T) {
+	server := newTestServer(t)
+	response, err := http.Post(server.URL+"/api/v1/analyze?depth=4", "application/x-chess-pgn", strings.NewReader(testPgn))
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	location := response.Header.Get("Location")
+	get := func(query string) (*http.Response, map[string]json.RawMessage) {
+		t.Helper()
+		response, err := http.Get(server.URL + location + "?" + query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer response.Body.Close()
+		var game map[string]json.RawMessage
+		json.NewDecoder(response.Body).Decode(&game)
+		return response, game
+	}
+
+	response, game := get("compact=true&fields=moveText,classification,whiteDrawProb")
+	var moves []map[string]any
+	if err := json.Unmarshal(game["moves"], &moves); err != nil || len(moves) != 7 {
+		t.Fatalf("expected 7 moves, got %s (%v)", game["moves"], err)
+	}
+	if len(moves[0]) != 2 || moves[0]["m"] != "e4" || moves[0]["cl"] == nil {
+		t.Errorf("expected only the short move text and classification, got %v", moves[0])
+	}
+	if response.Header.Get("ETag") != "" || game["summary"] == nil {
+		t.Errorf("expected the full summary without an ETag, got %q and %s", response.Header.Get("ETag"), game["summary"])
+	}
+	for _, query := range []string{"compact=maybe", "fields=moveText,nope"} {
+		if response, _ := get(query); response.StatusCode != http.StatusBadRequest {
+			t.Errorf("expected 400 for %s, got %s", query, response.Status)
+		}
+	}
+}
+
+func TestListAnalyses(t *testing.T) {
+	server := newTestServer(t)
+	for _, game := range [][3]string{{"Ann", "Bob", "2024.03.01"}, {"Bob", "Ann", "2024.05.20"}, {"Cat", "Dan", "????.??.??"}} {
+		tags := fmt.Sprintf("[White %q]\n[Black %q]\n[Date %q]\n", game[0], game[1], game[2])
+		pgn := strings.Replace(testPgn, "[Result", tags+"[Result", 1)
+		response, err := http.Post(server.URL+"/api/v1/analyze?depth=4", "application/x-chess-pgn", strings.NewReader(pgn))
+		if err != nil {
+			t.Fatal(err)
+		}
+		response.Body.Close()
+	}
+	list := func(query string) (*http.Response, AnalysisPage) {
+		t.Helper()
+		response, err := http.Get(server.URL + "/api/v1/analyses?" + query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer response.Body.Close()
+		var page AnalysisPage
+		json.NewDecoder(response.Body).Decode(&page)
+		return response, page
+	}
+
+	_, page := list("limit=2")
+	if page.Total != 3 || len(page.Analyses) != 2 || page.NextOffset != 2 || page.Analyses[0].White != "Cat" {
+		t.Fatalf("expected the two newest of 3 analyses, got %+v", page)
+	}
+	_, page = list("limit=2&offset=2")
+	if len(page.Analyses) != 1 || page.NextOffset != 0 || page.Analyses[0].White != "Ann" {
+		t.Errorf("expected the oldest analysis on the last page, got %+v", page)
+	}
+	_, page = list("player=ann&from=2024-04-01")
+	if page.Total != 1 || page.Analyses[0].Date != "2024.05.20" {
+		t.Errorf("expected Ann's game from May, got %+v", page)
+	}
+	if _, page = list("result=0-1"); page.Total != 0 || page.Analyses == nil {
+		t.Errorf("expected an empty list, got %+v", page)
+	}
+	if _, page = list("q=DAN"); page.Total != 1 || page.Analyses[0].Black != "Dan" {
+		t.Errorf("expected to find Dan's game, got %+v", page)
+	}
+	for _, query := range []string{"limit=0", "offset=-1", "from=March", "result=win", "minAccuracy=101", "classification=Awful", "classification=Blunder:0"} {
+		if response, _ := list(query); response.StatusCode != http.StatusBadRequest {
+			t.Errorf("expected 400 for %s, got %s", query, response.Status)
+		}
+	}
+}
+
+func TestAnalysisNotes(t *testing.T) {
+	server := newTestServer(t)
+	response, err := http.Post(server.URL+"/api/v1/analyze?depth=4", "application/x-chess-pgn", strings.NewReader(testPgn))
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	location := response.Header.Get("Location")
+	put := func(body string) (*http.Response, AnalysisNotes) {
+		t.Helper()
+		request, _ := http.NewRequest(http.MethodPut, server.URL+location+"/notes", strings.NewReader(body))
+		response, err := http.DefaultClient.Do(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer response.Body.Close()
+		var notes AnalysisNotes
+		json.NewDecoder(response.Body).Decode(&notes)
+		return response, notes
+	}
+
+	_, notes := put(`{"tags": ["Endgame training", " rook endings ", "endgame TRAINING", ""], "notes": "Went for Qh5 too early"}`)
+	if !slices.Equal(notes.Tags, []string{"Endgame training", "rook endings"}) {
+		t.Errorf("expected the tags trimmed without repeats, got %q", notes.Tags)
+	}
+	response, err = http.Get(server.URL + location + "/notes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got AnalysisNotes
+	json.NewDecoder(response.Body).Decode(&got)
+	response.Body.Close()
+	if got.Notes != "Went for Qh5 too early" || len(got.Tags) != 2 {
+		t.Errorf("expected the notes back, got %+v", got)
+	}
+	for query, want := range map[string]int{"tag=Rook+Endings": 1, "tag=rook+endings&tag=openings": 0, "q=qh5+too": 1} {
+		response, err := http.Get(server.URL + "/api/v1/analyses?" + query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var page AnalysisPage
+		json.NewDecoder(response.Body).Decode(&page)
+		response.Body.Close()
+		if page.Total != want {
+			t.Errorf("%s: expected %d analyses, got %+v", query, want, page)
+		}
+	}
+
+	if response, _ := put(`{"tags": ["` + strings.Repeat("x", maxAnalysisTagLen+1) + `"]}`); response.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected a long tag to be refused, got %s", response.Status)
+	}
+	request, _ := http.NewRequest(http.MethodPut, server.URL+"/api/v1/analyses/0123/notes", strings.NewReader(`{}`))
+	if response, err = http.DefaultClient.Do(request); err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown analysis, got %s", response.Status)
+	}
+}
+
+// fakeLichess serves the OAuth and study endpoints of Lichess for the user
+// "coach", who has a study with the ID "Study123" of a chapter with a
+// sideline
+func fakeLichess(t *testing.T) *httptest.Server {
+	t.Helper()
+	routes := http.NewServeMux()
+	routes.HandleFunc("POST /api/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.PostFormValue("code") != "good-code" || r.PostFormValue("code_verifier") == "" {
+			http.Error(w, "bad code", http.StatusBadRequest)
+			return
+		}
+		fmt.Fprint(w, `{"token_type": "Bearer", "access_token": "token"}`)
+	})
+	routes.HandleFunc("DELETE /api/token", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	routes.HandleFunc("GET /api/account", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			http.Error(w, "no token", http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(w, `{"id": "coach", "username": "Coach"}`)
+	})
+	routes.HandleFunc("POST /api/study/{study}/import-pgn", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" || r.PathValue("study") != "Study123" {
+			http.Error(w, "not your study", http.StatusForbidden)
+			return
+		}
+		pgn := r.PostFormValue("pgn")
+		if !strings.Contains(pgn, "[%eval") || !strings.Contains(pgn, "Qxf7#") {
+			http.Error(w, "expected an annotated PGN", http.StatusBadRequest)
+			return
+		}
+		fmt.Fprintf(w, `{"id": "Study123", "chapters": [{"id": "Chap4567", "name": %q}]}`, r.PostFormValue("name"))
+	})
+	routes.HandleFunc("GET /api/study/{file}", func(w http.ResponseWriter, r *http.Request) {
+		if r.PathValue("file") != "Study123.pgn" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, strings.Replace(testPgn, "2. Qh5 Nc6", "2. Qh5 (2. Nf3 Nc6) 2... Nc6", 1))
+	})
+	server := httptest.NewServer(routes)
+	t.Cleanup(server.Close)
+	return server
+}
+
+// loginWithLichess logs in to the server as the fake Lichess user, returning
+// the session cookie
+func loginWithLichess(t *testing.T, server *httptest.Server) *http.Cookie {
+	t.Helper()
+	client := loginClient()
+	response, err := client.Get(server.URL + "/auth/lichess")
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	redirect, _ := url.Parse(response.Header.Get("Location"))
+	response, err = client.Get(server.URL + "/auth/lichess/callback?code=good-code&state=" + redirect.Query().Get("state"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if cookie := responseCookie(response, sessionCookie); cookie != nil {
+		return cookie
+	}
+	t.Fatalf("expected a session cookie, got %s", response.Status)
+	return nil
+}
+
+// loginClient returns a client that keeps cookies, as the browser logging in
+// does, and stops at redirects
+func loginClient() *http.Client {
+	jar, _ := cookiejar.New(nil)
+	return &http.Client{Jar: jar, CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+}
+
+// responseCookie returns the cookie of the name the response sets, or nil
+func responseCookie(response *http.Response, name string) *http.Cookie {
+	for _, cookie := range response.Cookies() {
+		if cookie.Name == name {
+			return cookie
+		}
+	}
+	return nil
+}
+
+func TestStudyExport(t *testing.T) {
+	app := NewApplication()
+	app.engineFactory = (&chessanalysis.FakeEngine{}).NewEngine
+	lichess := fakeLichess(t)
+	if err := app.applyConfig(&Config{OAuth: OAuthConfig{Lichess: &LichessOAuthConfig{ClientID: "test", URL: lichess.URL}}}); err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(app)
+	t.Cleanup(server.Close)
+	response, err := http.Post(server.URL+"/api/v1/analyze?depth=4", "application/x-chess-pgn", strings.NewReader(testPgn))
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	location := response.Header.Get("Location")
+	cookie := loginWithLichess(t, server)
+	export := func(body string, session bool) *http.Response {
+		t.Helper()
+		request, _ := http.NewRequest(http.MethodPost, server.URL+location+"/lichess-study", strings.NewReader(body))
+		if session {
+			request.AddCookie(cookie)
+		}
+		response, err := http.DefaultClient.Do(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { response.Body.Close() })
+		return response
+	}
+
+	var chapter StudyChapter
+	json.NewDecoder(export(`{"study": "`+lichess.URL+`/study/Study123/Older123"}`, true).Body).Decode(&chapter)
+	if chapter.URL != lichess.URL+"/study/Study123/Chap4567" || chapter.Name != "? - ?" {
+		t.Errorf("expected the new chapter, got %+v", chapter)
+	}
+	for _, test := range []struct {
+		body    string
+		session bool
+		want    int
+	}{
+		{`{"study": "Study123"}`, false, http.StatusUnauthorized},
+		{`{"study": "Other123"}`, true, http.StatusForbidden},
+		{`{"study": "not a study"}`, true, http.StatusBadRequest},
+		{`{"study": "Study123", "orientation": "sideways"}`, true, http.StatusBadRequest},
+	} {
+		if response := export(test.body, test.session); response.StatusCode != test.want {
+			t.Errorf("%s: expected %d, got %s", test.body, test.want, response.Status)
+		}
+	}
+}
+
+func TestStudyImport(t *testing.T) {
+	app := NewApplication()
+	app.engineFactory = (&chessanalysis.FakeEngine{}).NewEngine
+	lichess := fakeLichess(t)
+	if err := app.applyConfig(&Config{OAuth: OAuthConfig{Lichess: &LichessOAuthConfig{ClientID: "test", URL: lichess.URL}}}); err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(app)
+	t.Cleanup(server.Close)
+	importStudy := func(study string) *http.Response {
+		t.Helper()
+		response, err := http.Post(server.URL+"/api/v1/jobs/lichess-study?depth=4", "application/json", strings.NewReader(`{"study": "`+study+`"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { response.Body.Close() })
+		return response
+	}
+
+	response := importStudy(lichess.URL + "/study/Study123")
+	var status JobGroupStatus
+	json.NewDecoder(response.Body).Decode(&status)
+	if response.StatusCode != http.StatusAccepted || len(status.Games) != 1 {
+		t.Fatalf("expected a job group of 1 chapter, got %s with %+v", response.Status, status)
+	}
+	deadline := time.Now().Add(10 * time.Second)
+	for status.Status != jobDone && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		response, err := http.Get(server.URL + "/api/v1/jobs/" + status.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		json.NewDecoder(response.Body).Decode(&status)
+		response.Body.Close()
+	}
+	if status.Status != jobDone || status.Games[0].AnalysisID == "" {
+		t.Fatalf("expected the chapter analyzed, got %+v", status)
+	}
+	stored, err := http.Get(server.URL + "/api/v1/analyses/" + status.Games[0].AnalysisID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stored.Body.Close()
+	var game chessanalysis.GameAnalysis
+	if err := json.NewDecoder(stored.Body).Decode(&game); err != nil {
+		t.Fatal(err)
+	}
+	if len(game.Moves) != 7 || len(game.Variations) != 1 || game.Variations[0].Ply != 2 || len(game.Variations[0].Moves) != 2 {
+		t.Errorf("expected 7 moves and the sideline 2. Nf3 Nc6, got %d moves and %+v", len(game.Moves), game.Variations)
+	}
+
+	if response := importStudy("Missing1"); response.StatusCode != http.StatusBadGateway {
+		t.Errorf("expected 502 for a study Lichess doesn't have, got %s", response.Status)
+	}
+	if response := importStudy("not a study"); response.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400 for an invalid study, got %s", response.Status)
+	}
+}
+
+func TestLichessLogin(t *testing.T) {
+	app := NewApplication()
+	app.engineFactory = (&chessanalysis.FakeEngine{}).NewEngine
+	lichess := fakeLichess(t)
+	if err := app.applyConfig(&Config{OAuth: OAuthConfig{Lichess: &LichessOAuthConfig{ClientID: "test", URL: lichess.URL}}}); err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(app)
+	t.Cleanup(server.Close)
+	client := loginClient()
+
+	response, err := client.Get(server.URL + "/auth/lichess")
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if cookie := responseCookie(response, loginStateCookie); cookie == nil || !cookie.HttpOnly || cookie.Secure {
+		t.Fatalf("expected an HttpOnly login state cookie for plain HTTP, got %v", response.Cookies())
+	}
+	redirect, err := url.Parse(response.Header.Get("Location"))
+	if err != nil || !strings.HasPrefix(redirect.String(), lichess.URL+"/oauth?") || redirect.Query().Get("code_challenge_method") != "S256" ||
+		redirect.Query().Get("scope") != "study:write" {
+		t.Fatalf("expected a redirect to log in with PKCE, got %q", redirect)
+	}
+	state := redirect.Query().Get("state")
+	// Another browser, such as one lured to the callback, can't finish it
+	other := &http.Client{CheckRedirect: client.CheckRedirect}
+	if response, err = other.Get(server.URL + "/auth/lichess/callback?code=good-code&state=" + state); err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusBadRequest || responseCookie(response, sessionCookie) != nil {
+		t.Fatalf("expected a callback without the login state cookie refused, got %s", response.Status)
+	}
+	response, err = client.Get(server.URL + "/auth/lichess/callback?code=good-code&state=" + state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	session := responseCookie(response, sessionCookie)
+	if response.StatusCode != http.StatusFound || session == nil || !session.HttpOnly || session.Secure {
+		t.Fatalf("expected a session cookie, got %s %v", response.Status, response.Cookies())
+	}
+	cookies := []*http.Cookie{session}
+	// Logins are used once
+	if response, err = client.Get(server.URL + "/auth/lichess/callback?code=good-code&state=" + state); err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected a second callback refused, got %s", response.Status)
+	}
+
+	do := func(method, path string, body string, session bool) *http.Response {
+		t.Helper()
+		request, _ := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+		if session {
+			request.AddCookie(cookies[0])
+		}
+		response, err := other.Do(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { response.Body.Close() })
+		return response
+	}
+	var status AccountStatus
+	json.NewDecoder(do(http.MethodGet, "/api/v1/account", "", true).Body).Decode(&status)
+	if status.Account == nil || status.Account.ID != "lichess:coach" || status.Account.Name != "Coach" {
+		t.Errorf("expected to be logged in as Coach, got %+v", status)
+	}
+
+	if response := do(http.MethodPost, "/api/v1/analyze?depth=4&private=true", testPgn, false); response.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected private analyses to need a login, got %s", response.Status)
+	}
+	location := do(http.MethodPost, "/api/v1/analyze?depth=4&private=true", testPgn, true).Header.Get("Location")
+	if response := do(http.MethodGet, location, "", false); response.StatusCode != http.StatusNotFound {
+		t.Errorf("expected a private analysis hidden from others, got %s", response.Status)
+	}
+	if response := do(http.MethodGet, location, "", true); response.StatusCode != http.StatusOK {
+		t.Errorf("expected a private analysis shown to its owner, got %s", response.Status)
+	}
+	public := do(http.MethodPost, "/api/v1/analyze?depth=4", testPgn, true).Header.Get("Location")
+	if response := do(http.MethodPut, public+"/notes", `{"notes": "mine"}`, false); response.StatusCode != http.StatusForbidden {
+		t.Errorf("expected others kept from changing the notes, got %s", response.Status)
+	}
+	for _, test := range []struct {
+		query   string
+		session bool
+		want    int
+	}{{"", false, 1}, {"", true, 2}, {"mine=true", true, 2}} {
+		var page AnalysisPage
+		json.NewDecoder(do(http.MethodGet, "/api/v1/analyses?"+test.query, "", test.session).Body).Decode(&page)
+		if page.Total != test.want {
+			t.Errorf("%q logged in %t: expected %d analyses, got %+v", test.query, test.session, test.want, page)
+		}
+	}
+
+	if response := do(http.MethodPost, "/auth/logout", "", true); response.StatusCode != http.StatusNoContent {
+		t.Errorf("expected to log out, got %s", response.Status)
+	}
+	json.NewDecoder(do(http.MethodGet, "/api/v1/account", "", true).Body).Decode(&status)
+	if status.Account != nil || !slices.Equal(status.Providers, []string{"lichess"}) {
+		t.Errorf("expected to be logged out, got %+v", status)
+	}
+
+	// Behind a proxy that terminates TLS, the redirect URL says cookies are
+	// only sent back over HTTPS
+	config := &LichessOAuthConfig{ClientID: "test", URL: lichess.URL, RedirectURL: "https://analyzer.example/auth/lichess/callback"}
+	if err := app.applyConfig(&Config{OAuth: OAuthConfig{Lichess: config}}); err != nil {
+		t.Fatal(err)
+	}
+	if cookie := responseCookie(do(http.MethodGet, "/auth/lichess", "", false), loginStateCookie); cookie == nil || !cookie.Secure {
+		t.Errorf("expected a secure login state cookie, got %v", cookie)
+	}
+}
+
+func TestHistoryFilter(t *testing.T) {
+	game := &chessanalysis.GameAnalysis{
+		Headers: map[string]string{"White": "Ann", "Black": "Bob", "Event": "Club Championship", "ECO": "B92"},
+		Moves: []chessanalysis.MoveAnalysis{
+			{Color: "White", Classification: chessanalysis.Blunder},
+			{Color: "Black", Classification: chessanalysis.Blunder},
+			{Color: "White", Classification: chessanalysis.Blunder},
+			{Color: "Black", Classification: chessanalysis.Good},
+		},
+	}
+	for query, want := range map[string]bool{
+		"event=championship":                      true,
+		"event=open":                              false,
+		"eco=b9":                                  true,
+		"eco=C":                                   false,
+		"q=club":                                  true,
+		"classification=Blunder:3":                true,
+		"classification=Blunder:4":                false,
+		"player=Ann&classification=Blunder:2":     true,
+		"player=Bob&classification=Blunder:2":     false,
+		"player=Bob&classification=Good":          true,
+		"classification=Good&classification=Best": false,
+	} {
+		values, _ := url.ParseQuery(query)
+		filter, err := parseHistoryFilter(values, nil)
+		if err != nil {
+			t.Fatalf("%s: %v", query, err)
+		}
+		if got := filter.matches(storedAnalysis{game: game}); got != want {
+			t.Errorf("%s: expected %t, got %t", query, want, got)
+		}
+	}
+}
+
+func TestNoScriptPage(t *testing.T) {
+	server := newTestServer(t)
+	response, err := http.Get(server.URL + "/noscript")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(response.Body)
+	response.Body.Close()
+	if response.StatusCode != http.StatusOK || !strings.Contains(string(body), `<form method="post"`) {
+		t.Fatalf("expected the form, got %s:\n%s", response.Status, body)
+	}
+
+	pgn := strings.Replace(testPgn, `[Event "Scholar's Mate"]`, `[Event "Scholar's Mate"]
+[White "<script>alert(1)</script>"]`, 1)
+	response, err = http.PostForm(server.URL+"/noscript", url.Values{"pgn": {pgn}, "depth": {"4"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ = io.ReadAll(response.Body)
+	response.Body.Close()
+	page := string(body)
+	if response.StatusCode != http.StatusOK || !strings.Contains(page, "4. Qxf7#") || !strings.Contains(page, "3... Nf6") {
+		t.Fatalf("expected the move table, got %s:\n%s", response.Status, page)
+	}
+	if strings.Contains(page, "<script>") || !strings.Contains(page, "&lt;script&gt;alert(1)&lt;/script&gt;") {
+		t.Errorf("expected the game's tags escaped, got:\n%s", page)
+	}
+
+	response, err = http.PostForm(server.URL+"/noscript", url.Values{"pgn": {"1. e4 e5 2. Ke3 *"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ = io.ReadAll(response.Body)
+	response.Body.Close()
+	if !strings.Contains(string(body), `class="error"`) || !strings.Contains(string(body), "Ke3") {
+		t.Errorf("expected the error with the PGN kept in the form, got:\n%s", body)
+	}
+}
+
+func TestNoScriptMoves(t *testing.T) {
+	moves := []chessanalysis.MoveAnalysis{
+		{MoveNumber: 1, Color: "White", MoveText: "e4", IsBestMove: true, Classification: chessanalysis.Best},
+		{
+			MoveNumber: 1, Color: "Black", MoveText: "f6", Classification: chessanalysis.Blunder,
+			FENBefore: "rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq - 0 1",
+			BestMove:  "e7e5", BestMoveSAN: "e5",
+			Hints: chessanalysis.MoveHints{Played: &chessanalysis.BoardArrow{From: "f7", To: "f6"}},
+		},
+	}
+	rows := noScriptMoves(moves)
+	if rows[0].Best != "" || rows[0].Diagram != "" {
+		t.Errorf("expected no best move or diagram for the best move, got %+v", rows[0])
+	}
+	if rows[1].Label != "1... f6" || rows[1].Best != "e5" || rows[1].Symbol != "??" {
+		t.Errorf("expected the blunder with its best move, got %+v", rows[1])
+	}
+	query, err := url.ParseQuery(strings.TrimPrefix(rows[1].Diagram, "api/v1/board.svg?"))
+	if err != nil || query.Get("fen") != moves[1].FENBefore || query.Get("arrows") != "last:f7f6,best:e7e5" || query.Get("orientation") != "Black" {
+		t.Errorf("expected a diagram of the position before the blunder from Black's side, got %q", rows[1].Diagram)
+	}
+}
+
+func TestWebsocketSecondOpinion(t *testing.T) {
+	app := NewApplication()
+	app.engineFactory = (&chessanalysis.FakeEngine{}).NewEngine
+	app.secondOpinion = (&chessanalysis.FakeEngine{}).NewEngine
+	server := httptest.NewServer(app)
+	t.Cleanup(server.Close)
+	conn := dialTestServer(t, server)
+
+	if err := conn.WriteJSON(Message{Type: "analyze", PGN: testPgn, Depth: 4}); err != nil {
+		t.Fatalf("failed to send analyze message: %v", err)
+	}
+	for i := 0; i < 7; i++ {
+		var response Message
+		if err := conn.ReadJSON(&response); err != nil {
+			t.Fatalf("failed to read analysis %d: %v", i+1, err)
+		}
+		var move chessanalysis.MoveAnalysis
+		if err := json.Unmarshal([]byte(response.Text), &move); err != nil {
+			t.Fatalf("failed to decode analysis %d: %v (%s)", i+1, err, response.Text)
+		}
+		// The same engine twice never disagrees with itself
+		if move.SecondOpinion == nil || move.SecondOpinion.Disagrees || move.SecondOpinion.WhiteScore != move.WhiteScore {
+			t.Errorf("expected an agreeing second opinion of %s, got %+v", move.MoveText, move.SecondOpinion)
+		}
+	}
+}
+
+func TestWebsocketAnalysisRefinement(t *testing.T) {
+	conn := dialTestServer(t, newTestServer(t))
+
+	if err := conn.WriteJSON(Message{Type: "analyze", PGN: testPgn, Depth: 10}); err != nil {
+		t.Fatalf("failed to send analyze message: %v", err)
+	}
+
+	analyzed, refined, summaries := 0, 0, 0
+	for summaries < 2 {
+		var response Message
+		if err := conn.ReadJSON(&response); err != nil {
+			t.Fatalf("failed to read message: %v", err)
+		}
+		var move chessanalysis.MoveAnalysis
+		switch response.Type {
+		case "analysis":
+			if err := json.Unmarshal([]byte(response.Text), &move); err != nil || move.Depth != quickAnalysisDepth {
+				t.Fatalf("expected a quick analysis, got %s (%v)", response.Text, err)
+			}
+			analyzed++
+		case "refined":
+			if err := json.Unmarshal([]byte(response.Text), &move); err != nil || move.Depth != 10 {
+				t.Fatalf("expected a refined analysis, got %s (%v)", response.Text, err)
+			}
+			refined++
+			if refined > analyzed {
+				t.Fatalf("refined move %d was sent before its first analysis", refined)
+			}
+		case "summary":
+			var game chessanalysis.GameAnalysis
+			if err := json.Unmarshal([]byte(response.Text), &game); err != nil {
+				t.Fatalf("failed to decode summary: %v", err)
+			}
+			summaries++
+			if want := map[int]int{1: quickAnalysisDepth, 2: 10}[summaries]; game.Options.Depth != want {
+				t.Errorf("expected summary %d at depth %d, got %d", summaries, want, game.Options.Depth)
+			}
+		default:
+			t.Fatalf("unexpected %q message: %s", response.Type, response.Text)
+		}
+	}
+	if analyzed != 7 || refined != 7 {
+		t.Errorf("expected every move analyzed and refined, got %d and %d", analyzed, refined)
+	}
+}
+
+func TestWebsocketKibitz(t *testing.T) {
+	conn := dialTestServer(t, newTestServer(t))
+
+	const fen = "rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq e3 0 1"
+	if err := conn.WriteJSON(Message{Type: "kibitz", Text: fen, Depth: 3}); err != nil {
+		t.Fatalf("failed to send kibitz message: %v", err)
+	}
+
+	for depth := 1; ; depth++ {
+		var response Message
+		if err := conn.ReadJSON(&response); err != nil {
+			t.Fatalf("failed to read message: %v", err)
+		}
+		var update chessanalysis.KibitzUpdate
+		if response.Type != "kibitz" || json.Unmarshal([]byte(response.Text), &update) != nil {
+			t.Fatalf("expected a kibitz update, got %q message: %s", response.Type, response.Text)
+		}
+		if update.FEN != fen {
+			t.Errorf("expected an update for %s, got one for %s", fen, update.FEN)
+		}
+		if update.Final {
+			if update.Depth != 3 {
+				t.Errorf("expected the search to finish at depth 3, got %d", update.Depth)
+			}
+			break
+		}
+		if update.Depth != depth {
+			t.Fatalf("expected an update at depth %d, got %d", depth, update.Depth)
+		}
+	}
+
+	if err := conn.WriteJSON(Message{Type: "kibitz", Text: "not a position"}); err != nil {
+		t.Fatalf("failed to send kibitz message: %v", err)
+	}
+	var response Message
+	if err := conn.ReadJSON(&response); err != nil {
+		t.Fatalf("failed to read response: %v", err)
+	}
+	if response.Type != "kibitz-error" {
+		t.Errorf("expected a kibitz error, got %q message: %s", response.Type, response.Text)
+	}
+}
+
+func TestWebsocketEvals(t *testing.T) {
+	conn := dialTestServer(t, newTestServer(t))
+
+	// kibitzUntilFinal kibitzes the position and returns the evaluations sent
+	// until the kibitzer's search finished
+	kibitzUntilFinal := func(fen string) []chessanalysis.EvalBar {
+		t.Helper()
+		if err := conn.WriteJSON(Message{Type: "kibitz", Text: fen, Depth: 3, BoardID: "bar"}); err != nil {
+			t.Fatalf("failed to send kibitz message: %v", err)
+		}
+		var bars []chessanalysis.EvalBar
+		for {
+			var response Message
+			if err := conn.ReadJSON(&response); err != nil {
+				t.Fatalf("failed to read message: %v", err)
+			}
+			switch response.Type {
+			case "eval":
+				var bar chessanalysis.EvalBar
+				if err := json.Unmarshal([]byte(response.Text), &bar); err != nil || response.BoardID != "bar" {
+					t.Fatalf("expected an evaluation of the board, got %+v", response)
+				}
+				bars = append(bars, bar)
+			case "kibitz":
+				var update chessanalysis.KibitzUpdate
+				if err := json.Unmarshal([]byte(response.Text), &update); err != nil {
+					t.Fatal(err)
+				}
+				if update.Final {
+					return bars
+				}
+			default:
+				t.Fatalf("unexpected %q message: %s", response.Type, response.Text)
+			}
+		}
+	}
+
+	if err := conn.WriteJSON(Message{Type: "eval-subscribe", BoardID: "bar"}); err != nil {
+		t.Fatalf("failed to send eval-subscribe message: %v", err)
+	}
+	bars := kibitzUntilFinal("rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq e3 0 1")
+	if len(bars) == 0 {
+		t.Fatal("expected evaluations while the kibitzer searched")
+	}
+	for _, bar := range bars {
+		if total := bar.WDL[0] + bar.WDL[1] + bar.WDL[2]; bar.Ply != 1 || bar.CP == nil || math.Abs(total-1) > 0.01 {
+			t.Errorf("expected a score and chances after 1. e4, got %+v", bar)
+		}
+	}
+
+	if err := conn.WriteJSON(Message{Type: "eval-unsubscribe", BoardID: "bar"}); err != nil {
+		t.Fatalf("failed to send eval-unsubscribe message: %v", err)
+	}
+	for _, bar := range kibitzUntilFinal("rnbqkbnr/pppp1ppp/8/4p3/4P3/8/PPPP1PPP/RNBQKBNR w KQkq e6 0 2") {
+		if bar.Ply == 2 {
+			t.Errorf("expected no evaluations once unsubscribed, got %+v", bar)
+		}
+	}
+}
+
+func TestWebsocketPonder(t *testing.T) {
+	app := NewApplication()
+	app.engineFactory = (&chessanalysis.FakeEngine{}).NewEngine
+	server := httptest.NewServer(app)
+	t.Cleanup(server.Close)
+	conn := dialTestServer(t, server)
+
+	const afterE4 = "rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq e3 0 1"
+	const afterE4E5 = "rnbqkbnr/pppp1ppp/8/4p3/4P3/8/PPPP1PPP/RNBQKBNR w KQkq e6 0 2"
+	fens, _ := json.Marshal([]string{afterE4, afterE4E5})
+	if err := conn.WriteJSON(Message{Type: "ponder", Text: string(fens), Depth: 5}); err != nil {
+		t.Fatalf("failed to send ponder message: %v", err)
+	}
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		_, first := app.kibitzCache.Get(afterE4)
+		_, second := app.kibitzCache.Get(afterE4E5)
+		if first && second {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expected the positions to be pondered")
+		}
+	}
+
+	// The pondered position is answered at once
+	if err := conn.WriteJSON(Message{Type: "kibitz", Text: afterE4E5, Depth: 5}); err != nil {
+		t.Fatalf("failed to send kibitz message: %v", err)
+	}
+	var response Message
+	if err := conn.ReadJSON(&response); err != nil {
+		t.Fatalf("failed to read message: %v", err)
+	}
+	var update chessanalysis.KibitzUpdate
+	if response.Type != "kibitz" || json.Unmarshal([]byte(response.Text), &update) != nil {
+		t.Fatalf("expected a kibitz update, got %q message: %s", response.Type, response.Text)
+	}
+	if !update.Final || update.Depth != 5 || update.FEN != afterE4E5 {
+		t.Errorf("expected the final update at depth 5 from cache, got %+v", update)
+	}
+
+	// A deeper request picks up after the cached depth
+	if err := conn.WriteJSON(Message{Type: "kibitz", Text: afterE4, Depth: 7}); err != nil {
+		t.Fatalf("failed to send kibitz message: %v", err)
+	}
+	var depths []int
+	for {
+		if err := conn.ReadJSON(&response); err != nil {
+			t.Fatalf("failed to read message: %v", err)
+		}
+		if err := json.Unmarshal([]byte(response.Text), &update); err != nil {
+			t.Fatalf("expected a kibitz update, got %q message: %s", response.Type, response.Text)
+		}
+		depths = append(depths, update.Depth)
+		if update.Final {
+			break
+		}
+	}
+	if fmt.Sprint(depths) != "[5 6 7 7]" {
+		t.Errorf("expected the cached depth 5, depths 6 and 7 and the final update, got %v", depths)
+	}
+}
+
+func TestWebsocketRelay(t *testing.T) {
+	relayServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, testPgn)
+	}))
+	t.Cleanup(relayServer.Close)
+
+	app := NewApplication()
+	app.engineFactory = (&chessanalysis.FakeEngine{}).NewEngine
+	server := httptest.NewServer(app)
+	t.Cleanup(server.Close)
+	conn := dialTestServer(t, server)
+
+	if err := conn.WriteJSON(Message{Type: "relay-subscribe"}); err != nil {
+		t.Fatalf("failed to send relay-subscribe message: %v", err)
+	}
+	var response Message
+	if err := conn.ReadJSON(&response); err != nil {
+		t.Fatalf("failed to read response: %v", err)
+	}
+	if response.Type != "relay-error" {
+		t.Fatalf("expected an error without a relay, got %q message: %s", response.Type, response.Text)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	relay := chessanalysis.NewRelay(relayServer.URL, chessanalysis.WithDepth(1), chessanalysis.WithEngineFactory(app.engineFactory))
+	app.relayLock.Lock()
+	app.relay = relay
+	app.relayLock.Unlock()
+	if err := conn.WriteJSON(Message{Type: "relay-subscribe"}); err != nil {
+		t.Fatalf("failed to send relay-subscribe message: %v", err)
+	}
+	if err := conn.ReadJSON(&response); err != nil || response.Type != "relay-boards" || response.Text != "[]" {
+		t.Fatalf("expected no boards yet, got %q message: %s (%v)", response.Type, response.Text, err)
+	}
+
+	app.followRelay(ctx, relay, relay)
+	for i := 0; i < 7; i++ {
+		if err := conn.ReadJSON(&response); err != nil {
+			t.Fatalf("failed to read relay update %d: %v", i+1, err)
+		}
+		var update chessanalysis.RelayUpdate
+		if response.Type != "relay" || json.Unmarshal([]byte(response.Text), &update) != nil {
+			t.Fatalf("expected a relay update, got %q message: %s", response.Type, response.Text)
+		}
+		if update.Board != 1 || update.Headers["Event"] != "Scholar's Mate" {
+			t.Errorf("unexpected relay update %+v", update)
+		}
+	}
+}
+
+// burstFollower sends a number of relay updates at once
+type burstFollower int
+
+func (n burstFollower) Follow(ctx context.Context, update func(chessanalysis.RelayUpdate)) error {
+	for i := 0; i < int(n); i++ {
+		update(chessanalysis.RelayUpdate{Board: 1})
+	}
+	return nil
+}
+
+func TestRelayDropsSlowSubscribers(t *testing.T) {
+	app := NewApplication()
+	client := &Client{}
+	// A subscriber whose writer never drains its queue
+	app.relaySubscribers[client] = newOutbox(client, 1)
+
+	app.followRelay(context.Background(), nil, burstFollower(2))
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		app.relayLock.Lock()
+		subscribers := len(app.relaySubscribers)
+		app.relayLock.Unlock()
+		if subscribers == 0 {
+			return
+		}
+	}
+	t.Error("expected the slow subscriber to be dropped without stalling the relay")
+}
+
+func TestRelayResubscribe(t *testing.T) {
+	app := NewApplication()
+	app.relay = chessanalysis.NewRelay("", chessanalysis.WithDepth(1), chessanalysis.WithEngineFactory((&chessanalysis.FakeEngine{}).NewEngine))
+	client := &Client{}
+	// A subscriber with an update its writer hasn't sent yet
+	subscriber := newOutbox(client, 2)
+	subscriber.messages <- Message{Type: "relay"}
+	app.relaySubscribers[client] = subscriber
+
+	app.subscribeToRelay(client)
+	if app.relaySubscribers[client] != subscriber {
+		t.Fatal("expected subscribing again to keep the client's outbox")
+	}
+	var types []string
+	for len(subscriber.messages) > 0 {
+		types = append(types, (<-subscriber.messages).Type)
+	}
+	if !slices.Equal(types, []string{"relay", "relay-boards"}) {
+		t.Errorf("expected the boards queued after the pending update, got %v", types)
+	}
+}
+
+func TestBroadcastOverview(t *testing.T) {
+	app := NewApplication()
+	app.engineFactory = (&chessanalysis.FakeEngine{}).NewEngine
+	relay := chessanalysis.NewRelay("", chessanalysis.WithDepth(1), chessanalysis.WithEngineFactory(app.engineFactory))
+	if _, err := relay.UpdateGame(context.Background(), testPgn); err != nil {
+		t.Fatal(err)
+	}
+	app.relay, app.relayRound = relay, "abc"
+	server := httptest.NewServer(app)
+	t.Cleanup(server.Close)
+
+	response, err := http.Get(server.URL + "/api/v1/broadcasts/abc/overview")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	var overview []chessanalysis.RelayBoardOverview
+	if err := json.NewDecoder(response.Body).Decode(&overview); err != nil {
+		t.Fatalf("failed to decode overview: %v", err)
+	}
+	if len(overview) != 1 || overview[0].Plies != 7 || overview[0].LastMove != "4. Qxf7#" || overview[0].Result != "1-0" {
+		t.Errorf("unexpected overview %+v", overview)
+	}
+
+	response, err = http.Get(server.URL + "/api/v1/broadcasts/other/overview")
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404 for a round not followed, got %s", response.Status)
+	}
+}
+
+func TestWebsocketBoards(t *testing.T) {
+	conn := dialTestServer(t, newTestServer(t))
+
+	// Two boards analyze at once over the one connection, while a guessing
+	// game on a third keeps its session to itself
+	for _, message := range []Message{
+		{Type: "analyze", PGN: testPgn, Depth: 3, BoardID: "a"},
+		{Type: "analyze", PGN: testPgn, Depth: 4, BoardID: "b"},
+		{Type: "guess", Text: "e4", BoardID: "c"},
+	} {
+		if err := conn.WriteJSON(message); err != nil {
+			t.Fatalf("failed to send %s message: %v", message.Type, err)
+		}
+	}
+	analyzed := map[string]int{}
+	summaries := map[string]bool{}
+	guessError := false
+	for len(summaries) < 2 || !guessError {
+		var response Message
+		if err := conn.ReadJSON(&response); err != nil {
+			t.Fatalf("failed to read message: %v", err)
+		}
+		switch response.Type {
+		case "analysis":
+			var move chessanalysis.MoveAnalysis
+			if err := json.Unmarshal([]byte(response.Text), &move); err != nil {
+				t.Fatalf("failed to decode analysis: %v (%s)", err, response.Text)
+			}
+			if want := map[string]int{"a": 3, "b": 4}[response.BoardID]; move.Depth != want {
+				t.Errorf("expected depth %d on board %q, got %d", want, response.BoardID, move.Depth)
+			}
+			analyzed[response.BoardID]++
+		case "summary":
+			summaries[response.BoardID] = true
+		case "guess-error":
+			guessError = response.BoardID == "c"
+		default:
+			t.Fatalf("unexpected %q message for board %q: %s", response.Type, response.BoardID, response.Text)
+		}
+	}
+	if analyzed["a"] != 7 || analyzed["b"] != 7 || !summaries["a"] || !summaries["b"] {
+		t.Errorf("expected both boards fully analyzed, got %v and summaries %v", analyzed, summaries)
+	}
+
+	// Closing frees a board, and only so many can be open at once
+	for _, id := range []string{"a", "b", "c"} {
+		if err := conn.WriteJSON(Message{Type: "board-close", BoardID: id}); err != nil {
+			t.Fatalf("failed to close board %s: %v", id, err)
+		}
+	}
+	for i := range maxBoardsPerClient + 1 {
+		if err := conn.WriteJSON(Message{Type: "kibitz-stop", BoardID: fmt.Sprint("board ", i)}); err != nil {
+			t.Fatalf("failed to send kibitz-stop message: %v", err)
+		}
+	}
+	var response Message
+	if err := conn.ReadJSON(&response); err != nil {
+		t.Fatalf("failed to read response: %v", err)
+	}
+	if response.Type != "board-error" || response.BoardID != fmt.Sprint("board ", maxBoardsPerClient) {
+		t.Errorf("expected an error opening one board too many, got %q message for %q", response.Type, response.BoardID)
+	}
+}
+
+func TestWebsocketRooms(t *testing.T) {
+	server := newTestServer(t)
+	host, viewer, latecomer := dialTestServer(t, server), dialTestServer(t, server), dialTestServer(t, server)
+	read := func(conn *websocket.Conn) Message {
+		t.Helper()
+		var response Message
+		if err := conn.ReadJSON(&response); err != nil {
+			t.Fatalf("failed to read message: %v", err)
+		}
+		return response
+	}
+	// readAnalysis reads a room's analysis up to its summary and returns the
+	// types of the messages
+	readAnalysis := func(conn *websocket.Conn, boardID string) []string {
+		t.Helper()
+		var types []string
+		for len(types) == 0 || types[len(types)-1] != "summary" {
+			response := read(conn)
+			if response.BoardID != boardID {
+				t.Fatalf("expected a message for board %q, got %q message for %q", boardID, response.Type, response.BoardID)
+			}
+			types = append(types, response.Type)
+		}
+		return types
+	}
+
+	host.WriteJSON(Message{Type: "room-create", BoardID: "lecture"})
+	created := read(host)
+	if created.Type != "room-created" || created.ID == "" || created.BoardID != "lecture" {
+		t.Fatalf("expected the room's ID, got %q message: %+v", created.Type, created)
+	}
+	viewer.WriteJSON(Message{Type: "room-join", ID: created.ID})
+	if joined := read(viewer); joined.Type != "room-joined" || joined.ID != created.ID {
+		t.Fatalf("expected to join the room, got %q message: %s", joined.Type, joined.Text)
+	}
+
+	host.WriteJSON(Message{Type: "analyze", PGN: testPgn, Depth: 4, BoardID: "lecture"})
+	want := append(append([]string{"room-analyze"}, slices.Repeat([]string{"analysis"}, 7)...), "summary")
+	if got := readAnalysis(host, "lecture"); !slices.Equal(got, want[1:]) {
+		t.Errorf("expected the host to get its analysis, got %v", got)
+	}
+	if got := readAnalysis(viewer, ""); !slices.Equal(got, want) {
+		t.Errorf("expected the viewer to get the host's analysis, got %v", got)
+	}
+
+	// Viewers who join late catch up, and can't drive the analysis
+	latecomer.WriteJSON(Message{Type: "room-join", ID: created.ID, BoardID: "tab"})
+	if joined := read(latecomer); joined.Type != "room-joined" {
+		t.Fatalf("expected to join the room, got %q message: %s", joined.Type, joined.Text)
+	}
+	if got := readAnalysis(latecomer, "tab"); !slices.Equal(got, want) {
+		t.Errorf("expected a late viewer to get the analysis so far, got %v", got)
+	}
+	latecomer.WriteJSON(Message{Type: "analyze", PGN: testPgn, BoardID: "tab"})
+	if response := read(latecomer); response.Type != "board-error" {
+		t.Errorf("expected viewers to be read-only, got %q message: %s", response.Type, response.Text)
+	}
+
+	// Closing the host's board closes the room
+	host.WriteJSON(Message{Type: "board-close", BoardID: "lecture"})
+	for _, conn := range []*websocket.Conn{viewer, latecomer} {
+		if response := read(conn); response.Type != "room-closed" || response.ID != created.ID {
+			t.Errorf("expected the room to close, got %q message: %s", response.Type, response.Text)
+		}
+	}
+	viewer.WriteJSON(Message{Type: "room-join", ID: created.ID})
+	if response := read(viewer); response.Type != "room-error" {
+		t.Errorf("expected a closed room not to be joinable, got %q message", response.Type)
+	}
+}
+
+func TestRoomDropsSlowViewers(t *testing.T) {
+	room := &Room{id: "slow", viewers: make(map[*Board]*outbox)}
+	board := &Board{id: "tab"}
+	// A viewer whose writer never drains its queue
+	room.viewers[board] = newOutbox(board.client, 1)
+
+	done := make(chan struct{})
+	go func() {
+		room.broadcast(Message{Type: "analysis"})
+		room.broadcast(Message{Type: "analysis"})
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("expected broadcasting not to wait for a slow viewer")
+	}
+	if len(room.viewers) != 0 {
+		t.Errorf("expected the slow viewer to be dropped, got %d viewers", len(room.viewers))
+	}
+}
+
+func TestEnginesEndpoint(t *testing.T) {
+	server := newTestServer(t)
+	response, err := http.Get(server.URL + "/api/v1/engines")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	var engines []EngineDescription
+	if err := json.NewDecoder(response.Body).Decode(&engines); err != nil || len(engines) != 1 {
+		t.Fatalf("expected one engine, got %v (%v)", engines, err)
+	}
+	engine := engines[0]
+	if engine.Name != "FakeEngine" || engine.Version != "1.0" || engine.Option("MultiPV") == nil {
+		t.Errorf("unexpected engine %+v", engine.EngineInfo)
+	}
+	if !engine.Capabilities.WDL || engine.Capabilities.MaxMultiPV != 500 || engine.Capabilities.Chess960 {
+		t.Errorf("unexpected capabilities %+v", engine.Capabilities)
+	}
+	if engine.Defaults.Depth != defaultAnalysisDepth || engine.Defaults.MaxDepth != maxAnalysisDepth {
+		t.Errorf("unexpected defaults %+v", engine.Defaults)
+	}
+}
+
+func TestAnalysisProfiles(t *testing.T) {
+	if err := validateProfiles(defaultProfiles); err != nil {
+		t.Errorf("expected the default profiles to be valid: %v", err)
+	}
+	for _, profiles := range [][]AnalysisProfile{
+		{{Name: "twice", Depth: 5}, {Name: "twice", Depth: 6}},
+		{{Name: "both", Depth: 5, MoveTimeMs: 1000}},
+		{{Depth: 5}},
+	} {
+		if err := validateProfiles(profiles); err == nil {
+			t.Errorf("expected %+v to be refused", profiles)
+		}
+	}
+
+	app := NewApplication()
+	app.engineFactory = (&chessanalysis.FakeEngine{}).NewEngine
+	app.profiles = []AnalysisProfile{{Name: "shallow", Depth: 3, MultiPV: 2}}
+	server := httptest.NewServer(app)
+	t.Cleanup(server.Close)
+
+	response, err := http.Get(server.URL + "/api/v1/profiles")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	var profiles []AnalysisProfile
+	if err := json.NewDecoder(response.Body).Decode(&profiles); err != nil || !slices.Equal(profiles, app.profiles) {
+		t.Errorf("expected the server's profiles, got %+v (%v)", profiles, err)
+	}
+
+	conn := dialTestServer(t, server)
+	if err := conn.WriteJSON(Message{Type: "analyze", PGN: testPgn, Depth: 20, Profile: "shallow"}); err != nil {
+		t.Fatal(err)
+	}
+	for {
+		var message Message
+		if err := conn.ReadJSON(&message); err != nil {
+			t.Fatal(err)
+		}
+		if message.Type == "summary" {
+			var game chessanalysis.GameAnalysis
+			if err := json.Unmarshal([]byte(message.Text), &game); err != nil {
+				t.Fatal(err)
+			}
+			if game.Options.Depth != 3 || game.Options.MultiPV != 2 {
+				t.Errorf("expected the profile's settings, got %+v", game.Options)
+			}
+			break
+		}
+		if message.Type != "analysis" {
+			t.Fatalf("expected a single pass at the profile's depth, got %+v", message)
+		}
+	}
+
+	if err := conn.WriteJSON(Message{Type: "analyze", PGN: testPgn, Profile: "unknown"}); err != nil {
+		t.Fatal(err)
+	}
+	var message Message
+	if err := conn.ReadJSON(&message); err != nil || !strings.Contains(message.Text, "unknown analysis profile") {
+		t.Errorf("expected an unknown profile to be refused, got %+v (%v)", message, err)
+	}
+}
+
+func TestWebsocketClassificationSymbols(t *testing.T) {
+	app := NewApplication()
+	app.engineFactory = (&chessanalysis.FakeEngine{Positions: map[string]chessanalysis.FakeEvaluation{
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1": {BestMove: "e2e4"},
+	}}).NewEngine
+	app.symbols = chessanalysis.UnicodeSymbols
+	server := httptest.NewServer(app)
+	t.Cleanup(server.Close)
+	conn := dialTestServer(t, server)
+
+	if err := conn.WriteJSON(Message{Type: "analyze", PGN: testPgn, Depth: 3}); err != nil {
+		t.Fatal(err)
+	}
+	symbols := make(map[string]string)
+	for {
+		var message Message
+		if err := conn.ReadJSON(&message); err != nil {
+			t.Fatal(err)
+		}
+		if message.Type == "summary" {
+			break
+		}
+		var move struct {
+			Classification       string `json:"classification"`
+			ClassificationSymbol string `json:"classificationSymbol"`
+		}
+		if err := json.Unmarshal([]byte(message.Text), &move); err != nil {
+			t.Fatalf("expected a move analysis, got %q message: %s", message.Type, message.Text)
+		}
+		symbols[move.Classification] = move.ClassificationSymbol
+	}
+	if symbols["Best"] != "★" {
+		t.Errorf("expected best moves shown with the Unicode symbol, got %v", symbols)
+	}
+}
+
+func TestWhatIf(t *testing.T) {
+	server := newTestServer(t)
+	conn := dialTestServer(t, server)
+	if err := conn.WriteJSON(Message{Type: "analyze", PGN: testPgn, Depth: 3}); err != nil {
+		t.Fatal(err)
+	}
+	var summary Message
+	for summary.Type != "summary" {
+		if err := conn.ReadJSON(&summary); err != nil {
+			t.Fatalf("failed to read summary: %v", err)
+		}
+	}
+
+	post := func(id, body string) (int, string) {
+		response, err := http.Post(server.URL+"/api/v1/analyses/"+id+"/whatif", "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer response.Body.Close()
+		data, _ := io.ReadAll(response.Body)
+		return response.StatusCode, string(data)
+	}
+	status, body := post(summary.ID, `{"ply": 1, "move": "c5"}`)
+	var whatIf chessanalysis.WhatIf
+	if err := json.Unmarshal([]byte(body), &whatIf); status != http.StatusOK || err != nil {
+		t.Fatalf("unexpected response %d: %s", status, body)
+	}
+	if whatIf.Move != "c5" || whatIf.Played != "e5" || whatIf.Depth != 3 {
+		t.Errorf("unexpected what-if %+v", whatIf)
+	}
+	if status, body := post(summary.ID, `{"ply": 1, "move": "Ke2"}`); status != http.StatusBadRequest {
+		t.Errorf("expected an illegal move to be refused, got %d: %s", status, body)
+	}
+	if status, _ := post("0123abcd", `{"ply": 1, "move": "c5"}`); status != http.StatusNotFound {
+		t.Errorf("expected an unknown analysis to be missing, got %d", status)
+	}
+
+	if err := conn.WriteJSON(Message{Type: "whatif", ID: summary.ID, Ply: 0, Text: "d4"}); err != nil {
+		t.Fatal(err)
+	}
+	var message Message
+	if err := conn.ReadJSON(&message); err != nil {
+		t.Fatal(err)
+	}
+	if message.Type != "whatif" || !strings.Contains(message.Text, `"move":"d4"`) || !strings.Contains(message.Text, `"played":"e4"`) {
+		t.Errorf("unexpected what-if message %+v", message)
+	}
+}
+
+func TestWebsocketNoMoves(t *testing.T) {
+	server := newTestServer(t)
+	conn := dialTestServer(t, server)
+
+	const headerOnly = "[White \"Carlsen\"]\n[Black \"Nepomniachtchi\"]\n[Result \"*\"]\n\n*"
+	if err := conn.WriteJSON(Message{Type: "analyze", PGN: headerOnly, Depth: 3}); err != nil {
+		t.Fatal(err)
+	}
+	var message Message
+	if err := conn.ReadJSON(&message); err != nil {
+		t.Fatal(err)
+	}
+	if message.Type != "no_moves" {
+		t.Fatalf("expected a no_moves message, got %q: %s", message.Type, message.Text)
+	}
+	var game struct {
+		Headers map[string]string `json:"headers"`
+		Summary struct {
+			NothingToAnalyze bool `json:"nothingToAnalyze"`
+		} `json:"summary"`
+	}
+	if err := json.Unmarshal([]byte(message.Text), &game); err != nil {
+		t.Fatal(err)
+	}
+	if !game.Summary.NothingToAnalyze || game.Headers["White"] != "Carlsen" {
+		t.Errorf("expected the headers and an empty summary, got %s", message.Text)
+	}
+}
+
+func TestMessagesEndpoint(t *testing.T) {
+	app := NewApplication()
+	app.translations = map[string]chessanalysis.Translations{"fr": {"classification.Blunder": "Gaffe"}}
+	server := httptest.NewServer(app)
+	t.Cleanup(server.Close)
+
+	for lang, want := range map[string]string{"fr": "Gaffe", "en": "Blunder"} {
+		response, err := http.Get(server.URL + "/api/v1/messages/" + lang)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var messages chessanalysis.Translations
+		err = json.NewDecoder(response.Body).Decode(&messages)
+		response.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if messages["classification.Blunder"] != want || messages["classification.Good"] != "Good" {
+			t.Errorf("expected %q for blunders and English otherwise in %s, got %v", want, lang, messages)
+		}
+	}
+
+	response, err := http.Get(server.URL + "/api/v1/messages/xx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusNotFound {
+		t.Errorf("expected an unknown language to be 404, got %d", response.StatusCode)
+	}
+}
+
+func TestWebsocketClassifierProfile(t *testing.T) {
+	conn := dialTestServer(t, newTestServer(t))
+	if err := conn.WriteJSON(Message{Type: "analyze", PGN: testPgn, Depth: 3, Classifier: "expert"}); err != nil {
+		t.Fatal(err)
+	}
+	for {
+		var message Message
+		if err := conn.ReadJSON(&message); err != nil {
+			t.Fatal(err)
+		}
+		if message.Type == "summary" {
+			var game chessanalysis.GameAnalysis
+			if err := json.Unmarshal([]byte(message.Text), &game); err != nil {
+				t.Fatal(err)
+			}
+			if game.Options.ClassifierProfile != "expert" {
+				t.Errorf("expected moves classified with the expert profile, got %+v", game.Options)
+			}
+			break
+		}
+	}
+
+	if err := conn.WriteJSON(Message{Type: "analyze", PGN: testPgn, Classifier: "grandmaster"}); err != nil {
+		t.Fatal(err)
+	}
+	var message Message
+	if err := conn.ReadJSON(&message); err != nil || !strings.Contains(message.Text, "unknown classifier profile") {
+		t.Errorf("expected an unknown classifier profile to be refused, got %+v (%v)", message, err)
+	}
+}
+
+func TestValidateEndpoint(t *testing.T) {
+	server := newTestServer(t)
+	response, err := http.Post(server.URL+"/api/v1/validate", "application/x-chess-pgn",
+		strings.NewReader(strings.Replace(testPgn, "Qxf7#", "Qxf8#", 1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	var validation chessanalysis.PGNValidation
+	if err := json.NewDecoder(response.Body).Decode(&validation); err != nil {
+		t.Fatal(err)
+	}
+	if validation.Valid || len(validation.Games) != 1 || validation.Games[0].Tags["Event"] != "Scholar's Mate" {
+		t.Fatalf("expected one invalid game, got %+v", validation)
+	}
+	if err := validation.Games[0].Error; err == nil || err.Token != "Qxf8#" || err.Ply != 7 || err.Line != 5 {
+		t.Errorf("expected 4. Qxf8# to be located, got %+v", err)
+	}
+}
+
+func TestInputLimits(t *testing.T) {
+	app := NewApplication()
+	app.engineFactory = (&chessanalysis.FakeEngine{}).NewEngine
+	app.limits = chessanalysis.InputLimits{MaxPlies: 6}
+	server := httptest.NewServer(app)
+	t.Cleanup(server.Close)
+
+	response, err := http.Post(server.URL+"/api/v1/validate", "application/x-chess-pgn", strings.NewReader(testPgn))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	var inputError InputError
+	if err := json.NewDecoder(response.Body).Decode(&inputError); err != nil {
+		t.Fatal(err)
+	}
+	if response.StatusCode != http.StatusRequestEntityTooLarge || inputError.InputLimitError == nil ||
+		inputError.Limit != "maxPlies" || inputError.Actual != 7 || inputError.Message == "" {
+		t.Errorf("expected the 7 plies to be refused, got %d %+v", response.StatusCode, inputError)
+	}
+
+	conn := dialTestServer(t, server)
+	if err := conn.WriteJSON(Message{Type: "analyze", PGN: testPgn, Depth: 4}); err != nil {
+		t.Fatal(err)
+	}
+	var message Message
+	if err := conn.ReadJSON(&message); err != nil {
+		t.Fatal(err)
+	}
+	if message.Type != "input-error" || !strings.Contains(message.Text, `"limit":"maxPlies"`) {
+		t.Errorf("expected the analysis to be refused, got %+v", message)
+	}
+}
+
+func TestAccessControl(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	config := `{"access": {"allowedIps": ["10.0.0.0/8", "127.0.0.1"], "users": {"alice": "wonderland"}}, "limits": {"maxPlies": 500}}`
+	if err := os.WriteFile(path, []byte(config), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := loadConfig(path)
+	if err != nil {
+		t.Fatalf("failed to load configuration: %v", err)
+	}
+	if loaded.Limits == nil || loaded.Limits.MaxPlies != 500 {
+		t.Errorf("expected the configured limits, got %+v", loaded.Limits)
+	}
+
+	app := NewApplication()
+	app.engineFactory = (&chessanalysis.FakeEngine{}).NewEngine
+	app.adminToken = "secret"
+	if app.access, err = newAccessControl(loaded.Access); err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(app)
+	t.Cleanup(server.Close)
+	get := func(path string, header http.Header) int {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodGet, server.URL+path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header = header
+		response, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		response.Body.Close()
+		return response.StatusCode
+	}
+	basic := func(user, password string) http.Header {
+		req, _ := http.NewRequest(http.MethodGet, "/", nil)
+		req.SetBasicAuth(user, password)
+		return req.Header
+	}
+	for _, test := range []struct {
+		path   string
+		header http.Header
+		want   int
+	}{
+		{"/", nil, http.StatusUnauthorized},
+		{"/", basic("alice", "wrong"), http.StatusUnauthorized},
+		{"/", basic("bob", "wonderland"), http.StatusUnauthorized},
+		{"/", basic("alice", "wonderland"), http.StatusOK},
+		{"/static/ws.js", basic("alice", "wonderland"), http.StatusOK},
+		{"/api/v1/admin/books", http.Header{"Authorization": {"Bearer secret"}}, http.StatusOK},
+		{"/api/v1/admin/books", nil, http.StatusUnauthorized},
+		{"/", http.Header{"Authorization": {"Bearer secret"}}, http.StatusUnauthorized},
+		{"/api/v1/profiles", http.Header{"Authorization": {"Bearer secret"}}, http.StatusUnauthorized},
+	} {
+		if got := get(test.path, test.header); got != test.want {
+			t.Errorf("expected %s with %v to return %d, got %d", test.path, test.header, test.want, got)
+		}
+	}
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws"
+	if _, response, err := websocket.DefaultDialer.Dial(url, nil); err == nil || response.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected the websocket to need credentials, got %v", err)
+	}
+	conn, _, err := websocket.DefaultDialer.Dial(url, basic("alice", "wonderland"))
+	if err != nil {
+		t.Fatalf("failed to connect with credentials: %v", err)
+	}
+	conn.Close()
+
+	// Requests from outside the allowed addresses are refused outright
+	app.access, _ = newAccessControl(AccessConfig{AllowedIPs: []string{"10.0.0.0/8"}})
+	if got := get("/", basic("alice", "wonderland")); got != http.StatusForbidden {
+		t.Errorf("expected a client outside the allowlist to be forbidden, got %d", got)
+	}
+	if _, err := newAccessControl(AccessConfig{AllowedIPs: []string{"localhost"}}); err == nil {
+		t.Error("expected a host name to be refused as an allowed IP")
+	}
+}
+
+func TestAdminBooks(t *testing.T) {
+	app := NewApplication()
+	app.engineFactory = (&chessanalysis.FakeEngine{}).NewEngine
+	app.adminToken = "secret"
+	server := httptest.NewServer(app)
+	t.Cleanup(server.Close)
+	request := func(method, path, token string, body []byte) int {
+		t.Helper()
+		req, err := http.NewRequest(method, server.URL+path, bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		response, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		response.Body.Close()
+		return response.StatusCode
+	}
+
+	// A polyglot book of 1. e4 from the starting position
+	book := make([]byte, 16)
+	binary.BigEndian.PutUint64(book, 0x463b96181691fc9c)
+	binary.BigEndian.PutUint16(book[8:], 28|12<<6)
+	binary.BigEndian.PutUint16(book[10:], 1)
+
+	for _, test := range []struct {
+		method, token string
+		body          []byte
+		want          int
+	}{
+		{http.MethodPut, "", book, http.StatusUnauthorized},
+		{http.MethodPut, "wrong", book, http.StatusUnauthorized},
+		{http.MethodPut, "secret", []byte("not a book"), http.StatusBadRequest},
+		{http.MethodDelete, "secret", nil, http.StatusNotFound},
+		{http.MethodPut, "secret", book, http.StatusNoContent},
+	} {
+		if got := request(test.method, "/api/v1/admin/books/e4.bin", test.token, test.body); got != test.want {
+			t.Errorf("expected %s with token %q to return %d, got %d", test.method, test.token, test.want, got)
+		}
+	}
+	if names := app.books.Names(); !slices.Equal(names, []string{"e4.bin"}) {
+		t.Errorf("expected the uploaded book on the shelf, got %v", names)
+	}
+
+	// Analyses use the uploaded book straight away
+	conn := dialTestServer(t, server)
+	if err := conn.WriteJSON(Message{Type: "analyze", PGN: testPgn, Depth: 4}); err != nil {
+		t.Fatalf("failed to send analyze message: %v", err)
+	}
+	var response Message
+	if err := conn.ReadJSON(&response); err != nil {
+		t.Fatalf("failed to read analysis: %v", err)
+	}
+	var move chessanalysis.MoveAnalysis
+	if err := json.Unmarshal([]byte(response.Text), &move); err != nil || move.Classification != chessanalysis.Book {
+		t.Errorf("expected 1. e4 to be a book move, got %s (%v)", response.Text, err)
+	}
+
+	if got := request(http.MethodDelete, "/api/v1/admin/books/e4.bin", "secret", nil); got != http.StatusNoContent {
+		t.Errorf("expected the book to be removed, got %d", got)
+	}
+	app.adminToken = ""
+	if got := request(http.MethodGet, "/api/v1/admin/books", "", nil); got != http.StatusForbidden {
+		t.Errorf("expected the admin API to be disabled without a token, got %d", got)
+	}
+}
+
+func TestWebsocketAnalysisError(t *testing.T) {
+	conn := dialTestServer(t, newTestServer(t))
+
+	if err := conn.WriteJSON(Message{Type: "analyze", PGN: ""}); err != nil {
+		t.Fatalf("failed to send analyze message: %v", err)
+	}
+
+	var response Message
+	if err := conn.ReadJSON(&response); err != nil {
+		t.Fatalf("failed to read response: %v", err)
+	}
+	if response.Text != "Analysis error: no game to analyze" {
+		t.Errorf("unexpected error text %q", response.Text)
+	}
+}
+
+func TestConfigReload(t *testing.T) {
+	dir := t.TempDir()
+	// A polyglot book of 1. e4 from the starting position
+	book := make([]byte, 16)
+	binary.BigEndian.PutUint64(book, 0x463b96181691fc9c)
+	binary.BigEndian.PutUint16(book[8:], 28|12<<6)
+	binary.BigEndian.PutUint16(book[10:], 1)
+	os.WriteFile(filepath.Join(dir, "e4.bin"), book, 0o600)
+	path := filepath.Join(dir, "config.json")
+	write := func(config string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(config), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	app := NewApplication()
+	app.engineFactory = (&chessanalysis.FakeEngine{}).NewEngine
+	app.adminToken = "secret"
+	app.flagLimits = chessanalysis.InputLimits{MaxPGNBytes: 1 << 20, MaxPlies: 300}
+	app.limitFlags = []string{"max-plies"}
+	server := httptest.NewServer(app)
+	t.Cleanup(server.Close)
+	reload := func() int {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodPost, server.URL+"/api/v1/admin/reload", nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		response, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		response.Body.Close()
+		return response.StatusCode
+	}
+	if got := reload(); got != http.StatusConflict {
+		t.Errorf("expected 409 without a configuration file, got %d", got)
+	}
+
+	// An open connection carries on across reloads
+	conn := dialTestServer(t, server)
+	app.configPath = path
+	write(`{"limits": {"maxGames": 2, "maxPlies": 10}, "maxDepth": 8, "books": ["` + filepath.Join(dir, "e4.bin") + `"],
+		"profiles": [{"name": "club", "depth": 4}]}`)
+	if got := reload(); got != http.StatusNoContent {
+		t.Fatalf("expected the configuration reloaded, got %d", got)
+	}
+	if limits := app.inputLimits(); limits != (chessanalysis.InputLimits{MaxGames: 2, MaxPlies: 300}) {
+		t.Errorf("expected the file's limits with the command line's plies, got %+v", limits)
+	}
+	if _, ok := app.profile("club"); !ok || app.depthCap() != 8 || !slices.Equal(app.books.Names(), []string{"e4.bin"}) {
+		t.Errorf("expected the file's profile, depth cap and book, got cap %d and books %v", app.depthCap(), app.books.Names())
+	}
+
+	// An invalid file changes nothing
+	write(`{"profiles": [{"name": "slow", "depth": 4, "moveTimeMs": 1000}]}`)
+	if got := reload(); got != http.StatusBadRequest {
+		t.Errorf("expected an invalid configuration refused, got %d", got)
+	}
+	if _, ok := app.profile("club"); !ok || app.depthCap() != 8 {
+		t.Error("expected the previous configuration kept")
+	}
+
+	// Settings left out of the file go back to their defaults
+	write(`{}`)
+	if got := reload(); got != http.StatusNoContent {
+		t.Fatalf("expected the configuration reloaded, got %d", got)
+	}
+	if _, ok := app.profile("club"); ok || app.depthCap() != maxAnalysisDepth || len(app.books.Names()) != 0 || app.inputLimits() != app.flagLimits {
+		t.Errorf("expected the defaults back, got cap %d, books %v and limits %+v", app.depthCap(), app.books.Names(), app.inputLimits())
+	}
+
+	if err := conn.WriteJSON(Message{Type: "analyze", PGN: testPgn, Depth: 4}); err != nil {
+		t.Fatalf("failed to send analyze message: %v", err)
+	}
+	var response Message
+	if err := conn.ReadJSON(&response); err != nil || response.Type != "analysis" {
+		t.Errorf("expected the connection opened before the reloads to analyze, got %q (%v)", response.Type, err)
+	}
+}
+
+func TestAPIKeyQuotas(t *testing.T) {
+	app := NewApplication()
+	app.engineFactory = (&chessanalysis.FakeEngine{}).NewEngine
+	var err error
+	app.access, err = newAccessControl(AccessConfig{APIKeys: map[string]APIKeyQuota{
+		"tenant-key": {Name: "tenant", MaxConcurrentJobs: 1, MaxEngineSecondsPerDay: 60, MaxDepth: 6},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Every job takes a minute on the clock the quotas are counted with
+	clock := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	app.quotas.now = func() time.Time {
+		clock = clock.Add(30 * time.Second)
+		return clock
+	}
+	server := httptest.NewServer(app)
+	t.Cleanup(server.Close)
+	analyze := func(key string) (*http.Response, chessanalysis.GameAnalysis) {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodPost, server.URL+"/api/v1/analyze?depth=12", strings.NewReader(testPgn))
+		if key != "" {
+			req.Header.Set("X-API-Key", key)
+		}
+		response, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer response.Body.Close()
+		var game chessanalysis.GameAnalysis
+		if response.StatusCode == http.StatusOK {
+			json.NewDecoder(response.Body).Decode(&game)
+		}
+		return response, game
+	}
+
+	if response, _ := analyze(""); response.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected 401 without a key, got %s", response.Status)
+	}
+	if response, _ := analyze("wrong"); response.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected 401 with an unknown key, got %s", response.Status)
+	}
+	response, game := analyze("tenant-key")
+	if response.StatusCode != http.StatusOK || game.Options.Depth != 6 {
+		t.Fatalf("expected an analysis capped at the key's depth 6, got %s at depth %d", response.Status, game.Options.Depth)
+	}
+	if response, _ := analyze("tenant-key"); response.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("expected 429 once the day's engine time is spent, got %s", response.Status)
+	}
+
+	// Keys in the URL would be written to the access log, so aren't taken
+	response, err = http.Post(server.URL+"/api/v1/analyze?depth=12&key=tenant-key", "application/x-chess-pgn", strings.NewReader(testPgn))
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected 401 with the key in the query, got %s", response.Status)
+	}
+
+	// Over the websocket, with the key as its only subprotocol, as browsers
+	// send it
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws"
+	dialer := websocket.Dialer{Subprotocols: []string{"key.tenant-key"}}
+	conn, _, err := dialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("failed to connect to websocket: %v", err)
+	}
+	if conn.Subprotocol() != "key.tenant-key" {
+		t.Errorf("expected the key's subprotocol accepted, got %q", conn.Subprotocol())
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	conn.WriteJSON(Message{Type: "analyze", PGN: testPgn})
+	var message Message
+	if err := conn.ReadJSON(&message); err != nil || message.Type != "quota-error" || !strings.Contains(message.Text, "engine seconds") {
+		t.Errorf("expected a quota-error, got %+v (%v)", message, err)
+	}
+
+	// The budget is the day's
+	clock = clock.Add(24 * time.Hour)
+	if response, _ := analyze("tenant-key"); response.StatusCode != http.StatusOK {
+		t.Errorf("expected the budget renewed the next day, got %s", response.Status)
+	}
+
+	clock = clock.Add(24 * time.Hour)
+	key := apiKeyHash(sha256.Sum256([]byte("tenant-key")))
+	done, err := app.startJob(&key, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := app.startJob(&key, true); !errors.Is(err, errQuotaExceeded) {
+		t.Errorf("expected a second concurrent job refused, got %v", err)
+	}
+	if _, err := app.startJob(&key, false); err != nil {
+		t.Errorf("expected pondering alongside the job, got %v", err)
+	}
+	done()
+}
+
+func TestRetention(t *testing.T) {
+	app := NewApplication()
+	app.adminToken = "secret"
+	if err := app.applyConfig(&Config{Retention: RetentionConfig{AnalysesMinutes: 60, EvalsMinutes: 10}}); err != nil {
+		t.Fatal(err)
+	}
+	id, _ := app.analyses.add(&chessanalysis.GameAnalysis{}, testPgn, []byte("{}"), ownership{})
+	app.kibitzCache.Put(chessanalysis.KibitzUpdate{FEN: chessanalysis.BenchmarkPositions[0], Depth: 6, Final: true})
+	now := time.Now()
+	if analyses, evals := app.purgeExpired(now.Add(30 * time.Minute)); analyses != 0 || evals != 1 {
+		t.Errorf("expected the evaluation expired after 30 minutes, got %d analyses and %d evaluations", analyses, evals)
+	}
+	if analyses, _ := app.purgeExpired(now.Add(2 * time.Hour)); analyses != 1 {
+		t.Errorf("expected the analysis expired after 2 hours, got %d", analyses)
+	}
+	if _, ok := app.analyses.get(id); ok {
+		t.Error("expected the expired analysis to be gone")
+	}
+
+	server := httptest.NewServer(app)
+	t.Cleanup(server.Close)
+	purge := func(query, token string) (int, PurgeResult) {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodPost, server.URL+"/api/v1/admin/purge"+query, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		response, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer response.Body.Close()
+		var result PurgeResult
+		json.NewDecoder(response.Body).Decode(&result)
+		return response.StatusCode, result
+	}
+	app.analyses.add(&chessanalysis.GameAnalysis{}, testPgn, []byte("{}"), ownership{})
+	if status, _ := purge("?olderThan=0s", "wrong"); status != http.StatusUnauthorized {
+		t.Errorf("expected 401 without the admin token, got %d", status)
+	}
+	if status, result := purge("", "secret"); status != http.StatusOK || result.Analyses != 0 {
+		t.Errorf("expected nothing expired yet, got %d with %+v", status, result)
+	}
+	if status, result := purge("?olderThan=0s", "secret"); status != http.StatusOK || result.Analyses != 1 {
+		t.Errorf("expected everything purged, got %d with %+v", status, result)
+	}
+	if status, _ := purge("?olderThan=soon", "secret"); status != http.StatusBadRequest {
+		t.Errorf("expected 400 for an invalid age, got %d", status)
+	}
+	if err := app.applyConfig(&Config{Retention: RetentionConfig{EvalsMinutes: -1}}); err == nil {
+		t.Error("expected a negative retention period to be refused")
+	}
+}
+
+func TestUnixSocketListener(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "chess.sock")
+	// A socket left behind by a server that didn't shut down cleanly
+	stale, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Skipf("can't listen on a Unix socket here: %v", err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	listeners, err := serverListeners(DefaultPort, false, socket)
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	if len(listeners) != 1 || listenerName(listeners[0]) != "unix:"+socket {
+		t.Fatalf("expected only the Unix socket, got %d listeners", len(listeners))
+	}
+	app := NewApplication()
+	app.engineFactory = (&chessanalysis.FakeEngine{}).NewEngine
+	// Requests over the socket have no address, and count as local
+	if app.access, err = newAccessControl(AccessConfig{AllowedIPs: []string{"10.0.0.0/8"}}); err != nil {
+		t.Fatal(err)
+	}
+	server := &http.Server{Handler: app}
+	go server.Serve(listeners[0])
+	defer server.Close()
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", socket)
+		},
+	}}
+	response, err := client.Get("http://chess-analyzer/api/v1/profiles")
+	if err != nil {
+		t.Fatalf("failed to reach the server over the socket: %v", err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		t.Errorf("expected the profiles over the socket, got %s", response.Status)
+	}
+}
+
+func TestSystemdListeners(t *testing.T) {
+	t.Setenv("LISTEN_PID", "1")
+	t.Setenv("LISTEN_FDS", "1")
+	if listeners, err := systemdListeners(); listeners != nil || err != nil {
+		t.Errorf("expected sockets passed to another process ignored, got %v (%v)", listeners, err)
+	}
+	t.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))
+	t.Setenv("LISTEN_FDS", "none")
+	if _, err := systemdListeners(); err == nil {
+		t.Error("expected an invalid LISTEN_FDS refused")
+	}
+}
+
+func TestWebsocketGuessTheMove(t *testing.T) {
+	conn := dialTestServer(t, newTestServer(t))
+
+	if err := conn.WriteJSON(Message{Type: "guess-start", PGN: testPgn, Depth: 2, Color: "White"}); err != nil {
+		t.Fatalf("failed to send guess-start message: %v", err)
+	}
+	for _, guess := range []string{"e4", "Qh5", "Bc4", "Qxf7#"} {
+		var response Message
+		if err := conn.ReadJSON(&response); err != nil {
+			t.Fatalf("failed to read prompt: %v", err)
+		}
+		if response.Type != "guess-position" {
+			t.Fatalf("expected guess-position message, got %q (%s)", response.Type, response.Text)
+		}
+		if err := conn.WriteJSON(Message{Type: "guess", Text: guess}); err != nil {
+			t.Fatalf("failed to send guess: %v", err)
+		}
+		if err := conn.ReadJSON(&response); err != nil {
+			t.Fatalf("failed to read guess result: %v", err)
+		}
+		var result chessanalysis.GuessResult
+		if err := json.Unmarshal([]byte(response.Text), &result); err != nil {
+			t.Fatalf("failed to decode guess result: %v (%s)", err, response.Text)
+		}
+		if result.Guess != guess || result.Played != guess {
+			t.Errorf("unexpected guess result %+v", result)
+		}
+	}
+
+	var response Message
+	if err := conn.ReadJSON(&response); err != nil {
+		t.Fatalf("failed to read completion: %v", err)
+	}
+	if response.Type != "guess-complete" {
+		t.Errorf("expected guess-complete message, got %q", response.Type)
+	}
+}
+
+func TestBoardEndpoint(t *testing.T) {
+	server := newTestServer(t)
+
+	response, err := http.Get(server.URL + "/api/v1/board.svg?fen=8/8/8/8/8/8/8/K6k+w+-+-+0+1&arrows=best:a1a2")
+	if err != nil {
+		t.Fatalf("failed to fetch board: %v", err)
+	}
+	defer response.Body.Close()
+	body, _ := io.ReadAll(response.Body)
+	if response.StatusCode != http.StatusOK || response.Header.Get("Content-Type") != "image/svg+xml" {
+		t.Fatalf("unexpected response %s (%s): %s", response.Status, response.Header.Get("Content-Type"), body)
+	}
+	if !strings.Contains(string(body), "data:image/png;base64,") {
+		t.Error("expected embedded piece images")
+	}
+
+	response, err = http.Get(server.URL + "/api/v1/board.svg?fen=invalid")
+	if err != nil {
+		t.Fatalf("failed to fetch board: %v", err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected bad request for an invalid FEN, got %s", response.Status)
+	}
+}
+
+func TestGIFExport(t *testing.T) {
+	server := newTestServer(t)
+	game, err := chessanalysis.AnalyzeGame(testPgn, chessanalysis.WithEngineFactory((&chessanalysis.FakeEngine{}).NewEngine))
+	if err != nil {
+		t.Fatalf("failed to analyze game: %v", err)
+	}
+	body, err := json.Marshal(game)
+	if err != nil {
+		t.Fatalf("failed to marshal game: %v", err)
+	}
+
+	response, err := http.Post(server.URL+"/export/gif", "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("failed to export GIF: %v", err)
+	}
+	defer response.Body.Close()
+	animation, err := gif.DecodeAll(response.Body)
+	if err != nil {
+		t.Fatalf("failed to decode GIF (%s): %v", response.Status, err)
+	}
+	if len(animation.Image) != 8 {
+		t.Errorf("expected 8 frames, got %d", len(animation.Image))
+	}
+}
+
+func TestExportRequestSize(t *testing.T) {
+	server := newTestServer(t)
+	// Whitespace keeps the decoder reading until the body is cut off
+	body := `{"moves": [` + strings.Repeat(" ", maxRequestSize) + `]}`
+	for _, path := range []string{"/export/anki", "/export/gif"} {
+		response, err := http.Post(server.URL+path, "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("failed to post to %s: %v", path, err)
+		}
+		response.Body.Close()
+		if response.StatusCode != http.StatusRequestEntityTooLarge {
+			t.Errorf("expected %s to refuse an oversized body, got %s", path, response.Status)
+		}
+	}
+}
+
+func TestParseMonths(t *testing.T) {
+	months, err := parseMonths("2023-11..2024-02, 2024-06")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, month := range months {
+		got = append(got, month.Format("2006-01"))
+	}
+	if strings.Join(got, ",") != "2023-11,2023-12,2024-01,2024-02,2024-06" {
+		t.Errorf("unexpected months %v", got)
+	}
+	for _, spec := range []string{"2024-13", "2024-03..2024-01", "January"} {
+		if _, err := parseMonths(spec); err == nil {
+			t.Errorf("expected %q to be rejected", spec)
+		}
+	}
+}